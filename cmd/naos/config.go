@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Dophin2009/nao/internal/naos"
+	"github.com/Dophin2009/nao/pkg/db"
+	log "github.com/sirupsen/logrus"
+)
+
+// configUsage is printed when the config command is given no valid
+// subcommand.
+const configUsage = `usage: naos config <command> [arguments]
+
+commands:
+  validate [file]
+
+Config files are read from the standard directories if no file is given.`
+
+// config checks config files without starting the server, as it is run
+// before the configuration is read.
+func config(args []string) {
+	if len(args) == 0 || args[0] != "validate" || len(args) > 2 {
+		log.Fatal(configUsage)
+		return
+	}
+
+	var err error
+	if len(args) == 2 {
+		_, err = naos.ReadConfigFile(args[1])
+	} else {
+		_, err = naos.ReadConfigs()
+	}
+
+	var verr *db.ValidationError
+	if errors.As(err, &verr) {
+		for _, f := range verr.Fields {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", f.Path, f.Message)
+		}
+		log.Fatalf("Found %d invalid config properties", len(verr.Fields))
+		return
+	}
+	if err != nil {
+		log.Fatalf("Failed to read config: %v", err)
+		return
+	}
+	log.Println("Config is valid")
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/Dophin2009/nao/internal/naos"
+	log "github.com/sirupsen/logrus"
+)
+
+// dedupe deletes the relations that duplicate older relations, which may
+// have been created before their uniqueness was enforced.
+func dedupe(conf *naos.Configuration, _ []string) {
+	ds, err := naos.NewDataService(conf, false)
+	if err != nil {
+		log.Fatalf("Failed to initialize data layer: %v", err)
+		return
+	}
+	defer ds.Database.Close()
+
+	deleted, err := naos.Dedupe(ds)
+	if err != nil {
+		log.Fatalf("Failed to dedupe relations: %v", err)
+		return
+	}
+
+	n := 0
+	for bucket, ids := range deleted {
+		for _, id := range ids {
+			log.WithFields(log.Fields{
+				"bucket": bucket,
+				"id":     id,
+			}).Info("Deleted duplicate")
+		}
+		n += len(ids)
+	}
+	log.Printf("Deleted %d duplicates", n)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/Dophin2009/nao/internal/naos"
+	log "github.com/sirupsen/logrus"
+)
+
+// fsck checks the relation buckets of the database for inconsistencies and
+// logs each one found, fixing them if the --fix flag is given. Missing buckets
+// are created if the --fix flag is given, even if db.verifybuckets is set.
+func fsck(conf *naos.Configuration, args []string) {
+	flags := flag.NewFlagSet("fsck", flag.ExitOnError)
+	fix := flags.Bool("fix", false, "delete dangling and duplicate relations and clear invalid values")
+	flags.Parse(args)
+	if *fix {
+		conf.DB.VerifyBuckets = false
+	}
+
+	ds, err := naos.NewDataService(conf, false)
+	if err != nil {
+		log.Fatalf("Failed to initialize data layer: %v", err)
+		return
+	}
+	defer ds.Database.Close()
+
+	rep, err := naos.CheckIntegrity(ds, *fix, nil)
+	if err != nil {
+		log.Fatalf("Failed to check integrity: %v", err)
+		return
+	}
+
+	for bucket, n := range rep.Checked {
+		log.WithFields(log.Fields{
+			"bucket": bucket,
+			"count":  n,
+		}).Info("Checked records")
+	}
+	for _, issue := range rep.Issues {
+		log.WithFields(log.Fields{
+			"bucket": issue.Bucket,
+			"id":     issue.ID,
+			"kind":   issue.Kind,
+			"fixed":  issue.Fixed,
+		}).Warn(issue.Description)
+	}
+	log.Printf("Found %d issues", len(rep.Issues))
+}
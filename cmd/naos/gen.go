@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/Dophin2009/nao/internal/naos"
+	log "github.com/sirupsen/logrus"
+)
+
+// gen synthesizes fake Media and Users with their lists into the empty
+// database for load and UI testing.
+func gen(conf *naos.Configuration, args []string) {
+	flags := flag.NewFlagSet("gen", flag.ExitOnError)
+	var opts naos.GenerateOptions
+	flags.IntVar(&opts.Media, "media", 1000, "number of Media to generate")
+	flags.IntVar(&opts.Users, "users", 100, "number of Users to generate")
+	flags.Int64Var(&opts.Seed, "seed", 1, "seed of the random choices")
+	flags.IntVar(&opts.BatchSize, "batch", naos.DefaultGenerateBatchSize,
+		"number of Media or Users generated per transaction")
+	flags.StringVar(&opts.Password, "password", naos.DefaultGeneratePassword,
+		"password of the generated Users")
+	flags.Parse(args)
+
+	ds, err := naos.NewDataService(conf, false)
+	if err != nil {
+		log.Fatalf("Failed to initialize data layer: %v", err)
+		return
+	}
+	defer ds.Database.Close()
+
+	counts, err := naos.Generate(ds, opts)
+	if err != nil {
+		log.Fatalf("Failed to generate data: %v", err)
+		return
+	}
+
+	fields := log.Fields{}
+	for bucket, n := range counts {
+		fields[bucket] = n
+	}
+	log.WithFields(fields).Info("Generated data")
+}
@@ -8,6 +8,7 @@ import (
 
 	log "github.com/sirupsen/logrus"
 	"github.com/Dophin2009/nao/internal/naos"
+	"github.com/Dophin2009/nao/pkg/server"
 )
 
 // TODO: Parse command line flags
@@ -20,6 +21,12 @@ func main() {
 		FullTimestamp: true,
 	})
 
+	// Check configuration files instead of reading them
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		config(os.Args[2:])
+		return
+	}
+
 	// Read configuration files
 	conf, err := naos.ReadConfigs()
 	if err != nil {
@@ -27,24 +34,38 @@ func main() {
 		return
 	}
 
-	s, err := naos.NewApplication(conf)
+	// Run subcommands instead of the server
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "dedupe":
+			dedupe(conf, os.Args[2:])
+			return
+		case "fsck":
+			fsck(conf, os.Args[2:])
+			return
+		case "gen":
+			gen(conf, os.Args[2:])
+			return
+		case "seed":
+			seed(conf, os.Args[2:])
+			return
+		case "user":
+			user(conf, os.Args[2:])
+			return
+		}
+	}
+
+	s, err := server.New(conf)
 	if err != nil {
-		log.Fatalf("Failed to initialize application: %v", err)
+		log.Fatalf("Failed to initialize server: %v", err)
+		return
+	}
+
+	err = s.Start()
+	if err != nil {
+		log.Fatalf("Failed to start server: %v", err)
 		return
 	}
-	defer s.DataLayer.Database.Close()
-
-	// Launch server in goroutine
-	shttp := s.HTTPServer()
-	go func() {
-		log.WithFields(log.Fields{
-			"address": shttp.Addr,
-		}).Info("Launching server")
-		err := shttp.ListenAndServe()
-		if err != nil {
-			log.Fatal(err)
-		}
-	}()
 
 	// Wait for SIGINTERRUPT signal
 	wait := time.Second * 15
@@ -55,7 +76,10 @@ func main() {
 	// Wait for processes to end, then shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), wait)
 	defer cancel()
-	shttp.Shutdown(ctx)
+	err = s.Shutdown(ctx)
+	if err != nil {
+		log.Errorf("Failed to shut down server: %v", err)
+	}
 
 	println()
 	log.Println("Exiting...")
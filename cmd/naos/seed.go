@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/Dophin2009/nao/internal/naos"
+	log "github.com/sirupsen/logrus"
+)
+
+// seed loads the fixtures files, or directories of them, given as arguments
+// into the database, or those in the configured seed directory if none are
+// given. With -empty, or without arguments, only the empty buckets are
+// loaded.
+func seed(conf *naos.Configuration, args []string) {
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	onlyEmpty := flags.Bool("empty", false, "load only the empty buckets")
+	flags.Parse(args)
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		if conf.DB.SeedDir == "" {
+			log.Fatal("No fixtures files given or seed directory configured")
+			return
+		}
+		paths = []string{conf.DB.SeedDir}
+		*onlyEmpty = true
+	}
+
+	ds, err := naos.NewDataService(conf, false)
+	if err != nil {
+		log.Fatalf("Failed to initialize data layer: %v", err)
+		return
+	}
+	defer ds.Database.Close()
+
+	if *onlyEmpty {
+		n, err := naos.SeedEmpty(ds, paths...)
+		if err != nil {
+			log.Fatalf("Failed to seed database: %v", err)
+			return
+		}
+		log.WithFields(log.Fields{
+			"paths":    len(paths),
+			"entities": n,
+		}).Info("Seeded empty buckets of database")
+		return
+	}
+
+	refs, err := naos.Seed(ds, paths...)
+	if err != nil {
+		log.Fatalf("Failed to seed database: %v", err)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"paths": len(paths),
+		"refs":  len(refs),
+	}).Info("Seeded database")
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/naos"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// userUsage is printed when the user command is given no valid subcommand.
+const userUsage = `usage: naos user <command> [arguments]
+
+commands:
+  create [-email email] [-role role] [-password password] username
+  list
+  set-password [-password password] username
+  set-role username role
+  disable [-enable] username
+
+Passwords not given by flag are read from the first line of stdin.`
+
+// user manages the User accounts in the database directly, so that the first
+// Admin can be created before the server is running.
+func user(conf *naos.Configuration, args []string) {
+	if len(args) == 0 {
+		log.Fatal(userUsage)
+		return
+	}
+
+	var run func(ds *graphql.DataService, args []string) error
+	switch args[0] {
+	case "create":
+		run = userCreate
+	case "list":
+		run = userList
+	case "set-password":
+		run = userSetPassword
+	case "set-role":
+		run = userSetRole
+	case "disable":
+		run = userDisable
+	default:
+		log.Fatalf("Unknown user command %q\n%s", args[0], userUsage)
+		return
+	}
+
+	ds, err := naos.NewDataService(conf, false)
+	if err != nil {
+		log.Fatalf("Failed to initialize data layer: %v", err)
+		return
+	}
+	defer ds.Database.Close()
+
+	err = run(ds, args[1:])
+	if err != nil {
+		log.Fatalf("Failed to run user %s: %v", args[0], err)
+		return
+	}
+}
+
+func userCreate(ds *graphql.DataService, args []string) error {
+	flags := flag.NewFlagSet("user create", flag.ExitOnError)
+	email := flags.String("email", "", "email of the User")
+	roleName := flags.String("role", "User", "role of the User: User, Moderator or Admin")
+	password := flags.String("password", "", "password of the User")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected a username")
+	}
+
+	perms, err := parseRolePermission(*roleName)
+	if err != nil {
+		return err
+	}
+	pass, err := readPassword(*password)
+	if err != nil {
+		return err
+	}
+
+	u := models.User{
+		Username:    flags.Arg(0),
+		Email:       *email,
+		Password:    []byte(pass),
+		Permissions: perms,
+	}
+	err = ds.Database.Transaction(true, func(tx db.Tx) error {
+		_, err := ds.UserService.Create(&u, tx)
+		if err != nil {
+			return fmt.Errorf("failed to create User: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"id":       u.Meta.ID,
+		"username": u.Username,
+		"role":     u.Permissions.Role(),
+	}).Info("Created User")
+	return nil
+}
+
+func userList(ds *graphql.DataService, args []string) error {
+	flags := flag.NewFlagSet("user list", flag.ExitOnError)
+	flags.Parse(args)
+
+	var list []*models.User
+	err := ds.Database.Transaction(false, func(tx db.Tx) error {
+		var err error
+		list, err = ds.UserService.GetAll(nil, nil, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get Users: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSERNAME\tEMAIL\tROLE\tDISABLED")
+	for _, u := range list {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%t\n",
+			u.Meta.ID, u.Username, u.Email, u.Permissions.Role(), u.Disabled)
+	}
+	return w.Flush()
+}
+
+func userSetPassword(ds *graphql.DataService, args []string) error {
+	flags := flag.NewFlagSet("user set-password", flag.ExitOnError)
+	password := flags.String("password", "", "new password of the User")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected a username")
+	}
+
+	pass, err := readPassword(*password)
+	if err != nil {
+		return err
+	}
+
+	return updateUser(ds, flags.Arg(0), func(u *models.User, tx db.Tx) error {
+		return ds.UserService.ChangePassword(u.Meta.ID, pass, tx)
+	})
+}
+
+func userSetRole(ds *graphql.DataService, args []string) error {
+	flags := flag.NewFlagSet("user set-role", flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		return fmt.Errorf("expected a username and a role")
+	}
+
+	perms, err := parseRolePermission(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	return updateUser(ds, flags.Arg(0), func(u *models.User, tx db.Tx) error {
+		u.Permissions = perms
+		return ds.UserService.Update(u, tx)
+	})
+}
+
+func userDisable(ds *graphql.DataService, args []string) error {
+	flags := flag.NewFlagSet("user disable", flag.ExitOnError)
+	enable := flags.Bool("enable", false, "enable the User again instead")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected a username")
+	}
+
+	return updateUser(ds, flags.Arg(0), func(u *models.User, tx db.Tx) error {
+		u.Disabled = !*enable
+		return ds.UserService.Update(u, tx)
+	})
+}
+
+// updateUser applies the given update to the User with the given username.
+func updateUser(
+	ds *graphql.DataService, username string,
+	update func(u *models.User, tx db.Tx) error,
+) error {
+	var u *models.User
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		var err error
+		u, err = ds.UserService.GetByUsername(username, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get User by username %q: %w", username, err)
+		}
+
+		err = update(u, tx)
+		if err != nil {
+			return fmt.Errorf("failed to update User %q: %w", username, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"id":       u.Meta.ID,
+		"username": u.Username,
+		"role":     u.Permissions.Role(),
+		"disabled": u.Disabled,
+	}).Info("Updated User")
+	return nil
+}
+
+// parseRolePermission returns the permissions of the Role with the given
+// name.
+func parseRolePermission(name string) (models.UserPermission, error) {
+	var role models.Role
+	err := role.UnmarshalGQL(name)
+	if err != nil {
+		return models.UserPermission{}, fmt.Errorf("failed to parse role: %w", err)
+	}
+	return models.RolePermission(role)
+}
+
+// readPassword returns the given password, or the first line of stdin if it
+// is empty.
+func readPassword(password string) (string, error) {
+	if password != "" {
+		return password, nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		if err != nil {
+			return "", fmt.Errorf("failed to read password from stdin: %w", err)
+		}
+		return "", fmt.Errorf("password must not be empty")
+	}
+	return line, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/Dophin2009/nao/internal/naos"
+	log "github.com/sirupsen/logrus"
+)
+
+// naosmigrate re-keys and re-encodes all records in the naos database with
+// the key encoding and codecs selected in the configuration files, and
+// migrates the relationships of media relations to their enum values.
+func main() {
+	log.SetFormatter(&log.TextFormatter{
+		FullTimestamp: true,
+	})
+
+	// Read configuration files
+	conf, err := naos.ReadConfigs()
+	if err != nil {
+		log.Fatalf("Failed to read config: %v", err)
+		return
+	}
+
+	// Records are re-keyed before the data layer is created, as it refuses
+	// databases keyed in another encoding
+	rekeyed, err := naos.Rekey(conf)
+	if err != nil {
+		log.Fatalf("Failed to re-key records: %v", err)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"keyencoding": conf.DB.KeyEncoding,
+		"count":       rekeyed,
+	}).Info("Re-keyed records")
+
+	ds, err := naos.NewDataService(conf, false)
+	if err != nil {
+		log.Fatalf("Failed to initialize data layer: %v", err)
+		return
+	}
+	defer ds.Database.Close()
+
+	err = naos.Reencode(ds)
+	if err != nil {
+		log.Fatalf("Failed to re-encode records: %v", err)
+		return
+	}
+
+	log.Println("Re-encoded all records")
+
+	rewritten, created, err := naos.MigrateMediaRelations(ds)
+	if err != nil {
+		log.Fatalf("Failed to migrate media relations: %v", err)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"rewritten": rewritten,
+		"inverses":  created,
+	}).Info("Migrated media relations")
+}
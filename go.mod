@@ -1,22 +1,71 @@
 module github.com/Dophin2009/nao
 
-go 1.12
+go 1.20
 
 require (
 	github.com/99designs/gqlgen v0.11.3
 	github.com/adrg/xdg v0.2.1
-	github.com/alexkohler/nakedret v1.0.0 // indirect
-	github.com/alexkohler/nargs v0.0.0-20190601183533-5ef696e27c16 // indirect
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/friendsofgo/graphiql v0.2.2
+	github.com/golang/protobuf v1.5.3
+	github.com/hashicorp/go-hclog v0.9.2
+	github.com/hashicorp/raft v1.1.1
+	github.com/ikawaha/kagome-dict/ipa v1.0.10
+	github.com/ikawaha/kagome/v2 v2.8.0
 	github.com/joho/godotenv v1.3.0
-	github.com/json-iterator/go v1.1.8
+	github.com/json-iterator/go v1.1.12
 	github.com/julienschmidt/httprouter v1.2.0
+	github.com/mitchellh/mapstructure v1.1.2
+	github.com/mozillazg/go-pinyin v0.20.0
 	github.com/rs/cors v1.7.0
-	github.com/sirupsen/logrus v1.2.0
+	github.com/sirupsen/logrus v1.5.0
 	github.com/spf13/viper v1.4.0
 	github.com/vektah/gqlparser v1.2.0
 	github.com/vektah/gqlparser/v2 v2.0.1
+	github.com/vmihailenco/msgpack v4.0.4+incompatible
+	github.com/yuin/gopher-lua v1.1.1
 	go.etcd.io/bbolt v1.3.3
-	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550
+	go.opentelemetry.io/otel v1.24.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.24.0
+	go.opentelemetry.io/otel/sdk v1.24.0
+	go.opentelemetry.io/otel/trace v1.24.0
+	go.opentelemetry.io/proto/otlp v1.1.0
+	golang.org/x/crypto v0.16.0
+	golang.org/x/text v0.14.0
+	google.golang.org/grpc v1.61.1
+	google.golang.org/protobuf v1.32.0
+	gopkg.in/yaml.v2 v2.4.0
+)
+
+require (
+	github.com/agnivade/levenshtein v1.0.3 // indirect
+	github.com/alexkohler/nakedret v1.0.0 // indirect
+	github.com/alexkohler/nargs v0.0.0-20190601183533-5ef696e27c16 // indirect
+	github.com/armon/go-metrics v0.3.3 // indirect
+	github.com/cenkalti/backoff/v4 v4.2.1 // indirect
+	github.com/fsnotify/fsnotify v1.4.7 // indirect
+	github.com/go-logr/logr v1.4.1 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/gorilla/websocket v1.4.0 // indirect
+	github.com/grpc-ecosystem/grpc-gateway/v2 v2.19.0 // indirect
+	github.com/hashicorp/go-immutable-radix v1.2.0 // indirect
+	github.com/hashicorp/go-msgpack v0.5.5 // indirect
+	github.com/hashicorp/golang-lru v0.5.0 // indirect
+	github.com/hashicorp/hcl v1.0.0 // indirect
+	github.com/ikawaha/kagome-dict v1.0.9 // indirect
+	github.com/ikawaha/kagome-dict/uni v1.1.3 // indirect
+	github.com/magiconair/properties v1.8.0 // indirect
+	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
+	github.com/modern-go/reflect2 v1.0.2 // indirect
+	github.com/pelletier/go-toml v1.2.0 // indirect
+	github.com/spf13/afero v1.1.2 // indirect
+	github.com/spf13/cast v1.3.0 // indirect
+	github.com/spf13/jwalterweatherman v1.0.0 // indirect
+	github.com/spf13/pflag v1.0.3 // indirect
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace v1.24.0 // indirect
+	go.opentelemetry.io/otel/metric v1.24.0 // indirect
+	golang.org/x/net v0.19.0 // indirect
+	golang.org/x/sys v0.17.0 // indirect
+	google.golang.org/genproto/googleapis/api v0.0.0-20240102182953-50ed04b92917 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240102182953-50ed04b92917 // indirect
 )
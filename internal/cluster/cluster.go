@@ -0,0 +1,328 @@
+// Package cluster runs a database as a node of a cluster that stays
+// available while a majority of its nodes are up. Writes are committed
+// through a Raft log and applied to the database of every node; requests to
+// nodes other than the leader are forwarded to it.
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/hashicorp/raft"
+	json "github.com/json-iterator/go"
+)
+
+// ApplyTimeout is the longest a write waits to be committed through the
+// Raft log.
+const ApplyTimeout = 10 * time.Second
+
+// Peer is the addresses of a node of the cluster.
+type Peer struct {
+	// Raft is the host:port address the node's Raft transport listens on.
+	Raft string `mapstructure:"raft" json:"raft"`
+	// HTTP is the base URL of the node's HTTP server, such as
+	// http://10.0.0.2:8080, that requests are forwarded to while it leads.
+	HTTP string `mapstructure:"http" json:"http"`
+}
+
+// Config defines a set of options for a node of a cluster.
+type Config struct {
+	// ID is the ID of the node among Peers.
+	ID string
+	// Dir is the directory the Raft log and snapshots of the node are kept
+	// in.
+	Dir string
+	// Peers are all the nodes of the cluster, including this one, by ID.
+	Peers map[string]Peer
+	// Transport is the Raft transport of the node, which reaches the others
+	// by their Raft addresses; a TCP transport on the Raft address of the
+	// node if nil.
+	Transport raft.Transport
+	// LogOutput receives the logs of Raft; os.Stderr if nil.
+	LogOutput io.Writer
+}
+
+// Cluster is a node of a cluster, which applies the Raft log to its
+// database.
+type Cluster struct {
+	ID    string
+	Peers map[string]Peer
+
+	raft   *raft.Raft
+	store  *store
+	trans  raft.Transport
+	driver *driver
+}
+
+// New starts the node of the cluster given in the configuration in front of
+// the given database driver, bootstrapping the cluster with all its peers on
+// first start. The driver must support replication, backups and restores,
+// and writes to it must be recorded with db.RecordReplication.
+func New(conf Config, inner db.DatabaseDriver) (*Cluster, error) {
+	self, ok := conf.Peers[conf.ID]
+	if !ok {
+		return nil, fmt.Errorf("node %q is not among peers: %w", conf.ID, db.ErrInvalid)
+	}
+	rd, ok := inner.(db.ReplicationDriver)
+	if !ok {
+		return nil, errors.New("database driver does not support replication")
+	}
+	if _, ok := inner.(db.RestoreDriver); !ok {
+		return nil, errors.New("database driver does not support restores")
+	}
+	if _, ok := inner.(db.BackupDriver); !ok {
+		return nil, errors.New("database driver does not support backups")
+	}
+
+	logOutput := conf.LogOutput
+	if logOutput == nil {
+		logOutput = os.Stderr
+	}
+
+	err := os.MkdirAll(conf.Dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Raft directory: %w", err)
+	}
+	st, err := openStore(filepath.Join(conf.Dir, "raft.db"))
+	if err != nil {
+		return nil, err
+	}
+	snaps, err := raft.NewFileSnapshotStore(conf.Dir, 2, logOutput)
+	if err != nil {
+		st.Close()
+		return nil, fmt.Errorf("failed to open Raft snapshot store: %w", err)
+	}
+
+	trans := conf.Transport
+	if trans == nil {
+		addr, err := net.ResolveTCPAddr("tcp", self.Raft)
+		if err != nil {
+			st.Close()
+			return nil, fmt.Errorf("failed to resolve Raft address: %w", err)
+		}
+		trans, err = raft.NewTCPTransport(self.Raft, addr, 3, ApplyTimeout, logOutput)
+		if err != nil {
+			st.Close()
+			return nil, fmt.Errorf("failed to create Raft transport: %w", err)
+		}
+	}
+
+	rc := raft.DefaultConfig()
+	rc.LocalID = raft.ServerID(conf.ID)
+	rc.LogOutput = logOutput
+	// The database already holds the writes applied before a restart; the
+	// log since the last snapshot is applied over them again
+	rc.NoSnapshotRestoreOnStart = true
+
+	c := &Cluster{
+		ID:    conf.ID,
+		Peers: conf.Peers,
+		store: st,
+		trans: trans,
+	}
+	c.driver = &driver{DatabaseDriver: inner, cluster: c}
+
+	existing, err := raft.HasExistingState(st, st, snaps)
+	if err != nil {
+		c.close()
+		return nil, fmt.Errorf("failed to read Raft state: %w", err)
+	}
+	if !existing {
+		servers := []raft.Server{}
+		for _, id := range c.peerIDs() {
+			servers = append(servers, raft.Server{
+				ID:      raft.ServerID(id),
+				Address: raft.ServerAddress(conf.Peers[id].Raft),
+			})
+		}
+		err = raft.BootstrapCluster(rc, st, st, snaps, trans,
+			raft.Configuration{Servers: servers})
+		if err != nil {
+			c.close()
+			return nil, fmt.Errorf("failed to bootstrap cluster: %w", err)
+		}
+	}
+
+	c.raft, err = raft.NewRaft(rc, &fsm{driver: inner, replication: rd}, st, st, snaps, trans)
+	if err != nil {
+		c.close()
+		return nil, fmt.Errorf("failed to start Raft: %w", err)
+	}
+	return c, nil
+}
+
+// Database returns the driver of the database of the node, which commits
+// writes through the Raft log. Writes are refused with data.ErrUnavailable
+// on nodes other than the leader.
+func (c *Cluster) Database() db.DatabaseDriver {
+	return c.driver
+}
+
+// Leader returns the ID of the leader of the cluster, or an empty string if
+// there is none.
+func (c *Cluster) Leader() string {
+	addr := c.raft.Leader()
+	if addr == "" {
+		return ""
+	}
+	for id, p := range c.Peers {
+		if raft.ServerAddress(p.Raft) == addr {
+			return id
+		}
+	}
+	return ""
+}
+
+// IsLeader returns whether the node is the leader of the cluster.
+func (c *Cluster) IsLeader() bool {
+	return c.raft.State() == raft.Leader
+}
+
+// Status is the state of a node of a cluster.
+type Status struct {
+	ID string `json:"id"`
+	// State is one of Follower, Candidate, Leader and Shutdown.
+	State string `json:"state"`
+	// Leader is the ID of the leader, empty if there is none.
+	Leader string `json:"leader"`
+	// LastIndex is the index of the last entry of the Raft log of the node,
+	// and AppliedIndex that of the last applied to its database.
+	LastIndex    uint64          `json:"lastIndex"`
+	AppliedIndex uint64          `json:"appliedIndex"`
+	Peers        map[string]Peer `json:"peers"`
+}
+
+// Status returns the state of the node.
+func (c *Cluster) Status() Status {
+	return Status{
+		ID:           c.ID,
+		State:        c.raft.State().String(),
+		Leader:       c.Leader(),
+		LastIndex:    c.raft.LastIndex(),
+		AppliedIndex: c.raft.AppliedIndex(),
+		Peers:        c.Peers,
+	}
+}
+
+// Close leaves the cluster and closes the Raft log of the node, but not its
+// database.
+func (c *Cluster) Close() error {
+	err := c.raft.Shutdown().Error()
+	if err != nil {
+		c.close()
+		return fmt.Errorf("failed to shut down Raft: %w", err)
+	}
+	return c.close()
+}
+
+// close closes the transport and store of the node.
+func (c *Cluster) close() error {
+	if closer, ok := c.trans.(raft.WithClose); ok {
+		closer.Close()
+	}
+	return c.store.Close()
+}
+
+// peerIDs returns the IDs of the peers in order.
+func (c *Cluster) peerIDs() []string {
+	ids := make([]string, 0, len(c.Peers))
+	for id := range c.Peers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// errCommitThroughLog is returned by the logic of the transactions of writes
+// to roll them back once they are recorded, as they are committed through the
+// Raft log instead.
+var errCommitThroughLog = errors.New("committed through the Raft log")
+
+// write runs the given logic in a writable transaction of the database that
+// is rolled back, and commits the writes recorded in it through the Raft
+// log. The functions registered with db.OnCommit are called once the writes
+// are applied on the node. Writes are serialized, so that each sees those
+// before it.
+func (c *Cluster) write(logic func(db.Tx) error) error {
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+
+	// Apply the writes committed by previous leaders first
+	if c.IsLeader() && c.raft.AppliedIndex() < c.raft.LastIndex() {
+		err := c.raft.Barrier(ApplyTimeout).Error()
+		if err != nil {
+			return fmt.Errorf("failed to apply Raft log: %w", err)
+		}
+	}
+
+	var entries []db.ReplicationEntry
+	ctx := &tx{}
+	err := c.driver.DatabaseDriver.Transaction(true, func(inner db.Tx) error {
+		pos, err := db.TxReplicationPosition(inner)
+		if err != nil {
+			return err
+		}
+
+		ctx.Tx = inner
+		err = logic(ctx)
+		if err != nil {
+			return err
+		}
+
+		entries, err = db.TxReplicationLog(inner, pos)
+		if err != nil {
+			return err
+		}
+		return errCommitThroughLog
+	})
+	if !errors.Is(err, errCommitThroughLog) {
+		return err
+	}
+
+	if len(entries) > 0 {
+		if !c.IsLeader() {
+			return fmt.Errorf("node is not the leader of the cluster: %w", data.ErrUnavailable)
+		}
+		cmd, err := json.Marshal(entries)
+		if err != nil {
+			return fmt.Errorf("failed to encode writes: %w", err)
+		}
+		f := c.raft.Apply(cmd, ApplyTimeout)
+		err = f.Error()
+		if errors.Is(err, raft.ErrNotLeader) || errors.Is(err, raft.ErrLeadershipLost) {
+			return fmt.Errorf("%v: %w", err, data.ErrUnavailable)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to commit writes through Raft log: %w", err)
+		}
+		if err, ok := f.Response().(error); ok && err != nil {
+			return fmt.Errorf("failed to apply writes: %w", err)
+		}
+	}
+
+	for _, f := range ctx.committed {
+		f()
+	}
+	return nil
+}
+
+// tx is a writable transaction of a cluster, whose commit hooks are called
+// once its writes are applied through the Raft log.
+type tx struct {
+	db.Tx
+	committed []func()
+}
+
+// OnCommit registers the given function to be called once the writes of the
+// transaction are applied.
+func (t *tx) OnCommit(f func()) {
+	t.committed = append(t.committed, f)
+}
@@ -0,0 +1,141 @@
+package cluster_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/cluster"
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/hashicorp/raft"
+)
+
+// TestCluster tests that writes to the leader of a cluster are committed
+// through the Raft log and applied on every node, and that writes to other
+// nodes are refused.
+func TestCluster(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nao-cluster")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	peers := map[string]cluster.Peer{
+		"a": {Raft: "a"},
+		"b": {Raft: "b"},
+	}
+	_, ta := raft.NewInmemTransport("a")
+	_, tb := raft.NewInmemTransport("b")
+	ta.Connect("b", tb)
+	tb.Connect("a", ta)
+
+	nodes := map[string]*graphql.DataService{}
+	clusters := map[string]*cluster.Cluster{}
+	for id, trans := range map[string]raft.Transport{"a": ta, "b": tb} {
+		ds, _, cleanup := naostest.NewDataService(t)
+		defer cleanup()
+
+		db.RecordReplication(ds.Lifecycle, 0)
+		clu, err := cluster.New(cluster.Config{
+			ID:        id,
+			Dir:       dir + "/" + id,
+			Peers:     peers,
+			Transport: trans,
+			LogOutput: ioutil.Discard,
+		}, ds.Database.DatabaseDriver)
+		if err != nil {
+			t.Fatalf("failed to start node %s: %v", id, err)
+		}
+		ds.Database.DatabaseDriver = clu.Database()
+		nodes[id], clusters[id] = ds, clu
+	}
+
+	var leader string
+	for deadline := time.Now().Add(10 * time.Second); leader == ""; {
+		if time.Now().After(deadline) {
+			t.Fatalf("no leader elected")
+		}
+		time.Sleep(50 * time.Millisecond)
+		leader = clusters["a"].Leader()
+	}
+	follower := "a"
+	if leader == "a" {
+		follower = "b"
+	}
+
+	committed := 0
+	nodes[leader].Lifecycle.RegisterCommitted(nodes[leader].GenreService.Bucket(),
+		db.AfterCreate, func(db.Model, db.Service) { committed++ })
+
+	var id int
+	err = nodes[leader].Database.Transaction(true, func(tx db.Tx) error {
+		id, err = nodes[leader].GenreService.Create(&models.Genre{
+			Names: []models.Title{{String: "Mecha", Language: "en"}},
+		}, tx)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to create Genre on leader: %v", err)
+	}
+	if committed != 1 {
+		t.Errorf("expected commit hook called once, got %d", committed)
+	}
+
+	// Failed transactions write nothing
+	err = nodes[leader].Database.Transaction(true, func(tx db.Tx) error {
+		_, err := nodes[leader].GenreService.Create(&models.Genre{
+			Names: []models.Title{{String: "Isekai", Language: "en"}},
+		}, tx)
+		if err != nil {
+			return err
+		}
+		return errors.New("aborted")
+	})
+	if err == nil || err.Error() != "aborted" {
+		t.Fatalf("expected aborted transaction, got %v", err)
+	}
+
+	for deadline := time.Now().Add(10 * time.Second); ; {
+		st := clusters[follower].Status()
+		if st.AppliedIndex >= clusters[leader].Status().LastIndex {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("follower did not apply Raft log: %+v", st)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	for _, ds := range nodes {
+		err = ds.Database.Transaction(false, func(tx db.Tx) error {
+			genres, err := ds.GenreService.GetAll(nil, nil, tx)
+			if err != nil {
+				return err
+			}
+			if len(genres) != 1 || genres[0].Meta.ID != id ||
+				genres[0].Names[0].String != "Mecha" {
+				t.Errorf("expected only Genre Mecha with ID %d, got %v", id, genres)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("failed to get Genres: %v", err)
+		}
+	}
+
+	err = nodes[follower].Database.Transaction(true, func(tx db.Tx) error {
+		_, err := nodes[follower].GenreService.Create(&models.Genre{
+			Names: []models.Title{{String: "Isekai", Language: "en"}},
+		}, tx)
+		return err
+	})
+	if !errors.Is(err, data.ErrUnavailable) {
+		t.Errorf("expected write to follower to be unavailable, got %v", err)
+	}
+}
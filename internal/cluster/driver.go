@@ -0,0 +1,98 @@
+package cluster
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// driver is the DatabaseDriver of a node of a cluster, which commits the
+// writes to the database in front of which it is through the Raft log.
+type driver struct {
+	db.DatabaseDriver
+	cluster *Cluster
+	mu      sync.Mutex
+}
+
+// Transaction begins a transaction and passes it to the given function.
+// Writable transactions are committed through the Raft log.
+func (d *driver) Transaction(writable bool, logic func(db.Tx) error) error {
+	if !writable {
+		return d.DatabaseDriver.Transaction(false, logic)
+	}
+	return d.cluster.write(logic)
+}
+
+// Close leaves the cluster and closes the database.
+func (d *driver) Close() error {
+	err := d.cluster.Close()
+	if err != nil {
+		d.DatabaseDriver.Close()
+		return err
+	}
+	return d.DatabaseDriver.Close()
+}
+
+// CountAll returns the number of persisted instances of a Model type.
+func (d *driver) CountAll(ser db.Service, tx db.Tx) (int, error) {
+	if cd, ok := d.DatabaseDriver.(db.CountDriver); ok {
+		return cd.CountAll(ser, tx)
+	}
+
+	vlist, err := d.GetRawAll(ser, tx)
+	if err != nil {
+		return 0, err
+	}
+	return len(vlist), nil
+}
+
+// Backup writes a consistent copy of the database of the node to the given
+// writer.
+func (d *driver) Backup(w io.Writer) (int64, error) {
+	return d.DatabaseDriver.(db.BackupDriver).Backup(w)
+}
+
+// BackupSize returns the size of a backup of the database of the node.
+func (d *driver) BackupSize() (int64, error) {
+	return d.DatabaseDriver.(db.BackupDriver).BackupSize()
+}
+
+// Stats returns the statistics of the database of the node.
+func (d *driver) Stats() (*db.Stats, error) {
+	sd, ok := d.DatabaseDriver.(db.StatsDriver)
+	if !ok {
+		return nil, errors.New("database driver does not support stats")
+	}
+	return sd.Stats()
+}
+
+// VerifyBuckets returns the names of the buckets missing from the database
+// of the node, creating them if repair is true.
+func (d *driver) VerifyBuckets(repair bool) ([]string, error) {
+	bv, ok := d.DatabaseDriver.(db.BucketVerifier)
+	if !ok {
+		return nil, errors.New("database driver does not support verifying buckets")
+	}
+	return bv.VerifyBuckets(repair)
+}
+
+// ReplicationLog returns at most limit entries of the replication log of the
+// database of the node after the given sequence number. Entries are only
+// kept while the writes they record are committed through the Raft log.
+func (d *driver) ReplicationLog(after uint64, limit int) ([]db.ReplicationEntry, error) {
+	return d.DatabaseDriver.(db.ReplicationDriver).ReplicationLog(after, limit)
+}
+
+// ApplyReplication refuses to apply entries other than those of the Raft
+// log.
+func (d *driver) ApplyReplication(entries []db.ReplicationEntry) error {
+	return errors.New("writes to a cluster are applied through the Raft log")
+}
+
+// ReplicationPosition returns the number of writes applied to the database
+// of the node.
+func (d *driver) ReplicationPosition() (uint64, error) {
+	return d.DatabaseDriver.(db.ReplicationDriver).ReplicationPosition()
+}
@@ -0,0 +1,84 @@
+package cluster
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/hashicorp/raft"
+	json "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+)
+
+// fsm applies the Raft log to the database of a node. Each entry of the log
+// is the writes of a transaction, as recorded in the replication log of the
+// leader.
+type fsm struct {
+	driver      db.DatabaseDriver
+	replication db.ReplicationDriver
+}
+
+// Apply applies the writes of the given entry of the Raft log in a single
+// transaction, returning the error if they fail to apply. The writes are
+// numbered after those already applied, so that the entries applied again
+// after a restart follow them too and leave the database as it was.
+func (f *fsm) Apply(l *raft.Log) interface{} {
+	var entries []db.ReplicationEntry
+	err := json.Unmarshal(l.Data, &entries)
+	if err != nil {
+		return fmt.Errorf("failed to decode writes of Raft log entry %d: %w", l.Index, err)
+	}
+
+	pos, err := f.replication.ReplicationPosition()
+	if err != nil {
+		return fmt.Errorf("failed to get replication position: %w", err)
+	}
+	for i := range entries {
+		entries[i].Seq = pos + uint64(i) + 1
+	}
+
+	err = f.replication.ApplyReplication(entries)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"index": l.Index,
+		}).Errorf("Failed to apply Raft log entry: %v", err)
+		return fmt.Errorf("failed to apply Raft log entry %d: %w", l.Index, err)
+	}
+	return nil
+}
+
+// Snapshot returns a snapshot of the database, taken as it is persisted.
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	return &snapshot{backup: f.driver.(db.BackupDriver)}, nil
+}
+
+// Restore replaces the contents of the database with those of the given
+// snapshot.
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	err := f.driver.(db.RestoreDriver).Restore(rc)
+	if err != nil {
+		return fmt.Errorf("failed to restore snapshot: %w", err)
+	}
+	return nil
+}
+
+// snapshot is a snapshot of the database of a node. As the writes applied
+// meanwhile may be included, it is only consistent once the entries of the
+// Raft log after it are applied over it.
+type snapshot struct {
+	backup db.BackupDriver
+}
+
+// Persist writes a backup of the database to the given sink.
+func (s *snapshot) Persist(sink raft.SnapshotSink) error {
+	_, err := s.backup.Backup(sink)
+	if err != nil {
+		sink.Cancel()
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return sink.Close()
+}
+
+// Release does nothing, as the snapshot holds no resources.
+func (s *snapshot) Release() {}
@@ -0,0 +1,70 @@
+package cluster
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/web"
+)
+
+// HeaderForwardedBy is the HTTP header set on the requests forwarded to the
+// leader to the ID of the node forwarding them, which are never forwarded
+// again.
+const HeaderForwardedBy = "X-Nao-Forwarded-By"
+
+// ErrorNoLeader is the error message of the responses to the requests that
+// could not be forwarded, as the cluster has no leader.
+const ErrorNoLeader = "cluster has no leader"
+
+// Handler returns a handler that forwards to the leader the requests that
+// may write, that is those of methods other than GET, HEAD and OPTIONS, and
+// those of authenticated callers, so that they read their own writes. Other
+// requests, and those to paths with any of the given suffixes, are passed to
+// the given handler. Requests are refused with 503 Service Unavailable while
+// there is no leader.
+func (c *Cluster) Handler(next http.Handler, local ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.IsLeader() || !c.forwards(r, local) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		leader := c.Leader()
+		if leader == "" {
+			web.EncodeResponseErrorFor(ErrorNoLeader,
+				fmt.Errorf("no leader to forward to: %w", data.ErrUnavailable), w)
+			return
+		}
+		target, err := url.Parse(c.Peers[leader].HTTP)
+		if err != nil {
+			web.EncodeResponseErrorFor(web.ErrorInternalServer,
+				fmt.Errorf("HTTP address of leader %q: %w", leader, err), w)
+			return
+		}
+
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		r.Header.Set(HeaderForwardedBy, c.ID)
+		proxy.ServeHTTP(w, r)
+	})
+}
+
+// forwards returns whether the given request is forwarded to the leader.
+func (c *Cluster) forwards(r *http.Request, local []string) bool {
+	if r.Header.Get(HeaderForwardedBy) != "" {
+		return false
+	}
+	for _, suffix := range local {
+		if strings.HasSuffix(r.URL.Path, suffix) {
+			return false
+		}
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return r.Header.Get("Authorization") != ""
+	}
+	return true
+}
@@ -0,0 +1,171 @@
+package cluster
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/raft"
+	json "github.com/json-iterator/go"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketLogs   = []byte("logs")
+	bucketStable = []byte("stable")
+)
+
+// errKeyNotFound is returned for missing keys of the stable store, with the
+// message raft expects.
+var errKeyNotFound = errors.New("not found")
+
+// store keeps the Raft log and the stable state of a node in a boltDB file of
+// its own, apart from the database the log is applied to.
+type store struct {
+	db *bolt.DB
+}
+
+// openStore opens the boltDB file at the given path as a Raft store.
+func openStore(path string) (*store, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Raft store: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketLogs, bucketStable} {
+			_, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create Raft store buckets: %w", err)
+	}
+	return &store{db: db}, nil
+}
+
+// Close closes the store.
+func (s *store) Close() error {
+	return s.db.Close()
+}
+
+// FirstIndex returns the index of the first log entry, or 0 if there are none.
+func (s *store) FirstIndex() (uint64, error) {
+	var idx uint64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		k, _ := tx.Bucket(bucketLogs).Cursor().First()
+		if k != nil {
+			idx = binary.BigEndian.Uint64(k)
+		}
+		return nil
+	})
+	return idx, err
+}
+
+// LastIndex returns the index of the last log entry, or 0 if there are none.
+func (s *store) LastIndex() (uint64, error) {
+	var idx uint64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		k, _ := tx.Bucket(bucketLogs).Cursor().Last()
+		if k != nil {
+			idx = binary.BigEndian.Uint64(k)
+		}
+		return nil
+	})
+	return idx, err
+}
+
+// GetLog reads the log entry at the given index into l.
+func (s *store) GetLog(index uint64, l *raft.Log) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketLogs).Get(uint64Key(index))
+		if v == nil {
+			return raft.ErrLogNotFound
+		}
+		return json.Unmarshal(v, l)
+	})
+}
+
+// StoreLog stores the given log entry.
+func (s *store) StoreLog(l *raft.Log) error {
+	return s.StoreLogs([]*raft.Log{l})
+}
+
+// StoreLogs stores the given log entries in a single transaction.
+func (s *store) StoreLogs(logs []*raft.Log) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketLogs)
+		for _, l := range logs {
+			v, err := json.Marshal(l)
+			if err != nil {
+				return fmt.Errorf("failed to encode log entry: %w", err)
+			}
+			err = b.Put(uint64Key(l.Index), v)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteRange deletes the log entries between the given indexes, inclusive.
+func (s *store) DeleteRange(min, max uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketLogs).Cursor()
+		for k, _ := c.Seek(uint64Key(min)); k != nil; k, _ = c.Next() {
+			if binary.BigEndian.Uint64(k) > max {
+				break
+			}
+			err := c.Delete()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Set sets the given key of the stable state.
+func (s *store) Set(k []byte, v []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketStable).Put(k, v)
+	})
+}
+
+// Get returns the value of the given key of the stable state.
+func (s *store) Get(k []byte) ([]byte, error) {
+	var v []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		stored := tx.Bucket(bucketStable).Get(k)
+		if stored == nil {
+			return errKeyNotFound
+		}
+		v = append([]byte{}, stored...)
+		return nil
+	})
+	return v, err
+}
+
+// SetUint64 sets the given key of the stable state to an integer.
+func (s *store) SetUint64(k []byte, v uint64) error {
+	return s.Set(k, uint64Key(v))
+}
+
+// GetUint64 returns the integer value of the given key of the stable state.
+func (s *store) GetUint64(k []byte) (uint64, error) {
+	v, err := s.Get(k)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(v), nil
+}
+
+func uint64Key(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
@@ -4,28 +4,55 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 )
 
 // ReadConfigs reads config files in the given directories with the given
-// filename (without extension). The overall config is unmarshalled into the
-// given pointer.
-func ReadConfigs(filename string, dirs []string, structure interface{}) error {
+// filename (without extension), in any format supported by viper, such as
+// YAML and TOML. The overall config is unmarshalled into the given pointer,
+// with the given defaults for keys, such as "db.path", not set in the files.
+// Keys of the files that are not in the structure are errors.
+func ReadConfigs(
+	filename string, dirs []string, defaults map[string]interface{},
+	structure interface{},
+) error {
+	v := viper.New()
+	v.SetConfigName(filename)
+	for _, d := range dirs {
+		v.AddConfigPath(d)
+	}
+	return read(v, defaults, structure)
+}
+
+// ReadConfigFile reads the config file at the given path, whose format is
+// given by its extension, as ReadConfigs does.
+func ReadConfigFile(
+	path string, defaults map[string]interface{}, structure interface{},
+) error {
+	v := viper.New()
+	v.SetConfigFile(path)
+	return read(v, defaults, structure)
+}
+
+func read(v *viper.Viper, defaults map[string]interface{}, structure interface{}) error {
 	if structure == nil {
 		return fmt.Errorf("structure: %w", errors.New("is nil"))
 	}
 
-	viper.SetConfigName(filename)
-	for _, d := range dirs {
-		viper.AddConfigPath(d)
+	for key, value := range defaults {
+		v.SetDefault(key, value)
 	}
 
-	err := viper.ReadInConfig()
+	err := v.ReadInConfig()
 	if err != nil {
 		return fmt.Errorf("failed to read in configs: %w", err)
 	}
 
-	err = viper.Unmarshal(structure)
+	// Unknown keys are reported by name, as are those of the wrong type
+	err = v.Unmarshal(structure, func(dc *mapstructure.DecoderConfig) {
+		dc.ErrorUnused = true
+	})
 	if err != nil {
 		return fmt.Errorf("failed to unmarshal config: %w", err)
 	}
@@ -0,0 +1,57 @@
+package config_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/config"
+)
+
+type testConfig struct {
+	Name    string `mapstructure:"name"`
+	Retries int    `mapstructure:"retries"`
+	DB      struct {
+		Path  string `mapstructure:"path"`
+		Codec string `mapstructure:"codec"`
+	} `mapstructure:"db"`
+}
+
+var testDefaults = map[string]interface{}{
+	"retries":  3,
+	"db.codec": "json",
+}
+
+// TestReadConfigFile tests that YAML and TOML files are read over the
+// defaults.
+func TestReadConfigFile(t *testing.T) {
+	for _, name := range []string{"yaml", "toml"} {
+		var c testConfig
+		err := config.ReadConfigFile(filepath.Join("testdata", "app."+name), testDefaults, &c)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if c.Name != name || c.DB.Path != "/var/lib/app.db" {
+			t.Errorf("%s: expected properties of file, got %+v", name, c)
+		}
+		if c.Retries != 3 || c.DB.Codec != "json" {
+			t.Errorf("%s: expected defaults, got %+v", name, c)
+		}
+	}
+}
+
+// TestReadConfigFileInvalid tests that unknown keys and values of the wrong
+// type are errors naming them.
+func TestReadConfigFileInvalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown.yaml":  "codex",
+		"mistyped.yaml": "retries",
+	}
+	for file, key := range tests {
+		var c testConfig
+		err := config.ReadConfigFile(filepath.Join("testdata", file), testDefaults, &c)
+		if err == nil || !strings.Contains(err.Error(), key) {
+			t.Errorf("%s: expected error naming %q, got %v", file, key, err)
+		}
+	}
+}
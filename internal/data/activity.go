@@ -0,0 +1,356 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// DefaultActivityFeedSize is the number of Activities kept per User if not
+// configured.
+const DefaultActivityFeedSize = 200
+
+// ActivityService performs operations on Activity, the feed of events of
+// each User.
+type ActivityService struct {
+	UserService *UserService
+	// FeedSize is the number of most recent Activities kept per User; older
+	// ones are deleted as new ones are recorded. DefaultActivityFeedSize is
+	// used if not positive.
+	FeedSize int
+	Hooks    db.PersistHooks
+}
+
+// NewActivityService returns an ActivityService.
+func NewActivityService(hooks db.PersistHooks, userService *UserService) *ActivityService {
+	return &ActivityService{
+		UserService: userService,
+		Hooks:       hooks,
+	}
+}
+
+// Track adds hooks to the given services that record Activities for the
+// UserMedia completed or scored and the UserMedia added to lists through
+// them.
+func (ser *ActivityService) Track(ums *UserMediaService, umls *UserMediaListService) {
+	recordUserMedia := func(um *models.UserMedia, old *models.UserMedia, tx db.Tx) error {
+		completed := um.Status != nil && *um.Status == models.WatchStatusCompleted
+		if completed && (old == nil || old.Status == nil || *old.Status != *um.Status) {
+			err := ser.record(&models.Activity{
+				UserID:      um.UserID,
+				Kind:        models.ActivityKindCompleted,
+				MediaID:     um.MediaID,
+				UserMediaID: um.Meta.ID,
+			}, tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		if um.Score != nil && (old == nil || old.Score == nil || *old.Score != *um.Score) {
+			score := *um.Score
+			err := ser.record(&models.Activity{
+				UserID:      um.UserID,
+				Kind:        models.ActivityKindScored,
+				MediaID:     um.MediaID,
+				UserMediaID: um.Meta.ID,
+				Score:       &score,
+			}, tx)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	umHooks := ums.PersistHooks()
+	umHooks.PostCreateHooks = append(umHooks.PostCreateHooks,
+		func(m db.Model, _ db.Service, tx db.Tx) error {
+			um, err := ums.AssertType(m)
+			if err != nil {
+				return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+			}
+			return recordUserMedia(um, nil, tx)
+		})
+	// Pre-update hooks still see the old value in the database
+	umHooks.PreUpdateHooks = append(umHooks.PreUpdateHooks,
+		func(m db.Model, _ db.Service, tx db.Tx) error {
+			um, err := ums.AssertType(m)
+			if err != nil {
+				return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+			}
+			old, err := ums.GetByID(um.Meta.ID, tx)
+			if err != nil {
+				return fmt.Errorf("failed to get UserMedia by ID %d: %w", um.Meta.ID, err)
+			}
+			return recordUserMedia(um, old, tx)
+		})
+
+	recordList := func(uml *models.UserMediaList, old *models.UserMediaList, tx db.Tx) error {
+		existing := map[int]bool{}
+		if old != nil {
+			for _, id := range old.UserMedia {
+				existing[id] = true
+			}
+		}
+
+		for _, umID := range uml.UserMedia {
+			if existing[umID] {
+				continue
+			}
+			existing[umID] = true
+
+			um, err := ums.GetByID(umID, tx)
+			if err != nil {
+				return fmt.Errorf("failed to get UserMedia by ID %d: %w", umID, err)
+			}
+			listID := uml.Meta.ID
+			err = ser.record(&models.Activity{
+				UserID:          uml.UserID,
+				Kind:            models.ActivityKindAddedToList,
+				MediaID:         um.MediaID,
+				UserMediaID:     umID,
+				UserMediaListID: &listID,
+			}, tx)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	umlHooks := umls.PersistHooks()
+	umlHooks.PostCreateHooks = append(umlHooks.PostCreateHooks,
+		func(m db.Model, _ db.Service, tx db.Tx) error {
+			uml, err := umls.AssertType(m)
+			if err != nil {
+				return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+			}
+			return recordList(uml, nil, tx)
+		})
+	umlHooks.PreUpdateHooks = append(umlHooks.PreUpdateHooks,
+		func(m db.Model, _ db.Service, tx db.Tx) error {
+			uml, err := umls.AssertType(m)
+			if err != nil {
+				return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+			}
+			old, err := umls.GetByID(uml.Meta.ID, tx)
+			if err != nil {
+				return fmt.Errorf("failed to get UserMediaList by ID %d: %w",
+					uml.Meta.ID, err)
+			}
+			return recordList(uml, old, tx)
+		})
+}
+
+// record persists the given Activity and deletes the oldest Activities of its
+// User beyond the feed size.
+func (ser *ActivityService) record(a *models.Activity, tx db.Tx) error {
+	_, err := ser.Create(a, tx)
+	if err != nil {
+		return fmt.Errorf("failed to record %s Activity for User with ID %d: %w",
+			a.Kind, a.UserID, err)
+	}
+
+	size := ser.FeedSize
+	if size <= 0 {
+		size = DefaultActivityFeedSize
+	}
+
+	list, err := ser.GetByUser(a.UserID, nil, nil, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get Activities of User with ID %d: %w", a.UserID, err)
+	}
+	if len(list) <= size {
+		return nil
+	}
+	for _, old := range list[size:] {
+		err = ser.Delete(old.Meta.ID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to delete Activity with ID %d: %w", old.Meta.ID, err)
+		}
+	}
+	return nil
+}
+
+// Create persists the given Activity.
+func (ser *ActivityService) Create(a *models.Activity, tx db.Tx) (int, error) {
+	return tx.Database().Create(a, ser, tx)
+}
+
+// Delete deletes the Activity with the given ID.
+func (ser *ActivityService) Delete(id int, tx db.Tx) error {
+	return tx.Database().Delete(id, ser, tx)
+}
+
+// GetByID retrieves the persisted Activity with the given ID.
+func (ser *ActivityService) GetByID(id int, tx db.Tx) (*models.Activity, error) {
+	m, err := tx.Database().GetByID(id, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return a, nil
+}
+
+// GetFeed retrieves the persisted Activities that pass the filter, newest
+// first.
+func (ser *ActivityService) GetFeed(
+	first *int, skip *int, tx db.Tx, keep func(a *models.Activity) bool,
+) ([]*models.Activity, error) {
+	vlist, err := tx.Database().GetFilter(nil, nil, ser, tx,
+		func(m db.Model) bool {
+			a, err := ser.AssertType(m)
+			if err != nil {
+				return false
+			}
+			return keep(a)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to Activities: %w", err)
+	}
+
+	// IDs are not necessarily assigned in order, so sort by creation time
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Meta.CreatedAt.After(list[j].Meta.CreatedAt)
+	})
+
+	if skip != nil && *skip > 0 {
+		if *skip > len(list) {
+			return []*models.Activity{}, nil
+		}
+		list = list[*skip:]
+	}
+	if first != nil && *first >= 0 && *first < len(list) {
+		list = list[:*first]
+	}
+	return list, nil
+}
+
+// GetByUser retrieves the persisted Activities of the User with the given ID,
+// newest first.
+func (ser *ActivityService) GetByUser(
+	uID int, first *int, skip *int, tx db.Tx,
+) ([]*models.Activity, error) {
+	return ser.GetFeed(first, skip, tx, func(a *models.Activity) bool {
+		return a.UserID == uID
+	})
+}
+
+// Bucket returns the name of the bucket for Activity.
+func (ser *ActivityService) Bucket() string {
+	return "Activity"
+}
+
+// Clean cleans the given Activity for storage.
+func (ser *ActivityService) Clean(m db.Model, _ db.Tx) error {
+	_, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return nil
+}
+
+// Validate returns an error if the Activity is not valid for the database.
+func (ser *ActivityService) Validate(m db.Model, tx db.Tx) error {
+	e, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	var verr ValidationError
+	if !e.Kind.IsValid() {
+		verr.Addf("Kind", FieldInvalid, "unknown kind %d", e.Kind)
+	}
+	err = verr.Err()
+	if err != nil {
+		return err
+	}
+
+	// Check if User with ID specified in Activity exists
+	_, err = tx.Database().GetRawByID(e.UserID, ser.UserService, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get User with ID %d: %w", e.UserID, err)
+	}
+	return nil
+}
+
+// Initialize sets initial values for some properties.
+func (ser *ActivityService) Initialize(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistOldProperties maintains certain properties of the existing Activity
+// in updates.
+func (ser *ActivityService) PersistOldProperties(_ db.Model, _ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistHooks returns the persistence hook functions.
+func (ser *ActivityService) PersistHooks() *db.PersistHooks {
+	return &ser.Hooks
+}
+
+// Marshal encodes the given Activity for storage.
+func (ser *ActivityService) Marshal(m db.Model) ([]byte, error) {
+	a, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	v, err := db.Codecs.Encode(ser.Bucket(), a)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
+	}
+
+	return v, nil
+}
+
+// Unmarshal decodes the given record into Activity.
+func (ser *ActivityService) Unmarshal(buf []byte) (db.Model, error) {
+	var a models.Activity
+	err := db.Codecs.Decode(buf, &a)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
+	}
+	return &a, nil
+}
+
+// AssertType exposes the given db.Model as an Activity.
+func (ser *ActivityService) AssertType(m db.Model) (*models.Activity, error) {
+	if m == nil {
+		return nil, fmt.Errorf("model: %w", errNil)
+	}
+
+	a, ok := m.(*models.Activity)
+	if !ok {
+		return nil, fmt.Errorf("model: %w", errors.New("not of Activity type"))
+	}
+	return a, nil
+}
+
+// mapFromModel returns a list of Activity type asserted from the given list of
+// db.Model.
+func (ser *ActivityService) mapFromModel(vlist []db.Model) ([]*models.Activity, error) {
+	list := make([]*models.Activity, len(vlist))
+	var err error
+	for i, v := range vlist {
+		list[i], err = ser.AssertType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,447 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// EpisodeAiringService performs operations on EpisodeAiring, the index of
+// the dated Episodes of Media by the date they air.
+type EpisodeAiringService struct {
+	MediaService      *MediaService
+	EpisodeService    *EpisodeService
+	EpisodeSetService *EpisodeSetService
+	UserMediaService  *UserMediaService
+	Hooks             db.PersistHooks
+}
+
+// NewEpisodeAiringService returns an EpisodeAiringService. The Episodes of
+// Media are read through the given UserMediaService, in the order used for
+// progress.
+func NewEpisodeAiringService(
+	hooks db.PersistHooks, mediaService *MediaService,
+	episodeService *EpisodeService, episodeSetService *EpisodeSetService,
+	userMediaService *UserMediaService,
+) *EpisodeAiringService {
+	// Initialize EpisodeAiringService
+	episodeAiringService := &EpisodeAiringService{
+		MediaService:      mediaService,
+		EpisodeService:    episodeService,
+		EpisodeSetService: episodeSetService,
+		UserMediaService:  userMediaService,
+		Hooks:             hooks,
+	}
+
+	// Add hooks to keep the Episodes of Media indexed as their sets change
+	indexSet := func(m db.Model, _ db.Service, tx db.Tx) error {
+		set, err := episodeSetService.AssertType(m)
+		if err != nil {
+			return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+		err = episodeAiringService.index(set.MediaID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to index Episodes of Media with ID %d: %w",
+				set.MediaID, err)
+		}
+		return nil
+	}
+	setSerHooks := episodeSetService.PersistHooks()
+	setSerHooks.PostCreateHooks = append(setSerHooks.PostCreateHooks, indexSet)
+	setSerHooks.PostUpdateHooks = append(setSerHooks.PostUpdateHooks, indexSet)
+	setSerHooks.PostDeleteHooks = append(setSerHooks.PostDeleteHooks, indexSet)
+
+	// Add hooks to keep Episodes indexed as their dates change
+	indexEpisode := func(m db.Model, _ db.Service, tx db.Tx) error {
+		epID := m.Metadata().ID
+		sets, err := episodeSetService.GetFilter(nil, nil, tx,
+			func(set *models.EpisodeSet) bool {
+				return indexOfInt(set.Episodes, epID) >= 0
+			})
+		if err != nil {
+			return fmt.Errorf("failed to get EpisodeSets of Episode with ID %d: %w",
+				epID, err)
+		}
+		for _, set := range sets {
+			err = episodeAiringService.index(set.MediaID, tx)
+			if err != nil {
+				return fmt.Errorf("failed to index Episodes of Media with ID %d: %w",
+					set.MediaID, err)
+			}
+		}
+		return nil
+	}
+	unindexEpisode := func(m db.Model, _ db.Service, tx db.Tx) error {
+		epID := m.Metadata().ID
+		err := tx.Database().DeleteFilter(episodeAiringService, tx, func(m db.Model) bool {
+			a, err := episodeAiringService.AssertType(m)
+			return err == nil && a.EpisodeID == epID
+		})
+		if err != nil {
+			return fmt.Errorf("failed to unindex Episode with ID %d: %w", epID, err)
+		}
+		return nil
+	}
+	epSerHooks := episodeService.PersistHooks()
+	epSerHooks.PostUpdateHooks = append(epSerHooks.PostUpdateHooks, indexEpisode)
+	epSerHooks.PreDeleteHooks = append(epSerHooks.PreDeleteHooks, unindexEpisode)
+
+	unindexMedia := func(m db.Model, _ db.Service, tx db.Tx) error {
+		mID := m.Metadata().ID
+		err := episodeAiringService.unindex(mID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to unindex Episodes of Media with ID %d: %w", mID, err)
+		}
+		return nil
+	}
+	mdSerHooks := mediaService.PersistHooks()
+	mdSerHooks.PreDeleteHooks = append(mdSerHooks.PreDeleteHooks, unindexMedia)
+
+	return episodeAiringService
+}
+
+// index replaces the entries of the Media with the given ID by those of its
+// dated Episodes, numbered in the order used for progress. The Media is only
+// removed from the index if it no longer exists.
+func (ser *EpisodeAiringService) index(mID int, tx db.Tx) error {
+	err := ser.unindex(mID, tx)
+	if err != nil {
+		return err
+	}
+
+	u, err := ser.UserMediaService.units(mID, tx)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	entries := []*models.EpisodeAiring{}
+	for i, ep := range u.regular {
+		if ep.Date != nil {
+			entries = append(entries, &models.EpisodeAiring{
+				MediaID: mID, EpisodeID: ep.Meta.ID, Number: i + 1, Date: *ep.Date,
+			})
+		}
+	}
+	for _, ep := range u.specials {
+		if ep.Date != nil {
+			entries = append(entries, &models.EpisodeAiring{
+				MediaID: mID, EpisodeID: ep.Meta.ID, Date: *ep.Date,
+			})
+		}
+	}
+	for _, a := range entries {
+		_, err = ser.Create(a, tx)
+		if err != nil {
+			return fmt.Errorf("failed to create EpisodeAiring: %w", err)
+		}
+	}
+	return nil
+}
+
+// unindex removes the entries of the Media with the given ID from the index.
+func (ser *EpisodeAiringService) unindex(mID int, tx db.Tx) error {
+	err := tx.Database().DeleteFilter(ser, tx, func(m db.Model) bool {
+		a, err := ser.AssertType(m)
+		return err == nil && a.MediaID == mID
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete EpisodeAirings by Media ID %d: %w", mID, err)
+	}
+	return nil
+}
+
+// Reindex rebuilds the index from all persisted EpisodeSets, returning the
+// number of Episodes indexed.
+func (ser *EpisodeAiringService) Reindex(tx db.Tx) (int, error) {
+	err := tx.Database().DeleteFilter(ser, tx, func(db.Model) bool { return true })
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete EpisodeAirings: %w", err)
+	}
+
+	sets, err := ser.EpisodeSetService.GetAll(nil, nil, tx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get EpisodeSets: %w", err)
+	}
+	indexed := map[int]bool{}
+	for _, set := range sets {
+		if indexed[set.MediaID] {
+			continue
+		}
+		indexed[set.MediaID] = true
+		err = ser.index(set.MediaID, tx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to index Episodes of Media with ID %d: %w",
+				set.MediaID, err)
+		}
+	}
+
+	list, err := ser.GetAll(nil, nil, tx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get EpisodeAirings: %w", err)
+	}
+	return len(list), nil
+}
+
+// NextEpisode returns the first Episode of the Media with the given ID that
+// airs after the given time, or an error wrapping ErrNotFound if there is
+// none.
+func (ser *EpisodeAiringService) NextEpisode(
+	mID int, now time.Time, tx db.Tx,
+) (*models.NextEpisode, error) {
+	next, err := ser.next(func(a *models.EpisodeAiring) bool {
+		return a.MediaID == mID
+	}, now, tx)
+	if err != nil {
+		return nil, err
+	}
+	a, ok := next[mID]
+	if !ok {
+		return nil, fmt.Errorf("next Episode of Media with ID %d: %w", mID, ErrNotFound)
+	}
+	return ser.nextEpisode(a, now, tx)
+}
+
+// Upcoming returns the next Episode to air after the given time of each Media
+// the User with the given ID is currently watching, soonest first.
+func (ser *EpisodeAiringService) Upcoming(
+	uID int, now time.Time, tx db.Tx,
+) ([]*models.NextEpisode, error) {
+	umList, err := ser.UserMediaService.GetFilter(nil, nil, tx, func(um *models.UserMedia) bool {
+		return um.UserID == uID &&
+			um.Status != nil && *um.Status == models.WatchStatusCurrent
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get UserMedia by User ID %d: %w", uID, err)
+	}
+	watching := make(map[int]bool, len(umList))
+	for _, um := range umList {
+		watching[um.MediaID] = true
+	}
+
+	next, err := ser.next(func(a *models.EpisodeAiring) bool {
+		return watching[a.MediaID]
+	}, now, tx)
+	if err != nil {
+		return nil, err
+	}
+	airings := make([]*models.EpisodeAiring, 0, len(next))
+	for _, a := range next {
+		airings = append(airings, a)
+	}
+	sort.Slice(airings, func(i, j int) bool {
+		if !airings[i].Date.Equal(airings[j].Date) {
+			return airings[i].Date.Before(airings[j].Date)
+		}
+		return airings[i].MediaID < airings[j].MediaID
+	})
+
+	list := make([]*models.NextEpisode, len(airings))
+	for i, a := range airings {
+		list[i], err = ser.nextEpisode(a, now, tx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+// next returns the first entry to air after the given time of each Media
+// whose entries pass the filter, by Media ID. Of entries that air at the
+// same time, the one of the lowest number comes first.
+func (ser *EpisodeAiringService) next(
+	keep func(*models.EpisodeAiring) bool, now time.Time, tx db.Tx,
+) (map[int]*models.EpisodeAiring, error) {
+	list, err := ser.GetFilter(nil, nil, tx, func(a *models.EpisodeAiring) bool {
+		return a.Date.After(now) && keep(a)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get EpisodeAirings: %w", err)
+	}
+
+	next := map[int]*models.EpisodeAiring{}
+	for _, a := range list {
+		b, ok := next[a.MediaID]
+		if !ok || a.Date.Before(b.Date) || (a.Date.Equal(b.Date) && a.Number < b.Number) {
+			next[a.MediaID] = a
+		}
+	}
+	return next, nil
+}
+
+// nextEpisode returns the given entry along with its Media and Episode.
+func (ser *EpisodeAiringService) nextEpisode(
+	a *models.EpisodeAiring, now time.Time, tx db.Tx,
+) (*models.NextEpisode, error) {
+	md, err := ser.MediaService.GetByID(a.MediaID, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Media with ID %d: %w", a.MediaID, err)
+	}
+	ep, err := ser.EpisodeService.GetByID(a.EpisodeID, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Episode with ID %d: %w", a.EpisodeID, err)
+	}
+	return &models.NextEpisode{
+		Media:           md,
+		Episode:         ep,
+		Number:          a.Number,
+		AirsAt:          a.Date,
+		TimeUntilAiring: int64(a.Date.Sub(now) / time.Second),
+	}, nil
+}
+
+// Create persists the given EpisodeAiring.
+func (ser *EpisodeAiringService) Create(a *models.EpisodeAiring, tx db.Tx) (int, error) {
+	return tx.Database().Create(a, ser, tx)
+}
+
+// Update replaces the value of the EpisodeAiring with the given ID.
+func (ser *EpisodeAiringService) Update(a *models.EpisodeAiring, tx db.Tx) error {
+	return tx.Database().Update(a, ser, tx)
+}
+
+// Delete deletes the EpisodeAiring with the given ID.
+func (ser *EpisodeAiringService) Delete(id int, tx db.Tx) error {
+	return tx.Database().Delete(id, ser, tx)
+}
+
+// GetAll retrieves all persisted values of EpisodeAiring.
+func (ser *EpisodeAiringService) GetAll(
+	first *int, skip *int, tx db.Tx,
+) ([]*models.EpisodeAiring, error) {
+	vlist, err := tx.Database().GetAll(first, skip, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to EpisodeAirings: %w", err)
+	}
+	return list, nil
+}
+
+// GetFilter retrieves all persisted values of EpisodeAiring that pass the
+// filter.
+func (ser *EpisodeAiringService) GetFilter(
+	first *int, skip *int, tx db.Tx, keep func(a *models.EpisodeAiring) bool,
+) ([]*models.EpisodeAiring, error) {
+	vlist, err := tx.Database().GetFilter(first, skip, ser, tx,
+		func(m db.Model) bool {
+			a, err := ser.AssertType(m)
+			if err != nil {
+				return false
+			}
+			return keep(a)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to EpisodeAirings: %w", err)
+	}
+	return list, nil
+}
+
+// Bucket returns the name of the bucket for EpisodeAiring.
+func (ser *EpisodeAiringService) Bucket() string {
+	return "EpisodeAiring"
+}
+
+// Clean cleans the given EpisodeAiring for storage.
+func (ser *EpisodeAiringService) Clean(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// Validate returns an error if the EpisodeAiring is not valid for the
+// database.
+func (ser *EpisodeAiringService) Validate(m db.Model, _ db.Tx) error {
+	a, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	var verr ValidationError
+	if a.Date.IsZero() {
+		verr.Add("Date", FieldRequired, "must not be empty")
+	}
+	return verr.Err()
+}
+
+// Initialize sets initial values for some properties.
+func (ser *EpisodeAiringService) Initialize(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistOldProperties maintains certain properties of the existing
+// EpisodeAiring in updates.
+func (ser *EpisodeAiringService) PersistOldProperties(_ db.Model, _ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistHooks returns the persistence hook functions.
+func (ser *EpisodeAiringService) PersistHooks() *db.PersistHooks {
+	return &ser.Hooks
+}
+
+// Marshal encodes the given EpisodeAiring for storage.
+func (ser *EpisodeAiringService) Marshal(m db.Model) ([]byte, error) {
+	a, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	v, err := db.Codecs.Encode(ser.Bucket(), a)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
+	}
+
+	return v, nil
+}
+
+// Unmarshal decodes the given record into EpisodeAiring.
+func (ser *EpisodeAiringService) Unmarshal(buf []byte) (db.Model, error) {
+	var a models.EpisodeAiring
+	err := db.Codecs.Decode(buf, &a)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
+	}
+	return &a, nil
+}
+
+// AssertType exposes the given db.Model as an EpisodeAiring.
+func (ser *EpisodeAiringService) AssertType(m db.Model) (*models.EpisodeAiring, error) {
+	if m == nil {
+		return nil, fmt.Errorf("model: %w", errNil)
+	}
+
+	a, ok := m.(*models.EpisodeAiring)
+	if !ok {
+		return nil, fmt.Errorf("model: %w", errors.New("not of EpisodeAiring type"))
+	}
+	return a, nil
+}
+
+// mapFromModel returns a list of EpisodeAiring type asserted from the given
+// list of db.Model.
+func (ser *EpisodeAiringService) mapFromModel(
+	vlist []db.Model,
+) ([]*models.EpisodeAiring, error) {
+	list := make([]*models.EpisodeAiring, len(vlist))
+	var err error
+	for i, v := range vlist {
+		list[i], err = ser.AssertType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+	}
+	return list, nil
+}
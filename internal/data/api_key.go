@@ -0,0 +1,356 @@
+package data
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// APIKeyService performs operations on APIKey.
+type APIKeyService struct {
+	UserService *UserService
+	Hooks       db.PersistHooks
+}
+
+// NewAPIKeyService returns an APIKeyService.
+func NewAPIKeyService(
+	hooks db.PersistHooks, userService *UserService,
+) *APIKeyService {
+	// Initialize APIKeyService
+	apiKeyService := &APIKeyService{
+		UserService: userService,
+		Hooks:       hooks,
+	}
+
+	// Add hook to delete APIKey on User deletion
+	deleteAPIKeyOnDeleteUser := func(um db.Model, _ db.Service, tx db.Tx) error {
+		uID := um.Metadata().ID
+		err := apiKeyService.DeleteByUser(uID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to delete APIKey by User ID %d: %w", uID, err)
+		}
+		return nil
+	}
+	uSerHooks := userService.PersistHooks()
+	uSerHooks.PreDeleteHooks =
+		append(uSerHooks.PreDeleteHooks, deleteAPIKeyOnDeleteUser)
+
+	return apiKeyService
+}
+
+const (
+	// APIKeyPrefix starts all API keys, which tells them apart from other
+	// bearer tokens.
+	APIKeyPrefix = "naos_"
+	// apiKeySize is the number of random bytes in API keys.
+	apiKeySize = 24
+	// apiKeyShownLength is the length of the start of API keys kept in the
+	// clear, including APIKeyPrefix.
+	apiKeyShownLength = len(APIKeyPrefix) + 6
+)
+
+// IsAPIKey checks if the given bearer token is an API key rather than a JWT.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// Generate creates an APIKey with the given name and scope for the User with
+// the given ID, and returns it with the key, which is not kept.
+func (ser *APIKeyService) Generate(
+	uID int, name string, scope models.APIKeyScope, tx db.Tx,
+) (string, *models.APIKey, error) {
+	buf := make([]byte, apiKeySize)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	key := APIKeyPrefix + hex.EncodeToString(buf)
+
+	k := models.APIKey{
+		UserID: uID,
+		Name:   name,
+		Scope:  scope,
+		Prefix: key[:apiKeyShownLength],
+		Hash:   hashAPIKey(key),
+	}
+	_, err = ser.Create(&k, tx)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create APIKey: %w", err)
+	}
+	return key, &k, nil
+}
+
+// Authenticate returns the APIKey of the given key. It returns an error
+// wrapping ErrUnauthorized if there is no such APIKey, such as after it was
+// revoked.
+func (ser *APIKeyService) Authenticate(key string, tx db.Tx) (*models.APIKey, error) {
+	hash := hashAPIKey(key)
+	first := 1
+	list, err := ser.GetFilter(&first, nil, tx, func(k *models.APIKey) bool {
+		return subtle.ConstantTimeCompare(k.Hash, hash) == 1
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get APIKeys: %w", err)
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("API key: invalid or revoked: %w", ErrUnauthorized)
+	}
+	return list[0], nil
+}
+
+// Touch marks the APIKey with the given ID as last used at the given time.
+func (ser *APIKeyService) Touch(id int, now time.Time, tx db.Tx) error {
+	k, err := ser.GetByID(id, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get APIKey by ID %d: %w", id, err)
+	}
+	k.LastUsed = &now
+	err = ser.Update(k, tx)
+	if err != nil {
+		return fmt.Errorf("failed to update APIKey with ID %d: %w", id, err)
+	}
+	return nil
+}
+
+// Revoke deletes the APIKey with the given ID of the User with the given ID.
+// It returns an error wrapping ErrNotFound if the User has no such APIKey.
+func (ser *APIKeyService) Revoke(id int, uID int, tx db.Tx) error {
+	k, err := ser.GetByID(id, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get APIKey by ID %d: %w", id, err)
+	}
+	if k.UserID != uID {
+		// Don't reveal the keys of other Users
+		return fmt.Errorf("APIKey with ID %d: %w", id, ErrNotFound)
+	}
+
+	err = ser.Delete(id, tx)
+	if err != nil {
+		return fmt.Errorf("failed to delete APIKey with ID %d: %w", id, err)
+	}
+	return nil
+}
+
+func hashAPIKey(key string) []byte {
+	hash := sha256.Sum256([]byte(key))
+	return hash[:]
+}
+
+// Create persists the given APIKey.
+func (ser *APIKeyService) Create(k *models.APIKey, tx db.Tx) (int, error) {
+	return tx.Database().Create(k, ser, tx)
+}
+
+// Update replaces the value of the APIKey with the given ID.
+func (ser *APIKeyService) Update(k *models.APIKey, tx db.Tx) error {
+	return tx.Database().Update(k, ser, tx)
+}
+
+// Delete deletes the APIKey with the given ID.
+func (ser *APIKeyService) Delete(id int, tx db.Tx) error {
+	return tx.Database().Delete(id, ser, tx)
+}
+
+// DeleteByUser deletes the APIKeys of the User with the given ID.
+func (ser *APIKeyService) DeleteByUser(uID int, tx db.Tx) error {
+	return tx.Database().DeleteFilter(ser, tx, func(m db.Model) bool {
+		k, err := ser.AssertType(m)
+		if err != nil {
+			return false
+		}
+		return k.UserID == uID
+	})
+}
+
+// GetByUser retrieves the APIKeys of the User with the given ID.
+func (ser *APIKeyService) GetByUser(uID int, tx db.Tx) ([]*models.APIKey, error) {
+	return ser.GetFilter(nil, nil, tx, func(k *models.APIKey) bool {
+		return k.UserID == uID
+	})
+}
+
+// GetByID retrieves the persisted APIKey with the given ID.
+func (ser *APIKeyService) GetByID(id int, tx db.Tx) (*models.APIKey, error) {
+	m, err := tx.Database().GetByID(id, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	k, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return k, nil
+}
+
+// GetFilter retrieves all persisted values of APIKey that pass the
+// filter.
+func (ser *APIKeyService) GetFilter(
+	first *int, skip *int, tx db.Tx, keep func(k *models.APIKey) bool,
+) ([]*models.APIKey, error) {
+	vlist, err := tx.Database().GetFilter(first, skip, ser, tx,
+		func(m db.Model) bool {
+			k, err := ser.AssertType(m)
+			if err != nil {
+				return false
+			}
+			return keep(k)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to APIKeys: %w", err)
+	}
+	return list, nil
+}
+
+// GetAll retrieves all persisted values of APIKey.
+func (ser *APIKeyService) GetAll(
+	first *int, skip *int, tx db.Tx,
+) ([]*models.APIKey, error) {
+	vlist, err := tx.Database().GetAll(first, skip, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to APIKeys: %w", err)
+	}
+	return list, nil
+}
+
+// Bucket returns the name of the bucket for APIKey.
+func (ser *APIKeyService) Bucket() string {
+	return "APIKey"
+}
+
+// Clean cleans the given APIKey for storage.
+func (ser *APIKeyService) Clean(m db.Model, _ db.Tx) error {
+	_, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return nil
+}
+
+// Validate returns an error if the APIKey is not valid for the
+// database.
+func (ser *APIKeyService) Validate(m db.Model, tx db.Tx) error {
+	e, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	var verr ValidationError
+	ValidateTags(e, &verr)
+	if !e.Scope.IsValid() {
+		verr.Addf("Scope", FieldInvalid, "unknown scope %s", e.Scope)
+	}
+	err = verr.Err()
+	if err != nil {
+		return err
+	}
+
+	// Check if User with ID specified in APIKey exists
+	_, err = tx.Database().GetRawByID(e.UserID, ser.UserService, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get User with ID %d: %w", e.UserID, err)
+	}
+
+	return nil
+}
+
+// Initialize sets initial values for some properties.
+func (ser *APIKeyService) Initialize(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistOldProperties maintains certain properties of the existing
+// APIKey in updates.
+func (ser *APIKeyService) PersistOldProperties(n db.Model, o db.Model, _ db.Tx) error {
+	nk, err := ser.AssertType(n)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	old, err := ser.AssertType(o)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	// The key itself and its owner may not change
+	nk.UserID = old.UserID
+	nk.Prefix = old.Prefix
+	nk.Hash = old.Hash
+	return nil
+}
+
+// PersistHooks returns the persistence hook functions.
+func (ser *APIKeyService) PersistHooks() *db.PersistHooks {
+	return &ser.Hooks
+}
+
+// Marshal encodes the given APIKey for storage.
+func (ser *APIKeyService) Marshal(m db.Model) ([]byte, error) {
+	k, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	v, err := db.Codecs.Encode(ser.Bucket(), k)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
+	}
+
+	return v, nil
+}
+
+// Unmarshal decodes the given record into APIKey.
+func (ser *APIKeyService) Unmarshal(buf []byte) (db.Model, error) {
+	var k models.APIKey
+	err := db.Codecs.Decode(buf, &k)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
+	}
+	return &k, nil
+}
+
+// AssertType exposes the given db.Model as a APIKey.
+func (ser *APIKeyService) AssertType(m db.Model) (*models.APIKey, error) {
+	if m == nil {
+		return nil, fmt.Errorf("model: %w", errNil)
+	}
+
+	k, ok := m.(*models.APIKey)
+	if !ok {
+		return nil, fmt.Errorf("model: %w", errors.New("not of APIKey type"))
+	}
+	return k, nil
+}
+
+// mapFromModel returns a list of APIKey type asserted from the given
+// list of db.Model.
+func (ser *APIKeyService) mapFromModel(
+	vlist []db.Model,
+) ([]*models.APIKey, error) {
+	list := make([]*models.APIKey, len(vlist))
+	var err error
+	for k, v := range vlist {
+		list[k], err = ser.AssertType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+	}
+	return list, nil
+}
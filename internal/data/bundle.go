@@ -0,0 +1,353 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// MediaBundleService exports Media along with the entities that make up
+// their entries as MediaBundles, and imports them, for sharing entries
+// between instances.
+type MediaBundleService struct {
+	MediaService          *MediaService
+	EpisodeService        *EpisodeService
+	EpisodeSetService     *EpisodeSetService
+	GenreService          *GenreService
+	MediaGenreService     *MediaGenreService
+	CharacterService      *CharacterService
+	PersonService         *PersonService
+	MediaCharacterService *MediaCharacterService
+	MediaStaffService     *MediaStaffService
+	MediaRelationService  *MediaRelationService
+}
+
+// Export returns the MediaBundle of the Media with the given ID.
+func (ser *MediaBundleService) Export(mID int, tx db.Tx) (*models.MediaBundle, error) {
+	md, err := ser.MediaService.GetByID(mID, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Media with ID %d: %w", mID, err)
+	}
+	b := models.MediaBundle{Media: md}
+
+	b.EpisodeSets, err = ser.EpisodeSetService.GetByMedia(mID, nil, nil, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get EpisodeSets by Media ID %d: %w", mID, err)
+	}
+	epIDs := []int{}
+	for _, set := range b.EpisodeSets {
+		epIDs = append(epIDs, set.Episodes...)
+	}
+	b.Episodes, err = ser.EpisodeService.GetMultiple(uniqueInts(epIDs), tx,
+		func(*models.Episode) bool { return true })
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Episodes of Media with ID %d: %w", mID, err)
+	}
+
+	b.MediaGenres, err = ser.MediaGenreService.GetByMedia(mID, nil, nil, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get MediaGenres by Media ID %d: %w", mID, err)
+	}
+	gIDs := make([]int, len(b.MediaGenres))
+	for i, mg := range b.MediaGenres {
+		gIDs[i] = mg.GenreID
+	}
+	b.Genres, err = ser.GenreService.GetMultiple(uniqueInts(gIDs), tx,
+		func(*models.Genre) bool { return true })
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Genres of Media with ID %d: %w", mID, err)
+	}
+
+	b.MediaCharacters, err = ser.MediaCharacterService.GetByMedia(mID, nil, nil, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get MediaCharacters by Media ID %d: %w", mID, err)
+	}
+	b.MediaStaff, err = ser.MediaStaffService.GetByMedia(mID, nil, nil, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get MediaStaff by Media ID %d: %w", mID, err)
+	}
+	cIDs := []int{}
+	pIDs := []int{}
+	for _, mc := range b.MediaCharacters {
+		if mc.CharacterID != nil {
+			cIDs = append(cIDs, *mc.CharacterID)
+		}
+		if mc.PersonID != nil {
+			pIDs = append(pIDs, *mc.PersonID)
+		}
+	}
+	for _, ms := range b.MediaStaff {
+		pIDs = append(pIDs, ms.PersonID)
+	}
+	b.Characters, err = ser.CharacterService.GetMultiple(uniqueInts(cIDs), tx,
+		func(*models.Character) bool { return true })
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Characters of Media with ID %d: %w", mID, err)
+	}
+	b.People, err = ser.PersonService.GetMultiple(uniqueInts(pIDs), tx,
+		func(*models.Person) bool { return true })
+	if err != nil {
+		return nil, fmt.Errorf("failed to get People of Media with ID %d: %w", mID, err)
+	}
+
+	b.MediaRelations, err = ser.MediaRelationService.GetByOwner(mID, nil, nil, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get MediaRelations by Owner ID %d: %w", mID, err)
+	}
+	rIDs := make([]int, len(b.MediaRelations))
+	for i, mr := range b.MediaRelations {
+		rIDs[i] = mr.RelatedID
+	}
+	b.RelatedMedia, err = ser.MediaService.GetMultiple(uniqueInts(rIDs), tx,
+		func(*models.Media) bool { return true })
+	if err != nil {
+		return nil, fmt.Errorf("failed to get related Media of Media with ID %d: %w", mID, err)
+	}
+	return &b, nil
+}
+
+// Import creates the entities of the given MediaBundle with new IDs, to
+// which the references between them are remapped. Slugs are generated anew,
+// and Genres with a name of an existing Genre are linked to that Genre rather
+// than created. MediaRelations are imported if their related Media are
+// found by their ExternalIDs, and skipped otherwise.
+func (ser *MediaBundleService) Import(
+	b *models.MediaBundle, tx db.Tx,
+) (*models.MediaBundleImport, error) {
+	if b.Media == nil {
+		return nil, fmt.Errorf("Media: %w", ErrInvalid)
+	}
+	res := models.MediaBundleImport{IDs: map[string]map[int]int{}}
+	ids := func(bucket string) map[int]int {
+		m, ok := res.IDs[bucket]
+		if !ok {
+			m = map[int]int{}
+			res.IDs[bucket] = m
+		}
+		return m
+	}
+	remap := func(bucket string, id int) (int, error) {
+		n, ok := res.IDs[bucket][id]
+		if !ok {
+			return 0, fmt.Errorf("%s with ID %d: not in bundle: %w", bucket, id, ErrInvalid)
+		}
+		return n, nil
+	}
+
+	md := *b.Media
+	oldID := md.Meta.ID
+	md.Meta = db.ModelMetadata{}
+	md.Slug = ""
+	mID, err := ser.MediaService.Create(&md, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Media: %w", err)
+	}
+	ids(ser.MediaService.Bucket())[oldID] = mID
+	res.MediaID = mID
+
+	for _, ep := range b.Episodes {
+		e := *ep
+		e.Meta = db.ModelMetadata{}
+		id, err := ser.EpisodeService.Create(&e, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Episode %d: %w", ep.Meta.ID, err)
+		}
+		ids(ser.EpisodeService.Bucket())[ep.Meta.ID] = id
+	}
+	for _, set := range b.EpisodeSets {
+		s := *set
+		s.Meta = db.ModelMetadata{}
+		s.MediaID = mID
+		s.Episodes = make([]int, len(set.Episodes))
+		for i, epID := range set.Episodes {
+			s.Episodes[i], err = remap(ser.EpisodeService.Bucket(), epID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		id, err := ser.EpisodeSetService.Create(&s, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create EpisodeSet %d: %w", set.Meta.ID, err)
+		}
+		ids(ser.EpisodeSetService.Bucket())[set.Meta.ID] = id
+	}
+
+	for _, g := range b.Genres {
+		id, err := ser.importGenre(g, tx)
+		if err != nil {
+			return nil, err
+		}
+		ids(ser.GenreService.Bucket())[g.Meta.ID] = id
+	}
+	for _, mg := range b.MediaGenres {
+		gID, err := remap(ser.GenreService.Bucket(), mg.GenreID)
+		if err != nil {
+			return nil, err
+		}
+		id, err := ser.MediaGenreService.Create(&models.MediaGenre{
+			MediaID: mID, GenreID: gID,
+		}, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create MediaGenre %d: %w", mg.Meta.ID, err)
+		}
+		ids(ser.MediaGenreService.Bucket())[mg.Meta.ID] = id
+	}
+
+	for _, c := range b.Characters {
+		ch := *c
+		ch.Meta = db.ModelMetadata{}
+		ch.Slug = ""
+		id, err := ser.CharacterService.Create(&ch, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Character %d: %w", c.Meta.ID, err)
+		}
+		ids(ser.CharacterService.Bucket())[c.Meta.ID] = id
+	}
+	for _, p := range b.People {
+		pr := *p
+		pr.Meta = db.ModelMetadata{}
+		pr.Slug = ""
+		id, err := ser.PersonService.Create(&pr, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Person %d: %w", p.Meta.ID, err)
+		}
+		ids(ser.PersonService.Bucket())[p.Meta.ID] = id
+	}
+	for _, mc := range b.MediaCharacters {
+		c := *mc
+		c.Meta = db.ModelMetadata{}
+		c.MediaID = mID
+		if mc.CharacterID != nil {
+			id, err := remap(ser.CharacterService.Bucket(), *mc.CharacterID)
+			if err != nil {
+				return nil, err
+			}
+			c.CharacterID = &id
+		}
+		if mc.PersonID != nil {
+			id, err := remap(ser.PersonService.Bucket(), *mc.PersonID)
+			if err != nil {
+				return nil, err
+			}
+			c.PersonID = &id
+		}
+		id, err := ser.MediaCharacterService.Create(&c, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create MediaCharacter %d: %w", mc.Meta.ID, err)
+		}
+		ids(ser.MediaCharacterService.Bucket())[mc.Meta.ID] = id
+	}
+	for _, ms := range b.MediaStaff {
+		s := *ms
+		s.Meta = db.ModelMetadata{}
+		s.MediaID = mID
+		s.PersonID, err = remap(ser.PersonService.Bucket(), ms.PersonID)
+		if err != nil {
+			return nil, err
+		}
+		id, err := ser.MediaStaffService.Create(&s, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create MediaStaff %d: %w", ms.Meta.ID, err)
+		}
+		ids(ser.MediaStaffService.Bucket())[ms.Meta.ID] = id
+	}
+
+	res.SkippedRelations = []*models.MediaRelation{}
+	for _, mr := range b.MediaRelations {
+		relatedID, err := ser.relatedMedia(b, mr.RelatedID, tx)
+		if err != nil {
+			return nil, err
+		}
+		if relatedID == 0 {
+			res.SkippedRelations = append(res.SkippedRelations, mr)
+			continue
+		}
+		id, err := ser.MediaRelationService.Create(&models.MediaRelation{
+			OwnerID: mID, RelatedID: relatedID, Relationship: mr.Relationship,
+		}, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create MediaRelation %d: %w", mr.Meta.ID, err)
+		}
+		ids(ser.MediaRelationService.Bucket())[mr.Meta.ID] = id
+	}
+	return &res, nil
+}
+
+// importGenre returns the ID of the Genre that shares a name with the given
+// one, creating the given Genre if there is none.
+func (ser *MediaBundleService) importGenre(g *models.Genre, tx db.Tx) (int, error) {
+	same, err := ser.GenreService.GetFilter(nil, nil, tx, func(o *models.Genre) bool {
+		for _, n := range g.Names {
+			for _, on := range o.Names {
+				if n.Language == on.Language &&
+					strings.EqualFold(strings.TrimSpace(n.String), strings.TrimSpace(on.String)) {
+					return true
+				}
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get Genres: %w", err)
+	}
+	if len(same) > 0 {
+		return same[0].Meta.ID, nil
+	}
+
+	ng := *g
+	ng.Meta = db.ModelMetadata{}
+	id, err := ser.GenreService.Create(&ng, tx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create Genre %d: %w", g.Meta.ID, err)
+	}
+	return id, nil
+}
+
+// relatedMedia returns the ID of the Media of the importing instance with the
+// ExternalID of the related Media of the given MediaBundle with the given ID,
+// or 0 if there is none.
+func (ser *MediaBundleService) relatedMedia(
+	b *models.MediaBundle, id int, tx db.Tx,
+) (int, error) {
+	var extID string
+	for _, md := range b.RelatedMedia {
+		if md.Meta.ID == id {
+			extID = md.ExternalID
+			break
+		}
+	}
+	if extID == "" {
+		return 0, nil
+	}
+
+	m, err := tx.Database().FindFirst(ser.MediaService, tx, func(m db.Model) (bool, error) {
+		v, err := ser.MediaService.Key(MediaKeyExternalID, m)
+		if err != nil {
+			return false, err
+		}
+		return v == extID, nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to find Media by ExternalID %q: %w", extID, err)
+	}
+	if m == nil {
+		return 0, nil
+	}
+	return m.Metadata().ID, nil
+}
+
+// uniqueInts returns the given values without repeats, in order of first
+// appearance.
+func uniqueInts(list []int) []int {
+	unique := []int{}
+	seen := map[int]bool{}
+	for _, v := range list {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,316 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// ChangeService performs operations on Change, the log of modifications made
+// to other persisted entities.
+type ChangeService struct {
+	Hooks db.PersistHooks
+}
+
+// NewChangeService returns a ChangeService.
+func NewChangeService(hooks db.PersistHooks) *ChangeService {
+	return &ChangeService{
+		Hooks: hooks,
+	}
+}
+
+// Track adds hooks to the given service that record a Change for every
+// entity created, updated, or deleted through it.
+func (ser *ChangeService) Track(tracked db.Service) {
+	ser.TrackOwned(tracked, nil)
+}
+
+// TrackOwned adds hooks to the given service of entities owned by Users that
+// record a Change for every entity created, updated, or deleted through it,
+// along with the ID of its User given by owner. A nil owner records Changes
+// to public entities, as Track does.
+func (ser *ChangeService) TrackOwned(
+	tracked db.Service, owner func(m db.Model) (int, error),
+) {
+	record := func(action models.ChangeAction) db.PersistHookFunc {
+		return func(m db.Model, s db.Service, tx db.Tx) error {
+			c := models.Change{
+				Bucket:   s.Bucket(),
+				EntityID: m.Metadata().ID,
+				Action:   action,
+			}
+			if owner != nil {
+				uID, err := owner(m)
+				if err != nil {
+					return fmt.Errorf("failed to get owner of %s with ID %d: %w",
+						c.Bucket, c.EntityID, err)
+				}
+				c.UserID = uID
+			}
+			_, err := ser.Create(&c, tx)
+			if err != nil {
+				return fmt.Errorf("failed to record %s Change for %s with ID %d: %w",
+					action, c.Bucket, c.EntityID, err)
+			}
+			return nil
+		}
+	}
+
+	hooks := tracked.PersistHooks()
+	hooks.PostCreateHooks =
+		append(hooks.PostCreateHooks, record(models.ChangeActionCreate))
+	hooks.PostUpdateHooks =
+		append(hooks.PostUpdateHooks, record(models.ChangeActionUpdate))
+	hooks.PostDeleteHooks =
+		append(hooks.PostDeleteHooks, record(models.ChangeActionDelete))
+}
+
+// Create persists the given Change.
+func (ser *ChangeService) Create(c *models.Change, tx db.Tx) (int, error) {
+	return tx.Database().Create(c, ser, tx)
+}
+
+// Update replaces the value of the Change with the given ID.
+func (ser *ChangeService) Update(c *models.Change, tx db.Tx) error {
+	return tx.Database().Update(c, ser, tx)
+}
+
+// Attribute attributes the latest Change recorded for the entity with the
+// given ID in the given bucket, such as the one of an update in the same
+// transaction, to the User with the given ID. Nothing is attributed if no
+// Change was recorded.
+func (ser *ChangeService) Attribute(bucket string, id int, uID int, tx db.Tx) error {
+	list, err := ser.GetFilter(nil, nil, tx, func(c *models.Change) bool {
+		return c.Bucket == bucket && c.EntityID == id
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get Changes of %s with ID %d: %w", bucket, id, err)
+	}
+	if len(list) == 0 {
+		return nil
+	}
+
+	latest := list[0]
+	for _, c := range list[1:] {
+		if c.Meta.CreatedAt.After(latest.Meta.CreatedAt) ||
+			(c.Meta.CreatedAt.Equal(latest.Meta.CreatedAt) && c.Meta.ID > latest.Meta.ID) {
+			latest = c
+		}
+	}
+	latest.AuthorID = uID
+	err = ser.Update(latest, tx)
+	if err != nil {
+		return fmt.Errorf("failed to update Change with ID %d: %w", latest.Meta.ID, err)
+	}
+	return nil
+}
+
+// Delete deletes the Change with the given ID.
+func (ser *ChangeService) Delete(id int, tx db.Tx) error {
+	return tx.Database().Delete(id, ser, tx)
+}
+
+// DeleteByUser deletes the Changes to the entities of the User with the given
+// ID.
+func (ser *ChangeService) DeleteByUser(uID int, tx db.Tx) error {
+	return tx.Database().DeleteFilter(ser, tx, func(m db.Model) bool {
+		c, err := ser.AssertType(m)
+		if err != nil {
+			return false
+		}
+		return c.UserID == uID
+	})
+}
+
+// GetAll retrieves all persisted values of Change.
+func (ser *ChangeService) GetAll(first *int, skip *int, tx db.Tx) ([]*models.Change, error) {
+	vlist, err := tx.Database().GetAll(first, skip, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to Changes: %w", err)
+	}
+	return list, nil
+}
+
+// GetFilter retrieves all persisted values of Change that pass the filter.
+func (ser *ChangeService) GetFilter(
+	first *int, skip *int, tx db.Tx, keep func(c *models.Change) bool,
+) ([]*models.Change, error) {
+	vlist, err := tx.Database().GetFilter(first, skip, ser, tx,
+		func(m db.Model) bool {
+			c, err := ser.AssertType(m)
+			if err != nil {
+				return false
+			}
+			return keep(c)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to Changes: %w", err)
+	}
+	return list, nil
+}
+
+// GetByID retrieves the persisted Change with the given ID.
+func (ser *ChangeService) GetByID(id int, tx db.Tx) (*models.Change, error) {
+	m, err := tx.Database().GetByID(id, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return c, nil
+}
+
+// GetByBucket retrieves the persisted Changes recorded for entities in the
+// given bucket.
+func (ser *ChangeService) GetByBucket(
+	bucket string, first *int, skip *int, tx db.Tx,
+) ([]*models.Change, error) {
+	return ser.GetFilter(first, skip, tx, func(c *models.Change) bool {
+		return c.Bucket == bucket
+	})
+}
+
+// GetSince retrieves the persisted Changes recorded after the given time that
+// pass the filter, oldest first. The log is the record of when entities were
+// last modified, so clients keep in sync by fetching the entities changed
+// since they last did.
+func (ser *ChangeService) GetSince(
+	since time.Time, first *int, skip *int, tx db.Tx, keep func(c *models.Change) bool,
+) ([]*models.Change, error) {
+	list, err := ser.GetFilter(nil, nil, tx, func(c *models.Change) bool {
+		return c.Meta.CreatedAt.After(since) && keep(c)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// IDs are not necessarily assigned in order, so sort by creation time
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Meta.CreatedAt.Before(list[j].Meta.CreatedAt)
+	})
+
+	if skip != nil && *skip > 0 {
+		if *skip > len(list) {
+			return []*models.Change{}, nil
+		}
+		list = list[*skip:]
+	}
+	if first != nil && *first >= 0 && *first < len(list) {
+		list = list[:*first]
+	}
+	return list, nil
+}
+
+// Bucket returns the name of the bucket for Change.
+func (ser *ChangeService) Bucket() string {
+	return "Change"
+}
+
+// Clean cleans the given Change for storage.
+func (ser *ChangeService) Clean(m db.Model, _ db.Tx) error {
+	_, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return nil
+}
+
+// Validate returns an error if the Change is not valid for the database.
+func (ser *ChangeService) Validate(m db.Model, _ db.Tx) error {
+	e, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	var verr ValidationError
+	ValidateTags(e, &verr)
+	if !e.Action.IsValid() {
+		verr.Addf("Action", FieldInvalid, "unknown action %d", e.Action)
+	}
+	return verr.Err()
+}
+
+// Initialize sets initial values for some properties.
+func (ser *ChangeService) Initialize(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistOldProperties maintains certain properties of the existing Change in
+// updates.
+func (ser *ChangeService) PersistOldProperties(_ db.Model, _ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistHooks returns the persistence hook functions.
+func (ser *ChangeService) PersistHooks() *db.PersistHooks {
+	return &ser.Hooks
+}
+
+// Marshal encodes the given Change for storage.
+func (ser *ChangeService) Marshal(m db.Model) ([]byte, error) {
+	c, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	v, err := db.Codecs.Encode(ser.Bucket(), c)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
+	}
+
+	return v, nil
+}
+
+// Unmarshal decodes the given record into Change.
+func (ser *ChangeService) Unmarshal(buf []byte) (db.Model, error) {
+	var c models.Change
+	err := db.Codecs.Decode(buf, &c)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
+	}
+	return &c, nil
+}
+
+// AssertType exposes the given db.Model as a Change.
+func (ser *ChangeService) AssertType(m db.Model) (*models.Change, error) {
+	if m == nil {
+		return nil, fmt.Errorf("model: %w", errNil)
+	}
+
+	c, ok := m.(*models.Change)
+	if !ok {
+		return nil, fmt.Errorf("model: %w", errors.New("not of Change type"))
+	}
+	return c, nil
+}
+
+// mapFromModel returns a list of Change type asserted from the given list of
+// db.Model.
+func (ser *ChangeService) mapFromModel(vlist []db.Model) ([]*models.Change, error) {
+	list := make([]*models.Change, len(vlist))
+	var err error
+	for i, v := range vlist {
+		list[i], err = ser.AssertType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+	}
+	return list, nil
+}
@@ -6,12 +6,16 @@ import (
 
 	"github.com/Dophin2009/nao/pkg/models"
 	"github.com/Dophin2009/nao/pkg/db"
-	json "github.com/json-iterator/go"
 )
 
 // CharacterService performs operations on Characters.
 type CharacterService struct {
 	Hooks db.PersistHooks
+	// SlugService indexes the Characters by their Slugs; Slugs are only generated
+	// if nil.
+	SlugService *SlugService
+	// NameService indexes the Characters by their names for search.
+	NameService *NameService
 }
 
 // NewCharacterService returns a CharacterService.
@@ -112,27 +116,67 @@ func (ser *CharacterService) GetByID(id int, tx db.Tx) (*models.Character, error
 	return c, nil
 }
 
+// GetBySlug retrieves the persisted Character with the given Slug.
+func (ser *CharacterService) GetBySlug(slug string, tx db.Tx) (*models.Character, error) {
+	id, err := ser.SlugService.ID(ser.Bucket(), slug, tx)
+	if err != nil {
+		return nil, err
+	}
+	return ser.GetByID(id, tx)
+}
+
+// Search retrieves the persisted Characters with a name matching the given query,
+// at most first if not nil, by NameService.Search.
+func (ser *CharacterService) Search(query string, first *int, tx db.Tx) ([]*models.Character, error) {
+	ids, err := ser.NameService.Search(ser.Bucket(), query, first, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*models.Character, len(ids))
+	for i, id := range ids {
+		list[i], err = ser.GetByID(id, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Character with ID %d: %w", id, err)
+		}
+	}
+	return list, nil
+}
+
 // Bucket returns the name of the bucket for Media.
 func (ser *CharacterService) Bucket() string {
 	return "Character"
 }
 
 // Clean cleans the given Character for storage
-func (ser *CharacterService) Clean(m db.Model, _ db.Tx) error {
-	_, err := ser.AssertType(m)
+func (ser *CharacterService) Clean(m db.Model, tx db.Tx) error {
+	e, err := ser.AssertType(m)
 	if err != nil {
 		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
-	return nil
+
+	err = cleanTitles(e.Names, e.Information)
+	if err != nil {
+		return err
+	}
+
+	e.Slug, err = ser.SlugService.clean(ser.Bucket(), e.Meta.ID, e.Slug, e.Names, tx)
+	return err
 }
 
 // Validate returns an error if the Character is not valid for the database.
 func (ser *CharacterService) Validate(m db.Model, _ db.Tx) error {
-	_, err := ser.AssertType(m)
+	e, err := ser.AssertType(m)
 	if err != nil {
 		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
-	return nil
+
+	var verr ValidationError
+	ValidateTags(e, &verr)
+	if e.Birthday != nil && !e.Birthday.IsValid() {
+		verr.Add("Birthday", FieldInvalid, "not a day of the calendar")
+	}
+	return verr.Err()
 }
 
 // Initialize sets initial values for some properties.
@@ -146,16 +190,16 @@ func (ser *CharacterService) PersistOldProperties(_ db.Model, _ db.Model, _ db.T
 	return nil
 }
 
-// Marshal transforms the given Character into JSON.
+// Marshal encodes the given Character for storage.
 func (ser *CharacterService) Marshal(m db.Model) ([]byte, error) {
 	c, err := ser.AssertType(m)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
-	v, err := json.Marshal(c)
+	v, err := db.Codecs.Encode(ser.Bucket(), c)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONMarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
 	}
 
 	return v, nil
@@ -166,12 +210,12 @@ func (ser *CharacterService) PersistHooks() *db.PersistHooks {
 	return &ser.Hooks
 }
 
-// Unmarshal parses the given JSON into Character.
+// Unmarshal decodes the given record into Character.
 func (ser *CharacterService) Unmarshal(buf []byte) (db.Model, error) {
 	var c models.Character
-	err := json.Unmarshal(buf, &c)
+	err := db.Codecs.Decode(buf, &c)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONUnmarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
 	}
 	return &c, nil
 }
@@ -0,0 +1,388 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// CommentService performs operations on Comment.
+type CommentService struct {
+	UserService   *UserService
+	ReviewService *ReviewService
+	Hooks         db.PersistHooks
+}
+
+// NewCommentService returns a CommentService.
+func NewCommentService(hooks db.PersistHooks, userService *UserService,
+	reviewService *ReviewService) *CommentService {
+	// Initialize CommentService
+	commentService := &CommentService{
+		UserService:   userService,
+		ReviewService: reviewService,
+		Hooks:         hooks,
+	}
+
+	// Add hook to delete Comment on User deletion
+	deleteCommentOnDeleteUser := func(um db.Model, _ db.Service, tx db.Tx) error {
+		uID := um.Metadata().ID
+		err := commentService.deleteFilter(tx, func(c *models.Comment) bool {
+			return c.UserID == uID
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete Comment by User ID %d: %w", uID, err)
+		}
+		return nil
+	}
+	uSerHooks := userService.PersistHooks()
+	uSerHooks.PreDeleteHooks =
+		append(uSerHooks.PreDeleteHooks, deleteCommentOnDeleteUser)
+
+	// Add hook to delete Comment on Review deletion
+	deleteCommentOnDeleteReview := func(rm db.Model, _ db.Service, tx db.Tx) error {
+		rID := rm.Metadata().ID
+		err := commentService.deleteFilter(tx, func(c *models.Comment) bool {
+			return c.ReviewID == rID
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete Comment by Review ID %d: %w", rID, err)
+		}
+		return nil
+	}
+	rSerHooks := reviewService.PersistHooks()
+	rSerHooks.PreDeleteHooks =
+		append(rSerHooks.PreDeleteHooks, deleteCommentOnDeleteReview)
+
+	// Add hook to delete replies on Comment deletion
+	deleteRepliesOnDeleteComment := func(cm db.Model, _ db.Service, tx db.Tx) error {
+		cID := cm.Metadata().ID
+		err := commentService.deleteFilter(tx, func(c *models.Comment) bool {
+			return c.ParentID != nil && *c.ParentID == cID
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete replies to Comment with ID %d: %w", cID, err)
+		}
+		return nil
+	}
+	commentService.Hooks.PreDeleteHooks =
+		append(commentService.Hooks.PreDeleteHooks, deleteRepliesOnDeleteComment)
+
+	return commentService
+}
+
+// Create persists the given Comment.
+func (ser *CommentService) Create(c *models.Comment, tx db.Tx) (int, error) {
+	return tx.Database().Create(c, ser, tx)
+}
+
+// Update replaces the value of the Comment with the given ID.
+func (ser *CommentService) Update(c *models.Comment, tx db.Tx) error {
+	return tx.Database().Update(c, ser, tx)
+}
+
+// Delete deletes the Comment with the given ID, along with its replies.
+func (ser *CommentService) Delete(id int, tx db.Tx) error {
+	return tx.Database().Delete(id, ser, tx)
+}
+
+// deleteFilter deletes the Comments that pass the filter one by one, so that
+// the replies to each are deleted as well.
+func (ser *CommentService) deleteFilter(tx db.Tx, keep func(c *models.Comment) bool) error {
+	list, err := ser.GetFilter(nil, nil, tx, keep)
+	if err != nil {
+		return err
+	}
+	for _, c := range list {
+		err = ser.Delete(c.Meta.ID, tx)
+		// Replies may already have been deleted with their parents
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete Comment with ID %d: %w", c.Meta.ID, err)
+		}
+	}
+	return nil
+}
+
+// GetFilter retrieves all persisted values of Comment that pass the filter.
+func (ser *CommentService) GetFilter(
+	first *int, skip *int, tx db.Tx, keep func(c *models.Comment) bool,
+) ([]*models.Comment, error) {
+	vlist, err := tx.Database().GetFilter(first, skip, ser, tx,
+		func(m db.Model) bool {
+			c, err := ser.AssertType(m)
+			if err != nil {
+				return false
+			}
+			return keep(c)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to Comments: %w", err)
+	}
+	return list, nil
+}
+
+// GetByID retrieves the persisted Comment with the given ID.
+func (ser *CommentService) GetByID(id int, tx db.Tx) (*models.Comment, error) {
+	m, err := tx.Database().GetByID(id, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return c, nil
+}
+
+// GetByReviewAs retrieves a list of the Comments on the Review with the given
+// ID visible to the caller that reply to the Comment with the given parent
+// ID, or that are top-level Comments if the parent ID is nil. Only Comments
+// updated after since are retrieved if it is not nil.
+func (ser *CommentService) GetByReviewAs(
+	caller *models.User, rID int, parentID *int, since *time.Time, first *int, skip *int,
+	tx db.Tx,
+) ([]*models.Comment, error) {
+	return ser.GetFilter(first, skip, tx, func(c *models.Comment) bool {
+		if c.ReviewID != rID || !moderatedVisible(caller, c.UserID, c.Hidden) ||
+			!c.Meta.UpdatedSince(since) {
+			return false
+		}
+		if parentID == nil {
+			return c.ParentID == nil
+		}
+		return c.ParentID != nil && *c.ParentID == *parentID
+	})
+}
+
+// GetFlagged retrieves a list of the Comments flagged for moderation.
+func (ser *CommentService) GetFlagged(first *int, skip *int, tx db.Tx) ([]*models.Comment, error) {
+	return ser.GetFilter(first, skip, tx, func(c *models.Comment) bool {
+		return c.Flagged
+	})
+}
+
+// CreateAs persists the given Comment on behalf of the caller, who must own
+// it and be able to see the Review commented on. Comments are never created
+// flagged or hidden.
+func (ser *CommentService) CreateAs(caller *models.User, c *models.Comment, tx db.Tx) (int, error) {
+	err := AuthorizeOwner(caller, c.UserID)
+	if err != nil {
+		return 0, err
+	}
+	_, err = ser.ReviewService.GetByIDAs(caller, c.ReviewID, tx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get Review by ID %d: %w", c.ReviewID, err)
+	}
+
+	c.Flagged = false
+	c.Hidden = false
+	return ser.Create(c, tx)
+}
+
+// DeleteAs deletes the Comment with the given ID on behalf of the caller, who
+// must own it or be a Moderator.
+func (ser *CommentService) DeleteAs(caller *models.User, id int, tx db.Tx) error {
+	c, err := ser.GetByID(id, tx)
+	if err != nil {
+		return err
+	}
+	err = AuthorizeOwner(caller, c.UserID)
+	if err != nil && authorizeModerator(caller) != nil {
+		return err
+	}
+	return ser.Delete(id, tx)
+}
+
+// FlagAs flags the Comment with the given ID for moderation on behalf of the
+// caller, who must be authenticated.
+func (ser *CommentService) FlagAs(caller *models.User, id int, tx db.Tx) error {
+	if caller == nil {
+		return fmt.Errorf("no credentials given: %w", ErrUnauthorized)
+	}
+
+	c, err := ser.GetByID(id, tx)
+	if err != nil {
+		return err
+	}
+	if !moderatedVisible(caller, c.UserID, c.Hidden) {
+		return fmt.Errorf("Comment with ID %d: hidden: %w", id, ErrNotFound)
+	}
+	c.Flagged = true
+	return ser.Update(c, tx)
+}
+
+// SetHiddenAs hides or shows the Comment with the given ID on behalf of the
+// caller, who must be a Moderator. The Comment is no longer flagged.
+func (ser *CommentService) SetHiddenAs(
+	caller *models.User, id int, hidden bool, tx db.Tx,
+) (*models.Comment, error) {
+	err := authorizeModerator(caller)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := ser.GetByID(id, tx)
+	if err != nil {
+		return nil, err
+	}
+	c.Hidden = hidden
+	c.Flagged = false
+	err = ser.Update(c, tx)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Bucket returns the name of the bucket for Comment.
+func (ser *CommentService) Bucket() string {
+	return "Comment"
+}
+
+// Clean cleans the given Comment for storage.
+func (ser *CommentService) Clean(m db.Model, _ db.Tx) error {
+	_, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return nil
+}
+
+// Validate returns an error if the Comment is not valid for the database.
+func (ser *CommentService) Validate(m db.Model, tx db.Tx) error {
+	e, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	var verr ValidationError
+	ValidateTags(e, &verr)
+	if e.ParentID != nil && *e.ParentID == e.Meta.ID {
+		verr.Add("ParentID", FieldInvalid, "may not reply to itself")
+	}
+	err = verr.Err()
+	if err != nil {
+		return err
+	}
+
+	db := tx.Database()
+
+	// Check if User with ID specified in Comment exists
+	_, err = db.GetRawByID(e.UserID, ser.UserService, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get User with ID %d: %w", e.UserID, err)
+	}
+
+	// Check if Review with ID specified in Comment exists
+	_, err = db.GetRawByID(e.ReviewID, ser.ReviewService, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get Review with ID %d: %w", e.ReviewID, err)
+	}
+
+	// Check that the parent Comment is on the same Review
+	if e.ParentID != nil {
+		parent, err := ser.GetByID(*e.ParentID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get Comment with ID %d: %w", *e.ParentID, err)
+		}
+		if parent.ReviewID != e.ReviewID {
+			verr.Addf("ParentID", FieldInvalid, "Comment with ID %d: not on Review with ID %d",
+				*e.ParentID, e.ReviewID)
+			return &verr
+		}
+	}
+
+	return nil
+}
+
+// Initialize sets initial values for some properties.
+func (ser *CommentService) Initialize(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistOldProperties maintains certain properties of the existing Comment
+// in updates.
+func (ser *CommentService) PersistOldProperties(n db.Model, o db.Model, _ db.Tx) error {
+	nc, err := ser.AssertType(n)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	oc, err := ser.AssertType(o)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	// Comments may not be moved between Users, Reviews or threads
+	nc.UserID = oc.UserID
+	nc.ReviewID = oc.ReviewID
+	nc.ParentID = oc.ParentID
+	return nil
+}
+
+// PersistHooks returns the persistence hook functions.
+func (ser *CommentService) PersistHooks() *db.PersistHooks {
+	return &ser.Hooks
+}
+
+// Marshal encodes the given Comment for storage.
+func (ser *CommentService) Marshal(m db.Model) ([]byte, error) {
+	c, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	v, err := db.Codecs.Encode(ser.Bucket(), c)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
+	}
+
+	return v, nil
+}
+
+// Unmarshal decodes the given record into Comment.
+func (ser *CommentService) Unmarshal(buf []byte) (db.Model, error) {
+	var c models.Comment
+	err := db.Codecs.Decode(buf, &c)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
+	}
+	return &c, nil
+}
+
+// AssertType exposes the given db.Model as a Comment.
+func (ser *CommentService) AssertType(m db.Model) (*models.Comment, error) {
+	if m == nil {
+		return nil, fmt.Errorf("model: %w", errNil)
+	}
+
+	c, ok := m.(*models.Comment)
+	if !ok {
+		return nil, fmt.Errorf("model: %w", errors.New("not of Comment type"))
+	}
+	return c, nil
+}
+
+// mapFromModel returns a list of Comment type asserted from the given list of
+// db.Model.
+func (ser *CommentService) mapFromModel(vlist []db.Model) ([]*models.Comment, error) {
+	list := make([]*models.Comment, len(vlist))
+	var err error
+	for i, v := range vlist {
+		list[i], err = ser.AssertType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+	}
+	return list, nil
+}
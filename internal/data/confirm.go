@@ -0,0 +1,40 @@
+package data
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConfirmationToken returns the token that confirms a bulk operation on the
+// entities of the given bucket with the given IDs. The token is the same for
+// the same entities in any order, so that a dry run of the operation gives
+// the token of the real one as long as the same entities are affected.
+func ConfirmationToken(bucket string, ids []int) string {
+	sorted := append([]int{}, ids...)
+	sort.Ints(sorted)
+
+	var b strings.Builder
+	b.WriteString(bucket)
+	for _, id := range sorted {
+		b.WriteByte(':')
+		b.WriteString(strconv.Itoa(id))
+	}
+	hash := sha256.Sum256([]byte(b.String()))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// CheckConfirmationToken returns an error wrapping ErrConflict if the given
+// token does not confirm the bulk operation on the entities of the given
+// bucket with the given IDs, such as when the entities changed since the dry
+// run that gave it.
+func CheckConfirmationToken(token string, bucket string, ids []int) error {
+	if token != ConfirmationToken(bucket, ids) {
+		return fmt.Errorf("confirmation token %q: not that of the %d %s affected: %w",
+			token, len(ids), bucket, ErrConflict)
+	}
+	return nil
+}
@@ -6,7 +6,6 @@ import (
 
 	"github.com/Dophin2009/nao/pkg/models"
 	"github.com/Dophin2009/nao/pkg/db"
-	json "github.com/json-iterator/go"
 )
 
 // EpisodeService performs operations on Episodes.
@@ -118,20 +117,23 @@ func (ser *EpisodeService) Bucket() string {
 
 // Clean cleans the given Episode for storage.
 func (ser *EpisodeService) Clean(m db.Model, _ db.Tx) error {
-	_, err := ser.AssertType(m)
+	e, err := ser.AssertType(m)
 	if err != nil {
 		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
-	return nil
+	return cleanTitles(e.Titles, e.Synopses)
 }
 
 // Validate returns an error if the Episode is not valid for the database.
 func (ser *EpisodeService) Validate(m db.Model, _ db.Tx) error {
-	_, err := ser.AssertType(m)
+	e, err := ser.AssertType(m)
 	if err != nil {
 		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
-	return nil
+
+	var verr ValidationError
+	ValidateTags(e, &verr)
+	return verr.Err()
 }
 
 // Initialize sets initial values for some properties.
@@ -150,27 +152,27 @@ func (ser *EpisodeService) PersistHooks() *db.PersistHooks {
 	return &ser.Hooks
 }
 
-// Marshal transforms the given Episode into JSON.
+// Marshal encodes the given Episode for storage.
 func (ser *EpisodeService) Marshal(m db.Model) ([]byte, error) {
 	ep, err := ser.AssertType(m)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
-	v, err := json.Marshal(ep)
+	v, err := db.Codecs.Encode(ser.Bucket(), ep)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONMarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
 	}
 
 	return v, nil
 }
 
-// Unmarshal parses the given JSON into Episode.
+// Unmarshal decodes the given record into Episode.
 func (ser *EpisodeService) Unmarshal(buf []byte) (db.Model, error) {
 	var ep models.Episode
-	err := json.Unmarshal(buf, &ep)
+	err := db.Codecs.Decode(buf, &ep)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONUnmarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
 	}
 	return &ep, nil
 }
@@ -429,7 +431,7 @@ func (ser *EpisodeSetService) Validate(m db.Model, tx db.Tx) error {
 	}
 
 	for _, id := range set.Episodes {
-		_, err := tx.Database().GetRawByID(id, ser, tx)
+		_, err := tx.Database().GetRawByID(id, ser.EpisodeService, tx)
 		if err != nil {
 			return fmt.Errorf("failed to get Episode with ID %d: %w", id, err)
 		}
@@ -453,27 +455,27 @@ func (ser *EpisodeSetService) PersistHooks() *db.PersistHooks {
 	return &ser.Hooks
 }
 
-// Marshal transforms the given EpisodeSet into JSON.
+// Marshal encodes the given EpisodeSet for storage.
 func (ser *EpisodeSetService) Marshal(m db.Model) ([]byte, error) {
 	set, err := ser.AssertType(m)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
-	v, err := json.Marshal(set)
+	v, err := db.Codecs.Encode(ser.Bucket(), set)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONMarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
 	}
 
 	return v, nil
 }
 
-// Unmarshal parses the given JSON into EpisodeSet.
+// Unmarshal decodes the given record into EpisodeSet.
 func (ser *EpisodeSetService) Unmarshal(buf []byte) (db.Model, error) {
 	var set models.EpisodeSet
-	err := json.Unmarshal(buf, &set)
+	err := db.Codecs.Decode(buf, &set)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONUnmarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
 	}
 	return &set, nil
 }
@@ -1,19 +1,55 @@
 package data
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// Errors returned by the data layer are wrapped around one of the following,
+// which callers may test for with errors.Is to tell the kind of failure.
+var (
+	// ErrNotFound is an error returned when the requested entity does not
+	// exist.
+	ErrNotFound = db.ErrNotFound
+	// ErrInvalid is an error returned when some value is invalid.
+	ErrInvalid = db.ErrInvalid
+	// ErrConflict is an error returned when a unique value already exists.
+	ErrConflict = db.ErrConflict
+	// ErrUnauthorized is an error returned when the caller is not allowed to
+	// perform the operation.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrUnavailable is an error returned when the operation is refused for
+	// a while, such as writes in maintenance mode.
+	ErrUnavailable = errors.New("unavailable")
+	// ErrLocked is an error returned when the entity is locked by another
+	// User.
+	ErrLocked = errors.New("locked")
+)
+
+// ValidationError collects the problems with the properties of an entity
+// found by validation. Validate returns one for invalid property values,
+// while missing references and conflicts keep their own errors.
+type ValidationError = db.ValidationError
+
+// FieldError is a problem with a single property of an entity.
+type FieldError = db.FieldError
+
+// Field error codes identify the kind of problem with a property.
+const (
+	FieldRequired   = db.FieldRequired
+	FieldInvalid    = db.FieldInvalid
+	FieldOutOfRange = db.FieldOutOfRange
+)
 
 var (
 	// errNil is an error returned when some pointer is nil.
 	errNil = errors.New("is nil")
-	// errInvalid is an error returned when some value is invalid.
-	errInvalid = errors.New("invalid")
-	// errAlreadyExists is an error returned when a unique value already exists.
-	errAlreadyExists = errors.New("already exists")
 )
 
 const (
 	errmsgModelAssertType = "failed to assert type of model"
 
-	errmsgJSONMarshal   = "failed to marshal to JSON"
-	errmsgJSONUnmarshal = "failed to unmarshal from JSON"
+	errmsgModelEncode = "failed to encode model"
+	errmsgModelDecode = "failed to decode model"
 )
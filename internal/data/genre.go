@@ -6,7 +6,6 @@ import (
 
 	"github.com/Dophin2009/nao/pkg/models"
 	"github.com/Dophin2009/nao/pkg/db"
-	json "github.com/json-iterator/go"
 )
 
 // GenreService performs operations on genre.
@@ -127,11 +126,14 @@ func (ser *GenreService) Clean(m db.Model, _ db.Tx) error {
 
 // Validate returns an error if the Genre is not valid for the database.
 func (ser *GenreService) Validate(m db.Model, _ db.Tx) error {
-	_, err := ser.AssertType(m)
+	e, err := ser.AssertType(m)
 	if err != nil {
 		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
-	return nil
+
+	var verr ValidationError
+	ValidateTags(e, &verr)
+	return verr.Err()
 }
 
 // Initialize sets initial values for some properties.
@@ -150,27 +152,27 @@ func (ser *GenreService) PersistHooks() *db.PersistHooks {
 	return &ser.Hooks
 }
 
-// Marshal transforms the given Genre into JSON.
+// Marshal encodes the given Genre for storage.
 func (ser *GenreService) Marshal(m db.Model) ([]byte, error) {
 	g, err := ser.AssertType(m)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
-	v, err := json.Marshal(g)
+	v, err := db.Codecs.Encode(ser.Bucket(), g)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONMarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
 	}
 
 	return v, nil
 }
 
-// Unmarshal parses the given JSON into Genre.
+// Unmarshal decodes the given record into Genre.
 func (ser *GenreService) Unmarshal(buf []byte) (db.Model, error) {
 	var g models.Genre
-	err := json.Unmarshal(buf, &g)
+	err := db.Codecs.Decode(buf, &g)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONUnmarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
 	}
 	return &g, nil
 }
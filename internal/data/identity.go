@@ -0,0 +1,284 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// IdentityService performs operations on Identity.
+type IdentityService struct {
+	UserService *UserService
+	Hooks       db.PersistHooks
+}
+
+// NewIdentityService returns an IdentityService.
+func NewIdentityService(
+	hooks db.PersistHooks, userService *UserService,
+) *IdentityService {
+	// Initialize IdentityService
+	identityService := &IdentityService{
+		UserService: userService,
+		Hooks:       hooks,
+	}
+
+	// Add hook to delete Identity on User deletion
+	deleteIdentityOnDeleteUser := func(um db.Model, _ db.Service, tx db.Tx) error {
+		uID := um.Metadata().ID
+		err := identityService.DeleteByUser(uID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to delete Identity by User ID %d: %w", uID, err)
+		}
+		return nil
+	}
+	uSerHooks := userService.PersistHooks()
+	uSerHooks.PreDeleteHooks =
+		append(uSerHooks.PreDeleteHooks, deleteIdentityOnDeleteUser)
+
+	return identityService
+}
+
+// Link links the User with the given ID to the account with the given issuer
+// and subject at the identity provider with the given name. It returns an
+// error wrapping ErrConflict if the account is linked to another User.
+func (ser *IdentityService) Link(
+	uID int, provider string, issuer string, subject string, email string, tx db.Tx,
+) (*models.Identity, error) {
+	i, err := ser.GetBySubject(issuer, subject, tx)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	if i != nil {
+		if i.UserID != uID {
+			return nil, fmt.Errorf("account %q of issuer %q: linked to another User: %w",
+				subject, issuer, ErrConflict)
+		}
+		return i, nil
+	}
+
+	i = &models.Identity{
+		UserID:   uID,
+		Provider: provider,
+		Issuer:   issuer,
+		Subject:  subject,
+		Email:    email,
+	}
+	_, err = ser.Create(i, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Identity: %w", err)
+	}
+	return i, nil
+}
+
+// Create persists the given Identity.
+func (ser *IdentityService) Create(i *models.Identity, tx db.Tx) (int, error) {
+	return tx.Database().Create(i, ser, tx)
+}
+
+// Update replaces the value of the Identity with the given ID.
+func (ser *IdentityService) Update(i *models.Identity, tx db.Tx) error {
+	return tx.Database().Update(i, ser, tx)
+}
+
+// Delete deletes the Identity with the given ID.
+func (ser *IdentityService) Delete(id int, tx db.Tx) error {
+	return tx.Database().Delete(id, ser, tx)
+}
+
+// DeleteByUser deletes the Identities of the User with the given ID.
+func (ser *IdentityService) DeleteByUser(uID int, tx db.Tx) error {
+	return tx.Database().DeleteFilter(ser, tx, func(m db.Model) bool {
+		i, err := ser.AssertType(m)
+		if err != nil {
+			return false
+		}
+		return i.UserID == uID
+	})
+}
+
+// GetBySubject retrieves the Identity of the account with the given subject
+// at the given issuer.
+func (ser *IdentityService) GetBySubject(
+	issuer string, subject string, tx db.Tx,
+) (*models.Identity, error) {
+	first := 1
+	list, err := ser.GetFilter(&first, nil, tx, func(i *models.Identity) bool {
+		return i.Issuer == issuer && i.Subject == subject
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Identities: %w", err)
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("Identity of %q at %q: %w", subject, issuer, ErrNotFound)
+	}
+	return list[0], nil
+}
+
+// GetByUser retrieves the Identities of the User with the given ID.
+func (ser *IdentityService) GetByUser(uID int, tx db.Tx) ([]*models.Identity, error) {
+	return ser.GetFilter(nil, nil, tx, func(i *models.Identity) bool {
+		return i.UserID == uID
+	})
+}
+
+// GetByID retrieves the persisted Identity with the given ID.
+func (ser *IdentityService) GetByID(id int, tx db.Tx) (*models.Identity, error) {
+	m, err := tx.Database().GetByID(id, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	i, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return i, nil
+}
+
+// GetFilter retrieves all persisted values of Identity that pass the
+// filter.
+func (ser *IdentityService) GetFilter(
+	first *int, skip *int, tx db.Tx, keep func(i *models.Identity) bool,
+) ([]*models.Identity, error) {
+	vlist, err := tx.Database().GetFilter(first, skip, ser, tx,
+		func(m db.Model) bool {
+			i, err := ser.AssertType(m)
+			if err != nil {
+				return false
+			}
+			return keep(i)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to Identities: %w", err)
+	}
+	return list, nil
+}
+
+// GetAll retrieves all persisted values of Identity.
+func (ser *IdentityService) GetAll(
+	first *int, skip *int, tx db.Tx,
+) ([]*models.Identity, error) {
+	vlist, err := tx.Database().GetAll(first, skip, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to Identities: %w", err)
+	}
+	return list, nil
+}
+
+// Bucket returns the name of the bucket for Identity.
+func (ser *IdentityService) Bucket() string {
+	return "Identity"
+}
+
+// Clean cleans the given Identity for storage.
+func (ser *IdentityService) Clean(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// Validate returns an error if the Identity is not valid for the
+// database.
+func (ser *IdentityService) Validate(m db.Model, tx db.Tx) error {
+	e, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	// Check if User with ID specified in Identity exists
+	_, err = tx.Database().GetRawByID(e.UserID, ser.UserService, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get User with ID %d: %w", e.UserID, err)
+	}
+
+	// Check that the account is not linked to another User
+	same, err := ser.GetBySubject(e.Issuer, e.Subject, tx)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if same != nil && same.Meta.ID != e.Meta.ID {
+		return fmt.Errorf("account %q of issuer %q: %w", e.Subject, e.Issuer, ErrConflict)
+	}
+
+	return nil
+}
+
+// Initialize sets initial values for some properties.
+func (ser *IdentityService) Initialize(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistOldProperties maintains certain properties of the existing
+// Identity in updates.
+func (ser *IdentityService) PersistOldProperties(_ db.Model, _ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistHooks returns the persistence hook functions.
+func (ser *IdentityService) PersistHooks() *db.PersistHooks {
+	return &ser.Hooks
+}
+
+// Marshal encodes the given Identity for storage.
+func (ser *IdentityService) Marshal(m db.Model) ([]byte, error) {
+	i, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	v, err := db.Codecs.Encode(ser.Bucket(), i)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
+	}
+
+	return v, nil
+}
+
+// Unmarshal decodes the given record into Identity.
+func (ser *IdentityService) Unmarshal(buf []byte) (db.Model, error) {
+	var i models.Identity
+	err := db.Codecs.Decode(buf, &i)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
+	}
+	return &i, nil
+}
+
+// AssertType exposes the given db.Model as a Identity.
+func (ser *IdentityService) AssertType(m db.Model) (*models.Identity, error) {
+	if m == nil {
+		return nil, fmt.Errorf("model: %w", errNil)
+	}
+
+	i, ok := m.(*models.Identity)
+	if !ok {
+		return nil, fmt.Errorf("model: %w", errors.New("not of Identity type"))
+	}
+	return i, nil
+}
+
+// mapFromModel returns a list of Identity type asserted from the given
+// list of db.Model.
+func (ser *IdentityService) mapFromModel(
+	vlist []db.Model,
+) ([]*models.Identity, error) {
+	list := make([]*models.Identity, len(vlist))
+	var err error
+	for i, v := range vlist {
+		list[i], err = ser.AssertType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,315 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// ImportRowService performs operations on ImportRow.
+type ImportRowService struct {
+	UserService *UserService
+	Hooks       db.PersistHooks
+}
+
+// NewImportRowService returns an ImportRowService.
+func NewImportRowService(hooks db.PersistHooks, userService *UserService) *ImportRowService {
+	// Initialize ImportRowService
+	importRowService := &ImportRowService{
+		UserService: userService,
+		Hooks:       hooks,
+	}
+
+	// Add hook to delete ImportRows on User deletion
+	deleteImportRowOnDeleteUser := func(um db.Model, _ db.Service, tx db.Tx) error {
+		uID := um.Metadata().ID
+		err := importRowService.DeleteByUser(uID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to delete ImportRows by User ID %d: %w", uID, err)
+		}
+		return nil
+	}
+	uSerHooks := userService.PersistHooks()
+	uSerHooks.PreDeleteHooks =
+		append(uSerHooks.PreDeleteHooks, deleteImportRowOnDeleteUser)
+
+	return importRowService
+}
+
+// Stage replaces the ImportRows of the User with the given ID with the given
+// ones, pending in order. It returns an error wrapping ErrConflict if some of
+// the previous ones are still pending.
+func (ser *ImportRowService) Stage(
+	uID int, rows []*models.ImportRow, tx db.Tx,
+) error {
+	status := models.ImportRowStatusPending
+	pending, err := ser.GetByUser(uID, &status, tx)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%d rows of the previous import still pending: %w",
+			len(pending), ErrConflict)
+	}
+
+	err = ser.DeleteByUser(uID, tx)
+	if err != nil {
+		return fmt.Errorf("failed to delete ImportRows by User ID %d: %w", uID, err)
+	}
+	for i, r := range rows {
+		r.UserID = uID
+		r.Row = i + 1
+		r.Status = models.ImportRowStatusPending
+		_, err = ser.Create(r, tx)
+		if err != nil {
+			return fmt.Errorf("failed to create ImportRow %d: %w", r.Row, err)
+		}
+	}
+	return nil
+}
+
+// Retry marks the failed ImportRows of the User with the given ID at the
+// given positions, or all of them if none are given, pending again. It
+// returns the number marked.
+func (ser *ImportRowService) Retry(uID int, rows []int, tx db.Tx) (int, error) {
+	retried := map[int]bool{}
+	for _, row := range rows {
+		retried[row] = true
+	}
+
+	status := models.ImportRowStatusFailed
+	failed, err := ser.GetByUser(uID, &status, tx)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, r := range failed {
+		if len(retried) > 0 && !retried[r.Row] {
+			continue
+		}
+		r.Status = models.ImportRowStatusPending
+		err = ser.Update(r, tx)
+		if err != nil {
+			return n, fmt.Errorf("failed to update ImportRow with ID %d: %w", r.Meta.ID, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Pending retrieves the first pending ImportRows, of all Users, in the order
+// they were staged.
+func (ser *ImportRowService) Pending(first *int, tx db.Tx) ([]*models.ImportRow, error) {
+	return ser.GetFilter(first, nil, tx, func(r *models.ImportRow) bool {
+		return r.Status == models.ImportRowStatusPending
+	})
+}
+
+// Create persists the given ImportRow.
+func (ser *ImportRowService) Create(r *models.ImportRow, tx db.Tx) (int, error) {
+	return tx.Database().Create(r, ser, tx)
+}
+
+// Update replaces the value of the ImportRow with the given ID.
+func (ser *ImportRowService) Update(r *models.ImportRow, tx db.Tx) error {
+	return tx.Database().Update(r, ser, tx)
+}
+
+// Delete deletes the ImportRow with the given ID.
+func (ser *ImportRowService) Delete(id int, tx db.Tx) error {
+	return tx.Database().Delete(id, ser, tx)
+}
+
+// DeleteByUser deletes the ImportRows of the User with the given ID.
+func (ser *ImportRowService) DeleteByUser(uID int, tx db.Tx) error {
+	return tx.Database().DeleteFilter(ser, tx, func(m db.Model) bool {
+		r, err := ser.AssertType(m)
+		if err != nil {
+			return false
+		}
+		return r.UserID == uID
+	})
+}
+
+// GetByUser retrieves the ImportRows of the User with the given ID in order,
+// only those of the given status if not nil.
+func (ser *ImportRowService) GetByUser(
+	uID int, status *models.ImportRowStatus, tx db.Tx,
+) ([]*models.ImportRow, error) {
+	return ser.GetFilter(nil, nil, tx, func(r *models.ImportRow) bool {
+		return r.UserID == uID && (status == nil || r.Status == *status)
+	})
+}
+
+// GetByID retrieves the persisted ImportRow with the given ID.
+func (ser *ImportRowService) GetByID(id int, tx db.Tx) (*models.ImportRow, error) {
+	m, err := tx.Database().GetByID(id, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return r, nil
+}
+
+// GetFilter retrieves all persisted values of ImportRow that pass the
+// filter.
+func (ser *ImportRowService) GetFilter(
+	first *int, skip *int, tx db.Tx, keep func(r *models.ImportRow) bool,
+) ([]*models.ImportRow, error) {
+	vlist, err := tx.Database().GetFilter(first, skip, ser, tx,
+		func(m db.Model) bool {
+			r, err := ser.AssertType(m)
+			if err != nil {
+				return false
+			}
+			return keep(r)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to ImportRows: %w", err)
+	}
+	return list, nil
+}
+
+// GetAll retrieves all persisted values of ImportRow.
+func (ser *ImportRowService) GetAll(
+	first *int, skip *int, tx db.Tx,
+) ([]*models.ImportRow, error) {
+	vlist, err := tx.Database().GetAll(first, skip, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to ImportRows: %w", err)
+	}
+	return list, nil
+}
+
+// Bucket returns the name of the bucket for ImportRow.
+func (ser *ImportRowService) Bucket() string {
+	return "ImportRow"
+}
+
+// Clean cleans the given ImportRow for storage.
+func (ser *ImportRowService) Clean(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// Validate returns an error if the ImportRow is not valid for the database.
+func (ser *ImportRowService) Validate(m db.Model, tx db.Tx) error {
+	r, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	var verr ValidationError
+	ValidateTags(r, &verr)
+	if !r.Status.IsValid() {
+		verr.Addf("Status", FieldInvalid, "unknown status %d", r.Status)
+	}
+	err = verr.Err()
+	if err != nil {
+		return err
+	}
+
+	// Check if User with ID specified in ImportRow exists
+	_, err = tx.Database().GetRawByID(r.UserID, ser.UserService, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get User with ID %d: %w", r.UserID, err)
+	}
+
+	return nil
+}
+
+// Initialize sets initial values for some properties.
+func (ser *ImportRowService) Initialize(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistOldProperties maintains certain properties of the existing
+// ImportRow in updates.
+func (ser *ImportRowService) PersistOldProperties(n db.Model, o db.Model, _ db.Tx) error {
+	nr, err := ser.AssertType(n)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	or, err := ser.AssertType(o)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	nr.UserID = or.UserID
+	nr.Row = or.Row
+	nr.Entry = or.Entry
+	return nil
+}
+
+// PersistHooks returns the persistence hook functions.
+func (ser *ImportRowService) PersistHooks() *db.PersistHooks {
+	return &ser.Hooks
+}
+
+// Marshal encodes the given ImportRow for storage.
+func (ser *ImportRowService) Marshal(m db.Model) ([]byte, error) {
+	r, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	v, err := db.Codecs.Encode(ser.Bucket(), r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
+	}
+
+	return v, nil
+}
+
+// Unmarshal decodes the given record into ImportRow.
+func (ser *ImportRowService) Unmarshal(buf []byte) (db.Model, error) {
+	var r models.ImportRow
+	err := db.Codecs.Decode(buf, &r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
+	}
+	return &r, nil
+}
+
+// AssertType exposes the given db.Model as an ImportRow.
+func (ser *ImportRowService) AssertType(m db.Model) (*models.ImportRow, error) {
+	if m == nil {
+		return nil, fmt.Errorf("model: %w", errNil)
+	}
+
+	r, ok := m.(*models.ImportRow)
+	if !ok {
+		return nil, fmt.Errorf("model: %w", errors.New("not of ImportRow type"))
+	}
+	return r, nil
+}
+
+// mapFromModel returns a list of ImportRow type asserted from the given list
+// of db.Model.
+func (ser *ImportRowService) mapFromModel(
+	vlist []db.Model,
+) ([]*models.ImportRow, error) {
+	list := make([]*models.ImportRow, len(vlist))
+	var err error
+	for i, v := range vlist {
+		list[i], err = ser.AssertType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,223 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// DefaultLibraryStaleAfter is the duration without progress after which a
+// UserMedia being watched is considered stale, when none is configured.
+const DefaultLibraryStaleAfter = 90 * 24 * time.Hour
+
+// LibraryHealth returns a report of the problems found in the library of the
+// User with the given ID, along with suggested fixes. UserMedia being watched
+// are stale if they have had no progress within staleAfter of now.
+func (ser *UserMediaService) LibraryHealth(
+	uID int, staleAfter time.Duration, now time.Time, tx db.Tx,
+) (*models.LibraryHealth, error) {
+	if staleAfter <= 0 {
+		staleAfter = DefaultLibraryStaleAfter
+	}
+
+	list, err := ser.GetByUser(uID, nil, nil, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get UserMedia by User ID %d: %w", uID, err)
+	}
+
+	h := models.LibraryHealth{
+		UserID:            uID,
+		Total:             len(list),
+		Stale:             []int{},
+		MissingScore:      []int{},
+		MissingFinishDate: []int{},
+		Orphaned:          []int{},
+		Duplicates:        [][]int{},
+		Fixes:             []models.LibraryFix{},
+	}
+
+	// Duplicates are listed oldest first, as IDs need not be in order of
+	// creation
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Meta.CreatedAt.Before(list[j].Meta.CreatedAt)
+	})
+
+	byMedia := map[int][]int{}
+	for _, um := range list {
+		id := um.Meta.ID
+		_, err := tx.Database().GetRawByID(um.MediaID, ser.MediaService, tx)
+		if errors.Is(err, ErrNotFound) {
+			h.Orphaned = append(h.Orphaned, id)
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to get Media with ID %d: %w", um.MediaID, err)
+		}
+		byMedia[um.MediaID] = append(byMedia[um.MediaID], id)
+
+		status := models.WatchStatusPlanning
+		if um.Status != nil {
+			status = *um.Status
+		}
+
+		if status == models.WatchStatusCurrent &&
+			now.Sub(lastProgress(um)) > staleAfter {
+			h.Stale = append(h.Stale, id)
+		}
+		if status != models.WatchStatusPlanning && um.Score == nil {
+			h.MissingScore = append(h.MissingScore, id)
+		}
+		if status == models.WatchStatusCompleted {
+			n := len(um.WatchInstances)
+			if n == 0 || um.WatchInstances[n-1].EndDate == nil {
+				h.MissingFinishDate = append(h.MissingFinishDate, id)
+			}
+		}
+	}
+
+	for _, ids := range byMedia {
+		if len(ids) > 1 {
+			h.Duplicates = append(h.Duplicates, ids)
+		}
+	}
+	sort.Slice(h.Duplicates, func(i, j int) bool {
+		return h.Duplicates[i][0] < h.Duplicates[j][0]
+	})
+
+	if len(h.Stale) > 0 {
+		hold := models.WatchStatusHold
+		h.Fixes = append(h.Fixes, models.LibraryFix{
+			Issue:        models.LibraryIssueStale,
+			Description:  "Put entries without recent progress on hold",
+			UserMediaIDs: h.Stale,
+			Edit:         &models.UserMediaEdit{Status: &hold},
+		})
+	}
+	if len(h.MissingScore) > 0 {
+		h.Fixes = append(h.Fixes, models.LibraryFix{
+			Issue:        models.LibraryIssueMissingScore,
+			Description:  "Score entries that have been watched",
+			UserMediaIDs: h.MissingScore,
+		})
+	}
+	if len(h.MissingFinishDate) > 0 {
+		h.Fixes = append(h.Fixes, models.LibraryFix{
+			Issue:        models.LibraryIssueMissingFinishDate,
+			Description:  "Set the finish dates of completed entries to their last update",
+			UserMediaIDs: h.MissingFinishDate,
+			Edit:         &models.UserMediaEdit{FillFinishDate: true},
+		})
+	}
+	if len(h.Orphaned) > 0 {
+		h.Fixes = append(h.Fixes, models.LibraryFix{
+			Issue:        models.LibraryIssueOrphaned,
+			Description:  "Delete entries of Media that no longer exist",
+			UserMediaIDs: h.Orphaned,
+			Edit:         &models.UserMediaEdit{Delete: true},
+		})
+	}
+	for _, ids := range h.Duplicates {
+		// Keep the oldest entry and delete the rest
+		h.Fixes = append(h.Fixes, models.LibraryFix{
+			Issue:        models.LibraryIssueDuplicate,
+			Description:  "Delete duplicate entries of the same Media",
+			UserMediaIDs: ids[1:],
+			Edit:         &models.UserMediaEdit{Delete: true},
+		})
+	}
+
+	return &h, nil
+}
+
+// lastProgress returns the time of the latest progress recorded in the given
+// UserMedia.
+func lastProgress(um *models.UserMedia) time.Time {
+	last := um.Meta.CreatedAt
+	for _, wi := range um.WatchInstances {
+		for _, t := range []*time.Time{wi.StartDate, wi.EndDate} {
+			if t != nil && t.After(last) {
+				last = *t
+			}
+		}
+	}
+	return last
+}
+
+// BulkEdit applies the given edit to the UserMedia with the given IDs, all of
+// which must belong to the User with the given ID. It returns the number of
+// UserMedia changed. The UserMedia are edited one by one, so the transaction
+// must be rolled back if the edit of any of them fails.
+func (ser *UserMediaService) BulkEdit(
+	uID int, ids []int, edit *models.UserMediaEdit, tx db.Tx,
+) (int, error) {
+	if edit == nil {
+		return 0, fmt.Errorf("edit: %w", errNil)
+	}
+
+	list, err := ser.GetMultiple(ids, tx, func(_ *models.UserMedia) bool {
+		return true
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get UserMedia: %w", err)
+	}
+	for _, um := range list {
+		if um.UserID != uID {
+			return 0, fmt.Errorf("UserMedia with ID %d of User with ID %d: %w",
+				um.Meta.ID, uID, ErrUnauthorized)
+		}
+	}
+
+	for _, um := range list {
+		if edit.Delete {
+			err = ser.Delete(um.Meta.ID, tx)
+			if err != nil {
+				return 0, fmt.Errorf("failed to delete UserMedia with ID %d: %w",
+					um.Meta.ID, err)
+			}
+			continue
+		}
+
+		if edit.Status != nil {
+			status := *edit.Status
+			um.Status = &status
+		}
+		if edit.Score != nil {
+			score := *edit.Score
+			um.Score = &score
+		}
+		if edit.FinishDate != nil || edit.FillFinishDate {
+			finish := um.Meta.UpdatedAt
+			if edit.FinishDate != nil {
+				finish = *edit.FinishDate
+			}
+			fillFinishDate(um, finish)
+		}
+
+		err = ser.Update(um, tx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update UserMedia with ID %d: %w",
+				um.Meta.ID, err)
+		}
+	}
+
+	return len(list), nil
+}
+
+// fillFinishDate sets the end date of the last watch of the given UserMedia
+// if it has none, recording a watch if there are none.
+func fillFinishDate(um *models.UserMedia, finish time.Time) {
+	n := len(um.WatchInstances)
+	if n == 0 {
+		um.WatchInstances = append(um.WatchInstances, models.WatchedInstance{})
+		n++
+	}
+
+	wi := &um.WatchInstances[n-1]
+	if wi.EndDate == nil {
+		wi.EndDate = &finish
+		wi.Ongoing = false
+	}
+}
@@ -0,0 +1,347 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// LockService performs operations on Lock, the marks of entities being
+// edited by Users.
+type LockService struct {
+	UserService *UserService
+	Hooks       db.PersistHooks
+}
+
+// NewLockService returns a LockService that locks the entities of the given
+// services.
+func NewLockService(
+	hooks db.PersistHooks, userService *UserService, mediaService *MediaService,
+) *LockService {
+	// Initialize LockService
+	lockService := &LockService{
+		UserService: userService,
+		Hooks:       hooks,
+	}
+	mediaService.LockService = lockService
+
+	// Add hook to delete Locks on User deletion
+	deleteLockOnDeleteUser := func(u db.Model, _ db.Service, tx db.Tx) error {
+		uID := u.Metadata().ID
+		err := lockService.DeleteByUser(uID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to delete Locks by User ID %d: %w", uID, err)
+		}
+		return nil
+	}
+	uSerHooks := userService.PersistHooks()
+	uSerHooks.PreDeleteHooks = append(uSerHooks.PreDeleteHooks, deleteLockOnDeleteUser)
+
+	// Add hook to delete Locks on deletion of the locked entities
+	deleteLockOnDeleteEntity := func(m db.Model, ser db.Service, tx db.Tx) error {
+		id := m.Metadata().ID
+		err := lockService.DeleteByEntity(ser.Bucket(), id, tx)
+		if err != nil {
+			return fmt.Errorf("failed to delete Lock of %s with ID %d: %w",
+				ser.Bucket(), id, err)
+		}
+		return nil
+	}
+	for _, ser := range []db.Service{mediaService} {
+		serHooks := ser.PersistHooks()
+		serHooks.PreDeleteHooks = append(serHooks.PreDeleteHooks, deleteLockOnDeleteEntity)
+	}
+
+	return lockService
+}
+
+// Lock locks the entity with the given ID in the given bucket for the User
+// with the given ID until the given time, renewing the Lock if that User
+// already holds it. It returns an error wrapping ErrLocked if another User
+// holds the Lock at the given current time.
+func (ser *LockService) Lock(
+	bucket string, id int, uID int, expiresAt time.Time, now time.Time, tx db.Tx,
+) (*models.Lock, error) {
+	l, err := ser.GetByEntity(bucket, id, tx)
+	if errors.Is(err, ErrNotFound) {
+		l = &models.Lock{Bucket: bucket, ModelID: id, UserID: uID, ExpiresAt: expiresAt}
+		_, err = ser.Create(l, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Lock: %w", err)
+		}
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if l.UserID != uID && l.Held(now) {
+		return nil, lockedError(l)
+	}
+	l.UserID = uID
+	l.ExpiresAt = expiresAt
+	err = ser.Update(l, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update Lock with ID %d: %w", l.Meta.ID, err)
+	}
+	return l, nil
+}
+
+// Unlock releases the Lock of the entity with the given ID in the given
+// bucket on behalf of the caller. The Locks of other Users may only be
+// released before they expire if force is true and the caller is an Admin.
+// It returns an error wrapping ErrNotFound if the entity is not locked.
+func (ser *LockService) Unlock(
+	caller *models.User, bucket string, id int, force bool, now time.Time, tx db.Tx,
+) error {
+	if caller == nil {
+		return fmt.Errorf("no credentials given: %w", ErrUnauthorized)
+	}
+	l, err := ser.GetByEntity(bucket, id, tx)
+	if err != nil {
+		return err
+	}
+
+	if l.UserID != caller.Meta.ID && l.Held(now) {
+		if !force {
+			return lockedError(l)
+		}
+		if !caller.Permissions.Role().Includes(models.RoleAdmin) {
+			return fmt.Errorf("Lock held by User with ID %d: only Admins may force it: %w",
+				l.UserID, ErrUnauthorized)
+		}
+	}
+	return ser.Delete(l.Meta.ID, tx)
+}
+
+// Check returns an error wrapping ErrLocked if the entity with the given ID
+// in the given bucket is locked by a User other than the caller at the given
+// time.
+func (ser *LockService) Check(
+	caller *models.User, bucket string, id int, now time.Time, tx db.Tx,
+) error {
+	l, err := ser.GetByEntity(bucket, id, tx)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !l.Held(now) || (caller != nil && l.UserID == caller.Meta.ID) {
+		return nil
+	}
+	return lockedError(l)
+}
+
+// lockedError returns an error wrapping ErrLocked for the given held Lock.
+func lockedError(l *models.Lock) error {
+	return fmt.Errorf("%s with ID %d: locked by User with ID %d until %s: %w",
+		l.Bucket, l.ModelID, l.UserID, l.ExpiresAt.Format(time.RFC3339), ErrLocked)
+}
+
+// Create persists the given Lock.
+func (ser *LockService) Create(l *models.Lock, tx db.Tx) (int, error) {
+	return tx.Database().Create(l, ser, tx)
+}
+
+// Update replaces the value of the Lock with the given ID.
+func (ser *LockService) Update(l *models.Lock, tx db.Tx) error {
+	return tx.Database().Update(l, ser, tx)
+}
+
+// Delete deletes the Lock with the given ID.
+func (ser *LockService) Delete(id int, tx db.Tx) error {
+	return tx.Database().Delete(id, ser, tx)
+}
+
+// DeleteByUser deletes the Locks held by the User with the given ID.
+func (ser *LockService) DeleteByUser(uID int, tx db.Tx) error {
+	return tx.Database().DeleteFilter(ser, tx, func(m db.Model) bool {
+		l, err := ser.AssertType(m)
+		if err != nil {
+			return false
+		}
+		return l.UserID == uID
+	})
+}
+
+// DeleteByEntity deletes the Lock of the entity with the given ID in the
+// given bucket.
+func (ser *LockService) DeleteByEntity(bucket string, id int, tx db.Tx) error {
+	return tx.Database().DeleteFilter(ser, tx, func(m db.Model) bool {
+		l, err := ser.AssertType(m)
+		if err != nil {
+			return false
+		}
+		return l.Bucket == bucket && l.ModelID == id
+	})
+}
+
+// GetByEntity retrieves the Lock of the entity with the given ID in the given
+// bucket, expired or not. It returns an error wrapping ErrNotFound if there
+// is none.
+func (ser *LockService) GetByEntity(bucket string, id int, tx db.Tx) (*models.Lock, error) {
+	one := 1
+	list, err := ser.GetFilter(&one, nil, tx, func(l *models.Lock) bool {
+		return l.Bucket == bucket && l.ModelID == id
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Locks: %w", err)
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("Lock of %s with ID %d: %w", bucket, id, ErrNotFound)
+	}
+	return list[0], nil
+}
+
+// GetFilter retrieves all persisted values of Lock that pass the filter.
+func (ser *LockService) GetFilter(
+	first *int, skip *int, tx db.Tx, keep func(l *models.Lock) bool,
+) ([]*models.Lock, error) {
+	vlist, err := tx.Database().GetFilter(first, skip, ser, tx,
+		func(m db.Model) bool {
+			l, err := ser.AssertType(m)
+			if err != nil {
+				return false
+			}
+			return keep(l)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to Locks: %w", err)
+	}
+	return list, nil
+}
+
+// GetAll retrieves all persisted values of Lock.
+func (ser *LockService) GetAll(first *int, skip *int, tx db.Tx) ([]*models.Lock, error) {
+	vlist, err := tx.Database().GetAll(first, skip, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to Locks: %w", err)
+	}
+	return list, nil
+}
+
+// Bucket returns the name of the bucket for Lock.
+func (ser *LockService) Bucket() string {
+	return "Lock"
+}
+
+// UniqueKey returns the bucket and the ID of the locked entity.
+func (ser *LockService) UniqueKey(m db.Model) (string, error) {
+	l, err := ser.AssertType(m)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return l.Bucket + "/" + strconv.Itoa(l.ModelID), nil
+}
+
+// Clean cleans the given Lock for storage.
+func (ser *LockService) Clean(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// Validate returns an error if the Lock is not valid for the database.
+func (ser *LockService) Validate(m db.Model, tx db.Tx) error {
+	l, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	var verr ValidationError
+	ValidateTags(l, &verr)
+	err = verr.Err()
+	if err != nil {
+		return err
+	}
+
+	// Check if User with ID specified in Lock exists
+	_, err = tx.Database().GetRawByID(l.UserID, ser.UserService, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get User with ID %d: %w", l.UserID, err)
+	}
+
+	return nil
+}
+
+// Initialize sets initial values for some properties.
+func (ser *LockService) Initialize(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistOldProperties maintains certain properties of the existing Lock in
+// updates.
+func (ser *LockService) PersistOldProperties(_ db.Model, _ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistHooks returns the persistence hook functions.
+func (ser *LockService) PersistHooks() *db.PersistHooks {
+	return &ser.Hooks
+}
+
+// Marshal encodes the given Lock for storage.
+func (ser *LockService) Marshal(m db.Model) ([]byte, error) {
+	l, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	v, err := db.Codecs.Encode(ser.Bucket(), l)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
+	}
+
+	return v, nil
+}
+
+// Unmarshal decodes the given record into Lock.
+func (ser *LockService) Unmarshal(buf []byte) (db.Model, error) {
+	var l models.Lock
+	err := db.Codecs.Decode(buf, &l)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
+	}
+	return &l, nil
+}
+
+// AssertType exposes the given db.Model as a Lock.
+func (ser *LockService) AssertType(m db.Model) (*models.Lock, error) {
+	if m == nil {
+		return nil, fmt.Errorf("model: %w", errNil)
+	}
+
+	l, ok := m.(*models.Lock)
+	if !ok {
+		return nil, fmt.Errorf("model: %w", errors.New("not of Lock type"))
+	}
+	return l, nil
+}
+
+// mapFromModel returns a list of Lock type asserted from the given list of
+// db.Model.
+func (ser *LockService) mapFromModel(vlist []db.Model) ([]*models.Lock, error) {
+	list := make([]*models.Lock, len(vlist))
+	var err error
+	for i, v := range vlist {
+		list[i], err = ser.AssertType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,338 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// LoginSessionService performs operations on LoginSession.
+type LoginSessionService struct {
+	UserService *UserService
+	Hooks       db.PersistHooks
+}
+
+// NewLoginSessionService returns a LoginSessionService.
+func NewLoginSessionService(
+	hooks db.PersistHooks, userService *UserService,
+) *LoginSessionService {
+	// Initialize LoginSessionService
+	loginSessionService := &LoginSessionService{
+		UserService: userService,
+		Hooks:       hooks,
+	}
+
+	// Add hook to delete LoginSession on User deletion
+	deleteLoginSessionOnDeleteUser := func(um db.Model, _ db.Service, tx db.Tx) error {
+		uID := um.Metadata().ID
+		err := loginSessionService.DeleteByUser(uID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to delete LoginSession by User ID %d: %w", uID, err)
+		}
+		return nil
+	}
+	uSerHooks := userService.PersistHooks()
+	uSerHooks.PreDeleteHooks =
+		append(uSerHooks.PreDeleteHooks, deleteLoginSessionOnDeleteUser)
+
+	return loginSessionService
+}
+
+// Start begins a LoginSession of the User with the given ID on the given
+// device and address, lasting until the given time, and deletes the expired
+// LoginSessions of the User.
+func (ser *LoginSessionService) Start(
+	uID int, device string, ip string, now time.Time, expiresAt time.Time, tx db.Tx,
+) (*models.LoginSession, error) {
+	err := tx.Database().DeleteFilter(ser, tx, func(m db.Model) bool {
+		ls, err := ser.AssertType(m)
+		if err != nil {
+			return false
+		}
+		return ls.UserID == uID && now.After(ls.ExpiresAt)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired LoginSessions: %w", err)
+	}
+
+	ls := models.LoginSession{
+		UserID:    uID,
+		Device:    device,
+		IP:        ip,
+		LastUsed:  now,
+		ExpiresAt: expiresAt,
+	}
+	_, err = ser.Create(&ls, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create LoginSession: %w", err)
+	}
+	return &ls, nil
+}
+
+// Use returns the LoginSession with the given ID of the User with the given
+// ID, marked as last used at the given time, from the given address if not
+// empty, and extended to the given expiry if not zero. It returns an error
+// wrapping ErrUnauthorized if the LoginSession was revoked or has expired.
+func (ser *LoginSessionService) Use(
+	id int, uID int, ip string, now time.Time, expiresAt time.Time, tx db.Tx,
+) (*models.LoginSession, error) {
+	ls, err := ser.Verify(id, uID, now, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	ls.LastUsed = now
+	if ip != "" {
+		ls.IP = ip
+	}
+	if !expiresAt.IsZero() {
+		ls.ExpiresAt = expiresAt
+	}
+	err = ser.Update(ls, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update LoginSession with ID %d: %w", id, err)
+	}
+	return ls, nil
+}
+
+// Verify returns the LoginSession with the given ID of the User with the
+// given ID, or an error wrapping ErrUnauthorized if it was revoked or has
+// expired by the given time.
+func (ser *LoginSessionService) Verify(
+	id int, uID int, now time.Time, tx db.Tx,
+) (*models.LoginSession, error) {
+	ls, err := ser.GetByID(id, tx)
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("LoginSession with ID %d: revoked: %w", id, ErrUnauthorized)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get LoginSession by ID %d: %w", id, err)
+	}
+	if ls.UserID != uID {
+		return nil, fmt.Errorf("LoginSession with ID %d: not of User with ID %d: %w",
+			id, uID, ErrUnauthorized)
+	}
+	if now.After(ls.ExpiresAt) {
+		return nil, fmt.Errorf("LoginSession with ID %d: expired: %w", id, ErrUnauthorized)
+	}
+	return ls, nil
+}
+
+// Revoke deletes the LoginSession with the given ID of the User with the
+// given ID. It returns an error wrapping ErrNotFound if the User has no such
+// LoginSession.
+func (ser *LoginSessionService) Revoke(id int, uID int, tx db.Tx) error {
+	ls, err := ser.GetByID(id, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get LoginSession by ID %d: %w", id, err)
+	}
+	if ls.UserID != uID {
+		// Don't reveal the sessions of other Users
+		return fmt.Errorf("LoginSession with ID %d: %w", id, ErrNotFound)
+	}
+
+	err = ser.Delete(id, tx)
+	if err != nil {
+		return fmt.Errorf("failed to delete LoginSession with ID %d: %w", id, err)
+	}
+	return nil
+}
+
+// Create persists the given LoginSession.
+func (ser *LoginSessionService) Create(ls *models.LoginSession, tx db.Tx) (int, error) {
+	return tx.Database().Create(ls, ser, tx)
+}
+
+// Update replaces the value of the LoginSession with the given ID.
+func (ser *LoginSessionService) Update(ls *models.LoginSession, tx db.Tx) error {
+	return tx.Database().Update(ls, ser, tx)
+}
+
+// Delete deletes the LoginSession with the given ID.
+func (ser *LoginSessionService) Delete(id int, tx db.Tx) error {
+	return tx.Database().Delete(id, ser, tx)
+}
+
+// DeleteByUser deletes the LoginSessions of the User with the given ID.
+func (ser *LoginSessionService) DeleteByUser(uID int, tx db.Tx) error {
+	return tx.Database().DeleteFilter(ser, tx, func(m db.Model) bool {
+		ls, err := ser.AssertType(m)
+		if err != nil {
+			return false
+		}
+		return ls.UserID == uID
+	})
+}
+
+// GetByUser retrieves the LoginSessions of the User with the given ID that
+// have not expired by the given time, most recently used first.
+func (ser *LoginSessionService) GetByUser(
+	uID int, now time.Time, tx db.Tx,
+) ([]*models.LoginSession, error) {
+	list, err := ser.GetFilter(nil, nil, tx, func(ls *models.LoginSession) bool {
+		return ls.UserID == uID && !now.After(ls.ExpiresAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].LastUsed.After(list[j].LastUsed)
+	})
+	return list, nil
+}
+
+// GetByID retrieves the persisted LoginSession with the given ID.
+func (ser *LoginSessionService) GetByID(id int, tx db.Tx) (*models.LoginSession, error) {
+	m, err := tx.Database().GetByID(id, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	ls, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return ls, nil
+}
+
+// GetFilter retrieves all persisted values of LoginSession that pass the
+// filter.
+func (ser *LoginSessionService) GetFilter(
+	first *int, skip *int, tx db.Tx, keep func(ls *models.LoginSession) bool,
+) ([]*models.LoginSession, error) {
+	vlist, err := tx.Database().GetFilter(first, skip, ser, tx,
+		func(m db.Model) bool {
+			ls, err := ser.AssertType(m)
+			if err != nil {
+				return false
+			}
+			return keep(ls)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to LoginSessions: %w", err)
+	}
+	return list, nil
+}
+
+// GetAll retrieves all persisted values of LoginSession.
+func (ser *LoginSessionService) GetAll(
+	first *int, skip *int, tx db.Tx,
+) ([]*models.LoginSession, error) {
+	vlist, err := tx.Database().GetAll(first, skip, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to LoginSessions: %w", err)
+	}
+	return list, nil
+}
+
+// Bucket returns the name of the bucket for LoginSession.
+func (ser *LoginSessionService) Bucket() string {
+	return "LoginSession"
+}
+
+// Clean cleans the given LoginSession for storage.
+func (ser *LoginSessionService) Clean(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// Validate returns an error if the LoginSession is not valid for the
+// database.
+func (ser *LoginSessionService) Validate(m db.Model, tx db.Tx) error {
+	e, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	// Check if User with ID specified in LoginSession exists
+	_, err = tx.Database().GetRawByID(e.UserID, ser.UserService, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get User with ID %d: %w", e.UserID, err)
+	}
+
+	return nil
+}
+
+// Initialize sets initial values for some properties.
+func (ser *LoginSessionService) Initialize(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistOldProperties maintains certain properties of the existing
+// LoginSession in updates.
+func (ser *LoginSessionService) PersistOldProperties(_ db.Model, _ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistHooks returns the persistence hook functions.
+func (ser *LoginSessionService) PersistHooks() *db.PersistHooks {
+	return &ser.Hooks
+}
+
+// Marshal encodes the given LoginSession for storage.
+func (ser *LoginSessionService) Marshal(m db.Model) ([]byte, error) {
+	ls, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	v, err := db.Codecs.Encode(ser.Bucket(), ls)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
+	}
+
+	return v, nil
+}
+
+// Unmarshal decodes the given record into LoginSession.
+func (ser *LoginSessionService) Unmarshal(buf []byte) (db.Model, error) {
+	var ls models.LoginSession
+	err := db.Codecs.Decode(buf, &ls)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
+	}
+	return &ls, nil
+}
+
+// AssertType exposes the given db.Model as a LoginSession.
+func (ser *LoginSessionService) AssertType(m db.Model) (*models.LoginSession, error) {
+	if m == nil {
+		return nil, fmt.Errorf("model: %w", errNil)
+	}
+
+	ls, ok := m.(*models.LoginSession)
+	if !ok {
+		return nil, fmt.Errorf("model: %w", errors.New("not of LoginSession type"))
+	}
+	return ls, nil
+}
+
+// mapFromModel returns a list of LoginSession type asserted from the given
+// list of db.Model.
+func (ser *LoginSessionService) mapFromModel(
+	vlist []db.Model,
+) ([]*models.LoginSession, error) {
+	list := make([]*models.LoginSession, len(vlist))
+	var err error
+	for i, v := range vlist {
+		list[i], err = ser.AssertType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+	}
+	return list, nil
+}
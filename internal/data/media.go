@@ -3,11 +3,12 @@ package data
 import (
 	"errors"
 	"fmt"
-	"strings"
+	"math/rand"
+	"time"
 
+	"github.com/Dophin2009/nao/internal/data/query"
 	"github.com/Dophin2009/nao/pkg/models"
 	"github.com/Dophin2009/nao/pkg/db"
-	json "github.com/json-iterator/go"
 )
 
 // TODO: Fuzzy search of models
@@ -15,6 +16,15 @@ import (
 // MediaService performs operations on Media.
 type MediaService struct {
 	Hooks db.PersistHooks
+	// SlugService indexes the Media by their Slugs; Slugs are only generated
+	// if nil.
+	SlugService *SlugService
+	// NameService indexes the Media by their Titles and MediaAliases for
+	// search.
+	NameService *NameService
+	// LockService keeps the Media locked by Users from being changed by
+	// others in UpdateAs and UpsertAs; Media are not locked if nil.
+	LockService *LockService
 }
 
 // NewMediaService returns a MediaService.
@@ -34,11 +44,231 @@ func (ser *MediaService) Update(md *models.Media, tx db.Tx) error {
 	return tx.Database().Update(md, ser, tx)
 }
 
+// UpdateAs edits the Media with the given ID as Edit does, on behalf of the
+// caller. It returns an error wrapping ErrLocked if the Media is locked by
+// another User.
+func (ser *MediaService) UpdateAs(caller *models.User, md *models.Media, tx db.Tx) error {
+	err := ser.checkLock(caller, md.Meta.ID, tx)
+	if err != nil {
+		return err
+	}
+	return ser.Edit(md, tx)
+}
+
+// Edit replaces the value of the Media with the given ID as a manual edit.
+// The fields of models.MediaRefreshFields changed are added to the
+// LockedFields of the Media, so that refreshes from the catalogue of its
+// ExternalID keep the edits.
+func (ser *MediaService) Edit(md *models.Media, tx db.Tx) error {
+	old, err := ser.GetByID(md.Meta.ID, tx)
+	if err != nil {
+		return err
+	}
+	err = cleanTitles(md.Titles, md.Synopses)
+	if err != nil {
+		return err
+	}
+	locked := md.LockedFields
+	if locked == nil {
+		locked = old.LockedFields
+	}
+	for _, f := range editedMediaFields(old, md) {
+		if !containsString(locked, f) {
+			locked = append(locked, f)
+		}
+	}
+	md.LockedFields = locked
+	return ser.Update(md, tx)
+}
+
+// Refresh applies the given metadata of the Media with the given ID, fetched
+// from the catalogue of its ExternalID, to the fields of
+// models.MediaRefreshFields not in its LockedFields, and returns true if the
+// Media changed. Updates are not destructive: Titles and Synopses replace
+// only those in the same languages, and fields not known in the catalogue
+// are kept. The ReleaseStatus of the Media is derived again from changed
+// dates if it may become the derived one.
+func (ser *MediaService) Refresh(id int, fetched *models.Media, tx db.Tx) (bool, error) {
+	md, err := ser.GetByID(id, tx)
+	if err != nil {
+		return false, err
+	}
+	err = cleanTitles(fetched.Titles, fetched.Synopses)
+	if err != nil {
+		return false, err
+	}
+
+	old := *md
+	if !md.Locked(models.MediaFieldTitles) {
+		md.Titles = mergeTitles(md.Titles, fetched.Titles)
+	}
+	if !md.Locked(models.MediaFieldSynopses) {
+		md.Synopses = mergeTitles(md.Synopses, fetched.Synopses)
+	}
+	if fetched.StartDate != nil && !md.Locked(models.MediaFieldStartDate) {
+		md.StartDate = fetched.StartDate
+	}
+	if fetched.EndDate != nil && !md.Locked(models.MediaFieldEndDate) {
+		md.EndDate = fetched.EndDate
+	}
+	if fetched.EpisodeCount != nil && !md.Locked(models.MediaFieldEpisodeCount) {
+		md.EpisodeCount = fetched.EpisodeCount
+	}
+
+	edited := editedMediaFields(&old, md)
+	if len(edited) == 0 {
+		return false, nil
+	}
+	if !timesEqual(old.StartDate, md.StartDate) || !timesEqual(old.EndDate, md.EndDate) {
+		s := models.DeriveReleaseStatus(md.StartDate, md.EndDate, time.Now())
+		if s != nil && (md.ReleaseStatus == nil || md.ReleaseStatus.CanBecome(*s)) {
+			md.ReleaseStatus = s
+		}
+	}
+
+	err = ser.Update(md, tx)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// editedMediaFields returns the fields of models.MediaRefreshFields whose
+// values differ between the given old and new Media.
+func editedMediaFields(o *models.Media, n *models.Media) []string {
+	edited := []string{}
+	if !titlesEqual(o.Titles, n.Titles) {
+		edited = append(edited, models.MediaFieldTitles)
+	}
+	if !titlesEqual(o.Synopses, n.Synopses) {
+		edited = append(edited, models.MediaFieldSynopses)
+	}
+	if !timesEqual(o.StartDate, n.StartDate) {
+		edited = append(edited, models.MediaFieldStartDate)
+	}
+	if !timesEqual(o.EndDate, n.EndDate) {
+		edited = append(edited, models.MediaFieldEndDate)
+	}
+	if (o.EpisodeCount == nil) != (n.EpisodeCount == nil) ||
+		o.EpisodeCount != nil && *o.EpisodeCount != *n.EpisodeCount {
+		edited = append(edited, models.MediaFieldEpisodeCount)
+	}
+	return edited
+}
+
+// mergeTitles returns the given Titles with those in the languages of the
+// given new Titles replaced by them.
+func mergeTitles(titles []models.Title, updates []models.Title) []models.Title {
+	if len(updates) == 0 {
+		return titles
+	}
+	langs := map[string]bool{}
+	for _, t := range updates {
+		langs[t.Language] = true
+	}
+	merged := []models.Title{}
+	for _, t := range titles {
+		if !langs[t.Language] {
+			merged = append(merged, t)
+		}
+	}
+	return append(merged, updates...)
+}
+
+// titlesEqual checks if the given lists of Titles are equal, in order.
+func titlesEqual(a []models.Title, b []models.Title) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// timesEqual checks if the given optional times are both unset or the same
+// instant.
+func timesEqual(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// UpsertAs upserts the given Media as Upsert does, on behalf of the caller. It
+// returns an error wrapping ErrLocked if the Media to update is locked by
+// another User.
+func (ser *MediaService) UpsertAs(
+	caller *models.User, md *models.Media, key string, tx db.Tx,
+) (int, bool, error) {
+	id, created, err := ser.Upsert(md, key, tx)
+	if err != nil || created {
+		return id, created, err
+	}
+
+	// The update is rolled back with the transaction
+	err = ser.checkLock(caller, id, tx)
+	if err != nil {
+		return 0, false, err
+	}
+	return id, created, nil
+}
+
+// checkLock returns an error wrapping ErrLocked if the Media with the given
+// ID is locked by a User other than the caller.
+func (ser *MediaService) checkLock(caller *models.User, id int, tx db.Tx) error {
+	if ser.LockService == nil {
+		return nil
+	}
+	return ser.LockService.Check(caller, ser.Bucket(), id, time.Now(), tx)
+}
+
+// Upsert updates the Media whose key of the given name, one of MediaKeySlug
+// and MediaKeyExternalID, has the value of that of the given Media, or
+// creates the given Media if there is none. It returns the ID of the Media
+// and true if it was created.
+func (ser *MediaService) Upsert(md *models.Media, key string, tx db.Tx) (int, bool, error) {
+	return tx.Database().Upsert(md, ser, key, tx)
+}
+
 // Delete deletes the Media with the given ID.
 func (ser *MediaService) Delete(id int, tx db.Tx) error {
 	return tx.Database().Delete(id, ser, tx)
 }
 
+// DeleteFilter deletes the Media that pass the filter, along with the
+// entities deleted with them, returning the IDs of the deleted Media in
+// order.
+func (ser *MediaService) DeleteFilter(
+	keep func(md *models.Media) bool, tx db.Tx,
+) ([]int, error) {
+	list, err := ser.GetFilter(nil, nil, tx, keep)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Media: %w", err)
+	}
+
+	ids := make([]int, len(list))
+	for i, md := range list {
+		ids[i] = md.Meta.ID
+		err = ser.Delete(md.Meta.ID, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete Media with ID %d: %w", md.Meta.ID, err)
+		}
+	}
+	return ids, nil
+}
+
 // GetAll retrieves all persisted values of Media.
 func (ser *MediaService) GetAll(first *int, skip *int, tx db.Tx) ([]*models.Media, error) {
 	vlist, err := tx.Database().GetAll(first, skip, ser, tx)
@@ -113,48 +343,236 @@ func (ser *MediaService) GetByID(id int, tx db.Tx) (*models.Media, error) {
 	return md, nil
 }
 
+// GetBySlug retrieves the persisted Media with the given Slug.
+func (ser *MediaService) GetBySlug(slug string, tx db.Tx) (*models.Media, error) {
+	id, err := ser.SlugService.ID(ser.Bucket(), slug, tx)
+	if err != nil {
+		return nil, err
+	}
+	return ser.GetByID(id, tx)
+}
+
+// Search retrieves the persisted Media with a Title or MediaAlias matching
+// the given query, at most first if not nil, by NameService.Search.
+func (ser *MediaService) Search(query string, first *int, tx db.Tx) ([]*models.Media, error) {
+	ids, err := ser.NameService.Search(ser.Bucket(), query, first, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*models.Media, len(ids))
+	for i, id := range ids {
+		list[i], err = ser.GetByID(id, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Media with ID %d: %w", id, err)
+		}
+	}
+	return list, nil
+}
+
+// GetByIDs retrieves the persisted Media with the given IDs, in the order of
+// the IDs. IDs of no Media are left nil in the list.
+func (ser *MediaService) GetByIDs(ids []int, tx db.Tx) ([]*models.Media, error) {
+	vlist, err := tx.Database().GetByIDs(ids, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*models.Media, len(vlist))
+	for i, v := range vlist {
+		if v == nil {
+			continue
+		}
+		list[i], err = ser.AssertType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+	}
+	return list, nil
+}
+
+// Count returns the number of persisted Media that pass the filter. A nil
+// filter passes all.
+func (ser *MediaService) Count(tx db.Tx, keep func(md *models.Media) bool) (int, error) {
+	var filter func(m db.Model) bool
+	if keep != nil {
+		filter = func(m db.Model) bool {
+			md, err := ser.AssertType(m)
+			if err != nil {
+				return false
+			}
+			return keep(md)
+		}
+	}
+	return tx.Database().Count(ser, tx, filter)
+}
+
+// Exists returns true if the Media with the given ID is persisted.
+func (ser *MediaService) Exists(id int, tx db.Tx) (bool, error) {
+	return tx.Database().Exists(id, ser, tx)
+}
+
+// Random returns up to n persisted Media that pass the filter, chosen
+// uniformly at random; a nil rnd uses the default source of math/rand. A nil
+// filter passes all.
+func (ser *MediaService) Random(
+	n int, tx db.Tx, keep func(md *models.Media) bool, rnd *rand.Rand,
+) ([]*models.Media, error) {
+	var filter func(m db.Model) bool
+	if keep != nil {
+		filter = func(m db.Model) bool {
+			md, err := ser.AssertType(m)
+			if err != nil {
+				return false
+			}
+			return keep(md)
+		}
+	}
+	vlist, err := tx.Database().Sample(n, ser, tx, filter, rnd)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to Media: %w", err)
+	}
+	return list, nil
+}
+
 // Bucket returns the name of the bucket for Media.
 func (ser *MediaService) Bucket() string {
 	return "Media"
 }
 
 // Clean cleans the given Media for storage
-func (ser *MediaService) Clean(m db.Model, _ db.Tx) error {
+func (ser *MediaService) Clean(m db.Model, tx db.Tx) error {
 	e, err := ser.AssertType(m)
 	if err != nil {
 		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
-	if e.Type != nil {
-		*e.Type = strings.Trim(*e.Type, " ")
-	}
-	if e.Source != nil {
-		*e.Source = strings.Trim(*e.Source, " ")
-	}
-
 	if e.SeasonPremiered.Quarter != nil && *e.SeasonPremiered.Quarter > 4 {
 		*e.SeasonPremiered.Quarter = 0
 	}
-	return nil
+	err = cleanTitles(e.Titles, e.Synopses, e.Background)
+	if err != nil {
+		return err
+	}
+
+	e.Slug, err = ser.SlugService.clean(ser.Bucket(), e.Meta.ID, e.Slug, e.Titles, tx)
+	return err
 }
 
 // Validate checks if the given Media is valid.
-func (ser *MediaService) Validate(m db.Model, _ db.Tx) error {
-	_, err := ser.AssertType(m)
+func (ser *MediaService) Validate(m db.Model, tx db.Tx) error {
+	md, err := ser.AssertType(m)
 	if err != nil {
 		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
+
+	var verr ValidationError
+	ValidateTags(md, &verr)
+	if md.ReleaseStatus != nil && !md.ReleaseStatus.IsValid() {
+		verr.Addf("ReleaseStatus", FieldInvalid, "unknown status %d", *md.ReleaseStatus)
+	}
+	if md.EpisodeCount != nil && *md.EpisodeCount < 0 {
+		verr.Add("EpisodeCount", FieldOutOfRange, "must not be negative")
+	}
+	for i, f := range md.LockedFields {
+		if !containsString(models.MediaRefreshFields, f) {
+			verr.Addf(db.FieldPath("LockedFields", i, ""), FieldInvalid, "unknown field %q", f)
+		}
+	}
+	err = verr.Err()
+	if err != nil {
+		return err
+	}
+
+	// Check that no other Media has the ExternalID
+	if md.ExternalID != "" {
+		same, err := tx.Database().FindFirst(ser, tx, func(o db.Model) (bool, error) {
+			omd, err := ser.AssertType(o)
+			if err != nil {
+				return true, err
+			}
+			return omd.Meta.ID != md.Meta.ID && omd.ExternalID == md.ExternalID, nil
+		})
+		if err != nil {
+			return err
+		}
+		if same != nil {
+			return fmt.Errorf("external ID %q: held by ID %d: %w",
+				md.ExternalID, same.Metadata().ID, ErrConflict)
+		}
+	}
 	return nil
 }
 
+// Keys of Media that they may be upserted by.
+const (
+	MediaKeySlug       = "slug"
+	MediaKeyExternalID = "externalID"
+)
+
+// Key returns the value of the key of the given name of the given Media.
+func (ser *MediaService) Key(name string, m db.Model) (string, error) {
+	md, err := ser.AssertType(m)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	switch name {
+	case MediaKeySlug:
+		return md.Slug, nil
+	case MediaKeyExternalID:
+		return md.ExternalID, nil
+	}
+	return "", fmt.Errorf("key %q: %w", name, ErrInvalid)
+}
+
 // Initialize sets initial values for some properties.
-func (ser *MediaService) Initialize(_ db.Model, _ db.Tx) error {
+func (ser *MediaService) Initialize(m db.Model, _ db.Tx) error {
+	md, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	if md.ReleaseStatus == nil {
+		md.ReleaseStatus = models.DeriveReleaseStatus(md.StartDate, md.EndDate, time.Now())
+	}
 	return nil
 }
 
 // PersistOldProperties maintains certain properties of the existing Media in
-// updates.
-func (ser *MediaService) PersistOldProperties(_ db.Model, _ db.Model, _ db.Tx) error {
+// updates. Media updated without a ReleaseStatus or LockedFields keep theirs,
+// and the ReleaseStatus may only change as allowed by
+// ReleaseStatus.CanBecome.
+func (ser *MediaService) PersistOldProperties(n db.Model, o db.Model, _ db.Tx) error {
+	nmd, err := ser.AssertType(n)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	omd, err := ser.AssertType(o)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	if nmd.LockedFields == nil {
+		nmd.LockedFields = omd.LockedFields
+	}
+
+	switch {
+	case nmd.ReleaseStatus == nil && omd.ReleaseStatus != nil:
+		nmd.ReleaseStatus = omd.ReleaseStatus
+	case nmd.ReleaseStatus == nil:
+		nmd.ReleaseStatus = models.DeriveReleaseStatus(nmd.StartDate, nmd.EndDate, time.Now())
+	case omd.ReleaseStatus != nil && !omd.ReleaseStatus.CanBecome(*nmd.ReleaseStatus):
+		var verr ValidationError
+		verr.Addf("ReleaseStatus", FieldInvalid, "%s to %s: not allowed",
+			*omd.ReleaseStatus, *nmd.ReleaseStatus)
+		return &verr
+	}
 	return nil
 }
 
@@ -163,31 +581,101 @@ func (ser *MediaService) PersistHooks() *db.PersistHooks {
 	return &ser.Hooks
 }
 
-// Marshal transforms the given Media into JSON.
+// Marshal encodes the given Media for storage.
 func (ser *MediaService) Marshal(m db.Model) ([]byte, error) {
 	md, err := ser.AssertType(m)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
-	v, err := json.Marshal(md)
+	v, err := db.Codecs.Encode(ser.Bucket(), md)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONMarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
 	}
 
 	return v, nil
 }
 
-// Unmarshal parses the given JSON into Media.
+// Unmarshal decodes the given record into Media.
 func (ser *MediaService) Unmarshal(buf []byte) (db.Model, error) {
 	var md models.Media
-	err := json.Unmarshal(buf, &md)
+	err := db.Codecs.Decode(buf, &md)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONUnmarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
 	}
 	return &md, nil
 }
 
+// MediaQuery is the Schema of the fields of Media that query expressions
+// may refer to.
+var MediaQuery = query.Schema{
+	"type": {Kind: query.KindString, Get: func(v interface{}) interface{} {
+		return optionalString(v.(*models.Media).Type)
+	}},
+	"source": {Kind: query.KindString, Get: func(v interface{}) interface{} {
+		return optionalString(v.(*models.Media).Source)
+	}},
+	"slug": {Kind: query.KindString, Get: func(v interface{}) interface{} {
+		return v.(*models.Media).Slug
+	}},
+	"externalID": {Kind: query.KindString, Get: func(v interface{}) interface{} {
+		return v.(*models.Media).ExternalID
+	}},
+	"releaseStatus": {Kind: query.KindString, Get: func(v interface{}) interface{} {
+		s := v.(*models.Media).ReleaseStatus
+		if s == nil {
+			return nil
+		}
+		return s.String()
+	}},
+	"seasonPremiered.year": {Kind: query.KindNumber, Get: func(v interface{}) interface{} {
+		y := v.(*models.Media).SeasonPremiered.Year
+		if y == nil {
+			return nil
+		}
+		return float64(*y)
+	}},
+	"seasonPremiered.quarter": {Kind: query.KindString, Get: func(v interface{}) interface{} {
+		q := v.(*models.Media).SeasonPremiered.Quarter
+		if q == nil {
+			return nil
+		}
+		return q.String()
+	}},
+	"startDate": {Kind: query.KindTime, Get: func(v interface{}) interface{} {
+		return optionalTime(v.(*models.Media).StartDate)
+	}},
+	"endDate": {Kind: query.KindTime, Get: func(v interface{}) interface{} {
+		return optionalTime(v.(*models.Media).EndDate)
+	}},
+}
+
+// CompileMediaQuery compiles the given query expression over the fields of
+// MediaQuery into a filter of Media.
+func CompileMediaQuery(expr string) (func(md *models.Media) bool, error) {
+	f, err := query.Compile(expr, MediaQuery)
+	if err != nil {
+		return nil, err
+	}
+	return func(md *models.Media) bool { return f(md) }, nil
+}
+
+// optionalString returns the value of the given string pointer, or nil.
+func optionalString(s *string) interface{} {
+	if s == nil {
+		return nil
+	}
+	return *s
+}
+
+// optionalTime returns the value of the given time pointer, or nil.
+func optionalTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return *t
+}
+
 // AssertType exposes the given db.Model as a Media.
 func (ser *MediaService) AssertType(m db.Model) (*models.Media, error) {
 	if m == nil {
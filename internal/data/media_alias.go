@@ -0,0 +1,270 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// MediaAliasService performs operations on MediaAlias.
+type MediaAliasService struct {
+	MediaService *MediaService
+	Hooks        db.PersistHooks
+}
+
+// NewMediaAliasService returns a MediaAliasService.
+func NewMediaAliasService(
+	hooks db.PersistHooks, mediaService *MediaService,
+) *MediaAliasService {
+	// Initialize MediaAliasService
+	mediaAliasService := &MediaAliasService{
+		MediaService: mediaService,
+		Hooks:        hooks,
+	}
+
+	// Add hook to delete MediaAlias on Media deletion
+	deleteMediaAliasOnDeleteMedia := func(md db.Model, _ db.Service, tx db.Tx) error {
+		mID := md.Metadata().ID
+		err := mediaAliasService.DeleteByMedia(mID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to delete MediaAlias by Media ID %d: %w", mID, err)
+		}
+		return nil
+	}
+	mdSerHooks := mediaService.PersistHooks()
+	mdSerHooks.PreDeleteHooks =
+		append(mdSerHooks.PreDeleteHooks, deleteMediaAliasOnDeleteMedia)
+
+	return mediaAliasService
+}
+
+// Create persists the given MediaAlias.
+func (ser *MediaAliasService) Create(a *models.MediaAlias, tx db.Tx) (int, error) {
+	return tx.Database().Create(a, ser, tx)
+}
+
+// Update replaces the value of the MediaAlias with the given ID.
+func (ser *MediaAliasService) Update(a *models.MediaAlias, tx db.Tx) error {
+	return tx.Database().Update(a, ser, tx)
+}
+
+// Delete deletes the MediaAlias with the given ID.
+func (ser *MediaAliasService) Delete(id int, tx db.Tx) error {
+	return tx.Database().Delete(id, ser, tx)
+}
+
+// DeleteByMedia deletes the MediaAlias with the given Media ID.
+func (ser *MediaAliasService) DeleteByMedia(mID int, tx db.Tx) error {
+	return tx.Database().DeleteFilter(ser, tx, func(m db.Model) bool {
+		a, err := ser.AssertType(m)
+		if err != nil {
+			return false
+		}
+
+		return a.MediaID == mID
+	})
+}
+
+// GetAll retrieves all persisted values of MediaAlias.
+func (ser *MediaAliasService) GetAll(
+	first *int, skip *int, tx db.Tx,
+) ([]*models.MediaAlias, error) {
+	vlist, err := tx.Database().GetAll(first, skip, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to MediaAlias: %w", err)
+	}
+	return list, nil
+}
+
+// GetFilter retrieves all persisted values of MediaAlias that pass the
+// filter.
+func (ser *MediaAliasService) GetFilter(
+	first *int, skip *int, tx db.Tx, keep func(a *models.MediaAlias) bool,
+) ([]*models.MediaAlias, error) {
+	vlist, err := tx.Database().GetFilter(first, skip, ser, tx,
+		func(m db.Model) bool {
+			a, err := ser.AssertType(m)
+			if err != nil {
+				return false
+			}
+			return keep(a)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to MediaAlias: %w", err)
+	}
+	return list, nil
+}
+
+// GetByID retrieves the persisted MediaAlias with the given ID.
+func (ser *MediaAliasService) GetByID(id int, tx db.Tx) (*models.MediaAlias, error) {
+	m, err := tx.Database().GetByID(id, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return a, nil
+}
+
+// GetByMedia retrieves a list of instances of MediaAlias with the given
+// Media ID, that is, the aliases of that Media.
+func (ser *MediaAliasService) GetByMedia(
+	mID int, first *int, skip *int, tx db.Tx,
+) ([]*models.MediaAlias, error) {
+	return ser.GetFilter(first, skip, tx, func(a *models.MediaAlias) bool {
+		return a.MediaID == mID
+	})
+}
+
+// Bucket returns the name of the bucket for MediaAlias.
+func (ser *MediaAliasService) Bucket() string {
+	return "MediaAlias"
+}
+
+// UniqueKey returns the key by which a MediaAlias must be unique, composed of
+// the ID of its Media and the NameKey of its title.
+func (ser *MediaAliasService) UniqueKey(m db.Model) (string, error) {
+	a, err := ser.AssertType(m)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return fmt.Sprintf("%d/%s", a.MediaID, NameKey(a.Title)), nil
+}
+
+// Clean cleans the given MediaAlias for storage.
+func (ser *MediaAliasService) Clean(m db.Model, _ db.Tx) error {
+	a, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	lang, err := models.CanonicalLanguage(a.Language)
+	if err != nil {
+		var verr ValidationError
+		verr.Add("Language", FieldInvalid, err.Error())
+		return &verr
+	}
+	a.Language = lang
+	return nil
+}
+
+// Validate returns an error if the MediaAlias is not valid for the database.
+func (ser *MediaAliasService) Validate(m db.Model, tx db.Tx) error {
+	a, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	var verr ValidationError
+	ValidateTags(a, &verr)
+	if strings.TrimSpace(a.Title) != "" && NameKey(a.Title) == "" {
+		verr.Add("Title", FieldRequired, "must have letters or digits")
+	}
+	if !a.Type.IsValid() {
+		verr.Addf("Type", FieldInvalid, "unknown type %d", a.Type)
+	}
+	err = verr.Err()
+	if err != nil {
+		return err
+	}
+
+	// Check if Media with ID specified in MediaAlias exists
+	_, err = tx.Database().GetRawByID(a.MediaID, ser.MediaService, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get Media with ID %d: %w", a.MediaID, err)
+	}
+
+	return nil
+}
+
+// Initialize sets initial values for some properties.
+func (ser *MediaAliasService) Initialize(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistOldProperties maintains certain properties of the existing
+// MediaAlias in updates. The Media of a MediaAlias does not change.
+func (ser *MediaAliasService) PersistOldProperties(n db.Model, o db.Model, _ db.Tx) error {
+	a, err := ser.AssertType(n)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	old, err := ser.AssertType(o)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	a.MediaID = old.MediaID
+	return nil
+}
+
+// PersistHooks returns the persistence hook functions.
+func (ser *MediaAliasService) PersistHooks() *db.PersistHooks {
+	return &ser.Hooks
+}
+
+// Marshal encodes the given MediaAlias for storage.
+func (ser *MediaAliasService) Marshal(m db.Model) ([]byte, error) {
+	a, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	v, err := db.Codecs.Encode(ser.Bucket(), a)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
+	}
+
+	return v, nil
+}
+
+// Unmarshal decodes the given record into MediaAlias.
+func (ser *MediaAliasService) Unmarshal(buf []byte) (db.Model, error) {
+	var a models.MediaAlias
+	err := db.Codecs.Decode(buf, &a)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
+	}
+	return &a, nil
+}
+
+// AssertType exposes the given db.Model as a MediaAlias.
+func (ser *MediaAliasService) AssertType(m db.Model) (*models.MediaAlias, error) {
+	if m == nil {
+		return nil, fmt.Errorf("model: %w", errNil)
+	}
+
+	a, ok := m.(*models.MediaAlias)
+	if !ok {
+		return nil, fmt.Errorf("model: %w", errors.New("not of MediaAlias type"))
+	}
+	return a, nil
+}
+
+// mapFromModel returns a list of MediaAlias type asserted from the given list
+// of db.Model.
+func (ser *MediaAliasService) mapFromModel(vlist []db.Model) ([]*models.MediaAlias, error) {
+	list := make([]*models.MediaAlias, len(vlist))
+	var err error
+	for i, v := range vlist {
+		list[i], err = ser.AssertType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+	}
+	return list, nil
+}
@@ -3,11 +3,9 @@ package data
 import (
 	"errors"
 	"fmt"
-	"strings"
 
 	"github.com/Dophin2009/nao/pkg/models"
 	"github.com/Dophin2009/nao/pkg/db"
-	json "github.com/json-iterator/go"
 )
 
 // MediaCharacterService performs operations on MediaCharacter.
@@ -112,7 +110,7 @@ func (ser *MediaCharacterService) DeleteByCharacter(cID int, tx db.Tx) error {
 			return false
 		}
 
-		return *mc.CharacterID == cID
+		return mc.CharacterID != nil && *mc.CharacterID == cID
 	})
 }
 
@@ -218,6 +216,16 @@ func (ser *MediaCharacterService) GetByMedia(
 	})
 }
 
+// GetByMediaRole retrieves a list of instances of MediaCharacter with the
+// given Media ID whose Characters have the given role in the Media.
+func (ser *MediaCharacterService) GetByMediaRole(
+	mID int, role string, first *int, skip *int, tx db.Tx,
+) ([]*models.MediaCharacter, error) {
+	return ser.GetFilter(first, skip, tx, func(mc *models.MediaCharacter) bool {
+		return mc.MediaID == mID && mc.CharacterRole != nil && *mc.CharacterRole == role
+	})
+}
+
 // GetByCharacter retrieves a list of instances of MediaCharacter with the
 // given Character ID.
 func (ser *MediaCharacterService) GetByCharacter(
@@ -234,7 +242,7 @@ func (ser *MediaCharacterService) GetByPerson(
 	pID int, first *int, skip *int, tx db.Tx,
 ) ([]*models.MediaCharacter, error) {
 	return ser.GetFilter(first, skip, tx, func(mc *models.MediaCharacter) bool {
-		return *mc.CharacterID == pID
+		return mc.PersonID != nil && *mc.PersonID == pID
 	})
 }
 
@@ -250,11 +258,11 @@ func (ser *MediaCharacterService) Clean(m db.Model, _ db.Tx) error {
 		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
-	if e.CharacterID != nil {
-		*e.CharacterRole = strings.Trim(*e.CharacterRole, " ")
-	}
-	if e.PersonRole != nil {
-		*e.PersonRole = strings.Trim(*e.PersonRole, " ")
+	if e.CharacterRole != nil {
+		role, err := models.ParseCharacterRole(*e.CharacterRole)
+		if err == nil {
+			*e.CharacterRole = role
+		}
 	}
 	return nil
 }
@@ -267,6 +275,48 @@ func (ser *MediaCharacterService) Validate(m db.Model, tx db.Tx) error {
 		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
+	var verr ValidationError
+
+	// Invalid if both Character and Person are not specified
+	if e.CharacterID == nil && e.PersonID == nil {
+		verr.Add("CharacterID", FieldRequired,
+			"either character ID or person ID must be specified")
+		verr.Add("PersonID", FieldRequired,
+			"either character ID or person ID must be specified")
+	}
+
+	// CharacterRole must be present if and only if CharacterID is specified
+	if e.CharacterID != nil {
+		if e.CharacterRole == nil {
+			verr.Add("CharacterRole", FieldRequired,
+				"must not be nil if character ID is specified")
+		} else {
+			_, err = models.ParseCharacterRole(*e.CharacterRole)
+			if err != nil {
+				verr.Add("CharacterRole", FieldInvalid, err.Error())
+			}
+		}
+	} else if e.CharacterRole != nil {
+		verr.Add("CharacterID", FieldRequired,
+			"must not be nil if character role is specified")
+	}
+
+	// PersonRole must be present if and only if PersonID is specified
+	if e.PersonID != nil {
+		if e.PersonRole == nil {
+			verr.Add("PersonRole", FieldRequired,
+				"must not be nil if person ID is specified")
+		}
+	} else if e.PersonRole != nil {
+		verr.Add("PersonID", FieldRequired,
+			"must not be nil if person role is specified")
+	}
+
+	err = verr.Err()
+	if err != nil {
+		return err
+	}
+
 	db := tx.Database()
 
 	// Check if Media with ID specified in MediaCharacter exists
@@ -275,68 +325,44 @@ func (ser *MediaCharacterService) Validate(m db.Model, tx db.Tx) error {
 		return fmt.Errorf("failed to get Media with ID %d: %w", e.MediaID, err)
 	}
 
-	// Invalid if both Character and Person are not specified
-	if e.CharacterID == nil && e.PersonID == nil {
-		nsterr := fmt.Errorf("character ID and person ID: %w", errNil)
-		return fmt.Errorf(
-			"either character ID or person ID must be specified: %w", nsterr)
-	}
-
 	// Check if Character with ID specified in new MediaCharacter exists
-	// CharacterID might be not specified
 	if e.CharacterID != nil {
-		// CharacterRole must be present if CharacterID is specified
-		if e.CharacterRole == nil {
-			nsterr := fmt.Errorf("character role: %w", errNil)
-			return fmt.Errorf(
-				"character role must not be nil if character ID is specified: %w",
-				nsterr,
-			)
-		}
-
 		cID := *e.CharacterID
 		_, err = db.GetRawByID(cID, ser.CharacterService, tx)
 		if err != nil {
 			return fmt.Errorf("failed to get Character with ID %d: %w", cID, err)
 		}
-	} else {
-		// CharacterRole must not be specified if CharacterID is not
-		if e.CharacterRole != nil {
-			nsterr := fmt.Errorf("character ID: %w", errNil)
-			return fmt.Errorf(
-				"character role must be nil if character ID is not specified: %w",
-				nsterr,
-			)
-		}
 	}
 
 	// Check if Person with ID specified in new MediaCharacter exists
-	// PersonID may be not specified
 	if e.PersonID != nil {
-		// PersonRole must be present if PersonID is specified
-		if e.PersonRole == nil {
-			nsterr := fmt.Errorf("person role: %w", errNil)
-			return fmt.Errorf(
-				"person role must not be nil if person ID is specified: %w", nsterr)
-		}
-
 		pID := *e.PersonID
 		_, err = db.GetRawByID(pID, ser.PersonService, tx)
 		if err != nil {
 			return fmt.Errorf("failed to get Person with ID %d: %w", pID, err)
 		}
-	} else {
-		// PersonRole must not be specified if PersonID is not
-		if e.PersonRole != nil {
-			nsterr := fmt.Errorf("person ID: %w", errNil)
-			return fmt.Errorf(
-				"person role must be nil if person ID is not specified: %w", nsterr)
-		}
 	}
 
 	return nil
 }
 
+// UniqueKey returns the key by which a MediaCharacter must be unique, composed
+// of the IDs of its Media, Character and Person.
+func (ser *MediaCharacterService) UniqueKey(m db.Model) (string, error) {
+	e, err := ser.AssertType(m)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	key := fmt.Sprintf("%d", e.MediaID)
+	if e.CharacterID != nil {
+		key += fmt.Sprintf("/c%d", *e.CharacterID)
+	}
+	if e.PersonID != nil {
+		key += fmt.Sprintf("/p%d", *e.PersonID)
+	}
+	return key, nil
+}
+
 // Initialize sets initial values for some properties.
 func (ser *MediaCharacterService) Initialize(_ db.Model, _ db.Tx) error {
 	return nil
@@ -353,27 +379,27 @@ func (ser *MediaCharacterService) PersistHooks() *db.PersistHooks {
 	return &ser.Hooks
 }
 
-// Marshal transforms the given MediaCharacter into JSON.
+// Marshal encodes the given MediaCharacter for storage.
 func (ser *MediaCharacterService) Marshal(m db.Model) ([]byte, error) {
 	mc, err := ser.AssertType(m)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
-	v, err := json.Marshal(mc)
+	v, err := db.Codecs.Encode(ser.Bucket(), mc)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONMarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
 	}
 
 	return v, nil
 }
 
-// Unmarshal parses the given JSON into MediaCharacter.
+// Unmarshal decodes the given record into MediaCharacter.
 func (ser *MediaCharacterService) Unmarshal(buf []byte) (db.Model, error) {
 	var mc models.MediaCharacter
-	err := json.Unmarshal(buf, &mc)
+	err := db.Codecs.Decode(buf, &mc)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONUnmarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
 	}
 	return &mc, nil
 }
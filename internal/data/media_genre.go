@@ -6,7 +6,6 @@ import (
 
 	"github.com/Dophin2009/nao/pkg/models"
 	"github.com/Dophin2009/nao/pkg/db"
-	json "github.com/json-iterator/go"
 )
 
 // MediaGenreService performs operations on MediaGenre.
@@ -70,6 +69,60 @@ func (ser *MediaGenreService) Delete(id int, tx db.Tx) error {
 	return tx.Database().Delete(id, ser, tx)
 }
 
+// SetByMedia reconciles the MediaGenres of the Media with the given ID with
+// the given Genre IDs, creating those missing and deleting those of Genres
+// absent from the list, and returns the resulting MediaGenres.
+func (ser *MediaGenreService) SetByMedia(
+	mID int, gIDs []int, tx db.Tx,
+) ([]*models.MediaGenre, error) {
+	_, err := tx.Database().GetRawByID(mID, ser.MediaService, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Media with ID %d: %w", mID, err)
+	}
+
+	existing, err := ser.GetByMedia(mID, nil, nil, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get MediaGenres by Media ID %d: %w", mID, err)
+	}
+
+	want := make(map[int]bool, len(gIDs))
+	for _, gID := range gIDs {
+		want[gID] = true
+	}
+
+	// Delete relations to absent Genres, keeping the rest
+	list := []*models.MediaGenre{}
+	for _, mg := range existing {
+		if !want[mg.GenreID] {
+			err = ser.Delete(mg.Meta.ID, tx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to delete MediaGenre with ID %d: %w",
+					mg.Meta.ID, err)
+			}
+			continue
+		}
+		delete(want, mg.GenreID)
+		list = append(list, mg)
+	}
+
+	// Create the missing relations in the given order
+	for _, gID := range gIDs {
+		if !want[gID] {
+			continue
+		}
+		delete(want, gID)
+
+		mg := &models.MediaGenre{MediaID: mID, GenreID: gID}
+		_, err = ser.Create(mg, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create MediaGenre of Genre with ID %d: %w",
+				gID, err)
+		}
+		list = append(list, mg)
+	}
+	return list, nil
+}
+
 // DeleteByMedia deletes the MediaGenres with the given Media ID.
 func (ser *MediaGenreService) DeleteByMedia(mID int, tx db.Tx) error {
 	return tx.Database().DeleteFilter(ser, tx, func(m db.Model) bool {
@@ -223,6 +276,16 @@ func (ser *MediaGenreService) Validate(m db.Model, tx db.Tx) error {
 	return nil
 }
 
+// UniqueKey returns the key by which a MediaGenre must be unique, composed of
+// the IDs of its Media and Genre.
+func (ser *MediaGenreService) UniqueKey(m db.Model) (string, error) {
+	e, err := ser.AssertType(m)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return fmt.Sprintf("%d/%d", e.MediaID, e.GenreID), nil
+}
+
 // Initialize sets initial values for some properties.
 func (ser *MediaGenreService) Initialize(_ db.Model, _ db.Tx) error {
 	return nil
@@ -239,27 +302,27 @@ func (ser *MediaGenreService) PersistHooks() *db.PersistHooks {
 	return &ser.Hooks
 }
 
-// Marshal transforms the given MediaGenre into JSON.
+// Marshal encodes the given MediaGenre for storage.
 func (ser *MediaGenreService) Marshal(m db.Model) ([]byte, error) {
 	mg, err := ser.AssertType(m)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
-	v, err := json.Marshal(mg)
+	v, err := db.Codecs.Encode(ser.Bucket(), mg)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONMarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
 	}
 
 	return v, nil
 }
 
-// Unmarshal parses the given JSON into MediaGenre.
+// Unmarshal decodes the given record into MediaGenre.
 func (ser *MediaGenreService) Unmarshal(buf []byte) (db.Model, error) {
 	var mg models.MediaGenre
-	err := json.Unmarshal(buf, &mg)
+	err := db.Codecs.Decode(buf, &mg)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONUnmarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
 	}
 	return &mg, nil
 }
@@ -3,11 +3,9 @@ package data
 import (
 	"errors"
 	"fmt"
-	"strings"
 
 	"github.com/Dophin2009/nao/pkg/models"
 	"github.com/Dophin2009/nao/pkg/db"
-	json "github.com/json-iterator/go"
 )
 
 // MediaProducerService performs operations on MediaProducer.
@@ -202,11 +200,10 @@ func (ser *MediaProducerService) Bucket() string {
 
 // Clean cleans the given MediaProducer for storage.
 func (ser *MediaProducerService) Clean(m db.Model, _ db.Tx) error {
-	e, err := ser.AssertType(m)
+	_, err := ser.AssertType(m)
 	if err != nil {
 		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
-	e.Role = strings.Trim(e.Role, " ")
 	return nil
 }
 
@@ -235,6 +232,16 @@ func (ser *MediaProducerService) Validate(m db.Model, tx db.Tx) error {
 	return nil
 }
 
+// UniqueKey returns the key by which a MediaProducer must be unique, composed
+// of the IDs of its Media and Producer and its role.
+func (ser *MediaProducerService) UniqueKey(m db.Model) (string, error) {
+	e, err := ser.AssertType(m)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return fmt.Sprintf("%d/%d/%s", e.MediaID, e.ProducerID, e.Role), nil
+}
+
 // Initialize sets initial values for some properties.
 func (ser *MediaProducerService) Initialize(_ db.Model, _ db.Tx) error {
 	return nil
@@ -251,27 +258,27 @@ func (ser *MediaProducerService) PersistHooks() *db.PersistHooks {
 	return &ser.Hooks
 }
 
-// Marshal transforms the given MediaProducer into JSON.
+// Marshal encodes the given MediaProducer for storage.
 func (ser *MediaProducerService) Marshal(m db.Model) ([]byte, error) {
 	mp, err := ser.AssertType(m)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
-	v, err := json.Marshal(mp)
+	v, err := db.Codecs.Encode(ser.Bucket(), mp)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONMarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
 	}
 
 	return v, nil
 }
 
-// Unmarshal parses the given JSON into MediaProducer.
+// Unmarshal decodes the given record into MediaProducer.
 func (ser *MediaProducerService) Unmarshal(buf []byte) (db.Model, error) {
 	var mp models.MediaProducer
-	err := json.Unmarshal(buf, &mp)
+	err := db.Codecs.Decode(buf, &mp)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONUnmarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
 	}
 	return &mp, nil
 }
@@ -3,17 +3,18 @@ package data
 import (
 	"errors"
 	"fmt"
-	"strings"
 
 	"github.com/Dophin2009/nao/pkg/models"
 	"github.com/Dophin2009/nao/pkg/db"
-	json "github.com/json-iterator/go"
 )
 
 // MediaRelationService performs operations on MediaRelation.
 type MediaRelationService struct {
 	MediaService *MediaService
-	Hooks        db.PersistHooks
+	// Inverses maps relationships to those of the inverses created with them,
+	// overriding MediaRelationship.Inverse.
+	Inverses map[models.MediaRelationship]models.MediaRelationship
+	Hooks    db.PersistHooks
 }
 
 // NewMediaRelationService returns a MediaRelationService.
@@ -44,19 +45,111 @@ func NewMediaRelationService(hooks db.PersistHooks, mediaService *MediaService)
 	return mediaRelationService
 }
 
-// Create persists the given MediaRelation.
+// Create persists the given MediaRelation, along with its inverse from the
+// related Media to the owning Media if there is none, such as a Prequel for a
+// Sequel.
 func (ser *MediaRelationService) Create(mr *models.MediaRelation, tx db.Tx) (int, error) {
-	return tx.Database().Create(mr, ser, tx)
+	id, err := tx.Database().Create(mr, ser, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	err = ser.EnsureInverse(mr, tx)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
 }
 
-// Update rmrlaces the value of the MediaRelation with the given ID.
+// Update replaces the value of the MediaRelation with the given ID, and
+// replaces its inverse along with it.
 func (ser *MediaRelationService) Update(mr *models.MediaRelation, tx db.Tx) error {
-	return tx.Database().Update(mr, ser, tx)
+	old, err := ser.GetByID(mr.Meta.ID, tx)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Database().Update(mr, ser, tx)
+	if err != nil {
+		return err
+	}
+
+	if old.OwnerID != mr.OwnerID || old.RelatedID != mr.RelatedID ||
+		old.Relationship != mr.Relationship {
+		err = ser.deleteInverse(old, tx)
+		if err != nil {
+			return err
+		}
+	}
+	return ser.EnsureInverse(mr, tx)
 }
 
-// Delete deletes the MediaRelation with the given ID.
+// Delete deletes the MediaRelation with the given ID, along with its inverse.
 func (ser *MediaRelationService) Delete(id int, tx db.Tx) error {
-	return tx.Database().Delete(id, ser, tx)
+	mr, err := ser.GetByID(id, tx)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Database().Delete(id, ser, tx)
+	if err != nil {
+		return err
+	}
+	return ser.deleteInverse(mr, tx)
+}
+
+// EnsureInverse persists the inverse of the given MediaRelation from the
+// related Media to the owning Media, if there is none.
+func (ser *MediaRelationService) EnsureInverse(mr *models.MediaRelation, tx db.Tx) error {
+	inv := ser.Inverse(mr.Relationship)
+	m, err := tx.Database().FindFirst(ser, tx, func(m db.Model) (bool, error) {
+		e, err := ser.AssertType(m)
+		if err != nil {
+			return false, err
+		}
+		return e.OwnerID == mr.RelatedID && e.RelatedID == mr.OwnerID &&
+			e.Relationship == inv, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to iterate through keys: %w", err)
+	}
+	if m != nil {
+		return nil
+	}
+
+	_, err = tx.Database().Create(&models.MediaRelation{
+		OwnerID:      mr.RelatedID,
+		RelatedID:    mr.OwnerID,
+		Relationship: inv,
+	}, ser, tx)
+	if err != nil {
+		return fmt.Errorf("failed to create inverse of MediaRelation with ID %d: %w",
+			mr.Meta.ID, err)
+	}
+	return nil
+}
+
+// Inverse returns the relationship of the inverse of MediaRelations of the
+// given relationship.
+func (ser *MediaRelationService) Inverse(r models.MediaRelationship) models.MediaRelationship {
+	inv, ok := ser.Inverses[r]
+	if ok {
+		return inv
+	}
+	return r.Inverse()
+}
+
+// deleteInverse deletes the inverses of the given MediaRelation.
+func (ser *MediaRelationService) deleteInverse(mr *models.MediaRelation, tx db.Tx) error {
+	inv := ser.Inverse(mr.Relationship)
+	return tx.Database().DeleteFilter(ser, tx, func(m db.Model) bool {
+		e, err := ser.AssertType(m)
+		if err != nil {
+			return false
+		}
+		return e.Meta.ID != mr.Meta.ID && e.OwnerID == mr.RelatedID &&
+			e.RelatedID == mr.OwnerID && e.Relationship == inv
+	})
 }
 
 // DeleteByOwner deletes the MediaRelation with the given Owner ID.
@@ -179,13 +272,18 @@ func (ser *MediaRelationService) GetByRelated(
 // GetByRelationship retrieves a list of instances of Media Relation with the
 // given relationship.
 func (ser *MediaRelationService) GetByRelationship(
-	relationship string, first *int, skip *int, tx db.Tx,
+	relationship models.MediaRelationship, first *int, skip *int, tx db.Tx,
 ) ([]*models.MediaRelation, error) {
 	return ser.GetFilter(first, skip, tx, func(mr *models.MediaRelation) bool {
 		return mr.Relationship == relationship
 	})
 }
 
+// Count returns the number of persisted MediaRelations.
+func (ser *MediaRelationService) Count(tx db.Tx) (int, error) {
+	return tx.Database().Count(ser, tx, nil)
+}
+
 // Bucket returns the name of the bucket for MediaRelation.
 func (ser *MediaRelationService) Bucket() string {
 	return "MediaRelation"
@@ -198,7 +296,10 @@ func (ser *MediaRelationService) Clean(m db.Model, _ db.Tx) error {
 		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
-	e.Relationship = strings.Trim(e.Relationship, " ")
+	rel, err := models.ParseMediaRelationship(string(e.Relationship))
+	if err == nil {
+		e.Relationship = rel
+	}
 	return nil
 }
 
@@ -210,6 +311,13 @@ func (ser *MediaRelationService) Validate(m db.Model, tx db.Tx) error {
 		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
+	_, err = models.ParseMediaRelationship(string(e.Relationship))
+	if err != nil {
+		var verr ValidationError
+		verr.Add("Relationship", FieldInvalid, err.Error())
+		return &verr
+	}
+
 	db := tx.Database()
 
 	// Check if owning Media with ID specified in new MediaRelation exists
@@ -243,27 +351,27 @@ func (ser *MediaRelationService) PersistHooks() *db.PersistHooks {
 	return &ser.Hooks
 }
 
-// Marshal transforms the given MediaRelation into JSON.
+// Marshal encodes the given MediaRelation for storage.
 func (ser *MediaRelationService) Marshal(m db.Model) ([]byte, error) {
 	mr, err := ser.AssertType(m)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
-	v, err := json.Marshal(mr)
+	v, err := db.Codecs.Encode(ser.Bucket(), mr)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONMarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
 	}
 
 	return v, nil
 }
 
-// Unmarshal parses the given JSON into MediaRelation.
+// Unmarshal decodes the given record into MediaRelation.
 func (ser *MediaRelationService) Unmarshal(buf []byte) (db.Model, error) {
 	var mr models.MediaRelation
-	err := json.Unmarshal(buf, &mr)
+	err := db.Codecs.Decode(buf, &mr)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONUnmarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
 	}
 	return &mr, nil
 }
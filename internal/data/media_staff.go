@@ -0,0 +1,292 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// MediaStaffService performs operations on MediaStaff.
+type MediaStaffService struct {
+	MediaService  *MediaService
+	PersonService *PersonService
+	Hooks         db.PersistHooks
+}
+
+// NewMediaStaffService returns a MediaStaffService.
+func NewMediaStaffService(hooks db.PersistHooks, mediaService *MediaService,
+	personService *PersonService) *MediaStaffService {
+	// Initialize MediaStaffService
+	mediaStaffService := &MediaStaffService{
+		MediaService:  mediaService,
+		PersonService: personService,
+		Hooks:         hooks,
+	}
+
+	// Add hook to delete MediaStaff on Media deletion
+	deleteMediaStaffOnDeleteMedia := func(md db.Model, _ db.Service, tx db.Tx) error {
+		mID := md.Metadata().ID
+		err := mediaStaffService.DeleteByMedia(mID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to delete MediaStaff by Media ID %d: %w",
+				mID, err)
+		}
+		return nil
+	}
+	mdSerHooks := mediaService.PersistHooks()
+	mdSerHooks.PreDeleteHooks =
+		append(mdSerHooks.PreDeleteHooks, deleteMediaStaffOnDeleteMedia)
+
+	// Add hook to delete MediaStaff on Person deletion
+	deleteMediaStaffOnDeletePerson := func(p db.Model, _ db.Service, tx db.Tx) error {
+		pID := p.Metadata().ID
+		err := mediaStaffService.DeleteByPerson(pID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to delete MediaStaff by Person ID %d: %w",
+				pID, err)
+		}
+		return nil
+	}
+	pSerHooks := personService.PersistHooks()
+	pSerHooks.PreDeleteHooks =
+		append(pSerHooks.PreDeleteHooks, deleteMediaStaffOnDeletePerson)
+
+	return mediaStaffService
+}
+
+// Create persists the given MediaStaff.
+func (ser *MediaStaffService) Create(ms *models.MediaStaff, tx db.Tx) (int, error) {
+	return tx.Database().Create(ms, ser, tx)
+}
+
+// Update replaces the value of the MediaStaff with the given ID.
+func (ser *MediaStaffService) Update(ms *models.MediaStaff, tx db.Tx) error {
+	return tx.Database().Update(ms, ser, tx)
+}
+
+// Delete deletes the MediaStaff with the given ID.
+func (ser *MediaStaffService) Delete(id int, tx db.Tx) error {
+	return tx.Database().Delete(id, ser, tx)
+}
+
+// DeleteByMedia deletes the MediaStaff with the given Media ID.
+func (ser *MediaStaffService) DeleteByMedia(mID int, tx db.Tx) error {
+	return tx.Database().DeleteFilter(ser, tx, func(m db.Model) bool {
+		ms, err := ser.AssertType(m)
+		if err != nil {
+			return false
+		}
+
+		return ms.MediaID == mID
+	})
+}
+
+// DeleteByPerson deletes the MediaStaff with the given Person ID.
+func (ser *MediaStaffService) DeleteByPerson(pID int, tx db.Tx) error {
+	return tx.Database().DeleteFilter(ser, tx, func(m db.Model) bool {
+		ms, err := ser.AssertType(m)
+		if err != nil {
+			return false
+		}
+
+		return ms.PersonID == pID
+	})
+}
+
+// GetAll retrieves all persisted values of MediaStaff.
+func (ser *MediaStaffService) GetAll(
+	first *int, skip *int, tx db.Tx,
+) ([]*models.MediaStaff, error) {
+	vlist, err := tx.Database().GetAll(first, skip, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to MediaStaff: %w", err)
+	}
+	return list, nil
+}
+
+// GetFilter retrieves all persisted values of MediaStaff that pass the
+// filter.
+func (ser *MediaStaffService) GetFilter(
+	first *int, skip *int, tx db.Tx, keep func(ms *models.MediaStaff) bool,
+) ([]*models.MediaStaff, error) {
+	vlist, err := tx.Database().GetFilter(first, skip, ser, tx,
+		func(m db.Model) bool {
+			ms, err := ser.AssertType(m)
+			if err != nil {
+				return false
+			}
+			return keep(ms)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to MediaStaff: %w", err)
+	}
+	return list, nil
+}
+
+// GetByID retrieves the persisted MediaStaff with the given ID.
+func (ser *MediaStaffService) GetByID(id int, tx db.Tx) (*models.MediaStaff, error) {
+	m, err := tx.Database().GetByID(id, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	ms, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return ms, nil
+}
+
+// GetByMedia retrieves a list of instances of MediaStaff with the given
+// Media ID, that is, the staff credited on that Media.
+func (ser *MediaStaffService) GetByMedia(
+	mID int, first *int, skip *int, tx db.Tx,
+) ([]*models.MediaStaff, error) {
+	return ser.GetFilter(first, skip, tx, func(ms *models.MediaStaff) bool {
+		return ms.MediaID == mID
+	})
+}
+
+// GetByPerson retrieves a list of instances of MediaStaff with the given
+// Person ID, that is, the credits of that Person.
+func (ser *MediaStaffService) GetByPerson(
+	pID int, first *int, skip *int, tx db.Tx,
+) ([]*models.MediaStaff, error) {
+	return ser.GetFilter(first, skip, tx, func(ms *models.MediaStaff) bool {
+		return ms.PersonID == pID
+	})
+}
+
+// Bucket returns the name of the bucket for MediaStaff.
+func (ser *MediaStaffService) Bucket() string {
+	return "MediaStaff"
+}
+
+// Clean cleans the given MediaStaff for storage.
+func (ser *MediaStaffService) Clean(m db.Model, _ db.Tx) error {
+	_, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return nil
+}
+
+// Validate returns an error if the MediaStaff is not valid for the
+// database.
+func (ser *MediaStaffService) Validate(m db.Model, tx db.Tx) error {
+	e, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	var verr ValidationError
+	ValidateTags(e, &verr)
+	if e.FirstEpisode != nil && *e.FirstEpisode < 1 {
+		verr.Add("FirstEpisode", FieldOutOfRange, "must be positive")
+	}
+	if e.LastEpisode != nil && *e.LastEpisode < 1 {
+		verr.Add("LastEpisode", FieldOutOfRange, "must be positive")
+	} else if e.FirstEpisode != nil && e.LastEpisode != nil && *e.LastEpisode < *e.FirstEpisode {
+		verr.Add("LastEpisode", FieldOutOfRange, "before first episode")
+	}
+	err = verr.Err()
+	if err != nil {
+		return err
+	}
+
+	db := tx.Database()
+
+	// Check if Media with ID specified in new MediaStaff exists
+	_, err = db.GetRawByID(e.MediaID, ser.MediaService, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get Media with ID %d: %w", e.MediaID, err)
+	}
+
+	// Check if Person with ID specified in new MediaStaff exists
+	_, err = db.GetRawByID(e.PersonID, ser.PersonService, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get Person with ID %d: %w", e.PersonID, err)
+	}
+
+	return nil
+}
+
+// Initialize sets initial values for some properties.
+func (ser *MediaStaffService) Initialize(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistOldProperties maintains certain properties of the existing
+// MediaStaff in updates.
+func (ser *MediaStaffService) PersistOldProperties(_ db.Model, _ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistHooks returns the persistence hook functions.
+func (ser *MediaStaffService) PersistHooks() *db.PersistHooks {
+	return &ser.Hooks
+}
+
+// Marshal encodes the given MediaStaff for storage.
+func (ser *MediaStaffService) Marshal(m db.Model) ([]byte, error) {
+	ms, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	v, err := db.Codecs.Encode(ser.Bucket(), ms)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
+	}
+
+	return v, nil
+}
+
+// Unmarshal decodes the given record into MediaStaff.
+func (ser *MediaStaffService) Unmarshal(buf []byte) (db.Model, error) {
+	var ms models.MediaStaff
+	err := db.Codecs.Decode(buf, &ms)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
+	}
+	return &ms, nil
+}
+
+// AssertType exposes the given db.Model as a MediaStaff.
+func (ser *MediaStaffService) AssertType(m db.Model) (*models.MediaStaff, error) {
+	if m == nil {
+		return nil, fmt.Errorf("model: %w", errNil)
+	}
+
+	ms, ok := m.(*models.MediaStaff)
+	if !ok {
+		return nil, fmt.Errorf("model: %w", errors.New("not of MediaStaff type"))
+	}
+	return ms, nil
+}
+
+// mapFromModel returns a list of MediaStaff type asserted from the given
+// list of db.Model.
+func (ser *MediaStaffService) mapFromModel(vlist []db.Model) ([]*models.MediaStaff, error) {
+	list := make([]*models.MediaStaff, len(vlist))
+	var err error
+	for i, v := range vlist {
+		list[i], err = ser.AssertType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,407 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// ModerationService performs operations on Report, the queue of content
+// reported to the moderators.
+type ModerationService struct {
+	UserService    *UserService
+	MediaService   *MediaService
+	ReviewService  *ReviewService
+	CommentService *CommentService
+	Hooks          db.PersistHooks
+}
+
+// NewModerationService returns a ModerationService.
+func NewModerationService(hooks db.PersistHooks, userService *UserService,
+	mediaService *MediaService, reviewService *ReviewService,
+	commentService *CommentService) *ModerationService {
+	// Initialize ModerationService
+	moderationService := &ModerationService{
+		UserService:    userService,
+		MediaService:   mediaService,
+		ReviewService:  reviewService,
+		CommentService: commentService,
+		Hooks:          hooks,
+	}
+
+	// Add hook to delete Report on User deletion
+	deleteReportOnDeleteUser := func(um db.Model, _ db.Service, tx db.Tx) error {
+		uID := um.Metadata().ID
+		err := moderationService.deleteFilter(tx, func(r *models.Report) bool {
+			return r.ReporterID == uID
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete Report by User ID %d: %w", uID, err)
+		}
+		return nil
+	}
+	uSerHooks := userService.PersistHooks()
+	uSerHooks.PreDeleteHooks =
+		append(uSerHooks.PreDeleteHooks, deleteReportOnDeleteUser)
+
+	// Add hooks to delete Report on deletion of the reported content
+	for target, ser := range moderationService.targetServices() {
+		target := target
+		deleteReportOnDeleteTarget := func(m db.Model, _ db.Service, tx db.Tx) error {
+			id := m.Metadata().ID
+			err := moderationService.DeleteByTarget(target, id, tx)
+			if err != nil {
+				return fmt.Errorf("failed to delete Report by %s ID %d: %w", target, id, err)
+			}
+			return nil
+		}
+		hooks := ser.PersistHooks()
+		hooks.PreDeleteHooks = append(hooks.PreDeleteHooks, deleteReportOnDeleteTarget)
+	}
+
+	return moderationService
+}
+
+// Create persists the given Report.
+func (ser *ModerationService) Create(r *models.Report, tx db.Tx) (int, error) {
+	return tx.Database().Create(r, ser, tx)
+}
+
+// Update replaces the value of the Report with the given ID.
+func (ser *ModerationService) Update(r *models.Report, tx db.Tx) error {
+	return tx.Database().Update(r, ser, tx)
+}
+
+// Delete deletes the Report with the given ID.
+func (ser *ModerationService) Delete(id int, tx db.Tx) error {
+	return tx.Database().Delete(id, ser, tx)
+}
+
+// DeleteByTarget deletes the Reports of the given content.
+func (ser *ModerationService) DeleteByTarget(
+	target models.ReportTarget, targetID int, tx db.Tx,
+) error {
+	return ser.deleteFilter(tx, func(r *models.Report) bool {
+		return r.Target == target && r.TargetID == targetID
+	})
+}
+
+func (ser *ModerationService) deleteFilter(tx db.Tx, keep func(r *models.Report) bool) error {
+	return tx.Database().DeleteFilter(ser, tx, func(m db.Model) bool {
+		r, err := ser.AssertType(m)
+		if err != nil {
+			return false
+		}
+		return keep(r)
+	})
+}
+
+// GetFilter retrieves all persisted values of Report that pass the filter.
+func (ser *ModerationService) GetFilter(
+	first *int, skip *int, tx db.Tx, keep func(r *models.Report) bool,
+) ([]*models.Report, error) {
+	vlist, err := tx.Database().GetFilter(first, skip, ser, tx,
+		func(m db.Model) bool {
+			r, err := ser.AssertType(m)
+			if err != nil {
+				return false
+			}
+			return keep(r)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to Reports: %w", err)
+	}
+	return list, nil
+}
+
+// GetByID retrieves the persisted Report with the given ID.
+func (ser *ModerationService) GetByID(id int, tx db.Tx) (*models.Report, error) {
+	m, err := tx.Database().GetByID(id, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return r, nil
+}
+
+// GetByStatus retrieves a list of instances of Report with the given status,
+// or of all Reports if the status is nil.
+func (ser *ModerationService) GetByStatus(
+	status *models.ReportStatus, first *int, skip *int, tx db.Tx,
+) ([]*models.Report, error) {
+	return ser.GetFilter(first, skip, tx, func(r *models.Report) bool {
+		return status == nil || r.Status == *status
+	})
+}
+
+// ReportAs persists the given Report on behalf of the caller, who must be
+// authenticated and able to see the reported content. Reported Reviews and
+// Comments are flagged for moderation.
+func (ser *ModerationService) ReportAs(caller *models.User, r *models.Report, tx db.Tx) (int, error) {
+	if caller == nil {
+		return 0, fmt.Errorf("no credentials given: %w", ErrUnauthorized)
+	}
+
+	r.ReporterID = caller.Meta.ID
+	r.Status = models.ReportStatusOpen
+	r.ResolverID = nil
+	id, err := ser.Create(r, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	switch r.Target {
+	case models.ReportTargetReview:
+		err = ser.ReviewService.FlagAs(caller, r.TargetID, tx)
+	case models.ReportTargetComment:
+		err = ser.CommentService.FlagAs(caller, r.TargetID, tx)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to flag %s with ID %d: %w", r.Target, r.TargetID, err)
+	}
+	return id, nil
+}
+
+// ResolveAs resolves the Report with the given ID on behalf of the caller,
+// who must be a Moderator, along with the other open Reports of the same
+// content. If hide is true, the reported content is hidden and the status
+// must be ReportStatusActioned; Media entries may not be hidden. The flag of
+// reported Reviews and Comments is cleared.
+func (ser *ModerationService) ResolveAs(
+	caller *models.User, id int, status models.ReportStatus, hide bool, tx db.Tx,
+) (*models.Report, error) {
+	err := authorizeModerator(caller)
+	if err != nil {
+		return nil, err
+	}
+	if status == models.ReportStatusOpen || !status.IsValid() {
+		return nil, fmt.Errorf("status %s: not a resolution: %w", status, ErrInvalid)
+	}
+	if hide && status != models.ReportStatusActioned {
+		return nil, fmt.Errorf("status %s: hiding content is an action: %w", status, ErrInvalid)
+	}
+
+	r, err := ser.GetByID(id, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Clear the flag, and hide the content if asked
+	switch r.Target {
+	case models.ReportTargetReview:
+		rv, err := ser.ReviewService.GetByID(r.TargetID, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Review by ID %d: %w", r.TargetID, err)
+		}
+		_, err = ser.ReviewService.SetHiddenAs(caller, rv.Meta.ID, hide || rv.Hidden, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to moderate Review with ID %d: %w", rv.Meta.ID, err)
+		}
+	case models.ReportTargetComment:
+		c, err := ser.CommentService.GetByID(r.TargetID, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Comment by ID %d: %w", r.TargetID, err)
+		}
+		_, err = ser.CommentService.SetHiddenAs(caller, c.Meta.ID, hide || c.Hidden, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to moderate Comment with ID %d: %w", c.Meta.ID, err)
+		}
+	case models.ReportTargetMedia:
+		if hide {
+			return nil, fmt.Errorf("Media with ID %d: may not be hidden: %w",
+				r.TargetID, ErrInvalid)
+		}
+	}
+
+	open, err := ser.GetFilter(nil, nil, tx, func(o *models.Report) bool {
+		return o.Meta.ID == r.Meta.ID || (o.Status == models.ReportStatusOpen &&
+			o.Target == r.Target && o.TargetID == r.TargetID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get open Reports of %s with ID %d: %w",
+			r.Target, r.TargetID, err)
+	}
+	resolverID := caller.Meta.ID
+	for _, o := range open {
+		o.Status = status
+		o.ResolverID = &resolverID
+		err = ser.Update(o, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update Report with ID %d: %w", o.Meta.ID, err)
+		}
+		if o.Meta.ID == r.Meta.ID {
+			r = o
+		}
+	}
+	return r, nil
+}
+
+// targetServices returns the services of the content that may be reported.
+func (ser *ModerationService) targetServices() map[models.ReportTarget]db.Service {
+	return map[models.ReportTarget]db.Service{
+		models.ReportTargetReview:  ser.ReviewService,
+		models.ReportTargetComment: ser.CommentService,
+		models.ReportTargetMedia:   ser.MediaService,
+	}
+}
+
+// Bucket returns the name of the bucket for Report.
+func (ser *ModerationService) Bucket() string {
+	return "Report"
+}
+
+// Clean cleans the given Report for storage.
+func (ser *ModerationService) Clean(m db.Model, _ db.Tx) error {
+	_, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return nil
+}
+
+// Validate returns an error if the Report is not valid for the database.
+func (ser *ModerationService) Validate(m db.Model, tx db.Tx) error {
+	e, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	var verr ValidationError
+	ValidateTags(e, &verr)
+	if !e.Target.IsValid() {
+		verr.Addf("Target", FieldInvalid, "unknown target %s", e.Target)
+	}
+	if !e.Status.IsValid() {
+		verr.Addf("Status", FieldInvalid, "unknown status %s", e.Status)
+	}
+	err = verr.Err()
+	if err != nil {
+		return err
+	}
+
+	db := tx.Database()
+
+	// Check if User with ID specified in Report exists
+	_, err = db.GetRawByID(e.ReporterID, ser.UserService, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get User with ID %d: %w", e.ReporterID, err)
+	}
+
+	// Check if the reported content exists
+	_, err = db.GetRawByID(e.TargetID, ser.targetServices()[e.Target], tx)
+	if err != nil {
+		return fmt.Errorf("failed to get %s with ID %d: %w", e.Target, e.TargetID, err)
+	}
+
+	// Check that the User has no other open Report of the content
+	if e.Status == models.ReportStatusOpen {
+		same, err := ser.GetFilter(nil, nil, tx, func(o *models.Report) bool {
+			return o.Meta.ID != e.Meta.ID && o.Status == models.ReportStatusOpen &&
+				o.ReporterID == e.ReporterID && o.Target == e.Target &&
+				o.TargetID == e.TargetID
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get open Reports of %s with ID %d: %w",
+				e.Target, e.TargetID, err)
+		}
+		if len(same) > 0 {
+			return fmt.Errorf("%s with ID %d: already reported by User with ID %d: %w",
+				e.Target, e.TargetID, e.ReporterID, ErrConflict)
+		}
+	}
+
+	return nil
+}
+
+// Initialize sets initial values for some properties.
+func (ser *ModerationService) Initialize(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistOldProperties maintains certain properties of the existing Report in
+// updates.
+func (ser *ModerationService) PersistOldProperties(n db.Model, o db.Model, _ db.Tx) error {
+	nr, err := ser.AssertType(n)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	or, err := ser.AssertType(o)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	// Only the resolution of a Report may change
+	nr.ReporterID = or.ReporterID
+	nr.Target = or.Target
+	nr.TargetID = or.TargetID
+	nr.Reason = or.Reason
+	return nil
+}
+
+// PersistHooks returns the persistence hook functions.
+func (ser *ModerationService) PersistHooks() *db.PersistHooks {
+	return &ser.Hooks
+}
+
+// Marshal encodes the given Report for storage.
+func (ser *ModerationService) Marshal(m db.Model) ([]byte, error) {
+	r, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	v, err := db.Codecs.Encode(ser.Bucket(), r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
+	}
+
+	return v, nil
+}
+
+// Unmarshal decodes the given record into Report.
+func (ser *ModerationService) Unmarshal(buf []byte) (db.Model, error) {
+	var r models.Report
+	err := db.Codecs.Decode(buf, &r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
+	}
+	return &r, nil
+}
+
+// AssertType exposes the given db.Model as a Report.
+func (ser *ModerationService) AssertType(m db.Model) (*models.Report, error) {
+	if m == nil {
+		return nil, fmt.Errorf("model: %w", errNil)
+	}
+
+	r, ok := m.(*models.Report)
+	if !ok {
+		return nil, fmt.Errorf("model: %w", errors.New("not of Report type"))
+	}
+	return r, nil
+}
+
+// mapFromModel returns a list of Report type asserted from the given list of
+// db.Model.
+func (ser *ModerationService) mapFromModel(vlist []db.Model) ([]*models.Report, error) {
+	list := make([]*models.Report, len(vlist))
+	var err error
+	for i, v := range vlist {
+		list[i], err = ser.AssertType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,446 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// NameService performs operations on Name, the index of Media, People and
+// Characters by the keys of their titles and names, those of Media along
+// with their MediaAliases.
+type NameService struct {
+	Hooks db.PersistHooks
+	// Romanizers add the readings of names in other scripts to their keys,
+	// so that names written in kanji are found by their romaji and the
+	// other way round. Kana are always romanized.
+	Romanizers []Romanizer
+	// services are the services of the entities indexed.
+	services []db.Service
+	// mediaAliasService is the service of the aliases Media are indexed by.
+	mediaAliasService *MediaAliasService
+}
+
+// NewNameService returns a NameService, which keeps the entities of the
+// given services indexed by their names. The given MediaAliasService must
+// have been created before, so that MediaAliases are deleted with their
+// Media before the Media are unindexed.
+func NewNameService(
+	hooks db.PersistHooks, mediaService *MediaService,
+	mediaAliasService *MediaAliasService, personService *PersonService,
+	characterService *CharacterService, romanizers ...Romanizer,
+) *NameService {
+	// Initialize NameService
+	nameService := &NameService{
+		Hooks:             hooks,
+		Romanizers:        romanizers,
+		services:          []db.Service{mediaService, personService, characterService},
+		mediaAliasService: mediaAliasService,
+	}
+	mediaService.NameService = nameService
+	personService.NameService = nameService
+	characterService.NameService = nameService
+
+	// Add hooks to keep the entities indexed by their names
+	indexEntity := func(m db.Model, ser db.Service, tx db.Tx) error {
+		names, err := nameService.namesOf(m, tx)
+		if err != nil {
+			return err
+		}
+		id := m.Metadata().ID
+		err = nameService.index(ser.Bucket(), id, nameService.Keys(names), tx)
+		if err != nil {
+			return fmt.Errorf("failed to index %s with ID %d: %w", ser.Bucket(), id, err)
+		}
+		return nil
+	}
+	unindexEntity := func(m db.Model, ser db.Service, tx db.Tx) error {
+		id := m.Metadata().ID
+		err := nameService.index(ser.Bucket(), id, nil, tx)
+		if err != nil {
+			return fmt.Errorf("failed to unindex %s with ID %d: %w", ser.Bucket(), id, err)
+		}
+		return nil
+	}
+	for _, ser := range nameService.services {
+		serHooks := ser.PersistHooks()
+		serHooks.PostCreateHooks = append(serHooks.PostCreateHooks, indexEntity)
+		serHooks.PostUpdateHooks = append(serHooks.PostUpdateHooks, indexEntity)
+		serHooks.PreDeleteHooks = append(serHooks.PreDeleteHooks, unindexEntity)
+	}
+
+	// Add hooks to index Media by their aliases
+	indexAliasMedia := func(m db.Model, _ db.Service, tx db.Tx) error {
+		a, err := mediaAliasService.AssertType(m)
+		if err != nil {
+			return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+		md, err := mediaService.GetByID(a.MediaID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get Media with ID %d: %w", a.MediaID, err)
+		}
+		return indexEntity(md, mediaService, tx)
+	}
+	aSerHooks := mediaAliasService.PersistHooks()
+	aSerHooks.PostCreateHooks = append(aSerHooks.PostCreateHooks, indexAliasMedia)
+	aSerHooks.PostUpdateHooks = append(aSerHooks.PostUpdateHooks, indexAliasMedia)
+	aSerHooks.PostDeleteHooks = append(aSerHooks.PostDeleteHooks, indexAliasMedia)
+
+	return nameService
+}
+
+// namesOf returns the names of the given entity, for Media their Titles and
+// the titles of their MediaAliases.
+func (ser *NameService) namesOf(m db.Model, tx db.Tx) ([]models.Title, error) {
+	switch e := m.(type) {
+	case *models.Media:
+		aliases, err := ser.mediaAliasService.GetByMedia(e.Meta.ID, nil, nil, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get MediaAliases by Media ID %d: %w",
+				e.Meta.ID, err)
+		}
+		names := append([]models.Title{}, e.Titles...)
+		for _, a := range aliases {
+			names = append(names, models.Title{String: a.Title, Language: a.Language})
+		}
+		return names, nil
+	case *models.Person:
+		return e.Names, nil
+	case *models.Character:
+		return e.Names, nil
+	}
+	return nil, fmt.Errorf("model: %w", errors.New("not of a type with names"))
+}
+
+// Keys returns the distinct keys of the given names, by NameKey and by the
+// readings of the Romanizers.
+func (ser *NameService) Keys(names []models.Title) []string {
+	keys := []string{}
+	seen := map[string]bool{}
+	add := func(k string) {
+		if k != "" && !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	for _, n := range names {
+		key := NameKey(n.String)
+		add(key)
+		for _, r := range ser.Romanizers {
+			add(NameKey(r.Romanize(key)))
+		}
+	}
+	return keys
+}
+
+// index replaces the keys the entity of the given bucket and ID is indexed
+// by. The entity is removed from the index if there are none.
+func (ser *NameService) index(bucket string, id int, keys []string, tx db.Tx) error {
+	list, err := ser.getBucket(bucket, tx)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range list {
+		if n.ModelID != id {
+			continue
+		}
+		if len(keys) == 0 {
+			err = ser.Delete(n.Meta.ID, tx)
+		} else {
+			n.Keys = keys
+			err = ser.Update(n, tx)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update Name with ID %d: %w", n.Meta.ID, err)
+		}
+		return nil
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err = ser.Create(&models.Name{Bucket: bucket, ModelID: id, Keys: keys}, tx)
+	if err != nil {
+		return fmt.Errorf("failed to create Name: %w", err)
+	}
+	return nil
+}
+
+// Reindex rebuilds the index from all persisted entities, returning the
+// number of entities indexed.
+func (ser *NameService) Reindex(tx db.Tx) (int, error) {
+	err := tx.Database().DeleteFilter(ser, tx, func(db.Model) bool { return true })
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete Names: %w", err)
+	}
+
+	n := 0
+	for _, entSer := range ser.services {
+		list, err := tx.Database().GetAll(nil, nil, entSer, tx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get %s: %w", entSer.Bucket(), err)
+		}
+		for _, m := range list {
+			names, err := ser.namesOf(m, tx)
+			if err != nil {
+				return 0, err
+			}
+			keys := ser.Keys(names)
+			if len(keys) == 0 {
+				continue
+			}
+			_, err = ser.Create(&models.Name{
+				Bucket: entSer.Bucket(), ModelID: m.Metadata().ID, Keys: keys,
+			}, tx)
+			if err != nil {
+				return 0, fmt.Errorf("failed to index %s with ID %d: %w",
+					entSer.Bucket(), m.Metadata().ID, err)
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Search returns the IDs of the entities of the given bucket with a name
+// matching the given query, at most first if not nil. A name matches if each
+// word of the query begins one of its words, in any order, or for words of
+// scripts written without spaces, such as kanji, is found in one of them.
+// Entities with a name of exactly the words of the query come first.
+func (ser *NameService) Search(
+	bucket string, query string, first *int, tx db.Tx,
+) ([]int, error) {
+	queries := ser.Keys([]models.Title{{String: query}})
+	if len(queries) == 0 {
+		return []int{}, nil
+	}
+
+	list, err := ser.getBucket(bucket, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	type match struct {
+		id    int
+		exact bool
+	}
+	matches := []match{}
+	for _, n := range list {
+		found, exact := false, false
+		for _, k := range n.Keys {
+			for _, q := range queries {
+				ok, ex := matchNameKey(k, q)
+				found = found || ok
+				exact = exact || ex
+			}
+		}
+		if found {
+			matches = append(matches, match{id: n.ModelID, exact: exact})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].exact && !matches[j].exact
+	})
+
+	if first != nil && *first >= 0 && *first < len(matches) {
+		matches = matches[:*first]
+	}
+	ids := make([]int, len(matches))
+	for i, m := range matches {
+		ids[i] = m.id
+	}
+	return ids, nil
+}
+
+// matchNameKey returns whether the given name key matches the given query
+// key, and whether it is made of exactly the words of the query.
+func matchNameKey(key, query string) (bool, bool) {
+	words := strings.Fields(key)
+	qwords := strings.Fields(query)
+	for _, q := range qwords {
+		found := false
+		for _, w := range words {
+			if strings.HasPrefix(w, q) || (!isLatinWord(q) && strings.Contains(w, q)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, false
+		}
+	}
+
+	if len(words) != len(qwords) {
+		return true, false
+	}
+	sort.Strings(words)
+	sort.Strings(qwords)
+	for i := range words {
+		if words[i] != qwords[i] {
+			return true, false
+		}
+	}
+	return true, true
+}
+
+// isLatinWord returns true if the given word is made only of Latin letters
+// and digits.
+func isLatinWord(w string) bool {
+	for _, r := range w {
+		if !unicode.Is(unicode.Latin, r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// getBucket retrieves the Names of the entities of the given bucket.
+func (ser *NameService) getBucket(bucket string, tx db.Tx) ([]*models.Name, error) {
+	vlist, err := tx.Database().GetFilter(nil, nil, ser, tx, func(m db.Model) bool {
+		n, err := ser.AssertType(m)
+		return err == nil && n.Bucket == bucket
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Names of %s: %w", bucket, err)
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to Names: %w", err)
+	}
+	return list, nil
+}
+
+// Create persists the given Name.
+func (ser *NameService) Create(n *models.Name, tx db.Tx) (int, error) {
+	return tx.Database().Create(n, ser, tx)
+}
+
+// Update replaces the value of the Name with the given ID.
+func (ser *NameService) Update(n *models.Name, tx db.Tx) error {
+	return tx.Database().Update(n, ser, tx)
+}
+
+// Delete deletes the Name with the given ID.
+func (ser *NameService) Delete(id int, tx db.Tx) error {
+	return tx.Database().Delete(id, ser, tx)
+}
+
+// GetAll retrieves all persisted values of Name.
+func (ser *NameService) GetAll(first *int, skip *int, tx db.Tx) ([]*models.Name, error) {
+	vlist, err := tx.Database().GetAll(first, skip, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to Names: %w", err)
+	}
+	return list, nil
+}
+
+// Bucket returns the name of the bucket for Name.
+func (ser *NameService) Bucket() string {
+	return "Name"
+}
+
+// UniqueKey returns the bucket and ID of the entity.
+func (ser *NameService) UniqueKey(m db.Model) (string, error) {
+	n, err := ser.AssertType(m)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return fmt.Sprintf("%s/%d", n.Bucket, n.ModelID), nil
+}
+
+// Clean cleans the given Name for storage.
+func (ser *NameService) Clean(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// Validate returns an error if the Name is not valid for the database.
+func (ser *NameService) Validate(m db.Model, _ db.Tx) error {
+	n, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	var verr ValidationError
+	ValidateTags(n, &verr)
+	return verr.Err()
+}
+
+// Initialize sets initial values for some properties.
+func (ser *NameService) Initialize(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistOldProperties maintains certain properties of the existing Name in
+// updates.
+func (ser *NameService) PersistOldProperties(_ db.Model, _ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistHooks returns the persistence hook functions.
+func (ser *NameService) PersistHooks() *db.PersistHooks {
+	return &ser.Hooks
+}
+
+// Marshal encodes the given Name for storage.
+func (ser *NameService) Marshal(m db.Model) ([]byte, error) {
+	n, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	v, err := db.Codecs.Encode(ser.Bucket(), n)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
+	}
+
+	return v, nil
+}
+
+// Unmarshal decodes the given record into Name.
+func (ser *NameService) Unmarshal(buf []byte) (db.Model, error) {
+	var n models.Name
+	err := db.Codecs.Decode(buf, &n)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
+	}
+	return &n, nil
+}
+
+// AssertType exposes the given db.Model as a Name.
+func (ser *NameService) AssertType(m db.Model) (*models.Name, error) {
+	if m == nil {
+		return nil, fmt.Errorf("model: %w", errNil)
+	}
+
+	n, ok := m.(*models.Name)
+	if !ok {
+		return nil, fmt.Errorf("model: %w", errors.New("not of Name type"))
+	}
+	return n, nil
+}
+
+// mapFromModel returns a list of Name type asserted from the given list of
+// db.Model.
+func (ser *NameService) mapFromModel(vlist []db.Model) ([]*models.Name, error) {
+	list := make([]*models.Name, len(vlist))
+	var err error
+	for i, v := range vlist {
+		list[i], err = ser.AssertType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,217 @@
+package data
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"golang.org/x/text/unicode/norm"
+)
+
+// TagClean is the name of the struct tag of the normalization of the
+// properties of models, such as `clean:"line"`.
+const TagClean = "clean"
+
+// Default bounds of the years of dates.
+const (
+	DefaultMinYear = 1800
+	DefaultMaxYear = 2200
+)
+
+// Normalizer normalizes the strings and dates of entities of every type as
+// they are written, by their clean tags, before their services validate and
+// clean them. Properties of struct type, and slices of them, are normalized
+// too. Strings are trimmed of surrounding whitespace, and the options of the
+// tags are:
+//
+//   - line: whitespace within the string is collapsed into single spaces,
+//     for names and other strings of a single line.
+//   - after=F: the date must not be before that of the property F of the
+//     same struct, if both are set.
+//   - -: the property is left as it is.
+//
+// The properties of db.ModelMetadata are left as they are.
+type Normalizer struct {
+	// Unicode puts strings in Unicode normalization form NFC, so that
+	// strings that look the same compare equal.
+	Unicode bool
+	// MinYear and MaxYear bound the years of dates that are set; either is
+	// unbounded if 0.
+	MinYear int
+	MaxYear int
+}
+
+// NewNormalizer returns a Normalizer that puts strings in NFC and bounds years
+// by DefaultMinYear and DefaultMaxYear.
+func NewNormalizer() *Normalizer {
+	return &Normalizer{
+		Unicode: true,
+		MinYear: DefaultMinYear,
+		MaxYear: DefaultMaxYear,
+	}
+}
+
+// Normalize normalizes the given Model, returning a ValidationError if any of
+// its dates is out of range.
+func (n *Normalizer) Normalize(m db.Model) error {
+	var verr ValidationError
+	n.normalizeStruct(reflect.ValueOf(m), "", &verr)
+	return verr.Err()
+}
+
+// String returns the given string normalized, with whitespace within it
+// collapsed if line is true.
+func (n *Normalizer) String(s string, line bool) string {
+	if n.Unicode {
+		s = norm.NFC.String(s)
+	}
+	if line {
+		return strings.Join(strings.Fields(s), " ")
+	}
+	return strings.TrimSpace(s)
+}
+
+// cleanField is a property of a struct type that is normalized.
+type cleanField struct {
+	index int
+	name  string
+	line  bool
+	// after is the index of the property the date may not be before, or -1.
+	after     int
+	afterName string
+}
+
+// cleanFields caches the normalized properties of struct types.
+var cleanFields sync.Map
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	metadataType = reflect.TypeOf(db.ModelMetadata{})
+)
+
+// cleanFieldsOf returns the normalized properties of the given struct type.
+func cleanFieldsOf(t reflect.Type) []cleanField {
+	if v, ok := cleanFields.Load(t); ok {
+		return v.([]cleanField)
+	}
+
+	fields := []cleanField{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" || sf.Type == metadataType {
+			continue
+		}
+
+		f := cleanField{index: i, name: sf.Name, after: -1}
+		tag := sf.Tag.Get(TagClean)
+		if tag == "-" {
+			continue
+		}
+		for _, opt := range strings.Split(tag, ",") {
+			opt = strings.TrimSpace(opt)
+			switch {
+			case opt == "":
+			case opt == "line":
+				f.line = true
+			case strings.HasPrefix(opt, "after="):
+				f.afterName = strings.TrimPrefix(opt, "after=")
+				af, ok := t.FieldByName(f.afterName)
+				if !ok || len(af.Index) != 1 {
+					panic(fmt.Sprintf("%s.%s: unknown property %q", t, sf.Name, f.afterName))
+				}
+				f.after = af.Index[0]
+			default:
+				panic(fmt.Sprintf("%s.%s: unknown option %q", t, sf.Name, opt))
+			}
+		}
+		fields = append(fields, f)
+	}
+	cleanFields.Store(t, fields)
+	return fields
+}
+
+// normalizeStruct normalizes the properties of the given struct value, or
+// pointer to one, whose path is prefix.
+func (n *Normalizer) normalizeStruct(v reflect.Value, prefix string, verr *ValidationError) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	for _, f := range cleanFieldsOf(v.Type()) {
+		path := f.name
+		if prefix != "" {
+			path = prefix + "." + f.name
+		}
+		fv := v.Field(f.index)
+		n.normalizeValue(fv, f.line, path, verr)
+
+		if f.after < 0 {
+			continue
+		}
+		start, ok := dateOf(v.Field(f.after))
+		end, eok := dateOf(fv)
+		if ok && eok && end.Before(start) {
+			verr.Addf(path, FieldOutOfRange, "%v: before %s %v", end, f.afterName, start)
+		}
+	}
+}
+
+// normalizeValue normalizes the given value of a property whose path is path.
+func (n *Normalizer) normalizeValue(
+	v reflect.Value, line bool, path string, verr *ValidationError,
+) {
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			return
+		}
+		y := t.Year()
+		if (n.MinYear != 0 && y < n.MinYear) || (n.MaxYear != 0 && y > n.MaxYear) {
+			verr.Addf(path, FieldOutOfRange, "year %d: must be between %d and %d",
+				y, n.MinYear, n.MaxYear)
+		}
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			n.normalizeValue(v.Elem(), line, path, verr)
+		}
+	case reflect.String:
+		if v.CanSet() {
+			v.SetString(n.String(v.String(), line))
+		}
+	case reflect.Slice:
+		switch v.Type().Elem().Kind() {
+		case reflect.String, reflect.Struct, reflect.Ptr:
+			for i := 0; i < v.Len(); i++ {
+				n.normalizeValue(v.Index(i), line, fmt.Sprintf("%s[%d]", path, i), verr)
+			}
+		}
+	case reflect.Struct:
+		n.normalizeStruct(v, path, verr)
+	}
+}
+
+// dateOf returns the date of the given time.Time value, or pointer to one, or
+// false if it is not set.
+func dateOf(v reflect.Value) (time.Time, bool) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return time.Time{}, false
+		}
+		v = v.Elem()
+	}
+	t, ok := v.Interface().(time.Time)
+	return t, ok && !t.IsZero()
+}
@@ -0,0 +1,445 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// NotificationService performs operations on Notification, the inbox of each
+// User.
+type NotificationService struct {
+	UserService       *UserService
+	UserFollowService *UserFollowService
+	UserMediaService  *UserMediaService
+	Hooks             db.PersistHooks
+}
+
+// NewNotificationService returns a NotificationService.
+func NewNotificationService(
+	hooks db.PersistHooks, userService *UserService,
+	userFollowService *UserFollowService, userMediaService *UserMediaService,
+) *NotificationService {
+	// Initialize NotificationService
+	notificationService := &NotificationService{
+		UserService:       userService,
+		UserFollowService: userFollowService,
+		UserMediaService:  userMediaService,
+		Hooks:             hooks,
+	}
+
+	// Add hook to delete Notification on User deletion
+	deleteNotificationOnDeleteUser := func(um db.Model, _ db.Service, tx db.Tx) error {
+		uID := um.Metadata().ID
+		err := notificationService.DeleteByUser(uID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to delete Notification by User ID %d: %w", uID, err)
+		}
+		return nil
+	}
+	uSerHooks := userService.PersistHooks()
+	uSerHooks.PreDeleteHooks =
+		append(uSerHooks.PreDeleteHooks, deleteNotificationOnDeleteUser)
+
+	return notificationService
+}
+
+// Track adds hooks to the given service that notify the followers of a User
+// of their new Activities, if the followers may view the lists of that User.
+func (ser *NotificationService) Track(as *ActivityService) {
+	aHooks := as.PersistHooks()
+	aHooks.PostCreateHooks = append(aHooks.PostCreateHooks,
+		func(m db.Model, _ db.Service, tx db.Tx) error {
+			a, err := as.AssertType(m)
+			if err != nil {
+				return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+			}
+			return ser.notifyFollowers(a, tx)
+		})
+}
+
+// notifyFollowers notifies the followers of the User of the given Activity
+// who may view it.
+func (ser *NotificationService) notifyFollowers(a *models.Activity, tx db.Tx) error {
+	list, err := ser.UserFollowService.GetByFollowee(a.UserID, nil, nil, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get followers of User with ID %d: %w", a.UserID, err)
+	}
+
+	for _, uf := range list {
+		follower, err := ser.UserService.GetByID(uf.FollowerID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get User by ID %d: %w", uf.FollowerID, err)
+		}
+		err = ser.UserService.AuthorizeViewAs(follower, a.UserID, models.PrivacyLists, tx)
+		if errors.Is(err, ErrUnauthorized) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		actorID, aID, mID := a.UserID, a.Meta.ID, a.MediaID
+		_, err = ser.Create(&models.Notification{
+			UserID:     follower.Meta.ID,
+			Kind:       models.NotificationFriendActivity,
+			MediaID:    &mID,
+			ActorID:    &actorID,
+			ActivityID: &aID,
+		}, tx)
+		if err != nil {
+			return fmt.Errorf("failed to notify User with ID %d: %w", follower.Meta.ID, err)
+		}
+	}
+	return nil
+}
+
+// NotifyAired notifies the Users watching or planning to watch some Media of
+// the Episodes of it that aired after the given start time, up to and
+// including the given end time. Users already notified of an Episode are not
+// notified again. It returns the number of Notifications created.
+func (ser *NotificationService) NotifyAired(from time.Time, to time.Time, tx db.Tx) (int, error) {
+	ums := ser.UserMediaService
+	if ums.EpisodeService == nil || ums.EpisodeSetService == nil {
+		return 0, nil
+	}
+	eps, err := ums.EpisodeService.GetFilter(nil, nil, tx, func(ep *models.Episode) bool {
+		return ep.Date != nil && ep.Date.After(from) && !ep.Date.After(to)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get Episodes aired since %v: %w", from, err)
+	}
+	if len(eps) == 0 {
+		return 0, nil
+	}
+	aired := map[int]bool{}
+	for _, ep := range eps {
+		aired[ep.Meta.ID] = true
+	}
+
+	// Find the Media of the aired Episodes
+	sets, err := ums.EpisodeSetService.GetFilter(nil, nil, tx, func(set *models.EpisodeSet) bool {
+		for _, id := range set.Episodes {
+			if aired[id] {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get EpisodeSets of aired Episodes: %w", err)
+	}
+	mediaEpisodes := map[int][]int{}
+	for _, set := range sets {
+		for _, id := range set.Episodes {
+			if aired[id] && !containsInt(mediaEpisodes[set.MediaID], id) {
+				mediaEpisodes[set.MediaID] = append(mediaEpisodes[set.MediaID], id)
+			}
+		}
+	}
+
+	followers, err := ums.GetFilter(nil, nil, tx, func(um *models.UserMedia) bool {
+		following := um.Status != nil && (*um.Status == models.WatchStatusCurrent ||
+			*um.Status == models.WatchStatusPlanning)
+		return following && len(mediaEpisodes[um.MediaID]) > 0
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get UserMedia of aired Media: %w", err)
+	}
+
+	count := 0
+	for _, um := range followers {
+		for _, epID := range mediaEpisodes[um.MediaID] {
+			uID, mID, epID := um.UserID, um.MediaID, epID
+			existing, err := ser.GetFilter(nil, nil, tx, func(n *models.Notification) bool {
+				return n.UserID == uID && n.EpisodeID != nil && *n.EpisodeID == epID
+			})
+			if err != nil {
+				return count, fmt.Errorf("failed to get Notifications of User with ID %d: %w",
+					uID, err)
+			}
+			if len(existing) > 0 {
+				continue
+			}
+
+			_, err = ser.Create(&models.Notification{
+				UserID:    uID,
+				Kind:      models.NotificationEpisodeAired,
+				MediaID:   &mID,
+				EpisodeID: &epID,
+			}, tx)
+			if err != nil {
+				return count, fmt.Errorf("failed to notify User with ID %d: %w", uID, err)
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Create persists the given Notification.
+func (ser *NotificationService) Create(n *models.Notification, tx db.Tx) (int, error) {
+	return tx.Database().Create(n, ser, tx)
+}
+
+// Update replaces the value of the Notification with the given ID.
+func (ser *NotificationService) Update(n *models.Notification, tx db.Tx) error {
+	return tx.Database().Update(n, ser, tx)
+}
+
+// Delete deletes the Notification with the given ID.
+func (ser *NotificationService) Delete(id int, tx db.Tx) error {
+	return tx.Database().Delete(id, ser, tx)
+}
+
+// DeleteByUser deletes the Notifications of the User with the given ID and
+// those about their Activities.
+func (ser *NotificationService) DeleteByUser(uID int, tx db.Tx) error {
+	return tx.Database().DeleteFilter(ser, tx, func(m db.Model) bool {
+		n, err := ser.AssertType(m)
+		if err != nil {
+			return false
+		}
+		return n.UserID == uID || (n.ActorID != nil && *n.ActorID == uID)
+	})
+}
+
+// MarkRead marks the Notifications of the User with the given ID with the
+// given IDs as read, or all of them if no IDs are given.
+func (ser *NotificationService) MarkRead(uID int, ids []int, tx db.Tx) error {
+	list, err := ser.GetFilter(nil, nil, tx, func(n *models.Notification) bool {
+		return n.UserID == uID && (len(ids) == 0 || containsInt(ids, n.Meta.ID))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get Notifications of User with ID %d: %w", uID, err)
+	}
+	// Notifications of other Users are reported as missing
+	found := map[int]bool{}
+	for _, n := range list {
+		found[n.Meta.ID] = true
+	}
+	for _, id := range ids {
+		if !found[id] {
+			return fmt.Errorf("Notification with ID %d: %w", id, ErrNotFound)
+		}
+	}
+
+	for _, n := range list {
+		if n.Read {
+			continue
+		}
+		n.Read = true
+		err = ser.Update(n, tx)
+		if err != nil {
+			return fmt.Errorf("failed to update Notification with ID %d: %w", n.Meta.ID, err)
+		}
+	}
+	return nil
+}
+
+// GetFilter retrieves all persisted values of Notification that pass the
+// filter.
+func (ser *NotificationService) GetFilter(
+	first *int, skip *int, tx db.Tx, keep func(n *models.Notification) bool,
+) ([]*models.Notification, error) {
+	vlist, err := tx.Database().GetFilter(first, skip, ser, tx,
+		func(m db.Model) bool {
+			n, err := ser.AssertType(m)
+			if err != nil {
+				return false
+			}
+			return keep(n)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to Notifications: %w", err)
+	}
+	return list, nil
+}
+
+// GetAll retrieves all persisted values of Notification.
+func (ser *NotificationService) GetAll(first *int, skip *int, tx db.Tx) ([]*models.Notification, error) {
+	vlist, err := tx.Database().GetAll(first, skip, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to Notifications: %w", err)
+	}
+	return list, nil
+}
+
+// GetByUser retrieves the persisted Notifications of the User with the given
+// ID, newest first. Only unread Notifications are retrieved if unread is
+// true, and only those updated after since if it is not nil.
+func (ser *NotificationService) GetByUser(
+	uID int, unread bool, since *time.Time, first *int, skip *int, tx db.Tx,
+) ([]*models.Notification, error) {
+	list, err := ser.GetFilter(nil, nil, tx, func(n *models.Notification) bool {
+		return n.UserID == uID && (!unread || !n.Read) && n.Meta.UpdatedSince(since)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// IDs are not necessarily assigned in order, so sort by creation time
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Meta.CreatedAt.After(list[j].Meta.CreatedAt)
+	})
+
+	if skip != nil && *skip > 0 {
+		if *skip > len(list) {
+			return []*models.Notification{}, nil
+		}
+		list = list[*skip:]
+	}
+	if first != nil && *first >= 0 && *first < len(list) {
+		list = list[:*first]
+	}
+	return list, nil
+}
+
+// UnreadCount returns the number of unread Notifications of the User with the
+// given ID.
+func (ser *NotificationService) UnreadCount(uID int, tx db.Tx) (int, error) {
+	list, err := ser.GetFilter(nil, nil, tx, func(n *models.Notification) bool {
+		return n.UserID == uID && !n.Read
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(list), nil
+}
+
+// Bucket returns the name of the bucket for Notification.
+func (ser *NotificationService) Bucket() string {
+	return "Notification"
+}
+
+// Clean cleans the given Notification for storage.
+func (ser *NotificationService) Clean(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// Validate returns an error if the Notification is not valid for the
+// database.
+func (ser *NotificationService) Validate(m db.Model, tx db.Tx) error {
+	e, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	var verr ValidationError
+	if !e.Kind.IsValid() {
+		verr.Addf("Kind", FieldInvalid, "unknown kind %v", e.Kind)
+	}
+	err = verr.Err()
+	if err != nil {
+		return err
+	}
+
+	db := tx.Database()
+
+	// Check if the Users with IDs specified in Notification exist
+	_, err = db.GetRawByID(e.UserID, ser.UserService, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get User with ID %d: %w", e.UserID, err)
+	}
+	if e.ActorID != nil {
+		_, err = db.GetRawByID(*e.ActorID, ser.UserService, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get User with ID %d: %w", *e.ActorID, err)
+		}
+	}
+
+	return nil
+}
+
+// Initialize sets initial values for some properties.
+func (ser *NotificationService) Initialize(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistOldProperties maintains certain properties of the existing
+// Notification in updates.
+func (ser *NotificationService) PersistOldProperties(n db.Model, o db.Model, _ db.Tx) error {
+	nt, err := ser.AssertType(n)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	old, err := ser.AssertType(o)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	nt.UserID = old.UserID
+	nt.Kind = old.Kind
+	return nil
+}
+
+// PersistHooks returns the persistence hook functions.
+func (ser *NotificationService) PersistHooks() *db.PersistHooks {
+	return &ser.Hooks
+}
+
+// Marshal encodes the given Notification for storage.
+func (ser *NotificationService) Marshal(m db.Model) ([]byte, error) {
+	n, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	v, err := db.Codecs.Encode(ser.Bucket(), n)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
+	}
+
+	return v, nil
+}
+
+// Unmarshal decodes the given record into Notification.
+func (ser *NotificationService) Unmarshal(buf []byte) (db.Model, error) {
+	var n models.Notification
+	err := db.Codecs.Decode(buf, &n)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
+	}
+	return &n, nil
+}
+
+// AssertType exposes the given db.Model as a Notification.
+func (ser *NotificationService) AssertType(m db.Model) (*models.Notification, error) {
+	if m == nil {
+		return nil, fmt.Errorf("model: %w", errNil)
+	}
+
+	n, ok := m.(*models.Notification)
+	if !ok {
+		return nil, fmt.Errorf("model: %w", errors.New("not of Notification type"))
+	}
+	return n, nil
+}
+
+// mapFromModel returns a list of Notification type asserted from the given
+// list of db.Model.
+func (ser *NotificationService) mapFromModel(vlist []db.Model) ([]*models.Notification, error) {
+	list := make([]*models.Notification, len(vlist))
+	var err error
+	for i, v := range vlist {
+		list[i], err = ser.AssertType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,511 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// Keys of the MediaOrders kept by MediaOrderService. The order by title in a
+// language is named by MediaOrderTitle, a colon and the language, such as
+// title:en.
+const (
+	// MediaOrderStartDate orders the Media by their StartDate.
+	MediaOrderStartDate = "startDate"
+	// MediaOrderScore orders the Media by the mean score given to them.
+	MediaOrderScore = "score"
+	// MediaOrderTitle orders the Media by their Title in a language, ignoring
+	// case.
+	MediaOrderTitle = "title"
+)
+
+// MediaOrderService performs operations on MediaOrder, the views of Media
+// sorted by their StartDate, their mean score and their Titles.
+type MediaOrderService struct {
+	MediaService     *MediaService
+	UserMediaService *UserMediaService
+	// TitleLanguages are the language ranges the Media are ordered by Title
+	// in; Media without a Title in one are ordered by their best other one.
+	TitleLanguages []string
+	Hooks          db.PersistHooks
+}
+
+// NewMediaOrderService returns a MediaOrderService, which keeps the Media
+// sorted as they and the scores given to them change.
+func NewMediaOrderService(
+	hooks db.PersistHooks, mediaService *MediaService,
+	userMediaService *UserMediaService, titleLanguages []string,
+) *MediaOrderService {
+	// Initialize MediaOrderService
+	mediaOrderService := &MediaOrderService{
+		MediaService:     mediaService,
+		UserMediaService: userMediaService,
+		TitleLanguages:   titleLanguages,
+		Hooks:            hooks,
+	}
+
+	// Add hooks to keep Media sorted as they change
+	indexMedia := func(created bool) db.PersistHookFunc {
+		return func(m db.Model, _ db.Service, tx db.Tx) error {
+			md, err := mediaService.AssertType(m)
+			if err != nil {
+				return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+			}
+			keys := mediaOrderService.keysOf(md)
+			if created {
+				// New Media are not yet scored by any User
+				keys[MediaOrderScore] = nil
+			}
+			for name, key := range keys {
+				err = mediaOrderService.index(name, md.Meta.ID, key, true, tx)
+				if err != nil {
+					return fmt.Errorf("failed to index Media with ID %d: %w", md.Meta.ID, err)
+				}
+			}
+			return nil
+		}
+	}
+	unindexMedia := func(m db.Model, _ db.Service, tx db.Tx) error {
+		mID := m.Metadata().ID
+		for _, name := range mediaOrderService.Names() {
+			err := mediaOrderService.index(name, mID, nil, false, tx)
+			if err != nil {
+				return fmt.Errorf("failed to unindex Media with ID %d: %w", mID, err)
+			}
+		}
+		return nil
+	}
+	mdSerHooks := mediaService.PersistHooks()
+	mdSerHooks.PostCreateHooks = append(mdSerHooks.PostCreateHooks, indexMedia(true))
+	mdSerHooks.PostUpdateHooks = append(mdSerHooks.PostUpdateHooks, indexMedia(false))
+	// Unindexed after deletion, so that the UserMedia deleted with the Media
+	// do not index it again
+	mdSerHooks.PostDeleteHooks = append(mdSerHooks.PostDeleteHooks, unindexMedia)
+
+	// Add hooks to keep Media sorted by score as they are scored
+	indexScore := func(m db.Model, _ db.Service, tx db.Tx) error {
+		um, err := userMediaService.AssertType(m)
+		if err != nil {
+			return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+		exists, err := mediaService.Exists(um.MediaID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to check existence of Media with ID %d: %w",
+				um.MediaID, err)
+		}
+		if !exists {
+			return nil
+		}
+		key, err := mediaOrderService.scoreKey(um.MediaID, tx)
+		if err != nil {
+			return err
+		}
+		err = mediaOrderService.index(MediaOrderScore, um.MediaID, key, true, tx)
+		if err != nil {
+			return fmt.Errorf("failed to index Media with ID %d: %w", um.MediaID, err)
+		}
+		return nil
+	}
+	umSerHooks := userMediaService.PersistHooks()
+	umSerHooks.PostCreateHooks = append(umSerHooks.PostCreateHooks, indexScore)
+	umSerHooks.PostUpdateHooks = append(umSerHooks.PostUpdateHooks, indexScore)
+	umSerHooks.PostDeleteHooks = append(umSerHooks.PostDeleteHooks, indexScore)
+
+	return mediaOrderService
+}
+
+// Names returns the names of the MediaOrders kept.
+func (ser *MediaOrderService) Names() []string {
+	names := []string{MediaOrderStartDate, MediaOrderScore}
+	for _, lang := range ser.TitleLanguages {
+		names = append(names, MediaOrderTitle+":"+lang)
+	}
+	return names
+}
+
+// keysOf returns the keys of the given Media in the MediaOrders derived from
+// the Media alone, by name; keys are nil if the Media has none.
+func (ser *MediaOrderService) keysOf(md *models.Media) map[string]*string {
+	keys := map[string]*string{MediaOrderStartDate: nil}
+	if md.StartDate != nil {
+		key := md.StartDate.UTC().Format("2006-01-02T15:04:05.000000000")
+		keys[MediaOrderStartDate] = &key
+	}
+	for _, lang := range ser.TitleLanguages {
+		name := MediaOrderTitle + ":" + lang
+		keys[name] = nil
+		if t := models.SelectTitle(md.Titles, []string{lang}); t != nil {
+			key := strings.ToLower(t.String)
+			keys[name] = &key
+		}
+	}
+	return keys
+}
+
+// scoreKey returns the key of the Media with the given ID in the MediaOrder
+// by score, or nil if no User scored it.
+func (ser *MediaOrderService) scoreKey(mID int, tx db.Tx) (*string, error) {
+	umList, err := ser.UserMediaService.GetFilter(nil, nil, tx, func(um *models.UserMedia) bool {
+		return um.MediaID == mID && um.Score != nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get UserMedia by Media ID %d: %w", mID, err)
+	}
+	if len(umList) == 0 {
+		return nil, nil
+	}
+	sum := 0
+	for _, um := range umList {
+		sum += *um.Score
+	}
+	return scoreOrderKey(float64(sum) / float64(len(umList))), nil
+}
+
+// scoreOrderKey returns the key of the given mean score, which sorts as
+// strings as the score does as a number.
+func scoreOrderKey(mean float64) *string {
+	key := fmt.Sprintf("%012.4f", mean)
+	return &key
+}
+
+// index moves the Media with the given ID to the position of the given key in
+// the MediaOrder of the given name, among the Media without a key if nil.
+// The Media is removed from the MediaOrder instead if keep is false.
+func (ser *MediaOrderService) index(
+	name string, mID int, key *string, keep bool, tx db.Tx,
+) error {
+	o, err := ser.get(name, tx)
+	if err != nil {
+		return err
+	}
+	if o == nil {
+		if !keep {
+			return nil
+		}
+		o = &models.MediaOrder{Name: name}
+	}
+
+	changed := false
+	for i, e := range o.Entries {
+		if e.MediaID != mID {
+			continue
+		}
+		if keep && key != nil && e.Key == *key {
+			return nil
+		}
+		o.Entries = append(o.Entries[:i], o.Entries[i+1:]...)
+		changed = true
+		break
+	}
+	if i := indexOfInt(o.Unkeyed, mID); i >= 0 {
+		if keep && key == nil {
+			return nil
+		}
+		o.Unkeyed = append(o.Unkeyed[:i], o.Unkeyed[i+1:]...)
+		changed = true
+	}
+
+	switch {
+	case !keep:
+	case key != nil:
+		e := models.MediaOrderEntry{MediaID: mID, Key: *key}
+		i := sort.Search(len(o.Entries), func(i int) bool {
+			return !entryBefore(o.Entries[i], e)
+		})
+		o.Entries = append(o.Entries, models.MediaOrderEntry{})
+		copy(o.Entries[i+1:], o.Entries[i:])
+		o.Entries[i] = e
+		changed = true
+	default:
+		i := sort.SearchInts(o.Unkeyed, mID)
+		o.Unkeyed = append(o.Unkeyed, 0)
+		copy(o.Unkeyed[i+1:], o.Unkeyed[i:])
+		o.Unkeyed[i] = mID
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	if o.Meta.ID == 0 {
+		_, err = ser.Create(o, tx)
+	} else {
+		err = ser.Update(o, tx)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to persist MediaOrder %q: %w", name, err)
+	}
+	return nil
+}
+
+// entryBefore checks if the entry a comes before the entry b.
+func entryBefore(a, b models.MediaOrderEntry) bool {
+	if a.Key != b.Key {
+		return a.Key < b.Key
+	}
+	return a.MediaID < b.MediaID
+}
+
+// get returns the MediaOrder of the given name, or nil if there is none.
+func (ser *MediaOrderService) get(name string, tx db.Tx) (*models.MediaOrder, error) {
+	m, err := tx.Database().FindFirst(ser, tx, func(m db.Model) (bool, error) {
+		o, err := ser.AssertType(m)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+		return o.Name == name, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate through keys: %w", err)
+	}
+	if m == nil {
+		return nil, nil
+	}
+	return ser.AssertType(m)
+}
+
+// Reindex rebuilds the MediaOrders from all persisted Media and UserMedia,
+// returning the number of Media sorted.
+func (ser *MediaOrderService) Reindex(tx db.Tx) (int, error) {
+	// Deleted one by one, as deleting while iterating through the bucket
+	// skips some
+	old, err := ser.GetAll(nil, nil, tx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get MediaOrders: %w", err)
+	}
+	for _, o := range old {
+		err = ser.Delete(o.Meta.ID, tx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete MediaOrder %q: %w", o.Name, err)
+		}
+	}
+
+	mdList, err := ser.MediaService.GetAll(nil, nil, tx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get Media: %w", err)
+	}
+	umList, err := ser.UserMediaService.GetFilter(nil, nil, tx, func(um *models.UserMedia) bool {
+		return um.Score != nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get UserMedia: %w", err)
+	}
+	sums := map[int]int{}
+	scored := map[int]int{}
+	for _, um := range umList {
+		sums[um.MediaID] += *um.Score
+		scored[um.MediaID]++
+	}
+
+	orders := map[string]*models.MediaOrder{}
+	for _, name := range ser.Names() {
+		orders[name] = &models.MediaOrder{
+			Name: name, Entries: []models.MediaOrderEntry{}, Unkeyed: []int{},
+		}
+	}
+	for _, md := range mdList {
+		mID := md.Meta.ID
+		keys := ser.keysOf(md)
+		keys[MediaOrderScore] = nil
+		if n := scored[mID]; n > 0 {
+			keys[MediaOrderScore] = scoreOrderKey(float64(sums[mID]) / float64(n))
+		}
+		for name, key := range keys {
+			o := orders[name]
+			if key == nil {
+				o.Unkeyed = append(o.Unkeyed, mID)
+			} else {
+				o.Entries = append(o.Entries, models.MediaOrderEntry{MediaID: mID, Key: *key})
+			}
+		}
+	}
+	for name, o := range orders {
+		sort.Slice(o.Entries, func(i, j int) bool {
+			return entryBefore(o.Entries[i], o.Entries[j])
+		})
+		sort.Ints(o.Unkeyed)
+		_, err = ser.Create(o, tx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create MediaOrder %q: %w", name, err)
+		}
+	}
+	return len(mdList), nil
+}
+
+// List returns the Media in the MediaOrder of the given name, descending by
+// key if desc is true, paginated by first and skip, along with the number
+// of Media in the MediaOrder. The Media without a key come last either way.
+func (ser *MediaOrderService) List(
+	name string, desc bool, first *int, skip *int, tx db.Tx,
+) ([]*models.Media, int, error) {
+	known := false
+	for _, n := range ser.Names() {
+		known = known || n == name
+	}
+	if !known {
+		return nil, 0, fmt.Errorf("order %q: must be one of %s: %w",
+			name, strings.Join(ser.Names(), ", "), ErrInvalid)
+	}
+	o, err := ser.get(name, tx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if o == nil {
+		return []*models.Media{}, 0, nil
+	}
+
+	start, end := 0, o.Len()
+	if skip != nil && *skip > 0 {
+		start = *skip
+		if start > end {
+			start = end
+		}
+	}
+	if first != nil && *first >= 0 && start+*first < end {
+		end = start + *first
+	}
+	ids := make([]int, 0, end-start)
+	for i := start; i < end; i++ {
+		switch {
+		case i >= len(o.Entries):
+			ids = append(ids, o.Unkeyed[i-len(o.Entries)])
+		case desc:
+			ids = append(ids, o.Entries[len(o.Entries)-1-i].MediaID)
+		default:
+			ids = append(ids, o.Entries[i].MediaID)
+		}
+	}
+
+	list, err := ser.MediaService.GetByIDs(ids, tx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get Media: %w", err)
+	}
+	return list, o.Len(), nil
+}
+
+// Create persists the given MediaOrder.
+func (ser *MediaOrderService) Create(o *models.MediaOrder, tx db.Tx) (int, error) {
+	return tx.Database().Create(o, ser, tx)
+}
+
+// Update replaces the value of the MediaOrder with the given ID.
+func (ser *MediaOrderService) Update(o *models.MediaOrder, tx db.Tx) error {
+	return tx.Database().Update(o, ser, tx)
+}
+
+// Delete deletes the MediaOrder with the given ID.
+func (ser *MediaOrderService) Delete(id int, tx db.Tx) error {
+	return tx.Database().Delete(id, ser, tx)
+}
+
+// GetAll retrieves all persisted values of MediaOrder.
+func (ser *MediaOrderService) GetAll(
+	first *int, skip *int, tx db.Tx,
+) ([]*models.MediaOrder, error) {
+	vlist, err := tx.Database().GetAll(first, skip, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to MediaOrders: %w", err)
+	}
+	return list, nil
+}
+
+// Bucket returns the name of the bucket for MediaOrder.
+func (ser *MediaOrderService) Bucket() string {
+	return "MediaOrder"
+}
+
+// Clean cleans the given MediaOrder for storage.
+func (ser *MediaOrderService) Clean(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// Validate returns an error if the MediaOrder is not valid for the database.
+func (ser *MediaOrderService) Validate(m db.Model, _ db.Tx) error {
+	o, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	var verr ValidationError
+	if o.Name == "" {
+		verr.Add("Name", FieldRequired, "must not be empty")
+	}
+	return verr.Err()
+}
+
+// Initialize sets initial values for some properties.
+func (ser *MediaOrderService) Initialize(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistOldProperties maintains certain properties of the existing
+// MediaOrder in updates.
+func (ser *MediaOrderService) PersistOldProperties(_ db.Model, _ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistHooks returns the persistence hook functions.
+func (ser *MediaOrderService) PersistHooks() *db.PersistHooks {
+	return &ser.Hooks
+}
+
+// Marshal encodes the given MediaOrder for storage.
+func (ser *MediaOrderService) Marshal(m db.Model) ([]byte, error) {
+	o, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	v, err := db.Codecs.Encode(ser.Bucket(), o)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
+	}
+
+	return v, nil
+}
+
+// Unmarshal decodes the given record into MediaOrder.
+func (ser *MediaOrderService) Unmarshal(buf []byte) (db.Model, error) {
+	var o models.MediaOrder
+	err := db.Codecs.Decode(buf, &o)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
+	}
+	return &o, nil
+}
+
+// AssertType exposes the given db.Model as a MediaOrder.
+func (ser *MediaOrderService) AssertType(m db.Model) (*models.MediaOrder, error) {
+	if m == nil {
+		return nil, fmt.Errorf("model: %w", errNil)
+	}
+
+	o, ok := m.(*models.MediaOrder)
+	if !ok {
+		return nil, fmt.Errorf("model: %w", errors.New("not of MediaOrder type"))
+	}
+	return o, nil
+}
+
+// mapFromModel returns a list of MediaOrder type asserted from the given list
+// of db.Model.
+func (ser *MediaOrderService) mapFromModel(vlist []db.Model) ([]*models.MediaOrder, error) {
+	list := make([]*models.MediaOrder, len(vlist))
+	var err error
+	for i, v := range vlist {
+		list[i], err = ser.AssertType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,356 @@
+package data
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// AuthorizeOwner returns an error wrapping ErrUnauthorized unless the given
+// caller is the User with the given ID or an Admin. A nil caller is an
+// anonymous one.
+func AuthorizeOwner(caller *models.User, ownerID int) error {
+	if caller == nil {
+		return fmt.Errorf("no credentials given: %w", ErrUnauthorized)
+	}
+	if caller.Meta.ID != ownerID &&
+		!caller.Permissions.Role().Includes(models.RoleAdmin) {
+		return fmt.Errorf("owned by User with ID %d: %w", ownerID, ErrUnauthorized)
+	}
+	return nil
+}
+
+// AuthorizeViewAs returns an error wrapping ErrUnauthorized unless the
+// caller may view the data of the given scope of the User with the given ID,
+// by the privacy settings of that User.
+func (ser *UserService) AuthorizeViewAs(
+	caller *models.User, ownerID int, scope models.PrivacyScope, tx db.Tx,
+) error {
+	// Owners and Admins need not look up the settings
+	if AuthorizeOwner(caller, ownerID) == nil {
+		return nil
+	}
+
+	owner, err := ser.GetByID(ownerID, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get User by ID %d: %w", ownerID, err)
+	}
+
+	role := models.RoleAnonymous
+	if caller != nil {
+		role = caller.Permissions.Role()
+	}
+	if !owner.Privacy.Of(scope).Allows(role) {
+		return fmt.Errorf("data of User with ID %d: private: %w", ownerID, ErrUnauthorized)
+	}
+	return nil
+}
+
+// GetByIDAs retrieves the persisted UserMedia with the given ID, if the
+// caller may view the lists of its User.
+func (ser *UserMediaService) GetByIDAs(
+	caller *models.User, id int, tx db.Tx,
+) (*models.UserMedia, error) {
+	um, err := ser.GetByID(id, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ser.UserService.AuthorizeViewAs(caller, um.UserID, models.PrivacyLists, tx)
+	if err != nil {
+		return nil, err
+	}
+	return um, nil
+}
+
+// GetByUserAs retrieves the persisted UserMedia of the User with the given
+// ID, if the caller may view the lists of that User.
+func (ser *UserMediaService) GetByUserAs(
+	caller *models.User, uID int, first *int, skip *int, tx db.Tx,
+) ([]*models.UserMedia, error) {
+	err := ser.UserService.AuthorizeViewAs(caller, uID, models.PrivacyLists, tx)
+	if err != nil {
+		return nil, err
+	}
+	return ser.GetByUser(uID, first, skip, tx)
+}
+
+// getOwnedAs retrieves the persisted UserMedia with the given ID, if the
+// caller owns it.
+func (ser *UserMediaService) getOwnedAs(
+	caller *models.User, id int, tx db.Tx,
+) (*models.UserMedia, error) {
+	um, err := ser.GetByID(id, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = AuthorizeOwner(caller, um.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return um, nil
+}
+
+// CreateAs persists the given UserMedia on behalf of the caller, who must own
+// it.
+func (ser *UserMediaService) CreateAs(
+	caller *models.User, um *models.UserMedia, tx db.Tx,
+) (int, error) {
+	err := AuthorizeOwner(caller, um.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return ser.Create(um, tx)
+}
+
+// UpdateAs replaces the value of the UserMedia with the given ID on behalf of
+// the caller, who must own both the existing and the new value, so that
+// UserMedia cannot be moved between Users.
+func (ser *UserMediaService) UpdateAs(
+	caller *models.User, um *models.UserMedia, tx db.Tx,
+) error {
+	_, err := ser.getOwnedAs(caller, um.Meta.ID, tx)
+	if err != nil {
+		return err
+	}
+
+	err = AuthorizeOwner(caller, um.UserID)
+	if err != nil {
+		return err
+	}
+	return ser.Update(um, tx)
+}
+
+// DeleteAs deletes the UserMedia with the given ID on behalf of the caller,
+// who must own it.
+func (ser *UserMediaService) DeleteAs(caller *models.User, id int, tx db.Tx) error {
+	_, err := ser.getOwnedAs(caller, id, tx)
+	if err != nil {
+		return err
+	}
+	return ser.Delete(id, tx)
+}
+
+// ScrobbleAs stitches the given playback event into the UserMedia of its User
+// on behalf of the caller, who must be that User.
+func (ser *UserMediaService) ScrobbleAs(
+	caller *models.User, s *models.Scrobble, tx db.Tx,
+) (*models.UserMedia, error) {
+	err := AuthorizeOwner(caller, s.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return ser.Scrobble(s, tx)
+}
+
+// PlayAs stitches the given playback event into the UserMedia of its User on
+// behalf of the caller, who must be that User.
+func (ser *UserMediaService) PlayAs(
+	caller *models.User, e *models.PlaybackEvent, tx db.Tx,
+) (*models.UserMedia, error) {
+	err := AuthorizeOwner(caller, e.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return ser.Play(e, tx)
+}
+
+// ReportProgressAs stitches the given report of progress into the UserMedia of its
+// User on behalf of the caller, who must be that User.
+func (ser *UserMediaService) ReportProgressAs(
+	caller *models.User, p *models.ProgressReport, tx db.Tx,
+) (*models.UserMedia, error) {
+	err := AuthorizeOwner(caller, p.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return ser.ReportProgress(p, tx)
+}
+
+// StartRewatchAs starts a rewatch of the Media with the given ID by the User
+// with the given ID on behalf of the caller, who must be that User.
+func (ser *UserMediaService) StartRewatchAs(
+	caller *models.User, uID int, mID int, t time.Time, tx db.Tx,
+) (*models.UserMedia, error) {
+	err := AuthorizeOwner(caller, uID)
+	if err != nil {
+		return nil, err
+	}
+	return ser.StartRewatch(uID, mID, t, tx)
+}
+
+// GetByIDAs retrieves the persisted UserMediaList with the given ID, if the
+// caller may view the lists of its User.
+func (ser *UserMediaListService) GetByIDAs(
+	caller *models.User, id int, tx db.Tx,
+) (*models.UserMediaList, error) {
+	uml, err := ser.GetByID(id, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ser.UserService.AuthorizeViewAs(caller, uml.UserID, models.PrivacyLists, tx)
+	if err != nil {
+		return nil, err
+	}
+	return uml, nil
+}
+
+// getOwnedAs retrieves the persisted UserMediaList with the given ID, if the
+// caller owns it.
+func (ser *UserMediaListService) getOwnedAs(
+	caller *models.User, id int, tx db.Tx,
+) (*models.UserMediaList, error) {
+	uml, err := ser.GetByID(id, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = AuthorizeOwner(caller, uml.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return uml, nil
+}
+
+// CreateAs persists the given UserMediaList on behalf of the caller, who must
+// own it and all the UserMedia in it.
+func (ser *UserMediaListService) CreateAs(
+	caller *models.User, uml *models.UserMediaList, tx db.Tx,
+) (int, error) {
+	err := ser.authorizeWrite(caller, uml, tx)
+	if err != nil {
+		return 0, err
+	}
+	return ser.Create(uml, tx)
+}
+
+// UpdateAs replaces the value of the UserMediaList with the given ID on
+// behalf of the caller, who must own both the existing and the new value and
+// all the UserMedia in it.
+func (ser *UserMediaListService) UpdateAs(
+	caller *models.User, uml *models.UserMediaList, tx db.Tx,
+) error {
+	_, err := ser.getOwnedAs(caller, uml.Meta.ID, tx)
+	if err != nil {
+		return err
+	}
+
+	err = ser.authorizeWrite(caller, uml, tx)
+	if err != nil {
+		return err
+	}
+	return ser.Update(uml, tx)
+}
+
+// ReorderAs changes the sections and order of the entries of the
+// UserMediaList with the given ID on behalf of the caller, who must own it.
+// See Reorder.
+func (ser *UserMediaListService) ReorderAs(
+	caller *models.User, id int, sections []models.UserMediaListSection,
+	moves []models.UserMediaListMove, tx db.Tx,
+) (*models.UserMediaList, error) {
+	uml, err := ser.getOwnedAs(caller, id, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ser.Reorder(uml, sections, moves, tx)
+	if err != nil {
+		return nil, err
+	}
+	return uml, nil
+}
+
+// DeleteAs deletes the UserMediaList with the given ID on behalf of the
+// caller, who must own it.
+func (ser *UserMediaListService) DeleteAs(caller *models.User, id int, tx db.Tx) error {
+	_, err := ser.getOwnedAs(caller, id, tx)
+	if err != nil {
+		return err
+	}
+	return ser.Delete(id, tx)
+}
+
+// authorizeWrite checks that the caller owns the given UserMediaList and
+// that the UserMedia in it belong to the same User.
+func (ser *UserMediaListService) authorizeWrite(
+	caller *models.User, uml *models.UserMediaList, tx db.Tx,
+) error {
+	err := AuthorizeOwner(caller, uml.UserID)
+	if err != nil {
+		return err
+	}
+
+	for _, umID := range uml.UserMedia {
+		um, err := ser.UserMediaService.GetByID(umID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get UserMedia by ID %d: %w", umID, err)
+		}
+		if um.UserID != uml.UserID {
+			return fmt.Errorf("UserMedia with ID %d: owned by another User: %w",
+				umID, ErrUnauthorized)
+		}
+	}
+	return nil
+}
+
+// ScoreFormatOf returns the ScoreFormat the caller gives and reads scores in.
+// Anonymous callers read scores on the stored scale.
+func ScoreFormatOf(caller *models.User) models.ScoreFormat {
+	if caller == nil {
+		return models.ScoreFormatPoint100
+	}
+	return caller.ScoreFormat
+}
+
+// NormalizeScoreAs converts the given score in the ScoreFormat of the caller
+// to the stored scale. It returns an error wrapping ErrInvalid if the score
+// is out of the range of the ScoreFormat.
+func NormalizeScoreAs(caller *models.User, score *int) (*int, error) {
+	n, err := ScoreFormatOf(caller).Normalize(score)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, ErrInvalid)
+	}
+	return n, nil
+}
+
+// GetByUserMediaAs retrieves the watch states of the Episodes of the Media
+// with the given ID by the User with the given ID, if the caller may view the
+// lists of that User.
+func (ser *UserEpisodeService) GetByUserMediaAs(
+	caller *models.User, uID int, mID int, tx db.Tx,
+) ([]*models.UserEpisode, error) {
+	err := ser.UserService.AuthorizeViewAs(caller, uID, models.PrivacyLists, tx)
+	if err != nil {
+		return nil, err
+	}
+	return ser.GetByUserMedia(uID, mID, tx)
+}
+
+// MarkWatchedAs marks the Episodes of the given EpisodeMark watched on behalf
+// of the caller, who must be its User.
+func (ser *UserEpisodeService) MarkWatchedAs(
+	caller *models.User, mk *models.EpisodeMark, tx db.Tx,
+) (*models.UserMedia, []*models.UserEpisode, error) {
+	err := AuthorizeOwner(caller, mk.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ser.MarkWatched(mk, tx)
+}
+
+// MarkUnwatchedAs marks the Episode with the given ID unwatched by the User
+// with the given ID on behalf of the caller, who must be that User.
+func (ser *UserEpisodeService) MarkUnwatchedAs(
+	caller *models.User, uID int, mID int, epID int, tx db.Tx,
+) (*models.UserMedia, []*models.UserEpisode, error) {
+	err := AuthorizeOwner(caller, uID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ser.MarkUnwatched(uID, mID, epID, tx)
+}
@@ -0,0 +1,278 @@
+package data
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// passwordResetTokenSize is the number of random bytes in password reset
+// tokens.
+const passwordResetTokenSize = 32
+
+// PasswordResetService performs operations on PasswordReset.
+type PasswordResetService struct {
+	UserService *UserService
+	Hooks       db.PersistHooks
+}
+
+// NewPasswordResetService returns a PasswordResetService.
+func NewPasswordResetService(
+	hooks db.PersistHooks, userService *UserService,
+) *PasswordResetService {
+	// Initialize PasswordResetService
+	passwordResetService := &PasswordResetService{
+		UserService: userService,
+		Hooks:       hooks,
+	}
+
+	// Add hook to delete PasswordReset on User deletion
+	deletePasswordResetOnDeleteUser := func(um db.Model, _ db.Service, tx db.Tx) error {
+		uID := um.Metadata().ID
+		err := passwordResetService.DeleteByUser(uID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to delete PasswordReset by User ID %d: %w", uID, err)
+		}
+		return nil
+	}
+	uSerHooks := userService.PersistHooks()
+	uSerHooks.PreDeleteHooks =
+		append(uSerHooks.PreDeleteHooks, deletePasswordResetOnDeleteUser)
+
+	return passwordResetService
+}
+
+// Request starts a reset of the password of the User with the given ID,
+// replacing any pending one, valid until the given time. It returns the token
+// to redeem the reset with.
+func (ser *PasswordResetService) Request(
+	uID int, expiresAt time.Time, tx db.Tx,
+) (string, error) {
+	buf := make([]byte, passwordResetTokenSize)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+
+	err = ser.DeleteByUser(uID, tx)
+	if err != nil {
+		return "", fmt.Errorf("failed to delete PasswordResets by User ID %d: %w", uID, err)
+	}
+	_, err = ser.Create(&models.PasswordReset{
+		UserID:    uID,
+		TokenHash: hashPasswordResetToken(token),
+		ExpiresAt: expiresAt,
+	}, tx)
+	if err != nil {
+		return "", fmt.Errorf("failed to create PasswordReset: %w", err)
+	}
+	return token, nil
+}
+
+// Redeem replaces the password of the User of the pending reset with the
+// given token, if it has not expired by the given time, and ends the reset.
+// It returns an error wrapping ErrUnauthorized if there is no such reset.
+func (ser *PasswordResetService) Redeem(
+	token string, password string, now time.Time, tx db.Tx,
+) error {
+	hash := hashPasswordResetToken(token)
+	list, err := ser.GetFilter(nil, nil, tx, func(pr *models.PasswordReset) bool {
+		return bytes.Equal(pr.TokenHash, hash)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get PasswordResets: %w", err)
+	}
+	if len(list) == 0 || now.After(list[0].ExpiresAt) {
+		return fmt.Errorf("password reset token: invalid or expired: %w", ErrUnauthorized)
+	}
+
+	pr := list[0]
+	err = ser.UserService.ChangePassword(pr.UserID, password, tx)
+	if err != nil {
+		return fmt.Errorf("failed to change password of User with ID %d: %w", pr.UserID, err)
+	}
+	err = ser.DeleteByUser(pr.UserID, tx)
+	if err != nil {
+		return fmt.Errorf("failed to delete PasswordResets by User ID %d: %w", pr.UserID, err)
+	}
+	return nil
+}
+
+// hashPasswordResetToken returns the stored hash of the given token.
+func hashPasswordResetToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
+
+// Create persists the given PasswordReset.
+func (ser *PasswordResetService) Create(pr *models.PasswordReset, tx db.Tx) (int, error) {
+	return tx.Database().Create(pr, ser, tx)
+}
+
+// Delete deletes the PasswordReset with the given ID.
+func (ser *PasswordResetService) Delete(id int, tx db.Tx) error {
+	return tx.Database().Delete(id, ser, tx)
+}
+
+// DeleteByUser deletes the PasswordResets of the User with the given ID.
+func (ser *PasswordResetService) DeleteByUser(uID int, tx db.Tx) error {
+	return tx.Database().DeleteFilter(ser, tx, func(m db.Model) bool {
+		pr, err := ser.AssertType(m)
+		if err != nil {
+			return false
+		}
+		return pr.UserID == uID
+	})
+}
+
+// GetFilter retrieves all persisted values of PasswordReset that pass the
+// filter.
+func (ser *PasswordResetService) GetFilter(
+	first *int, skip *int, tx db.Tx, keep func(pr *models.PasswordReset) bool,
+) ([]*models.PasswordReset, error) {
+	vlist, err := tx.Database().GetFilter(first, skip, ser, tx,
+		func(m db.Model) bool {
+			pr, err := ser.AssertType(m)
+			if err != nil {
+				return false
+			}
+			return keep(pr)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to PasswordResets: %w", err)
+	}
+	return list, nil
+}
+
+// GetAll retrieves all persisted values of PasswordReset.
+func (ser *PasswordResetService) GetAll(
+	first *int, skip *int, tx db.Tx,
+) ([]*models.PasswordReset, error) {
+	vlist, err := tx.Database().GetAll(first, skip, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to PasswordResets: %w", err)
+	}
+	return list, nil
+}
+
+// Bucket returns the name of the bucket for PasswordReset.
+func (ser *PasswordResetService) Bucket() string {
+	return "PasswordReset"
+}
+
+// Clean cleans the given PasswordReset for storage.
+func (ser *PasswordResetService) Clean(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// Validate returns an error if the PasswordReset is not valid for the
+// database.
+func (ser *PasswordResetService) Validate(m db.Model, tx db.Tx) error {
+	e, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	var verr ValidationError
+	ValidateTags(e, &verr)
+	err = verr.Err()
+	if err != nil {
+		return err
+	}
+
+	// Check if User with ID specified in PasswordReset exists
+	_, err = tx.Database().GetRawByID(e.UserID, ser.UserService, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get User with ID %d: %w", e.UserID, err)
+	}
+
+	return nil
+}
+
+// Initialize sets initial values for some properties.
+func (ser *PasswordResetService) Initialize(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistOldProperties maintains certain properties of the existing
+// PasswordReset in updates.
+func (ser *PasswordResetService) PersistOldProperties(_ db.Model, _ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistHooks returns the persistence hook functions.
+func (ser *PasswordResetService) PersistHooks() *db.PersistHooks {
+	return &ser.Hooks
+}
+
+// Marshal encodes the given PasswordReset for storage.
+func (ser *PasswordResetService) Marshal(m db.Model) ([]byte, error) {
+	pr, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	v, err := db.Codecs.Encode(ser.Bucket(), pr)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
+	}
+
+	return v, nil
+}
+
+// Unmarshal decodes the given record into PasswordReset.
+func (ser *PasswordResetService) Unmarshal(buf []byte) (db.Model, error) {
+	var pr models.PasswordReset
+	err := db.Codecs.Decode(buf, &pr)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
+	}
+	return &pr, nil
+}
+
+// AssertType exposes the given db.Model as a PasswordReset.
+func (ser *PasswordResetService) AssertType(m db.Model) (*models.PasswordReset, error) {
+	if m == nil {
+		return nil, fmt.Errorf("model: %w", errNil)
+	}
+
+	pr, ok := m.(*models.PasswordReset)
+	if !ok {
+		return nil, fmt.Errorf("model: %w", errors.New("not of PasswordReset type"))
+	}
+	return pr, nil
+}
+
+// mapFromModel returns a list of PasswordReset type asserted from the given
+// list of db.Model.
+func (ser *PasswordResetService) mapFromModel(
+	vlist []db.Model,
+) ([]*models.PasswordReset, error) {
+	list := make([]*models.PasswordReset, len(vlist))
+	var err error
+	for i, v := range vlist {
+		list[i], err = ser.AssertType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,217 @@
+package data
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// PersistedQueryService performs operations on PersistedQuery.
+type PersistedQueryService struct {
+	Hooks db.PersistHooks
+}
+
+// HashQuery returns the hex-encoded SHA-256 hash that a query document is
+// persisted by.
+func HashQuery(query string) string {
+	hash := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(hash[:])
+}
+
+// Store persists the given query document by its hash, if not already
+// persisted, and returns the PersistedQuery. If registered is true, the query
+// is marked as registered.
+func (ser *PersistedQueryService) Store(
+	query string, registered bool, tx db.Tx,
+) (*models.PersistedQuery, error) {
+	hash := HashQuery(query)
+	pq, err := ser.GetByHash(hash, tx)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("failed to get PersistedQuery by hash %q: %w", hash, err)
+	}
+
+	if pq == nil {
+		pq = &models.PersistedQuery{Hash: hash, Query: query, Registered: registered}
+		_, err = ser.Create(pq, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create PersistedQuery: %w", err)
+		}
+		return pq, nil
+	}
+
+	if registered && !pq.Registered {
+		pq.Registered = true
+		err = ser.Update(pq, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to register PersistedQuery with ID %d: %w",
+				pq.Meta.ID, err)
+		}
+	}
+	return pq, nil
+}
+
+// Create persists the given PersistedQuery.
+func (ser *PersistedQueryService) Create(pq *models.PersistedQuery, tx db.Tx) (int, error) {
+	return tx.Database().Create(pq, ser, tx)
+}
+
+// Update replaces the value of the PersistedQuery with the given ID.
+func (ser *PersistedQueryService) Update(pq *models.PersistedQuery, tx db.Tx) error {
+	return tx.Database().Update(pq, ser, tx)
+}
+
+// Delete deletes the PersistedQuery with the given ID.
+func (ser *PersistedQueryService) Delete(id int, tx db.Tx) error {
+	return tx.Database().Delete(id, ser, tx)
+}
+
+// GetByHash retrieves the persisted PersistedQuery with the given hash.
+func (ser *PersistedQueryService) GetByHash(
+	hash string, tx db.Tx,
+) (*models.PersistedQuery, error) {
+	m, err := tx.Database().FindFirst(ser, tx, func(m db.Model) (bool, error) {
+		pq, err := ser.AssertType(m)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+		return pq.Hash == hash, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate through keys: %w", err)
+	}
+	if m == nil {
+		return nil, fmt.Errorf("PersistedQuery with hash %q: %w", hash, ErrNotFound)
+	}
+
+	pq, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return pq, nil
+}
+
+// GetAll retrieves all persisted values of PersistedQuery.
+func (ser *PersistedQueryService) GetAll(
+	first *int, skip *int, tx db.Tx,
+) ([]*models.PersistedQuery, error) {
+	vlist, err := tx.Database().GetAll(first, skip, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to PersistedQueries: %w", err)
+	}
+	return list, nil
+}
+
+// Bucket returns the name of the bucket for PersistedQuery.
+func (ser *PersistedQueryService) Bucket() string {
+	return "PersistedQuery"
+}
+
+// Clean cleans the given PersistedQuery for storage.
+func (ser *PersistedQueryService) Clean(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// Validate returns an error if the PersistedQuery is not valid for the
+// database.
+func (ser *PersistedQueryService) Validate(m db.Model, _ db.Tx) error {
+	e, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	var verr ValidationError
+	ValidateTags(e, &verr)
+	if e.Query != "" && e.Hash != HashQuery(e.Query) {
+		verr.Addf("Hash", FieldInvalid, "%q: does not match query", e.Hash)
+	}
+	return verr.Err()
+}
+
+// UniqueKey returns the key by which a PersistedQuery must be unique, its
+// hash.
+func (ser *PersistedQueryService) UniqueKey(m db.Model) (string, error) {
+	e, err := ser.AssertType(m)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return e.Hash, nil
+}
+
+// Initialize sets initial values for some properties.
+func (ser *PersistedQueryService) Initialize(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistOldProperties maintains certain properties of the existing
+// PersistedQuery in updates.
+func (ser *PersistedQueryService) PersistOldProperties(_ db.Model, _ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistHooks returns the persistence hook functions.
+func (ser *PersistedQueryService) PersistHooks() *db.PersistHooks {
+	return &ser.Hooks
+}
+
+// Marshal encodes the given PersistedQuery for storage.
+func (ser *PersistedQueryService) Marshal(m db.Model) ([]byte, error) {
+	pq, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	v, err := db.Codecs.Encode(ser.Bucket(), pq)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
+	}
+
+	return v, nil
+}
+
+// Unmarshal decodes the given record into PersistedQuery.
+func (ser *PersistedQueryService) Unmarshal(buf []byte) (db.Model, error) {
+	var pq models.PersistedQuery
+	err := db.Codecs.Decode(buf, &pq)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
+	}
+	return &pq, nil
+}
+
+// AssertType exposes the given db.Model as a PersistedQuery.
+func (ser *PersistedQueryService) AssertType(m db.Model) (*models.PersistedQuery, error) {
+	if m == nil {
+		return nil, fmt.Errorf("model: %w", errNil)
+	}
+
+	pq, ok := m.(*models.PersistedQuery)
+	if !ok {
+		return nil, fmt.Errorf("model: %w", errors.New("not of PersistedQuery type"))
+	}
+	return pq, nil
+}
+
+// mapFromModel returns a list of PersistedQuery type asserted from the given
+// list of db.Model.
+func (ser *PersistedQueryService) mapFromModel(
+	vlist []db.Model,
+) ([]*models.PersistedQuery, error) {
+	list := make([]*models.PersistedQuery, len(vlist))
+	var err error
+	for i, v := range vlist {
+		list[i], err = ser.AssertType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+	}
+	return list, nil
+}
@@ -6,7 +6,6 @@ import (
 
 	"github.com/Dophin2009/nao/pkg/models"
 	"github.com/Dophin2009/nao/pkg/db"
-	json "github.com/json-iterator/go"
 )
 
 // TODO: User rating/favoriting/comments/etc. of Persons
@@ -14,6 +13,11 @@ import (
 // PersonService performs operations on Persons.
 type PersonService struct {
 	Hooks db.PersistHooks
+	// SlugService indexes the People by their Slugs; Slugs are only generated
+	// if nil.
+	SlugService *SlugService
+	// NameService indexes the People by their names for search.
+	NameService *NameService
 }
 
 // NewPersonService returns a PersonService.
@@ -113,27 +117,63 @@ func (ser *PersonService) GetByID(id int, tx db.Tx) (*models.Person, error) {
 	return p, nil
 }
 
+// GetBySlug retrieves the persisted Person with the given Slug.
+func (ser *PersonService) GetBySlug(slug string, tx db.Tx) (*models.Person, error) {
+	id, err := ser.SlugService.ID(ser.Bucket(), slug, tx)
+	if err != nil {
+		return nil, err
+	}
+	return ser.GetByID(id, tx)
+}
+
+// Search retrieves the persisted People with a name matching the given query,
+// at most first if not nil, by NameService.Search.
+func (ser *PersonService) Search(query string, first *int, tx db.Tx) ([]*models.Person, error) {
+	ids, err := ser.NameService.Search(ser.Bucket(), query, first, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*models.Person, len(ids))
+	for i, id := range ids {
+		list[i], err = ser.GetByID(id, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Person with ID %d: %w", id, err)
+		}
+	}
+	return list, nil
+}
+
 // Bucket returns the name of the bucket for Person.
 func (ser *PersonService) Bucket() string {
 	return "Person"
 }
 
 // Clean cleans the given Person for storage.
-func (ser *PersonService) Clean(m db.Model, _ db.Tx) error {
-	_, err := ser.AssertType(m)
+func (ser *PersonService) Clean(m db.Model, tx db.Tx) error {
+	e, err := ser.AssertType(m)
 	if err != nil {
 		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
-	return nil
+	err = cleanTitles(e.Names, e.Information)
+	if err != nil {
+		return err
+	}
+
+	e.Slug, err = ser.SlugService.clean(ser.Bucket(), e.Meta.ID, e.Slug, e.Names, tx)
+	return err
 }
 
 // Validate returns an error if the Person is not valid for the database.
 func (ser *PersonService) Validate(m db.Model, _ db.Tx) error {
-	_, err := ser.AssertType(m)
+	e, err := ser.AssertType(m)
 	if err != nil {
 		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
-	return nil
+
+	var verr ValidationError
+	ValidateTags(e, &verr)
+	return verr.Err()
 }
 
 // Initialize sets initial values for some properties.
@@ -152,27 +192,27 @@ func (ser *PersonService) PersistHooks() *db.PersistHooks {
 	return &ser.Hooks
 }
 
-// Marshal transforms the given Person into JSON.
+// Marshal encodes the given Person for storage.
 func (ser *PersonService) Marshal(m db.Model) ([]byte, error) {
 	p, err := ser.AssertType(m)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
-	v, err := json.Marshal(p)
+	v, err := db.Codecs.Encode(ser.Bucket(), p)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONMarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
 	}
 
 	return v, nil
 }
 
-// Unmarshal parses the given JSON into Person.
+// Unmarshal decodes the given record into Person.
 func (ser *PersonService) Unmarshal(buf []byte) (db.Model, error) {
 	var p models.Person
-	err := json.Unmarshal(buf, &p)
+	err := db.Codecs.Decode(buf, &p)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONUnmarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
 	}
 	return &p, nil
 }
@@ -3,16 +3,17 @@ package data
 import (
 	"errors"
 	"fmt"
-	"strings"
 
 	"github.com/Dophin2009/nao/pkg/models"
 	"github.com/Dophin2009/nao/pkg/db"
-	json "github.com/json-iterator/go"
 )
 
 // ProducerService performs operations on Producer.
 type ProducerService struct {
 	Hooks db.PersistHooks
+	// SlugService indexes the Producers by their Slugs; Slugs are only generated
+	// if nil.
+	SlugService *SlugService
 }
 
 // NewProducerService returns a ProducerService.
@@ -112,31 +113,41 @@ func (ser *ProducerService) GetByID(id int, tx db.Tx) (*models.Producer, error)
 	return p, nil
 }
 
+// GetBySlug retrieves the persisted Producer with the given Slug.
+func (ser *ProducerService) GetBySlug(slug string, tx db.Tx) (*models.Producer, error) {
+	id, err := ser.SlugService.ID(ser.Bucket(), slug, tx)
+	if err != nil {
+		return nil, err
+	}
+	return ser.GetByID(id, tx)
+}
+
 // Bucket returns the name of the bucket for Producer.
 func (ser *ProducerService) Bucket() string {
 	return "Producer"
 }
 
 // Clean cleans the given Producer for storage.
-func (ser *ProducerService) Clean(m db.Model, _ db.Tx) error {
+func (ser *ProducerService) Clean(m db.Model, tx db.Tx) error {
 	e, err := ser.AssertType(m)
 	if err != nil {
 		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
-	for i, t := range e.Types {
-		e.Types[i] = strings.Trim(t, " ")
-	}
-	return nil
+	e.Slug, err = ser.SlugService.clean(ser.Bucket(), e.Meta.ID, e.Slug, e.Titles, tx)
+	return err
 }
 
 // Validate returns an error if the Producer is not valid for the database.
 func (ser *ProducerService) Validate(m db.Model, _ db.Tx) error {
-	_, err := ser.AssertType(m)
+	e, err := ser.AssertType(m)
 	if err != nil {
 		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
-	return nil
+
+	var verr ValidationError
+	ValidateTags(e, &verr)
+	return verr.Err()
 }
 
 // Initialize sets initial values for some properties.
@@ -155,27 +166,27 @@ func (ser *ProducerService) PersistHooks() *db.PersistHooks {
 	return &ser.Hooks
 }
 
-// Marshal transforms the given Producer into JSON.
+// Marshal encodes the given Producer for storage.
 func (ser *ProducerService) Marshal(m db.Model) ([]byte, error) {
 	p, err := ser.AssertType(m)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
-	v, err := json.Marshal(p)
+	v, err := db.Codecs.Encode(ser.Bucket(), p)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONMarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
 	}
 
 	return v, nil
 }
 
-// Unmarshal parses the given JSON into Producer.
+// Unmarshal decodes the given record into Producer.
 func (ser *ProducerService) Unmarshal(buf []byte) (db.Model, error) {
 	var p models.Producer
-	err := json.Unmarshal(buf, &p)
+	err := db.Codecs.Decode(buf, &p)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONUnmarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
 	}
 	return &p, nil
 }
@@ -0,0 +1,284 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// ProducerStaffService performs operations on ProducerStaff.
+type ProducerStaffService struct {
+	ProducerService *ProducerService
+	PersonService   *PersonService
+	Hooks           db.PersistHooks
+}
+
+// NewProducerStaffService returns a ProducerStaffService.
+func NewProducerStaffService(hooks db.PersistHooks, producerService *ProducerService,
+	personService *PersonService) *ProducerStaffService {
+	// Initialize ProducerStaffService
+	producerStaffService := &ProducerStaffService{
+		ProducerService: producerService,
+		PersonService:   personService,
+		Hooks:           hooks,
+	}
+
+	// Add hook to delete ProducerStaff on Producer deletion
+	deleteProducerStaffOnDeleteProducer := func(pd db.Model, _ db.Service, tx db.Tx) error {
+		pID := pd.Metadata().ID
+		err := producerStaffService.DeleteByProducer(pID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to delete ProducerStaff by Producer ID %d: %w",
+				pID, err)
+		}
+		return nil
+	}
+	pdSerHooks := producerService.PersistHooks()
+	pdSerHooks.PreDeleteHooks =
+		append(pdSerHooks.PreDeleteHooks, deleteProducerStaffOnDeleteProducer)
+
+	// Add hook to delete ProducerStaff on Person deletion
+	deleteProducerStaffOnDeletePerson := func(p db.Model, _ db.Service, tx db.Tx) error {
+		pID := p.Metadata().ID
+		err := producerStaffService.DeleteByPerson(pID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to delete ProducerStaff by Person ID %d: %w",
+				pID, err)
+		}
+		return nil
+	}
+	pSerHooks := personService.PersistHooks()
+	pSerHooks.PreDeleteHooks =
+		append(pSerHooks.PreDeleteHooks, deleteProducerStaffOnDeletePerson)
+
+	return producerStaffService
+}
+
+// Create persists the given ProducerStaff.
+func (ser *ProducerStaffService) Create(ps *models.ProducerStaff, tx db.Tx) (int, error) {
+	return tx.Database().Create(ps, ser, tx)
+}
+
+// Update replaces the value of the ProducerStaff with the given ID.
+func (ser *ProducerStaffService) Update(ps *models.ProducerStaff, tx db.Tx) error {
+	return tx.Database().Update(ps, ser, tx)
+}
+
+// Delete deletes the ProducerStaff with the given ID.
+func (ser *ProducerStaffService) Delete(id int, tx db.Tx) error {
+	return tx.Database().Delete(id, ser, tx)
+}
+
+// DeleteByProducer deletes the ProducerStaff with the given Producer ID.
+func (ser *ProducerStaffService) DeleteByProducer(pID int, tx db.Tx) error {
+	return tx.Database().DeleteFilter(ser, tx, func(m db.Model) bool {
+		ps, err := ser.AssertType(m)
+		if err != nil {
+			return false
+		}
+
+		return ps.ProducerID == pID
+	})
+}
+
+// DeleteByPerson deletes the ProducerStaff with the given Person ID.
+func (ser *ProducerStaffService) DeleteByPerson(pID int, tx db.Tx) error {
+	return tx.Database().DeleteFilter(ser, tx, func(m db.Model) bool {
+		ps, err := ser.AssertType(m)
+		if err != nil {
+			return false
+		}
+
+		return ps.PersonID == pID
+	})
+}
+
+// GetAll retrieves all persisted values of ProducerStaff.
+func (ser *ProducerStaffService) GetAll(
+	first *int, skip *int, tx db.Tx,
+) ([]*models.ProducerStaff, error) {
+	vlist, err := tx.Database().GetAll(first, skip, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to ProducerStaff: %w", err)
+	}
+	return list, nil
+}
+
+// GetFilter retrieves all persisted values of ProducerStaff that pass the
+// filter.
+func (ser *ProducerStaffService) GetFilter(
+	first *int, skip *int, tx db.Tx, keep func(ps *models.ProducerStaff) bool,
+) ([]*models.ProducerStaff, error) {
+	vlist, err := tx.Database().GetFilter(first, skip, ser, tx,
+		func(m db.Model) bool {
+			ps, err := ser.AssertType(m)
+			if err != nil {
+				return false
+			}
+			return keep(ps)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to ProducerStaff: %w", err)
+	}
+	return list, nil
+}
+
+// GetByID retrieves the persisted ProducerStaff with the given ID.
+func (ser *ProducerStaffService) GetByID(id int, tx db.Tx) (*models.ProducerStaff, error) {
+	m, err := tx.Database().GetByID(id, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	ps, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return ps, nil
+}
+
+// GetByProducer retrieves a list of instances of ProducerStaff with the given
+// Producer ID, that is, the staff of that Producer.
+func (ser *ProducerStaffService) GetByProducer(
+	pID int, first *int, skip *int, tx db.Tx,
+) ([]*models.ProducerStaff, error) {
+	return ser.GetFilter(first, skip, tx, func(ps *models.ProducerStaff) bool {
+		return ps.ProducerID == pID
+	})
+}
+
+// GetByPerson retrieves a list of instances of ProducerStaff with the given
+// Person ID, that is, the Producers that Person has worked at.
+func (ser *ProducerStaffService) GetByPerson(
+	pID int, first *int, skip *int, tx db.Tx,
+) ([]*models.ProducerStaff, error) {
+	return ser.GetFilter(first, skip, tx, func(ps *models.ProducerStaff) bool {
+		return ps.PersonID == pID
+	})
+}
+
+// Bucket returns the name of the bucket for ProducerStaff.
+func (ser *ProducerStaffService) Bucket() string {
+	return "ProducerStaff"
+}
+
+// Clean cleans the given ProducerStaff for storage.
+func (ser *ProducerStaffService) Clean(m db.Model, _ db.Tx) error {
+	_, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return nil
+}
+
+// Validate returns an error if the ProducerStaff is not valid for the
+// database.
+func (ser *ProducerStaffService) Validate(m db.Model, tx db.Tx) error {
+	e, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	var verr ValidationError
+	ValidateTags(e, &verr)
+	err = verr.Err()
+	if err != nil {
+		return err
+	}
+
+	db := tx.Database()
+
+	// Check if Producer with ID specified in new ProducerStaff exists
+	_, err = db.GetRawByID(e.ProducerID, ser.ProducerService, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get Producer with ID %d: %w", e.ProducerID, err)
+	}
+
+	// Check if Person with ID specified in new ProducerStaff exists
+	_, err = db.GetRawByID(e.PersonID, ser.PersonService, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get Person with ID %d: %w", e.PersonID, err)
+	}
+
+	return nil
+}
+
+// Initialize sets initial values for some properties.
+func (ser *ProducerStaffService) Initialize(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistOldProperties maintains certain properties of the existing
+// ProducerStaff in updates.
+func (ser *ProducerStaffService) PersistOldProperties(_ db.Model, _ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistHooks returns the persistence hook functions.
+func (ser *ProducerStaffService) PersistHooks() *db.PersistHooks {
+	return &ser.Hooks
+}
+
+// Marshal encodes the given ProducerStaff for storage.
+func (ser *ProducerStaffService) Marshal(m db.Model) ([]byte, error) {
+	ps, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	v, err := db.Codecs.Encode(ser.Bucket(), ps)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
+	}
+
+	return v, nil
+}
+
+// Unmarshal decodes the given record into ProducerStaff.
+func (ser *ProducerStaffService) Unmarshal(buf []byte) (db.Model, error) {
+	var ps models.ProducerStaff
+	err := db.Codecs.Decode(buf, &ps)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
+	}
+	return &ps, nil
+}
+
+// AssertType exposes the given db.Model as a ProducerStaff.
+func (ser *ProducerStaffService) AssertType(m db.Model) (*models.ProducerStaff, error) {
+	if m == nil {
+		return nil, fmt.Errorf("model: %w", errNil)
+	}
+
+	ps, ok := m.(*models.ProducerStaff)
+	if !ok {
+		return nil, fmt.Errorf("model: %w", errors.New("not of ProducerStaff type"))
+	}
+	return ps, nil
+}
+
+// mapFromModel returns a list of ProducerStaff type asserted from the given
+// list of db.Model.
+func (ser *ProducerStaffService) mapFromModel(vlist []db.Model) ([]*models.ProducerStaff, error) {
+	list := make([]*models.ProducerStaff, len(vlist))
+	var err error
+	for i, v := range vlist {
+		list[i], err = ser.AssertType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+	}
+	return list, nil
+}
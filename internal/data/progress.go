@@ -0,0 +1,181 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// mediaUnits contains some Media and its Episodes, split into regular and
+// special Episodes in watch order.
+type mediaUnits struct {
+	media    *models.Media
+	regular  []*models.Episode
+	specials []*models.Episode
+}
+
+// singleUnit returns true if the Media is watched as a single unit.
+func (u *mediaUnits) singleUnit() bool {
+	return u.media.IsSingleUnit() || (len(u.regular) == 1 && len(u.specials) == 0)
+}
+
+// isSpecial returns true if the Episode with the given ID is a special
+// Episode of the Media.
+func (u *mediaUnits) isSpecial(epID int) bool {
+	for _, ep := range u.specials {
+		if ep.Meta.ID == epID {
+			return true
+		}
+	}
+	return false
+}
+
+// units retrieves the Media with the given ID and its Episodes. Episodes are
+// ordered as in the EpisodeSets of the Media, oldest set first; Episodes are
+// not retrieved if the Episode services are not set.
+func (ser *UserMediaService) units(mID int, tx db.Tx) (*mediaUnits, error) {
+	md, err := ser.MediaService.GetByID(mID, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Media with ID %d: %w", mID, err)
+	}
+	u := mediaUnits{media: md}
+	if ser.EpisodeSetService == nil || ser.EpisodeService == nil {
+		return &u, nil
+	}
+
+	sets, err := ser.EpisodeSetService.GetByMedia(mID, nil, nil, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get EpisodeSets by Media ID %d: %w", mID, err)
+	}
+	sort.Slice(sets, func(i, j int) bool {
+		return sets[i].Meta.ID < sets[j].Meta.ID
+	})
+
+	ids := []int{}
+	seen := map[int]bool{}
+	for _, set := range sets {
+		for _, id := range set.Episodes {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	eps, err := ser.EpisodeService.GetMultiple(ids, tx, func(_ *models.Episode) bool {
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Episodes of Media with ID %d: %w", mID, err)
+	}
+	for _, ep := range eps {
+		if ep.Special {
+			u.specials = append(u.specials, ep)
+		} else {
+			u.regular = append(u.regular, ep)
+		}
+	}
+	return &u, nil
+}
+
+// Progress returns how far the User of the given UserMedia is through the
+// latest watch of its Media. Movies and Media with a single regular Episode
+// count as a single unit, and special Episodes are counted separately from
+// regular ones.
+func (ser *UserMediaService) Progress(
+	um *models.UserMedia, tx db.Tx,
+) (*models.Progress, error) {
+	u, err := ser.units(um.MediaID, tx)
+	if err != nil {
+		return nil, err
+	}
+	return progress(um, u), nil
+}
+
+func progress(um *models.UserMedia, u *mediaUnits) *models.Progress {
+	p := models.Progress{
+		Total:         len(u.regular),
+		TotalSpecials: len(u.specials),
+		SingleUnit:    u.singleUnit(),
+	}
+	if p.SingleUnit {
+		p.Total = 1
+	}
+
+	var latest *models.WatchedInstance
+	if n := len(um.WatchInstances); n > 0 {
+		latest = &um.WatchInstances[n-1]
+	}
+
+	if latest != nil {
+		p.Watched = latest.Episodes
+		if p.Total > 0 && p.Watched > p.Total {
+			p.Watched = p.Total
+		}
+
+		seen := map[int]bool{}
+		for _, id := range latest.Specials {
+			if !seen[id] && (len(u.specials) == 0 || u.isSpecial(id)) {
+				seen[id] = true
+				p.Specials++
+			}
+		}
+	}
+
+	// A completed UserMedia without a watch in progress is fully watched,
+	// regardless of the recorded episode counts
+	ongoing := latest != nil && latest.Ongoing
+	if um.Status != nil && *um.Status == models.WatchStatusCompleted && !ongoing {
+		p.Watched = p.Total
+		p.Completed = true
+	}
+	if p.Total > 0 && p.Watched >= p.Total {
+		p.Completed = true
+	}
+
+	return &p
+}
+
+// ContinueWatching returns the Media that the User with the given ID is in
+// the middle of watching, along with their progress and next Episode, most
+// recently watched first.
+func (ser *UserMediaService) ContinueWatching(
+	uID int, tx db.Tx,
+) ([]*models.ContinueWatching, error) {
+	list, err := ser.GetFilter(nil, nil, tx, func(um *models.UserMedia) bool {
+		return um.UserID == uID &&
+			um.Status != nil && *um.Status == models.WatchStatusCurrent
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get UserMedia by User ID %d: %w", uID, err)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return lastProgress(list[i]).After(lastProgress(list[j]))
+	})
+
+	entries := []*models.ContinueWatching{}
+	for _, um := range list {
+		u, err := ser.units(um.MediaID, tx)
+		if err != nil {
+			return nil, err
+		}
+
+		p := progress(um, u)
+		if p.Completed {
+			continue
+		}
+
+		e := models.ContinueWatching{
+			UserMedia: um,
+			Media:     u.media,
+			Progress:  p,
+		}
+		if !p.SingleUnit && p.Watched < len(u.regular) {
+			e.Next = u.regular[p.Watched]
+		}
+		entries = append(entries, &e)
+	}
+	return entries, nil
+}
@@ -0,0 +1,381 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// ProposalService performs operations on Proposal, the queue of changes to
+// Media proposed by Users for Moderators to review.
+type ProposalService struct {
+	UserService  *UserService
+	MediaService *MediaService
+	// ChangeService, if set, attributes the Changes of approved Proposals to
+	// their proposers.
+	ChangeService *ChangeService
+	// Patch applies the patch of a Proposal to the given Media in place,
+	// keeping its metadata.
+	Patch func(md *models.Media, patch []byte) error
+	Hooks db.PersistHooks
+}
+
+// NewProposalService returns a ProposalService.
+func NewProposalService(
+	hooks db.PersistHooks, userService *UserService, mediaService *MediaService,
+	changeService *ChangeService, patch func(md *models.Media, patch []byte) error,
+) *ProposalService {
+	// Initialize ProposalService
+	proposalService := &ProposalService{
+		UserService:   userService,
+		MediaService:  mediaService,
+		ChangeService: changeService,
+		Patch:         patch,
+		Hooks:         hooks,
+	}
+
+	// Add hook to delete Proposal on User deletion
+	deleteProposalOnDeleteUser := func(um db.Model, _ db.Service, tx db.Tx) error {
+		uID := um.Metadata().ID
+		err := proposalService.deleteFilter(tx, func(p *models.Proposal) bool {
+			return p.UserID == uID
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete Proposal by User ID %d: %w", uID, err)
+		}
+		return nil
+	}
+	uSerHooks := userService.PersistHooks()
+	uSerHooks.PreDeleteHooks =
+		append(uSerHooks.PreDeleteHooks, deleteProposalOnDeleteUser)
+
+	// Add hook to delete Proposal on Media deletion
+	deleteProposalOnDeleteMedia := func(mdm db.Model, _ db.Service, tx db.Tx) error {
+		mID := mdm.Metadata().ID
+		err := proposalService.deleteFilter(tx, func(p *models.Proposal) bool {
+			return p.MediaID == mID
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete Proposal by Media ID %d: %w", mID, err)
+		}
+		return nil
+	}
+	mdSerHooks := mediaService.PersistHooks()
+	mdSerHooks.PreDeleteHooks =
+		append(mdSerHooks.PreDeleteHooks, deleteProposalOnDeleteMedia)
+
+	return proposalService
+}
+
+// Create persists the given Proposal.
+func (ser *ProposalService) Create(p *models.Proposal, tx db.Tx) (int, error) {
+	return tx.Database().Create(p, ser, tx)
+}
+
+// Update replaces the value of the Proposal with the given ID.
+func (ser *ProposalService) Update(p *models.Proposal, tx db.Tx) error {
+	return tx.Database().Update(p, ser, tx)
+}
+
+// Delete deletes the Proposal with the given ID.
+func (ser *ProposalService) Delete(id int, tx db.Tx) error {
+	return tx.Database().Delete(id, ser, tx)
+}
+
+func (ser *ProposalService) deleteFilter(tx db.Tx, keep func(p *models.Proposal) bool) error {
+	return tx.Database().DeleteFilter(ser, tx, func(m db.Model) bool {
+		p, err := ser.AssertType(m)
+		if err != nil {
+			return false
+		}
+		return keep(p)
+	})
+}
+
+// GetFilter retrieves all persisted values of Proposal that pass the filter.
+func (ser *ProposalService) GetFilter(
+	first *int, skip *int, tx db.Tx, keep func(p *models.Proposal) bool,
+) ([]*models.Proposal, error) {
+	vlist, err := tx.Database().GetFilter(first, skip, ser, tx,
+		func(m db.Model) bool {
+			p, err := ser.AssertType(m)
+			if err != nil {
+				return false
+			}
+			return keep(p)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to Proposals: %w", err)
+	}
+	return list, nil
+}
+
+// GetByID retrieves the persisted Proposal with the given ID.
+func (ser *ProposalService) GetByID(id int, tx db.Tx) (*models.Proposal, error) {
+	m, err := tx.Database().GetByID(id, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return p, nil
+}
+
+// GetByStatus retrieves a list of instances of Proposal with the given
+// status, or of all Proposals if the status is nil.
+func (ser *ProposalService) GetByStatus(
+	status *models.ProposalStatus, first *int, skip *int, tx db.Tx,
+) ([]*models.Proposal, error) {
+	return ser.GetFilter(first, skip, tx, func(p *models.Proposal) bool {
+		return status == nil || p.Status == *status
+	})
+}
+
+// ProposeAs persists the given Proposal on behalf of the caller, who must be
+// authenticated. It returns an error wrapping ErrInvalid if the patch does
+// not apply to the Media or makes it invalid.
+func (ser *ProposalService) ProposeAs(
+	caller *models.User, p *models.Proposal, tx db.Tx,
+) (int, error) {
+	if caller == nil {
+		return 0, fmt.Errorf("no credentials given: %w", ErrUnauthorized)
+	}
+
+	md, err := ser.MediaService.GetByID(p.MediaID, tx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get Media by ID %d: %w", p.MediaID, err)
+	}
+	err = ser.apply(md, p.Patch)
+	if err != nil {
+		return 0, err
+	}
+	err = ser.MediaService.Validate(md, tx)
+	if err != nil {
+		return 0, fmt.Errorf("patched Media: %w", err)
+	}
+
+	p.UserID = caller.Meta.ID
+	p.Status = models.ProposalStatusPending
+	p.ReviewerID = nil
+	return ser.Create(p, tx)
+}
+
+// ApproveAs applies the pending Proposal with the given ID to its Media
+// through the update of the Media on behalf of the caller, who must be a
+// Moderator, and attributes the update to the proposer. It returns an error
+// wrapping ErrConflict if the Proposal was already reviewed.
+func (ser *ProposalService) ApproveAs(
+	caller *models.User, id int, tx db.Tx,
+) (*models.Proposal, error) {
+	p, err := ser.pendingAs(caller, id, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	md, err := ser.MediaService.GetByID(p.MediaID, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Media by ID %d: %w", p.MediaID, err)
+	}
+	err = ser.apply(md, p.Patch)
+	if err != nil {
+		return nil, err
+	}
+	err = ser.MediaService.UpdateAs(caller, md, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update Media with ID %d: %w", md.Meta.ID, err)
+	}
+	if ser.ChangeService != nil {
+		err = ser.ChangeService.Attribute(ser.MediaService.Bucket(), md.Meta.ID, p.UserID, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to attribute update of Media with ID %d: %w",
+				md.Meta.ID, err)
+		}
+	}
+
+	return p, ser.review(caller, p, models.ProposalStatusApproved, tx)
+}
+
+// RejectAs declines the pending Proposal with the given ID on behalf of the
+// caller, who must be a Moderator. It returns an error wrapping ErrConflict if
+// the Proposal was already reviewed.
+func (ser *ProposalService) RejectAs(
+	caller *models.User, id int, tx db.Tx,
+) (*models.Proposal, error) {
+	p, err := ser.pendingAs(caller, id, tx)
+	if err != nil {
+		return nil, err
+	}
+	return p, ser.review(caller, p, models.ProposalStatusRejected, tx)
+}
+
+// pendingAs retrieves the pending Proposal with the given ID for the caller
+// to review, who must be a Moderator.
+func (ser *ProposalService) pendingAs(
+	caller *models.User, id int, tx db.Tx,
+) (*models.Proposal, error) {
+	err := authorizeModerator(caller)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := ser.GetByID(id, tx)
+	if err != nil {
+		return nil, err
+	}
+	if p.Status != models.ProposalStatusPending {
+		return nil, fmt.Errorf("Proposal with ID %d: already %s: %w", id, p.Status, ErrConflict)
+	}
+	return p, nil
+}
+
+// review marks the given Proposal with the given status by the caller.
+func (ser *ProposalService) review(
+	caller *models.User, p *models.Proposal, status models.ProposalStatus, tx db.Tx,
+) error {
+	reviewerID := caller.Meta.ID
+	p.Status = status
+	p.ReviewerID = &reviewerID
+	err := ser.Update(p, tx)
+	if err != nil {
+		return fmt.Errorf("failed to update Proposal with ID %d: %w", p.Meta.ID, err)
+	}
+	return nil
+}
+
+// apply applies the given patch to the given Media with Patch.
+func (ser *ProposalService) apply(md *models.Media, patch []byte) error {
+	if ser.Patch == nil {
+		return errors.New("patches are not supported")
+	}
+	err := ser.Patch(md, patch)
+	if err != nil {
+		return fmt.Errorf("patch: %v: %w", err, ErrInvalid)
+	}
+	return nil
+}
+
+// Bucket returns the name of the bucket for Proposal.
+func (ser *ProposalService) Bucket() string {
+	return "Proposal"
+}
+
+// Clean cleans the given Proposal for storage.
+func (ser *ProposalService) Clean(m db.Model, _ db.Tx) error {
+	_, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return nil
+}
+
+// Validate returns an error if the Proposal is not valid for the database.
+func (ser *ProposalService) Validate(m db.Model, tx db.Tx) error {
+	e, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	var verr ValidationError
+	ValidateTags(e, &verr)
+	if !e.Status.IsValid() {
+		verr.Addf("Status", FieldInvalid, "unknown status %s", e.Status)
+	}
+	err = verr.Err()
+	if err != nil {
+		return err
+	}
+
+	db := tx.Database()
+
+	// Check if User with ID specified in Proposal exists
+	_, err = db.GetRawByID(e.UserID, ser.UserService, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get User with ID %d: %w", e.UserID, err)
+	}
+
+	// Check if Media with ID specified in Proposal exists
+	_, err = db.GetRawByID(e.MediaID, ser.MediaService, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get Media with ID %d: %w", e.MediaID, err)
+	}
+
+	return nil
+}
+
+// Initialize sets initial values for some properties.
+func (ser *ProposalService) Initialize(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistOldProperties maintains certain properties of the existing Proposal
+// in updates.
+func (ser *ProposalService) PersistOldProperties(_ db.Model, _ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistHooks returns the persistence hook functions.
+func (ser *ProposalService) PersistHooks() *db.PersistHooks {
+	return &ser.Hooks
+}
+
+// Marshal encodes the given Proposal for storage.
+func (ser *ProposalService) Marshal(m db.Model) ([]byte, error) {
+	p, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	v, err := db.Codecs.Encode(ser.Bucket(), p)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
+	}
+
+	return v, nil
+}
+
+// Unmarshal decodes the given record into Proposal.
+func (ser *ProposalService) Unmarshal(buf []byte) (db.Model, error) {
+	var p models.Proposal
+	err := db.Codecs.Decode(buf, &p)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
+	}
+	return &p, nil
+}
+
+// AssertType exposes the given db.Model as a Proposal.
+func (ser *ProposalService) AssertType(m db.Model) (*models.Proposal, error) {
+	if m == nil {
+		return nil, fmt.Errorf("model: %w", errNil)
+	}
+
+	p, ok := m.(*models.Proposal)
+	if !ok {
+		return nil, fmt.Errorf("model: %w", errors.New("not of Proposal type"))
+	}
+	return p, nil
+}
+
+// mapFromModel returns a list of Proposal type asserted from the given list
+// of db.Model.
+func (ser *ProposalService) mapFromModel(vlist []db.Model) ([]*models.Proposal, error) {
+	list := make([]*models.Proposal, len(vlist))
+	var err error
+	for i, v := range vlist {
+		list[i], err = ser.AssertType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+	}
+	return list, nil
+}
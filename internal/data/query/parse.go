@@ -0,0 +1,331 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// tokenKind is the kind of a token of an expression.
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenBool
+	tokenNull
+	tokenIn
+	// tokenOp is an operator or punctuation, given by its text.
+	tokenOp
+)
+
+// token is a lexical token of an expression.
+type token struct {
+	kind tokenKind
+	// text is the name of an identifier, the value of a string, the keyword
+	// or the operator.
+	text   string
+	number float64
+	// pos is the byte offset of the token in the expression.
+	pos int
+}
+
+// String returns the token as written in errors.
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of query"
+	case tokenString:
+		return strconv.Quote(t.text)
+	}
+	return t.text
+}
+
+// errorf returns an error wrapping db.ErrInvalid at the position of the token.
+func (t token) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("query: at position %d: %s: %w", t.pos+1,
+		fmt.Sprintf(format, args...), db.ErrInvalid)
+}
+
+// operators are the operators and punctuation of expressions, longest first.
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "~", "!",
+	"(", ")", "[", "]", ","}
+
+// comparisons are the operators comparing a field to a literal.
+var comparisons = map[string]bool{
+	"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true, "~": true,
+}
+
+// lex splits the given expression into tokens, ending with a tokenEOF.
+func lex(expr string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(expr); {
+		r, size := utf8.DecodeRuneInString(expr[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '"':
+			t, n, err := lexString(expr[i:], i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, t)
+			i += n
+		case r == '-' || r == '.' || unicode.IsDigit(r):
+			n := 1
+			for i+n < len(expr) && strings.ContainsRune("0123456789.eE+-", rune(expr[i+n])) {
+				n++
+			}
+			v, err := strconv.ParseFloat(expr[i:i+n], 64)
+			if err != nil {
+				return nil, token{pos: i}.errorf("%q: not a number", expr[i:i+n])
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: expr[i : i+n], number: v, pos: i})
+			i += n
+		case r == '_' || unicode.IsLetter(r):
+			n := 0
+			for i+n < len(expr) {
+				r, size := utf8.DecodeRuneInString(expr[i+n:])
+				if r != '_' && r != '.' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				n += size
+			}
+			t := token{kind: tokenIdent, text: expr[i : i+n], pos: i}
+			switch t.text {
+			case "true", "false":
+				t.kind = tokenBool
+			case "null":
+				t.kind = tokenNull
+			case "in":
+				t.kind = tokenIn
+			}
+			tokens = append(tokens, t)
+			i += n
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(expr[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, token{pos: i}.errorf("unexpected character %q", r)
+			}
+			tokens = append(tokens, token{kind: tokenOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(expr)}), nil
+}
+
+// lexString returns the string literal at the start of the given input, at
+// the given position of the expression, and its length in the input.
+func lexString(input string, pos int) (token, int, error) {
+	escaped := false
+	for n := 1; n < len(input); n++ {
+		switch {
+		case escaped:
+			escaped = false
+		case input[n] == '\\':
+			escaped = true
+		case input[n] == '"':
+			s, err := strconv.Unquote(input[:n+1])
+			if err != nil {
+				return token{}, 0, token{pos: pos}.errorf("%s: malformed string", input[:n+1])
+			}
+			return token{kind: tokenString, text: s, pos: pos}, n + 1, nil
+		}
+	}
+	return token{}, 0, token{pos: pos}.errorf("unterminated string")
+}
+
+// parser compiles the tokens of an expression into a Filter by recursive
+// descent:
+//
+//	or         = and { "||" and }
+//	and        = unary { "&&" unary }
+//	unary      = "!" unary | "(" or ")" | comparison
+//	comparison = field [ op literal | "in" "[" literal { "," literal } "]" ]
+type parser struct {
+	tokens []token
+	schema Schema
+	depth  int
+}
+
+// parse compiles the whole expression.
+func (p *parser) parse() (Filter, error) {
+	f, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, t.errorf("unexpected %s", t)
+	}
+	return f, nil
+}
+
+// peek returns the next token without consuming it.
+func (p *parser) peek() token {
+	return p.tokens[0]
+}
+
+// next consumes and returns the next token.
+func (p *parser) next() token {
+	t := p.tokens[0]
+	if t.kind != tokenEOF {
+		p.tokens = p.tokens[1:]
+	}
+	return t
+}
+
+// accept consumes the next token if it is the given operator.
+func (p *parser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokenOp && t.text == op {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// expect consumes the next token, which must be the given operator.
+func (p *parser) expect(op string) error {
+	if !p.accept(op) {
+		t := p.peek()
+		return t.errorf("expected %s, got %s", op, t)
+	}
+	return nil
+}
+
+// enter descends into a nested operand, refusing those nested deeper than
+// MaxDepth.
+func (p *parser) enter() error {
+	p.depth++
+	if p.depth > MaxDepth {
+		return p.peek().errorf("nested deeper than %d", MaxDepth)
+	}
+	return nil
+}
+
+func (p *parser) or() (Filter, error) {
+	f, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		g, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := f
+		f = func(v interface{}) bool { return l(v) || g(v) }
+	}
+	return f, nil
+}
+
+func (p *parser) and() (Filter, error) {
+	f, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		g, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l := f
+		f = func(v interface{}) bool { return l(v) && g(v) }
+	}
+	return f, nil
+}
+
+func (p *parser) unary() (Filter, error) {
+	err := p.enter()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+
+	if p.accept("!") {
+		f, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(v interface{}) bool { return !f(v) }, nil
+	}
+	if p.accept("(") {
+		f, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return f, p.expect(")")
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (Filter, error) {
+	t := p.next()
+	if t.kind != tokenIdent {
+		return nil, t.errorf("expected field, got %s", t)
+	}
+	field, ok := p.schema[t.text]
+	if !ok {
+		return nil, t.errorf("unknown field %q; fields are %s", t.text,
+			strings.Join(p.schema.Names(), ", "))
+	}
+
+	op := p.peek()
+	switch {
+	case op.kind == tokenIn:
+		p.next()
+		return p.in(t.text, field)
+	case op.kind == tokenOp && comparisons[op.text]:
+		p.next()
+		return compare(t.text, field, op.text, p.next())
+	}
+
+	// Bare boolean fields test if they are true
+	if field.Kind != KindBool {
+		return nil, op.errorf("expected operator after %s, got %s", t.text, op)
+	}
+	return compare(t.text, field, "==", token{kind: tokenBool, text: "true", pos: t.pos})
+}
+
+// in returns the Filter of the test of the given field against a list of
+// literals.
+func (p *parser) in(name string, field Field) (Filter, error) {
+	err := p.expect("[")
+	if err != nil {
+		return nil, err
+	}
+	filters := []Filter{}
+	for {
+		f, err := compare(name, field, "==", p.next())
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+		if !p.accept(",") {
+			break
+		}
+	}
+	err = p.expect("]")
+	if err != nil {
+		return nil, err
+	}
+	return func(v interface{}) bool {
+		for _, f := range filters {
+			if f(v) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
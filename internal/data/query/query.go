@@ -0,0 +1,225 @@
+// Package query compiles filter expressions over the fields of entities, such
+// as `type == "TV" && seasonPremiered.year >= 2020`, into filter functions.
+// Only the fields of the Schema given to Compile may be referred to.
+//
+// Expressions compare a field to a literal with ==, !=, <, <=, > or >=, test
+// a field against a list of literals with in, as in `source in ["mal",
+// "anilist"]`, or test strings for a case-insensitive substring with ~.
+// Comparisons are joined with && and ||, negated with !, and grouped with
+// parentheses. Literals are double-quoted strings, numbers, true, false and
+// null. Strings are compared ignoring case, and times are given as strings in
+// RFC 3339 format or as dates such as "2020-04-01". A field that is not set
+// is only equal to null; every other comparison of it is false.
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// MaxLength is the length of the longest expression that is compiled, and
+// MaxDepth the deepest nesting of its operators.
+const (
+	MaxLength = 1024
+	MaxDepth  = 32
+)
+
+// Kind is the type of the values of a field.
+type Kind int
+
+const (
+	// KindString is the kind of fields of string values.
+	KindString Kind = iota
+	// KindNumber is the kind of fields of float64 values.
+	KindNumber
+	// KindBool is the kind of fields of bool values.
+	KindBool
+	// KindTime is the kind of fields of time.Time values.
+	KindTime
+)
+
+// String returns the written name of the Kind.
+func (k Kind) String() string {
+	switch k {
+	case KindString:
+		return "string"
+	case KindNumber:
+		return "number"
+	case KindBool:
+		return "bool"
+	case KindTime:
+		return "time"
+	}
+	return fmt.Sprintf("%d", int(k))
+}
+
+// Field is a field of the entities filtered by expressions.
+type Field struct {
+	Kind Kind
+	// Get returns the value of the field of the given entity, of the Go type
+	// of the Kind, or nil if it is not set.
+	Get func(v interface{}) interface{}
+}
+
+// Schema is the whitelist of the fields expressions may refer to, by name.
+type Schema map[string]Field
+
+// Names returns the sorted names of the fields of the Schema.
+func (s Schema) Names() []string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Filter reports whether the given entity passes a compiled expression.
+type Filter func(v interface{}) bool
+
+// Compile parses the given expression and compiles it into a Filter of the
+// entities of the fields of the given Schema. It returns an error wrapping
+// db.ErrInvalid if the expression is malformed, refers to a field not in the
+// Schema, or compares a field to a literal of another kind.
+func Compile(expr string, schema Schema) (Filter, error) {
+	if len(expr) > MaxLength {
+		return nil, fmt.Errorf("query: longer than %d characters: %w", MaxLength, db.ErrInvalid)
+	}
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := parser{tokens: tokens, schema: schema}
+	f, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// compare returns the Filter of the comparison of the given field to the
+// given literal value with the given operator.
+func compare(name string, field Field, op string, lit token) (Filter, error) {
+	if lit.kind == tokenNull {
+		switch op {
+		case "==":
+			return func(v interface{}) bool { return field.Get(v) == nil }, nil
+		case "!=":
+			return func(v interface{}) bool { return field.Get(v) != nil }, nil
+		}
+		return nil, lit.errorf("null may only be compared with == or !=")
+	}
+
+	want, err := literalOf(field.Kind, lit)
+	if err != nil {
+		return nil, err
+	}
+	cmp, err := comparator(field.Kind, op)
+	if err != nil {
+		return nil, fmt.Errorf("field %q: %w", name, err)
+	}
+	return func(v interface{}) bool {
+		got := field.Get(v)
+		if got == nil {
+			return false
+		}
+		return cmp(got, want)
+	}, nil
+}
+
+// literalOf returns the value of the given literal token as a value of the
+// given Kind.
+func literalOf(kind Kind, lit token) (interface{}, error) {
+	switch {
+	case kind == KindString && lit.kind == tokenString:
+		return lit.text, nil
+	case kind == KindNumber && lit.kind == tokenNumber:
+		return lit.number, nil
+	case kind == KindBool && lit.kind == tokenBool:
+		return lit.text == "true", nil
+	case kind == KindTime && lit.kind == tokenString:
+		t, err := parseTime(lit.text)
+		if err != nil {
+			return nil, lit.errorf("%q: not a date or time", lit.text)
+		}
+		return t, nil
+	}
+	return nil, lit.errorf("%s is not a %s", lit, kind)
+}
+
+// parseTime parses the given string as a time in RFC 3339 format or a date.
+func parseTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+// comparator returns the function comparing values of the given Kind with
+// the given operator.
+func comparator(kind Kind, op string) (func(got, want interface{}) bool, error) {
+	var order func(got, want interface{}) int
+	switch kind {
+	case KindString:
+		if op == "~" {
+			return func(got, want interface{}) bool {
+				return strings.Contains(strings.ToLower(got.(string)),
+					strings.ToLower(want.(string)))
+			}, nil
+		}
+		order = func(got, want interface{}) int {
+			return strings.Compare(strings.ToLower(got.(string)), strings.ToLower(want.(string)))
+		}
+	case KindNumber:
+		order = func(got, want interface{}) int {
+			g, w := got.(float64), want.(float64)
+			switch {
+			case g < w:
+				return -1
+			case g > w:
+				return 1
+			}
+			return 0
+		}
+	case KindTime:
+		order = func(got, want interface{}) int {
+			g, w := got.(time.Time), want.(time.Time)
+			switch {
+			case g.Before(w):
+				return -1
+			case g.After(w):
+				return 1
+			}
+			return 0
+		}
+	case KindBool:
+		switch op {
+		case "==":
+			return func(got, want interface{}) bool { return got.(bool) == want.(bool) }, nil
+		case "!=":
+			return func(got, want interface{}) bool { return got.(bool) != want.(bool) }, nil
+		}
+		return nil, fmt.Errorf("operator %s: not defined on %s: %w", op, kind, db.ErrInvalid)
+	}
+
+	switch op {
+	case "==":
+		return func(got, want interface{}) bool { return order(got, want) == 0 }, nil
+	case "!=":
+		return func(got, want interface{}) bool { return order(got, want) != 0 }, nil
+	case "<":
+		return func(got, want interface{}) bool { return order(got, want) < 0 }, nil
+	case "<=":
+		return func(got, want interface{}) bool { return order(got, want) <= 0 }, nil
+	case ">":
+		return func(got, want interface{}) bool { return order(got, want) > 0 }, nil
+	case ">=":
+		return func(got, want interface{}) bool { return order(got, want) >= 0 }, nil
+	}
+	return nil, fmt.Errorf("operator %s: not defined on %s: %w", op, kind, db.ErrInvalid)
+}
@@ -0,0 +1,97 @@
+package query_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data/query"
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+type show struct {
+	Type    *string
+	Year    int
+	Airing  bool
+	Started time.Time
+}
+
+var schema = query.Schema{
+	"type": {Kind: query.KindString, Get: func(v interface{}) interface{} {
+		if t := v.(show).Type; t != nil {
+			return *t
+		}
+		return nil
+	}},
+	"season.year": {Kind: query.KindNumber, Get: func(v interface{}) interface{} {
+		return float64(v.(show).Year)
+	}},
+	"airing": {Kind: query.KindBool, Get: func(v interface{}) interface{} {
+		return v.(show).Airing
+	}},
+	"started": {Kind: query.KindTime, Get: func(v interface{}) interface{} {
+		return v.(show).Started
+	}},
+}
+
+// TestCompile tests that expressions filter by the fields of the Schema with
+// the precedence of && over ||, and that unset fields only equal null.
+func TestCompile(t *testing.T) {
+	tv, movie := "TV", "Movie"
+	shows := []show{
+		{&tv, 2021, true, time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{&tv, 2018, false, time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{&movie, 2020, false, time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{nil, 2022, true, time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	cases := []struct {
+		expr string
+		want []bool
+	}{
+		{`type == "tv" && season.year >= 2020`, []bool{true, false, false, false}},
+		{`type == "Movie" || airing && season.year > 2021`, []bool{false, false, true, true}},
+		{`(type == "Movie" || airing) && season.year > 2020`, []bool{true, false, false, true}},
+		{`!airing`, []bool{false, true, true, false}},
+		{`type in ["movie", "ona"]`, []bool{false, false, true, false}},
+		{`type ~ "ov"`, []bool{false, false, true, false}},
+		{`type != "TV"`, []bool{false, false, true, false}},
+		{`type == null`, []bool{false, false, false, true}},
+		{`started < "2020-07-01"`, []bool{false, true, false, false}},
+	}
+	for _, c := range cases {
+		f, err := query.Compile(c.expr, schema)
+		if err != nil {
+			t.Errorf("%s: %v", c.expr, err)
+			continue
+		}
+		for i, s := range shows {
+			if got := f(s); got != c.want[i] {
+				t.Errorf("%s: show %d: expected %t, got %t", c.expr, i, c.want[i], got)
+			}
+		}
+	}
+}
+
+// TestCompileInvalid tests that malformed expressions, fields not in the
+// Schema and literals of the wrong kind are refused as invalid.
+func TestCompileInvalid(t *testing.T) {
+	exprs := []string{
+		``,
+		`title == "Cowboy Bebop"`,
+		`type == 2020`,
+		`season.year >= "2020"`,
+		`airing > true`,
+		`type == "TV" &&`,
+		`(type == "TV"`,
+		`type == "TV`,
+		`type < null`,
+		`season.year`,
+	}
+	for _, expr := range exprs {
+		_, err := query.Compile(expr, schema)
+		if !errors.Is(err, db.ErrInvalid) {
+			t.Errorf("%q: expected invalid, got %v", expr, err)
+		}
+	}
+}
@@ -0,0 +1,478 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// ReviewScoreMax is the highest score that may be given in a Review.
+const ReviewScoreMax = 10
+
+// ReviewService performs operations on Review.
+type ReviewService struct {
+	UserService  *UserService
+	MediaService *MediaService
+	Hooks        db.PersistHooks
+}
+
+// NewReviewService returns a ReviewService.
+func NewReviewService(hooks db.PersistHooks, userService *UserService,
+	mediaService *MediaService) *ReviewService {
+	// Initialize ReviewService
+	reviewService := &ReviewService{
+		UserService:  userService,
+		MediaService: mediaService,
+		Hooks:        hooks,
+	}
+
+	// Add hook to delete Review on User deletion
+	deleteReviewOnDeleteUser := func(um db.Model, _ db.Service, tx db.Tx) error {
+		uID := um.Metadata().ID
+		err := reviewService.DeleteByUser(uID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to delete Review by User ID %d: %w", uID, err)
+		}
+		return nil
+	}
+	uSerHooks := userService.PersistHooks()
+	uSerHooks.PreDeleteHooks =
+		append(uSerHooks.PreDeleteHooks, deleteReviewOnDeleteUser)
+
+	// Add hook to delete Review on Media deletion
+	deleteReviewOnDeleteMedia := func(mdm db.Model, _ db.Service, tx db.Tx) error {
+		mID := mdm.Metadata().ID
+		err := reviewService.DeleteByMedia(mID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to delete Review by Media ID %d: %w", mID, err)
+		}
+		return nil
+	}
+	mdSerHooks := mediaService.PersistHooks()
+	mdSerHooks.PreDeleteHooks =
+		append(mdSerHooks.PreDeleteHooks, deleteReviewOnDeleteMedia)
+
+	return reviewService
+}
+
+// Create persists the given Review.
+func (ser *ReviewService) Create(r *models.Review, tx db.Tx) (int, error) {
+	return tx.Database().Create(r, ser, tx)
+}
+
+// Update replaces the value of the Review with the given ID.
+func (ser *ReviewService) Update(r *models.Review, tx db.Tx) error {
+	return tx.Database().Update(r, ser, tx)
+}
+
+// Delete deletes the Review with the given ID.
+func (ser *ReviewService) Delete(id int, tx db.Tx) error {
+	return tx.Database().Delete(id, ser, tx)
+}
+
+// DeleteByUser deletes the Reviews with the given User ID.
+func (ser *ReviewService) DeleteByUser(uID int, tx db.Tx) error {
+	return ser.deleteFilter(tx, func(r *models.Review) bool {
+		return r.UserID == uID
+	})
+}
+
+// DeleteByMedia deletes the Reviews with the given Media ID.
+func (ser *ReviewService) DeleteByMedia(mID int, tx db.Tx) error {
+	return ser.deleteFilter(tx, func(r *models.Review) bool {
+		return r.MediaID == mID
+	})
+}
+
+// deleteFilter deletes the Reviews that pass the filter one by one, so that
+// the deletion hooks of each are run.
+func (ser *ReviewService) deleteFilter(tx db.Tx, keep func(r *models.Review) bool) error {
+	list, err := ser.GetFilter(nil, nil, tx, keep)
+	if err != nil {
+		return err
+	}
+	for _, r := range list {
+		err = ser.Delete(r.Meta.ID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to delete Review with ID %d: %w", r.Meta.ID, err)
+		}
+	}
+	return nil
+}
+
+// GetFilter retrieves all persisted values of Review that pass the filter.
+func (ser *ReviewService) GetFilter(
+	first *int, skip *int, tx db.Tx, keep func(r *models.Review) bool,
+) ([]*models.Review, error) {
+	vlist, err := tx.Database().GetFilter(first, skip, ser, tx,
+		func(m db.Model) bool {
+			r, err := ser.AssertType(m)
+			if err != nil {
+				return false
+			}
+			return keep(r)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to Reviews: %w", err)
+	}
+	return list, nil
+}
+
+// GetAll retrieves all persisted values of Review.
+func (ser *ReviewService) GetAll(first *int, skip *int, tx db.Tx) ([]*models.Review, error) {
+	vlist, err := tx.Database().GetAll(first, skip, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to Reviews: %w", err)
+	}
+	return list, nil
+}
+
+// GetByID retrieves the persisted Review with the given ID.
+func (ser *ReviewService) GetByID(id int, tx db.Tx) (*models.Review, error) {
+	m, err := tx.Database().GetByID(id, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return r, nil
+}
+
+// GetByMedia retrieves a list of instances of Review with the given Media ID.
+func (ser *ReviewService) GetByMedia(
+	mID int, first *int, skip *int, tx db.Tx,
+) ([]*models.Review, error) {
+	return ser.GetFilter(first, skip, tx, func(r *models.Review) bool {
+		return r.MediaID == mID
+	})
+}
+
+// GetByUser retrieves a list of instances of Review with the given User ID.
+func (ser *ReviewService) GetByUser(
+	uID int, first *int, skip *int, tx db.Tx,
+) ([]*models.Review, error) {
+	return ser.GetFilter(first, skip, tx, func(r *models.Review) bool {
+		return r.UserID == uID
+	})
+}
+
+// GetByUserMedia retrieves the Review of the Media with the given ID by the
+// User with the given ID.
+func (ser *ReviewService) GetByUserMedia(uID int, mID int, tx db.Tx) (*models.Review, error) {
+	m, err := tx.Database().FindFirst(ser, tx, func(m db.Model) (bool, error) {
+		r, err := ser.AssertType(m)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+		return r.UserID == uID && r.MediaID == mID, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate through keys: %w", err)
+	}
+	if m == nil {
+		return nil, fmt.Errorf("Review of Media with ID %d by User with ID %d: %w",
+			mID, uID, ErrNotFound)
+	}
+
+	r, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return r, nil
+}
+
+// GetFlagged retrieves a list of the Reviews flagged for moderation.
+func (ser *ReviewService) GetFlagged(first *int, skip *int, tx db.Tx) ([]*models.Review, error) {
+	return ser.GetFilter(first, skip, tx, func(r *models.Review) bool {
+		return r.Flagged
+	})
+}
+
+// GetByIDAs retrieves the persisted Review with the given ID, if visible to
+// the caller.
+func (ser *ReviewService) GetByIDAs(caller *models.User, id int, tx db.Tx) (*models.Review, error) {
+	r, err := ser.GetByID(id, tx)
+	if err != nil {
+		return nil, err
+	}
+	if !moderatedVisible(caller, r.UserID, r.Hidden) {
+		return nil, fmt.Errorf("Review with ID %d: hidden: %w", id, ErrNotFound)
+	}
+	return r, nil
+}
+
+// GetByMediaAs retrieves a list of the Reviews of the Media with the given
+// ID visible to the caller, only those updated after since if it is not nil.
+func (ser *ReviewService) GetByMediaAs(
+	caller *models.User, mID int, since *time.Time, first *int, skip *int, tx db.Tx,
+) ([]*models.Review, error) {
+	return ser.GetFilter(first, skip, tx, func(r *models.Review) bool {
+		return r.MediaID == mID && moderatedVisible(caller, r.UserID, r.Hidden) &&
+			r.Meta.UpdatedSince(since)
+	})
+}
+
+// CreateAs persists the given Review on behalf of the caller, who must own
+// it. Reviews are never created flagged or hidden.
+func (ser *ReviewService) CreateAs(caller *models.User, r *models.Review, tx db.Tx) (int, error) {
+	err := AuthorizeOwner(caller, r.UserID)
+	if err != nil {
+		return 0, err
+	}
+
+	r.Flagged = false
+	r.Hidden = false
+	return ser.Create(r, tx)
+}
+
+// UpdateAs replaces the body, score and spoiler flag of the Review with the
+// given ID on behalf of the caller, who must own it. The moderation flags are
+// kept.
+func (ser *ReviewService) UpdateAs(caller *models.User, r *models.Review, tx db.Tx) error {
+	old, err := ser.GetByID(r.Meta.ID, tx)
+	if err != nil {
+		return err
+	}
+	err = AuthorizeOwner(caller, old.UserID)
+	if err != nil {
+		return err
+	}
+
+	r.Flagged = old.Flagged
+	r.Hidden = old.Hidden
+	return ser.Update(r, tx)
+}
+
+// DeleteAs deletes the Review with the given ID on behalf of the caller, who
+// must own it.
+func (ser *ReviewService) DeleteAs(caller *models.User, id int, tx db.Tx) error {
+	r, err := ser.GetByID(id, tx)
+	if err != nil {
+		return err
+	}
+	err = AuthorizeOwner(caller, r.UserID)
+	if err != nil {
+		return err
+	}
+	return ser.Delete(id, tx)
+}
+
+// FlagAs flags the Review with the given ID for moderation on behalf of the
+// caller, who must be authenticated.
+func (ser *ReviewService) FlagAs(caller *models.User, id int, tx db.Tx) error {
+	if caller == nil {
+		return fmt.Errorf("no credentials given: %w", ErrUnauthorized)
+	}
+
+	r, err := ser.GetByIDAs(caller, id, tx)
+	if err != nil {
+		return err
+	}
+	r.Flagged = true
+	return ser.Update(r, tx)
+}
+
+// SetHiddenAs hides or shows the Review with the given ID on behalf of the
+// caller, who must be a Moderator. The Review is no longer flagged.
+func (ser *ReviewService) SetHiddenAs(
+	caller *models.User, id int, hidden bool, tx db.Tx,
+) (*models.Review, error) {
+	err := authorizeModerator(caller)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := ser.GetByID(id, tx)
+	if err != nil {
+		return nil, err
+	}
+	r.Hidden = hidden
+	r.Flagged = false
+	err = ser.Update(r, tx)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Bucket returns the name of the bucket for Review.
+func (ser *ReviewService) Bucket() string {
+	return "Review"
+}
+
+// Clean cleans the given Review for storage.
+func (ser *ReviewService) Clean(m db.Model, _ db.Tx) error {
+	_, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return nil
+}
+
+// Validate returns an error if the Review is not valid for the database.
+func (ser *ReviewService) Validate(m db.Model, tx db.Tx) error {
+	e, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	var verr ValidationError
+	ValidateTags(e, &verr)
+	if e.Score != nil && (*e.Score < 0 || *e.Score > ReviewScoreMax) {
+		verr.Addf("Score", FieldOutOfRange, "%d: must be between 0 and %d",
+			*e.Score, ReviewScoreMax)
+	}
+	err = verr.Err()
+	if err != nil {
+		return err
+	}
+
+	db := tx.Database()
+
+	// Check if User with ID specified in Review exists
+	_, err = db.GetRawByID(e.UserID, ser.UserService, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get User with ID %d: %w", e.UserID, err)
+	}
+
+	// Check if Media with ID specified in Review exists
+	_, err = db.GetRawByID(e.MediaID, ser.MediaService, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get Media with ID %d: %w", e.MediaID, err)
+	}
+
+	// Check that the User has not already reviewed the Media
+	same, err := ser.GetByUserMedia(e.UserID, e.MediaID, tx)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("failed to get Review of Media with ID %d by User with ID %d: %w",
+			e.MediaID, e.UserID, err)
+	}
+	if same != nil && same.Meta.ID != e.Meta.ID {
+		return fmt.Errorf("Media with ID %d: already reviewed by User with ID %d: %w",
+			e.MediaID, e.UserID, ErrConflict)
+	}
+
+	return nil
+}
+
+// Initialize sets initial values for some properties.
+func (ser *ReviewService) Initialize(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistOldProperties maintains certain properties of the existing Review in
+// updates.
+func (ser *ReviewService) PersistOldProperties(n db.Model, o db.Model, _ db.Tx) error {
+	nr, err := ser.AssertType(n)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	or, err := ser.AssertType(o)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	// Reviews may not be moved between Users or Media
+	nr.UserID = or.UserID
+	nr.MediaID = or.MediaID
+	return nil
+}
+
+// PersistHooks returns the persistence hook functions.
+func (ser *ReviewService) PersistHooks() *db.PersistHooks {
+	return &ser.Hooks
+}
+
+// Marshal encodes the given Review for storage.
+func (ser *ReviewService) Marshal(m db.Model) ([]byte, error) {
+	r, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	v, err := db.Codecs.Encode(ser.Bucket(), r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
+	}
+
+	return v, nil
+}
+
+// Unmarshal decodes the given record into Review.
+func (ser *ReviewService) Unmarshal(buf []byte) (db.Model, error) {
+	var r models.Review
+	err := db.Codecs.Decode(buf, &r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
+	}
+	return &r, nil
+}
+
+// AssertType exposes the given db.Model as a Review.
+func (ser *ReviewService) AssertType(m db.Model) (*models.Review, error) {
+	if m == nil {
+		return nil, fmt.Errorf("model: %w", errNil)
+	}
+
+	r, ok := m.(*models.Review)
+	if !ok {
+		return nil, fmt.Errorf("model: %w", errors.New("not of Review type"))
+	}
+	return r, nil
+}
+
+// mapFromModel returns a list of Review type asserted from the given list of
+// db.Model.
+func (ser *ReviewService) mapFromModel(vlist []db.Model) ([]*models.Review, error) {
+	list := make([]*models.Review, len(vlist))
+	var err error
+	for i, v := range vlist {
+		list[i], err = ser.AssertType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+	}
+	return list, nil
+}
+
+// moderatedVisible returns true if content of the User with the given ID is
+// visible to the caller; hidden content is visible only to its User and
+// Moderators.
+func moderatedVisible(caller *models.User, ownerID int, hidden bool) bool {
+	if !hidden {
+		return true
+	}
+	if caller == nil {
+		return false
+	}
+	return caller.Meta.ID == ownerID ||
+		caller.Permissions.Role().Includes(models.RoleModerator)
+}
+
+// authorizeModerator returns an error wrapping ErrUnauthorized unless the
+// caller is a Moderator.
+func authorizeModerator(caller *models.User) error {
+	if caller == nil {
+		return fmt.Errorf("no credentials given: %w", ErrUnauthorized)
+	}
+	if r := caller.Permissions.Role(); !r.Includes(models.RoleModerator) {
+		return fmt.Errorf("role %s: insufficient permissions: %w", r, ErrUnauthorized)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package data
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// StartRewatch starts a rewatch of the Media with the given ID by the User
+// with the given ID at the given time, closing the ongoing watches of their
+// UserMedia, starting a new one numbered after the latest rewatch and marking
+// the UserMedia current. The User must have completed the Media before.
+func (ser *UserMediaService) StartRewatch(
+	uID int, mID int, t time.Time, tx db.Tx,
+) (*models.UserMedia, error) {
+	list, err := ser.GetFilter(nil, nil, tx, func(um *models.UserMedia) bool {
+		return um.UserID == uID && um.MediaID == mID
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get UserMedia by User ID %d and Media ID %d: %w",
+			uID, mID, err)
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("UserMedia of User with ID %d and Media with ID %d: %w",
+			uID, mID, ErrNotFound)
+	}
+	um := list[0]
+
+	n := latestRewatch(um)
+	completed := um.Status != nil && *um.Status == models.WatchStatusCompleted
+	if !completed && n == 0 {
+		return nil, fmt.Errorf("UserMedia with ID %d: not completed: %w", um.Meta.ID, ErrInvalid)
+	}
+
+	for i := range um.WatchInstances {
+		um.WatchInstances[i].Ongoing = false
+	}
+	start, end := t, t
+	um.WatchInstances = append(um.WatchInstances, models.WatchedInstance{
+		Ongoing:   true,
+		Rewatch:   n + 1,
+		StartDate: &start,
+		EndDate:   &end,
+	})
+	status := models.WatchStatusCurrent
+	um.Status = &status
+
+	err = ser.Update(um, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update UserMedia with ID %d: %w", um.Meta.ID, err)
+	}
+	return um, nil
+}
+
+// latestRewatch returns the number of the latest rewatch of the given
+// UserMedia, or 0 if it has not been rewatched.
+func latestRewatch(um *models.UserMedia) int {
+	n := 0
+	for _, wi := range um.WatchInstances {
+		if wi.Rewatch > n {
+			n = wi.Rewatch
+		}
+	}
+	return n
+}
+
+// rewatchStart returns the start of the latest rewatch of the given UserMedia,
+// or nil if it has not been rewatched or the start is unknown.
+func rewatchStart(um *models.UserMedia) *time.Time {
+	n := latestRewatch(um)
+	if n == 0 {
+		return nil
+	}
+	for _, wi := range um.WatchInstances {
+		if wi.Rewatch == n {
+			return wi.StartDate
+		}
+	}
+	return nil
+}
+
+// nextRewatch returns the Rewatch of a watch of the given UserMedia started
+// by some progress: a new rewatch if the Media was completed, unless the
+// progress is of a special Episode, and otherwise that of the latest watch.
+func nextRewatch(um *models.UserMedia, special bool) int {
+	n := latestRewatch(um)
+	if !special && um.Status != nil && *um.Status == models.WatchStatusCompleted {
+		return n + 1
+	}
+	return n
+}
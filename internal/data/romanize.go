@@ -0,0 +1,276 @@
+package data
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/ikawaha/kagome-dict/ipa"
+	"github.com/ikawaha/kagome/v2/tokenizer"
+	"github.com/mozillazg/go-pinyin"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Romanizer transliterates names into Latin script, such as by the readings
+// of kanji or the pinyin of hanzi.
+type Romanizer interface {
+	// Romanize returns the given name key in Latin script, or an empty string
+	// if it has no reading of it.
+	Romanize(key string) string
+}
+
+// NameKey returns the key the given name is indexed and searched by: its
+// words, separated by single spaces, in compatibility-normalized lowercase
+// without diacritics, with kana romanized by Hepburn and the long vowels of
+// romanized Japanese shortened, so that "Ōtomo", "Ootomo" and "おおとも" share a
+// key. Words of other scripts, such as kanji, are kept.
+func NameKey(name string) string {
+	name = strings.ToLower(norm.NFKC.String(name))
+
+	// Strip the diacritics of letters, but not the voicing marks of kana
+	var b strings.Builder
+	for _, r := range norm.NFD.String(name) {
+		if unicode.Is(unicode.Mn, r) && r != '゙' && r != '゚' {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	name = norm.NFC.String(b.String())
+
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != 'ー'
+	})
+	for i, w := range words {
+		words[i] = foldLongVowels(romanizeKana(w))
+	}
+	return strings.Join(words, " ")
+}
+
+// foldLongVowels shortens the long vowels of the given romanized word, as
+// written doubled or as "ou".
+func foldLongVowels(w string) string {
+	var b strings.Builder
+	var last rune
+	for _, r := range w {
+		if strings.ContainsRune("aeiou", r) && (r == last || (last == 'o' && r == 'u')) {
+			continue
+		}
+		b.WriteRune(r)
+		last = r
+	}
+	return b.String()
+}
+
+// kanaRomaji are the Hepburn romanizations of the hiragana.
+var kanaRomaji = map[rune]string{
+	'あ': "a", 'い': "i", 'う': "u", 'え': "e", 'お': "o",
+	'か': "ka", 'き': "ki", 'く': "ku", 'け': "ke", 'こ': "ko",
+	'が': "ga", 'ぎ': "gi", 'ぐ': "gu", 'げ': "ge", 'ご': "go",
+	'さ': "sa", 'し': "shi", 'す': "su", 'せ': "se", 'そ': "so",
+	'ざ': "za", 'じ': "ji", 'ず': "zu", 'ぜ': "ze", 'ぞ': "zo",
+	'た': "ta", 'ち': "chi", 'つ': "tsu", 'て': "te", 'と': "to",
+	'だ': "da", 'ぢ': "ji", 'づ': "zu", 'で': "de", 'ど': "do",
+	'な': "na", 'に': "ni", 'ぬ': "nu", 'ね': "ne", 'の': "no",
+	'は': "ha", 'ひ': "hi", 'ふ': "fu", 'へ': "he", 'ほ': "ho",
+	'ば': "ba", 'び': "bi", 'ぶ': "bu", 'べ': "be", 'ぼ': "bo",
+	'ぱ': "pa", 'ぴ': "pi", 'ぷ': "pu", 'ぺ': "pe", 'ぽ': "po",
+	'ま': "ma", 'み': "mi", 'む': "mu", 'め': "me", 'も': "mo",
+	'や': "ya", 'ゆ': "yu", 'よ': "yo",
+	'ら': "ra", 'り': "ri", 'る': "ru", 'れ': "re", 'ろ': "ro",
+	'わ': "wa", 'ゐ': "i", 'ゑ': "e", 'を': "o", 'ん': "n", 'ゔ': "vu",
+}
+
+// romanizeKana returns the given string with its hiragana and katakana
+// romanized by Hepburn, and any other characters kept.
+func romanizeKana(s string) string {
+	var b strings.Builder
+	geminate := false
+	for _, r := range s {
+		// Read katakana as the hiragana of the same sound
+		if r >= 'ァ' && r <= 'ヶ' {
+			r -= 'ァ' - 'ぁ'
+		}
+
+		out := b.String()
+		switch r {
+		case 'っ':
+			geminate = true
+			continue
+		case 'ー':
+			// Long vowels are shortened by NameKey
+			continue
+		case 'ゃ', 'ゅ', 'ょ':
+			// Palatalize the syllable before, as in "kya" and "sha"
+			v := map[rune]string{'ゃ': "a", 'ゅ': "u", 'ょ': "o"}[r]
+			if strings.HasSuffix(out, "i") {
+				base := out[:len(out)-1]
+				if !strings.HasSuffix(base, "sh") && !strings.HasSuffix(base, "ch") &&
+					!strings.HasSuffix(base, "j") {
+					base += "y"
+				}
+				b.Reset()
+				b.WriteString(base + v)
+				continue
+			}
+			b.WriteString("y" + v)
+			continue
+		case 'ぁ', 'ぃ', 'ぅ', 'ぇ', 'ぉ':
+			// Replace the vowel of the syllable before, as in "fa" and "ti"
+			v := map[rune]string{'ぁ': "a", 'ぃ': "i", 'ぅ': "u", 'ぇ': "e", 'ぉ': "o"}[r]
+			if out != "" && strings.ContainsRune("aiueo", rune(out[len(out)-1])) {
+				base := out[:len(out)-1]
+				if base == "" || strings.HasSuffix(base, " ") {
+					base += "w"
+				}
+				b.Reset()
+				b.WriteString(base + v)
+				continue
+			}
+			b.WriteString(v)
+			continue
+		}
+
+		romaji, ok := kanaRomaji[r]
+		if !ok {
+			geminate = false
+			b.WriteRune(r)
+			continue
+		}
+		if geminate {
+			geminate = false
+			if strings.HasPrefix(romaji, "ch") {
+				b.WriteByte('t')
+			} else if !strings.ContainsRune("aiueon", rune(romaji[0])) {
+				b.WriteByte(romaji[0])
+			}
+		}
+		b.WriteString(romaji)
+	}
+	return b.String()
+}
+
+// KanjiRomanizer romanizes Japanese names written in kanji by the readings
+// given to their words by the morphological analysis of kagome with the IPA
+// dictionary, so that family and given names written together are read
+// apart. Kanji read otherwise in names than they usually are, as given names
+// often are, may be read by further Romanizers.
+type KanjiRomanizer struct {
+	once      sync.Once
+	tokenizer *tokenizer.Tokenizer
+	err       error
+}
+
+// NewKanjiRomanizer returns a KanjiRomanizer. The dictionary is loaded the
+// first time a name is romanized.
+func NewKanjiRomanizer() *KanjiRomanizer {
+	return &KanjiRomanizer{}
+}
+
+// Romanize returns the reading of the given name key in katakana, which
+// NameKey romanizes, or an empty string if none of its words have kanji
+// read by the dictionary.
+func (r *KanjiRomanizer) Romanize(key string) string {
+	r.once.Do(func() {
+		r.tokenizer, r.err = tokenizer.New(ipa.Dict(), tokenizer.OmitBosEos())
+	})
+	if r.err != nil {
+		return ""
+	}
+
+	words := strings.Fields(key)
+	read := false
+	for i, w := range words {
+		if !containsHan(w) {
+			continue
+		}
+		if reading, ok := r.readWord(w); ok {
+			words[i] = reading
+			read = true
+		}
+	}
+	if !read {
+		return ""
+	}
+	return strings.Join(words, " ")
+}
+
+// readWord returns the readings of the morphemes of the given word,
+// separated by spaces, or false if some of its kanji are not read.
+func (r *KanjiRomanizer) readWord(w string) (string, bool) {
+	parts := []string{}
+	for _, tok := range r.tokenizer.Tokenize(w) {
+		if !containsHan(tok.Surface) {
+			parts = append(parts, tok.Surface)
+			continue
+		}
+		reading, ok := tok.Reading()
+		if !ok || reading == "" || reading == "*" {
+			return "", false
+		}
+		parts = append(parts, reading)
+	}
+	return strings.Join(parts, " "), true
+}
+
+// PinyinRomanizer romanizes Chinese names written in hanzi, simplified or
+// traditional, by their pinyin without tones. A name written as a single
+// word is read as a family name of one hanzi followed by the given name, so
+// that "毛泽东" is read as "mao zedong"; names written in several words are
+// read word by word. Names in kanji are read as if Chinese.
+type PinyinRomanizer struct {
+	args pinyin.Args
+}
+
+// NewPinyinRomanizer returns a PinyinRomanizer.
+func NewPinyinRomanizer() *PinyinRomanizer {
+	return &PinyinRomanizer{args: pinyin.NewArgs()}
+}
+
+// Romanize returns the pinyin of the given name key, or an empty string if
+// none of its words are written wholly in hanzi.
+func (r *PinyinRomanizer) Romanize(key string) string {
+	words := strings.Fields(key)
+	read := false
+	for i, w := range words {
+		syllables := r.readWord(w)
+		if len(syllables) == 0 {
+			continue
+		}
+		if len(words) == 1 && len(syllables) > 1 {
+			words[i] = syllables[0] + " " + strings.Join(syllables[1:], "")
+		} else {
+			words[i] = strings.Join(syllables, "")
+		}
+		read = true
+	}
+	if !read {
+		return ""
+	}
+	return strings.Join(words, " ")
+}
+
+// readWord returns the pinyin syllables of the given word, or none if it is
+// not written wholly in hanzi of known pinyin.
+func (r *PinyinRomanizer) readWord(w string) []string {
+	runes := []rune(w)
+	for _, c := range runes {
+		if !unicode.Is(unicode.Han, c) {
+			return nil
+		}
+	}
+	syllables := pinyin.LazyPinyin(w, r.args)
+	if len(syllables) != len(runes) {
+		return nil
+	}
+	return syllables
+}
+
+// containsHan checks if the given string has any kanji or hanzi.
+func containsHan(s string) bool {
+	for _, r := range s {
+		if unicode.Is(unicode.Han, r) {
+			return true
+		}
+	}
+	return false
+}
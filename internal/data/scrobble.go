@@ -0,0 +1,270 @@
+package data
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// DefaultScrobbleSessionGap is the session gap used when none is configured.
+const DefaultScrobbleSessionGap = 6 * time.Hour
+
+// Scrobble stitches the given playback event into the WatchedInstances of the
+// UserMedia of its User and Media, creating the UserMedia if it does not
+// exist yet.
+//
+// The event extends the ongoing WatchedInstance if it is reported within the
+// session gap of the instance's last progress and does not move backwards;
+// otherwise the ongoing instance is closed and a new one is started. Events
+// that reach the end of the Media close the instance and mark the UserMedia
+// completed; instances started after that are part of a new rewatch. Events
+// of special Episodes are recorded in the ongoing instance without affecting
+// its progress through the regular Episodes.
+func (ser *UserMediaService) Scrobble(s *models.Scrobble, tx db.Tx) (*models.UserMedia, error) {
+	if s == nil {
+		return nil, fmt.Errorf("scrobble: %w", errNil)
+	}
+	if s.Episodes < 0 {
+		return nil, fmt.Errorf("episodes %d: %w", s.Episodes, ErrInvalid)
+	}
+
+	u, err := ser.units(s.MediaID, tx)
+	if err != nil {
+		return nil, err
+	}
+	return ser.scrobble(s, u, tx)
+}
+
+// Play stitches the given playback event into the WatchedInstances of the
+// UserMedia of its User and Media, as a Scrobble. Finishing a regular Episode
+// counts it as watched, while starting or pausing it counts only the Episodes
+// before it; finishing the last regular Episode completes the Media. The
+// Episode may be omitted only for Media watched as a single unit.
+func (ser *UserMediaService) Play(e *models.PlaybackEvent, tx db.Tx) (*models.UserMedia, error) {
+	if e == nil {
+		return nil, fmt.Errorf("playback event: %w", errNil)
+	}
+	if !e.Kind.IsValid() {
+		return nil, fmt.Errorf("playback event kind %v: %w", e.Kind, ErrInvalid)
+	}
+
+	u, err := ser.units(e.MediaID, tx)
+	if err != nil {
+		return nil, err
+	}
+	s, err := u.scrobbleOf(e)
+	if err != nil {
+		return nil, err
+	}
+	return ser.scrobble(s, u, tx)
+}
+
+// ReportProgress stitches the given report of progress into the
+// WatchedInstances of the UserMedia of its User and Media, as the finishing of
+// the reported Episode. See Play.
+func (ser *UserMediaService) ReportProgress(
+	p *models.ProgressReport, tx db.Tx,
+) (*models.UserMedia, error) {
+	if p == nil {
+		return nil, fmt.Errorf("progress report: %w", errNil)
+	}
+	return ser.Play(&models.PlaybackEvent{
+		UserID:    p.UserID,
+		MediaID:   p.MediaID,
+		Kind:      models.PlaybackEventFinished,
+		EpisodeID: p.EpisodeID,
+		Time:      p.Time,
+	}, tx)
+}
+
+// scrobbleOf returns the Scrobble of the given playback event of the Media.
+func (u *mediaUnits) scrobbleOf(e *models.PlaybackEvent) (*models.Scrobble, error) {
+	mID := u.media.Meta.ID
+	s := models.Scrobble{
+		UserID:    e.UserID,
+		MediaID:   mID,
+		EpisodeID: e.EpisodeID,
+		Time:      e.Time,
+	}
+	if e.EpisodeID != nil && u.isSpecial(*e.EpisodeID) {
+		return &s, nil
+	}
+
+	var n int
+	switch {
+	case e.EpisodeID != nil:
+		i := indexOfEpisode(u.regular, *e.EpisodeID)
+		if i < 0 {
+			return nil, fmt.Errorf("Episode with ID %d: not of Media with ID %d: %w",
+				*e.EpisodeID, mID, ErrInvalid)
+		}
+		n = i + 1
+	case e.Episode != nil:
+		n = *e.Episode
+		if n < 1 || (len(u.regular) > 0 && n > len(u.regular)) {
+			return nil, fmt.Errorf("episode %d: not of Media with ID %d: %w", n, mID, ErrInvalid)
+		}
+		if n <= len(u.regular) {
+			epID := u.regular[n-1].Meta.ID
+			s.EpisodeID = &epID
+		}
+	case u.singleUnit():
+		n = 1
+	default:
+		return nil, fmt.Errorf("episode of Media with ID %d: %w", mID, ErrInvalid)
+	}
+
+	finished := e.Kind == models.PlaybackEventFinished
+	if !finished {
+		n--
+	}
+	s.Episodes = n
+	s.Completed = finished && (u.singleUnit() || n == len(u.regular))
+	return &s, nil
+}
+
+// scrobble stitches the given playback event into the UserMedia of its User
+// and Media, whose units are given.
+func (ser *UserMediaService) scrobble(
+	s *models.Scrobble, u *mediaUnits, tx db.Tx,
+) (*models.UserMedia, error) {
+	list, err := ser.GetFilter(nil, nil, tx, func(um *models.UserMedia) bool {
+		return um.UserID == s.UserID && um.MediaID == s.MediaID
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get UserMedia by User ID %d and Media ID %d: %w",
+			s.UserID, s.MediaID, err)
+	}
+
+	var um *models.UserMedia
+	if len(list) > 0 {
+		um = list[0]
+	} else {
+		um = &models.UserMedia{
+			UserID:  s.UserID,
+			MediaID: s.MediaID,
+		}
+	}
+
+	special := s.EpisodeID != nil && u.isSpecial(*s.EpisodeID)
+	if u.singleUnit() && s.Completed {
+		s.Episodes = 1
+	}
+
+	ser.stitch(um, s, special)
+
+	if um.Meta.ID == 0 {
+		_, err = ser.Create(um, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create UserMedia: %w", err)
+		}
+	} else {
+		err = ser.Update(um, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update UserMedia with ID %d: %w",
+				um.Meta.ID, err)
+		}
+	}
+	return um, nil
+}
+
+// stitch applies the given playback event to the WatchedInstances of the
+// given UserMedia. The EndDate of an ongoing instance is the time of its last
+// reported progress; see lastScrobbled.
+func (ser *UserMediaService) stitch(
+	um *models.UserMedia, s *models.Scrobble, special bool,
+) {
+	gap := ser.ScrobbleSessionGap
+	if gap <= 0 {
+		gap = DefaultScrobbleSessionGap
+	}
+	t := s.Time
+
+	episodes := s.Episodes
+	completed := s.Completed
+	if special {
+		// Specials are outside the regular numbering and never finish the
+		// Media, so the progress of the ongoing instance is kept
+		episodes, completed = 0, false
+		for _, wi := range um.WatchInstances {
+			if wi.Ongoing && wi.Episodes > episodes {
+				episodes = wi.Episodes
+			}
+		}
+	}
+
+	var cur *models.WatchedInstance
+	for i := range um.WatchInstances {
+		wi := &um.WatchInstances[i]
+		if !wi.Ongoing {
+			continue
+		}
+
+		// Events reported slightly out of order still belong to the session
+		continues := episodes >= wi.Episodes
+		if last := lastScrobbled(wi); last != nil {
+			continues = continues && t.Sub(*last) <= gap && last.Sub(t) <= gap
+		}
+		if continues && cur == nil {
+			cur = wi
+		} else {
+			wi.Ongoing = false
+		}
+	}
+
+	if cur == nil {
+		start := t
+		um.WatchInstances = append(um.WatchInstances, models.WatchedInstance{
+			Rewatch:   nextRewatch(um, special),
+			StartDate: &start,
+		})
+		cur = &um.WatchInstances[len(um.WatchInstances)-1]
+	}
+
+	if cur.EndDate == nil || t.After(*cur.EndDate) {
+		end := t
+		cur.EndDate = &end
+	}
+	cur.Episodes = episodes
+	cur.Ongoing = !completed
+	if special && !containsInt(cur.Specials, *s.EpisodeID) {
+		cur.Specials = append(cur.Specials, *s.EpisodeID)
+	}
+
+	status := models.WatchStatusCurrent
+	if completed {
+		status = models.WatchStatusCompleted
+	}
+	um.Status = &status
+}
+
+// lastScrobbled returns the time of the last progress of the given ongoing
+// WatchedInstance: its EndDate, or its StartDate if it has none, as those
+// recorded other than by scrobbling may not, or nil if it has neither, in
+// which case it is still open to any progress.
+func lastScrobbled(wi *models.WatchedInstance) *time.Time {
+	if wi.EndDate != nil {
+		return wi.EndDate
+	}
+	return wi.StartDate
+}
+
+func indexOfEpisode(eps []*models.Episode, epID int) int {
+	for i, ep := range eps {
+		if ep.Meta.ID == epID {
+			return i
+		}
+	}
+	return -1
+}
+
+func containsInt(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
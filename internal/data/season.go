@@ -0,0 +1,386 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// MediaSeasonService performs operations on MediaSeason, the index of Media
+// by the season they premiered in.
+type MediaSeasonService struct {
+	MediaService     *MediaService
+	UserMediaService *UserMediaService
+	Hooks            db.PersistHooks
+}
+
+// NewMediaSeasonService returns a MediaSeasonService.
+func NewMediaSeasonService(
+	hooks db.PersistHooks, mediaService *MediaService,
+	userMediaService *UserMediaService,
+) *MediaSeasonService {
+	// Initialize MediaSeasonService
+	mediaSeasonService := &MediaSeasonService{
+		MediaService:     mediaService,
+		UserMediaService: userMediaService,
+		Hooks:            hooks,
+	}
+
+	// Add hooks to keep Media indexed by the season they premiered in
+	indexMedia := func(m db.Model, _ db.Service, tx db.Tx) error {
+		md, err := mediaService.AssertType(m)
+		if err != nil {
+			return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+		err = mediaSeasonService.index(md.Meta.ID, &md.SeasonPremiered, tx)
+		if err != nil {
+			return fmt.Errorf("failed to index Media with ID %d: %w", md.Meta.ID, err)
+		}
+		return nil
+	}
+	unindexMedia := func(m db.Model, _ db.Service, tx db.Tx) error {
+		mID := m.Metadata().ID
+		err := mediaSeasonService.index(mID, nil, tx)
+		if err != nil {
+			return fmt.Errorf("failed to unindex Media with ID %d: %w", mID, err)
+		}
+		return nil
+	}
+	mdSerHooks := mediaService.PersistHooks()
+	mdSerHooks.PostCreateHooks = append(mdSerHooks.PostCreateHooks, indexMedia)
+	mdSerHooks.PostUpdateHooks = append(mdSerHooks.PostUpdateHooks, indexMedia)
+	mdSerHooks.PreDeleteHooks = append(mdSerHooks.PreDeleteHooks, unindexMedia)
+
+	return mediaSeasonService
+}
+
+// index moves the Media with the given ID to the index of the given season,
+// out of that of any other. The Media is only removed from the index if the
+// season is nil or incomplete.
+func (ser *MediaSeasonService) index(mID int, season *models.Season, tx db.Tx) error {
+	indexed := season != nil && season.Year != nil &&
+		season.Quarter != nil && season.Quarter.IsValid()
+
+	list, err := ser.GetAll(nil, nil, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get MediaSeasons: %w", err)
+	}
+
+	found := false
+	for _, s := range list {
+		target := indexed && s.Year == *season.Year && s.Quarter == *season.Quarter
+		if target {
+			found = true
+		}
+
+		i := indexOfInt(s.MediaIDs, mID)
+		switch {
+		case target && i < 0:
+			s.MediaIDs = append(s.MediaIDs, mID)
+		case !target && i >= 0:
+			s.MediaIDs = append(s.MediaIDs[:i], s.MediaIDs[i+1:]...)
+		default:
+			continue
+		}
+
+		if len(s.MediaIDs) == 0 {
+			err = ser.Delete(s.Meta.ID, tx)
+		} else {
+			err = ser.Update(s, tx)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update MediaSeason with ID %d: %w", s.Meta.ID, err)
+		}
+	}
+
+	if indexed && !found {
+		_, err = ser.Create(&models.MediaSeason{
+			Year:     *season.Year,
+			Quarter:  *season.Quarter,
+			MediaIDs: []int{mID},
+		}, tx)
+		if err != nil {
+			return fmt.Errorf("failed to create MediaSeason: %w", err)
+		}
+	}
+	return nil
+}
+
+// Reindex rebuilds the index from all persisted Media, returning the number
+// of Media indexed.
+func (ser *MediaSeasonService) Reindex(tx db.Tx) (int, error) {
+	err := tx.Database().DeleteFilter(ser, tx, func(db.Model) bool { return true })
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete MediaSeasons: %w", err)
+	}
+
+	list, err := ser.MediaService.GetAll(nil, nil, tx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get Media: %w", err)
+	}
+	n := 0
+	for _, md := range list {
+		s := md.SeasonPremiered
+		if s.Year == nil || s.Quarter == nil || !s.Quarter.IsValid() {
+			continue
+		}
+		err = ser.index(md.Meta.ID, &s, tx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to index Media with ID %d: %w", md.Meta.ID, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Chart returns the Media that premiered in the given season along with
+// their statistics, in the given order, only those that pass the given
+// filter if not nil.
+func (ser *MediaSeasonService) Chart(
+	year int, quarter models.Quarter, order models.MediaSort,
+	keep func(*models.Media) bool, first *int, skip *int, tx db.Tx,
+) ([]*models.SeasonEntry, error) {
+	if !quarter.IsValid() {
+		return nil, fmt.Errorf("quarter %d: %w", quarter, ErrInvalid)
+	}
+	if !order.IsValid() {
+		return nil, fmt.Errorf("sort %d: %w", order, ErrInvalid)
+	}
+
+	m, err := tx.Database().FindFirst(ser, tx, func(m db.Model) (bool, error) {
+		s, err := ser.AssertType(m)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+		return s.Year == year && s.Quarter == quarter, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate through keys: %w", err)
+	}
+	if m == nil {
+		return []*models.SeasonEntry{}, nil
+	}
+	season, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	if keep == nil {
+		keep = func(*models.Media) bool { return true }
+	}
+	mdList, err := ser.MediaService.GetMultiple(season.MediaIDs, tx, keep)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Media: %w", err)
+	}
+	stats, err := ser.stats(season.MediaIDs, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*models.SeasonEntry, len(mdList))
+	for i, md := range mdList {
+		list[i] = &models.SeasonEntry{Media: md, Stats: stats[md.Meta.ID]}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i].Stats, list[j].Stats
+		if order == models.MediaSortScore && !equalScores(a.Score, b.Score) {
+			return b.Score == nil || a.Score != nil && *a.Score > *b.Score
+		}
+		if a.Popularity != b.Popularity {
+			return a.Popularity > b.Popularity
+		}
+		return list[i].Media.Meta.ID < list[j].Media.Meta.ID
+	})
+
+	if skip != nil && *skip > 0 {
+		if *skip > len(list) {
+			return []*models.SeasonEntry{}, nil
+		}
+		list = list[*skip:]
+	}
+	if first != nil && *first >= 0 && *first < len(list) {
+		list = list[:*first]
+	}
+	return list, nil
+}
+
+// stats returns the statistics of the Media with the given IDs, by ID.
+func (ser *MediaSeasonService) stats(mIDs []int, tx db.Tx) (map[int]models.MediaStats, error) {
+	set := make(map[int]bool, len(mIDs))
+	for _, mID := range mIDs {
+		set[mID] = true
+	}
+	umList, err := ser.UserMediaService.GetFilter(nil, nil, tx, func(um *models.UserMedia) bool {
+		return set[um.MediaID]
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get UserMedia: %w", err)
+	}
+
+	sums := map[int]int{}
+	scored := map[int]int{}
+	stats := map[int]models.MediaStats{}
+	for _, um := range umList {
+		st := stats[um.MediaID]
+		st.Popularity++
+		stats[um.MediaID] = st
+		if um.Score != nil {
+			sums[um.MediaID] += *um.Score
+			scored[um.MediaID]++
+		}
+	}
+	for mID, n := range scored {
+		st := stats[mID]
+		score := (sums[mID] + n/2) / n
+		st.Score = &score
+		stats[mID] = st
+	}
+	return stats, nil
+}
+
+// equalScores checks if the given scores are both nil or equal.
+func equalScores(a *int, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// indexOfInt returns the index of the given value in the list, or -1 if it is
+// not in it.
+func indexOfInt(list []int, v int) int {
+	for i, x := range list {
+		if x == v {
+			return i
+		}
+	}
+	return -1
+}
+
+// Create persists the given MediaSeason.
+func (ser *MediaSeasonService) Create(s *models.MediaSeason, tx db.Tx) (int, error) {
+	return tx.Database().Create(s, ser, tx)
+}
+
+// Update replaces the value of the MediaSeason with the given ID.
+func (ser *MediaSeasonService) Update(s *models.MediaSeason, tx db.Tx) error {
+	return tx.Database().Update(s, ser, tx)
+}
+
+// Delete deletes the MediaSeason with the given ID.
+func (ser *MediaSeasonService) Delete(id int, tx db.Tx) error {
+	return tx.Database().Delete(id, ser, tx)
+}
+
+// GetAll retrieves all persisted values of MediaSeason.
+func (ser *MediaSeasonService) GetAll(
+	first *int, skip *int, tx db.Tx,
+) ([]*models.MediaSeason, error) {
+	vlist, err := tx.Database().GetAll(first, skip, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to MediaSeasons: %w", err)
+	}
+	return list, nil
+}
+
+// Bucket returns the name of the bucket for MediaSeason.
+func (ser *MediaSeasonService) Bucket() string {
+	return "MediaSeason"
+}
+
+// Clean cleans the given MediaSeason for storage.
+func (ser *MediaSeasonService) Clean(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// Validate returns an error if the MediaSeason is not valid for the database.
+func (ser *MediaSeasonService) Validate(m db.Model, _ db.Tx) error {
+	s, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	var verr ValidationError
+	if !s.Quarter.IsValid() {
+		verr.Addf("Quarter", FieldInvalid, "unknown quarter %d", s.Quarter)
+	}
+	return verr.Err()
+}
+
+// Initialize sets initial values for some properties.
+func (ser *MediaSeasonService) Initialize(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistOldProperties maintains certain properties of the existing
+// MediaSeason in updates.
+func (ser *MediaSeasonService) PersistOldProperties(_ db.Model, _ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistHooks returns the persistence hook functions.
+func (ser *MediaSeasonService) PersistHooks() *db.PersistHooks {
+	return &ser.Hooks
+}
+
+// Marshal encodes the given MediaSeason for storage.
+func (ser *MediaSeasonService) Marshal(m db.Model) ([]byte, error) {
+	s, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	v, err := db.Codecs.Encode(ser.Bucket(), s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
+	}
+
+	return v, nil
+}
+
+// Unmarshal decodes the given record into MediaSeason.
+func (ser *MediaSeasonService) Unmarshal(buf []byte) (db.Model, error) {
+	var s models.MediaSeason
+	err := db.Codecs.Decode(buf, &s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
+	}
+	return &s, nil
+}
+
+// AssertType exposes the given db.Model as a MediaSeason.
+func (ser *MediaSeasonService) AssertType(m db.Model) (*models.MediaSeason, error) {
+	if m == nil {
+		return nil, fmt.Errorf("model: %w", errNil)
+	}
+
+	s, ok := m.(*models.MediaSeason)
+	if !ok {
+		return nil, fmt.Errorf("model: %w", errors.New("not of MediaSeason type"))
+	}
+	return s, nil
+}
+
+// mapFromModel returns a list of MediaSeason type asserted from the given
+// list of db.Model.
+func (ser *MediaSeasonService) mapFromModel(
+	vlist []db.Model,
+) ([]*models.MediaSeason, error) {
+	list := make([]*models.MediaSeason, len(vlist))
+	var err error
+	for i, v := range vlist {
+		list[i], err = ser.AssertType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+	}
+	return list, nil
+}
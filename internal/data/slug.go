@@ -0,0 +1,440 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// MaxSlugLength is the most characters a generated Slug is made of, not
+// counting the suffix added to tell it apart from those of other entities.
+const MaxSlugLength = 64
+
+// slugLanguages are the language ranges of the Titles Slugs are preferably
+// generated from.
+var slugLanguages = []string{"en"}
+
+// SlugService performs operations on Slug, the index of Media, People,
+// Characters and Producers by their Slugs.
+type SlugService struct {
+	Hooks db.PersistHooks
+	// services are the services of the entities indexed.
+	services []db.Service
+}
+
+// NewSlugService returns a SlugService, which the given services clean the
+// Slugs of their entities with, keeping the entities indexed by them.
+func NewSlugService(
+	hooks db.PersistHooks, mediaService *MediaService, personService *PersonService,
+	characterService *CharacterService, producerService *ProducerService,
+) *SlugService {
+	// Initialize SlugService
+	slugService := &SlugService{
+		Hooks: hooks,
+		services: []db.Service{
+			mediaService, personService, characterService, producerService,
+		},
+	}
+	mediaService.SlugService = slugService
+	personService.SlugService = slugService
+	characterService.SlugService = slugService
+	producerService.SlugService = slugService
+
+	// Add hooks to keep the entities indexed by their Slugs
+	indexEntity := func(m db.Model, ser db.Service, tx db.Tx) error {
+		slug, err := slugOf(m)
+		if err != nil {
+			return err
+		}
+		id := m.Metadata().ID
+		err = slugService.index(ser.Bucket(), id, slug, tx)
+		if err != nil {
+			return fmt.Errorf("failed to index %s with ID %d: %w", ser.Bucket(), id, err)
+		}
+		return nil
+	}
+	unindexEntity := func(m db.Model, ser db.Service, tx db.Tx) error {
+		id := m.Metadata().ID
+		err := slugService.index(ser.Bucket(), id, "", tx)
+		if err != nil {
+			return fmt.Errorf("failed to unindex %s with ID %d: %w", ser.Bucket(), id, err)
+		}
+		return nil
+	}
+	for _, ser := range slugService.services {
+		serHooks := ser.PersistHooks()
+		serHooks.PostCreateHooks = append(serHooks.PostCreateHooks, indexEntity)
+		serHooks.PostUpdateHooks = append(serHooks.PostUpdateHooks, indexEntity)
+		serHooks.PreDeleteHooks = append(serHooks.PreDeleteHooks, unindexEntity)
+	}
+
+	return slugService
+}
+
+// slugOf returns the Slug of the given entity.
+func slugOf(m db.Model) (string, error) {
+	switch e := m.(type) {
+	case *models.Media:
+		return e.Slug, nil
+	case *models.Person:
+		return e.Slug, nil
+	case *models.Character:
+		return e.Slug, nil
+	case *models.Producer:
+		return e.Slug, nil
+	}
+	return "", fmt.Errorf("model: %w", errors.New("not of a type with a Slug"))
+}
+
+// Slugify returns the Slug made of the lowercase letters and digits of the
+// given string, with hyphens in place of the runs of other characters between
+// them.
+func Slugify(s string) string {
+	var b strings.Builder
+	sep := false
+	for _, r := range strings.ToLower(s) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			sep = b.Len() > 0
+			continue
+		}
+		if sep {
+			b.WriteByte('-')
+			sep = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// generateSlug returns the Slug of the first of the given Titles, preferably
+// an English one, that has any letters or digits, cut to MaxSlugLength, or an
+// empty string if none does.
+func generateSlug(titles []models.Title) string {
+	for _, t := range models.LocalizeTitles(titles, slugLanguages) {
+		slug := Slugify(t.String)
+		if slug == "" {
+			continue
+		}
+		runes := []rune(slug)
+		if len(runes) > MaxSlugLength {
+			slug = strings.TrimRight(string(runes[:MaxSlugLength]), "-")
+		}
+		return slug
+	}
+	return ""
+}
+
+// clean returns the Slug of the entity of the given bucket and ID, which is 0
+// if it has not yet been persisted. A given Slug is normalized by Slugify, and
+// must not be held by another entity of the bucket. Otherwise, the Slug the
+// entity is indexed by is kept, so that it does not change with the Titles,
+// or a new one is generated from the given Titles, or the bucket name if none
+// may be, suffixed by the lowest number from 2 that tells it apart from the
+// Slugs of the other entities. Slugs are only normalized and generated if the
+// SlugService is nil.
+func (ser *SlugService) clean(
+	bucket string, id int, slug string, titles []models.Title, tx db.Tx,
+) (string, error) {
+	slug = Slugify(slug)
+	if ser == nil {
+		if slug == "" {
+			slug = generateSlug(titles)
+		}
+		return slug, nil
+	}
+
+	list, err := ser.getBucket(bucket, tx)
+	if err != nil {
+		return "", err
+	}
+	held := make(map[string]bool, len(list))
+	for _, s := range list {
+		if s.ModelID == id {
+			if slug == "" {
+				return s.Slug, nil
+			}
+			continue
+		}
+		held[s.Slug] = true
+	}
+
+	if slug != "" {
+		if held[slug] {
+			return "", fmt.Errorf("slug %q: %w", slug, ErrConflict)
+		}
+		return slug, nil
+	}
+
+	base := generateSlug(titles)
+	if base == "" {
+		base = Slugify(bucket)
+	}
+	slug = base
+	for n := 2; held[slug]; n++ {
+		slug = fmt.Sprintf("%s-%d", base, n)
+	}
+	return slug, nil
+}
+
+// index moves the entity of the given bucket and ID to the given Slug, out
+// of any other. The entity is only removed from the index if the Slug is
+// empty.
+func (ser *SlugService) index(bucket string, id int, slug string, tx db.Tx) error {
+	list, err := ser.getBucket(bucket, tx)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range list {
+		if s.ModelID != id {
+			continue
+		}
+		if s.Slug == slug {
+			return nil
+		}
+		if slug == "" {
+			err = ser.Delete(s.Meta.ID, tx)
+		} else {
+			s.Slug = slug
+			err = ser.Update(s, tx)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update Slug with ID %d: %w", s.Meta.ID, err)
+		}
+		return nil
+	}
+
+	if slug == "" {
+		return nil
+	}
+	_, err = ser.Create(&models.Slug{Bucket: bucket, Slug: slug, ModelID: id}, tx)
+	if err != nil {
+		return fmt.Errorf("failed to create Slug: %w", err)
+	}
+	return nil
+}
+
+// Reindex rebuilds the index from all persisted entities, returning the
+// number of entities indexed. Entities without Slugs, such as those persisted
+// before Slugs were, are updated with generated ones after those with Slugs
+// are indexed, so that they do not take any of theirs.
+func (ser *SlugService) Reindex(tx db.Tx) (int, error) {
+	err := tx.Database().DeleteFilter(ser, tx, func(db.Model) bool { return true })
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete Slugs: %w", err)
+	}
+
+	n := 0
+	unslugged := map[db.Service][]db.Model{}
+	for _, entSer := range ser.services {
+		list, err := tx.Database().GetAll(nil, nil, entSer, tx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get %s: %w", entSer.Bucket(), err)
+		}
+		for _, m := range list {
+			slug, err := slugOf(m)
+			if err != nil {
+				return 0, err
+			}
+			if slug == "" {
+				unslugged[entSer] = append(unslugged[entSer], m)
+				continue
+			}
+			err = ser.index(entSer.Bucket(), m.Metadata().ID, slug, tx)
+			if err != nil {
+				return 0, fmt.Errorf("failed to index %s with ID %d: %w",
+					entSer.Bucket(), m.Metadata().ID, err)
+			}
+			n++
+		}
+	}
+
+	// Entities are indexed by the hooks of their updates
+	for _, entSer := range ser.services {
+		for _, m := range unslugged[entSer] {
+			err = tx.Database().Update(m, entSer, tx)
+			if err != nil {
+				return 0, fmt.Errorf("failed to update %s with ID %d: %w",
+					entSer.Bucket(), m.Metadata().ID, err)
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+// ID returns the ID of the entity of the given bucket with the given Slug.
+func (ser *SlugService) ID(bucket string, slug string, tx db.Tx) (int, error) {
+	m, err := tx.Database().FindFirst(ser, tx, func(m db.Model) (bool, error) {
+		s, err := ser.AssertType(m)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+		return s.Bucket == bucket && s.Slug == slug, nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to iterate through keys: %w", err)
+	}
+	if m == nil {
+		return 0, fmt.Errorf("%s with slug %q: %w", bucket, slug, ErrNotFound)
+	}
+
+	s, err := ser.AssertType(m)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return s.ModelID, nil
+}
+
+// getBucket retrieves the Slugs of the entities of the given bucket.
+func (ser *SlugService) getBucket(bucket string, tx db.Tx) ([]*models.Slug, error) {
+	vlist, err := tx.Database().GetFilter(nil, nil, ser, tx, func(m db.Model) bool {
+		s, err := ser.AssertType(m)
+		return err == nil && s.Bucket == bucket
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Slugs of %s: %w", bucket, err)
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to Slugs: %w", err)
+	}
+	return list, nil
+}
+
+// Create persists the given Slug.
+func (ser *SlugService) Create(s *models.Slug, tx db.Tx) (int, error) {
+	return tx.Database().Create(s, ser, tx)
+}
+
+// Update replaces the value of the Slug with the given ID.
+func (ser *SlugService) Update(s *models.Slug, tx db.Tx) error {
+	return tx.Database().Update(s, ser, tx)
+}
+
+// Delete deletes the Slug with the given ID.
+func (ser *SlugService) Delete(id int, tx db.Tx) error {
+	return tx.Database().Delete(id, ser, tx)
+}
+
+// GetAll retrieves all persisted values of Slug.
+func (ser *SlugService) GetAll(first *int, skip *int, tx db.Tx) ([]*models.Slug, error) {
+	vlist, err := tx.Database().GetAll(first, skip, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to Slugs: %w", err)
+	}
+	return list, nil
+}
+
+// Bucket returns the name of the bucket for Slug.
+func (ser *SlugService) Bucket() string {
+	return "Slug"
+}
+
+// UniqueKey returns the bucket of the entity and the Slug.
+func (ser *SlugService) UniqueKey(m db.Model) (string, error) {
+	s, err := ser.AssertType(m)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return s.Bucket + "/" + s.Slug, nil
+}
+
+// Clean cleans the given Slug for storage.
+func (ser *SlugService) Clean(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// Validate returns an error if the Slug is not valid for the database.
+func (ser *SlugService) Validate(m db.Model, _ db.Tx) error {
+	s, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	var verr ValidationError
+	if s.Slug == "" {
+		verr.Add("Slug", FieldRequired, "must not be empty")
+	} else if Slugify(s.Slug) != s.Slug {
+		verr.Addf("Slug", FieldInvalid, "%q: not a slug", s.Slug)
+	}
+	return verr.Err()
+}
+
+// Initialize sets initial values for some properties.
+func (ser *SlugService) Initialize(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistOldProperties maintains certain properties of the existing Slug in
+// updates.
+func (ser *SlugService) PersistOldProperties(_ db.Model, _ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistHooks returns the persistence hook functions.
+func (ser *SlugService) PersistHooks() *db.PersistHooks {
+	return &ser.Hooks
+}
+
+// Marshal encodes the given Slug for storage.
+func (ser *SlugService) Marshal(m db.Model) ([]byte, error) {
+	s, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	v, err := db.Codecs.Encode(ser.Bucket(), s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
+	}
+
+	return v, nil
+}
+
+// Unmarshal decodes the given record into Slug.
+func (ser *SlugService) Unmarshal(buf []byte) (db.Model, error) {
+	var s models.Slug
+	err := db.Codecs.Decode(buf, &s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
+	}
+	return &s, nil
+}
+
+// AssertType exposes the given db.Model as a Slug.
+func (ser *SlugService) AssertType(m db.Model) (*models.Slug, error) {
+	if m == nil {
+		return nil, fmt.Errorf("model: %w", errNil)
+	}
+
+	s, ok := m.(*models.Slug)
+	if !ok {
+		return nil, fmt.Errorf("model: %w", errors.New("not of Slug type"))
+	}
+	return s, nil
+}
+
+// mapFromModel returns a list of Slug type asserted from the given list of
+// db.Model.
+func (ser *SlugService) mapFromModel(vlist []db.Model) ([]*models.Slug, error) {
+	list := make([]*models.Slug, len(vlist))
+	var err error
+	for i, v := range vlist {
+		list[i], err = ser.AssertType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+	}
+	return list, nil
+}
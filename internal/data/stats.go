@@ -0,0 +1,256 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// WrapupGenres is the number of top Genres in a Wrapup.
+const WrapupGenres = 5
+
+// StatsService computes statistics of the watch history of Users from their
+// WatchSessions.
+type StatsService struct {
+	WatchSessionService *WatchSessionService
+	EpisodeService      *EpisodeService
+	MediaGenreService   *MediaGenreService
+	// UserMediaService retrieves the watches sessions are part of; no time
+	// counts as rewatching if it is not set.
+	UserMediaService *UserMediaService
+}
+
+// Heatmap returns the number of Episodes the User with the given ID watched
+// on each day of the given year, in the given location. The Episodes of a
+// WatchSession are counted on the day it started; a session without Episodes,
+// as of Media watched as a single unit, counts as one.
+func (ser *StatsService) Heatmap(
+	uID int, year int, loc *time.Location, tx db.Tx,
+) (*models.Heatmap, error) {
+	sessions, err := ser.sessionsIn(uID, year, loc, tx)
+	if err != nil {
+		return nil, err
+	}
+	return heatmapOf(uID, year, loc, sessions), nil
+}
+
+// Wrapup returns a summary of the watching of the User with the given ID over
+// the given year, in the given location. Episodes are counted as in Heatmap.
+// The time spent watching is the sum of the durations of the Episodes
+// watched; sessions of no Episodes of known duration count the time between
+// their first and last reports instead. The time of sessions that started
+// during rewatches of their Media is also counted separately.
+func (ser *StatsService) Wrapup(
+	uID int, year int, loc *time.Location, tx db.Tx,
+) (*models.Wrapup, error) {
+	sessions, err := ser.sessionsIn(uID, year, loc, tx)
+	if err != nil {
+		return nil, err
+	}
+	hm := heatmapOf(uID, year, loc, sessions)
+
+	wu := models.Wrapup{
+		UserID:        uID,
+		Year:          year,
+		Episodes:      hm.Episodes,
+		LongestStreak: longestStreak(hm.Days),
+		TopGenres:     []models.GenreCount{},
+	}
+
+	// Durations of the Episodes watched
+	ids := []int{}
+	for _, ws := range sessions {
+		ids = append(ids, ws.Episodes...)
+	}
+	eps, err := ser.EpisodeService.GetMultiple(ids, tx, func(_ *models.Episode) bool {
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Episodes: %w", err)
+	}
+	minutes := map[int]int{}
+	for _, ep := range eps {
+		if ep.Duration != nil {
+			minutes[ep.Meta.ID] = *ep.Duration
+		}
+	}
+
+	rewatching, err := ser.rewatching(sessions, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var watched, rewatched time.Duration
+	byMedia := map[int]int{}
+	for _, ws := range sessions {
+		var d time.Duration
+		for _, epID := range ws.Episodes {
+			d += time.Duration(minutes[epID]) * time.Minute
+		}
+		if d == 0 {
+			d = ws.Duration()
+		}
+		watched += d
+		if rewatching[ws.Meta.ID] {
+			rewatched += d
+		}
+		byMedia[ws.MediaID] += sessionEpisodes(ws)
+	}
+	wu.Hours = watched.Hours()
+	wu.RewatchHours = rewatched.Hours()
+	wu.Media = len(byMedia)
+
+	byGenre := map[int]int{}
+	for mID, n := range byMedia {
+		mgs, err := ser.MediaGenreService.GetByMedia(mID, nil, nil, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get MediaGenres by Media ID %d: %w", mID, err)
+		}
+		for _, mg := range mgs {
+			byGenre[mg.GenreID] += n
+		}
+	}
+	for gID, n := range byGenre {
+		wu.TopGenres = append(wu.TopGenres, models.GenreCount{GenreID: gID, Episodes: n})
+	}
+	sort.Slice(wu.TopGenres, func(i, j int) bool {
+		a, b := wu.TopGenres[i], wu.TopGenres[j]
+		if a.Episodes != b.Episodes {
+			return a.Episodes > b.Episodes
+		}
+		return a.GenreID < b.GenreID
+	})
+	if len(wu.TopGenres) > WrapupGenres {
+		wu.TopGenres = wu.TopGenres[:WrapupGenres]
+	}
+
+	return &wu, nil
+}
+
+// sessionsIn retrieves the WatchSessions of the User with the given ID that
+// started in the given year, in the given location.
+func (ser *StatsService) sessionsIn(
+	uID int, year int, loc *time.Location, tx db.Tx,
+) ([]*models.WatchSession, error) {
+	if year < 1 || year > 9999 {
+		return nil, fmt.Errorf("year %d: %w", year, ErrInvalid)
+	}
+	start, end := yearBounds(year, loc)
+	list, err := ser.WatchSessionService.GetFilterParallel(nil, nil, tx,
+		func(ws *models.WatchSession) bool {
+			return ws.UserID == uID && !ws.Start.Before(start) && ws.Start.Before(end)
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get WatchSessions of User with ID %d: %w", uID, err)
+	}
+	return list, nil
+}
+
+// rewatching returns whether each of the given WatchSessions, by ID, started
+// during a rewatch of its Media, that is the latest watch of its UserMedia
+// started by then is a rewatch.
+func (ser *StatsService) rewatching(
+	sessions []*models.WatchSession, tx db.Tx,
+) (map[int]bool, error) {
+	rewatching := map[int]bool{}
+	if ser.UserMediaService == nil {
+		return rewatching, nil
+	}
+
+	ids := []int{}
+	seen := map[int]bool{}
+	for _, ws := range sessions {
+		if !seen[ws.UserMediaID] {
+			seen[ws.UserMediaID] = true
+			ids = append(ids, ws.UserMediaID)
+		}
+	}
+	list, err := ser.UserMediaService.GetMultiple(ids, tx, func(_ *models.UserMedia) bool {
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get UserMedia of WatchSessions: %w", err)
+	}
+	byID := map[int]*models.UserMedia{}
+	for _, um := range list {
+		byID[um.Meta.ID] = um
+	}
+
+	for _, ws := range sessions {
+		um, ok := byID[ws.UserMediaID]
+		if !ok {
+			continue
+		}
+		var at *models.WatchedInstance
+		for i := range um.WatchInstances {
+			wi := &um.WatchInstances[i]
+			if wi.StartDate == nil || wi.StartDate.After(ws.Start) {
+				continue
+			}
+			if at == nil || !wi.StartDate.Before(*at.StartDate) {
+				at = wi
+			}
+		}
+		rewatching[ws.Meta.ID] = at != nil && at.Rewatch > 0
+	}
+	return rewatching, nil
+}
+
+// yearBounds returns the start of the given year and of the year after, in
+// the given location, or UTC if nil.
+func yearBounds(year int, loc *time.Location) (time.Time, time.Time) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+	return start, start.AddDate(1, 0, 0)
+}
+
+// heatmapOf returns the Heatmap of the given WatchSessions, all of which
+// started in the given year.
+func heatmapOf(
+	uID int, year int, loc *time.Location, sessions []*models.WatchSession,
+) *models.Heatmap {
+	start, end := yearBounds(year, loc)
+	hm := models.Heatmap{UserID: uID, Year: year, Days: []models.HeatmapDay{}}
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		hm.Days = append(hm.Days, models.HeatmapDay{Date: d})
+	}
+
+	for _, ws := range sessions {
+		n := sessionEpisodes(ws)
+		hm.Days[ws.Start.In(start.Location()).YearDay()-1].Episodes += n
+		hm.Episodes += n
+	}
+	return &hm
+}
+
+// sessionEpisodes returns the number of Episodes watched in the given
+// WatchSession, which is one for sessions of Media watched as a single unit.
+func sessionEpisodes(ws *models.WatchSession) int {
+	if len(ws.Episodes) == 0 {
+		return 1
+	}
+	return len(ws.Episodes)
+}
+
+// longestStreak returns the first of the longest runs of consecutive days in
+// the given list on which some Episodes were watched.
+func longestStreak(days []models.HeatmapDay) models.Streak {
+	var best models.Streak
+	run := 0
+	for i, d := range days {
+		if d.Episodes == 0 {
+			run = 0
+			continue
+		}
+		run++
+		if run > best.Days {
+			best = models.Streak{Days: run, Start: days[i-run+1].Date, End: d.Date}
+		}
+	}
+	return best
+}
@@ -0,0 +1,103 @@
+package data
+
+import (
+	"fmt"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// SetCustomStatuses replaces the CustomStatuses of the User with the given ID
+// and updates their UserMedia to match: those of removed custom statuses keep
+// their Status without a custom status, and those of custom statuses mapped
+// to another WatchStatus take it as their Status.
+func (ser *UserMediaService) SetCustomStatuses(
+	uID int, statuses []models.CustomStatus, tx db.Tx,
+) (*models.User, error) {
+	u, err := ser.UserService.GetByID(uID, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get User by ID %d: %w", uID, err)
+	}
+	u.CustomStatuses = statuses
+	err = ser.UserService.Update(u, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update User with ID %d: %w", uID, err)
+	}
+
+	list, err := ser.GetFilter(nil, nil, tx, func(um *models.UserMedia) bool {
+		return um.UserID == uID && um.CustomStatus != nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get UserMedia by User ID %d: %w", uID, err)
+	}
+	for _, um := range list {
+		cs := u.CustomStatus(*um.CustomStatus)
+		switch {
+		case cs == nil:
+			um.CustomStatus = nil
+		case um.Status != nil && *um.Status == cs.Status:
+			continue
+		}
+		// The Status of UserMedia left with custom statuses is mapped as they
+		// are updated
+
+		err = ser.Update(um, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update UserMedia with ID %d: %w", um.Meta.ID, err)
+		}
+	}
+	return u, nil
+}
+
+// mapCustomStatus sets the Status of the given UserMedia to the WatchStatus
+// its custom status maps to, if it has one.
+func (ser *UserMediaService) mapCustomStatus(um *models.UserMedia, tx db.Tx) error {
+	if um.CustomStatus == nil {
+		return nil
+	}
+
+	u, err := ser.UserService.GetByID(um.UserID, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get User by ID %d: %w", um.UserID, err)
+	}
+	cs := u.CustomStatus(*um.CustomStatus)
+	if cs == nil {
+		return fmt.Errorf("custom status %q: %w", *um.CustomStatus, ErrInvalid)
+	}
+	status := cs.Status
+	um.Status = &status
+	return nil
+}
+
+// validateCustomStatuses adds the errors of the given CustomStatuses of a User
+// to the given ValidationError.
+func validateCustomStatuses(statuses []models.CustomStatus, verr *ValidationError) {
+	if len(statuses) > models.MaxCustomStatuses {
+		verr.Addf("CustomStatuses", FieldOutOfRange, "%d: must be at most %d",
+			len(statuses), models.MaxCustomStatuses)
+	}
+
+	keys := map[string]bool{}
+	for i, cs := range statuses {
+		field := fmt.Sprintf("CustomStatuses[%d]", i)
+		switch {
+		case !cs.IsValidKey():
+			verr.Addf(field+".Key", FieldInvalid,
+				"%q: must be lower case letters and digits separated by hyphens", cs.Key)
+		case keys[cs.Key]:
+			verr.Addf(field+".Key", FieldInvalid, "%q: defined more than once", cs.Key)
+		}
+		keys[cs.Key] = true
+
+		if cs.Label == "" {
+			verr.Add(field+".Label", FieldRequired, "must not be empty")
+		}
+		if !cs.IsValidColor() {
+			verr.Addf(field+".Color", FieldInvalid, "%q: must be a hex triplet such as #ff8800",
+				cs.Color)
+		}
+		if !cs.Status.IsValid() {
+			verr.Addf(field+".Status", FieldInvalid, "unknown status %d", cs.Status)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	json "github.com/json-iterator/go"
+)
+
+// SyncType is a type of entity owned by Users that clients may sync.
+type SyncType struct {
+	Service db.Service
+	// New returns an empty entity of the type to decode changes into.
+	New func() db.Model
+	// Owner returns the ID of the User owning the given entity.
+	Owner func(m db.Model) (int, error)
+}
+
+// SyncService applies the changes clients push from their local copies of
+// the entities of Users, and lists the entities changed since clients last
+// synced. Changes to the synced entities are recorded in the change log with
+// their Users, and deletions are kept there as tombstones.
+type SyncService struct {
+	ChangeService *ChangeService
+	types         map[string]*SyncType
+}
+
+// NewSyncService returns a SyncService without any types to sync.
+func NewSyncService(changeService *ChangeService, userService *UserService) *SyncService {
+	syncService := &SyncService{
+		ChangeService: changeService,
+		types:         map[string]*SyncType{},
+	}
+
+	// Add hook to delete the Changes of Users once their entities are deleted
+	deleteChangesOnDeleteUser := func(u db.Model, _ db.Service, tx db.Tx) error {
+		uID := u.Metadata().ID
+		err := changeService.DeleteByUser(uID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to delete Changes by User ID %d: %w", uID, err)
+		}
+		return nil
+	}
+	uSerHooks := userService.PersistHooks()
+	uSerHooks.PostDeleteHooks =
+		append(uSerHooks.PostDeleteHooks, deleteChangesOnDeleteUser)
+
+	return syncService
+}
+
+// Register makes the entities of the given type syncable.
+func (ser *SyncService) Register(t SyncType) {
+	ser.types[t.Service.Bucket()] = &t
+	ser.ChangeService.TrackOwned(t.Service, t.Owner)
+}
+
+// Types returns the names of the types of entities that may be synced.
+func (ser *SyncService) Types() []string {
+	names := make([]string, 0, len(ser.types))
+	for name := range ser.types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Push applies the given changes made by the caller to the entities of their
+// User, in order. Changes to entities changed since the versions they were
+// based on are returned as conflicts along with the entities as they are,
+// and invalid changes are rejected; neither are applied. Deletions of
+// entities already deleted are applied.
+func (ser *SyncService) Push(
+	caller *models.User, changes []*models.SyncChange, tx db.Tx,
+) (*models.SyncResult, error) {
+	res := models.SyncResult{
+		Applied:   []*models.SyncApplied{},
+		Conflicts: []*models.SyncConflict{},
+		Rejected:  []*models.SyncRejected{},
+	}
+	for i, c := range changes {
+		err := ser.apply(caller, i, c, &res, tx)
+		if err != nil {
+			return nil, fmt.Errorf("change %d: %w", i, err)
+		}
+	}
+	return &res, nil
+}
+
+// apply applies the change at the given index of a pushed batch and records
+// its outcome in res. Only errors that abort the batch are returned.
+func (ser *SyncService) apply(
+	caller *models.User, i int, c *models.SyncChange, res *models.SyncResult, tx db.Tx,
+) error {
+	reject := func(err error) error {
+		res.Rejected = append(res.Rejected, &models.SyncRejected{Index: i, Error: err.Error()})
+		return nil
+	}
+
+	if c == nil {
+		return reject(fmt.Errorf("change: %w", errNil))
+	}
+	t, ok := ser.types[c.Type]
+	if !ok {
+		return reject(fmt.Errorf("type %q: not synced: %w", c.Type, ErrInvalid))
+	}
+	if !c.Action.IsValid() {
+		return reject(fmt.Errorf("action %d: %w", c.Action, ErrInvalid))
+	}
+
+	var m db.Model
+	if c.Action != models.ChangeActionDelete {
+		m = t.New()
+		err := json.Unmarshal(c.Entity, m)
+		if err != nil {
+			return reject(fmt.Errorf("entity: %v: %w", err, ErrInvalid))
+		}
+	}
+
+	dbs := tx.Database()
+	if c.Action == models.ChangeActionCreate {
+		err := ser.authorize(caller, t, m)
+		if err != nil {
+			return reject(err)
+		}
+		*m.Metadata() = db.ModelMetadata{}
+		err = t.Service.Validate(m, tx)
+		if err != nil {
+			return reject(err)
+		}
+
+		id, err := dbs.Create(m, t.Service, tx)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", c.Type, err)
+		}
+		res.Applied = append(res.Applied, &models.SyncApplied{Index: i, ID: id})
+		return nil
+	}
+
+	cur, err := dbs.GetByID(c.ID, t.Service, tx)
+	if errors.Is(err, ErrNotFound) {
+		if c.Action == models.ChangeActionDelete {
+			res.Applied = append(res.Applied, &models.SyncApplied{Index: i, ID: c.ID})
+			return nil
+		}
+		res.Conflicts = append(res.Conflicts, &models.SyncConflict{
+			Index:   i,
+			Change:  c,
+			Server:  []byte("null"),
+			Deleted: true,
+		})
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get %s by ID %d: %w", c.Type, c.ID, err)
+	}
+	err = ser.authorize(caller, t, cur)
+	if err != nil {
+		return reject(err)
+	}
+
+	meta := cur.Metadata()
+	if meta.Version != c.BaseVersion {
+		server, err := json.Marshal(cur)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s with ID %d: %w", c.Type, c.ID, err)
+		}
+		res.Conflicts = append(res.Conflicts, &models.SyncConflict{
+			Index:   i,
+			Change:  c,
+			Server:  server,
+			Version: meta.Version,
+		})
+		return nil
+	}
+
+	if c.Action == models.ChangeActionDelete {
+		err = dbs.Delete(c.ID, t.Service, tx)
+		if err != nil {
+			return fmt.Errorf("failed to delete %s with ID %d: %w", c.Type, c.ID, err)
+		}
+		res.Applied = append(res.Applied, &models.SyncApplied{Index: i, ID: c.ID})
+		return nil
+	}
+
+	// Entities may not be given away to other Users
+	curOwner, err := t.Owner(cur)
+	if err != nil {
+		return fmt.Errorf("failed to get owner of %s with ID %d: %w", c.Type, c.ID, err)
+	}
+	owner, err := t.Owner(m)
+	if err != nil {
+		return reject(err)
+	}
+	if owner != curOwner {
+		return reject(fmt.Errorf("owner %d: must be %d: %w", owner, curOwner, ErrInvalid))
+	}
+	*m.Metadata() = *meta
+	err = t.Service.Validate(m, tx)
+	if err != nil {
+		return reject(err)
+	}
+
+	err = dbs.Update(m, t.Service, tx)
+	if err != nil {
+		return fmt.Errorf("failed to update %s with ID %d: %w", c.Type, c.ID, err)
+	}
+	res.Applied = append(res.Applied, &models.SyncApplied{
+		Index:   i,
+		ID:      c.ID,
+		Version: m.Metadata().Version,
+	})
+	return nil
+}
+
+// authorize returns an error wrapping ErrUnauthorized unless the caller may
+// sync the given entity.
+func (ser *SyncService) authorize(caller *models.User, t *SyncType, m db.Model) error {
+	owner, err := t.Owner(m)
+	if err != nil {
+		return err
+	}
+	return AuthorizeOwner(caller, owner)
+}
+
+// Pull returns the entities of the User with the given ID changed after
+// since, in the order of their last changes, from at most first Changes if
+// not nil. If since is nil, all the entities of the User are returned, as of
+// the given time.
+func (ser *SyncService) Pull(
+	uID int, since *time.Time, first *int, now time.Time, tx db.Tx,
+) (*models.SyncPull, error) {
+	if since == nil {
+		return ser.pullAll(uID, now, tx)
+	}
+
+	changes, err := ser.ChangeService.GetSince(*since, nil, nil, tx, func(c *models.Change) bool {
+		_, ok := ser.types[c.Bucket]
+		return ok && c.UserID == uID
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Changes: %w", err)
+	}
+
+	pull := models.SyncPull{Since: since, Entities: []*models.SyncEntity{}, Next: *since}
+	if first != nil && *first >= 0 && *first < len(changes) {
+		changes = changes[:*first]
+		pull.More = true
+	}
+	if len(changes) > 0 {
+		pull.Next = changes[len(changes)-1].Meta.CreatedAt
+	}
+
+	// Only the last Change to each entity is pulled, so walk them backwards
+	seen := map[string]map[int]bool{}
+	for i := len(changes) - 1; i >= 0; i-- {
+		c := changes[i]
+		if seen[c.Bucket] == nil {
+			seen[c.Bucket] = map[int]bool{}
+		}
+		if seen[c.Bucket][c.EntityID] {
+			continue
+		}
+		seen[c.Bucket][c.EntityID] = true
+
+		e := models.SyncEntity{
+			Type:      c.Bucket,
+			ID:        c.EntityID,
+			Action:    c.Action,
+			ChangedAt: c.Meta.CreatedAt,
+			Entity:    []byte("null"),
+		}
+		m, err := tx.Database().GetByID(c.EntityID, ser.types[c.Bucket].Service, tx)
+		if errors.Is(err, ErrNotFound) {
+			e.Deleted = true
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to get %s by ID %d: %w", c.Bucket, c.EntityID, err)
+		} else {
+			e.Entity, err = json.Marshal(m)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode %s with ID %d: %w",
+					c.Bucket, c.EntityID, err)
+			}
+		}
+		pull.Entities = append(pull.Entities, &e)
+	}
+	for i, j := 0, len(pull.Entities)-1; i < j; i, j = i+1, j-1 {
+		pull.Entities[i], pull.Entities[j] = pull.Entities[j], pull.Entities[i]
+	}
+	return &pull, nil
+}
+
+// pullAll returns all the entities of the User with the given ID, as of the
+// given time.
+func (ser *SyncService) pullAll(uID int, now time.Time, tx db.Tx) (*models.SyncPull, error) {
+	pull := models.SyncPull{Entities: []*models.SyncEntity{}, Next: now}
+	for _, name := range ser.Types() {
+		t := ser.types[name]
+		list, err := tx.Database().GetFilter(nil, nil, t.Service, tx, func(m db.Model) bool {
+			owner, err := t.Owner(m)
+			return err == nil && owner == uID
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s by User ID %d: %w", name, uID, err)
+		}
+
+		for _, m := range list {
+			buf, err := json.Marshal(m)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode %s with ID %d: %w",
+					name, m.Metadata().ID, err)
+			}
+			meta := m.Metadata()
+			action := models.ChangeActionCreate
+			if meta.Version > 0 {
+				action = models.ChangeActionUpdate
+			}
+			pull.Entities = append(pull.Entities, &models.SyncEntity{
+				Type:      name,
+				ID:        meta.ID,
+				Action:    action,
+				ChangedAt: meta.UpdatedAt,
+				Entity:    buf,
+			})
+		}
+	}
+	return &pull, nil
+}
@@ -0,0 +1,23 @@
+package data
+
+import (
+	"fmt"
+
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// cleanTitles puts the language tags of the given sets of Titles in canonical
+// case, returning an error wrapping ErrInvalid if any is not a well-formed
+// BCP-47 tag.
+func cleanTitles(sets ...[]models.Title) error {
+	for _, set := range sets {
+		for i := range set {
+			lang, err := models.CanonicalLanguage(set[i].Language)
+			if err != nil {
+				return fmt.Errorf("title %q: %v: %w", set[i].String, err, ErrInvalid)
+			}
+			set[i].Language = lang
+		}
+	}
+	return nil
+}
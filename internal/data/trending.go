@@ -0,0 +1,157 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// DefaultTrendingWindow is the period of activity trends are computed over
+// if not configured.
+const DefaultTrendingWindow = 7 * 24 * time.Hour
+
+// TrendWeights are the weights of the kinds of events in trending scores.
+type TrendWeights struct {
+	Add        float64
+	Completion float64
+	Score      float64
+}
+
+// DefaultTrendWeights are the weights of events if not configured.
+var DefaultTrendWeights = TrendWeights{Add: 1, Completion: 2, Score: 1}
+
+// TrendingService computes the Media trending in the recent activity of
+// Users and keeps the latest result.
+type TrendingService struct {
+	UserMediaService *UserMediaService
+	ActivityService  *ActivityService
+	// Window is the period before each computation whose events are counted.
+	// DefaultTrendingWindow is used if not positive.
+	Window time.Duration
+	// Weights are the weights of the kinds of events; DefaultTrendWeights is
+	// used if zero.
+	Weights TrendWeights
+
+	mu      sync.RWMutex
+	trends  []*models.Trend
+	updated time.Time
+}
+
+// Refresh recomputes the trends from the events in the window before the
+// given time: UserMedia created, and Activities of completion and scoring.
+// Each event counts its weight, scaled down linearly with its age.
+func (ser *TrendingService) Refresh(now time.Time, tx db.Tx) error {
+	window := ser.Window
+	if window <= 0 {
+		window = DefaultTrendingWindow
+	}
+	weights := ser.Weights
+	if weights == (TrendWeights{}) {
+		weights = DefaultTrendWeights
+	}
+	since := now.Add(-window)
+	inWindow := func(t time.Time) bool {
+		return t.After(since) && !t.After(now)
+	}
+	recency := func(t time.Time) float64 {
+		return float64(t.Sub(since)) / float64(window)
+	}
+
+	trends := map[int]*models.Trend{}
+	trendOf := func(mID int) *models.Trend {
+		t, ok := trends[mID]
+		if !ok {
+			t = &models.Trend{MediaID: mID}
+			trends[mID] = t
+		}
+		return t
+	}
+
+	umList, err := ser.UserMediaService.GetFilterParallel(nil, nil, tx,
+		func(um *models.UserMedia) bool {
+			return inWindow(um.Meta.CreatedAt)
+		})
+	if err != nil {
+		return fmt.Errorf("failed to get UserMedia: %w", err)
+	}
+	for _, um := range umList {
+		t := trendOf(um.MediaID)
+		t.Adds++
+		t.Score += weights.Add * recency(um.Meta.CreatedAt)
+	}
+
+	aList, err := ser.ActivityService.GetFeed(nil, nil, tx, func(a *models.Activity) bool {
+		return inWindow(a.Meta.CreatedAt) &&
+			(a.Kind == models.ActivityKindCompleted || a.Kind == models.ActivityKindScored)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get Activities: %w", err)
+	}
+	for _, a := range aList {
+		t := trendOf(a.MediaID)
+		if a.Kind == models.ActivityKindCompleted {
+			t.Completions++
+			t.Score += weights.Completion * recency(a.Meta.CreatedAt)
+		} else {
+			t.Scores++
+			t.Score += weights.Score * recency(a.Meta.CreatedAt)
+		}
+	}
+
+	// Activities outlive the Media they are about
+	list := make([]*models.Trend, 0, len(trends))
+	for mID, t := range trends {
+		_, err = tx.Database().GetRawByID(mID, ser.UserMediaService.MediaService, tx)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get Media with ID %d: %w", mID, err)
+		}
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Score != list[j].Score {
+			return list[i].Score > list[j].Score
+		}
+		return list[i].MediaID < list[j].MediaID
+	})
+
+	ser.mu.Lock()
+	defer ser.mu.Unlock()
+	ser.trends, ser.updated = list, now
+	return nil
+}
+
+// Get returns up to the given number of the most trending Media as of the
+// last refresh, and the time of that refresh. The trends are refreshed first
+// if they never were. All trends are returned if the limit is not positive.
+func (ser *TrendingService) Get(limit int, tx db.Tx) ([]*models.Trend, time.Time, error) {
+	ser.mu.RLock()
+	updated := ser.updated
+	ser.mu.RUnlock()
+	if updated.IsZero() {
+		err := ser.Refresh(time.Now(), tx)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+	}
+
+	ser.mu.RLock()
+	defer ser.mu.RUnlock()
+	list := ser.trends
+	if limit > 0 && limit < len(list) {
+		list = list[:limit]
+	}
+	res := make([]*models.Trend, len(list))
+	for i, t := range list {
+		trend := *t
+		res[i] = &trend
+	}
+	return res, ser.updated, nil
+}
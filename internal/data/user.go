@@ -3,17 +3,17 @@ package data
 import (
 	"errors"
 	"fmt"
-	"strings"
 
 	"github.com/Dophin2009/nao/pkg/models"
 	"github.com/Dophin2009/nao/pkg/db"
-	json "github.com/json-iterator/go"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type userWrap struct {
 	updatedPass bool
 	*models.User
+	// hashed is true if the Password of a new User is already hashed.
+	hashed bool
 }
 
 // UserService performs operations on User.
@@ -30,13 +30,20 @@ func NewUserService(hooks db.PersistHooks) *UserService {
 
 // Create persists the given User.
 func (ser *UserService) Create(u *models.User, tx db.Tx) (int, error) {
-	uw := userWrap{false, u}
+	uw := userWrap{User: u}
+	return tx.Database().Create(&uw, ser, tx)
+}
+
+// CreateHashed persists the given User, whose Password is already hashed by
+// HashPassword, such as a hash shared by many generated Users.
+func (ser *UserService) CreateHashed(u *models.User, tx db.Tx) (int, error) {
+	uw := userWrap{User: u, hashed: true}
 	return tx.Database().Create(&uw, ser, tx)
 }
 
 // Update rulaces the value of the User with the given ID.
 func (ser *UserService) Update(u *models.User, tx db.Tx) error {
-	uw := &userWrap{false, u}
+	uw := &userWrap{User: u}
 	return ser.update(uw, tx)
 }
 
@@ -126,25 +133,25 @@ func (ser *UserService) GetByID(id int, tx db.Tx) (*models.User, error) {
 
 // GetByUsername retrieves a single instance of User with the given username.
 func (ser *UserService) GetByUsername(username string, tx db.Tx) (*models.User, error) {
-	var e models.User
-	_, err := tx.Database().FindFirst(ser, tx, func(m db.Model) (bool, error) {
+	m, err := tx.Database().FindFirst(ser, tx, func(m db.Model) (bool, error) {
 		u, err := ser.AssertType(m)
 		if err != nil {
 			return false, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 		}
-
-		if u.Username == username {
-			e = *u
-			return true, nil
-		}
-
-		return false, nil
+		return u.Username == username, nil
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to iterate through keys: %w", err)
 	}
+	if m == nil {
+		return nil, fmt.Errorf("username %q: %w", username, ErrNotFound)
+	}
 
-	return &e, nil
+	u, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return u, nil
 }
 
 // Authorize checks if the user with the given ID has permissions that meet
@@ -156,7 +163,7 @@ func (ser *UserService) Authorize(userID int, req *models.UserPermission, tx db.
 	}
 
 	if !ser.RequirementsMet(&user.Permissions, req) {
-		return nil, errors.New("insufficient permissions")
+		return nil, fmt.Errorf("insufficient permissions: %w", ErrUnauthorized)
 	}
 	return user, nil
 }
@@ -181,7 +188,10 @@ func (ser *UserService) AuthenticateWithPassword(
 
 	err = bcrypt.CompareHashAndPassword(u.Password, []byte(password))
 	if err != nil {
-		return fmt.Errorf("failed to match passwords: %w", err)
+		return fmt.Errorf("failed to match passwords: %v: %w", err, ErrUnauthorized)
+	}
+	if u.Disabled {
+		return fmt.Errorf("User %q: disabled: %w", username, ErrUnauthorized)
 	}
 
 	return nil
@@ -201,7 +211,7 @@ func (ser *UserService) ChangePassword(userID int, password string, tx db.Tx) er
 	}
 	u.Password = pass
 
-	uw := &userWrap{true, u}
+	uw := &userWrap{updatedPass: true, User: u}
 	err = ser.update(uw, tx)
 	if err != nil {
 		return err
@@ -227,13 +237,10 @@ func (ser *UserService) Bucket() string {
 
 // Clean cleans the given User for storage.
 func (ser *UserService) Clean(m db.Model, _ db.Tx) error {
-	e, err := ser.AssertType(m)
+	_, err := ser.AssertType(m)
 	if err != nil {
 		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
-
-	e.Username = strings.Trim(e.Username, " ")
-	e.Email = strings.Trim(e.Email, " ")
 	return nil
 }
 
@@ -247,8 +254,24 @@ func (ser *UserService) Validate(m db.Model, tx db.Tx) error {
 
 	// Check that username does not already exist
 	sameUsername, err := ser.GetByUsername(u.Username, tx)
-	if sameUsername != nil {
-		return fmt.Errorf("username %q: %w", u.Username, errAlreadyExists)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("failed to get User by username %q: %w", u.Username, err)
+	}
+	if sameUsername != nil && sameUsername.Meta.ID != u.Meta.ID {
+		return fmt.Errorf("username %q: %w", u.Username, ErrConflict)
+	}
+
+	var verr ValidationError
+	if !u.Privacy.IsValid() {
+		verr.Add("Privacy", FieldInvalid, "unknown visibility")
+	}
+	if !u.ScoreFormat.IsValid() {
+		verr.Addf("ScoreFormat", FieldInvalid, "unknown score format %s", u.ScoreFormat)
+	}
+	validateCustomStatuses(u.CustomStatuses, &verr)
+	err = verr.Err()
+	if err != nil {
+		return err
 	}
 
 	return nil
@@ -261,6 +284,9 @@ func (ser *UserService) Initialize(m db.Model, _ db.Tx) error {
 		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
+	if uw.hashed {
+		return nil
+	}
 	pass, err := ser.HashPassword(uw.User.Password)
 	if err != nil {
 		return fmt.Errorf("failed to generate password hash: %w", err)
@@ -294,29 +320,29 @@ func (ser *UserService) PersistHooks() *db.PersistHooks {
 	return &ser.Hooks
 }
 
-// Marshal transforms the given User into JSON.
+// Marshal encodes the given User for storage.
 func (ser *UserService) Marshal(m db.Model) ([]byte, error) {
 	uw, err := ser.assertWrapType(m)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
-	v, err := json.Marshal(uw.User)
+	v, err := db.Codecs.Encode(ser.Bucket(), uw.User)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONMarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
 	}
 
 	return v, nil
 }
 
-// Unmarshal parses the given JSON into User.
+// Unmarshal decodes the given record into User.
 func (ser *UserService) Unmarshal(buf []byte) (db.Model, error) {
 	var u models.User
-	err := json.Unmarshal(buf, &u)
+	err := db.Codecs.Decode(buf, &u)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONUnmarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
 	}
-	return &userWrap{false, &u}, nil
+	return &userWrap{User: &u}, nil
 }
 
 func (ser *UserService) assertWrapType(m db.Model) (*userWrap, error) {
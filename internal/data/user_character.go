@@ -6,7 +6,6 @@ import (
 
 	"github.com/Dophin2009/nao/pkg/models"
 	"github.com/Dophin2009/nao/pkg/db"
-	json "github.com/json-iterator/go"
 )
 
 // UserCharacterService performs operations on UserCharacter.
@@ -244,27 +243,27 @@ func (ser *UserCharacterService) PersistHooks() *db.PersistHooks {
 	return &ser.Hooks
 }
 
-// Marshal transforms the given UserCharacter into JSON.
+// Marshal encodes the given UserCharacter for storage.
 func (ser *UserCharacterService) Marshal(m db.Model) ([]byte, error) {
 	uc, err := ser.AssertType(m)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
-	v, err := json.Marshal(uc)
+	v, err := db.Codecs.Encode(ser.Bucket(), uc)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONMarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
 	}
 
 	return v, nil
 }
 
-// Unmarshal parses the given JSON into UserCharacter.
+// Unmarshal decodes the given record into UserCharacter.
 func (ser *UserCharacterService) Unmarshal(buf []byte) (db.Model, error) {
 	var uc models.UserCharacter
-	err := json.Unmarshal(buf, &uc)
+	err := db.Codecs.Decode(buf, &uc)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONUnmarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
 	}
 	return &uc, nil
 }
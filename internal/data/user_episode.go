@@ -6,24 +6,27 @@ import (
 
 	"github.com/Dophin2009/nao/pkg/models"
 	"github.com/Dophin2009/nao/pkg/db"
-	json "github.com/json-iterator/go"
 )
 
 // UserEpisodeService performs operations on UserEpisode.
 type UserEpisodeService struct {
 	UserService    *UserService
 	EpisodeService *EpisodeService
-	Hooks          db.PersistHooks
+	// UserMediaService retrieves the Episodes of Media and records the
+	// progress derived from watch states.
+	UserMediaService *UserMediaService
+	Hooks            db.PersistHooks
 }
 
 // NewUserEpisodeService returns a UserEpisodeService.
 func NewUserEpisodeService(hooks db.PersistHooks, userService *UserService,
-	episodeService *EpisodeService) *UserEpisodeService {
+	episodeService *EpisodeService, userMediaService *UserMediaService) *UserEpisodeService {
 	// Initiate UserEpisodeService
 	userEpisodeService := &UserEpisodeService{
-		UserService:    userService,
-		EpisodeService: episodeService,
-		Hooks:          hooks,
+		UserService:      userService,
+		EpisodeService:   episodeService,
+		UserMediaService: userMediaService,
+		Hooks:            hooks,
 	}
 
 	// Add hook to delete UserEpisode on User deletion
@@ -243,27 +246,27 @@ func (ser *UserEpisodeService) PersistHooks() *db.PersistHooks {
 	return &ser.Hooks
 }
 
-// Marshal transforms the given UserEpisode into JSON.
+// Marshal encodes the given UserEpisode for storage.
 func (ser *UserEpisodeService) Marshal(m db.Model) ([]byte, error) {
 	uep, err := ser.AssertType(m)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
-	v, err := json.Marshal(uep)
+	v, err := db.Codecs.Encode(ser.Bucket(), uep)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONMarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
 	}
 
 	return v, nil
 }
 
-// Unmarshal parses the given JSON into UserEpisode.
+// Unmarshal decodes the given record into UserEpisode.
 func (ser *UserEpisodeService) Unmarshal(buf []byte) (db.Model, error) {
 	var uep models.UserEpisode
-	err := json.Unmarshal(buf, &uep)
+	err := db.Codecs.Decode(buf, &uep)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONUnmarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
 	}
 	return &uep, nil
 }
@@ -0,0 +1,312 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// UserFollowService performs operations on UserFollow.
+type UserFollowService struct {
+	UserService *UserService
+	Hooks       db.PersistHooks
+}
+
+// NewUserFollowService returns a UserFollowService.
+func NewUserFollowService(hooks db.PersistHooks, userService *UserService) *UserFollowService {
+	// Initialize UserFollowService
+	userFollowService := &UserFollowService{
+		UserService: userService,
+		Hooks:       hooks,
+	}
+
+	// Add hook to delete UserFollow on User deletion
+	deleteUserFollowOnDeleteUser := func(um db.Model, _ db.Service, tx db.Tx) error {
+		uID := um.Metadata().ID
+		err := userFollowService.DeleteByUser(uID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to delete UserFollow by User ID %d: %w", uID, err)
+		}
+		return nil
+	}
+	uSerHooks := userService.PersistHooks()
+	uSerHooks.PreDeleteHooks =
+		append(uSerHooks.PreDeleteHooks, deleteUserFollowOnDeleteUser)
+
+	return userFollowService
+}
+
+// Create persists the given UserFollow.
+func (ser *UserFollowService) Create(uf *models.UserFollow, tx db.Tx) (int, error) {
+	return tx.Database().Create(uf, ser, tx)
+}
+
+// Delete deletes the UserFollow with the given ID.
+func (ser *UserFollowService) Delete(id int, tx db.Tx) error {
+	return tx.Database().Delete(id, ser, tx)
+}
+
+// DeleteByUser deletes the UserFollows in which the User with the given ID is
+// either the follower or the followee.
+func (ser *UserFollowService) DeleteByUser(uID int, tx db.Tx) error {
+	return tx.Database().DeleteFilter(ser, tx, func(m db.Model) bool {
+		uf, err := ser.AssertType(m)
+		if err != nil {
+			return false
+		}
+
+		return uf.FollowerID == uID || uf.FolloweeID == uID
+	})
+}
+
+// Follow makes the User with the given follower ID follow the User with the
+// given followee ID, if not already following.
+func (ser *UserFollowService) Follow(followerID int, followeeID int, tx db.Tx) error {
+	_, err := ser.GetByPair(followerID, followeeID, tx)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	_, err = ser.Create(&models.UserFollow{
+		FollowerID: followerID,
+		FolloweeID: followeeID,
+	}, tx)
+	return err
+}
+
+// Unfollow makes the User with the given follower ID stop following the User
+// with the given followee ID, if following.
+func (ser *UserFollowService) Unfollow(followerID int, followeeID int, tx db.Tx) error {
+	return tx.Database().DeleteFilter(ser, tx, func(m db.Model) bool {
+		uf, err := ser.AssertType(m)
+		if err != nil {
+			return false
+		}
+
+		return uf.FollowerID == followerID && uf.FolloweeID == followeeID
+	})
+}
+
+// GetFilter retrieves all persisted values of UserFollow that pass the filter.
+func (ser *UserFollowService) GetFilter(
+	first *int, skip *int, tx db.Tx, keep func(uf *models.UserFollow) bool,
+) ([]*models.UserFollow, error) {
+	vlist, err := tx.Database().GetFilter(first, skip, ser, tx,
+		func(m db.Model) bool {
+			uf, err := ser.AssertType(m)
+			if err != nil {
+				return false
+			}
+			return keep(uf)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to UserFollows: %w", err)
+	}
+	return list, nil
+}
+
+// GetAll retrieves all persisted values of UserFollow.
+func (ser *UserFollowService) GetAll(first *int, skip *int, tx db.Tx) ([]*models.UserFollow, error) {
+	vlist, err := tx.Database().GetAll(first, skip, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to UserFollows: %w", err)
+	}
+	return list, nil
+}
+
+// GetByPair retrieves the persisted UserFollow of the User with the given
+// follower ID following the User with the given followee ID.
+func (ser *UserFollowService) GetByPair(
+	followerID int, followeeID int, tx db.Tx,
+) (*models.UserFollow, error) {
+	m, err := tx.Database().FindFirst(ser, tx, func(m db.Model) (bool, error) {
+		uf, err := ser.AssertType(m)
+		if err != nil {
+			return false, err
+		}
+		return uf.FollowerID == followerID && uf.FolloweeID == followeeID, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate through keys: %w", err)
+	}
+	if m == nil {
+		return nil, fmt.Errorf("User with ID %d following User with ID %d: %w",
+			followerID, followeeID, ErrNotFound)
+	}
+
+	uf, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return uf, nil
+}
+
+// GetByFollower retrieves a list of instances of UserFollow with the given
+// follower ID, that is, the Users followed by that User.
+func (ser *UserFollowService) GetByFollower(
+	uID int, first *int, skip *int, tx db.Tx,
+) ([]*models.UserFollow, error) {
+	return ser.GetFilter(first, skip, tx, func(uf *models.UserFollow) bool {
+		return uf.FollowerID == uID
+	})
+}
+
+// GetByFollowee retrieves a list of instances of UserFollow with the given
+// followee ID, that is, the followers of that User.
+func (ser *UserFollowService) GetByFollowee(
+	uID int, first *int, skip *int, tx db.Tx,
+) ([]*models.UserFollow, error) {
+	return ser.GetFilter(first, skip, tx, func(uf *models.UserFollow) bool {
+		return uf.FolloweeID == uID
+	})
+}
+
+// Followees returns the IDs of the Users followed by the User with the given
+// ID.
+func (ser *UserFollowService) Followees(uID int, tx db.Tx) ([]int, error) {
+	list, err := ser.GetByFollower(uID, nil, nil, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, len(list))
+	for i, uf := range list {
+		ids[i] = uf.FolloweeID
+	}
+	return ids, nil
+}
+
+// Bucket returns the name of the bucket for UserFollow.
+func (ser *UserFollowService) Bucket() string {
+	return "UserFollow"
+}
+
+// Clean cleans the given UserFollow for storage.
+func (ser *UserFollowService) Clean(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// Validate returns an error if the UserFollow is not valid for the database.
+func (ser *UserFollowService) Validate(m db.Model, tx db.Tx) error {
+	e, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	var verr ValidationError
+	if e.FollowerID == e.FolloweeID {
+		verr.Add("FolloweeID", FieldInvalid, "may not follow themselves")
+	}
+	err = verr.Err()
+	if err != nil {
+		return err
+	}
+
+	db := tx.Database()
+
+	// Check if Users with IDs specified in UserFollow exist
+	_, err = db.GetRawByID(e.FollowerID, ser.UserService, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get User with ID %d: %w", e.FollowerID, err)
+	}
+	_, err = db.GetRawByID(e.FolloweeID, ser.UserService, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get User with ID %d: %w", e.FolloweeID, err)
+	}
+
+	// Check that the follow does not already exist
+	same, err := ser.GetByPair(e.FollowerID, e.FolloweeID, tx)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("failed to get UserFollow of User with ID %d by User with ID %d: %w",
+			e.FolloweeID, e.FollowerID, err)
+	}
+	if same != nil && same.Meta.ID != e.Meta.ID {
+		return fmt.Errorf("User with ID %d: already following User with ID %d: %w",
+			e.FollowerID, e.FolloweeID, ErrConflict)
+	}
+
+	return nil
+}
+
+// Initialize sets initial values for some properties.
+func (ser *UserFollowService) Initialize(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistOldProperties maintains certain properties of the existing
+// UserFollow in updates.
+func (ser *UserFollowService) PersistOldProperties(_ db.Model, _ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistHooks returns the persistence hook functions.
+func (ser *UserFollowService) PersistHooks() *db.PersistHooks {
+	return &ser.Hooks
+}
+
+// Marshal encodes the given UserFollow for storage.
+func (ser *UserFollowService) Marshal(m db.Model) ([]byte, error) {
+	uf, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	v, err := db.Codecs.Encode(ser.Bucket(), uf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
+	}
+
+	return v, nil
+}
+
+// Unmarshal decodes the given record into UserFollow.
+func (ser *UserFollowService) Unmarshal(buf []byte) (db.Model, error) {
+	var uf models.UserFollow
+	err := db.Codecs.Decode(buf, &uf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
+	}
+	return &uf, nil
+}
+
+// AssertType exposes the given db.Model as a UserFollow.
+func (ser *UserFollowService) AssertType(m db.Model) (*models.UserFollow, error) {
+	if m == nil {
+		return nil, fmt.Errorf("model: %w", errNil)
+	}
+
+	uf, ok := m.(*models.UserFollow)
+	if !ok {
+		return nil, fmt.Errorf("model: %w", errors.New("not of UserFollow type"))
+	}
+	return uf, nil
+}
+
+// mapFromModel returns a list of UserFollow type asserted from the given list
+// of db.Model.
+func (ser *UserFollowService) mapFromModel(vlist []db.Model) ([]*models.UserFollow, error) {
+	list := make([]*models.UserFollow, len(vlist))
+	var err error
+	for i, v := range vlist {
+		list[i], err = ser.AssertType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+	}
+	return list, nil
+}
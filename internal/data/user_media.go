@@ -3,17 +3,25 @@ package data
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/Dophin2009/nao/pkg/models"
 	"github.com/Dophin2009/nao/pkg/db"
-	json "github.com/json-iterator/go"
 )
 
 // UserMediaService performs operations on UserMedia.
 type UserMediaService struct {
 	UserService  *UserService
 	MediaService *MediaService
-	Hooks        db.PersistHooks
+	// EpisodeService and EpisodeSetService are used to tell regular Episodes
+	// from specials in progress tracking; Episodes are not considered if
+	// unset.
+	EpisodeService    *EpisodeService
+	EpisodeSetService *EpisodeSetService
+	// ScrobbleSessionGap is the longest pause between playback events of the
+	// same WatchedInstance; DefaultScrobbleSessionGap is used if unset.
+	ScrobbleSessionGap time.Duration
+	Hooks              db.PersistHooks
 }
 
 // NewUserMediaService returns a UserMediaService.
@@ -131,6 +139,31 @@ func (ser *UserMediaService) GetFilter(
 	return list, nil
 }
 
+// GetFilterParallel retrieves the persisted UserMedia values that pass the
+// filter as GetFilter, unmarshaling and filtering them concurrently; the
+// filter must not use the transaction.
+func (ser *UserMediaService) GetFilterParallel(
+	first *int, skip *int, tx db.Tx, keep func(um *models.UserMedia) bool,
+) ([]*models.UserMedia, error) {
+	vlist, err := tx.Database().GetFilterParallel(first, skip, ser, tx,
+		func(m db.Model) bool {
+			um, err := ser.AssertType(m)
+			if err != nil {
+				return false
+			}
+			return keep(um)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to UserMedia: %w", err)
+	}
+	return list, nil
+}
+
 // GetMultiple retrieves the persisted UserMedia values specified by the
 // given IDs that pass the filter.
 func (ser *UserMediaService) GetMultiple(
@@ -193,11 +226,20 @@ func (ser *UserMediaService) Bucket() string {
 }
 
 // Clean cleans the given UserMedia for storage.
-func (ser *UserMediaService) Clean(m db.Model, _ db.Tx) error {
-	_, err := ser.AssertType(m)
+func (ser *UserMediaService) Clean(m db.Model, tx db.Tx) error {
+	um, err := ser.AssertType(m)
 	if err != nil {
 		return fmt.Errorf("%s :%w", errmsgModelAssertType, err)
 	}
+
+	um.RewatchCount = latestRewatch(um)
+	if um.CustomStatus != nil && *um.CustomStatus == "" {
+		um.CustomStatus = nil
+	}
+	// The Status of updated UserMedia is kept in PersistOldProperties
+	if um.Meta.ID == 0 {
+		return ser.mapCustomStatus(um, tx)
+	}
 	return nil
 }
 
@@ -208,14 +250,31 @@ func (ser *UserMediaService) Validate(m db.Model, tx db.Tx) error {
 		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
+	var verr ValidationError
+	if e.Score != nil && (*e.Score < 0 || *e.Score > models.ScoreMax) {
+		verr.Addf("Score", FieldOutOfRange, "%d: must be between 0 and %d",
+			*e.Score, models.ScoreMax)
+	}
+	err = verr.Err()
+	if err != nil {
+		return err
+	}
+
 	db := tx.Database()
 
 	// Check if User with ID specified in UserMedia exists
-	_, err = db.GetRawByID(e.UserID, ser.UserService, tx)
+	u, err := ser.UserService.GetByID(e.UserID, tx)
 	if err != nil {
 		return fmt.Errorf("failed to get User with ID %d: %w", e.UserID, err)
 	}
 
+	// Check if the custom status of the UserMedia is one of its User
+	if e.CustomStatus != nil && *e.CustomStatus != "" && u.CustomStatus(*e.CustomStatus) == nil {
+		verr.Addf("CustomStatus", FieldInvalid, "%q: not a custom status of User with ID %d",
+			*e.CustomStatus, e.UserID)
+		return verr.Err()
+	}
+
 	// Check if Media with ID specified in MediaCharacter exists
 	_, err = db.GetRawByID(e.MediaID, ser.MediaService, tx)
 	if err != nil {
@@ -225,15 +284,44 @@ func (ser *UserMediaService) Validate(m db.Model, tx db.Tx) error {
 	return nil
 }
 
+// UniqueKey returns the key by which a UserMedia must be unique, composed of
+// the IDs of its User and Media.
+func (ser *UserMediaService) UniqueKey(m db.Model) (string, error) {
+	e, err := ser.AssertType(m)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	return fmt.Sprintf("%d/%d", e.UserID, e.MediaID), nil
+}
+
 // Initialize sets initial values for some properties.
 func (ser *UserMediaService) Initialize(_ db.Model, _ db.Tx) error {
 	return nil
 }
 
 // PersistOldProperties maintains certain properties of the existing UserMedia
-// in updates.
-func (ser *UserMediaService) PersistOldProperties(_ db.Model, _ db.Model, _ db.Tx) error {
-	return nil
+// in updates. UserMedia whose Status is changed without their custom status
+// lose it; otherwise, their Status is that their custom status maps to, if
+// any.
+func (ser *UserMediaService) PersistOldProperties(n db.Model, o db.Model, tx db.Tx) error {
+	num, err := ser.AssertType(n)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	oum, err := ser.AssertType(o)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	sameCustom := num.CustomStatus != nil && oum.CustomStatus != nil &&
+		*num.CustomStatus == *oum.CustomStatus
+	changedStatus := num.Status != nil &&
+		(oum.Status == nil || *num.Status != *oum.Status)
+	if sameCustom && changedStatus {
+		num.CustomStatus = nil
+		return nil
+	}
+	return ser.mapCustomStatus(num, tx)
 }
 
 // PersistHooks returns the persistence hook functions.
@@ -241,27 +329,27 @@ func (ser *UserMediaService) PersistHooks() *db.PersistHooks {
 	return &ser.Hooks
 }
 
-// Marshal transforms the given UserMedia into JSON.
+// Marshal encodes the given UserMedia for storage.
 func (ser *UserMediaService) Marshal(m db.Model) ([]byte, error) {
 	um, err := ser.AssertType(m)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
-	v, err := json.Marshal(um)
+	v, err := db.Codecs.Encode(ser.Bucket(), um)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONMarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
 	}
 
 	return v, nil
 }
 
-// Unmarshal parses the given JSON into UserMedia.
+// Unmarshal decodes the given record into UserMedia.
 func (ser *UserMediaService) Unmarshal(buf []byte) (db.Model, error) {
 	var um models.UserMedia
-	err := json.Unmarshal(buf, &um)
+	err := db.Codecs.Decode(buf, &um)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONUnmarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
 	}
 	return &um, nil
 }
@@ -6,7 +6,6 @@ import (
 
 	"github.com/Dophin2009/nao/pkg/models"
 	"github.com/Dophin2009/nao/pkg/db"
-	json "github.com/json-iterator/go"
 )
 
 // UserMediaListService performs operations on UserMediaList.
@@ -185,17 +184,107 @@ func (ser *UserMediaListService) GetByID(id int, tx db.Tx) (*models.UserMediaLis
 	return uml, nil
 }
 
+// Reorder replaces the sections of the given UserMediaList if sections is not
+// nil, applies the given moves in order, and persists the result. Entries of
+// removed sections are moved out of any section. Either all the changes are
+// made or none are.
+func (ser *UserMediaListService) Reorder(
+	uml *models.UserMediaList, sections []models.UserMediaListSection,
+	moves []models.UserMediaListMove, tx db.Tx,
+) error {
+	if sections != nil {
+		// Assign IDs to new sections after the highest one in use
+		next := 1
+		for _, list := range [][]models.UserMediaListSection{uml.Sections, sections} {
+			for _, sec := range list {
+				if sec.ID >= next {
+					next = sec.ID + 1
+				}
+			}
+		}
+		for i := range sections {
+			if sections[i].ID == 0 {
+				sections[i].ID = next
+				next++
+			}
+		}
+		uml.Sections = sections
+	}
+
+	err := validateUserMediaListSections(uml.Sections)
+	if err != nil {
+		return err
+	}
+	sectionExists := map[int]bool{}
+	for _, sec := range uml.Sections {
+		sectionExists[sec.ID] = true
+	}
+
+	groups := userMediaListGroups(uml)
+	for _, mv := range moves {
+		from, ok := userMediaListSectionOf(uml, mv.UserMediaID)
+		if !ok {
+			return fmt.Errorf("UserMedia with ID %d: not in UserMediaList with ID %d: %w",
+				mv.UserMediaID, uml.Meta.ID, ErrInvalid)
+		}
+		to := 0
+		if mv.SectionID != nil {
+			to = *mv.SectionID
+			if !sectionExists[to] {
+				return fmt.Errorf("section with ID %d: not in UserMediaList with ID %d: %w",
+					to, uml.Meta.ID, ErrInvalid)
+			}
+		}
+		if mv.Position < 0 {
+			return fmt.Errorf("position %d: must not be negative: %w", mv.Position, ErrInvalid)
+		}
+
+		// Take the entry out of its section
+		for i, id := range groups[from] {
+			if id == mv.UserMediaID {
+				groups[from] = append(groups[from][:i:i], groups[from][i+1:]...)
+				break
+			}
+		}
+
+		// Insert it into the other at the position
+		pos := mv.Position
+		if pos > len(groups[to]) {
+			pos = len(groups[to])
+		}
+		group := make([]int, 0, len(groups[to])+1)
+		group = append(group, groups[to][:pos]...)
+		group = append(group, mv.UserMediaID)
+		groups[to] = append(group, groups[to][pos:]...)
+
+		if to == 0 {
+			delete(uml.EntrySections, mv.UserMediaID)
+		} else {
+			if uml.EntrySections == nil {
+				uml.EntrySections = map[int]int{}
+			}
+			uml.EntrySections[mv.UserMediaID] = to
+		}
+	}
+	flattenUserMediaList(uml, groups)
+
+	return ser.Update(uml, tx)
+}
+
 // Bucket returns the name of the bucket for UserMediaList.
 func (ser *UserMediaListService) Bucket() string {
 	return "UserMediaList"
 }
 
-// Clean cleans the given UserMediaList for storage.
+// Clean cleans the given UserMediaList for storage, dropping the sections of
+// entries no longer in the list and ordering the entries by section.
 func (ser *UserMediaListService) Clean(m db.Model, _ db.Tx) error {
-	_, err := ser.AssertType(m)
+	e, err := ser.AssertType(m)
 	if err != nil {
 		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
+
+	flattenUserMediaList(e, userMediaListGroups(e))
 	return nil
 }
 
@@ -207,6 +296,11 @@ func (ser *UserMediaListService) Validate(m db.Model, tx db.Tx) error {
 		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
+	err = validateUserMediaListSections(e.Sections)
+	if err != nil {
+		return err
+	}
+
 	db := tx.Database()
 
 	// Check if User with ID specified in UserMediaList exists
@@ -242,27 +336,27 @@ func (ser *UserMediaListService) PersistHooks() *db.PersistHooks {
 	return &ser.Hooks
 }
 
-// Marshal transforms the given UserMediaList into JSON.
+// Marshal encodes the given UserMediaList for storage.
 func (ser *UserMediaListService) Marshal(m db.Model) ([]byte, error) {
 	uml, err := ser.AssertType(m)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
-	v, err := json.Marshal(uml)
+	v, err := db.Codecs.Encode(ser.Bucket(), uml)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONMarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
 	}
 
 	return v, nil
 }
 
-// Unmarshal parses the given JSON into UserMediaList.
+// Unmarshal decodes the given record into UserMediaList.
 func (ser *UserMediaListService) Unmarshal(buf []byte) (db.Model, error) {
 	var uml models.UserMediaList
-	err := json.Unmarshal(buf, &uml)
+	err := db.Codecs.Decode(buf, &uml)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONUnmarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
 	}
 	return &uml, nil
 }
@@ -293,3 +387,75 @@ func (ser *UserMediaListService) mapFromModel(vlist []db.Model) ([]*models.UserM
 	}
 	return list, nil
 }
+
+// validateUserMediaListSections returns an error if the IDs of the given
+// sections are not positive and unique.
+func validateUserMediaListSections(sections []models.UserMediaListSection) error {
+	var verr ValidationError
+	seen := map[int]bool{}
+	for i, sec := range sections {
+		if sec.ID <= 0 {
+			verr.Addf(db.FieldPath("Sections", i, "ID"), FieldOutOfRange,
+				"%d: must be positive", sec.ID)
+		} else if seen[sec.ID] {
+			verr.Addf(db.FieldPath("Sections", i, "ID"), FieldInvalid,
+				"%d: not unique", sec.ID)
+		}
+		seen[sec.ID] = true
+	}
+	return verr.Err()
+}
+
+// userMediaListSectionOf returns the ID of the section of the entry with the
+// given UserMedia ID, or 0 if in no section, and whether the entry is in the
+// list.
+func userMediaListSectionOf(uml *models.UserMediaList, umID int) (int, bool) {
+	for _, id := range uml.UserMedia {
+		if id == umID {
+			return uml.EntrySections[umID], true
+		}
+	}
+	return 0, false
+}
+
+// userMediaListGroups returns the entries of the given UserMediaList grouped
+// by the IDs of their sections, in the order of the list. Entries in no
+// section, or in sections that no longer exist, are grouped under 0.
+func userMediaListGroups(uml *models.UserMediaList) map[int][]int {
+	exists := map[int]bool{}
+	for _, sec := range uml.Sections {
+		exists[sec.ID] = true
+	}
+
+	groups := map[int][]int{}
+	for _, id := range uml.UserMedia {
+		secID, ok := uml.EntrySections[id]
+		if !ok || !exists[secID] {
+			secID = 0
+		}
+		groups[secID] = append(groups[secID], id)
+	}
+	return groups
+}
+
+// flattenUserMediaList sets the entries of the given UserMediaList to the
+// given groups of entries by section ID: the entries in no section first,
+// then those of each section in order. Only the entries in sections are kept
+// in EntrySections.
+func flattenUserMediaList(uml *models.UserMediaList, groups map[int][]int) {
+	entries := make([]int, 0, len(uml.UserMedia))
+	entries = append(entries, groups[0]...)
+	var entrySections map[int]int
+	for _, sec := range uml.Sections {
+		for _, id := range groups[sec.ID] {
+			if entrySections == nil {
+				entrySections = map[int]int{}
+			}
+			entrySections[id] = sec.ID
+		}
+		entries = append(entries, groups[sec.ID]...)
+	}
+
+	uml.UserMedia = entries
+	uml.EntrySections = entrySections
+}
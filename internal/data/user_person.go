@@ -6,7 +6,6 @@ import (
 
 	"github.com/Dophin2009/nao/pkg/models"
 	"github.com/Dophin2009/nao/pkg/db"
-	json "github.com/json-iterator/go"
 )
 
 // UserPersonService performs operations on UserPerson.
@@ -242,27 +241,27 @@ func (ser *UserPersonService) PersistHooks() *db.PersistHooks {
 	return &ser.Hooks
 }
 
-// Marshal transforms the given UserPerson into JSON.
+// Marshal encodes the given UserPerson for storage.
 func (ser *UserPersonService) Marshal(m db.Model) ([]byte, error) {
 	up, err := ser.AssertType(m)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
 	}
 
-	v, err := json.Marshal(up)
+	v, err := db.Codecs.Encode(ser.Bucket(), up)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONMarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
 	}
 
 	return v, nil
 }
 
-// Unmarshal parses the given JSON into UserPerson.
+// Unmarshal decodes the given record into UserPerson.
 func (ser *UserPersonService) Unmarshal(buf []byte) (db.Model, error) {
 	var up models.UserPerson
-	err := json.Unmarshal(buf, &up)
+	err := db.Codecs.Decode(buf, &up)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", errmsgJSONUnmarshal, err)
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
 	}
 	return &up, nil
 }
@@ -0,0 +1,285 @@
+package data
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TagValidate is the name of the struct tag of the declarative checks of the
+// properties of models and request bodies, such as
+// `validate:"required,max=255,lang"`.
+const TagValidate = "validate"
+
+// ValidateTags checks the properties of the given struct, or pointer to one,
+// against the rules of their validate tags, adding the problems found to
+// verr. Properties of struct type, and slices of them, are checked too, with
+// paths such as Titles[1].Language. The rules are:
+//
+//   - required: strings must have characters other than spaces, slices and
+//     maps must not be empty, pointers must not be nil, and numbers must not
+//     be zero.
+//   - min=N and max=N: bound the number of characters of strings, the number
+//     of elements of slices and maps, and the value of numbers.
+//   - lang: strings must be empty or BCP 47 language tags.
+//   - url: strings must be empty or HTTP URLs.
+//   - dive: the rules after it apply to each element of a slice.
+//
+// Rules other than required pass nil pointers. Tags of unknown rules panic.
+func ValidateTags(v interface{}, verr *ValidationError) {
+	validateStruct(reflect.ValueOf(v), "", verr)
+}
+
+// tagRule is a single rule of a validate tag.
+type tagRule struct {
+	name string
+	arg  int
+}
+
+// tagField is a property of a struct type that is checked by its validate
+// tag or that may contain checked properties.
+type tagField struct {
+	index int
+	name  string
+	// rules apply to the property, and elem to each of its elements if the
+	// tag dives.
+	rules []tagRule
+	elem  []tagRule
+	dive  bool
+	// nested is true if the property is a struct, or a slice of them, that
+	// has checked properties.
+	nested bool
+}
+
+// tagFields caches the checked properties of struct types.
+var tagFields sync.Map
+
+// fieldsOf returns the checked properties of the given struct type.
+func fieldsOf(t reflect.Type) []tagField {
+	if v, ok := tagFields.Load(t); ok {
+		return v.([]tagField)
+	}
+
+	// Mark the type as in progress so that recursive types terminate
+	tagFields.Store(t, []tagField{})
+	fields := []tagField{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		f := tagField{index: i, name: sf.Name}
+		tag, ok := sf.Tag.Lookup(TagValidate)
+		if ok {
+			f.rules, f.elem, f.dive = parseTagRules(t, sf.Name, tag)
+		}
+		elem := sf.Type
+		for elem.Kind() == reflect.Ptr || elem.Kind() == reflect.Slice {
+			elem = elem.Elem()
+		}
+		f.nested = elem.Kind() == reflect.Struct && len(fieldsOf(elem)) > 0
+		if ok || f.nested {
+			fields = append(fields, f)
+		}
+	}
+	tagFields.Store(t, fields)
+	return fields
+}
+
+// parseTagRules returns the rules of the given validate tag of a property of
+// the given struct type, split at dive.
+func parseTagRules(t reflect.Type, name string, tag string) ([]tagRule, []tagRule, bool) {
+	rules := []tagRule{}
+	var elem []tagRule
+	for _, s := range strings.Split(tag, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if s == "dive" {
+			elem = []tagRule{}
+			continue
+		}
+
+		r := tagRule{name: s}
+		if i := strings.IndexByte(s, '='); i >= 0 {
+			arg, err := strconv.Atoi(s[i+1:])
+			if err != nil {
+				panic(fmt.Sprintf("%s.%s: invalid argument of rule %q", t, name, s))
+			}
+			r = tagRule{name: s[:i], arg: arg}
+		}
+		switch r.name {
+		case "required", "min", "max", "lang", "url":
+		default:
+			panic(fmt.Sprintf("%s.%s: unknown rule %q", t, name, r.name))
+		}
+
+		if elem != nil {
+			elem = append(elem, r)
+		} else {
+			rules = append(rules, r)
+		}
+	}
+	return rules, elem, elem != nil
+}
+
+// validateStruct checks the properties of the given struct value, or pointer
+// to one, whose path is prefix.
+func validateStruct(v reflect.Value, prefix string, verr *ValidationError) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	for _, f := range fieldsOf(v.Type()) {
+		fv := v.Field(f.index)
+		path := f.name
+		if prefix != "" {
+			path = prefix + "." + f.name
+		}
+
+		if !checkTagRules(fv, f.rules, path, verr) {
+			continue
+		}
+		if f.dive || f.nested {
+			validateElems(fv, f, path, verr)
+		}
+	}
+}
+
+// validateElems checks the elements of the given property value, by the
+// rules after dive and by their own properties.
+func validateElems(v reflect.Value, f tagField, path string, verr *ValidationError) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		if f.nested {
+			validateStruct(v, path, verr)
+		}
+		return
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		ev := v.Index(i)
+		epath := fmt.Sprintf("%s[%d]", path, i)
+		if !checkTagRules(ev, f.elem, epath, verr) {
+			continue
+		}
+		if f.nested {
+			validateStruct(ev, epath, verr)
+		}
+	}
+}
+
+// checkTagRules checks the given value against the given rules, adding the
+// first problem found to verr. It returns true if there was none.
+func checkTagRules(v reflect.Value, rules []tagRule, path string, verr *ValidationError) bool {
+	for _, r := range rules {
+		code, msg := checkTagRule(v, r)
+		if code != "" {
+			verr.Add(path, code, msg)
+			return false
+		}
+	}
+	return true
+}
+
+// checkTagRule checks the given value against the given rule, returning the
+// code and message of the problem found, or an empty code if there is none.
+func checkTagRule(v reflect.Value, r tagRule) (string, string) {
+	if r.name == "required" {
+		if isBlank(v) {
+			return FieldRequired, "must not be empty"
+		}
+		return "", ""
+	}
+
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", ""
+		}
+		v = v.Elem()
+	}
+	switch r.name {
+	case "min", "max":
+		n, unit, ok := measure(v)
+		if !ok {
+			return "", ""
+		}
+		if r.name == "min" && n < int64(r.arg) {
+			return FieldOutOfRange, fmt.Sprintf("must be at least %d%s", r.arg, unit)
+		}
+		if r.name == "max" && n > int64(r.arg) {
+			return FieldOutOfRange, fmt.Sprintf("must be at most %d%s", r.arg, unit)
+		}
+	case "lang":
+		if v.Kind() != reflect.String {
+			return "", ""
+		}
+		_, err := models.CanonicalLanguage(v.String())
+		if err != nil {
+			return FieldInvalid, err.Error()
+		}
+	case "url":
+		if v.Kind() != reflect.String || v.String() == "" {
+			return "", ""
+		}
+		u, err := url.Parse(v.String())
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return FieldInvalid, fmt.Sprintf("%q: not an HTTP URL", v.String())
+		}
+	}
+	return "", ""
+}
+
+// isBlank returns true if the given value is missing for the required rule.
+func isBlank(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	}
+	return false
+}
+
+// measure returns the size of the given value bounded by min and max, along
+// with the unit it is given in, or false if it has none.
+func measure(v reflect.Value) (int64, string, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return int64(utf8.RuneCountInString(v.String())), " characters", true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return int64(v.Len()), " elements", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), "", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), "", true
+	}
+	return 0, "", false
+}
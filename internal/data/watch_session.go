@@ -0,0 +1,348 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// WatchSessionService performs operations on WatchSession.
+type WatchSessionService struct {
+	UserService      *UserService
+	UserMediaService *UserMediaService
+	// SessionGap is the longest time between two reports of the same session;
+	// DefaultScrobbleSessionGap is used if not positive.
+	SessionGap time.Duration
+	Hooks      db.PersistHooks
+}
+
+// NewWatchSessionService returns a WatchSessionService.
+func NewWatchSessionService(
+	hooks db.PersistHooks, sessionGap time.Duration,
+	userService *UserService, userMediaService *UserMediaService,
+) *WatchSessionService {
+	// Initialize WatchSessionService
+	watchSessionService := &WatchSessionService{
+		UserService:      userService,
+		UserMediaService: userMediaService,
+		SessionGap:       sessionGap,
+		Hooks:            hooks,
+	}
+
+	// Add hook to delete WatchSession on User deletion
+	deleteWatchSessionOnDeleteUser := func(um db.Model, _ db.Service, tx db.Tx) error {
+		uID := um.Metadata().ID
+		err := watchSessionService.deleteFilter(tx, func(ws *models.WatchSession) bool {
+			return ws.UserID == uID
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete WatchSession by User ID %d: %w", uID, err)
+		}
+		return nil
+	}
+	uSerHooks := userService.PersistHooks()
+	uSerHooks.PreDeleteHooks =
+		append(uSerHooks.PreDeleteHooks, deleteWatchSessionOnDeleteUser)
+
+	// Add hook to delete WatchSession on UserMedia deletion
+	deleteWatchSessionOnDeleteUserMedia := func(umm db.Model, _ db.Service, tx db.Tx) error {
+		umID := umm.Metadata().ID
+		err := watchSessionService.deleteFilter(tx, func(ws *models.WatchSession) bool {
+			return ws.UserMediaID == umID
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete WatchSession by UserMedia ID %d: %w", umID, err)
+		}
+		return nil
+	}
+	umSerHooks := userMediaService.PersistHooks()
+	umSerHooks.PreDeleteHooks =
+		append(umSerHooks.PreDeleteHooks, deleteWatchSessionOnDeleteUserMedia)
+
+	return watchSessionService
+}
+
+// Create persists the given WatchSession.
+func (ser *WatchSessionService) Create(ws *models.WatchSession, tx db.Tx) (int, error) {
+	return tx.Database().Create(ws, ser, tx)
+}
+
+// Update replaces the value of the WatchSession with the given ID.
+func (ser *WatchSessionService) Update(ws *models.WatchSession, tx db.Tx) error {
+	return tx.Database().Update(ws, ser, tx)
+}
+
+// Delete deletes the WatchSession with the given ID.
+func (ser *WatchSessionService) Delete(id int, tx db.Tx) error {
+	return tx.Database().Delete(id, ser, tx)
+}
+
+// deleteFilter deletes the WatchSessions that pass the filter.
+func (ser *WatchSessionService) deleteFilter(
+	tx db.Tx, keep func(ws *models.WatchSession) bool,
+) error {
+	return tx.Database().DeleteFilter(ser, tx, func(m db.Model) bool {
+		ws, err := ser.AssertType(m)
+		if err != nil {
+			return false
+		}
+		return keep(ws)
+	})
+}
+
+// Record records the given report of progress through the given UserMedia in
+// the WatchSessions of its User. The report extends the latest session of the
+// Media if it falls within the session gap of it; otherwise a new session is
+// started.
+func (ser *WatchSessionService) Record(
+	um *models.UserMedia, p *models.ProgressReport, tx db.Tx,
+) (*models.WatchSession, error) {
+	if um == nil || p == nil {
+		return nil, fmt.Errorf("progress report: %w", errNil)
+	}
+
+	gap := ser.SessionGap
+	if gap <= 0 {
+		gap = DefaultScrobbleSessionGap
+	}
+
+	list, err := ser.GetFilter(nil, nil, tx, func(ws *models.WatchSession) bool {
+		return ws.UserID == um.UserID && ws.MediaID == um.MediaID
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get WatchSessions by User ID %d and Media ID %d: %w",
+			um.UserID, um.MediaID, err)
+	}
+
+	var ws *models.WatchSession
+	for _, s := range list {
+		if ws == nil || s.End.After(ws.End) {
+			ws = s
+		}
+	}
+	if ws == nil || p.Time.Before(ws.Start.Add(-gap)) || p.Time.After(ws.End.Add(gap)) {
+		ws = &models.WatchSession{
+			UserID:      um.UserID,
+			MediaID:     um.MediaID,
+			UserMediaID: um.Meta.ID,
+			Start:       p.Time,
+			End:         p.Time,
+		}
+	}
+
+	if p.Time.Before(ws.Start) {
+		ws.Start = p.Time
+	}
+	if p.Time.After(ws.End) {
+		ws.End = p.Time
+	}
+	// Repeated reports of the same Episode are recorded once
+	n := len(ws.Episodes)
+	if p.EpisodeID != nil && (n == 0 || ws.Episodes[n-1] != *p.EpisodeID) {
+		ws.Episodes = append(ws.Episodes, *p.EpisodeID)
+	}
+	ws.Reports++
+
+	if ws.Meta.ID == 0 {
+		_, err = ser.Create(ws, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create WatchSession: %w", err)
+		}
+	} else {
+		err = ser.Update(ws, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update WatchSession with ID %d: %w",
+				ws.Meta.ID, err)
+		}
+	}
+	return ws, nil
+}
+
+// GetFilter retrieves all persisted values of WatchSession that pass the
+// filter.
+func (ser *WatchSessionService) GetFilter(
+	first *int, skip *int, tx db.Tx, keep func(ws *models.WatchSession) bool,
+) ([]*models.WatchSession, error) {
+	vlist, err := tx.Database().GetFilter(first, skip, ser, tx,
+		func(m db.Model) bool {
+			ws, err := ser.AssertType(m)
+			if err != nil {
+				return false
+			}
+			return keep(ws)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to WatchSessions: %w", err)
+	}
+	return list, nil
+}
+
+// GetFilterParallel retrieves the persisted WatchSession values that pass the
+// filter as GetFilter, unmarshaling and filtering them concurrently; the
+// filter must not use the transaction.
+func (ser *WatchSessionService) GetFilterParallel(
+	first *int, skip *int, tx db.Tx, keep func(ws *models.WatchSession) bool,
+) ([]*models.WatchSession, error) {
+	vlist, err := tx.Database().GetFilterParallel(first, skip, ser, tx,
+		func(m db.Model) bool {
+			ws, err := ser.AssertType(m)
+			if err != nil {
+				return false
+			}
+			return keep(ws)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to WatchSessions: %w", err)
+	}
+	return list, nil
+}
+
+// GetAll retrieves all persisted values of WatchSession.
+func (ser *WatchSessionService) GetAll(first *int, skip *int, tx db.Tx) ([]*models.WatchSession, error) {
+	vlist, err := tx.Database().GetAll(first, skip, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := ser.mapFromModel(vlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map db.Models to WatchSessions: %w", err)
+	}
+	return list, nil
+}
+
+// GetByUser retrieves a list of instances of WatchSession of the User with
+// the given ID, oldest first.
+func (ser *WatchSessionService) GetByUser(
+	uID int, first *int, skip *int, tx db.Tx,
+) ([]*models.WatchSession, error) {
+	return ser.GetFilter(first, skip, tx, func(ws *models.WatchSession) bool {
+		return ws.UserID == uID
+	})
+}
+
+// Bucket returns the name of the bucket for WatchSession.
+func (ser *WatchSessionService) Bucket() string {
+	return "WatchSession"
+}
+
+// Clean cleans the given WatchSession for storage.
+func (ser *WatchSessionService) Clean(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// Validate returns an error if the WatchSession is not valid for the
+// database.
+func (ser *WatchSessionService) Validate(m db.Model, tx db.Tx) error {
+	e, err := ser.AssertType(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	// Check that the UserMedia exists and is of the User and Media
+	um, err := ser.UserMediaService.GetByID(e.UserMediaID, tx)
+	if err != nil {
+		return fmt.Errorf("failed to get UserMedia with ID %d: %w", e.UserMediaID, err)
+	}
+	if um.UserID != e.UserID || um.MediaID != e.MediaID {
+		var verr ValidationError
+		verr.Addf("UserMediaID", FieldInvalid, "%d: not of User with ID %d and Media with ID %d",
+			e.UserMediaID, e.UserID, e.MediaID)
+		return &verr
+	}
+
+	return nil
+}
+
+// Initialize sets initial values for some properties.
+func (ser *WatchSessionService) Initialize(_ db.Model, _ db.Tx) error {
+	return nil
+}
+
+// PersistOldProperties maintains certain properties of the existing
+// WatchSession in updates.
+func (ser *WatchSessionService) PersistOldProperties(n db.Model, o db.Model, _ db.Tx) error {
+	ws, err := ser.AssertType(n)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+	old, err := ser.AssertType(o)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	ws.UserID = old.UserID
+	ws.MediaID = old.MediaID
+	ws.UserMediaID = old.UserMediaID
+	return nil
+}
+
+// PersistHooks returns the persistence hook functions.
+func (ser *WatchSessionService) PersistHooks() *db.PersistHooks {
+	return &ser.Hooks
+}
+
+// Marshal encodes the given WatchSession for storage.
+func (ser *WatchSessionService) Marshal(m db.Model) ([]byte, error) {
+	ws, err := ser.AssertType(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+	}
+
+	v, err := db.Codecs.Encode(ser.Bucket(), ws)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelEncode, err)
+	}
+
+	return v, nil
+}
+
+// Unmarshal decodes the given record into WatchSession.
+func (ser *WatchSessionService) Unmarshal(buf []byte) (db.Model, error) {
+	var ws models.WatchSession
+	err := db.Codecs.Decode(buf, &ws)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelDecode, err)
+	}
+	return &ws, nil
+}
+
+// AssertType exposes the given db.Model as a WatchSession.
+func (ser *WatchSessionService) AssertType(m db.Model) (*models.WatchSession, error) {
+	if m == nil {
+		return nil, fmt.Errorf("model: %w", errNil)
+	}
+
+	ws, ok := m.(*models.WatchSession)
+	if !ok {
+		return nil, fmt.Errorf("model: %w", errors.New("not of WatchSession type"))
+	}
+	return ws, nil
+}
+
+// mapFromModel returns a list of WatchSession type asserted from the given
+// list of db.Model.
+func (ser *WatchSessionService) mapFromModel(vlist []db.Model) ([]*models.WatchSession, error) {
+	list := make([]*models.WatchSession, len(vlist))
+	var err error
+	for i, v := range vlist {
+		list[i], err = ser.AssertType(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelAssertType, err)
+		}
+	}
+	return list, nil
+}
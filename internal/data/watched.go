@@ -0,0 +1,322 @@
+package data
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// GetByUserMedia retrieves the watch states of the Episodes of the Media with
+// the given ID by the User with the given ID, regular Episodes in watch order
+// followed by specials. The states of Episodes the User has neither watched
+// nor rated are not persisted, and have no ID.
+func (ser *UserEpisodeService) GetByUserMedia(
+	uID int, mID int, tx db.Tx,
+) ([]*models.UserEpisode, error) {
+	u, err := ser.UserMediaService.units(mID, tx)
+	if err != nil {
+		return nil, err
+	}
+	states, err := ser.episodeStates(uID, u, tx)
+	if err != nil {
+		return nil, err
+	}
+	return u.states(states), nil
+}
+
+// MarkWatched marks the Episodes of the given EpisodeMark watched and returns
+// the UserMedia of its User and Media, which is nil if it does not exist, and
+// the watch states of the Episodes of the Media, as GetByUserMedia.
+//
+// The progress of the latest WatchedInstance of the UserMedia is derived from
+// the states, as the position of the last watched regular Episode, and
+// newly watched specials are recorded in it; both are stitched in as
+// Scrobbles, creating the UserMedia if it does not exist yet. During a
+// rewatch, only Episodes watched since it started count, and marking those
+// watched before counts them as rewatched. Marks never move progress
+// backwards, so that progress recorded without watch states is kept.
+func (ser *UserEpisodeService) MarkWatched(
+	mk *models.EpisodeMark, tx db.Tx,
+) (*models.UserMedia, []*models.UserEpisode, error) {
+	if mk == nil {
+		return nil, nil, fmt.Errorf("episode mark: %w", errNil)
+	}
+
+	u, err := ser.UserMediaService.units(mk.MediaID, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if mk.UpTo < 0 || mk.UpTo > len(u.regular) {
+		return nil, nil, fmt.Errorf("up to episode %d: not of Media with ID %d: %w",
+			mk.UpTo, mk.MediaID, ErrInvalid)
+	}
+
+	states, err := ser.episodeStates(mk.UserID, u, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	um, err := ser.userMedia(mk.UserID, mk.MediaID, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	var since *time.Time
+	if um != nil {
+		since = rewatchStart(um)
+	}
+	for _, id := range mk.EpisodeIDs {
+		if _, ok := states[id]; !ok {
+			return nil, nil, fmt.Errorf("Episode with ID %d: not of Media with ID %d: %w",
+				id, mk.MediaID, ErrInvalid)
+		}
+	}
+
+	changed := map[int]bool{}
+	specials := []int{}
+	mark := func(uep *models.UserEpisode, rewatch bool) {
+		t := mk.Time
+		if !watchedSince(uep, since) && u.isSpecial(uep.EpisodeID) {
+			specials = append(specials, uep.EpisodeID)
+		}
+		switch {
+		case !uep.Watched:
+			uep.Watched = true
+			uep.FirstWatched = &t
+		case rewatch:
+			uep.Rewatches++
+		default:
+			return
+		}
+		if uep.LastWatched == nil || t.After(*uep.LastWatched) {
+			uep.LastWatched = &t
+		}
+		changed[uep.EpisodeID] = true
+	}
+	for _, ep := range u.regular[:mk.UpTo] {
+		uep := states[ep.Meta.ID]
+		mark(uep, !watchedSince(uep, since))
+	}
+	for _, id := range mk.EpisodeIDs {
+		mark(states[id], true)
+	}
+
+	// States are persisted in watch order
+	for _, uep := range u.states(states) {
+		if !changed[uep.EpisodeID] {
+			continue
+		}
+		err = ser.persist(uep, tx)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	episodes := 0
+	if um != nil && len(um.WatchInstances) > 0 {
+		episodes = um.WatchInstances[len(um.WatchInstances)-1].Episodes
+	}
+	// Specials are recorded first, as they are in the instance the regular
+	// Episodes may complete
+	for _, id := range specials {
+		epID := id
+		um, err = ser.UserMediaService.scrobble(&models.Scrobble{
+			UserID:    mk.UserID,
+			MediaID:   mk.MediaID,
+			EpisodeID: &epID,
+			Time:      mk.Time,
+		}, u, tx)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if n := watchedUpTo(u, states, since); n > episodes {
+		um, err = ser.UserMediaService.scrobble(&models.Scrobble{
+			UserID:    mk.UserID,
+			MediaID:   mk.MediaID,
+			Episodes:  n,
+			Completed: n == len(u.regular),
+			Time:      mk.Time,
+		}, u, tx)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return um, u.states(states), nil
+}
+
+// MarkUnwatched marks the Episode with the given ID of the Media with the
+// given ID unwatched by the User with the given ID, clearing its timestamps
+// and rewatches, and returns the UserMedia and watch states as MarkWatched.
+//
+// If the latest WatchedInstance of the UserMedia counts more regular Episodes
+// than the position of the last one still watched, its progress is moved back
+// to that position and it is reopened, along with the UserMedia if
+// completed; unwatched specials are removed from it.
+func (ser *UserEpisodeService) MarkUnwatched(
+	uID int, mID int, epID int, tx db.Tx,
+) (*models.UserMedia, []*models.UserEpisode, error) {
+	u, err := ser.UserMediaService.units(mID, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	states, err := ser.episodeStates(uID, u, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	uep, ok := states[epID]
+	if !ok {
+		return nil, nil, fmt.Errorf("Episode with ID %d: not of Media with ID %d: %w",
+			epID, mID, ErrInvalid)
+	}
+
+	um, err := ser.userMedia(uID, mID, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !uep.Watched {
+		return um, u.states(states), nil
+	}
+
+	uep.Watched = false
+	uep.FirstWatched = nil
+	uep.LastWatched = nil
+	uep.Rewatches = 0
+	err = ser.persist(uep, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if um == nil || len(um.WatchInstances) == 0 {
+		return um, u.states(states), nil
+	}
+	latest := &um.WatchInstances[len(um.WatchInstances)-1]
+	changed := false
+	if u.isSpecial(epID) {
+		for i, id := range latest.Specials {
+			if id == epID {
+				latest.Specials = append(latest.Specials[:i], latest.Specials[i+1:]...)
+				changed = true
+				break
+			}
+		}
+	} else if n := watchedUpTo(u, states, rewatchStart(um)); latest.Episodes > n {
+		latest.Episodes = n
+		latest.Ongoing = true
+		if um.Status != nil && *um.Status == models.WatchStatusCompleted {
+			status := models.WatchStatusCurrent
+			um.Status = &status
+		}
+		changed = true
+	}
+	if changed {
+		err = ser.UserMediaService.Update(um, tx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to update UserMedia with ID %d: %w",
+				um.Meta.ID, err)
+		}
+	}
+	return um, u.states(states), nil
+}
+
+// episodeStates retrieves the watch states of the Episodes of the Media by
+// the User with the given ID, by Episode ID. Episodes without persisted states
+// are given unpersisted ones.
+func (ser *UserEpisodeService) episodeStates(
+	uID int, u *mediaUnits, tx db.Tx,
+) (map[int]*models.UserEpisode, error) {
+	states := map[int]*models.UserEpisode{}
+	for _, ep := range u.episodes() {
+		states[ep.Meta.ID] = &models.UserEpisode{UserID: uID, EpisodeID: ep.Meta.ID}
+	}
+
+	list, err := ser.GetFilter(nil, nil, tx, func(uep *models.UserEpisode) bool {
+		_, ok := states[uep.EpisodeID]
+		return uep.UserID == uID && ok
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get UserEpisodes by User ID %d and Media ID %d: %w",
+			uID, u.media.Meta.ID, err)
+	}
+	for _, uep := range list {
+		states[uep.EpisodeID] = uep
+	}
+	return states, nil
+}
+
+// persist creates the given UserEpisode if it has no ID, and updates it
+// otherwise.
+func (ser *UserEpisodeService) persist(uep *models.UserEpisode, tx db.Tx) error {
+	if uep.Meta.ID == 0 {
+		_, err := ser.Create(uep, tx)
+		if err != nil {
+			return fmt.Errorf("failed to create UserEpisode: %w", err)
+		}
+		return nil
+	}
+
+	err := ser.Update(uep, tx)
+	if err != nil {
+		return fmt.Errorf("failed to update UserEpisode with ID %d: %w", uep.Meta.ID, err)
+	}
+	return nil
+}
+
+// userMedia retrieves the UserMedia of the User and Media with the given IDs,
+// or nil if it does not exist.
+func (ser *UserEpisodeService) userMedia(
+	uID int, mID int, tx db.Tx,
+) (*models.UserMedia, error) {
+	list, err := ser.UserMediaService.GetFilter(nil, nil, tx, func(um *models.UserMedia) bool {
+		return um.UserID == uID && um.MediaID == mID
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get UserMedia by User ID %d and Media ID %d: %w",
+			uID, mID, err)
+	}
+	if len(list) == 0 {
+		return nil, nil
+	}
+	return list[0], nil
+}
+
+// episodes returns the Episodes of the Media, regular Episodes in watch order
+// followed by specials.
+func (u *mediaUnits) episodes() []*models.Episode {
+	eps := make([]*models.Episode, 0, len(u.regular)+len(u.specials))
+	eps = append(eps, u.regular...)
+	return append(eps, u.specials...)
+}
+
+// states returns the given watch states of the Episodes of the Media, in the
+// order of episodes.
+func (u *mediaUnits) states(states map[int]*models.UserEpisode) []*models.UserEpisode {
+	eps := u.episodes()
+	list := make([]*models.UserEpisode, len(eps))
+	for i, ep := range eps {
+		list[i] = states[ep.Meta.ID]
+	}
+	return list
+}
+
+// watchedUpTo returns the position of the last regular Episode of the Media
+// watched since the given time in the given watch states, or 0 if none is.
+// All watched Episodes count if the time is nil.
+func watchedUpTo(u *mediaUnits, states map[int]*models.UserEpisode, since *time.Time) int {
+	for i := len(u.regular) - 1; i >= 0; i-- {
+		if watchedSince(states[u.regular[i].Meta.ID], since) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// watchedSince returns true if the given watch state is of an Episode last
+// watched since the given time, or watched at all if the time is nil.
+func watchedSince(uep *models.UserEpisode, since *time.Time) bool {
+	if uep == nil || !uep.Watched {
+		return false
+	}
+	return since == nil || (uep.LastWatched != nil && !uep.LastWatched.Before(*since))
+}
@@ -0,0 +1,400 @@
+// Package fixtures loads declarative YAML fixtures into a database.
+//
+// A fixtures file maps bucket names to lists of entities, which are created in
+// the order they appear in the file. Each entity gives the properties of its
+// model, and may be named with the reserved "ref" property. Any string value
+// of the form "$name" is replaced with the ID of the entity named by the ref
+// "name", which must appear earlier in the file; "$$" escapes a literal "$".
+// As JSON is YAML, fixtures files may also be written in JSON.
+//
+//	Media:
+//	  - ref: bebop
+//	    Titles: [{String: Cowboy Bebop, Language: en}]
+//	Genre:
+//	  - ref: scifi
+//	    Names: [{String: Sci-Fi, Language: en}]
+//	MediaGenre:
+//	  - MediaID: $bebop
+//	    GenreID: $scifi
+package fixtures
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	json "github.com/json-iterator/go"
+	"gopkg.in/yaml.v2"
+)
+
+// RefKey is the reserved entity property that names the entity for
+// references.
+const RefKey = "ref"
+
+// Fixtures is a set of entities to be loaded into a database.
+type Fixtures struct {
+	Buckets []Bucket
+}
+
+// Bucket is a list of entities of the same type.
+type Bucket struct {
+	Name     string
+	Entities []Entity
+}
+
+// Entity is a single entity to be created.
+type Entity struct {
+	// Ref is the name by which other entities refer to the entity, if any.
+	Ref    string
+	Fields map[string]interface{}
+}
+
+// Refs maps the names of loaded entities to their IDs.
+type Refs map[string]int
+
+// Skip selects the entities skipped by LoadSkipTx.
+type Skip struct {
+	// Buckets are the names of the buckets whose entities are skipped.
+	Buckets map[string]bool
+	// refs are the refs of the entities skipped so far.
+	refs map[string]bool
+}
+
+// errSkipped is returned when resolving a reference to a skipped entity.
+var errSkipped = errors.New("refers to a skipped entity")
+
+// extensions are the file extensions of fixtures files in directories.
+var extensions = []string{".yml", ".yaml", ".json"}
+
+// Parse parses the given YAML document into Fixtures.
+func Parse(buf []byte) (*Fixtures, error) {
+	var doc yaml.MapSlice
+	err := yaml.Unmarshal(buf, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+
+	var f Fixtures
+	for _, item := range doc {
+		name, ok := item.Key.(string)
+		if !ok {
+			return nil, fmt.Errorf("bucket name %v: not a string", item.Key)
+		}
+
+		list, ok := item.Value.([]interface{})
+		if !ok && item.Value != nil {
+			return nil, fmt.Errorf("bucket %q: not a list of entities", name)
+		}
+
+		b := Bucket{Name: name, Entities: make([]Entity, len(list))}
+		for i, v := range list {
+			fields, err := normalize(v)
+			if err != nil {
+				return nil, fmt.Errorf("bucket %q entity %d: %w", name, i, err)
+			}
+			m, ok := fields.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("bucket %q entity %d: not a map", name, i)
+			}
+
+			if ref, ok := m[RefKey]; ok {
+				b.Entities[i].Ref = fmt.Sprint(ref)
+				delete(m, RefKey)
+			}
+			b.Entities[i].Fields = m
+		}
+		f.Buckets = append(f.Buckets, b)
+	}
+	return &f, nil
+}
+
+// ReadFile reads and parses the fixtures file at the given path.
+func ReadFile(path string) (*Fixtures, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures file %q: %w", path, err)
+	}
+
+	f, err := Parse(buf)
+	if err != nil {
+		return nil, fmt.Errorf("fixtures file %q: %w", path, err)
+	}
+	return f, nil
+}
+
+// Files returns the given paths of fixtures files with the directories among
+// them replaced by the fixtures files they contain, in order of name.
+func Files(paths ...string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixtures path %q: %w", path, err)
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixtures directory %q: %w", path, err)
+		}
+
+		for _, e := range entries {
+			if e.IsDir() || !hasExtension(e.Name()) {
+				continue
+			}
+			files = append(files, filepath.Join(path, e.Name()))
+		}
+	}
+	return files, nil
+}
+
+func hasExtension(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range extensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// Load creates all the entities of the given fixtures in a single
+// transaction, so that either all or none are created.
+func Load(f *Fixtures, ds *graphql.DataService) (Refs, error) {
+	refs := Refs{}
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		return LoadTx(f, ds, tx, refs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// LoadTx creates all the entities of the given fixtures in the given
+// transaction. References are resolved with the given Refs, to which the refs
+// of the created entities are added.
+func LoadTx(f *Fixtures, ds *graphql.DataService, tx db.Tx, refs Refs) error {
+	_, err := LoadSkipTx(f, ds, tx, refs, nil)
+	return err
+}
+
+// LoadSkipTx creates the entities of the given fixtures in the given
+// transaction like LoadTx, except those of the buckets selected by the given
+// Skip, if not nil, and those that refer to entities skipped. It returns the
+// number of entities created.
+func LoadSkipTx(
+	f *Fixtures, ds *graphql.DataService, tx db.Tx, refs Refs, skip *Skip,
+) (int, error) {
+	creators := newCreators(ds)
+	if skip != nil && skip.refs == nil {
+		skip.refs = map[string]bool{}
+	}
+
+	n := 0
+	for _, b := range f.Buckets {
+		create, ok := creators[b.Name]
+		if !ok {
+			return n, fmt.Errorf("bucket %q: unknown", b.Name)
+		}
+
+		for i, e := range b.Entities {
+			if e.Ref != "" {
+				_, created := refs[e.Ref]
+				if created || (skip != nil && skip.refs[e.Ref]) {
+					return n, fmt.Errorf("ref %q: defined more than once", e.Ref)
+				}
+			}
+
+			resolved, err := resolve(e.Fields, refs, skip)
+			if skip != nil && (skip.Buckets[b.Name] || errors.Is(err, errSkipped)) {
+				if e.Ref != "" {
+					skip.refs[e.Ref] = true
+				}
+				continue
+			}
+			if err != nil {
+				return n, fmt.Errorf("bucket %q entity %d: %w", b.Name, i, err)
+			}
+
+			buf, err := json.Marshal(resolved)
+			if err != nil {
+				return n, fmt.Errorf("bucket %q entity %d: %w", b.Name, i, err)
+			}
+
+			id, err := create(buf, tx)
+			if err != nil {
+				return n, fmt.Errorf("failed to create %s entity %d: %w", b.Name, i, err)
+			}
+			n++
+
+			if e.Ref != "" {
+				refs[e.Ref] = id
+			}
+		}
+	}
+	return n, nil
+}
+
+// normalize converts the ordered maps decoded from YAML into maps with string
+// keys, which can be encoded into JSON.
+func normalize(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case yaml.MapSlice:
+		m := make(map[string]interface{}, len(v))
+		for _, item := range v {
+			key, ok := item.Key.(string)
+			if !ok {
+				return nil, fmt.Errorf("key %v: not a string", item.Key)
+			}
+			n, err := normalize(item.Value)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = n
+		}
+		return m, nil
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, val := range v {
+			n, err := normalize(val)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = n
+		}
+		return list, nil
+	}
+	return v, nil
+}
+
+// resolve returns a copy of the given value with references replaced by the
+// IDs of the entities they name. References to entities selected by the given
+// Skip, if not nil, return errSkipped.
+func resolve(v interface{}, refs Refs, skip *Skip) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			r, err := resolve(val, refs, skip)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			m[k] = r
+		}
+		return m, nil
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, val := range v {
+			r, err := resolve(val, refs, skip)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = r
+		}
+		return list, nil
+	case string:
+		if strings.HasPrefix(v, "$$") {
+			return v[1:], nil
+		}
+		if strings.HasPrefix(v, "$") {
+			id, ok := refs[v[1:]]
+			if !ok && skip != nil && skip.refs[v[1:]] {
+				return nil, fmt.Errorf("ref %q: %w", v[1:], errSkipped)
+			}
+			if !ok {
+				return nil, fmt.Errorf("ref %q: not defined", v[1:])
+			}
+			return id, nil
+		}
+	}
+	return v, nil
+}
+
+// creator creates an entity from its JSON encoding and returns its ID.
+type creator func(buf []byte, tx db.Tx) (int, error)
+
+// generic returns a creator of entities of the given service.
+func generic(ser db.Service, newModel func() db.Model) creator {
+	return func(buf []byte, tx db.Tx) (int, error) {
+		m := newModel()
+		err := json.Unmarshal(buf, m)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decode entity: %w", err)
+		}
+		return tx.Database().Create(m, ser, tx)
+	}
+}
+
+// userFixture is the form of User fixtures, with a plain text password.
+type userFixture struct {
+	Username    string
+	Email       string
+	Password    string
+	Permissions models.UserPermission
+}
+
+// newCreators returns the creators of the entities of each bucket of the
+// given data layer.
+func newCreators(ds *graphql.DataService) map[string]creator {
+	creators := map[string]creator{
+		ds.CharacterService.Bucket(): generic(ds.CharacterService,
+			func() db.Model { return &models.Character{} }),
+		ds.EpisodeService.Bucket(): generic(ds.EpisodeService,
+			func() db.Model { return &models.Episode{} }),
+		ds.EpisodeSetService.Bucket(): generic(ds.EpisodeSetService,
+			func() db.Model { return &models.EpisodeSet{} }),
+		ds.GenreService.Bucket(): generic(ds.GenreService,
+			func() db.Model { return &models.Genre{} }),
+		ds.MediaService.Bucket(): generic(ds.MediaService,
+			func() db.Model { return &models.Media{} }),
+		ds.MediaCharacterService.Bucket(): generic(ds.MediaCharacterService,
+			func() db.Model { return &models.MediaCharacter{} }),
+		ds.MediaGenreService.Bucket(): generic(ds.MediaGenreService,
+			func() db.Model { return &models.MediaGenre{} }),
+		ds.MediaProducerService.Bucket(): generic(ds.MediaProducerService,
+			func() db.Model { return &models.MediaProducer{} }),
+		ds.MediaRelationSerivce.Bucket(): generic(ds.MediaRelationSerivce,
+			func() db.Model { return &models.MediaRelation{} }),
+		ds.MediaStaffService.Bucket(): generic(ds.MediaStaffService,
+			func() db.Model { return &models.MediaStaff{} }),
+		ds.PersonService.Bucket(): generic(ds.PersonService,
+			func() db.Model { return &models.Person{} }),
+		ds.ProducerService.Bucket(): generic(ds.ProducerService,
+			func() db.Model { return &models.Producer{} }),
+		ds.ProducerStaffService.Bucket(): generic(ds.ProducerStaffService,
+			func() db.Model { return &models.ProducerStaff{} }),
+		ds.UserMediaService.Bucket(): generic(ds.UserMediaService,
+			func() db.Model { return &models.UserMedia{} }),
+		ds.UserMediaListService.Bucket(): generic(ds.UserMediaListService,
+			func() db.Model { return &models.UserMediaList{} }),
+		ds.UserEpisodeService.Bucket(): generic(ds.UserEpisodeService,
+			func() db.Model { return &models.UserEpisode{} }),
+	}
+
+	// Users are created through the service so that passwords are hashed
+	creators[ds.UserService.Bucket()] = func(buf []byte, tx db.Tx) (int, error) {
+		var uf userFixture
+		err := json.Unmarshal(buf, &uf)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decode entity: %w", err)
+		}
+		return ds.UserService.Create(&models.User{
+			Username:    uf.Username,
+			Email:       uf.Email,
+			Password:    []byte(uf.Password),
+			Permissions: uf.Permissions,
+		}, tx)
+	}
+
+	return creators
+}
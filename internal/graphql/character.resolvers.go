@@ -12,23 +12,23 @@ import (
 )
 
 func (r *characterResolver) Names(ctx context.Context, obj *models.Character, first *int, skip *int) ([]*models.Title, error) {
-	return sliceTitles(obj.Names, first, skip), nil
+	return sliceTitles(localizeTitles(ctx, obj.Names), first, skip), nil
 }
 
 func (r *characterResolver) Information(ctx context.Context, obj *models.Character, first *int, skip *int) ([]*models.Title, error) {
-	return sliceTitles(obj.Information, first, skip), nil
+	return sliceTitles(localizeTitles(ctx, obj.Information), first, skip), nil
 }
 
-func (r *characterResolver) Media(ctx context.Context, obj *models.Character, first *int, skip *int) ([]*models.MediaCharacter, error) {
+func (r *characterResolver) Media(ctx context.Context, obj *models.Character, first *int, after *string, last *int, before *string) (*MediaCharacterConnection, error) {
 	ds, err := getCtxDataService(ctx)
 	if err != nil {
 		return nil, errorGetDataServices(err)
 	}
 
 	var list []*models.MediaCharacter
-	err = ds.Database.Transaction(false, func(tx db.Tx) error {
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
 		ser := ds.MediaCharacterService
-		list, err = ser.GetByCharacter(obj.Meta.ID, first, skip, tx)
+		list, err = ser.GetByCharacter(obj.Meta.ID, nil, nil, tx)
 		if err != nil {
 			return fmt.Errorf("failed to get MediaCharacters by Character id %d: %w",
 				obj.Meta.ID, err)
@@ -39,7 +39,23 @@ func (r *characterResolver) Media(ctx context.Context, obj *models.Character, fi
 		return nil, err
 	}
 
-	return list, nil
+	start, end, info, err := paginate(len(list), func(i int) int {
+		return list[i].Meta.ID
+	}, first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := MediaCharacterConnection{
+		Edges:      make([]*MediaCharacterEdge, 0, end-start),
+		Nodes:      list[start:end],
+		PageInfo:   info,
+		TotalCount: len(list),
+	}
+	for _, mc := range conn.Nodes {
+		conn.Edges = append(conn.Edges, &MediaCharacterEdge{Cursor: db.EncodeCursor(mc.Meta.ID), Node: mc})
+	}
+	return &conn, nil
 }
 
 // Character returns CharacterResolver implementation.
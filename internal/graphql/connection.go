@@ -0,0 +1,97 @@
+package graphql
+
+import (
+	"fmt"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// PageInfo describes the page of a list returned in a connection.
+type PageInfo struct {
+	HasNextPage     bool
+	HasPreviousPage bool
+	StartCursor     *string
+	EndCursor       *string
+}
+
+// paginate returns the bounds of the page of a list of n items, the ith of
+// which has the given ID, selected by the arguments of a connection field, and
+// its PageInfo. The after and before cursors bound the list exclusively; then
+// the first or last of the rest are selected. Cursors of IDs no longer in the
+// list fall between the IDs around them in key order.
+func paginate(
+	n int, id func(i int) int, first *int, after *string, last *int, before *string,
+) (int, int, *PageInfo, error) {
+	if first != nil && *first < 0 {
+		return 0, 0, nil, fmt.Errorf("first %d: must not be negative: %w",
+			*first, data.ErrInvalid)
+	}
+	if last != nil && *last < 0 {
+		return 0, 0, nil, fmt.Errorf("last %d: must not be negative: %w",
+			*last, data.ErrInvalid)
+	}
+
+	start, end := 0, n
+	if after != nil {
+		i, found, err := cursorIndex(n, id, *after)
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("after: %w", err)
+		}
+		if found {
+			i++
+		}
+		start = i
+	}
+	if before != nil {
+		i, _, err := cursorIndex(n, id, *before)
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("before: %w", err)
+		}
+		if i < end {
+			end = i
+		}
+	}
+	if start > end {
+		start = end
+	}
+
+	if first != nil && start+*first < end {
+		end = start + *first
+	}
+	if last != nil && end-*last > start {
+		start = end - *last
+	}
+
+	info := PageInfo{
+		HasNextPage:     end < n,
+		HasPreviousPage: start > 0,
+	}
+	if start < end {
+		sc, ec := db.EncodeCursor(id(start)), db.EncodeCursor(id(end-1))
+		info.StartCursor, info.EndCursor = &sc, &ec
+	}
+	return start, end, &info, nil
+}
+
+// cursorIndex returns the index of the item the cursor points to in a list of
+// n items, the ith of which has the given ID, and true; or, if the item is not
+// in the list, the index of the first item after it in key order and false.
+func cursorIndex(n int, id func(i int) int, cursor string) (int, bool, error) {
+	cID, err := db.DecodeCursor(cursor)
+	if err != nil {
+		return 0, false, err
+	}
+
+	next := n
+	for i := 0; i < n; i++ {
+		o := id(i)
+		if o == cID {
+			return i, true, nil
+		}
+		if o > cID && next == n {
+			next = i
+		}
+	}
+	return next, false, nil
+}
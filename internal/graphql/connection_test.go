@@ -0,0 +1,65 @@
+package graphql
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// TestPaginate tests that pages are bounded by cursors, including cursors of
+// IDs no longer in the list, and cut to the first or last of the rest.
+func TestPaginate(t *testing.T) {
+	point := func(a int) *int {
+		return &a
+	}
+	cursor := func(id int) *string {
+		c := db.EncodeCursor(id)
+		return &c
+	}
+
+	ids := []int{10, 20, 30, 40, 50}
+	id := func(i int) int {
+		return ids[i]
+	}
+
+	cases := []struct {
+		name       string
+		first      *int
+		after      *string
+		last       *int
+		before     *string
+		start, end int
+	}{
+		{"all", nil, nil, nil, nil, 0, 5},
+		{"first", point(2), nil, nil, nil, 0, 2},
+		{"first after", point(2), cursor(20), nil, nil, 2, 4},
+		{"after missing", point(2), cursor(25), nil, nil, 2, 4},
+		{"last before", nil, nil, point(2), cursor(40), 1, 3},
+		{"after before", nil, cursor(10), nil, cursor(40), 1, 3},
+		{"after end", nil, cursor(50), nil, nil, 5, 5},
+	}
+	for _, c := range cases {
+		start, end, info, err := paginate(len(ids), id, c.first, c.after, c.last, c.before)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+			continue
+		}
+		if start != c.start || end != c.end {
+			t.Errorf("%s: expected [%d, %d), got [%d, %d)", c.name, c.start, c.end, start, end)
+		}
+		if info.HasPreviousPage != (start > 0) || info.HasNextPage != (end < len(ids)) {
+			t.Errorf("%s: unexpected page info %+v", c.name, *info)
+		}
+		if start < end && *info.StartCursor != db.EncodeCursor(ids[start]) {
+			t.Errorf("%s: expected start cursor of ID %d", c.name, ids[start])
+		}
+	}
+
+	bad := "not a cursor"
+	_, _, _, err := paginate(len(ids), id, nil, &bad, nil, nil)
+	if !errors.Is(err, data.ErrInvalid) {
+		t.Errorf("expected invalid cursor, got %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package graphql
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+func (r *entityResolver) FindMediaByID(ctx context.Context, id int) (*models.Media, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	var md *models.Media
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		md, err = ds.MediaService.GetByID(id, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get Media by id %d: %w", id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+func (r *entityResolver) FindPersonByID(ctx context.Context, id int) (*models.Person, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	var p *models.Person
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		p, err = ds.PersonService.GetByID(id, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get Person by id %d: %w", id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (r *entityResolver) FindUserByID(ctx context.Context, id int) (*models.User, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	// Users are resolved only for callers that may view their profiles
+	var u *models.User
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		err = ds.UserService.AuthorizeViewAs(getCtxUser(ctx), id, models.PrivacyProfile, tx)
+		if err != nil {
+			return err
+		}
+		u, err = ds.UserService.GetByID(id, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get User by id %d: %w", id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Entity returns EntityResolver implementation.
+func (r *Resolver) Entity() EntityResolver { return &entityResolver{r} }
+
+type entityResolver struct{ *Resolver }
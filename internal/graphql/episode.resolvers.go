@@ -12,11 +12,11 @@ import (
 )
 
 func (r *episodeResolver) Titles(ctx context.Context, obj *models.Episode, first *int, skip *int) ([]*models.Title, error) {
-	return sliceTitles(obj.Titles, first, skip), nil
+	return sliceTitles(localizeTitles(ctx, obj.Titles), first, skip), nil
 }
 
 func (r *episodeResolver) Synopses(ctx context.Context, obj *models.Episode, first *int, skip *int) ([]*models.Title, error) {
-	return sliceTitles(obj.Synopses, first, skip), nil
+	return sliceTitles(localizeTitles(ctx, obj.Synopses), first, skip), nil
 }
 
 func (r *episodeSetResolver) Media(ctx context.Context, obj *models.EpisodeSet) (*models.Media, error) {
@@ -26,7 +26,7 @@ func (r *episodeSetResolver) Media(ctx context.Context, obj *models.EpisodeSet)
 	}
 
 	var md *models.Media
-	err = ds.Database.Transaction(false, func(tx db.Tx) error {
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
 		ser := ds.MediaService
 		md, err = ser.GetByID(obj.MediaID, tx)
 		if err != nil {
@@ -42,21 +42,21 @@ func (r *episodeSetResolver) Media(ctx context.Context, obj *models.EpisodeSet)
 }
 
 func (r *episodeSetResolver) Descriptions(ctx context.Context, obj *models.EpisodeSet, first *int, skip *int) ([]*models.Title, error) {
-	return sliceTitles(obj.Descriptions, first, skip), nil
+	return sliceTitles(localizeTitles(ctx, obj.Descriptions), first, skip), nil
 }
 
-func (r *episodeSetResolver) Episodes(ctx context.Context, obj *models.EpisodeSet, first *int) ([]*models.Episode, error) {
+func (r *episodeSetResolver) Episodes(ctx context.Context, obj *models.EpisodeSet, first *int, after *string, last *int, before *string) (*EpisodeConnection, error) {
 	ds, err := getCtxDataService(ctx)
 	if err != nil {
 		return nil, errorGetDataServices(err)
 	}
 
 	var list []*models.Episode
-	err = ds.Database.Transaction(false, func(tx db.Tx) error {
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
 		ser := ds.EpisodeService
 		list, err = ser.GetMultiple(obj.Episodes, tx, nil)
 		if err != nil {
-			return fmt.Errorf("failed to get Epiosodes by ids: %w", err)
+			return fmt.Errorf("failed to get Episodes by ids: %w", err)
 		}
 		return nil
 	})
@@ -64,7 +64,23 @@ func (r *episodeSetResolver) Episodes(ctx context.Context, obj *models.EpisodeSe
 		return nil, err
 	}
 
-	return list, nil
+	start, end, info, err := paginate(len(list), func(i int) int {
+		return list[i].Meta.ID
+	}, first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := EpisodeConnection{
+		Edges:      make([]*EpisodeEdge, 0, end-start),
+		Nodes:      list[start:end],
+		PageInfo:   info,
+		TotalCount: len(list),
+	}
+	for _, ep := range conn.Nodes {
+		conn.Edges = append(conn.Edges, &EpisodeEdge{Cursor: db.EncodeCursor(ep.Meta.ID), Node: ep})
+	}
+	return &conn, nil
 }
 
 // Episode returns EpisodeResolver implementation.
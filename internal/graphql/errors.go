@@ -0,0 +1,25 @@
+package graphql
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// PresentError converts the given resolver error into a GraphQL error, with
+// the error code of the data layer error it wraps in the "code" extension,
+// and the problems with the fields of a ValidationError in the "fields"
+// extension.
+func PresentError(ctx context.Context, err error) *gqlerror.Error {
+	gqlerr := graphql.DefaultErrorPresenter(ctx, err)
+	if gqlerr.Extensions == nil {
+		gqlerr.Extensions = map[string]interface{}{}
+	}
+	gqlerr.Extensions["code"] = web.ErrorCode(err)
+	if fields := web.ErrorFields(err); fields != nil {
+		gqlerr.Extensions["fields"] = fields
+	}
+	return gqlerr
+}
@@ -12,23 +12,23 @@ import (
 )
 
 func (r *genreResolver) Names(ctx context.Context, obj *models.Genre, first *int, skip *int) ([]*models.Title, error) {
-	return sliceTitles(obj.Names, first, skip), nil
+	return sliceTitles(localizeTitles(ctx, obj.Names), first, skip), nil
 }
 
 func (r *genreResolver) Descriptions(ctx context.Context, obj *models.Genre, first *int, skip *int) ([]*models.Title, error) {
-	return sliceTitles(obj.Descriptions, first, skip), nil
+	return sliceTitles(localizeTitles(ctx, obj.Descriptions), first, skip), nil
 }
 
-func (r *genreResolver) Media(ctx context.Context, obj *models.Genre, first *int, skip *int) ([]*models.MediaGenre, error) {
+func (r *genreResolver) Media(ctx context.Context, obj *models.Genre, first *int, after *string, last *int, before *string) (*MediaGenreConnection, error) {
 	ds, err := getCtxDataService(ctx)
 	if err != nil {
 		return nil, errorGetDataServices(err)
 	}
 
 	var list []*models.MediaGenre
-	err = ds.Database.Transaction(false, func(tx db.Tx) error {
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
 		ser := ds.MediaGenreService
-		list, err = ser.GetByGenre(obj.Meta.ID, first, skip, tx)
+		list, err = ser.GetByGenre(obj.Meta.ID, nil, nil, tx)
 		if err != nil {
 			return fmt.Errorf("failed to get MediaGenres by Genre id %d: %w",
 				obj.Meta.ID, err)
@@ -39,7 +39,23 @@ func (r *genreResolver) Media(ctx context.Context, obj *models.Genre, first *int
 		return nil, err
 	}
 
-	return list, nil
+	start, end, info, err := paginate(len(list), func(i int) int {
+		return list[i].Meta.ID
+	}, first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := MediaGenreConnection{
+		Edges:      make([]*MediaGenreEdge, 0, end-start),
+		Nodes:      list[start:end],
+		PageInfo:   info,
+		TotalCount: len(list),
+	}
+	for _, mg := range conn.Nodes {
+		conn.Edges = append(conn.Edges, &MediaGenreEdge{Cursor: db.EncodeCursor(mg.Meta.ID), Node: mg})
+	}
+	return &conn, nil
 }
 
 // Genre returns GenreResolver implementation.
@@ -7,100 +7,292 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/Dophin2009/nao/internal/data"
 	"github.com/Dophin2009/nao/pkg/db"
 	"github.com/Dophin2009/nao/pkg/models"
 )
 
+func (r *mediaResolver) ID(ctx context.Context, obj *models.Media) (int, error) {
+	return obj.Meta.ID, nil
+}
+
 func (r *mediaResolver) Titles(ctx context.Context, obj *models.Media, first *int, skip *int) ([]*models.Title, error) {
-	return sliceTitles(obj.Titles, first, skip), nil
+	return sliceTitles(localizeTitles(ctx, obj.Titles), first, skip), nil
+}
+
+func (r *mediaResolver) Aliases(ctx context.Context, obj *models.Media) ([]*models.MediaAlias, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	var list []*models.MediaAlias
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		list, err = ds.MediaAliasService.GetByMedia(obj.Meta.ID, nil, nil, tx)
+		if err != nil {
+			return fmt.Errorf(
+				"failed to get MediaAliases by Media id %d: %w", obj.Meta.ID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
 }
 
 func (r *mediaResolver) Synopses(ctx context.Context, obj *models.Media, first *int, skip *int) ([]*models.Title, error) {
-	return sliceTitles(obj.Synopses, first, skip), nil
+	return sliceTitles(localizeTitles(ctx, obj.Synopses), first, skip), nil
 }
 
 func (r *mediaResolver) Background(ctx context.Context, obj *models.Media, first *int, skip *int) ([]*models.Title, error) {
-	return sliceTitles(obj.Titles, first, skip), nil
+	return sliceTitles(localizeTitles(ctx, obj.Background), first, skip), nil
 }
 
-func (r *mediaResolver) EpisodeSets(ctx context.Context, obj *models.Media, first *int, skip *int) ([]*models.EpisodeSet, error) {
+func (r *mediaResolver) EpisodeSets(ctx context.Context, obj *models.Media, first *int, after *string, last *int, before *string) (*EpisodeSetConnection, error) {
 	ds, err := getCtxDataService(ctx)
 	if err != nil {
 		return nil, errorGetDataServices(err)
 	}
 
 	var list []*models.EpisodeSet
-	ds.Database.Transaction(false, func(tx db.Tx) error {
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
 		ser := ds.EpisodeSetService
-		list, err = ser.GetByMedia(obj.Meta.ID, first, skip, tx)
+		list, err = ser.GetByMedia(obj.Meta.ID, nil, nil, tx)
 		if err != nil {
 			return fmt.Errorf("failed to get EpisodeSets by Media id %d: %w",
 				obj.Meta.ID, err)
 		}
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	return list, nil
+	start, end, info, err := paginate(len(list), func(i int) int {
+		return list[i].Meta.ID
+	}, first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := EpisodeSetConnection{
+		Edges:      make([]*EpisodeSetEdge, 0, end-start),
+		Nodes:      list[start:end],
+		PageInfo:   info,
+		TotalCount: len(list),
+	}
+	for _, set := range conn.Nodes {
+		conn.Edges = append(conn.Edges, &EpisodeSetEdge{Cursor: db.EncodeCursor(set.Meta.ID), Node: set})
+	}
+	return &conn, nil
 }
 
-func (r *mediaResolver) Producers(ctx context.Context, obj *models.Media, first *int, skip *int) ([]*models.MediaProducer, error) {
+func (r *mediaResolver) Producers(ctx context.Context, obj *models.Media, first *int, after *string, last *int, before *string) (*MediaProducerConnection, error) {
 	ds, err := getCtxDataService(ctx)
 	if err != nil {
 		return nil, errorGetDataServices(err)
 	}
 
 	var list []*models.MediaProducer
-	err = ds.Database.Transaction(false, func(tx db.Tx) error {
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
 		ser := ds.MediaProducerService
-		list, err = ser.GetByMedia(obj.Meta.ID, first, skip, tx)
+		list, err = ser.GetByMedia(obj.Meta.ID, nil, nil, tx)
 		if err != nil {
 			return fmt.Errorf("failed to get MediaProducers by Media id %d: %w",
 				obj.Meta.ID, err)
 		}
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	return list, nil
+	start, end, info, err := paginate(len(list), func(i int) int {
+		return list[i].Meta.ID
+	}, first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := MediaProducerConnection{
+		Edges:      make([]*MediaProducerEdge, 0, end-start),
+		Nodes:      list[start:end],
+		PageInfo:   info,
+		TotalCount: len(list),
+	}
+	for _, mp := range conn.Nodes {
+		conn.Edges = append(conn.Edges, &MediaProducerEdge{Cursor: db.EncodeCursor(mp.Meta.ID), Node: mp})
+	}
+	return &conn, nil
 }
 
-func (r *mediaResolver) Characters(ctx context.Context, obj *models.Media, first *int, skip *int) ([]*models.MediaCharacter, error) {
+func (r *mediaResolver) Characters(ctx context.Context, obj *models.Media, first *int, after *string, last *int, before *string, role *string) (*MediaCharacterConnection, error) {
 	ds, err := getCtxDataService(ctx)
 	if err != nil {
 		return nil, errorGetDataServices(err)
 	}
 
+	var name string
+	if role != nil {
+		name, err = models.ParseCharacterRole(*role)
+		if err != nil {
+			return nil, fmt.Errorf("role: %v: %w", err, data.ErrInvalid)
+		}
+	}
+
 	var list []*models.MediaCharacter
-	err = ds.Database.Transaction(false, func(tx db.Tx) error {
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
 		ser := ds.MediaCharacterService
-		list, err = ser.GetByMedia(obj.Meta.ID, first, skip, tx)
+		if role != nil {
+			list, err = ser.GetByMediaRole(obj.Meta.ID, name, nil, nil, tx)
+		} else {
+			list, err = ser.GetByMedia(obj.Meta.ID, nil, nil, tx)
+		}
 		if err != nil {
 			return fmt.Errorf(
 				"failed to get MediaCharacters by Media id %d: %w", obj.Meta.ID, err)
 		}
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	return list, nil
+	start, end, info, err := paginate(len(list), func(i int) int {
+		return list[i].Meta.ID
+	}, first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := MediaCharacterConnection{
+		Edges:      make([]*MediaCharacterEdge, 0, end-start),
+		Nodes:      list[start:end],
+		PageInfo:   info,
+		TotalCount: len(list),
+	}
+	for _, mc := range conn.Nodes {
+		conn.Edges = append(conn.Edges, &MediaCharacterEdge{Cursor: db.EncodeCursor(mc.Meta.ID), Node: mc})
+	}
+	return &conn, nil
+}
+
+func (r *mediaResolver) Staff(ctx context.Context, obj *models.Media, first *int, after *string, last *int, before *string) (*MediaStaffConnection, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	var list []*models.MediaStaff
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		ser := ds.MediaStaffService
+		list, err = ser.GetByMedia(obj.Meta.ID, nil, nil, tx)
+		if err != nil {
+			return fmt.Errorf(
+				"failed to get MediaStaff by Media id %d: %w", obj.Meta.ID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, info, err := paginate(len(list), func(i int) int {
+		return list[i].Meta.ID
+	}, first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := MediaStaffConnection{
+		Edges:      make([]*MediaStaffEdge, 0, end-start),
+		Nodes:      list[start:end],
+		PageInfo:   info,
+		TotalCount: len(list),
+	}
+	for _, ms := range conn.Nodes {
+		conn.Edges = append(conn.Edges, &MediaStaffEdge{Cursor: db.EncodeCursor(ms.Meta.ID), Node: ms})
+	}
+	return &conn, nil
 }
 
-func (r *mediaResolver) Genres(ctx context.Context, obj *models.Media, first *int, skip *int) ([]*models.MediaGenre, error) {
+func (r *mediaResolver) Genres(ctx context.Context, obj *models.Media, first *int, after *string, last *int, before *string) (*MediaGenreConnection, error) {
 	ds, err := getCtxDataService(ctx)
 	if err != nil {
 		return nil, errorGetDataServices(err)
 	}
 
 	var list []*models.MediaGenre
-	err = ds.Database.Transaction(false, func(tx db.Tx) error {
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
 		ser := ds.MediaGenreService
-		list, err = ser.GetByMedia(obj.Meta.ID, first, skip, tx)
+		list, err = ser.GetByMedia(obj.Meta.ID, nil, nil, tx)
 		if err != nil {
 			return fmt.Errorf("failed to get MediaGenres by Media id %d: %w",
 				obj.Meta.ID, err)
 		}
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	return list, nil
+	start, end, info, err := paginate(len(list), func(i int) int {
+		return list[i].Meta.ID
+	}, first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := MediaGenreConnection{
+		Edges:      make([]*MediaGenreEdge, 0, end-start),
+		Nodes:      list[start:end],
+		PageInfo:   info,
+		TotalCount: len(list),
+	}
+	for _, mg := range conn.Nodes {
+		conn.Edges = append(conn.Edges, &MediaGenreEdge{Cursor: db.EncodeCursor(mg.Meta.ID), Node: mg})
+	}
+	return &conn, nil
+}
+
+func (r *mediaResolver) Reviews(ctx context.Context, obj *models.Media, first *int, after *string, last *int, before *string) (*ReviewConnection, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	var list []*models.Review
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		ser := ds.ReviewService
+		list, err = ser.GetByMediaAs(getCtxUser(ctx), obj.Meta.ID, nil, nil, nil, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get Reviews by Media id %d: %w",
+				obj.Meta.ID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, info, err := paginate(len(list), func(i int) int {
+		return list[i].Meta.ID
+	}, first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := ReviewConnection{
+		Edges:      make([]*ReviewEdge, 0, end-start),
+		Nodes:      list[start:end],
+		PageInfo:   info,
+		TotalCount: len(list),
+	}
+	for _, rv := range conn.Nodes {
+		conn.Edges = append(conn.Edges, &ReviewEdge{Cursor: db.EncodeCursor(rv.Meta.ID), Node: rv})
+	}
+	return &conn, nil
 }
 
 // Media returns MediaResolver implementation.
@@ -0,0 +1,19 @@
+package graphql
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+
+import (
+	"context"
+
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+func (r *mediaAliasResolver) Media(ctx context.Context, obj *models.MediaAlias) (*models.Media, error) {
+	return resolveMediaByID(ctx, obj.MediaID)
+}
+
+// MediaAlias returns MediaAliasResolver implementation.
+func (r *Resolver) MediaAlias() MediaAliasResolver { return &mediaAliasResolver{r} }
+
+type mediaAliasResolver struct{ *Resolver }
@@ -26,7 +26,7 @@ func (r *mediaCharacterResolver) Character(ctx context.Context, obj *models.Medi
 	}
 
 	var c *models.Character
-	err = ds.Database.Transaction(false, func(tx db.Tx) error {
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
 		ser := ds.CharacterService
 		c, err = ser.GetByID(*obj.CharacterID, tx)
 		if err != nil {
@@ -50,7 +50,7 @@ func (r *mediaCharacterResolver) Person(ctx context.Context, obj *models.MediaCh
 	}
 
 	var p *models.Person
-	err = ds.Database.Transaction(false, func(tx db.Tx) error {
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
 		ser := ds.PersonService
 		p, err = ser.GetByID(*obj.PersonID, tx)
 		if err != nil {
@@ -22,7 +22,7 @@ func (r *mediaGenreResolver) Genre(ctx context.Context, obj *models.MediaGenre)
 	}
 
 	var g *models.Genre
-	err = ds.Database.Transaction(false, func(tx db.Tx) error {
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
 		ser := ds.GenreService
 		g, err = ser.GetByID(obj.GenreID, tx)
 		if err != nil {
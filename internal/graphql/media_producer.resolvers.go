@@ -22,7 +22,7 @@ func (r *mediaProducerResolver) Producer(ctx context.Context, obj *models.MediaP
 	}
 
 	var p *models.Producer
-	err = ds.Database.Transaction(false, func(tx db.Tx) error {
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
 		ser := ds.ProducerService
 		p, err = ser.GetByID(obj.ProducerID, tx)
 		if err != nil {
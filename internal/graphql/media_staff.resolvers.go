@@ -0,0 +1,40 @@
+package graphql
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+func (r *mediaStaffResolver) Media(ctx context.Context, obj *models.MediaStaff) (*models.Media, error) {
+	return resolveMediaByID(ctx, obj.MediaID)
+}
+
+func (r *mediaStaffResolver) Person(ctx context.Context, obj *models.MediaStaff) (*models.Person, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	var p *models.Person
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		ser := ds.PersonService
+		p, err = ser.GetByID(obj.PersonID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get Person by id %d: %w", obj.PersonID, err)
+		}
+		return nil
+	})
+
+	return p, err
+}
+
+// MediaStaff returns MediaStaffResolver implementation.
+func (r *Resolver) MediaStaff() MediaStaffResolver { return &mediaStaffResolver{r} }
+
+type mediaStaffResolver struct{ *Resolver }
@@ -0,0 +1,114 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// PersistedQueryCache is the store of the automatic persisted queries sent by
+// clients, backed by the PersistedQuery bucket so that their hashes remain
+// valid across restarts and instances.
+type PersistedQueryCache struct {
+	DataService *DataService
+}
+
+var _ graphql.Cache = PersistedQueryCache{}
+
+// Get returns the query document persisted with the given hash.
+func (c PersistedQueryCache) Get(_ context.Context, hash string) (interface{}, bool) {
+	ds := c.DataService
+	var pq *models.PersistedQuery
+	err := ds.Database.Transaction(false, func(tx db.Tx) error {
+		var err error
+		pq, err = ds.PersistedQueryService.GetByHash(hash, tx)
+		return err
+	})
+	if err != nil {
+		return nil, false
+	}
+	return pq.Query, true
+}
+
+// Add persists the given query document. The hash has already been checked
+// against it, and is recomputed by the data layer.
+func (c PersistedQueryCache) Add(_ context.Context, _ string, query interface{}) {
+	q, ok := query.(string)
+	if !ok {
+		return
+	}
+
+	// A query that fails to persist is sent in full again by the client
+	ds := c.DataService
+	_ = ds.Database.Transaction(true, func(tx db.Tx) error {
+		_, err := ds.PersistedQueryService.Store(q, false, tx)
+		return err
+	})
+}
+
+// errcodePersistedQueryNotAllowed is the error code of operations refused by
+// PersistedQueryAllowlist.
+const errcodePersistedQueryNotAllowed = "PERSISTED_QUERY_NOT_ALLOWED"
+
+// PersistedQueryAllowlist is a handler extension that refuses operations other
+// than the persisted queries registered by Admins, for callers other than
+// Admins. It must be used before the AutomaticPersistedQuery extension, so
+// that unregistered queries are not persisted.
+type PersistedQueryAllowlist struct {
+	DataService *DataService
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationParameterMutator
+} = PersistedQueryAllowlist{}
+
+// ExtensionName returns the name of the extension.
+func (PersistedQueryAllowlist) ExtensionName() string {
+	return "PersistedQueryAllowlist"
+}
+
+// Validate checks that the extension can be used with the given schema.
+func (a PersistedQueryAllowlist) Validate(_ graphql.ExecutableSchema) error {
+	if a.DataService == nil {
+		return errors.New("PersistedQueryAllowlist.DataService must not be nil")
+	}
+	return nil
+}
+
+// MutateOperationParameters refuses the operation if its query, sent in full
+// or by hash, is not registered, unless the caller is an Admin.
+func (a PersistedQueryAllowlist) MutateOperationParameters(
+	ctx context.Context, params *graphql.RawParams,
+) *gqlerror.Error {
+	if getCtxRole(ctx).Includes(models.RoleAdmin) {
+		return nil
+	}
+
+	hash := ""
+	if params.Query != "" {
+		hash = data.HashQuery(params.Query)
+	} else if ext, ok := params.Extensions["persistedQuery"].(map[string]interface{}); ok {
+		hash, _ = ext["sha256Hash"].(string)
+	}
+
+	ds := a.DataService
+	var pq *models.PersistedQuery
+	err := ds.Database.Transaction(false, func(tx db.Tx) error {
+		var err error
+		pq, err = ds.PersistedQueryService.GetByHash(hash, tx)
+		return err
+	})
+	if err != nil || !pq.Registered {
+		gqlerr := gqlerror.Errorf("query is not registered")
+		errcode.Set(gqlerr, errcodePersistedQueryNotAllowed)
+		return gqlerr
+	}
+	return nil
+}
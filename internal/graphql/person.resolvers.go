@@ -11,32 +11,133 @@ import (
 	"github.com/Dophin2009/nao/pkg/models"
 )
 
+func (r *personResolver) ID(ctx context.Context, obj *models.Person) (int, error) {
+	return obj.Meta.ID, nil
+}
+
 func (r *personResolver) Names(ctx context.Context, obj *models.Person, first *int, skip *int) ([]*models.Title, error) {
-	return sliceTitles(obj.Names, first, skip), nil
+	return sliceTitles(localizeTitles(ctx, obj.Names), first, skip), nil
 }
 
 func (r *personResolver) Information(ctx context.Context, obj *models.Person, first *int, skip *int) ([]*models.Title, error) {
-	return sliceTitles(obj.Information, first, skip), nil
+	return sliceTitles(localizeTitles(ctx, obj.Information), first, skip), nil
 }
 
-func (r *personResolver) Media(ctx context.Context, obj *models.Person, first *int, skip *int) ([]*models.MediaCharacter, error) {
+func (r *personResolver) Media(ctx context.Context, obj *models.Person, first *int, after *string, last *int, before *string) (*MediaCharacterConnection, error) {
 	ds, err := getCtxDataService(ctx)
 	if err != nil {
 		return nil, errorGetDataServices(err)
 	}
 
 	var list []*models.MediaCharacter
-	err = ds.Database.Transaction(false, func(tx db.Tx) error {
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
 		ser := ds.MediaCharacterService
-		list, err = ser.GetByPerson(obj.Meta.ID, first, skip, tx)
+		list, err = ser.GetByPerson(obj.Meta.ID, nil, nil, tx)
 		if err != nil {
 			return fmt.Errorf(
 				"failed to get MediaCharacters by Person id %d: %w", obj.Meta.ID, err)
 		}
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, info, err := paginate(len(list), func(i int) int {
+		return list[i].Meta.ID
+	}, first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
 
-	return list, nil
+	conn := MediaCharacterConnection{
+		Edges:      make([]*MediaCharacterEdge, 0, end-start),
+		Nodes:      list[start:end],
+		PageInfo:   info,
+		TotalCount: len(list),
+	}
+	for _, mc := range conn.Nodes {
+		conn.Edges = append(conn.Edges, &MediaCharacterEdge{Cursor: db.EncodeCursor(mc.Meta.ID), Node: mc})
+	}
+	return &conn, nil
+}
+
+func (r *personResolver) Producers(ctx context.Context, obj *models.Person, first *int, after *string, last *int, before *string) (*ProducerStaffConnection, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	var list []*models.ProducerStaff
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		ser := ds.ProducerStaffService
+		list, err = ser.GetByPerson(obj.Meta.ID, nil, nil, tx)
+		if err != nil {
+			return fmt.Errorf(
+				"failed to get ProducerStaff by Person id %d: %w", obj.Meta.ID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, info, err := paginate(len(list), func(i int) int {
+		return list[i].Meta.ID
+	}, first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := ProducerStaffConnection{
+		Edges:      make([]*ProducerStaffEdge, 0, end-start),
+		Nodes:      list[start:end],
+		PageInfo:   info,
+		TotalCount: len(list),
+	}
+	for _, ps := range conn.Nodes {
+		conn.Edges = append(conn.Edges, &ProducerStaffEdge{Cursor: db.EncodeCursor(ps.Meta.ID), Node: ps})
+	}
+	return &conn, nil
+}
+
+func (r *personResolver) Credits(ctx context.Context, obj *models.Person, first *int, after *string, last *int, before *string) (*MediaStaffConnection, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	var list []*models.MediaStaff
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		ser := ds.MediaStaffService
+		list, err = ser.GetByPerson(obj.Meta.ID, nil, nil, tx)
+		if err != nil {
+			return fmt.Errorf(
+				"failed to get MediaStaff by Person id %d: %w", obj.Meta.ID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, info, err := paginate(len(list), func(i int) int {
+		return list[i].Meta.ID
+	}, first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := MediaStaffConnection{
+		Edges:      make([]*MediaStaffEdge, 0, end-start),
+		Nodes:      list[start:end],
+		PageInfo:   info,
+		TotalCount: len(list),
+	}
+	for _, ms := range conn.Nodes {
+		conn.Edges = append(conn.Edges, &MediaStaffEdge{Cursor: db.EncodeCursor(ms.Meta.ID), Node: ms})
+	}
+	return &conn, nil
 }
 
 // Person returns PersonResolver implementation.
@@ -12,27 +12,85 @@ import (
 )
 
 func (r *producerResolver) Titles(ctx context.Context, obj *models.Producer, first *int, skip *int) ([]*models.Title, error) {
-	return sliceTitles(obj.Titles, first, skip), nil
+	return sliceTitles(localizeTitles(ctx, obj.Titles), first, skip), nil
 }
 
-func (r *producerResolver) Media(ctx context.Context, obj *models.Producer, first *int, skip *int) ([]*models.MediaProducer, error) {
+func (r *producerResolver) Media(ctx context.Context, obj *models.Producer, first *int, after *string, last *int, before *string) (*MediaProducerConnection, error) {
 	ds, err := getCtxDataService(ctx)
 	if err != nil {
 		return nil, errorGetDataServices(err)
 	}
 
 	var list []*models.MediaProducer
-	err = ds.Database.Transaction(false, func(tx db.Tx) error {
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
 		ser := ds.MediaProducerService
-		list, err = ser.GetByProducer(obj.Meta.ID, first, skip, tx)
+		list, err = ser.GetByProducer(obj.Meta.ID, nil, nil, tx)
 		if err != nil {
 			return fmt.Errorf(
 				"failed to get MediaProducers by Producer id %d: %w", obj.Meta.ID, err)
 		}
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, info, err := paginate(len(list), func(i int) int {
+		return list[i].Meta.ID
+	}, first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := MediaProducerConnection{
+		Edges:      make([]*MediaProducerEdge, 0, end-start),
+		Nodes:      list[start:end],
+		PageInfo:   info,
+		TotalCount: len(list),
+	}
+	for _, mp := range conn.Nodes {
+		conn.Edges = append(conn.Edges, &MediaProducerEdge{Cursor: db.EncodeCursor(mp.Meta.ID), Node: mp})
+	}
+	return &conn, nil
+}
+
+func (r *producerResolver) Staff(ctx context.Context, obj *models.Producer, first *int, after *string, last *int, before *string) (*ProducerStaffConnection, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
 
-	return list, nil
+	var list []*models.ProducerStaff
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		ser := ds.ProducerStaffService
+		list, err = ser.GetByProducer(obj.Meta.ID, nil, nil, tx)
+		if err != nil {
+			return fmt.Errorf(
+				"failed to get ProducerStaff by Producer id %d: %w", obj.Meta.ID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, info, err := paginate(len(list), func(i int) int {
+		return list[i].Meta.ID
+	}, first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := ProducerStaffConnection{
+		Edges:      make([]*ProducerStaffEdge, 0, end-start),
+		Nodes:      list[start:end],
+		PageInfo:   info,
+		TotalCount: len(list),
+	}
+	for _, ps := range conn.Nodes {
+		conn.Edges = append(conn.Edges, &ProducerStaffEdge{Cursor: db.EncodeCursor(ps.Meta.ID), Node: ps})
+	}
+	return &conn, nil
 }
 
 // Producer returns ProducerResolver implementation.
@@ -0,0 +1,55 @@
+package graphql
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+func (r *producerStaffResolver) Producer(ctx context.Context, obj *models.ProducerStaff) (*models.Producer, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	var p *models.Producer
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		ser := ds.ProducerService
+		p, err = ser.GetByID(obj.ProducerID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get Producer by id %d: %w", obj.ProducerID, err)
+		}
+		return nil
+	})
+
+	return p, err
+}
+
+func (r *producerStaffResolver) Person(ctx context.Context, obj *models.ProducerStaff) (*models.Person, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	var p *models.Person
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		ser := ds.PersonService
+		p, err = ser.GetByID(obj.PersonID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get Person by id %d: %w", obj.PersonID, err)
+		}
+		return nil
+	})
+
+	return p, err
+}
+
+// ProducerStaff returns ProducerStaffResolver implementation.
+func (r *Resolver) ProducerStaff() ProducerStaffResolver { return &producerStaffResolver{r} }
+
+type producerStaffResolver struct{ *Resolver }
@@ -22,7 +22,7 @@ func resolveMediaByID(ctx context.Context, mID int) (*models.Media, error) {
 	}
 
 	var md *models.Media
-	err = ds.Database.Transaction(false, func(tx db.Tx) error {
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
 		ser := ds.MediaService
 		md, err = ser.GetByID(mID, tx)
 		if err != nil {
@@ -47,6 +47,17 @@ func sliceTitles(
 	return tlist
 }
 
+// LanguagesKey is the context key value for the language ranges the caller
+// accepts, as returned by models.ParseAcceptLanguage.
+const LanguagesKey = "LanguagesKey"
+
+// localizeTitles returns the given set of Titles ordered for the languages
+// accepted by the caller.
+func localizeTitles(ctx context.Context, titles []models.Title) []models.Title {
+	langs, _ := ctx.Value(LanguagesKey).([]string)
+	return models.LocalizeTitles(titles, langs)
+}
+
 func calculatePaginationBounds(first *int, skip *int, size int) (int, int) {
 	if size <= 0 {
 		return 0, 0
@@ -90,11 +101,43 @@ type DataService struct {
 	MediaGenreService     *data.MediaGenreService
 	MediaProducerService  *data.MediaProducerService
 	MediaRelationSerivce  *data.MediaRelationService
+	MediaStaffService     *data.MediaStaffService
+	MediaAliasService     *data.MediaAliasService
 	PersonService         *data.PersonService
 	ProducerService       *data.ProducerService
+	ProducerStaffService  *data.ProducerStaffService
 	UserService           *data.UserService
 	UserMediaService      *data.UserMediaService
 	UserMediaListService  *data.UserMediaListService
+	UserEpisodeService    *data.UserEpisodeService
+	UserFollowService     *data.UserFollowService
+	ReviewService         *data.ReviewService
+	CommentService        *data.CommentService
+	ModerationService     *data.ModerationService
+	WatchSessionService   *data.WatchSessionService
+	NotificationService   *data.NotificationService
+	PasswordResetService  *data.PasswordResetService
+	LoginSessionService   *data.LoginSessionService
+	IdentityService       *data.IdentityService
+	APIKeyService         *data.APIKeyService
+	MediaSeasonService    *data.MediaSeasonService
+	EpisodeAiringService  *data.EpisodeAiringService
+	MediaOrderService     *data.MediaOrderService
+	MediaBundleService    *data.MediaBundleService
+	LockService           *data.LockService
+	ProposalService       *data.ProposalService
+	SlugService           *data.SlugService
+	NameService           *data.NameService
+	TrendingService       *data.TrendingService
+	StatsService          *data.StatsService
+	ChangeService         *data.ChangeService
+	SyncService           *data.SyncService
+	ActivityService       *data.ActivityService
+	PersistedQueryService *data.PersistedQueryService
+	ImportRowService      *data.ImportRowService
+	// Lifecycle calls the hooks registered on the lifecycle events of the
+	// entities of all the services.
+	Lifecycle *db.Lifecycle
 }
 
 // DataServiceKey is the context key value for DataServices.
@@ -1,6 +1,7 @@
 package graphql
 
 import (
+	"context"
 	"testing"
 
 	"github.com/Dophin2009/nao/pkg/models"
@@ -101,3 +102,36 @@ func TestCalculatePaginationBounds(t *testing.T) {
 		})
 	}
 }
+
+// TestLocalizeTitles tests that localizeTitles orders Titles for the languages
+// accepted by the caller.
+func TestLocalizeTitles(t *testing.T) {
+	ja := models.Title{String: "カウボーイビバップ", Language: "ja"}
+	romaji := models.Title{String: "Kaubōi Bebappu", Language: "ja-Latn", Preferred: true}
+	en := models.Title{String: "Cowboy Bebop", Language: "en"}
+	enUS := models.Title{String: "Cowboy Bebop (US)", Language: "en-US",
+		Priority: models.TitlePrioritySecondary}
+	set := []models.Title{ja, romaji, enUS, en}
+
+	cases := []struct {
+		header string
+		first  string
+	}{
+		{"", romaji.String},
+		{"en-GB, ja;q=0.5", en.String},
+		{"en-US", enUS.String},
+		{"fr, ja;q=0.9, en;q=0.8", romaji.String},
+		{"ja;q=0, en", en.String},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.header, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), LanguagesKey,
+				models.ParseAcceptLanguage(tc.header))
+			res := localizeTitles(ctx, set)
+			if len(res) != len(set) || res[0].String != tc.first {
+				t.Errorf("expected %q first, got %v", tc.first, res)
+			}
+		})
+	}
+}
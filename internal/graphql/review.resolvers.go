@@ -0,0 +1,99 @@
+package graphql
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+func (r *commentResolver) Replies(ctx context.Context, obj *models.Comment, first *int, after *string, last *int, before *string) (*CommentConnection, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	var list []*models.Comment
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		ser := ds.CommentService
+		list, err = ser.GetByReviewAs(getCtxUser(ctx), obj.ReviewID, &obj.Meta.ID, nil, nil, nil, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get replies to Comment with id %d: %w",
+				obj.Meta.ID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, info, err := paginate(len(list), func(i int) int {
+		return list[i].Meta.ID
+	}, first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := CommentConnection{
+		Edges:      make([]*CommentEdge, 0, end-start),
+		Nodes:      list[start:end],
+		PageInfo:   info,
+		TotalCount: len(list),
+	}
+	for _, c := range conn.Nodes {
+		conn.Edges = append(conn.Edges, &CommentEdge{Cursor: db.EncodeCursor(c.Meta.ID), Node: c})
+	}
+	return &conn, nil
+}
+
+func (r *reviewResolver) Comments(ctx context.Context, obj *models.Review, first *int, after *string, last *int, before *string) (*CommentConnection, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	var list []*models.Comment
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		ser := ds.CommentService
+		list, err = ser.GetByReviewAs(getCtxUser(ctx), obj.Meta.ID, nil, nil, nil, nil, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get Comments by Review id %d: %w",
+				obj.Meta.ID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, info, err := paginate(len(list), func(i int) int {
+		return list[i].Meta.ID
+	}, first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := CommentConnection{
+		Edges:      make([]*CommentEdge, 0, end-start),
+		Nodes:      list[start:end],
+		PageInfo:   info,
+		TotalCount: len(list),
+	}
+	for _, c := range conn.Nodes {
+		conn.Edges = append(conn.Edges, &CommentEdge{Cursor: db.EncodeCursor(c.Meta.ID), Node: c})
+	}
+	return &conn, nil
+}
+
+// Comment returns CommentResolver implementation.
+func (r *Resolver) Comment() CommentResolver { return &commentResolver{r} }
+
+// Review returns ReviewResolver implementation.
+func (r *Resolver) Review() ReviewResolver { return &reviewResolver{r} }
+
+type commentResolver struct{ *Resolver }
+type reviewResolver struct{ *Resolver }
@@ -0,0 +1,286 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/introspection"
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// RoleKey is the context key value for the Role of the caller.
+const RoleKey = "RoleKey"
+
+// directiveHasRole is the name of the directive that restricts fields and
+// types to callers with some minimum Role.
+const directiveHasRole = "hasRole"
+
+// UserKey is the context key value for the authenticated User of the caller,
+// which is nil for anonymous callers. Resolvers of User-owned resources pass
+// it to the ownership checks of the data layer, such as
+// data.UserMediaService.UpdateAs.
+const UserKey = "UserKey"
+
+func getCtxUser(ctx context.Context) *models.User {
+	v, _ := ctx.Value(UserKey).(*models.User)
+	return v
+}
+
+func getCtxRole(ctx context.Context) models.Role {
+	v, ok := ctx.Value(RoleKey).(models.Role)
+	if !ok {
+		return models.RoleAnonymous
+	}
+	return v
+}
+
+// HasRole implements the @hasRole directive, refusing to resolve the field
+// for callers without the given Role.
+func HasRole(
+	ctx context.Context, _ interface{}, next graphql.Resolver, role models.Role,
+) (interface{}, error) {
+	caller := getCtxRole(ctx)
+	if !caller.Includes(role) {
+		return nil, fmt.Errorf("role %s: insufficient permissions: %w",
+			caller, data.ErrUnauthorized)
+	}
+	return next(ctx)
+}
+
+// RoleVisibility contains the minimum Roles required to see the types and
+// fields of a schema, as declared with the @hasRole directive.
+type RoleVisibility struct {
+	types  map[string]models.Role
+	fields map[string]map[string]models.Role
+}
+
+// NewRoleVisibility reads the Role requirements declared in the given schema.
+func NewRoleVisibility(schema *ast.Schema) (*RoleVisibility, error) {
+	vis := RoleVisibility{
+		types:  map[string]models.Role{},
+		fields: map[string]map[string]models.Role{},
+	}
+
+	for name, def := range schema.Types {
+		role, ok, err := requiredRole(def.Directives)
+		if err != nil {
+			return nil, fmt.Errorf("type %q: %w", name, err)
+		}
+		if ok {
+			vis.types[name] = role
+		}
+
+		for _, f := range def.Fields {
+			role, ok, err := requiredRole(f.Directives)
+			if err != nil {
+				return nil, fmt.Errorf("field %q of type %q: %w", f.Name, name, err)
+			}
+			if !ok {
+				continue
+			}
+
+			if vis.fields[name] == nil {
+				vis.fields[name] = map[string]models.Role{}
+			}
+			vis.fields[name][f.Name] = role
+		}
+	}
+
+	return &vis, nil
+}
+
+func requiredRole(directives ast.DirectiveList) (models.Role, bool, error) {
+	d := directives.ForName(directiveHasRole)
+	if d == nil {
+		return models.RoleAnonymous, false, nil
+	}
+
+	arg := d.Arguments.ForName("role")
+	if arg == nil || arg.Value == nil {
+		return models.RoleAnonymous, false,
+			fmt.Errorf("directive @%s: missing role", directiveHasRole)
+	}
+
+	var role models.Role
+	err := role.UnmarshalGQL(arg.Value.Raw)
+	if err != nil {
+		return models.RoleAnonymous, false,
+			fmt.Errorf("directive @%s: %w", directiveHasRole, err)
+	}
+	return role, true, nil
+}
+
+// TypeVisible returns true if the type is visible to the given Role.
+func (vis *RoleVisibility) TypeVisible(typeName string, role models.Role) bool {
+	req, ok := vis.types[typeName]
+	return !ok || role.Includes(req)
+}
+
+// FieldVisible returns true if the field of the type is visible to the given
+// Role.
+func (vis *RoleVisibility) FieldVisible(
+	typeName string, fieldName string, role models.Role,
+) bool {
+	req, ok := vis.fields[typeName][fieldName]
+	return !ok || role.Includes(req)
+}
+
+// Prune returns a copy of the given schema without the types and fields
+// hidden from the given Role.
+func (vis *RoleVisibility) Prune(schema *ast.Schema, role models.Role) *ast.Schema {
+	pruned := *schema
+	pruned.Types = make(map[string]*ast.Definition, len(schema.Types))
+
+	for name, def := range schema.Types {
+		if !vis.TypeVisible(name, role) {
+			continue
+		}
+
+		d := *def
+		d.Fields = ast.FieldList{}
+		for _, f := range def.Fields {
+			if vis.FieldVisible(name, f.Name, role) {
+				d.Fields = append(d.Fields, f)
+			}
+		}
+		pruned.Types[name] = &d
+	}
+
+	if schema.Query != nil {
+		pruned.Query = pruned.Types[schema.Query.Name]
+	}
+	if schema.Mutation != nil {
+		pruned.Mutation = pruned.Types[schema.Mutation.Name]
+	}
+	if schema.Subscription != nil {
+		pruned.Subscription = pruned.Types[schema.Subscription.Name]
+	}
+
+	return &pruned
+}
+
+// RoleSchema is the effective schema of some Role; queries are validated
+// against the schema without the types and fields hidden from the Role.
+type RoleSchema struct {
+	graphql.ExecutableSchema
+	Role   models.Role
+	schema *ast.Schema
+}
+
+// NewRoleSchema returns the effective schema of the given executable schema
+// for the given Role.
+func NewRoleSchema(
+	es graphql.ExecutableSchema, vis *RoleVisibility, role models.Role,
+) *RoleSchema {
+	return &RoleSchema{
+		ExecutableSchema: es,
+		Role:             role,
+		schema:           vis.Prune(es.Schema(), role),
+	}
+}
+
+// Schema returns the pruned schema of the Role.
+func (rs *RoleSchema) Schema() *ast.Schema {
+	return rs.schema
+}
+
+// RoleIntrospection is a handler extension that hides the types and fields
+// not visible to the caller's Role from introspection queries.
+type RoleIntrospection struct {
+	Visibility *RoleVisibility
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.FieldInterceptor
+} = RoleIntrospection{}
+
+// ExtensionName returns the name of the extension.
+func (RoleIntrospection) ExtensionName() string {
+	return "RoleIntrospection"
+}
+
+// Validate checks that the extension can be used with the given schema.
+func (RoleIntrospection) Validate(_ graphql.ExecutableSchema) error {
+	return nil
+}
+
+// InterceptField filters the results of the introspection type and field
+// lists.
+func (ri RoleIntrospection) InterceptField(
+	ctx context.Context, next graphql.Resolver,
+) (interface{}, error) {
+	res, err := next(ctx)
+	if err != nil {
+		return res, err
+	}
+
+	fc := graphql.GetFieldContext(ctx)
+	if fc == nil || fc.Field.Field == nil {
+		return res, nil
+	}
+	role := getCtxRole(ctx)
+
+	switch fc.Object + "." + fc.Field.Name {
+	case "__Schema.types":
+		types, ok := res.([]introspection.Type)
+		if !ok {
+			return res, nil
+		}
+
+		visible := []introspection.Type{}
+		for _, t := range types {
+			name := t.Name()
+			if name == nil || ri.Visibility.TypeVisible(*name, role) {
+				visible = append(visible, t)
+			}
+		}
+		return visible, nil
+	case "__Type.fields":
+		fields, ok := res.([]introspection.Field)
+		if !ok {
+			return res, nil
+		}
+
+		typeName, ok := parentTypeName(fc)
+		if !ok {
+			return res, nil
+		}
+
+		visible := []introspection.Field{}
+		for _, f := range fields {
+			if ri.Visibility.FieldVisible(typeName, f.Name, role) {
+				visible = append(visible, f)
+			}
+		}
+		return visible, nil
+	}
+
+	return res, nil
+}
+
+// parentTypeName returns the name of the introspection type whose field is
+// being resolved in the given field context.
+func parentTypeName(fc *graphql.FieldContext) (string, bool) {
+	if fc.Parent == nil {
+		return "", false
+	}
+
+	var name *string
+	switch t := fc.Parent.Result.(type) {
+	case *introspection.Type:
+		if t != nil {
+			name = t.Name()
+		}
+	case introspection.Type:
+		name = t.Name()
+	}
+
+	if name == nil {
+		return "", false
+	}
+	return *name, true
+}
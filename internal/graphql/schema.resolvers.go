@@ -7,17 +7,19 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/Dophin2009/nao/internal/data"
 	"github.com/Dophin2009/nao/pkg/db"
 	"github.com/Dophin2009/nao/pkg/models"
 )
 
-func (r *mutationResolver) CreateMedia(ctx context.Context, media models.Media) (*models.Media, error) {
+func (r *mutationResolver) CreateMedia(ctx context.Context, media models.Media, dryRun *bool) (*models.Media, error) {
+	ctx = dryRunContext(ctx, dryRun)
 	ds, err := getCtxDataService(ctx)
 	if err != nil {
 		return nil, errorGetDataServices(err)
 	}
 
-	err = ds.Database.Transaction(true, func(tx db.Tx) error {
+	err = ds.Database.TransactionContext(ctx, true, func(tx db.Tx) error {
 		ser := ds.MediaService
 		_, err = ser.Create(&media, tx)
 		if err != nil {
@@ -32,6 +34,213 @@ func (r *mutationResolver) CreateMedia(ctx context.Context, media models.Media)
 	return &media, nil
 }
 
+func (r *mutationResolver) CreateReview(ctx context.Context, mediaID int, review models.Review, dryRun *bool) (*models.Review, error) {
+	ctx = dryRunContext(ctx, dryRun)
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	caller := getCtxUser(ctx)
+	if caller != nil {
+		review.UserID = caller.Meta.ID
+	}
+	review.MediaID = mediaID
+	err = ds.Database.TransactionContext(ctx, true, func(tx db.Tx) error {
+		ser := ds.ReviewService
+		_, err = ser.CreateAs(caller, &review, tx)
+		if err != nil {
+			return fmt.Errorf("failed to create Review of Media with id %d: %w", mediaID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &review, nil
+}
+
+func (r *mutationResolver) UpdateReview(ctx context.Context, id int, review models.Review, dryRun *bool) (*models.Review, error) {
+	ctx = dryRunContext(ctx, dryRun)
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	var rv *models.Review
+	err = ds.Database.TransactionContext(ctx, true, func(tx db.Tx) error {
+		ser := ds.ReviewService
+		rv, err = ser.GetByIDAs(getCtxUser(ctx), id, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get Review by id %d: %w", id, err)
+		}
+
+		rv.Body = review.Body
+		rv.Score = review.Score
+		rv.Spoiler = review.Spoiler
+		err = ser.UpdateAs(getCtxUser(ctx), rv, tx)
+		if err != nil {
+			return fmt.Errorf("failed to update Review with id %d: %w", id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rv, nil
+}
+
+func (r *mutationResolver) DeleteReview(ctx context.Context, id int) (bool, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return false, errorGetDataServices(err)
+	}
+
+	err = ds.Database.TransactionContext(ctx, true, func(tx db.Tx) error {
+		err := ds.ReviewService.DeleteAs(getCtxUser(ctx), id, tx)
+		if err != nil {
+			return fmt.Errorf("failed to delete Review with id %d: %w", id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) CreateComment(ctx context.Context, reviewID int, comment models.Comment, dryRun *bool) (*models.Comment, error) {
+	ctx = dryRunContext(ctx, dryRun)
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	caller := getCtxUser(ctx)
+	if caller != nil {
+		comment.UserID = caller.Meta.ID
+	}
+	comment.ReviewID = reviewID
+	err = ds.Database.TransactionContext(ctx, true, func(tx db.Tx) error {
+		ser := ds.CommentService
+		_, err = ser.CreateAs(caller, &comment, tx)
+		if err != nil {
+			return fmt.Errorf("failed to create Comment on Review with id %d: %w", reviewID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &comment, nil
+}
+
+func (r *mutationResolver) DeleteComment(ctx context.Context, id int) (bool, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return false, errorGetDataServices(err)
+	}
+
+	err = ds.Database.TransactionContext(ctx, true, func(tx db.Tx) error {
+		err := ds.CommentService.DeleteAs(getCtxUser(ctx), id, tx)
+		if err != nil {
+			return fmt.Errorf("failed to delete Comment with id %d: %w", id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) FlagReview(ctx context.Context, id int) (bool, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return false, errorGetDataServices(err)
+	}
+
+	err = ds.Database.TransactionContext(ctx, true, func(tx db.Tx) error {
+		err := ds.ReviewService.FlagAs(getCtxUser(ctx), id, tx)
+		if err != nil {
+			return fmt.Errorf("failed to flag Review with id %d: %w", id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) FlagComment(ctx context.Context, id int) (bool, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return false, errorGetDataServices(err)
+	}
+
+	err = ds.Database.TransactionContext(ctx, true, func(tx db.Tx) error {
+		err := ds.CommentService.FlagAs(getCtxUser(ctx), id, tx)
+		if err != nil {
+			return fmt.Errorf("failed to flag Comment with id %d: %w", id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) SetReviewHidden(ctx context.Context, id int, hidden bool) (*models.Review, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	var rv *models.Review
+	err = ds.Database.TransactionContext(ctx, true, func(tx db.Tx) error {
+		rv, err = ds.ReviewService.SetHiddenAs(getCtxUser(ctx), id, hidden, tx)
+		if err != nil {
+			return fmt.Errorf("failed to moderate Review with id %d: %w", id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rv, nil
+}
+
+func (r *mutationResolver) SetCommentHidden(ctx context.Context, id int, hidden bool) (*models.Comment, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	var c *models.Comment
+	err = ds.Database.TransactionContext(ctx, true, func(tx db.Tx) error {
+		c, err = ds.CommentService.SetHiddenAs(getCtxUser(ctx), id, hidden, tx)
+		if err != nil {
+			return fmt.Errorf("failed to moderate Comment with id %d: %w", id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
 func (r *queryResolver) MediaByID(ctx context.Context, id int) (*models.Media, error) {
 	ds, err := getCtxDataService(ctx)
 	if err != nil {
@@ -39,7 +248,7 @@ func (r *queryResolver) MediaByID(ctx context.Context, id int) (*models.Media, e
 	}
 
 	var md *models.Media
-	err = ds.Database.Transaction(false, func(tx db.Tx) error {
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
 		ser := ds.MediaService
 		md, err = ser.GetByID(id, tx)
 		if err != nil {
@@ -53,6 +262,260 @@ func (r *queryResolver) MediaByID(ctx context.Context, id int) (*models.Media, e
 	return md, nil
 }
 
+func (r *queryResolver) MediaByIDs(ctx context.Context, ids []int) ([]*models.Media, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	var list []*models.Media
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		list, err = ds.MediaService.GetByIDs(ids, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get Media by IDs: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *queryResolver) MediaBySlug(ctx context.Context, slug string) (*models.Media, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	var md *models.Media
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		md, err = ds.MediaService.GetBySlug(slug, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get Media by slug %q: %w", slug, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+func (r *queryResolver) PersonBySlug(ctx context.Context, slug string) (*models.Person, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	var p *models.Person
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		p, err = ds.PersonService.GetBySlug(slug, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get Person by slug %q: %w", slug, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (r *queryResolver) CharacterBySlug(ctx context.Context, slug string) (*models.Character, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	var c *models.Character
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		c, err = ds.CharacterService.GetBySlug(slug, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get Character by slug %q: %w", slug, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (r *queryResolver) ProducerBySlug(ctx context.Context, slug string) (*models.Producer, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	var p *models.Producer
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		p, err = ds.ProducerService.GetBySlug(slug, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get Producer by slug %q: %w", slug, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (r *queryResolver) SearchMedia(ctx context.Context, query string, first *int) ([]*models.Media, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	var list []*models.Media
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		list, err = ds.MediaService.Search(query, first, tx)
+		if err != nil {
+			return fmt.Errorf("failed to search Media by %q: %w", query, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *queryResolver) SearchPeople(ctx context.Context, query string, first *int) ([]*models.Person, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	var list []*models.Person
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		list, err = ds.PersonService.Search(query, first, tx)
+		if err != nil {
+			return fmt.Errorf("failed to search People by %q: %w", query, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *queryResolver) SearchCharacters(ctx context.Context, query string, first *int) ([]*models.Character, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	var list []*models.Character
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		list, err = ds.CharacterService.Search(query, first, tx)
+		if err != nil {
+			return fmt.Errorf("failed to search Characters by %q: %w", query, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *queryResolver) MediaBySeason(ctx context.Context, year int, quarter models.Quarter, sort models.MediaSort, releaseStatus []models.ReleaseStatus, filter *string, first *int, after *string, last *int, before *string) (*MediaConnection, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	expr := func(*models.Media) bool { return true }
+	if filter != nil {
+		expr, err = data.CompileMediaQuery(*filter)
+		if err != nil {
+			return nil, fmt.Errorf("filter: %w", err)
+		}
+	}
+
+	var list []*models.SeasonEntry
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		keep := func(md *models.Media) bool {
+			return md.HasReleaseStatus(releaseStatus...) && expr(md)
+		}
+		list, err = ds.MediaSeasonService.Chart(year, quarter, sort, keep, nil, nil, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get Media of %s %d: %w", quarter, year, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, info, err := paginate(len(list), func(i int) int {
+		return list[i].Media.Meta.ID
+	}, first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := MediaConnection{
+		Edges:      make([]*MediaEdge, 0, end-start),
+		Nodes:      make([]*models.Media, 0, end-start),
+		PageInfo:   info,
+		TotalCount: len(list),
+	}
+	for _, e := range list[start:end] {
+		conn.Edges = append(conn.Edges, &MediaEdge{Cursor: db.EncodeCursor(e.Media.Meta.ID), Node: e.Media})
+		conn.Nodes = append(conn.Nodes, e.Media)
+	}
+	return &conn, nil
+}
+
+func (r *queryResolver) Trending(ctx context.Context, limit *int) ([]*models.Trend, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	n := 0
+	if limit != nil {
+		n = *limit
+	}
+	var list []*models.Trend
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		list, _, err = ds.TrendingService.Get(n, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get trending Media: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *queryResolver) ReviewByID(ctx context.Context, id int) (*models.Review, error) {
+	ds, err := getCtxDataService(ctx)
+	if err != nil {
+		return nil, errorGetDataServices(err)
+	}
+
+	var rv *models.Review
+	err = ds.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		ser := ds.ReviewService
+		rv, err = ser.GetByIDAs(getCtxUser(ctx), id, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get Review by id %d: %w", id, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
 // Mutation returns MutationResolver implementation.
 func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
 
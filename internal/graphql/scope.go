@@ -0,0 +1,130 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// ScopeKey is the context key value for the APIKeyScope of the credentials of
+// the caller; callers without API keys have the Admin scope, and anonymous
+// callers of the read-only public API the Read scope.
+const ScopeKey = "ScopeKey"
+
+func getCtxScope(ctx context.Context) models.APIKeyScope {
+	v, ok := ctx.Value(ScopeKey).(models.APIKeyScope)
+	if !ok {
+		return models.APIKeyScopeAdmin
+	}
+	return v
+}
+
+// mutationType is the name of the root type of mutations.
+const mutationType = "Mutation"
+
+// ReadOnlyScope is a handler extension that refuses to resolve mutations for
+// callers of the Read scope.
+type ReadOnlyScope struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.FieldInterceptor
+} = ReadOnlyScope{}
+
+// ExtensionName returns the name of the extension.
+func (ReadOnlyScope) ExtensionName() string {
+	return "ReadOnlyScope"
+}
+
+// Validate checks that the extension can be used with the given schema.
+func (ReadOnlyScope) Validate(_ graphql.ExecutableSchema) error {
+	return nil
+}
+
+// InterceptField refuses to resolve the fields of mutations for callers
+// without the Write scope.
+func (ReadOnlyScope) InterceptField(
+	ctx context.Context, next graphql.Resolver,
+) (interface{}, error) {
+	fc := graphql.GetFieldContext(ctx)
+	if fc != nil && fc.Object == mutationType {
+		scope := getCtxScope(ctx)
+		if !scope.Includes(models.APIKeyScopeWrite) {
+			if getCtxUser(ctx) == nil {
+				return nil, fmt.Errorf("anonymous caller: read-only: %w",
+					data.ErrUnauthorized)
+			}
+			return nil, fmt.Errorf("API key of scope %s: read-only: %w",
+				scope, data.ErrUnauthorized)
+		}
+	}
+	return next(ctx)
+}
+
+// MaintenanceMode is a handler extension that refuses to resolve mutations
+// while the server is in maintenance mode.
+type MaintenanceMode struct {
+	Maintenance *web.Maintenance
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.FieldInterceptor
+} = MaintenanceMode{}
+
+// ExtensionName returns the name of the extension.
+func (MaintenanceMode) ExtensionName() string {
+	return "MaintenanceMode"
+}
+
+// Validate checks that the extension can be used with the given schema.
+func (MaintenanceMode) Validate(_ graphql.ExecutableSchema) error {
+	return nil
+}
+
+// InterceptField refuses to resolve the fields of mutations while the server
+// is in maintenance mode, unless they are dry runs.
+func (m MaintenanceMode) InterceptField(
+	ctx context.Context, next graphql.Resolver,
+) (interface{}, error) {
+	fc := graphql.GetFieldContext(ctx)
+	if fc != nil && fc.Object == mutationType && !isDryRun(fc.Args) {
+		err := m.Maintenance.Err()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return next(ctx)
+}
+
+// dryRunArg is the name of the argument of mutations that runs them without
+// persisting their writes.
+const dryRunArg = "dryRun"
+
+// isDryRun returns true if the given arguments of a mutation ask for a dry
+// run.
+func isDryRun(args map[string]interface{}) bool {
+	switch v := args[dryRunArg].(type) {
+	case bool:
+		return v
+	case *bool:
+		return v != nil && *v
+	}
+	return false
+}
+
+// dryRunContext returns a copy of the given context in which writable
+// transactions are rolled back, if dryRun is true, so that the mutation
+// responds with the entities it writes cleaned and validated but not
+// persisted.
+func dryRunContext(ctx context.Context, dryRun *bool) context.Context {
+	if dryRun == nil || !*dryRun {
+		return ctx
+	}
+	return db.WithDryRun(ctx)
+}
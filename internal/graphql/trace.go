@@ -0,0 +1,91 @@
+package graphql
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/Dophin2009/nao/internal/trace"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Tracing is a handler extension that serves the fields backed by resolver
+// methods in spans, so that slow resolvers show in traces. Fields of plain
+// struct members are not traced.
+type Tracing struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationInterceptor
+	graphql.FieldInterceptor
+} = Tracing{}
+
+// ExtensionName returns the name of the extension.
+func (Tracing) ExtensionName() string {
+	return "Tracing"
+}
+
+// Validate checks that the extension can be used with the given schema.
+func (Tracing) Validate(_ graphql.ExecutableSchema) error {
+	return nil
+}
+
+// InterceptOperation names the span of the request after the operation.
+func (Tracing) InterceptOperation(
+	ctx context.Context, next graphql.OperationHandler,
+) graphql.ResponseHandler {
+	span := trace.FromContext(ctx)
+	if oc := graphql.GetOperationContext(ctx); span.IsRecording() && oc != nil {
+		if oc.OperationName != "" {
+			span.SetAttributes(attribute.String("graphql.operation.name", oc.OperationName))
+		}
+		if oc.Operation != nil {
+			span.SetAttributes(attribute.String("graphql.operation.type",
+				string(oc.Operation.Operation)))
+		}
+	}
+	return next(ctx)
+}
+
+// InterceptField serves fields backed by resolver methods in a child span of
+// the current span.
+func (Tracing) InterceptField(
+	ctx context.Context, next graphql.Resolver,
+) (interface{}, error) {
+	fc := graphql.GetFieldContext(ctx)
+	if fc == nil || !fc.IsMethod || fc.Field.Field == nil {
+		return next(ctx)
+	}
+
+	ctx, span := trace.StartSpan(ctx, fc.Object+"."+fc.Field.Name)
+	if !span.IsRecording() {
+		return next(ctx)
+	}
+	span.SetAttributes(attribute.String("graphql.field.path", fieldPath(fc)))
+	res, err := next(ctx)
+	trace.Finish(span, err)
+	return res, err
+}
+
+// fieldPath returns the path of the field of the given context, such as
+// media.0.titles.
+func fieldPath(fc *graphql.FieldContext) string {
+	path := ""
+	for ; fc != nil; fc = fc.Parent {
+		var seg string
+		switch {
+		case fc.Index != nil:
+			seg = strconv.Itoa(*fc.Index)
+		case fc.Field.Field != nil:
+			seg = fc.Field.Alias
+		default:
+			continue
+		}
+		if path == "" {
+			path = seg
+		} else {
+			path = seg + "." + path
+		}
+	}
+	return path
+}
@@ -0,0 +1,19 @@
+package graphql
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+
+import (
+	"context"
+
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+func (r *trendResolver) Media(ctx context.Context, obj *models.Trend) (*models.Media, error) {
+	return resolveMediaByID(ctx, obj.MediaID)
+}
+
+// Trend returns TrendResolver implementation.
+func (r *Resolver) Trend() TrendResolver { return &trendResolver{r} }
+
+type trendResolver struct{ *Resolver }
@@ -0,0 +1,28 @@
+package graphql
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+
+import (
+	"context"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+func (r *userResolver) ID(ctx context.Context, obj *models.User) (int, error) {
+	return obj.Meta.ID, nil
+}
+
+func (r *userResolver) Email(ctx context.Context, obj *models.User) (string, error) {
+	err := data.AuthorizeOwner(getCtxUser(ctx), obj.Meta.ID)
+	if err != nil {
+		return "", err
+	}
+	return obj.Email, nil
+}
+
+// User returns UserResolver implementation.
+func (r *Resolver) User() UserResolver { return &userResolver{r} }
+
+type userResolver struct{ *Resolver }
@@ -0,0 +1,270 @@
+// Package jobs tracks the progress of long-running jobs, such as backups and
+// integrity checks, and pushes it to subscribers as it changes.
+package jobs
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultRetain is the number of finished Jobs kept by a Manager if not
+// configured.
+const DefaultRetain = 20
+
+// Kinds of Jobs run by the server.
+const (
+	KindBackup    = "backup"
+	KindSnapshot  = "snapshot"
+	KindIntegrity = "integrity"
+	KindImport    = "import"
+	KindRefresh   = "refresh"
+)
+
+// State is the state of a Job.
+type State string
+
+const (
+	// StateRunning means the Job has not finished yet.
+	StateRunning State = "Running"
+	// StateSucceeded means the Job finished without error.
+	StateSucceeded State = "Succeeded"
+	// StateFailed means the Job finished with an error.
+	StateFailed State = "Failed"
+)
+
+// Job is a snapshot of the progress of a long-running job.
+type Job struct {
+	ID    int    `json:"id"`
+	Kind  string `json:"kind"`
+	State State  `json:"state"`
+	// Done is the number of units of work done, and Total is the number of
+	// units of the Job, or 0 if unknown.
+	Done       int64      `json:"done"`
+	Total      int64      `json:"total"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt"`
+}
+
+// Manager tracks the Jobs of the server. It is safe for concurrent use.
+type Manager struct {
+	// Retain is the number of most recent finished Jobs kept.
+	Retain int
+
+	mu     sync.Mutex
+	nextID int
+	jobs   []*Job
+	subs   map[*Subscription]bool
+}
+
+// NewManager returns a Manager that keeps the given number of finished Jobs.
+func NewManager(retain int) *Manager {
+	if retain <= 0 {
+		retain = DefaultRetain
+	}
+	return &Manager{
+		Retain: retain,
+		nextID: 1,
+		subs:   map[*Subscription]bool{},
+	}
+}
+
+// Start begins tracking a new Job of the given kind and returns the Task
+// through which its progress is reported.
+func (m *Manager) Start(kind string) *Task {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j := Job{
+		ID:        m.nextID,
+		Kind:      kind,
+		State:     StateRunning,
+		StartedAt: time.Now(),
+	}
+	m.nextID++
+	m.jobs = append(m.jobs, &j)
+	m.prune()
+	m.publish(&j)
+
+	return &Task{m: m, id: j.ID}
+}
+
+// Jobs returns the running and recently finished Jobs, oldest first.
+func (m *Manager) Jobs() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := make([]Job, len(m.jobs))
+	for i, j := range m.jobs {
+		list[i] = *j
+	}
+	return list
+}
+
+// Subscribe returns a Subscription to the changes of the Jobs. It must be
+// closed when no longer used.
+func (m *Manager) Subscribe() *Subscription {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := &Subscription{
+		m:       m,
+		notify:  make(chan struct{}, 1),
+		pending: map[int]Job{},
+	}
+	m.subs[s] = true
+	return s
+}
+
+// update applies the given change to the Job with the given ID, if it is
+// still tracked, and publishes the result.
+func (m *Manager) update(id int, change func(j *Job)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, j := range m.jobs {
+		if j.ID == id {
+			if j.State != StateRunning {
+				return
+			}
+			change(j)
+			m.publish(j)
+			return
+		}
+	}
+}
+
+// publish queues the given Job state for every subscriber.
+func (m *Manager) publish(j *Job) {
+	for s := range m.subs {
+		s.push(*j)
+	}
+}
+
+// prune removes the oldest finished Jobs beyond the retention count.
+func (m *Manager) prune() {
+	finished := 0
+	for _, j := range m.jobs {
+		if j.State != StateRunning {
+			finished++
+		}
+	}
+
+	kept := m.jobs[:0]
+	for _, j := range m.jobs {
+		if j.State != StateRunning && finished > m.Retain {
+			finished--
+			continue
+		}
+		kept = append(kept, j)
+	}
+	m.jobs = kept
+}
+
+// Task reports the progress of a single Job. The methods of a nil Task do
+// nothing, so that jobs may run untracked.
+type Task struct {
+	m  *Manager
+	id int
+}
+
+// ID returns the ID of the Job.
+func (t *Task) ID() int {
+	if t == nil {
+		return 0
+	}
+	return t.id
+}
+
+// SetTotal sets the total number of units of work of the Job.
+func (t *Task) SetTotal(n int64) {
+	if t == nil {
+		return
+	}
+	t.m.update(t.id, func(j *Job) {
+		j.Total = n
+	})
+}
+
+// Advance adds the given number of units to those done.
+func (t *Task) Advance(n int64) {
+	if t == nil {
+		return
+	}
+	t.m.update(t.id, func(j *Job) {
+		j.Done += n
+	})
+}
+
+// Finish marks the Job as finished, failed if err is not nil. Later reports
+// are ignored.
+func (t *Task) Finish(err error) {
+	if t == nil {
+		return
+	}
+	t.m.update(t.id, func(j *Job) {
+		now := time.Now()
+		j.FinishedAt = &now
+		j.State = StateSucceeded
+		if err != nil {
+			j.State = StateFailed
+			j.Error = err.Error()
+		}
+	})
+
+	t.m.mu.Lock()
+	defer t.m.mu.Unlock()
+	t.m.prune()
+}
+
+// Subscription receives the changes of the Jobs of a Manager. Changes to the
+// same Job that have not yet been received are coalesced into the latest, so
+// slow subscribers never block jobs nor miss their final states.
+type Subscription struct {
+	m       *Manager
+	notify  chan struct{}
+	mu      sync.Mutex
+	pending map[int]Job
+}
+
+// C returns a channel that receives a value when changes are pending.
+func (s *Subscription) C() <-chan struct{} {
+	return s.notify
+}
+
+// Next returns the pending changes, as the latest state of each changed Job,
+// ordered by ID.
+func (s *Subscription) Next() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Job, 0, len(s.pending))
+	for _, j := range s.pending {
+		list = append(list, j)
+	}
+	s.pending = map[int]Job{}
+
+	sort.Slice(list, func(i, k int) bool {
+		return list[i].ID < list[k].ID
+	})
+	return list
+}
+
+// Close stops the Subscription from receiving changes.
+func (s *Subscription) Close() {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	delete(s.m.subs, s)
+}
+
+func (s *Subscription) push(j Job) {
+	s.mu.Lock()
+	s.pending[j.ID] = j
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,39 @@
+package jobs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSubscriptionCoalesces(t *testing.T) {
+	m := NewManager(1)
+	sub := m.Subscribe()
+	defer sub.Close()
+
+	task := m.Start(KindBackup)
+	task.SetTotal(10)
+	for i := 0; i < 10; i++ {
+		task.Advance(1)
+	}
+	task.Finish(errors.New("disk full"))
+	// Reports after finishing are ignored
+	task.Advance(1)
+
+	<-sub.C()
+	list := sub.Next()
+	if len(list) != 1 {
+		t.Fatalf("expected 1 pending job, got %d", len(list))
+	}
+	j := list[0]
+	if j.State != StateFailed || j.Done != 10 || j.Total != 10 ||
+		j.Error != "disk full" || j.FinishedAt == nil {
+		t.Errorf("unexpected final state: %+v", j)
+	}
+
+	// Only the most recent finished job is retained
+	m.Start(KindSnapshot).Finish(nil)
+	jobs := m.Jobs()
+	if len(jobs) != 1 || jobs[0].Kind != KindSnapshot {
+		t.Errorf("expected only the snapshot job to be retained, got %+v", jobs)
+	}
+}
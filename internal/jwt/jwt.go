@@ -1,6 +1,7 @@
 package jwt
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"time"
@@ -11,51 +12,78 @@ import (
 
 const keyEnvKey = "JWT_KEY"
 
+// ErrAudience is returned when verifying tokens issued for another audience.
+var ErrAudience = errors.New("token is for another audience")
+
 // Authenticator authenticates JSON web tokens.
 type Authenticator struct {
+	// Audience is the audience of the tokens issued, such as the name of a
+	// tenant; tokens of other audiences are rejected.
+	Audience string
+
 	key string
 }
 
+// NewAuthenticator returns an Authenticator that signs and verifies tokens
+// with the given secret key.
+func NewAuthenticator(key string) *Authenticator {
+	return &Authenticator{
+		key: key,
+	}
+}
+
 // Claims is a custom JWT claims type with username and expiration information.
 type Claims struct {
 	Username string
+	// Session is the ID of the login session the token was issued for, or 0
+	// for tokens issued before sessions were tracked.
+	Session int `json:",omitempty"`
 	jwt.StandardClaims
 }
 
-// Verify checks the given HTTP request for a valid JWT.
-func (au *Authenticator) Verify(tokenstr string) error {
+// Verify checks the given token string for a valid JWT and returns its
+// claims.
+func (au *Authenticator) Verify(tokenstr string) (*Claims, error) {
 	claims := Claims{}
 	tkn, err := jwt.ParseWithClaims(tokenstr, &claims,
 		func(_ *jwt.Token) (interface{}, error) {
-			return au.key, nil
+			return []byte(au.key), nil
 		})
 	if err != nil {
-		return fmt.Errorf("failed to parse token string: %w", err)
+		return nil, fmt.Errorf("failed to parse token string: %w", err)
 	}
 
 	if !tkn.Valid {
-		return jwt.ErrSignatureInvalid
+		return nil, jwt.ErrSignatureInvalid
+	}
+	if claims.Audience != au.Audience {
+		return nil, fmt.Errorf("token audience %q: %w", claims.Audience, ErrAudience)
 	}
 
-	return nil
+	return &claims, nil
 }
 
-// NewToken returns a new JWT token.
-func (au *Authenticator) NewToken(username string, minDuration time.Duration) (string, error) {
-	expiration := time.Now().Add(minDuration * time.Minute)
+// NewToken returns a new JWT token for the given username and login session
+// that is valid for the given duration, and the time it expires.
+func (au *Authenticator) NewToken(
+	username string, session int, duration time.Duration,
+) (string, time.Time, error) {
+	expiration := time.Now().Add(duration)
 	claims := Claims{
 		Username: username,
+		Session:  session,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expiration.Unix(),
+			Audience:  au.Audience,
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &claims)
-	tknstr, err := token.SignedString(au.key)
+	tknstr, err := token.SignedString([]byte(au.key))
 	if err != nil {
-		return "", fmt.Errorf("failed to create signed string: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to create signed string: %w", err)
 	}
-	return tknstr, nil
+	return tknstr, expiration, nil
 }
 
 // ReadKeyFromEnv reads the JWT secret key from a .env file at the given path
@@ -0,0 +1,85 @@
+// Package mail delivers templated email messages to Users through an SMTP
+// server, queued and retried in the background.
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Message is a single plain text email message.
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Sender delivers Messages.
+type Sender interface {
+	Send(m *Message) error
+}
+
+// SMTPSender delivers Messages through an SMTP server.
+type SMTPSender struct {
+	Host string
+	Port string
+	// Username and Password authenticate with the server; no authentication
+	// is done if Username is empty.
+	Username string
+	Password string
+	// From is the address Messages are sent from.
+	From string
+}
+
+// Send delivers the given Message through the SMTP server.
+func (s *SMTPSender) Send(m *Message) error {
+	if len(m.To) == 0 {
+		return errors.New("no recipients given")
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	addr := net.JoinHostPort(s.Host, s.Port)
+	err := smtp.SendMail(addr, auth, s.From, m.To, s.encode(m, time.Now()))
+	if err != nil {
+		return fmt.Errorf("failed to send message %q: %w", m.Subject, err)
+	}
+	return nil
+}
+
+// encode returns the given Message with its headers, dated with the given
+// time, in the format sent to the server.
+func (s *SMTPSender) encode(m *Message, t time.Time) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", s.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", t.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.Replace(m.Body, "\n", "\r\n", -1))
+	return buf.Bytes()
+}
+
+// LogSender hands Messages to a logging function instead of delivering them,
+// for development.
+type LogSender struct {
+	Log func(m *Message)
+}
+
+// Send logs the given Message.
+func (s *LogSender) Send(m *Message) error {
+	if s.Log != nil {
+		s.Log(m)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package mail
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultQueueSize is the number of Messages a Queue holds if not
+	// configured.
+	DefaultQueueSize = 100
+	// DefaultRetryDelay is the delay before the first retry of a Message if
+	// not configured; the delay doubles with every retry.
+	DefaultRetryDelay = 30 * time.Second
+)
+
+// ErrQueueFull is returned when a Message is given to a Queue that cannot
+// hold any more.
+var ErrQueueFull = errors.New("mail queue full")
+
+// Queue sends Messages through a Sender in the background, retrying failed
+// deliveries. Messages still queued when the Queue is stopped are dropped.
+type Queue struct {
+	Sender Sender
+	// Retries is the number of times delivery of a Message is retried after
+	// it fails.
+	Retries int
+	// RetryDelay is the delay before the first retry; DefaultRetryDelay is
+	// used if not positive.
+	RetryDelay time.Duration
+	// OnError is called with the errors of the Messages that could not be
+	// delivered.
+	OnError func(error)
+
+	msgs chan *Message
+	stop chan struct{}
+	done chan struct{}
+	mu   sync.Mutex
+}
+
+// NewQueue returns a Queue holding up to the given number of Messages, or
+// DefaultQueueSize if not positive, for the given Sender.
+func NewQueue(sender Sender, size int, retries int, onError func(error)) *Queue {
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	return &Queue{
+		Sender:  sender,
+		Retries: retries,
+		OnError: onError,
+		msgs:    make(chan *Message, size),
+	}
+}
+
+// Start begins sending queued Messages in the background.
+func (q *Queue) Start() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.stop != nil {
+		return errors.New("mail queue already started")
+	}
+	q.stop = make(chan struct{})
+	q.done = make(chan struct{})
+	go q.run(q.stop, q.done)
+	return nil
+}
+
+// Stop stops sending Messages and waits for a delivery in progress to
+// finish.
+func (q *Queue) Stop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.stop == nil {
+		return
+	}
+	close(q.stop)
+	<-q.done
+	q.stop, q.done = nil, nil
+}
+
+// Enqueue adds the given Message to the Queue without waiting. It returns
+// ErrQueueFull if the Queue cannot hold it.
+func (q *Queue) Enqueue(m *Message) error {
+	select {
+	case q.msgs <- m:
+		return nil
+	default:
+		return fmt.Errorf("message %q: %w", m.Subject, ErrQueueFull)
+	}
+}
+
+func (q *Queue) run(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	for {
+		select {
+		case <-stop:
+			return
+		case m := <-q.msgs:
+			err := q.deliver(m, stop)
+			if err != nil && q.OnError != nil {
+				q.OnError(err)
+			}
+		}
+	}
+}
+
+// deliver sends the given Message, retrying with increasing delays until it
+// is sent, the retries run out, or the Queue is stopped.
+func (q *Queue) deliver(m *Message, stop <-chan struct{}) error {
+	delay := q.RetryDelay
+	if delay <= 0 {
+		delay = DefaultRetryDelay
+	}
+
+	err := q.Sender.Send(m)
+	for i := 0; err != nil && i < q.Retries; i++ {
+		select {
+		case <-stop:
+			return fmt.Errorf("stopped before delivery: %w", err)
+		case <-time.After(delay):
+		}
+		delay *= 2
+		err = q.Sender.Send(m)
+	}
+	return err
+}
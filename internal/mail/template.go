@@ -0,0 +1,117 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+	"time"
+)
+
+// Template renders the subject and body of Messages from some data.
+type Template struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+// NewTemplate returns a Template with the given subject and body templates,
+// in text/template syntax. It panics if either cannot be parsed.
+func NewTemplate(name string, subject string, body string) *Template {
+	return &Template{
+		subject: template.Must(template.New(name + ".subject").Parse(subject)),
+		body:    template.Must(template.New(name + ".body").Parse(body)),
+	}
+}
+
+// Render returns the Message to the given address rendered from the given
+// data.
+func (t *Template) Render(to string, data interface{}) (*Message, error) {
+	var subject, body bytes.Buffer
+	err := t.subject.Execute(&subject, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render subject: %w", err)
+	}
+	err = t.body.Execute(&body, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render body: %w", err)
+	}
+
+	return &Message{
+		To:      []string{to},
+		Subject: subject.String(),
+		Body:    body.String(),
+	}, nil
+}
+
+// PasswordResetData is the data of PasswordReset Messages.
+type PasswordResetData struct {
+	Username string
+	// Token is the password reset token, and URL the link to reset the
+	// password with it.
+	Token     string
+	URL       string
+	ExpiresAt time.Time
+}
+
+// PasswordReset is the Template of the Messages that let Users reset their
+// password.
+var PasswordReset = NewTemplate("password-reset",
+	`Reset your naos password`,
+	`Hi {{.Username}},
+
+Someone asked to reset the password of your naos account. If it was you,
+reset your password{{if .URL}} at
+
+    {{.URL}}
+{{else}} with the token
+
+    {{.Token}}
+{{end}}
+before {{.ExpiresAt.Format "2006-01-02 15:04 MST"}}. Otherwise, you can ignore this message.
+`)
+
+// AiringDigestData is the data of AiringDigest Messages.
+type AiringDigestData struct {
+	Username string
+	Entries  []AiringDigestEntry
+}
+
+// AiringDigestEntry is the number of Episodes of some Media aired in the
+// period of an AiringDigest.
+type AiringDigestEntry struct {
+	Title    string
+	Episodes int
+}
+
+// AiringDigest is the Template of the periodic digests of the Episodes aired
+// of the Media Users are watching.
+var AiringDigest = NewTemplate("airing-digest",
+	`New episodes of {{len .Entries}} shows you're watching`,
+	`Hi {{.Username}},
+
+New episodes aired recently of the shows you're watching or planning to
+watch:
+{{range .Entries}}
+  - {{.Title}}: {{.Episodes}} new episode{{if ne .Episodes 1}}s{{end}}{{end}}
+`)
+
+// ImportSummaryData is the data of ImportSummary Messages.
+type ImportSummaryData struct {
+	Username string
+	Imported int
+	Skipped  int
+	Errors   []string
+}
+
+// ImportSummary is the Template of the summaries of finished imports of the
+// lists of Users.
+var ImportSummary = NewTemplate("import-summary",
+	`Your naos import has finished`,
+	`Hi {{.Username}},
+
+Your import has finished: {{.Imported}} entries were imported and
+{{.Skipped}} were skipped.
+{{if .Errors}}
+The following problems were found:
+{{range .Errors}}
+  - {{.}}{{end}}
+{{end}}`)
@@ -0,0 +1,45 @@
+package naos_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/naos"
+	"github.com/Dophin2009/nao/internal/web"
+)
+
+// TestPublicRoutes tests that the read-only public API mode serves anonymous
+// callers the reads of Media, People and public lists, GraphQL and logging
+// in, and nothing else.
+func TestPublicRoutes(t *testing.T) {
+	access := web.Access{Rules: naos.PublicRoutes}
+	for _, tt := range []struct {
+		method string
+		path   []string
+		policy web.RoutePolicy
+	}{
+		{http.MethodGet, []string{"media"}, web.RoutePublic},
+		{http.MethodHead, []string{"media", ":id"}, web.RoutePublic},
+		{http.MethodGet, []string{"media", ":id", "staff"}, web.RoutePublic},
+		{http.MethodGet, []string{"search", "people"}, web.RoutePublic},
+		{http.MethodGet, []string{"people", ":id", "credits"}, web.RoutePublic},
+		{http.MethodGet, []string{"list", ":id"}, web.RoutePublic},
+		{http.MethodPost, []string{"graphql"}, web.RoutePublic},
+		{http.MethodPost, []string{"auth", "token"}, web.RoutePublic},
+		{http.MethodGet, []string{"auth", "oidc", ":provider", "callback"}, web.RoutePublic},
+		{http.MethodPost, []string{"media"}, web.RouteAuthenticated},
+		{http.MethodPatch, []string{"media", ":id"}, web.RouteAuthenticated},
+		{http.MethodGet, []string{"media", ":id", "friends"}, web.RouteAuthenticated},
+		{http.MethodPatch, []string{"list", ":id"}, web.RouteAuthenticated},
+		{http.MethodGet, []string{"user", ":id", "sessions"}, web.RouteAuthenticated},
+		{http.MethodGet, []string{"users", "me", "sessions"}, web.RouteAuthenticated},
+		{http.MethodDelete, []string{"users", "me", "sessions", ":id"}, web.RouteAuthenticated},
+		{http.MethodGet, []string{"admin", "overview"}, web.RouteAuthenticated},
+		{http.MethodGet, []string{"changes", "feed"}, web.RouteAuthenticated},
+	} {
+		h := web.Handler{Method: tt.method, Path: tt.path}
+		if p := access.Policy(&h); p != tt.policy {
+			t.Errorf("%s %s: expected policy %d, got %d", tt.method, h.PathString(), tt.policy, p)
+		}
+	}
+}
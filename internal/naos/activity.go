@@ -0,0 +1,231 @@
+package naos
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// ActivityFeed is a single page of an activity feed.
+type ActivityFeed struct {
+	First      *int               `json:"first"`
+	Skip       *int               `json:"skip"`
+	Activities []*models.Activity `json:"activities"`
+}
+
+// NewActivityHandler returns a GET endpoint handler that lists the
+// Activities of the User given by the id path variable, newest first and
+// paginated with the first and skip query parameters. Callers other than the
+// User may view them if the User's lists are visible to them.
+func NewActivityHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			uID, u, ok := authorizeLibraryView(w, r, ps, ds, au, models.PrivacyLists)
+			if !ok {
+				return
+			}
+			first, skip, ok := parsePagination(w, r)
+			if !ok {
+				return
+			}
+
+			var list []*models.Activity
+			err := ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var err error
+				list, err = ds.ActivityService.GetByUser(uID, first, skip, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get Activities of User with ID %d: %w",
+						uID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			displayActivityScores(u, list)
+			web.EncodeResponseBody(ActivityFeed{
+				First:      first,
+				Skip:       skip,
+				Activities: list,
+			}, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewActivityFeedHandler returns a GET endpoint handler that lists the
+// Activities of all Users whose lists are visible to the caller, newest first
+// and paginated with the first and skip query parameters. The users query
+// parameter, a comma-separated list of User IDs, restricts the feed to those
+// Users. If friends is true, the feed is restricted to the Users followed by
+// the caller instead.
+func NewActivityFeedHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator, friends bool,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			u, err := RequestUser(r, ds, au)
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorAuthentication, err, w)
+				return
+			}
+			first, skip, ok := parsePagination(w, r)
+			if !ok {
+				return
+			}
+			users, err := parseQueryIntList("users", r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+				return
+			}
+
+			if friends {
+				if u == nil {
+					web.EncodeResponseErrorUnauthorized(web.ErrorAuthentication,
+						errors.New("no credentials given"), w)
+					return
+				}
+				err = ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+					users, err = ds.UserFollowService.Followees(u.Meta.ID, tx)
+					return err
+				})
+				if err != nil {
+					web.EncodeResponseErrorFor(web.ErrorInternalServer,
+						fmt.Errorf("failed to get followees of User with ID %d: %w",
+							u.Meta.ID, err), w)
+					return
+				}
+			}
+
+			var wanted map[int]bool
+			if users != nil || friends {
+				wanted = make(map[int]bool, len(users))
+				for _, id := range users {
+					wanted[id] = true
+				}
+			}
+
+			var list []*models.Activity
+			err = ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				// The privacy settings of each User are checked once
+				visible := map[int]bool{}
+				var verr error
+				list, err = ds.ActivityService.GetFeed(first, skip, tx,
+					func(a *models.Activity) bool {
+						if wanted != nil && !wanted[a.UserID] {
+							return false
+						}
+
+						ok, seen := visible[a.UserID]
+						if !seen {
+							err := ds.UserService.AuthorizeViewAs(
+								u, a.UserID, models.PrivacyLists, tx)
+							if err != nil && !errors.Is(err, data.ErrUnauthorized) {
+								verr = err
+							}
+							ok = err == nil
+							visible[a.UserID] = ok
+						}
+						return ok
+					})
+				if err != nil {
+					return fmt.Errorf("failed to get Activities: %w", err)
+				}
+				return verr
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			displayActivityScores(u, list)
+			web.EncodeResponseBody(ActivityFeed{
+				First:      first,
+				Skip:       skip,
+				Activities: list,
+			}, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// parsePagination returns the first and skip query parameters of the given
+// request. If either cannot be parsed, it encodes an error response and
+// returns false.
+func parsePagination(w http.ResponseWriter, r *http.Request) (*int, *int, bool) {
+	first, err := web.ParseQueryInt("first", r)
+	if err != nil {
+		web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+		return nil, nil, false
+	}
+	skip, err := web.ParseQueryInt("skip", r)
+	if err != nil {
+		web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+		return nil, nil, false
+	}
+	return first, skip, true
+}
+
+// parseUpdatedSince returns the updated_since query parameter of the given
+// request, which limits listings to entities updated after it. If it cannot
+// be parsed, it encodes an error response and returns false.
+func parseUpdatedSince(w http.ResponseWriter, r *http.Request) (*time.Time, bool) {
+	since, err := web.ParseQueryTime("updated_since", r)
+	if err != nil {
+		web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+		return nil, false
+	}
+	return since, true
+}
+
+// displayActivityScores converts the scores of the given Activities to the
+// ScoreFormat of the caller.
+func displayActivityScores(caller *models.User, list []*models.Activity) {
+	format := data.ScoreFormatOf(caller)
+	for _, a := range list {
+		a.Score = format.Display(a.Score)
+	}
+}
+
+// parseQueryIntList returns the comma-separated int values of the URL query
+// parameter with the given name, or nil if the parameter is not present.
+func parseQueryIntList(name string, r *http.Request) ([]int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(v, ",")
+	list := make([]int, len(parts))
+	for i, p := range parts {
+		id, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return nil, fmt.Errorf("query parameter %q: %w", name, err)
+		}
+		list[i] = id
+	}
+	return list, nil
+}
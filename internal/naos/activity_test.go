@@ -0,0 +1,52 @@
+package naos_test
+
+import (
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestActivityFeed tests that completing and scoring UserMedia are recorded
+// in the capped feed of their User.
+func TestActivityFeed(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+	ds.ActivityService.FeedSize = 2
+
+	uID := refs["spike"]
+	var list []*models.Activity
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		um, err := ds.UserMediaService.GetByID(refs["watching"], tx)
+		if err != nil {
+			return err
+		}
+		for _, score := range []int{7, 8, 8, 9} {
+			score := score
+			um.Score = &score
+			err = ds.UserMediaService.Update(um, tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		list, err = ds.ActivityService.GetByUser(uID, nil, nil, tx)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to record activity: %v", err)
+	}
+
+	// The Completed Activity of the fixture and the score of 7 are dropped,
+	// and the unchanged score of 8 is recorded once
+	if len(list) != 2 {
+		t.Fatalf("expected 2 Activities, got %d", len(list))
+	}
+	for i, score := range []int{9, 8} {
+		a := list[i]
+		if a.Kind != models.ActivityKindScored || a.Score == nil || *a.Score != score {
+			t.Errorf("expected Activity %d to be a score of %d, got %+v", i, score, *a)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package naos
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// NewNextEpisodeHandler returns a GET endpoint handler that returns the next
+// Episode to air of the Media given by the id path variable, along with the
+// number of seconds until it airs. Media without an Episode dated in the
+// future have no next Episode.
+func NewNextEpisodeHandler(path []string, ds *graphql.DataService) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			mID, err := web.ParsePathVarInt("id", &ps)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorPathVariableParsing, err, w)
+				return
+			}
+
+			var next *models.NextEpisode
+			err = ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				_, err := ds.MediaService.GetByID(mID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get Media by ID %d: %w", mID, err)
+				}
+				next, err = ds.EpisodeAiringService.NextEpisode(mID, time.Now(), tx)
+				return err
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			localizeNextEpisodes([]*models.NextEpisode{next}, r)
+			web.EncodeResponseBody(next, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewUpcomingHandler returns a GET endpoint handler that lists the next
+// Episode to air of each Media the User given by the id path variable is
+// currently watching, soonest first. Callers other than the User may view it
+// if the User's lists are visible to them.
+func NewUpcomingHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			uID, _, ok := authorizeLibraryView(w, r, ps, ds, au, models.PrivacyLists)
+			if !ok {
+				return
+			}
+
+			var list []*models.NextEpisode
+			err := ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var err error
+				list, err = ds.EpisodeAiringService.Upcoming(uID, time.Now(), tx)
+				if err != nil {
+					return fmt.Errorf("failed to list upcoming Episodes: %w", err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			localizeNextEpisodes(list, r)
+			web.EncodeResponseBody(list, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// localizeNextEpisodes orders the Titles of the Media and Episodes of the
+// given list for the Accept-Language header of the given request.
+func localizeNextEpisodes(list []*models.NextEpisode, r *http.Request) {
+	langs := models.ParseAcceptLanguage(r.Header.Get(web.HeaderAcceptLanguage))
+	for _, next := range list {
+		next.Media.Titles = models.LocalizeTitles(next.Media.Titles, langs)
+		next.Episode.Titles = models.LocalizeTitles(next.Episode.Titles, langs)
+	}
+}
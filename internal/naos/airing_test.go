@@ -0,0 +1,103 @@
+package naos_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestNextEpisode tests that the next Episode of a Media follows the dates of
+// its Episodes and that it is listed for the Users watching the Media.
+func TestNextEpisode(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	now := time.Now()
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d).Truncate(time.Second)
+		return &t
+	}
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		mID, err := ds.MediaService.Create(&models.Media{
+			Titles: []models.Title{{String: "Samurai Champloo", Language: "en"}},
+		}, tx)
+		if err != nil {
+			return err
+		}
+		dates := []*time.Time{at(-24 * time.Hour), at(time.Hour), at(48 * time.Hour)}
+		eps := make([]int, len(dates))
+		for i, d := range dates {
+			eps[i], err = ds.EpisodeService.Create(&models.Episode{Date: d}, tx)
+			if err != nil {
+				return err
+			}
+		}
+		setID, err := ds.EpisodeSetService.Create(&models.EpisodeSet{
+			MediaID: mID, Episodes: eps,
+		}, tx)
+		if err != nil {
+			return err
+		}
+
+		next, err := ds.EpisodeAiringService.NextEpisode(mID, now, tx)
+		if err != nil {
+			return err
+		}
+		if next.Episode.Meta.ID != eps[1] || next.Number != 2 ||
+			next.TimeUntilAiring <= 0 || next.TimeUntilAiring > 3600 {
+			t.Errorf("expected episode 2 within an hour, got episode %d in %ds",
+				next.Number, next.TimeUntilAiring)
+		}
+
+		// The Episode aired early
+		ep, err := ds.EpisodeService.GetByID(eps[1], tx)
+		if err != nil {
+			return err
+		}
+		ep.Date = at(-time.Hour)
+		err = ds.EpisodeService.Update(ep, tx)
+		if err != nil {
+			return err
+		}
+
+		status := models.WatchStatusCurrent
+		_, err = ds.UserMediaService.Create(&models.UserMedia{
+			UserID: refs["spike"], MediaID: mID, Status: &status,
+		}, tx)
+		if err != nil {
+			return err
+		}
+		list, err := ds.EpisodeAiringService.Upcoming(refs["spike"], now, tx)
+		if err != nil {
+			return err
+		}
+		if len(list) != 1 || list[0].Episode.Meta.ID != eps[2] || list[0].Number != 3 {
+			t.Errorf("expected episode 3 upcoming, got %v", list)
+		}
+		list, err = ds.EpisodeAiringService.Upcoming(refs["faye"], now, tx)
+		if err != nil {
+			return err
+		}
+		if len(list) != 0 {
+			t.Errorf("expected no upcoming Episodes of other Users, got %d", len(list))
+		}
+
+		err = ds.EpisodeSetService.Delete(setID, tx)
+		if err != nil {
+			return err
+		}
+		_, err = ds.EpisodeAiringService.NextEpisode(mID, now, tx)
+		if !errors.Is(err, data.ErrNotFound) {
+			t.Errorf("expected no next Episode without Episodes, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to get next Episodes: %v", err)
+	}
+}
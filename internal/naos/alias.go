@@ -0,0 +1,199 @@
+package naos
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// MediaAliasRequest is the request body of a new or changed MediaAlias.
+type MediaAliasRequest struct {
+	Title    string                `json:"title" validate:"required,max=255"`
+	Language string                `json:"language" validate:"lang"`
+	Type     models.MediaAliasType `json:"type"`
+}
+
+// NewMediaAliasesHandler returns a GET endpoint handler that lists the
+// MediaAliases of the Media given by the id path variable.
+func NewMediaAliasesHandler(path []string, ds *graphql.DataService) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			mID, err := web.ParsePathVarInt("id", &ps)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorPathVariableParsing, err, w)
+				return
+			}
+
+			var list []*models.MediaAlias
+			err = ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				_, err := ds.MediaService.GetByID(mID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get Media by ID %d: %w", mID, err)
+				}
+				list, err = ds.MediaAliasService.GetByMedia(mID, nil, nil, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get MediaAliases by Media ID %d: %w", mID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(list, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewMediaAliasCreateHandler returns a POST endpoint handler that adds the
+// MediaAlias in the request body to the Media given by the id path variable.
+// Only Moderators may add MediaAliases.
+func NewMediaAliasCreateHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		DryRun: true,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			if !authorizeRole(w, r, ds, au, models.RoleModerator) {
+				return
+			}
+			mID, err := web.ParsePathVarInt("id", &ps)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorPathVariableParsing, err, w)
+				return
+			}
+			var req MediaAliasRequest
+			if !parseRequestBody(w, r, &req) {
+				return
+			}
+
+			a := models.MediaAlias{
+				MediaID:  mID,
+				Title:    req.Title,
+				Language: req.Language,
+				Type:     req.Type,
+			}
+			err = ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				_, err := ds.MediaAliasService.Create(&a, tx)
+				if err != nil {
+					return fmt.Errorf("failed to create MediaAlias of Media with ID %d: %w",
+						mID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			w.WriteHeader(http.StatusCreated)
+			web.EncodeResponseBody(&a, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewMediaAliasUpdateHandler returns a PUT endpoint handler that replaces the
+// title, language and type of the MediaAlias given by the id path variable
+// with those in the request body. Only Moderators may change MediaAliases.
+func NewMediaAliasUpdateHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPut,
+		Path:   path,
+		DryRun: true,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			if !authorizeRole(w, r, ds, au, models.RoleModerator) {
+				return
+			}
+			aID, err := web.ParsePathVarInt("id", &ps)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorPathVariableParsing, err, w)
+				return
+			}
+			var req MediaAliasRequest
+			if !parseRequestBody(w, r, &req) {
+				return
+			}
+
+			var a *models.MediaAlias
+			err = ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				a, err = ds.MediaAliasService.GetByID(aID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get MediaAlias by ID %d: %w", aID, err)
+				}
+
+				a.Title = req.Title
+				a.Language = req.Language
+				a.Type = req.Type
+				err = ds.MediaAliasService.Update(a, tx)
+				if err != nil {
+					return fmt.Errorf("failed to update MediaAlias with ID %d: %w", aID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(a, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewMediaAliasDeleteHandler returns a DELETE endpoint handler that deletes
+// the MediaAlias given by the id path variable. Only Moderators may delete
+// MediaAliases.
+func NewMediaAliasDeleteHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodDelete,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			if !authorizeRole(w, r, ds, au, models.RoleModerator) {
+				return
+			}
+			aID, err := web.ParsePathVarInt("id", &ps)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorPathVariableParsing, err, w)
+				return
+			}
+
+			err = ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				err := ds.MediaAliasService.Delete(aID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to delete MediaAlias with ID %d: %w", aID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		},
+	}
+}
@@ -0,0 +1,224 @@
+package naos
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// APIKeyInfo is the view of an APIKey given to callers, without its hash.
+type APIKeyInfo struct {
+	ID        int                `json:"id"`
+	UserID    int                `json:"userId"`
+	Name      string             `json:"name"`
+	Scope     models.APIKeyScope `json:"scope"`
+	Prefix    string             `json:"prefix"`
+	CreatedAt time.Time          `json:"createdAt"`
+	LastUsed  *time.Time         `json:"lastUsed"`
+}
+
+func newAPIKeyInfo(k *models.APIKey) *APIKeyInfo {
+	return &APIKeyInfo{
+		ID:        k.Meta.ID,
+		UserID:    k.UserID,
+		Name:      k.Name,
+		Scope:     k.Scope,
+		Prefix:    k.Prefix,
+		CreatedAt: k.Meta.CreatedAt,
+		LastUsed:  k.LastUsed,
+	}
+}
+
+func newAPIKeyInfos(list []*models.APIKey) []*APIKeyInfo {
+	infos := make([]*APIKeyInfo, len(list))
+	for i, k := range list {
+		infos[i] = newAPIKeyInfo(k)
+	}
+	return infos
+}
+
+// APIKeyRequest is the request body of the creation of an API key.
+type APIKeyRequest struct {
+	Name  string             `json:"name" validate:"required,max=255"`
+	Scope models.APIKeyScope `json:"scope"`
+}
+
+// APIKeyResponse is the response body of a created API key. The key is only
+// ever returned here.
+type APIKeyResponse struct {
+	Key    string      `json:"key"`
+	APIKey *APIKeyInfo `json:"apiKey"`
+}
+
+// NewAPIKeyCreateHandler returns a POST endpoint handler that creates an API
+// key of the caller with the name and scope given in the request body. Keys
+// may only be created with tokens from logins or keys of the Admin scope, so
+// that keys do not grant more than the credentials they were created with.
+func NewAPIKeyCreateHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			u, scope, err := RequestCaller(r, ds, au)
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorAuthentication, err, w)
+				return
+			}
+			if u == nil {
+				web.EncodeResponseErrorUnauthorized(web.ErrorAuthentication,
+					errors.New("no credentials given"), w)
+				return
+			}
+			if !scope.Includes(models.APIKeyScopeAdmin) {
+				web.EncodeResponseErrorForbidden(web.ErrorAuthorization,
+					fmt.Errorf("API key of scope %s: may not create API keys", scope), w)
+				return
+			}
+
+			var req APIKeyRequest
+			if !parseRequestBody(w, r, &req) {
+				return
+			}
+
+			var res APIKeyResponse
+			err = ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				key, k, err := ds.APIKeyService.Generate(u.Meta.ID, req.Name, req.Scope, tx)
+				if err != nil {
+					return err
+				}
+				res = APIKeyResponse{Key: key, APIKey: newAPIKeyInfo(k)}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(res, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewAPIKeysHandler returns a GET endpoint handler that lists the API keys of
+// the caller.
+func NewAPIKeysHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			u, ok := loginCaller(w, r, ds, au)
+			if !ok {
+				return
+			}
+
+			var list []*models.APIKey
+			err := ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var err error
+				list, err = ds.APIKeyService.GetByUser(u.Meta.ID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get APIKeys by User ID %d: %w", u.Meta.ID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(newAPIKeyInfos(list), w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewAPIKeyRevokeHandler returns a DELETE endpoint handler that revokes the
+// API key of the caller given by the id path variable.
+func NewAPIKeyRevokeHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodDelete,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			id, err := web.ParsePathVarInt("id", &ps)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorPathVariableParsing, err, w)
+				return
+			}
+			u, ok := loginCaller(w, r, ds, au)
+			if !ok {
+				return
+			}
+
+			err = ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				return ds.APIKeyService.Revoke(id, u.Meta.ID, tx)
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(struct{}{}, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewAdminAPIKeysHandler returns a GET endpoint handler that lists the API
+// keys of all Users, with first and skip query parameters. Only Admins may
+// list them.
+func NewAdminAPIKeysHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			if !authorizeRole(w, r, ds, au, models.RoleAdmin) {
+				return
+			}
+			first, skip, ok := parsePagination(w, r)
+			if !ok {
+				return
+			}
+
+			var list []*models.APIKey
+			err := ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var err error
+				list, err = ds.APIKeyService.GetAll(first, skip, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get APIKeys: %w", err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(newAPIKeyInfos(list), w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
@@ -0,0 +1,65 @@
+package naos_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/naos"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestAPIKey tests that API keys authenticate their User with permissions
+// limited by their scope until they are revoked.
+func TestAPIKey(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	spike := refs["spike"]
+	var key string
+	var k *models.APIKey
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		u, err := ds.UserService.GetByID(spike, tx)
+		if err != nil {
+			return err
+		}
+		u.Permissions.WriteMedia = true
+		err = ds.UserService.Update(u, tx)
+		if err != nil {
+			return err
+		}
+
+		key, k, err = ds.APIKeyService.Generate(spike, "scrobbler", models.APIKeyScopeWrite, tx)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to generate API key: %v", err)
+	}
+	if !data.IsAPIKey(key) || k.Prefix != key[:len(k.Prefix)] {
+		t.Errorf("unexpected key %q with prefix %q", key, k.Prefix)
+	}
+
+	u, scope, err := naos.CredentialUser(key, ds, nil)
+	if err != nil {
+		t.Fatalf("failed to authenticate API key: %v", err)
+	}
+	if u.Meta.ID != spike || scope != models.APIKeyScopeWrite {
+		t.Errorf("expected User %d with Write scope, got %d with %s", spike, u.Meta.ID, scope)
+	}
+	if u.Permissions.Role() != models.RoleUser {
+		t.Errorf("expected permissions limited to User role, got %s", u.Permissions.Role())
+	}
+
+	err = ds.Database.Transaction(true, func(tx db.Tx) error {
+		return ds.APIKeyService.Revoke(k.Meta.ID, spike, tx)
+	})
+	if err != nil {
+		t.Fatalf("failed to revoke API key: %v", err)
+	}
+	_, _, err = naos.CredentialUser(key, ds, nil)
+	if !errors.Is(err, data.ErrUnauthorized) {
+		t.Errorf("expected revoked key to be unauthorized, got %v", err)
+	}
+}
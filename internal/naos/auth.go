@@ -0,0 +1,304 @@
+package naos
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// HeaderAuthorization is the HTTP header that carries the caller's
+// credentials.
+const HeaderAuthorization = "Authorization"
+
+// RequestUser returns the User authenticated by the bearer token in the
+// Authorization header of the given request, or nil if the request carries
+// no token. API keys of the Read scope are refused for requests that may
+// modify data.
+func RequestUser(
+	r *http.Request, ds *graphql.DataService, au *jwt.Authenticator,
+) (*models.User, error) {
+	u, scope, err := RequestCaller(r, ds, au)
+	if err != nil {
+		return nil, err
+	}
+	if u != nil && !scope.Includes(models.APIKeyScopeWrite) && !safeMethod(r.Method) {
+		return nil, fmt.Errorf("API key of scope %s: read-only: %w", scope,
+			data.ErrUnauthorized)
+	}
+	return u, nil
+}
+
+// RequestCaller returns the User authenticated by the bearer token in the
+// Authorization header of the given request, or nil if the request carries
+// no token, and the scope of the token.
+func RequestCaller(
+	r *http.Request, ds *graphql.DataService, au *jwt.Authenticator,
+) (*models.User, models.APIKeyScope, error) {
+	tknstr, err := bearerToken(r)
+	if err != nil || tknstr == "" {
+		return nil, models.APIKeyScopeAdmin, err
+	}
+	return CredentialUser(tknstr, ds, au)
+}
+
+// RequireCaller returns an error wrapping data.ErrUnauthorized if the given
+// request carries no valid credentials.
+func RequireCaller(
+	r *http.Request, ds *graphql.DataService, au *jwt.Authenticator,
+) error {
+	u, _, err := RequestCaller(r, ds, au)
+	if err != nil {
+		return err
+	}
+	if u == nil {
+		return fmt.Errorf("credentials required: %w", data.ErrUnauthorized)
+	}
+	return nil
+}
+
+// readMethods are the HTTP methods of the routes of the read-only public API.
+var readMethods = []string{http.MethodGet, http.MethodHead}
+
+// PublicRoutes is the route policy table of the read-only public API mode,
+// which makes public the reads of Media, People and public lists, GraphQL,
+// which is read-only for anonymous callers, and the routes of logging in.
+// All other routes require credentials.
+var PublicRoutes = []web.RouteRule{
+	{Path: []string{"auth", "token"}, Policy: web.RoutePublic},
+	{Path: []string{"auth", "refresh"}, Policy: web.RoutePublic},
+	{Path: []string{"auth", "reset", "**"}, Policy: web.RoutePublic},
+	{Path: []string{"auth", "oidc", "**"}, Policy: web.RoutePublic},
+	// Scripts authenticate the callers of their webhooks themselves
+	{Path: []string{"hooks", "*"}, Policy: web.RoutePublic},
+	{Methods: []string{http.MethodPost}, Path: []string{"graphql"},
+		Policy: web.RoutePublic},
+	{Methods: readMethods, Path: []string{"graphiql"}, Policy: web.RoutePublic},
+	// Friends are only known to Users
+	{Methods: readMethods, Path: []string{"media", "*", "friends"},
+		Policy: web.RouteAuthenticated},
+	{Methods: readMethods, Path: []string{"media", "**"}, Policy: web.RoutePublic},
+	{Methods: readMethods, Path: []string{"search", "**"}, Policy: web.RoutePublic},
+	{Methods: readMethods, Path: []string{"people", "**"}, Policy: web.RoutePublic},
+	{Methods: readMethods, Path: []string{"list", "*"}, Policy: web.RoutePublic},
+}
+
+// bearerToken returns the bearer token in the Authorization header of the
+// given request, or an empty string if there is none.
+func bearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get(HeaderAuthorization)
+	if header == "" {
+		return "", nil
+	}
+
+	tknstr := strings.TrimPrefix(header, "Bearer ")
+	if tknstr == header {
+		return "", fmt.Errorf("authorization header is not a bearer token: %w",
+			data.ErrUnauthorized)
+	}
+	return tknstr, nil
+}
+
+// safeMethod checks if requests with the given HTTP method only read data.
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// CredentialUser returns the User authenticated by the given bearer token,
+// either an API key or a token from a login, and the scope of the token.
+// Tokens from logins have the Admin scope.
+func CredentialUser(
+	tknstr string, ds *graphql.DataService, au *jwt.Authenticator,
+) (*models.User, models.APIKeyScope, error) {
+	if data.IsAPIKey(tknstr) {
+		return APIKeyUser(tknstr, ds)
+	}
+	u, err := TokenUser(tknstr, ds, au)
+	return u, models.APIKeyScopeAdmin, err
+}
+
+// APIKeyUser returns the User of the given API key, with their permissions
+// limited by its scope, and the scope.
+func APIKeyUser(
+	key string, ds *graphql.DataService,
+) (*models.User, models.APIKeyScope, error) {
+	var u *models.User
+	var k *models.APIKey
+	err := ds.Database.Transaction(false, func(tx db.Tx) error {
+		var err error
+		k, err = ds.APIKeyService.Authenticate(key, tx)
+		if err != nil {
+			return err
+		}
+		u, err = ds.UserService.GetByID(k.UserID, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get User by ID %d: %w", k.UserID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, models.APIKeyScopeRead, err
+	}
+	if u.Disabled {
+		return nil, models.APIKeyScopeRead,
+			fmt.Errorf("User %q: disabled: %w", u.Username, data.ErrUnauthorized)
+	}
+
+	now := time.Now()
+	if k.LastUsed == nil || now.Sub(*k.LastUsed) > loginSessionTouchInterval {
+		err = ds.Database.Transaction(true, func(tx db.Tx) error {
+			return ds.APIKeyService.Touch(k.Meta.ID, now, tx)
+		})
+		// Nodes of a cluster other than the leader leave it to the next use
+		if err != nil && !errors.Is(err, data.ErrUnavailable) {
+			return nil, models.APIKeyScopeRead, err
+		}
+	}
+
+	u.Permissions = k.Scope.Permissions(u.Permissions)
+	return u, k.Scope, nil
+}
+
+// TokenUser returns the User authenticated by the given token.
+func TokenUser(
+	tknstr string, ds *graphql.DataService, au *jwt.Authenticator,
+) (*models.User, error) {
+	if au == nil {
+		return nil, fmt.Errorf("token authentication is not configured: %w",
+			data.ErrUnauthorized)
+	}
+
+	claims, err := au.Verify(tknstr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify token: %v: %w", err, data.ErrUnauthorized)
+	}
+
+	now := time.Now()
+	var u *models.User
+	var ls *models.LoginSession
+	err = ds.Database.Transaction(false, func(tx db.Tx) error {
+		u, err = ds.UserService.GetByUsername(claims.Username, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get User by username %q: %w",
+				claims.Username, err)
+		}
+		if claims.Session == 0 {
+			return nil
+		}
+
+		// Tokens of revoked sessions are no longer valid
+		ls, err = ds.LoginSessionService.Verify(claims.Session, u.Meta.ID, now, tx)
+		return err
+	})
+	if errors.Is(err, data.ErrNotFound) {
+		// Tokens of deleted Users are no longer valid
+		return nil, fmt.Errorf("%v: %w", err, data.ErrUnauthorized)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if u.Disabled {
+		// Tokens of disabled Users are no longer valid either
+		return nil, fmt.Errorf("User %q: disabled: %w", u.Username, data.ErrUnauthorized)
+	}
+
+	if ls != nil && now.Sub(ls.LastUsed) > loginSessionTouchInterval {
+		err = ds.Database.Transaction(true, func(tx db.Tx) error {
+			_, err := ds.LoginSessionService.Use(ls.Meta.ID, u.Meta.ID, "", now,
+				time.Time{}, tx)
+			return err
+		})
+		if err != nil && !errors.Is(err, data.ErrUnavailable) {
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+// loginSessionTouchInterval is the longest time the last use of a login
+// session or API key goes unrecorded, so that not every request writes to
+// the database.
+const loginSessionTouchInterval = 5 * time.Minute
+
+// RequestSession returns the ID of the login session of the token of the
+// given request, or 0 if the request carries no valid token of a session.
+func RequestSession(r *http.Request, au *jwt.Authenticator) int {
+	tknstr, err := bearerToken(r)
+	if au == nil || err != nil || tknstr == "" || data.IsAPIKey(tknstr) {
+		return 0
+	}
+	claims, err := au.Verify(tknstr)
+	if err != nil {
+		return 0
+	}
+	return claims.Session
+}
+
+// requestIP returns the address of the remote end of the given request.
+func requestIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RequestRole returns the Role of the caller of the given request.
+func RequestRole(
+	r *http.Request, ds *graphql.DataService, au *jwt.Authenticator,
+) (models.Role, error) {
+	u, err := RequestUser(r, ds, au)
+	if err != nil {
+		return models.RoleAnonymous, err
+	}
+	if u == nil {
+		return models.RoleAnonymous, nil
+	}
+	return u.Permissions.Role(), nil
+}
+
+// authorizeRole returns true if the caller of the given request has the given
+// Role. Otherwise, it encodes an error response and returns false.
+func authorizeRole(
+	w http.ResponseWriter, r *http.Request,
+	ds *graphql.DataService, au *jwt.Authenticator, role models.Role,
+) bool {
+	_, ok := authorizeRoleUser(w, r, ds, au, role)
+	return ok
+}
+
+// authorizeRoleUser returns the caller of the given request and true if the
+// caller has the given Role, as authorizeRole does.
+func authorizeRoleUser(
+	w http.ResponseWriter, r *http.Request,
+	ds *graphql.DataService, au *jwt.Authenticator, role models.Role,
+) (*models.User, bool) {
+	u, err := RequestUser(r, ds, au)
+	if err != nil {
+		web.EncodeResponseErrorFor(web.ErrorAuthentication, err, w)
+		return nil, false
+	}
+	caller := models.RoleAnonymous
+	if u != nil {
+		caller = u.Permissions.Role()
+	}
+	if !caller.Includes(role) {
+		web.EncodeResponseErrorForbidden(web.ErrorAuthorization,
+			fmt.Errorf("role %s: insufficient permissions", caller), w)
+		return nil, false
+	}
+	return u, true
+}
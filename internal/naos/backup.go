@@ -0,0 +1,51 @@
+package naos
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jobs"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// NewBackupHandler returns a GET endpoint handler that streams a consistent
+// snapshot of the database to Admin callers. Its progress is tracked as a
+// job.
+func NewBackupHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator, jm *jobs.Manager,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			if !authorizeRole(w, r, ds, au, models.RoleAdmin) {
+				return
+			}
+
+			filename := fmt.Sprintf("nao-%s.db",
+				time.Now().UTC().Format("20060102T150405Z"))
+			w.Header().Set(web.HeaderContentType, "application/octet-stream")
+			w.Header().Set("Content-Disposition",
+				fmt.Sprintf("attachment; filename=%q", filename))
+
+			// Headers have already been sent once writing begins, so errors
+			// can only be logged
+			n, err := ds.Database.BackupWithProgress(w, jm.Start(jobs.KindBackup))
+			if err != nil {
+				log.WithFields(log.Fields{
+					"written": n,
+				}).Errorf("Failed to stream backup: %v", err)
+				return
+			}
+			log.WithFields(log.Fields{
+				"written": n,
+			}).Info("Streamed backup")
+		},
+	}
+}
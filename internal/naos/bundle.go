@@ -0,0 +1,98 @@
+package naos
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// NewMediaExportHandler returns a GET endpoint handler that exports the Media
+// given by the id path variable as a MediaBundle, a single JSON document
+// along with its Episodes, Genres, Characters, staff and relations, which
+// other instances may import.
+func NewMediaExportHandler(path []string, ds *graphql.DataService) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			mID, err := web.ParsePathVarInt("id", &ps)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorPathVariableParsing, err, w)
+				return
+			}
+
+			var b *models.MediaBundle
+			err = ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				b, err = ds.MediaBundleService.Export(mID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to export Media with ID %d: %w", mID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			filename := fmt.Sprintf("media-%d.json", mID)
+			if b.Media.Slug != "" {
+				filename = fmt.Sprintf("%s.json", b.Media.Slug)
+			}
+			w.Header().Set("Content-Disposition",
+				fmt.Sprintf("attachment; filename=%q", filename))
+			web.EncodeResponseBody(b, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewMediaImportHandler returns a POST endpoint handler that imports the
+// MediaBundle in the request body, such as one exported by another instance,
+// in a single transaction, and responds with the new IDs of its entities with
+// 201 Created. Only Moderators may import Media.
+func NewMediaImportHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		DryRun: true,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			if !authorizeRole(w, r, ds, au, models.RoleModerator) {
+				return
+			}
+			var b models.MediaBundle
+			if !parseRequestBody(w, r, &b) {
+				return
+			}
+
+			var res *models.MediaBundleImport
+			err := ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				var err error
+				res, err = ds.MediaBundleService.Import(&b, tx)
+				if err != nil {
+					return fmt.Errorf("failed to import Media: %w", err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			w.WriteHeader(http.StatusCreated)
+			web.EncodeResponseBody(res, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
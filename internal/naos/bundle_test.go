@@ -0,0 +1,173 @@
+package naos_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestMediaBundle tests that a Media exported from one instance is imported
+// into another with its entities remapped, its Genres matched by name and
+// its relations to Media of the same ExternalIDs.
+func TestMediaBundle(t *testing.T) {
+	src, srcRefs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+	dst, dstRefs, cleanupDst := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanupDst()
+
+	// Both instances know the movie by its ExternalID
+	setExternalID := func(ds *graphql.DataService, mID int) {
+		err := ds.Database.Transaction(true, func(tx db.Tx) error {
+			md, err := ds.MediaService.GetByID(mID, tx)
+			if err != nil {
+				return err
+			}
+			md.ExternalID = "mal:5"
+			return ds.MediaService.Update(md, tx)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	setExternalID(src, srcRefs["movie"])
+	setExternalID(dst, dstRefs["movie"])
+
+	var buf []byte
+	err := src.Database.Transaction(true, func(tx db.Tx) error {
+		mID := srcRefs["bebop"]
+		epID, err := src.EpisodeService.Create(&models.Episode{
+			Titles: []models.Title{{String: "Asteroid Blues", Language: "en"}},
+		}, tx)
+		if err != nil {
+			return err
+		}
+		_, err = src.EpisodeSetService.Create(&models.EpisodeSet{
+			MediaID: mID, Episodes: []int{epID},
+		}, tx)
+		if err != nil {
+			return err
+		}
+		cID, err := src.CharacterService.Create(&models.Character{
+			Names: []models.Title{{String: "Spike Spiegel", Language: "en"}},
+		}, tx)
+		if err != nil {
+			return err
+		}
+		pID, err := src.PersonService.Create(&models.Person{
+			Names: []models.Title{{String: "Koichi Yamadera", Language: "en"}},
+		}, tx)
+		if err != nil {
+			return err
+		}
+		cRole, pRole := "Main", "Japanese"
+		_, err = src.MediaCharacterService.Create(&models.MediaCharacter{
+			MediaID: mID, CharacterID: &cID, CharacterRole: &cRole,
+			PersonID: &pID, PersonRole: &pRole,
+		}, tx)
+		if err != nil {
+			return err
+		}
+		_, err = src.MediaStaffService.Create(&models.MediaStaff{
+			MediaID: mID, PersonID: pID, Role: "Voice Director",
+		}, tx)
+		if err != nil {
+			return err
+		}
+		_, err = src.MediaRelationSerivce.Create(&models.MediaRelation{
+			OwnerID: mID, RelatedID: srcRefs["movie"],
+			Relationship: models.MediaRelationshipSideStory,
+		}, tx)
+		if err != nil {
+			return err
+		}
+
+		b, err := src.MediaBundleService.Export(mID, tx)
+		if err != nil {
+			return err
+		}
+		buf, err = json.Marshal(b)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to export Media: %v", err)
+	}
+
+	var b models.MediaBundle
+	err = json.Unmarshal(buf, &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res *models.MediaBundleImport
+	err = dst.Database.Transaction(true, func(tx db.Tx) error {
+		var err error
+		res, err = dst.MediaBundleService.Import(&b, tx)
+		if err != nil {
+			return err
+		}
+
+		mID := res.MediaID
+		if mID == dstRefs["bebop"] {
+			t.Errorf("expected new Media, got ID %d", mID)
+		}
+		genres, err := dst.MediaGenreService.GetByMedia(mID, nil, nil, tx)
+		if err != nil {
+			return err
+		}
+		if len(genres) != 1 || genres[0].GenreID != dstRefs["scifi"] {
+			t.Errorf("expected existing Genre %d, got %v", dstRefs["scifi"], genres)
+		}
+		sets, err := dst.EpisodeSetService.GetByMedia(mID, nil, nil, tx)
+		if err != nil {
+			return err
+		}
+		if len(sets) != 1 || len(sets[0].Episodes) != 1 {
+			t.Fatalf("expected 1 EpisodeSet of 1 Episode, got %v", sets)
+		}
+		chars, err := dst.MediaCharacterService.GetByMedia(mID, nil, nil, tx)
+		if err != nil {
+			return err
+		}
+		staff, err := dst.MediaStaffService.GetByMedia(mID, nil, nil, tx)
+		if err != nil {
+			return err
+		}
+		if len(chars) != 1 || len(staff) != 1 || *chars[0].PersonID != staff[0].PersonID {
+			t.Errorf("expected Character and staff of the same Person, got %v and %v",
+				chars, staff)
+		}
+		rels, err := dst.MediaRelationSerivce.GetByOwner(mID, nil, nil, tx)
+		if err != nil {
+			return err
+		}
+		if len(rels) != 1 || rels[0].RelatedID != dstRefs["movie"] {
+			t.Errorf("expected relation to Media %d, got %v", dstRefs["movie"], rels)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to import Media: %v", err)
+	}
+	if len(res.SkippedRelations) != 0 {
+		t.Errorf("expected no skipped relations, got %v", res.SkippedRelations)
+	}
+
+	// Media are imported once by their ExternalIDs
+	b.Media.ExternalID = "mal:1"
+	err = dst.Database.Transaction(true, func(tx db.Tx) error {
+		_, err := dst.MediaBundleService.Import(&b, tx)
+		if err != nil {
+			return err
+		}
+		_, err = dst.MediaBundleService.Import(&b, tx)
+		return err
+	})
+	if !errors.Is(err, data.ErrConflict) {
+		t.Errorf("expected Media of the same ExternalID to conflict, got %v", err)
+	}
+}
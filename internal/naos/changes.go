@@ -0,0 +1,160 @@
+package naos
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// ChangeFeed is a single page of the public change feed.
+type ChangeFeed struct {
+	Type    *string          `json:"type"`
+	Since   *time.Time       `json:"since"`
+	First   *int             `json:"first"`
+	Skip    *int             `json:"skip"`
+	Changes []*models.Change `json:"changes"`
+	// Next is the time to list Changes since on the next sync, if Since is
+	// given: the time of the last Change listed, or Since if none are.
+	Next *time.Time `json:"next,omitempty"`
+}
+
+// ChangeFeedDocs describes the public change feed to API consumers.
+type ChangeFeedDocs struct {
+	Path        string            `json:"path"`
+	Description string            `json:"description"`
+	Types       []string          `json:"types"`
+	Actions     []string          `json:"actions"`
+	Parameters  map[string]string `json:"parameters"`
+}
+
+// NewChangeFeedHandler returns a GET endpoint handler that lists the recorded
+// Changes of the given public entity types. Changes to entities of any other
+// type, such as those owned by Users, are never included. If the since query
+// parameter is given, only Changes recorded after it are listed, oldest
+// first, so that offline clients can sync incrementally.
+func NewChangeFeedHandler(
+	path []string, ds *graphql.DataService, public []string,
+) web.Handler {
+	isPublic := make(map[string]bool, len(public))
+	for _, b := range public {
+		isPublic[b] = true
+	}
+
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			first, err := web.ParseQueryInt("first", r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+				return
+			}
+			skip, err := web.ParseQueryInt("skip", r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+				return
+			}
+
+			since, err := web.ParseQueryTime("since", r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+				return
+			}
+
+			var typ *string
+			if t := r.URL.Query().Get("type"); t != "" {
+				if !isPublic[t] {
+					web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing,
+						fmt.Errorf("type %q: %w", t, errors.New("not a public entity type")), w)
+					return
+				}
+				typ = &t
+			}
+
+			var list []*models.Change
+			err = ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				ser := ds.ChangeService
+				keep := func(c *models.Change) bool {
+					if typ != nil {
+						return c.Bucket == *typ
+					}
+					return isPublic[c.Bucket]
+				}
+				if since != nil {
+					list, err = ser.GetSince(*since, first, skip, tx, keep)
+				} else {
+					list, err = ser.GetFilter(first, skip, tx, keep)
+				}
+				if err != nil {
+					return fmt.Errorf("failed to get Changes: %w", err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			feed := ChangeFeed{
+				Type:    typ,
+				Since:   since,
+				First:   first,
+				Skip:    skip,
+				Changes: list,
+			}
+			if since != nil {
+				feed.Next = since
+				if len(list) > 0 {
+					feed.Next = &list[len(list)-1].Meta.CreatedAt
+				}
+			}
+			web.EncodeResponseBody(feed, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewChangeFeedDocsHandler returns a GET endpoint handler that describes the
+// change feed served at the given feed path.
+func NewChangeFeedDocsHandler(
+	path []string, feedPath string, public []string,
+) web.Handler {
+	docs := ChangeFeedDocs{
+		Path: feedPath,
+		Description: "A paginated, chronological feed of creations, updates, " +
+			"and deletions of public catalog entities.",
+		Types: public,
+		Actions: []string{
+			models.ChangeActionCreate.String(),
+			models.ChangeActionUpdate.String(),
+			models.ChangeActionDelete.String(),
+		},
+		Parameters: map[string]string{
+			"type": "Only include changes to entities of this type.",
+			"since": "Only include changes made after this RFC 3339 time, " +
+				"oldest first; pass the next time of the response on the next sync.",
+			"first": "The maximum number of changes to return.",
+			"skip":  "The number of changes to skip before collecting.",
+		},
+	}
+
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			web.EncodeResponseBody(docs, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
@@ -0,0 +1,67 @@
+package naos_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestChangesSince tests that updates keep the creation time of entities and
+// are listed in the changes since a time before them.
+func TestChangesSince(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	mID := refs["bebop"]
+	keep := func(c *models.Change) bool { return c.Bucket == ds.MediaService.Bucket() }
+
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		md, err := ds.MediaService.GetByID(mID, tx)
+		if err != nil {
+			return err
+		}
+		created := md.Meta.CreatedAt
+		since := time.Now()
+
+		md.Meta.CreatedAt = time.Time{}
+		err = ds.MediaService.Update(md, tx)
+		if err != nil {
+			return err
+		}
+
+		md, err = ds.MediaService.GetByID(mID, tx)
+		if err != nil {
+			return err
+		}
+		if !md.Meta.CreatedAt.Equal(created) {
+			t.Errorf("expected creation time %v to be kept, got %v", created, md.Meta.CreatedAt)
+		}
+		if !md.Meta.UpdatedSince(&since) {
+			t.Errorf("expected Media updated since %v, got %v", since, md.Meta.UpdatedAt)
+		}
+
+		list, err := ds.ChangeService.GetSince(since, nil, nil, tx, keep)
+		if err != nil {
+			return err
+		}
+		if len(list) != 1 || list[0].EntityID != mID ||
+			list[0].Action != models.ChangeActionUpdate {
+			t.Errorf("expected a single update of Media %d, got %+v", mID, list)
+		}
+
+		list, err = ds.ChangeService.GetSince(time.Now(), nil, nil, tx, keep)
+		if err != nil {
+			return err
+		}
+		if len(list) != 0 {
+			t.Errorf("expected no Changes since now, got %d", len(list))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
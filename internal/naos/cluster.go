@@ -0,0 +1,76 @@
+package naos
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"github.com/Dophin2009/nao/internal/cluster"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// NewCluster starts the node of the cluster given in the configuration in
+// front of the database of the given data layer, whose writes are committed
+// through the Raft log from then on.
+func NewCluster(c *Configuration, ds *graphql.DataService) (*cluster.Cluster, error) {
+	if len(c.Tenants) > 0 {
+		return nil, errors.New("tenants are not supported in a cluster")
+	}
+	if c.Replication.Primary != "" {
+		return nil, errors.New("followers of a primary cannot be in a cluster")
+	}
+
+	dir := c.Cluster.Dir
+	if dir == "" {
+		dir = filepath.Join(filepath.Dir(c.DB.Path), "raft")
+	}
+	// The writes of each transaction are recorded for as long as it takes
+	// to commit them through the Raft log
+	if !c.Replication.Log {
+		db.RecordReplication(ds.Lifecycle, 0)
+	}
+
+	clu, err := cluster.New(cluster.Config{
+		ID:        c.Cluster.ID,
+		Dir:       dir,
+		Peers:     c.Cluster.Peers,
+		LogOutput: log.StandardLogger().Writer(),
+	}, ds.Database.DatabaseDriver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to join cluster: %w", err)
+	}
+	ds.Database.DatabaseDriver = clu.Database()
+
+	log.WithFields(log.Fields{
+		"id":    c.Cluster.ID,
+		"dir":   dir,
+		"peers": len(c.Cluster.Peers),
+	}).Info("Joined cluster")
+	return clu, nil
+}
+
+// NewClusterStatusHandler returns a GET endpoint handler that shows Admins
+// the state of the node of the cluster serving the request, which is never
+// forwarded to the leader.
+func NewClusterStatusHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+	clu *cluster.Cluster,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			if !authorizeRole(w, r, ds, au, models.RoleAdmin) {
+				return
+			}
+			web.EncodeResponseBody(clu.Status(), w)
+		},
+	}
+}
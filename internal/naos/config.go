@@ -1,38 +1,849 @@
 package naos
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/adrg/xdg"
+	"github.com/Dophin2009/nao/internal/cluster"
 	"github.com/Dophin2009/nao/internal/config"
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/mail"
+	"github.com/Dophin2009/nao/internal/script"
+	"github.com/Dophin2009/nao/internal/trace"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
 )
 
 // Configuration contains config properties read from config files.
 type Configuration struct {
 	Hostname string `mapstructure:"hostname"`
 	Port     string `mapstructure:"port"`
-	DB       struct {
+	// GRPCPort is the port the gRPC API is served on; disabled if unset.
+	GRPCPort string `mapstructure:"grpcport"`
+	// BasePath is the path prefix the API is served under, such as /nao,
+	// behind a reverse proxy that passes on requests under it with their
+	// paths unchanged; served at the root if unset. The HTTP addresses of the
+	// peers of a cluster include it.
+	BasePath string `mapstructure:"basepath"`
+	// Proxies configures the reverse proxies the server is served behind.
+	Proxies struct {
+		// Trusted are the IP addresses and CIDR ranges, such as 10.0.0.0/8,
+		// of the proxies trusted to give the addresses of clients in the
+		// X-Forwarded-For header, which are used in place of theirs, such as
+		// in login sessions. Proxies connecting over Unix domain sockets are
+		// always trusted.
+		Trusted []string `mapstructure:"trusted"`
+	} `mapstructure:"proxies"`
+	// Frontend configures serving a static frontend, such as a single-page
+	// application, alongside the API of the default database.
+	Frontend struct {
+		// Dir is the directory of the files of the frontend, with index.html
+		// at its root, served for browser navigations to other paths;
+		// disabled if unset.
+		Dir string `mapstructure:"dir"`
+		// Exclude are the path prefixes left to the API; defaults to /api and
+		// /graphql.
+		Exclude []string `mapstructure:"exclude"`
+		// MaxAge is how long the files other than index.html are cached for;
+		// defaults to an hour.
+		MaxAge time.Duration `mapstructure:"maxage"`
+	} `mapstructure:"frontend"`
+	// Listen configures serving the HTTP API on a Unix domain socket or a
+	// socket passed by systemd, instead of on Hostname and Port, such as
+	// behind a reverse proxy on the same host.
+	Listen struct {
+		// Socket is the path of the Unix domain socket; disabled if unset.
+		Socket string `mapstructure:"socket"`
+		// SocketMode is the file mode of the socket; defaults to 0660.
+		SocketMode uint32 `mapstructure:"socketmode"`
+		// Systemd serves on a socket passed by systemd socket activation,
+		// that of SystemdName if set, as in FileDescriptorName= of the socket
+		// unit, or else the first.
+		Systemd     bool   `mapstructure:"systemd"`
+		SystemdName string `mapstructure:"systemdname"`
+	} `mapstructure:"listen"`
+	DB struct {
 		Path     string `mapstructure:"path"`
 		Filemode uint32 `mapstructure:"filemode"`
+		// Codec is the name of the encoding used for records in all buckets
+		// without an entry in BucketCodecs; defaults to "json".
+		Codec        string            `mapstructure:"codec"`
+		BucketCodecs map[string]string `mapstructure:"bucketcodecs"`
+		// IDGenerator is the name of the ID assignment strategy for all
+		// buckets without an entry in BucketIDGenerators; defaults to
+		// "sequence".
+		IDGenerator        string            `mapstructure:"idgenerator"`
+		BucketIDGenerators map[string]string `mapstructure:"bucketidgenerators"`
+		// Node is the number of this instance among federated instances,
+		// used in snowflake IDs.
+		Node int `mapstructure:"node"`
+		// KeyEncoding is the name of the encoding of the IDs of records as
+		// their keys in buckets, "binary" or "string"; defaults to "binary".
+		// Databases keyed in another encoding must be re-keyed by naosmigrate.
+		KeyEncoding string `mapstructure:"keyencoding"`
+		// Cache configures the in-memory read cache; disabled if Size is 0.
+		Cache struct {
+			Size int           `mapstructure:"size"`
+			TTL  time.Duration `mapstructure:"ttl"`
+		} `mapstructure:"cache"`
+		// Snapshots configures periodic snapshots of the database; disabled if
+		// Interval is 0.
+		Snapshots struct {
+			Interval time.Duration `mapstructure:"interval"`
+			Retain   int           `mapstructure:"retain"`
+			Dir      string        `mapstructure:"dir"`
+		} `mapstructure:"snapshots"`
+		// SeedDir is a directory of fixtures files loaded into the empty
+		// buckets of the database at startup, and by the seed command if
+		// given no files; disabled if unset.
+		SeedDir string `mapstructure:"seeddir"`
+		// VerifyBuckets refuses to start on a database missing some of its
+		// buckets, rather than creating them; naos fsck -fix creates them.
+		VerifyBuckets bool `mapstructure:"verifybuckets"`
+		// ScanWorkers is the number of goroutines that unmarshal and filter
+		// the records of large buckets in analytical scans, such as the
+		// recomputation of statistics and trends; defaults to the number of
+		// CPUs, and 1 scans serially.
+		ScanWorkers int `mapstructure:"scanworkers"`
 	} `mapstructure:"db"`
+	JWT struct {
+		// EnvPath is the path to the .env file containing the secret key used
+		// to sign authentication tokens; tokens are rejected if unset.
+		EnvPath string `mapstructure:"envpath"`
+		// TokenDuration is how long issued tokens are valid for; defaults to
+		// an hour.
+		TokenDuration time.Duration `mapstructure:"tokenduration"`
+	} `mapstructure:"jwt"`
+	// Access configures which routes anonymous callers are served.
+	Access struct {
+		// PublicReadOnly serves anonymous callers only the read-only public
+		// API of PublicRoutes, such as Media, People and public lists, and
+		// requires credentials for all other routes. GraphQL is served to
+		// anonymous callers for queries only.
+		PublicReadOnly bool `mapstructure:"publicreadonly"`
+	} `mapstructure:"access"`
+	Scrobble struct {
+		// SessionGap is the longest pause between playback events stitched
+		// into the same watch.
+		SessionGap time.Duration `mapstructure:"sessiongap"`
+	} `mapstructure:"scrobble"`
+	Library struct {
+		// StaleAfter is the duration without progress after which entries
+		// being watched are reported as stale.
+		StaleAfter time.Duration `mapstructure:"staleafter"`
+	} `mapstructure:"library"`
+	Import struct {
+		// BatchSize is the largest number of staged entries of list imports
+		// written at once, and Interval the duration between batches;
+		// defaults to DefaultImportBatchSize and DefaultImportInterval.
+		BatchSize int           `mapstructure:"batchsize"`
+		Interval  time.Duration `mapstructure:"interval"`
+	} `mapstructure:"import"`
+	Activity struct {
+		// FeedSize is the number of most recent Activities kept per User.
+		FeedSize int `mapstructure:"feedsize"`
+	} `mapstructure:"activity"`
+	Lock struct {
+		// TTL is how long Locks on entities are held for if not requested,
+		// and MaxTTL the longest that may be requested; default to
+		// DefaultLockTTL and DefaultLockMaxTTL.
+		TTL    time.Duration `mapstructure:"ttl"`
+		MaxTTL time.Duration `mapstructure:"maxttl"`
+	} `mapstructure:"lock"`
+	Order struct {
+		// TitleLanguages are the language ranges Media are kept sorted by
+		// Title in; defaults to DefaultOrderTitleLanguages.
+		TitleLanguages []string `mapstructure:"titlelanguages"`
+	} `mapstructure:"order"`
+	Trending struct {
+		// Interval is the duration between computations of the trending
+		// Media; they are computed once on first use if 0.
+		Interval time.Duration `mapstructure:"interval"`
+		// Window is the period of activity counted in trends.
+		Window time.Duration `mapstructure:"window"`
+	} `mapstructure:"trending"`
+	Refresh struct {
+		// Interval is the duration between refreshes of the metadata of the
+		// Media linked to AniList and TMDB by their ExternalIDs; disabled if
+		// 0.
+		Interval time.Duration `mapstructure:"interval"`
+		// Delay is the duration waited between fetches of metadata.
+		Delay time.Duration `mapstructure:"delay"`
+		// AniListURL is the URL of the GraphQL API of AniList.
+		AniListURL string `mapstructure:"anilisturl"`
+		// TMDBURL is the base URL of the API of The Movie Database, and
+		// TMDBAPIKey the API key requests are authorized with; Media of TMDB
+		// are not refreshed if unset.
+		TMDBURL    string `mapstructure:"tmdburl"`
+		TMDBAPIKey string `mapstructure:"tmdbapikey"`
+	} `mapstructure:"refresh"`
+	Notifications struct {
+		// AiringInterval is the duration between checks for newly aired
+		// Episodes to notify Users of; disabled if 0.
+		AiringInterval time.Duration `mapstructure:"airinginterval"`
+	} `mapstructure:"notifications"`
+	Mail struct {
+		// Host and Port are the SMTP server messages are sent through; mail
+		// is disabled if Host is unset, unless DryRun.
+		Host     string `mapstructure:"host"`
+		Port     string `mapstructure:"port"`
+		Username string `mapstructure:"username"`
+		Password string `mapstructure:"password"`
+		// From is the address messages are sent from.
+		From string `mapstructure:"from"`
+		// DryRun logs messages instead of sending them.
+		DryRun bool `mapstructure:"dryrun"`
+		// QueueSize is the number of messages waiting to be sent that are
+		// held, and Retries the number of times failed deliveries are
+		// retried, after RetryDelay, doubled with each retry.
+		QueueSize  int           `mapstructure:"queuesize"`
+		Retries    int           `mapstructure:"retries"`
+		RetryDelay time.Duration `mapstructure:"retrydelay"`
+		// ResetURL is the address of the page Users reset their password
+		// at, given the token in the token query parameter; the token is
+		// sent by itself if unset.
+		ResetURL string `mapstructure:"reseturl"`
+		// ResetDuration is how long password reset tokens are valid for;
+		// defaults to an hour.
+		ResetDuration time.Duration `mapstructure:"resetduration"`
+		// DigestInterval is the duration between digests of aired Episodes
+		// sent to Users; disabled if 0.
+		DigestInterval time.Duration `mapstructure:"digestinterval"`
+	} `mapstructure:"mail"`
+	Tracing struct {
+		// Endpoint is the URL of the OpenTelemetry collector spans are
+		// exported to over OTLP/HTTP, such as http://localhost:4318/v1/traces;
+		// tracing is disabled if unset.
+		Endpoint string `mapstructure:"endpoint"`
+		// ServiceName is the name spans are reported under; defaults to
+		// "naos".
+		ServiceName string `mapstructure:"servicename"`
+		// Headers are sent with each export, such as for authentication.
+		Headers map[string]string `mapstructure:"headers"`
+		// FlushInterval is the longest time finished spans wait to be
+		// exported.
+		FlushInterval time.Duration `mapstructure:"flushinterval"`
+	} `mapstructure:"tracing"`
+	Relations struct {
+		// Inverses maps relationships of MediaRelations to those of the
+		// inverses created with them, overriding the defaults such as
+		// Prequel for Sequel. Each relationship must be the inverse of its
+		// inverse.
+		Inverses map[string]string `mapstructure:"inverses"`
+	} `mapstructure:"relations"`
+	OIDC struct {
+		// Providers are the OpenID Connect identity providers Users may log
+		// in with, by the name used in login paths.
+		Providers map[string]OIDCProviderConfig `mapstructure:"providers"`
+		// LoginDuration is how long Users have to complete logins at
+		// providers; defaults to 10 minutes.
+		LoginDuration time.Duration `mapstructure:"loginduration"`
+	} `mapstructure:"oidc"`
+	GraphQL struct {
+		// AllowlistOnly restricts callers other than Admins to the persisted
+		// queries registered by Admins, sent by hash.
+		AllowlistOnly bool `mapstructure:"allowlistonly"`
+	} `mapstructure:"graphql"`
+	// Errors configures the error responses of the REST API.
+	Errors struct {
+		// Debug includes the detail of internal server errors in error
+		// responses, for development; they are only logged otherwise.
+		Debug bool `mapstructure:"debug"`
+		// Sentry reports the panics recovered from handlers to the Sentry
+		// project of DSN, tagged with Environment; disabled if DSN is unset.
+		Sentry struct {
+			DSN         string `mapstructure:"dsn"`
+			Environment string `mapstructure:"environment"`
+		} `mapstructure:"sentry"`
+	} `mapstructure:"errors"`
+	// Timeouts configures how long requests to the REST API are served for
+	// before their database scans are stopped and they are responded to with
+	// 503 Service Unavailable.
+	Timeouts struct {
+		// Default is the timeout of the routes without one in Routes;
+		// defaults to 30 seconds, and 0 disables it.
+		Default time.Duration `mapstructure:"default"`
+		// Routes are the timeouts of single routes by method and path as
+		// registered, such as "GET /media/:id"; 0 disables the timeout of a
+		// route.
+		Routes map[string]time.Duration `mapstructure:"routes"`
+	} `mapstructure:"timeouts"`
+	// Compression configures the compression of response bodies.
+	Compression struct {
+		// Disabled turns compression off.
+		Disabled bool `mapstructure:"disabled"`
+		// MinSize is the size in bytes of the smallest body compressed;
+		// defaults to 1 KiB.
+		MinSize int `mapstructure:"minsize"`
+		// ContentTypes are the media types of the bodies compressed;
+		// defaults to JSON, XML, MessagePack, CSV and plain text.
+		ContentTypes []string `mapstructure:"contenttypes"`
+	} `mapstructure:"compression"`
+	// Normalize configures the normalization of the strings and dates of
+	// entities as they are written.
+	Normalize struct {
+		// DisableUnicode leaves strings in the Unicode normalization form they
+		// are given in, rather than putting them in NFC.
+		DisableUnicode bool `mapstructure:"disableunicode"`
+		// MinYear and MaxYear bound the years of dates; default to 1800 and
+		// 2200.
+		MinYear int `mapstructure:"minyear"`
+		MaxYear int `mapstructure:"maxyear"`
+	} `mapstructure:"normalize"`
+	// Maintenance configures maintenance mode, in which writes are refused;
+	// Admins may switch it at runtime.
+	Maintenance struct {
+		// Enabled starts the server in maintenance mode.
+		Enabled bool `mapstructure:"enabled"`
+		// RetryAfter is how long callers are told to wait before retrying
+		// refused writes; defaults to 5 minutes.
+		RetryAfter time.Duration `mapstructure:"retryafter"`
+	} `mapstructure:"maintenance"`
+	// Scripts configures the Lua scripts of operators called on the
+	// lifecycle events of public entities and as webhooks.
+	Scripts struct {
+		// Dir is the directory of the scripts; disabled if unset.
+		Dir string `mapstructure:"dir"`
+		// Timeout is the longest a script may run for each call; defaults to
+		// 5 seconds.
+		Timeout time.Duration `mapstructure:"timeout"`
+	} `mapstructure:"scripts"`
+	// Replication configures the replication of the database to followers
+	// serving reads.
+	Replication struct {
+		// Log records the writes to the database in the replication log
+		// followers pull.
+		Log bool `mapstructure:"log"`
+		// Retain is the number of entries kept in the log; defaults to
+		// 100000.
+		Retain int `mapstructure:"retain"`
+		// Primary is the base URL of the API of the primary this instance
+		// follows, refusing writes of its own; disabled if unset.
+		Primary string `mapstructure:"primary"`
+		// APIKey is an API key of an Admin of the primary.
+		APIKey string `mapstructure:"apikey"`
+		// Interval is the duration between pulls of the log of the
+		// primary; defaults to 5 seconds.
+		Interval time.Duration `mapstructure:"interval"`
+	} `mapstructure:"replication"`
+	// Cluster runs the instance as a node of a cluster whose writes are
+	// committed through a Raft log, for high availability.
+	Cluster struct {
+		// ID is the ID of the node among Peers; disabled if unset.
+		ID string `mapstructure:"id"`
+		// Dir is the directory of the Raft log and snapshots of the node;
+		// defaults to a raft directory beside the database.
+		Dir string `mapstructure:"dir"`
+		// Peers are all the nodes of the cluster, including this one, by
+		// ID.
+		Peers map[string]cluster.Peer `mapstructure:"peers"`
+	} `mapstructure:"cluster"`
+	// Tenants are the isolated databases served alongside the default one,
+	// by name.
+	Tenants map[string]TenantConfig `mapstructure:"tenants"`
+
+	// tenant is the name of the tenant the configuration is of, and
+	// pathPrefix the path prefix it is served under; both are empty for the
+	// default database.
+	tenant     string
+	pathPrefix string
+}
+
+// basePath returns the path prefix the API is served under, with a leading
+// slash and without a trailing one, or an empty string if served at the
+// root.
+func (c *Configuration) basePath() string {
+	p := strings.Trim(c.BasePath, "/")
+	if p == "" {
+		return ""
+	}
+	return "/" + p
+}
+
+// TenantConfig configures a tenant, an isolated database served alongside
+// the default one, such as that of a single community.
+type TenantConfig struct {
+	// Hosts are the hostnames of the requests served by the tenant.
+	Hosts []string `mapstructure:"hosts"`
+	// Prefix is the path prefix of the requests served by the tenant, such
+	// as /c/anime, which is stripped before they are routed.
+	Prefix string `mapstructure:"prefix"`
+	DB     struct {
+		// Path is the path of the database file; defaults to the name of the
+		// tenant with the .db extension in a tenants directory beside the
+		// default database.
+		Path string `mapstructure:"path"`
+		// Filemode defaults to that of the default database.
+		Filemode uint32 `mapstructure:"filemode"`
+		// SeedDir is a directory of fixtures files loaded into the empty
+		// buckets of the database when opened; disabled if unset.
+		SeedDir string `mapstructure:"seeddir"`
+		// CacheSize is the size of the in-memory read cache; defaults to that
+		// of the default database.
+		CacheSize int `mapstructure:"cachesize"`
+	} `mapstructure:"db"`
+	// AllowlistOnly restricts the GraphQL API as for the default database,
+	// whose setting is used if unset.
+	AllowlistOnly *bool `mapstructure:"allowlistonly"`
+	// Maintenance starts the tenant in maintenance mode; each tenant is
+	// switched in and out of it by itself.
+	Maintenance bool `mapstructure:"maintenance"`
+}
+
+// OIDCProviderConfig configures an OpenID Connect identity provider.
+type OIDCProviderConfig struct {
+	// Issuer is the URL of the provider its configuration is discovered
+	// from.
+	Issuer       string `mapstructure:"issuer"`
+	ClientID     string `mapstructure:"clientid"`
+	ClientSecret string `mapstructure:"clientsecret"`
+	// RedirectURL is the address registered with the provider that Users are
+	// sent back to, which passes the code and state query parameters on to
+	// the callback endpoint.
+	RedirectURL string `mapstructure:"redirecturl"`
+	// Scopes are the scopes requested; defaults to openid, profile and
+	// email.
+	Scopes []string `mapstructure:"scopes"`
 }
 
 // ReadConfigs returns a Configuration object with configuration properties
-// read from standard directories.
+// read from standard directories, over ConfigDefaults. The files may be YAML,
+// TOML or JSON, and unknown keys and invalid values are errors naming them.
 func ReadConfigs() (*Configuration, error) {
 	filename := "naos"
 
 	var conf Configuration
-	err := config.ReadConfigs(filename, ConfigDirs(), &conf)
+	err := config.ReadConfigs(filename, ConfigDirs(), ConfigDefaults(), &conf)
 	if err != nil {
 		return nil,
 			fmt.Errorf("failed to read config files %q: %w", filename+".*", err)
 	}
 
+	err = conf.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
 	return &conf, nil
 }
 
+// ReadConfigFile returns a Configuration object with configuration
+// properties read from the file at the given path, as ReadConfigs does.
+func ReadConfigFile(path string) (*Configuration, error) {
+	var conf Configuration
+	err := config.ReadConfigFile(path, ConfigDefaults(), &conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %q: %w", path, err)
+	}
+
+	err = conf.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return &conf, nil
+}
+
+// ConfigDefaults returns the values of the configuration properties not set
+// in config files, by key.
+func ConfigDefaults() map[string]interface{} {
+	return map[string]interface{}{
+		"frontend.exclude":         web.DefaultFrontendExclude,
+		"frontend.maxage":          web.DefaultFrontendMaxAge,
+		"listen.socketmode":        0660,
+		"db.filemode":              0600,
+		"db.codec":                 "json",
+		"db.idgenerator":           "sequence",
+		"db.keyencoding":           "binary",
+		"jwt.tokenduration":        DefaultTokenDuration,
+		"scrobble.sessiongap":      data.DefaultScrobbleSessionGap,
+		"library.staleafter":       data.DefaultLibraryStaleAfter,
+		"import.batchsize":         DefaultImportBatchSize,
+		"import.interval":          DefaultImportInterval,
+		"activity.feedsize":        data.DefaultActivityFeedSize,
+		"lock.ttl":                 DefaultLockTTL,
+		"lock.maxttl":              DefaultLockMaxTTL,
+		"order.titlelanguages":     DefaultOrderTitleLanguages,
+		"trending.window":          data.DefaultTrendingWindow,
+		"refresh.delay":            DefaultRefreshDelay,
+		"refresh.anilisturl":       DefaultAniListURL,
+		"refresh.tmdburl":          DefaultTMDBURL,
+		"mail.port":                "25",
+		"mail.queuesize":           mail.DefaultQueueSize,
+		"mail.retrydelay":          mail.DefaultRetryDelay,
+		"mail.resetduration":       DefaultResetDuration,
+		"tracing.servicename":      "naos",
+		"tracing.flushinterval":    trace.DefaultFlushInterval,
+		"oidc.loginduration":       DefaultOIDCLoginDuration,
+		"compression.minsize":      web.DefaultCompressionMinSize,
+		"compression.contenttypes": web.DefaultCompressionContentTypes,
+		"normalize.minyear":        data.DefaultMinYear,
+		"normalize.maxyear":        data.DefaultMaxYear,
+		"maintenance.retryafter":   web.DefaultMaintenanceRetryAfter,
+		"timeouts.default":         web.DefaultTimeout,
+		"scripts.timeout":          script.DefaultTimeout,
+		"replication.retain":       DefaultReplicationRetain,
+		"replication.interval":     DefaultReplicationInterval,
+	}
+}
+
+// Validate checks the configuration, returning a ValidationError whose paths
+// are the keys of the invalid properties, such as "db.codec", if any are
+// invalid.
+func (c *Configuration) Validate() error {
+	var verr db.ValidationError
+	validateNonNegative(reflect.ValueOf(c).Elem(), "", &verr)
+
+	validatePort(c.Port, "port", &verr)
+	validatePort(c.GRPCPort, "grpcport", &verr)
+	validatePort(c.Mail.Port, "mail.port", &verr)
+
+	if c.Listen.Socket != "" && c.Listen.Systemd {
+		verr.Add("listen.socket", db.FieldInvalid, "must not be set with listen.systemd")
+	}
+	if c.Listen.SystemdName != "" && !c.Listen.Systemd {
+		verr.Add("listen.systemdname", db.FieldInvalid, "must not be set without listen.systemd")
+	}
+
+	if strings.ContainsAny(c.BasePath, "?#") {
+		verr.Addf("basepath", db.FieldInvalid, "%q is not a path", c.BasePath)
+	}
+	for i, p := range c.Frontend.Exclude {
+		if !strings.HasPrefix(p, "/") {
+			verr.Addf(fmt.Sprintf("frontend.exclude[%d]", i), db.FieldInvalid,
+				"%q is not an absolute path", p)
+		}
+	}
+	for i, p := range c.Proxies.Trusted {
+		_, err := web.NewProxies([]string{p})
+		if err != nil {
+			verr.Addf(fmt.Sprintf("proxies.trusted[%d]", i), db.FieldInvalid,
+				"%q is not an IP address or CIDR range", p)
+		}
+	}
+	if c.DB.Path == "" {
+		verr.Add("db.path", db.FieldRequired, "must be set")
+	}
+	validateCodec := func(name, key string) {
+		_, err := db.CodecByName(name)
+		if err != nil {
+			verr.Addf(key, db.FieldInvalid, "unknown codec %q", name)
+		}
+	}
+	validateCodec(c.DB.Codec, "db.codec")
+	for _, bucket := range sortedKeys(c.DB.BucketCodecs) {
+		validateCodec(c.DB.BucketCodecs[bucket], "db.bucketcodecs."+bucket)
+	}
+	snowflake := false
+	validateIDGenerator := func(name, key string) {
+		_, err := db.IDGeneratorByName(name, 0)
+		if err != nil {
+			verr.Addf(key, db.FieldInvalid, "unknown id generator %q", name)
+		}
+		snowflake = snowflake || name == "snowflake"
+	}
+	validateIDGenerator(c.DB.IDGenerator, "db.idgenerator")
+	for _, bucket := range sortedKeys(c.DB.BucketIDGenerators) {
+		validateIDGenerator(c.DB.BucketIDGenerators[bucket], "db.bucketidgenerators."+bucket)
+	}
+	if _, err := db.NewSnowflakeIDGenerator(c.DB.Node); snowflake && err != nil {
+		verr.Addf("db.node", db.FieldOutOfRange, "%d is not a snowflake node", c.DB.Node)
+	}
+	if _, err := db.KeyEncodingByName(c.DB.KeyEncoding); err != nil {
+		verr.Addf("db.keyencoding", db.FieldInvalid, "unknown key encoding %q", c.DB.KeyEncoding)
+	}
+
+	if c.Lock.MaxTTL < c.Lock.TTL {
+		verr.Add("lock.maxttl", db.FieldOutOfRange, "must not be less than lock.ttl")
+	}
+	if c.Normalize.MaxYear < c.Normalize.MinYear {
+		verr.Add("normalize.maxyear", db.FieldOutOfRange,
+			"must not be less than normalize.minyear")
+	}
+	if c.Mail.Host != "" && c.Mail.From == "" {
+		verr.Add("mail.from", db.FieldRequired, "must be set if mail.host is")
+	}
+	validateURL(c.Mail.ResetURL, "mail.reseturl", &verr)
+	validateURL(c.Tracing.Endpoint, "tracing.endpoint", &verr)
+	if c.Errors.Sentry.DSN != "" {
+		_, err := web.NewSentryReporter(c.Errors.Sentry.DSN)
+		if err != nil {
+			verr.Add("errors.sentry.dsn", db.FieldInvalid, "is not a Sentry DSN")
+		}
+	}
+	for _, route := range sortedKeys(c.Timeouts.Routes) {
+		_, err := web.ParseTimeoutRoute(route)
+		if err != nil {
+			verr.Addf("timeouts.routes."+route, db.FieldInvalid,
+				"%q is not a method and path", route)
+		}
+	}
+	validateURL(c.Refresh.AniListURL, "refresh.anilisturl", &verr)
+	validateURL(c.Refresh.TMDBURL, "refresh.tmdburl", &verr)
+	validateURL(c.Replication.Primary, "replication.primary", &verr)
+	if c.Replication.Primary != "" && c.Replication.APIKey == "" {
+		verr.Add("replication.apikey", db.FieldRequired, "must be set if replication.primary is")
+	}
+	if c.Cluster.ID != "" {
+		if _, ok := c.Cluster.Peers[c.Cluster.ID]; !ok {
+			verr.Addf("cluster.peers", db.FieldRequired, "must include cluster.id %q", c.Cluster.ID)
+		}
+	}
+
+	for _, name := range sortedKeys(c.OIDC.Providers) {
+		pc, key := c.OIDC.Providers[name], "oidc.providers."+name
+		if pc.Issuer == "" {
+			verr.Add(key+".issuer", db.FieldRequired, "must be set")
+		}
+		validateURL(pc.Issuer, key+".issuer", &verr)
+		if pc.ClientID == "" {
+			verr.Add(key+".clientid", db.FieldRequired, "must be set")
+		}
+		validateURL(pc.RedirectURL, key+".redirecturl", &verr)
+	}
+	for _, name := range sortedKeys(c.Tenants) {
+		tc, key := c.Tenants[name], "tenants."+name
+		if name == "" || data.Slugify(name) != name {
+			verr.Add(key, db.FieldInvalid, "name must be a slug")
+		}
+		if len(tc.Hosts) == 0 && strings.Trim(tc.Prefix, "/") == "" {
+			verr.Add(key, db.FieldRequired, "must have hosts or a prefix")
+		}
+	}
+
+	_, err := RelationInverses(c)
+	if err != nil {
+		verr.Add("relations.inverses", db.FieldInvalid, strings.TrimSuffix(
+			err.Error(), ": "+db.ErrInvalid.Error()))
+	}
+	return verr.Err()
+}
+
+// validateNonNegative adds problems with the numbers and durations of the
+// given value of the configuration that are negative, named by their keys
+// under the given one.
+func validateNonNegative(v reflect.Value, key string, verr *db.ValidationError) {
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			name, ok := sf.Tag.Lookup("mapstructure")
+			if !ok || sf.PkgPath != "" {
+				continue
+			}
+			validateNonNegative(v.Field(i), configKey(key, name), verr)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+		})
+		for _, k := range keys {
+			validateNonNegative(v.MapIndex(k), configKey(key, fmt.Sprint(k)), verr)
+		}
+	case reflect.Ptr:
+		if !v.IsNil() {
+			validateNonNegative(v.Elem(), key, verr)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Int() < 0 {
+			verr.Add(key, db.FieldOutOfRange, "must not be negative")
+		}
+	}
+}
+
+// validatePort adds a problem with the port of the given key unless it is
+// unset or a port number.
+func validatePort(port, key string, verr *db.ValidationError) {
+	if port == "" {
+		return
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		verr.Addf(key, db.FieldInvalid, "%q is not a port number", port)
+	}
+}
+
+// validateURL adds a problem with the URL of the given key unless it is
+// unset or an absolute HTTP URL.
+func validateURL(s, key string, verr *db.ValidationError) {
+	if s == "" {
+		return
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		verr.Addf(key, db.FieldInvalid, "%q is not an HTTP URL", s)
+	}
+}
+
+// configKey returns the key of the property of the given name under the
+// given key.
+func configKey(key, name string) string {
+	if key == "" {
+		return name
+	}
+	return key + "." + name
+}
+
+// sortedKeys returns the keys of the given map of configuration properties
+// in order, so that problems are reported in a stable order.
+func sortedKeys(m interface{}) []string {
+	keys := []string{}
+	for _, k := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// TenantConfiguration returns the configuration of the tenant of the given
+// name: that of the default database with the database and settings of the
+// tenant. The gRPC API, tracing, mail, snapshots, replication, clustering
+// and the background schedulers are only run for the default database.
+func (c *Configuration) TenantConfiguration(name string) (*Configuration, error) {
+	tc, ok := c.Tenants[name]
+	if !ok {
+		return nil, fmt.Errorf("tenant %q: %w", name, errors.New("not configured"))
+	}
+
+	conf := *c
+	conf.tenant = name
+	conf.pathPrefix = tc.Prefix
+	conf.Tenants = nil
+	conf.GRPCPort = ""
+
+	conf.DB.Path = tc.DB.Path
+	if conf.DB.Path == "" {
+		conf.DB.Path = filepath.Join(filepath.Dir(c.DB.Path), "tenants", name+".db")
+	}
+	if tc.DB.Filemode != 0 {
+		conf.DB.Filemode = tc.DB.Filemode
+	}
+	conf.DB.SeedDir = tc.DB.SeedDir
+	if tc.DB.CacheSize != 0 {
+		conf.DB.Cache.Size = tc.DB.CacheSize
+	}
+	conf.DB.Snapshots.Interval = 0
+
+	if tc.AllowlistOnly != nil {
+		conf.GraphQL.AllowlistOnly = *tc.AllowlistOnly
+	}
+	conf.Maintenance.Enabled = tc.Maintenance
+
+	conf.Tracing.Endpoint = ""
+	conf.Mail.Host = ""
+	conf.Mail.DryRun = false
+	conf.Notifications.AiringInterval = 0
+	conf.Trending.Interval = 0
+	conf.Refresh.Interval = 0
+	conf.Replication.Log = false
+	conf.Replication.Primary = ""
+	conf.Cluster.ID = ""
+	return &conf, nil
+}
+
+// ConfigureCodecs selects the encodings of database records as given in the
+// configuration.
+func ConfigureCodecs(c *Configuration) error {
+	codecs := &db.CodecSet{
+		Default: db.JSONCodec{},
+		Buckets: map[string]db.Codec{},
+	}
+
+	if c.DB.Codec != "" {
+		codec, err := db.CodecByName(c.DB.Codec)
+		if err != nil {
+			return fmt.Errorf("failed to select default codec: %w", err)
+		}
+		codecs.Default = codec
+	}
+
+	for bucket, name := range c.DB.BucketCodecs {
+		codec, err := db.CodecByName(name)
+		if err != nil {
+			return fmt.Errorf("failed to select codec for bucket %q: %w", bucket, err)
+		}
+		codecs.Buckets[bucket] = codec
+	}
+
+	db.Codecs = codecs
+	return nil
+}
+
+// ConfigureIDGenerators selects the ID assignment strategies of database
+// buckets as given in the configuration.
+func ConfigureIDGenerators(c *Configuration) error {
+	gens := &db.IDGeneratorSet{
+		Default: db.SequenceIDGenerator{},
+		Buckets: map[string]db.IDGenerator{},
+	}
+
+	if c.DB.IDGenerator != "" {
+		gen, err := db.IDGeneratorByName(c.DB.IDGenerator, c.DB.Node)
+		if err != nil {
+			return fmt.Errorf("failed to select default id generator: %w", err)
+		}
+		gens.Default = gen
+	}
+
+	// Buckets share a single snowflake generator, as its IDs are unique
+	// across buckets anyway
+	var snowflake db.IDGenerator
+	if c.DB.IDGenerator == "snowflake" {
+		snowflake = gens.Default
+	}
+	for bucket, name := range c.DB.BucketIDGenerators {
+		if name == "snowflake" && snowflake != nil {
+			gens.Buckets[bucket] = snowflake
+			continue
+		}
+
+		gen, err := db.IDGeneratorByName(name, c.DB.Node)
+		if err != nil {
+			return fmt.Errorf("failed to select id generator for bucket %q: %w",
+				bucket, err)
+		}
+		if name == "snowflake" {
+			snowflake = gen
+		}
+		gens.Buckets[bucket] = gen
+	}
+
+	db.IDGenerators = gens
+	return nil
+}
+
+// ConfigureNormalizer selects the normalization of the strings and dates of
+// entities as they are written as given in the configuration.
+func ConfigureNormalizer(c *Configuration) {
+	nc := c.Normalize
+	n := data.NewNormalizer()
+	n.Unicode = !nc.DisableUnicode
+	if nc.MinYear != 0 {
+		n.MinYear = nc.MinYear
+	}
+	if nc.MaxYear != 0 {
+		n.MaxYear = nc.MaxYear
+	}
+	db.ModelNormalizer = n
+}
+
+// ConfigureScanWorkers selects the concurrency of parallel scans as given in
+// the configuration.
+func ConfigureScanWorkers(c *Configuration) {
+	if c.DB.ScanWorkers > 0 {
+		db.ScanWorkers = c.DB.ScanWorkers
+	}
+}
+
 // ConfigDirs returns a list of configuration directories.
 func ConfigDirs() []string {
 	subdir := "nao"
@@ -42,3 +853,42 @@ func ConfigDirs() []string {
 	}
 	return dirs
 }
+
+// RelationInverses returns the inverses of relationships of MediaRelations
+// given in the configuration, which override the defaults. It returns an
+// error if a relationship would not be the inverse of its inverse, as
+// deleting either of a MediaRelation and its inverse would then leave the
+// other.
+func RelationInverses(
+	c *Configuration,
+) (map[models.MediaRelationship]models.MediaRelationship, error) {
+	inverses := make(map[models.MediaRelationship]models.MediaRelationship,
+		len(c.Relations.Inverses))
+	for name, invName := range c.Relations.Inverses {
+		r, err := models.ParseMediaRelationship(name)
+		if err != nil {
+			return nil, fmt.Errorf("relationship: %v: %w", err, db.ErrInvalid)
+		}
+		inv, err := models.ParseMediaRelationship(invName)
+		if err != nil {
+			return nil, fmt.Errorf("inverse of %s: %v: %w", r, err, db.ErrInvalid)
+		}
+		inverses[r] = inv
+	}
+
+	inverse := func(r models.MediaRelationship) models.MediaRelationship {
+		inv, ok := inverses[r]
+		if ok {
+			return inv
+		}
+		return r.Inverse()
+	}
+	for _, r := range models.MediaRelationships {
+		inv := inverse(r)
+		if inverse(inv) != r {
+			return nil, fmt.Errorf("inverse of %s: %s, whose inverse is %s: %w",
+				r, inv, inverse(inv), db.ErrInvalid)
+		}
+	}
+	return inverses, nil
+}
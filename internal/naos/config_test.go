@@ -0,0 +1,59 @@
+package naos_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/naos"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// TestReadConfigFile tests that config files are read over the defaults.
+func TestReadConfigFile(t *testing.T) {
+	c, err := naos.ReadConfigFile("testdata/config.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.DB.Path != "/var/lib/nao/naos.db" || c.DB.Codec != "json" {
+		t.Errorf("expected path of file and default codec, got %+v", c.DB)
+	}
+	if c.Lock.TTL != naos.DefaultLockTTL {
+		t.Errorf("expected default lock TTL, got %s", c.Lock.TTL)
+	}
+	if len(c.Compression.ContentTypes) != 1 {
+		t.Errorf("expected content types of file to replace defaults, got %v",
+			c.Compression.ContentTypes)
+	}
+
+	timeouts, err := naos.NewTimeouts(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timeouts.Default != web.DefaultTimeout || timeouts.Routes["GET /media/:id"] != 2*time.Minute {
+		t.Errorf("expected default timeout and that of route of file, got %+v", timeouts)
+	}
+}
+
+// TestConfigurationValidate tests that every invalid property is reported by
+// its key.
+func TestConfigurationValidate(t *testing.T) {
+	_, err := naos.ReadConfigFile("testdata/config-invalid.toml")
+	var verr *db.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	expected := []string{
+		"mail.retries", "port", "db.path", "db.codec", "lock.maxttl", "mail.from",
+		"timeouts.routes./media",
+	}
+	if len(verr.Fields) != len(expected) {
+		t.Fatalf("expected problems with %v, got %v", expected, verr.Fields)
+	}
+	for i, key := range expected {
+		if verr.Fields[i].Path != key {
+			t.Errorf("expected problem %d with %s, got %v", i, key, verr.Fields[i])
+		}
+	}
+}
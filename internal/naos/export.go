@@ -0,0 +1,354 @@
+package naos
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// Formats of exported lists.
+const (
+	ExportFormatCSV = "csv"
+	ExportFormatTSV = "tsv"
+	// ExportFormatMAL is the XML format of MyAnimeList exports.
+	ExportFormatMAL = "mal"
+)
+
+// exportDateFormat is the format of the dates of exported lists.
+const exportDateFormat = "2006-01-02"
+
+// ListExportEntry is a single UserMedia of an exported list, joined with its
+// Media.
+type ListExportEntry struct {
+	MediaID int
+	Title   string
+	Type    string
+	Status  *models.WatchStatus
+	// Score is the score of the UserMedia in the ScoreFormat of the export.
+	Score     *int
+	Progress  models.Progress
+	StartDate *time.Time
+	EndDate   *time.Time
+	// Rewatches is the number of rewatches of the Media started.
+	Rewatches int
+	Comments  string
+}
+
+// NewListExportHandler returns a GET endpoint handler that streams the
+// UserMedia of the User given by the id path variable, joined with the
+// titles of their Media, in the format given by the format query parameter:
+// csv, the default, tsv or mal. Scores are given in the ScoreFormat of the
+// caller, except for mal exports, which are on a 10-point scale. The lists of
+// the User must be visible to the caller.
+func NewListExportHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			format := strings.ToLower(r.URL.Query().Get("format"))
+			if format == "" {
+				format = ExportFormatCSV
+			}
+			var contentType string
+			switch format {
+			case ExportFormatCSV:
+				contentType = "text/csv; charset=utf-8"
+			case ExportFormatTSV:
+				contentType = "text/tab-separated-values; charset=utf-8"
+			case ExportFormatMAL:
+				contentType = "application/xml; charset=utf-8"
+			default:
+				web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing,
+					fmt.Errorf("format %q: %w", format, data.ErrInvalid), w)
+				return
+			}
+
+			uID, caller, ok := authorizeLibraryView(w, r, ps, ds, au, models.PrivacyLists)
+			if !ok {
+				return
+			}
+			scoreFormat := data.ScoreFormatOf(caller)
+			if format == ExportFormatMAL {
+				scoreFormat = models.ScoreFormatPoint10
+			}
+			langs := models.ParseAcceptLanguage(r.Header.Get(web.HeaderAcceptLanguage))
+
+			var u *models.User
+			var entries []*ListExportEntry
+			err := ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var err error
+				u, err = ds.UserService.GetByID(uID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get User by ID %d: %w", uID, err)
+				}
+				entries, err = ListExport(ds, uID, scoreFormat, langs, tx)
+				return err
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			filename := fmt.Sprintf("%s-list.%s", u.Username, format)
+			if format == ExportFormatMAL {
+				filename = fmt.Sprintf("%s-list.xml", u.Username)
+			}
+			w.Header().Set(web.HeaderContentType, contentType)
+			w.Header().Set("Content-Disposition",
+				fmt.Sprintf("attachment; filename=%q", filename))
+
+			// Headers have already been sent once writing begins, so errors
+			// can only be logged
+			switch format {
+			case ExportFormatCSV:
+				err = WriteListDelimited(w, entries, ',')
+			case ExportFormatTSV:
+				err = WriteListDelimited(w, entries, '\t')
+			case ExportFormatMAL:
+				err = WriteListMAL(w, u, entries)
+			}
+			if err != nil {
+				log.WithFields(log.Fields{
+					"user":   uID,
+					"format": format,
+				}).Errorf("Failed to stream list export: %v", err)
+			}
+		},
+	}
+}
+
+// ListExport returns the UserMedia of the User with the given ID joined with
+// their Media, ordered by title, with scores in the given ScoreFormat and
+// titles chosen for the given language ranges.
+func ListExport(
+	ds *graphql.DataService, uID int, format models.ScoreFormat, langs []string,
+	tx db.Tx,
+) ([]*ListExportEntry, error) {
+	umList, err := ds.UserMediaService.GetByUser(uID, nil, nil, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get UserMedia by User ID %d: %w", uID, err)
+	}
+
+	entries := make([]*ListExportEntry, 0, len(umList))
+	for _, um := range umList {
+		md, err := ds.MediaService.GetByID(um.MediaID, tx)
+		if errors.Is(err, data.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Media by ID %d: %w", um.MediaID, err)
+		}
+		progress, err := ds.UserMediaService.Progress(um, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get progress of UserMedia with ID %d: %w",
+				um.Meta.ID, err)
+		}
+
+		e := ListExportEntry{
+			MediaID:   md.Meta.ID,
+			Title:     fmt.Sprintf("Media %d", md.Meta.ID),
+			Status:    um.Status,
+			Score:     format.Display(um.Score),
+			Progress:  *progress,
+			Rewatches: um.RewatchCount,
+		}
+		if t := models.SelectTitle(md.Titles, langs); t != nil {
+			e.Title = t.String
+		}
+		if md.Type != nil {
+			e.Type = *md.Type
+		}
+		if c := models.SelectTitle(um.Comments, langs); c != nil {
+			e.Comments = c.String
+		}
+		for i, wi := range um.WatchInstances {
+			if i == 0 {
+				e.StartDate = wi.StartDate
+			}
+			if wi.EndDate != nil {
+				e.EndDate = wi.EndDate
+			}
+		}
+		entries = append(entries, &e)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return strings.ToLower(entries[i].Title) < strings.ToLower(entries[j].Title)
+	})
+	return entries, nil
+}
+
+// WriteListDelimited writes the given exported entries as delimited values,
+// separated by the given rune, with a header row.
+func WriteListDelimited(w io.Writer, entries []*ListExportEntry, comma rune) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+
+	err := cw.Write([]string{
+		"media_id", "title", "type", "status", "score", "progress", "episodes",
+		"start_date", "end_date", "rewatches", "comments",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	for _, e := range entries {
+		var status, score, total string
+		if e.Status != nil {
+			status = watchStatusNames[*e.Status]
+		}
+		if e.Score != nil {
+			score = strconv.Itoa(*e.Score)
+		}
+		if e.Progress.Total > 0 {
+			total = strconv.Itoa(e.Progress.Total)
+		}
+		err = cw.Write([]string{
+			strconv.Itoa(e.MediaID), e.Title, e.Type, status, score,
+			strconv.Itoa(e.Progress.Watched), total,
+			formatExportDate(e.StartDate, ""), formatExportDate(e.EndDate, ""),
+			strconv.Itoa(e.Rewatches), e.Comments,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write entry of Media with ID %d: %w", e.MediaID, err)
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to flush: %w", err)
+	}
+	return nil
+}
+
+// MALList is the root element of a MyAnimeList export.
+type MALList struct {
+	XMLName xml.Name    `xml:"myanimelist"`
+	Info    MALInfo     `xml:"myinfo"`
+	Anime   []*MALAnime `xml:"anime"`
+}
+
+// MALInfo describes the User of a MyAnimeList export.
+type MALInfo struct {
+	Username      string `xml:"user_name"`
+	ExportType    int    `xml:"user_export_type"`
+	TotalAnime    int    `xml:"user_total_anime"`
+	TotalWatching int    `xml:"user_total_watching"`
+	TotalComplete int    `xml:"user_total_completed"`
+	TotalOnHold   int    `xml:"user_total_onhold"`
+	TotalDropped  int    `xml:"user_total_dropped"`
+	TotalPlanning int    `xml:"user_total_plantowatch"`
+}
+
+// MALAnime is a single entry of a MyAnimeList export.
+type MALAnime struct {
+	// ID is always 0, as Media are not mapped to MyAnimeList IDs; importers
+	// fall back to matching the title.
+	ID              int    `xml:"series_animedb_id"`
+	Title           string `xml:"series_title"`
+	Type            string `xml:"series_type"`
+	Episodes        int    `xml:"series_episodes"`
+	WatchedEpisodes int    `xml:"my_watched_episodes"`
+	StartDate       string `xml:"my_start_date"`
+	FinishDate      string `xml:"my_finish_date"`
+	Score           int    `xml:"my_score"`
+	Status          string `xml:"my_status"`
+	TimesWatched    int    `xml:"my_times_watched"`
+	Comments        string `xml:"my_comments"`
+	UpdateOnImport  int    `xml:"update_on_import"`
+}
+
+// WriteListMAL writes the given exported entries of the given User in the XML
+// format of MyAnimeList exports. Scores are expected on a 10-point scale.
+func WriteListMAL(w io.Writer, u *models.User, entries []*ListExportEntry) error {
+	list := MALList{
+		Info: MALInfo{Username: u.Username, ExportType: 1},
+	}
+	for _, e := range entries {
+		a := MALAnime{
+			Title:           e.Title,
+			Type:            e.Type,
+			Episodes:        e.Progress.Total,
+			WatchedEpisodes: e.Progress.Watched,
+			StartDate:       formatExportDate(e.StartDate, "0000-00-00"),
+			FinishDate:      formatExportDate(e.EndDate, "0000-00-00"),
+			TimesWatched:    e.Rewatches,
+			Comments:        e.Comments,
+			UpdateOnImport:  1,
+		}
+		if e.Score != nil {
+			a.Score = *e.Score
+		}
+
+		status := models.WatchStatusPlanning
+		if e.Status != nil {
+			status = *e.Status
+		}
+		switch status {
+		case models.WatchStatusCurrent:
+			a.Status = "Watching"
+			list.Info.TotalWatching++
+		case models.WatchStatusCompleted:
+			a.Status = "Completed"
+			list.Info.TotalComplete++
+		case models.WatchStatusHold:
+			a.Status = "On-Hold"
+			list.Info.TotalOnHold++
+		case models.WatchStatusDropped:
+			a.Status = "Dropped"
+			list.Info.TotalDropped++
+		default:
+			a.Status = "Plan to Watch"
+			list.Info.TotalPlanning++
+		}
+		list.Anime = append(list.Anime, &a)
+	}
+	list.Info.TotalAnime = len(list.Anime)
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(&list)
+	if err != nil {
+		return fmt.Errorf("failed to encode XML: %w", err)
+	}
+	return nil
+}
+
+// watchStatusNames are the written names of the WatchStatuses in exports.
+var watchStatusNames = map[models.WatchStatus]string{
+	models.WatchStatusCurrent:   "Current",
+	models.WatchStatusCompleted: "Completed",
+	models.WatchStatusPlanning:  "Planning",
+	models.WatchStatusDropped:   "Dropped",
+	models.WatchStatusHold:      "Hold",
+}
+
+// formatExportDate formats the given date for exports, or returns the given
+// default if it is nil.
+func formatExportDate(t *time.Time, def string) string {
+	if t == nil {
+		return def
+	}
+	return t.Format(exportDateFormat)
+}
@@ -0,0 +1,67 @@
+package naos_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/naos"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestListExport tests that exported lists are joined with the titles of
+// their Media and written as delimited values and MyAnimeList XML.
+func TestListExport(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	var entries []*naos.ListExportEntry
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		hold := models.WatchStatusHold
+		_, err := ds.UserMediaService.Create(&models.UserMedia{
+			UserID: refs["spike"], MediaID: refs["movie"], Status: &hold,
+		}, tx)
+		if err != nil {
+			return err
+		}
+		entries, err = naos.ListExport(ds, refs["spike"], models.ScoreFormatPoint10, nil, tx)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to export list: %v", err)
+	}
+	if len(entries) == 0 {
+		t.Fatalf("expected entries, got none")
+	}
+
+	var buf bytes.Buffer
+	err = naos.WriteListDelimited(&buf, entries, '\t')
+	if err != nil {
+		t.Fatalf("failed to write list: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(entries)+1 {
+		t.Errorf("expected %d lines, got %d", len(entries)+1, len(lines))
+	}
+	if !strings.Contains(lines[1], "\tCowboy Bebop\t") {
+		t.Errorf("expected entry of Cowboy Bebop, got %q", lines[1])
+	}
+
+	buf.Reset()
+	err = naos.WriteListMAL(&buf, &models.User{Username: "spike"}, entries)
+	if err != nil {
+		t.Fatalf("failed to write list: %v", err)
+	}
+	for _, s := range []string{
+		"<user_name>spike</user_name>",
+		"<series_title>Cowboy Bebop</series_title>",
+		"<my_status>Completed</my_status>",
+		"<my_status>On-Hold</my_status>",
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("expected %q in export", s)
+		}
+	}
+}
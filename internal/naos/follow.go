@@ -0,0 +1,220 @@
+package naos
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// FollowResponse is the response body of a follow or unfollow.
+type FollowResponse struct {
+	Following bool `json:"following"`
+}
+
+// FriendScore is the UserMedia of a followed User for some Media.
+type FriendScore struct {
+	User   models.UserProfile  `json:"user"`
+	Status *models.WatchStatus `json:"status"`
+	Score  *int                `json:"score"`
+}
+
+// NewFollowHandler returns an endpoint handler that makes the caller follow
+// the User given by the id path variable, or stop following them if unfollow
+// is true. Follows are made with PUT requests and removed with DELETE
+// requests.
+func NewFollowHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator, unfollow bool,
+) web.Handler {
+	method := http.MethodPut
+	if unfollow {
+		method = http.MethodDelete
+	}
+
+	return web.Handler{
+		Method: method,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			uID, u, ok := libraryCaller(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+			if u == nil {
+				web.EncodeResponseErrorUnauthorized(web.ErrorAuthentication,
+					errors.New("no credentials given"), w)
+				return
+			}
+
+			err := ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				if unfollow {
+					return ds.UserFollowService.Unfollow(u.Meta.ID, uID, tx)
+				}
+				return ds.UserFollowService.Follow(u.Meta.ID, uID, tx)
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer,
+					fmt.Errorf("failed to change follow of User with ID %d: %w", uID, err), w)
+				return
+			}
+
+			web.EncodeResponseBody(FollowResponse{Following: !unfollow}, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewFollowListHandler returns a GET endpoint handler that lists the Users
+// followed by the User given by the id path variable, or the followers of
+// that User if followers is true. The lists are visible to callers that may
+// view the profile of the User.
+func NewFollowListHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator, followers bool,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			uID, _, ok := authorizeLibraryView(w, r, ps, ds, au, models.PrivacyProfile)
+			if !ok {
+				return
+			}
+			first, skip, ok := parsePagination(w, r)
+			if !ok {
+				return
+			}
+
+			var list []models.UserProfile
+			err := ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var follows []*models.UserFollow
+				var err error
+				if followers {
+					follows, err = ds.UserFollowService.GetByFollowee(uID, first, skip, tx)
+				} else {
+					follows, err = ds.UserFollowService.GetByFollower(uID, first, skip, tx)
+				}
+				if err != nil {
+					return fmt.Errorf("failed to get UserFollows of User with ID %d: %w",
+						uID, err)
+				}
+
+				list = make([]models.UserProfile, len(follows))
+				for i, uf := range follows {
+					id := uf.FolloweeID
+					if followers {
+						id = uf.FollowerID
+					}
+					list[i], err = userProfile(ds, id, tx)
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(list, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewFriendScoresHandler returns a GET endpoint handler that lists the
+// scores and statuses given to the Media given by the id path variable by
+// the Users the caller follows, among those whose lists are visible to the
+// caller.
+func NewFriendScoresHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			mID, u, ok := libraryCaller(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+			if u == nil {
+				web.EncodeResponseErrorUnauthorized(web.ErrorAuthentication,
+					errors.New("no credentials given"), w)
+				return
+			}
+
+			list := []FriendScore{}
+			err := ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				followees, err := ds.UserFollowService.Followees(u.Meta.ID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get followees of User with ID %d: %w",
+						u.Meta.ID, err)
+				}
+				followed := make(map[int]bool, len(followees))
+				for _, id := range followees {
+					followed[id] = true
+				}
+
+				umList, err := ds.UserMediaService.GetFilter(nil, nil, tx,
+					func(um *models.UserMedia) bool {
+						return um.MediaID == mID && followed[um.UserID]
+					})
+				if err != nil {
+					return fmt.Errorf("failed to get UserMedia by Media ID %d: %w", mID, err)
+				}
+
+				for _, um := range umList {
+					err = ds.UserService.AuthorizeViewAs(u, um.UserID, models.PrivacyLists, tx)
+					if errors.Is(err, data.ErrUnauthorized) {
+						continue
+					}
+					if err != nil {
+						return err
+					}
+
+					profile, err := userProfile(ds, um.UserID, tx)
+					if err != nil {
+						return err
+					}
+					list = append(list, FriendScore{
+						User:   profile,
+						Status: um.Status,
+						Score:  data.ScoreFormatOf(u).Display(um.Score),
+					})
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(list, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// userProfile returns the profile of the User with the given ID.
+func userProfile(ds *graphql.DataService, uID int, tx db.Tx) (models.UserProfile, error) {
+	u, err := ds.UserService.GetByID(uID, tx)
+	if err != nil {
+		return models.UserProfile{}, fmt.Errorf("failed to get User by ID %d: %w", uID, err)
+	}
+	return models.UserProfile{
+		ID:       u.Meta.ID,
+		Username: u.Username,
+	}, nil
+}
@@ -0,0 +1,62 @@
+package naos_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestUserFollow tests that follows are unique, not made to oneself, and
+// deleted with their Users.
+func TestUserFollow(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	spike := refs["spike"]
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		jet := models.User{Username: "jet", Password: []byte("bonsai")}
+		jetID, err := ds.UserService.Create(&jet, tx)
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < 2; i++ {
+			err = ds.UserFollowService.Follow(spike, jetID, tx)
+			if err != nil {
+				return err
+			}
+		}
+		followees, err := ds.UserFollowService.Followees(spike, tx)
+		if err != nil {
+			return err
+		}
+		if len(followees) != 1 || followees[0] != jetID {
+			t.Errorf("expected to follow only User %d, got %v", jetID, followees)
+		}
+
+		err = ds.UserFollowService.Follow(spike, spike, tx)
+		if !errors.Is(err, data.ErrInvalid) {
+			t.Errorf("expected invalid self-follow, got %v", err)
+		}
+
+		err = ds.UserService.Delete(jetID, tx)
+		if err != nil {
+			return err
+		}
+		followees, err = ds.UserFollowService.Followees(spike, tx)
+		if err != nil {
+			return err
+		}
+		if len(followees) != 0 {
+			t.Errorf("expected follows of deleted User to be deleted, got %v", followees)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to follow: %v", err)
+	}
+}
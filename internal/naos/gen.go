@@ -0,0 +1,477 @@
+package naos
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+const (
+	// DefaultGenerateBatchSize is the number of Media or Users generated per
+	// transaction if not given.
+	DefaultGenerateBatchSize = 1000
+	// DefaultGeneratePassword is the password of generated Users if not
+	// given.
+	DefaultGeneratePassword = "password"
+)
+
+// GenerateOptions are the sizes of the fake data synthesized by Generate.
+type GenerateOptions struct {
+	// Media and Users are the numbers of Media and Users generated.
+	Media int
+	Users int
+	// Seed seeds the random choices, so that equal options generate equal
+	// data.
+	Seed int64
+	// BatchSize is the number of Media or Users generated per transaction;
+	// defaults to DefaultGenerateBatchSize.
+	BatchSize int
+	// Password is the password of every generated User; defaults to
+	// DefaultGeneratePassword.
+	Password string
+}
+
+// Generate synthesizes fake Media with Episodes, and Users with lists of
+// them, into the empty database of the given data layer for load and UI
+// testing, returning the number of entities created by bucket. Titles,
+// seasons and episode counts follow those of real catalogues, and Users list
+// popular Media more often. Media, Episodes and UserMedia are written
+// directly, without validation or hooks, along with the Slugs, Names,
+// seasons and airings that index them, so that large databases are
+// generated quickly; Users are created normally, sharing a single password
+// hash. It returns an error wrapping data.ErrConflict if the database
+// already has Media or Users.
+func Generate(ds *graphql.DataService, opts GenerateOptions) (map[string]int, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultGenerateBatchSize
+	}
+	if opts.Password == "" {
+		opts.Password = DefaultGeneratePassword
+	}
+
+	err := ds.Database.Transaction(false, func(tx db.Tx) error {
+		one := 1
+		mdList, err := ds.MediaService.GetAll(&one, nil, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get Media: %w", err)
+		}
+		uList, err := ds.UserService.GetAll(&one, nil, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get Users: %w", err)
+		}
+		if len(mdList) > 0 || len(uList) > 0 {
+			return fmt.Errorf("database already has Media or Users: %w", data.ErrConflict)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pass, err := ds.UserService.HashPassword([]byte(opts.Password))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate password hash: %w", err)
+	}
+
+	g := generator{
+		ds:        ds,
+		rnd:       rand.New(rand.NewSource(opts.Seed)),
+		now:       time.Now(),
+		counts:    map[string]int{},
+		slugs:     map[string]bool{},
+		seasonIDs: map[genSeason][]int{},
+	}
+	err = g.batches(opts.Media, opts.BatchSize, g.media)
+	if err != nil {
+		return nil, err
+	}
+	err = g.seasons()
+	if err != nil {
+		return nil, err
+	}
+	err = g.batches(opts.Users, opts.BatchSize, func(i int, tx db.Tx) error {
+		return g.user(i, pass, tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Sorted last, by the scores of the lists
+	err = ds.Database.Transaction(true, func(tx db.Tx) error {
+		_, err := ds.MediaOrderService.Reindex(tx)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sort Media: %w", err)
+	}
+	return g.counts, nil
+}
+
+// generator holds the state of Generate.
+type generator struct {
+	ds     *graphql.DataService
+	rnd    *rand.Rand
+	now    time.Time
+	counts map[string]int
+	// slugs are the Slugs taken by generated Media.
+	slugs map[string]bool
+	// mediaList are the generated Media, the most popular first.
+	mediaList []*genMedia
+	// seasonIDs are the IDs of the generated Media by season.
+	seasonIDs map[genSeason][]int
+}
+
+// genMedia is a generated Media along with what its listing depends on.
+type genMedia struct {
+	id     int
+	aired  int
+	status models.ReleaseStatus
+	// quality is the mean score Users give the Media.
+	quality float64
+}
+
+// batches calls gen with the numbers from 0 to n, in transactions of size
+// numbers each.
+func (g *generator) batches(n int, size int, gen func(i int, tx db.Tx) error) error {
+	for start := 0; start < n; start += size {
+		err := g.ds.Database.Transaction(true, func(tx db.Tx) error {
+			for i := start; i < n && i < start+size; i++ {
+				err := gen(i, tx)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// put persists the given entity directly, without validation or hooks.
+func (g *generator) put(m db.Model, ser db.Service, tx db.Tx) (int, error) {
+	meta := m.Metadata()
+	meta.CreatedAt = g.now
+	meta.UpdatedAt = g.now
+	id, err := tx.Database().DatabaseDriver.Create(m, ser, tx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create %s: %w", ser.Bucket(), err)
+	}
+	g.counts[ser.Bucket()]++
+	return id, nil
+}
+
+// weighted returns the index of one of the given weights at random, in
+// proportion to the weight.
+func (g *generator) weighted(weights []int) int {
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
+	n := g.rnd.Intn(total)
+	for i, w := range weights {
+		if n < w {
+			return i
+		}
+		n -= w
+	}
+	return len(weights) - 1
+}
+
+var (
+	genAdjectives = []string{
+		"Crimson", "Silent", "Eternal", "Broken", "Lost", "Hidden", "Starlit",
+		"Iron", "Wandering", "Last", "Azure", "Midnight", "Endless", "Frozen",
+		"Golden", "Scarlet", "Forgotten", "Little", "Phantom", "Radiant",
+	}
+	genNouns = []string{
+		"Blade", "Horizon", "Academy", "Requiem", "Garden", "Frontier",
+		"Chronicle", "Alchemist", "Sky", "Kingdom", "Melody", "Signal",
+		"Labyrinth", "Dragon", "Voyage", "Witch", "Detective", "Orchestra",
+		"Circuit", "Festival",
+	}
+	genSyllables = []string{
+		"ka", "ki", "ku", "ko", "sa", "shi", "su", "to", "na", "ni", "ha",
+		"hi", "mi", "mo", "ya", "yu", "ri", "ro", "no", "ta", "te", "se", "ra",
+		"tsu", "chi", "wa", "ga", "ji", "do",
+		// Words do not begin with the last syllable
+		"n",
+	}
+	genTypes         = []string{"TV", "Movie", "OVA", "ONA", "Special"}
+	genTypeWeights   = []int{55, 15, 10, 10, 10}
+	genSources       = []string{"Original", "Manga", "Light Novel", "Novel", "Game", "Visual Novel"}
+	genSourceWeights = []int{30, 35, 15, 5, 10, 5}
+)
+
+// title returns a generated English title and its Japanese reading.
+func (g *generator) title() (string, string) {
+	en := genAdjectives[g.rnd.Intn(len(genAdjectives))] + " " +
+		genNouns[g.rnd.Intn(len(genNouns))]
+	switch n := g.rnd.Intn(10); {
+	case n == 0:
+		en += fmt.Sprintf(" Season %d", 2+g.rnd.Intn(3))
+	case n == 1:
+		en += ": " + genNouns[g.rnd.Intn(len(genNouns))] + " Arc"
+	}
+
+	words := make([]string, 1+g.rnd.Intn(3))
+	for i := range words {
+		var w strings.Builder
+		w.WriteString(genSyllables[g.rnd.Intn(len(genSyllables)-1)])
+		for j := 1 + g.rnd.Intn(3); j > 0; j-- {
+			w.WriteString(genSyllables[g.rnd.Intn(len(genSyllables))])
+		}
+		words[i] = strings.Title(w.String())
+	}
+	return en, strings.Join(words, " ")
+}
+
+// episodeCount returns a generated number of Episodes of a Media of the given
+// type.
+func (g *generator) episodeCount(typ string) int {
+	switch typ {
+	case "TV":
+		switch n := g.rnd.Intn(20); {
+		case n < 10:
+			return 12
+		case n < 12:
+			return 13
+		case n < 17:
+			return 24 + g.rnd.Intn(3)
+		case n < 19:
+			return 10 + g.rnd.Intn(40)
+		default:
+			return 50 + g.rnd.Intn(150)
+		}
+	case "Movie":
+		return 1
+	case "ONA":
+		return 6 + g.rnd.Intn(19)
+	}
+	return 1 + g.rnd.Intn(6)
+}
+
+// media generates a single Media with its Episodes.
+func (g *generator) media(_ int, tx db.Tx) error {
+	typ := genTypes[g.weighted(genTypeWeights)]
+	source := genSources[g.weighted(genSourceWeights)]
+	en, ja := g.title()
+	n := g.episodeCount(typ)
+
+	// Most Media are recent; a few are announced for next year
+	year := g.now.Year() + 1 - int(g.rnd.ExpFloat64()*8)
+	if year < 1970 {
+		year = 1970 + g.rnd.Intn(10)
+	}
+	start := time.Date(year, time.Month(1+g.rnd.Intn(12)), 1+g.rnd.Intn(28),
+		15, 0, 0, 0, time.UTC)
+	interval := 7 * 24 * time.Hour
+	if typ != "TV" && typ != "ONA" {
+		interval = 0
+	}
+	end := start.Add(time.Duration(n-1) * interval)
+	quarter := models.Quarter((int(start.Month())-1)/3 + 1)
+
+	slug := data.Slugify(en)
+	for i := 2; g.slugs[slug]; i++ {
+		slug = fmt.Sprintf("%s-%d", data.Slugify(en), i)
+	}
+	g.slugs[slug] = true
+
+	titles := []models.Title{
+		{String: en, Language: "en", Priority: models.TitlePriorityPrimary},
+		{String: ja, Language: "ja-Latn", Priority: models.TitlePriorityPrimary},
+	}
+	md := models.Media{
+		Titles: titles,
+		Synopses: []models.Title{{
+			String: fmt.Sprintf("A %s %s adaptation of the story of the %s.",
+				strings.ToLower(genAdjectives[g.rnd.Intn(len(genAdjectives))]),
+				strings.ToLower(source),
+				strings.ToLower(genNouns[g.rnd.Intn(len(genNouns))])),
+			Language: "en",
+		}},
+		StartDate:       &start,
+		EndDate:         &end,
+		SeasonPremiered: models.Season{Quarter: &quarter, Year: &year},
+		ReleaseStatus:   models.DeriveReleaseStatus(&start, &end, g.now),
+		Type:            &typ,
+		Source:          &source,
+		Slug:            slug,
+	}
+	mID, err := g.put(&md, g.ds.MediaService, tx)
+	if err != nil {
+		return err
+	}
+	_, err = g.put(&models.Slug{
+		Bucket: g.ds.MediaService.Bucket(), Slug: slug, ModelID: mID,
+	}, g.ds.SlugService, tx)
+	if err != nil {
+		return err
+	}
+	_, err = g.put(&models.Name{
+		Bucket: g.ds.MediaService.Bucket(), ModelID: mID, Keys: g.ds.NameService.Keys(titles),
+	}, g.ds.NameService, tx)
+	if err != nil {
+		return err
+	}
+
+	duration := 24
+	if typ == "Movie" {
+		duration = 90 + g.rnd.Intn(40)
+	}
+	aired := 0
+	epIDs := make([]int, n)
+	for i := range epIDs {
+		date := start.Add(time.Duration(i) * interval)
+		if !date.After(g.now) {
+			aired++
+		}
+		epIDs[i], err = g.put(&models.Episode{
+			Titles:   []models.Title{{String: fmt.Sprintf("Episode %d", i+1), Language: "en"}},
+			Date:     &date,
+			Duration: &duration,
+		}, g.ds.EpisodeService, tx)
+		if err != nil {
+			return err
+		}
+		_, err = g.put(&models.EpisodeAiring{
+			MediaID: mID, EpisodeID: epIDs[i], Number: i + 1, Date: date,
+		}, g.ds.EpisodeAiringService, tx)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = g.put(&models.EpisodeSet{MediaID: mID, Episodes: epIDs},
+		g.ds.EpisodeSetService, tx)
+	if err != nil {
+		return err
+	}
+
+	g.mediaList = append(g.mediaList, &genMedia{
+		id:      mID,
+		aired:   aired,
+		status:  *md.ReleaseStatus,
+		quality: math.Max(20, math.Min(95, 68+g.rnd.NormFloat64()*10)),
+	})
+	season := genSeason{year, quarter}
+	g.seasonIDs[season] = append(g.seasonIDs[season], mID)
+	return nil
+}
+
+// seasons indexes the generated Media by the season they premiered in.
+func (g *generator) seasons() error {
+	return g.ds.Database.Transaction(true, func(tx db.Tx) error {
+		for s, ids := range g.seasonIDs {
+			_, err := g.put(&models.MediaSeason{
+				Year: s.year, Quarter: s.quarter, MediaIDs: ids,
+			}, g.ds.MediaSeasonService, tx)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+var (
+	genStatuses = []models.WatchStatus{
+		models.WatchStatusCompleted, models.WatchStatusPlanning, models.WatchStatusCurrent,
+		models.WatchStatusDropped, models.WatchStatusHold,
+	}
+	genStatusWeights = []int{55, 20, 8, 10, 7}
+)
+
+// user generates the User of the given number with a list of Media, most
+// often the popular ones.
+func (g *generator) user(i int, pass []byte, tx db.Tx) error {
+	u := models.User{
+		Username: fmt.Sprintf("user%d", i+1),
+		Email:    fmt.Sprintf("user%d@example.test", i+1),
+		Password: pass,
+	}
+	uID, err := g.ds.UserService.CreateHashed(&u, tx)
+	if err != nil {
+		return fmt.Errorf("failed to create User %q: %w", u.Username, err)
+	}
+	g.counts[g.ds.UserService.Bucket()]++
+	if len(g.mediaList) == 0 {
+		return nil
+	}
+
+	// List sizes are log-normal, around a hundred Media
+	size := int(math.Exp(4.3 + g.rnd.NormFloat64()*0.9))
+	if size > len(g.mediaList) {
+		size = len(g.mediaList)
+	}
+	zipf := rand.NewZipf(g.rnd, 1.1, 10, uint64(len(g.mediaList)-1))
+	listed := make(map[int]bool, size)
+	// Popular Media are listed again and again; give up on the rest of the
+	// list once they are all listed
+	for attempts := 0; len(listed) < size && attempts < 4*size; attempts++ {
+		gm := g.mediaList[zipf.Uint64()]
+		if listed[gm.id] {
+			continue
+		}
+		listed[gm.id] = true
+
+		um := models.UserMedia{UserID: uID, MediaID: gm.id}
+		status := models.WatchStatusPlanning
+		switch gm.status {
+		case models.ReleaseStatusReleasing:
+			status = models.WatchStatusCurrent
+			if g.rnd.Intn(3) == 0 {
+				status = models.WatchStatusPlanning
+			}
+		case models.ReleaseStatusFinished:
+			status = genStatuses[g.weighted(genStatusWeights)]
+		}
+		um.Status = &status
+
+		watched := 0
+		switch status {
+		case models.WatchStatusCompleted:
+			watched = gm.aired
+		case models.WatchStatusCurrent, models.WatchStatusDropped, models.WatchStatusHold:
+			watched = g.rnd.Intn(gm.aired + 1)
+		}
+		if watched > 0 || status == models.WatchStatusCurrent {
+			um.WatchInstances = []models.WatchedInstance{{
+				Episodes: watched,
+				Ongoing:  status == models.WatchStatusCurrent,
+			}}
+		}
+		if status != models.WatchStatusPlanning && g.rnd.Intn(10) < 7 {
+			// Scores are given in tens, around the quality of the Media
+			score := int(math.Round((gm.quality+g.rnd.NormFloat64()*12)/10)) * 10
+			if score < 10 {
+				score = 10
+			}
+			if score > models.ScoreMax {
+				score = models.ScoreMax
+			}
+			um.Score = &score
+		}
+
+		_, err = g.put(&um, g.ds.UserMediaService, tx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// genSeason identifies a season of generated Media.
+type genSeason struct {
+	year    int
+	quarter models.Quarter
+}
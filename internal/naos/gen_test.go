@@ -0,0 +1,81 @@
+package naos_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/naos"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// TestGenerate tests that generated Media are indexed as created ones are,
+// that generated Users may log in, and that only empty databases are
+// generated into.
+func TestGenerate(t *testing.T) {
+	ds, _, cleanup := naostest.NewDataService(t)
+	defer cleanup()
+
+	opts := naos.GenerateOptions{Media: 60, Users: 5, Seed: 7, BatchSize: 25}
+	counts, err := naos.Generate(ds, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[ds.MediaService.Bucket()] != 60 || counts[ds.UserService.Bucket()] != 5 {
+		t.Errorf("expected 60 Media and 5 Users, got %v", counts)
+	}
+
+	err = ds.Database.Transaction(false, func(tx db.Tx) error {
+		list, err := ds.MediaService.GetAll(nil, nil, tx)
+		if err != nil {
+			return err
+		}
+		for _, md := range list {
+			bySlug, err := ds.MediaService.GetBySlug(md.Slug, tx)
+			if err != nil {
+				return err
+			}
+			if bySlug.Meta.ID != md.Meta.ID {
+				t.Errorf("expected slug %q of %d, got %d", md.Slug, md.Meta.ID, bySlug.Meta.ID)
+			}
+			s := md.SeasonPremiered
+			chart, err := ds.MediaSeasonService.Chart(*s.Year, *s.Quarter, 0, nil, nil, nil, tx)
+			if err != nil {
+				return err
+			}
+			found := false
+			for _, e := range chart {
+				found = found || e.Media.Meta.ID == md.Meta.ID
+			}
+			if !found {
+				t.Errorf("expected Media %d in chart of %s %d", md.Meta.ID, *s.Quarter, *s.Year)
+			}
+		}
+
+		sorted, total, err := ds.MediaOrderService.List(data.MediaOrderStartDate, false,
+			nil, nil, tx)
+		if err != nil {
+			return err
+		}
+		if total != 60 {
+			t.Errorf("expected 60 sorted Media, got %d", total)
+		}
+		for i := 1; i < len(sorted); i++ {
+			if sorted[i].StartDate.Before(*sorted[i-1].StartDate) {
+				t.Errorf("expected Media sorted by start date, got %d before %d",
+					sorted[i-1].Meta.ID, sorted[i].Meta.ID)
+			}
+		}
+
+		return ds.UserService.AuthenticateWithPassword("user1", naos.DefaultGeneratePassword, tx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = naos.Generate(ds, opts)
+	if !errors.Is(err, data.ErrConflict) {
+		t.Errorf("expected generating into a filled database to conflict, got %v", err)
+	}
+}
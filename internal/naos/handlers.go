@@ -2,31 +2,103 @@ package naos
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
 	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/models"
 	"github.com/friendsofgo/graphiql"
 	"github.com/julienschmidt/httprouter"
 )
 
-// NewGraphQLHandler returns a POST endpoint handler for the GraphQL API.
-func NewGraphQLHandler(path []string, ds *graphql.DataService) web.Handler {
+// NewGraphQLHandler returns a POST endpoint handler for the GraphQL API. Each
+// caller is served the effective schema of their Role. Clients may send the
+// hashes of queries persisted in the database in place of their documents; if
+// allowlistOnly is true, callers other than Admins may only send queries
+// registered by Admins. If anonymousReadOnly is true, anonymous callers may
+// only send queries. Mutations are refused while the server is in the given
+// maintenance mode.
+func NewGraphQLHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator, allowlistOnly bool,
+	anonymousReadOnly bool, maintenance *web.Maintenance,
+) (web.Handler, error) {
 	cfg := graphql.Config{
 		Resolvers: &graphql.Resolver{},
+		Directives: graphql.DirectiveRoot{
+			HasRole: graphql.HasRole,
+		},
+	}
+	es := graphql.NewExecutableSchema(cfg)
+
+	vis, err := graphql.NewRoleVisibility(es.Schema())
+	if err != nil {
+		return web.Handler{}, fmt.Errorf("failed to read role visibility: %w", err)
+	}
+
+	roles := []models.Role{
+		models.RoleAnonymous, models.RoleUser, models.RoleModerator, models.RoleAdmin,
+	}
+	queries := graphql.PersistedQueryCache{DataService: ds}
+	gqlHandlers := make(map[models.Role]*handler.Server, len(roles))
+	for _, role := range roles {
+		h := handler.New(graphql.NewRoleSchema(es, vis, role))
+		h.AddTransport(transport.Websocket{KeepAlivePingInterval: 10 * time.Second})
+		h.AddTransport(transport.Options{})
+		h.AddTransport(transport.GET{})
+		h.AddTransport(transport.POST{})
+		h.AddTransport(transport.MultipartForm{})
+		h.SetQueryCache(lru.New(1000))
+		h.Use(extension.Introspection{})
+		if allowlistOnly {
+			h.Use(graphql.PersistedQueryAllowlist{DataService: ds})
+		}
+		h.Use(extension.AutomaticPersistedQuery{Cache: queries})
+		h.Use(graphql.RoleIntrospection{Visibility: vis})
+		h.Use(graphql.Tracing{})
+		h.Use(graphql.ReadOnlyScope{})
+		h.Use(graphql.MaintenanceMode{Maintenance: maintenance})
+		h.SetErrorPresenter(graphql.PresentError)
+		gqlHandlers[role] = h
 	}
-	gqlHandler := handler.NewDefaultServer(graphql.NewExecutableSchema(cfg))
 
-	ctx := context.WithValue(context.Background(), graphql.DataServiceKey, ds)
 	return web.Handler{
 		Method: http.MethodPost,
 		Path:   path,
+		// Queries are sent with POST too, so mutations are refused in
+		// maintenance mode by operation rather than by method
+		AllowInMaintenance: true,
 		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			// Queries are sent with POST too, so the scope of API keys is
+			// checked by operation rather than by method
+			u, scope, err := RequestCaller(r, ds, au)
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorAuthentication, err, w)
+				return
+			}
+			role := models.RoleAnonymous
+			if u != nil {
+				role = u.Permissions.Role()
+			} else if anonymousReadOnly {
+				scope = models.APIKeyScopeRead
+			}
+
+			ctx := context.WithValue(r.Context(), graphql.DataServiceKey, ds)
+			ctx = context.WithValue(ctx, graphql.UserKey, u)
+			ctx = context.WithValue(ctx, graphql.RoleKey, role)
+			ctx = context.WithValue(ctx, graphql.ScopeKey, scope)
+			ctx = context.WithValue(ctx, graphql.LanguagesKey,
+				models.ParseAcceptLanguage(r.Header.Get(web.HeaderAcceptLanguage)))
 			r = r.WithContext(ctx)
-			gqlHandler.ServeHTTP(w, r)
+			gqlHandlers[role].ServeHTTP(w, r)
 		},
-	}
+	}, nil
 }
 
 // NewGraphiQLHandler returns a new GET endpoint handler for rendering a
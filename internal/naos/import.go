@@ -0,0 +1,398 @@
+package naos
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/mail"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// ListImportSyncLimit is the largest number of entries imported during the
+// request; larger imports are staged in the import queue.
+const ListImportSyncLimit = 100
+
+// ListImportRow is the result of the import of a single entry.
+type ListImportRow struct {
+	// Row is the position of the entry in the imported list, starting at 1.
+	Row     int    `json:"row"`
+	Title   string `json:"title"`
+	MediaID *int   `json:"mediaID"`
+	// Created is true if a stub Media was created for the entry as no Media
+	// has its title.
+	Created bool   `json:"created"`
+	Error   string `json:"error,omitempty"`
+	// Status and Attempts are those of the entry if staged in the import
+	// queue.
+	Status   *models.ImportRowStatus `json:"status,omitempty"`
+	Attempts int                     `json:"attempts,omitempty"`
+}
+
+// ListImportSummary is the result of the import of a list.
+type ListImportSummary struct {
+	// JobID is the ID of the job of the import, if run in the background.
+	JobID    *int             `json:"jobID"`
+	Running  bool             `json:"running"`
+	Imported int              `json:"imported"`
+	Failed   int              `json:"failed"`
+	Rows     []*ListImportRow `json:"rows"`
+}
+
+// ListImports keeps the summary of the latest import of each User. It is safe
+// for concurrent use.
+type ListImports struct {
+	mu        sync.Mutex
+	summaries map[int]*ListImportSummary
+}
+
+// NewListImports returns an empty ListImports.
+func NewListImports() *ListImports {
+	return &ListImports{summaries: map[int]*ListImportSummary{}}
+}
+
+// Get returns a copy of the summary of the latest import of the User with the
+// given ID, or nil if there is none.
+func (li *ListImports) Get(uID int) *ListImportSummary {
+	li.mu.Lock()
+	defer li.mu.Unlock()
+
+	s, ok := li.summaries[uID]
+	if !ok {
+		return nil
+	}
+	c := *s
+	c.Rows = append([]*ListImportRow{}, s.Rows...)
+	return &c
+}
+
+func (li *ListImports) set(uID int, s *ListImportSummary) {
+	li.mu.Lock()
+	defer li.mu.Unlock()
+	li.summaries[uID] = s
+}
+
+// NewListImportHandler returns a POST endpoint handler that imports a list in
+// the XML format of MyAnimeList exports into the UserMedia of the User given
+// by the id path variable. Entries are matched to Media by title, and stub
+// Media are created for unknown titles. Lists of up to ListImportSyncLimit
+// entries are imported during the request and their summary returned; larger
+// lists are staged in the given ImportQueue, which imports them in the
+// background. Only the User may import into their library.
+func NewListImportHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator, q *ImportQueue,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			uID, _, ok := authorizeLibraryOwner(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+
+			body, err := web.ReadRequestBody(r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorRequestBodyReading, err, w)
+				return
+			}
+			var list MALList
+			err = xml.Unmarshal(body, &list)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorRequestBodyParsing, err, w)
+				return
+			}
+
+			if len(list.Anime) <= ListImportSyncLimit {
+				s := ImportMALList(ds, uID, list.Anime, nil)
+				q.Imports.set(uID, s)
+				web.EncodeResponseBody(s, w)
+				return
+			}
+
+			err = q.Enqueue(uID, list.Anime)
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+			web.EncodeResponseBody(q.Imports.Get(uID), w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewListImportSummaryHandler returns a GET endpoint handler for the summary
+// of the latest import of the User given by the id path variable. Only the
+// User may view it.
+func NewListImportSummaryHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator, li *ListImports,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			uID, _, ok := authorizeLibraryOwner(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+
+			s := li.Get(uID)
+			if s == nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer,
+					fmt.Errorf("import of User with ID %d: %w", uID, data.ErrNotFound), w)
+				return
+			}
+			web.EncodeResponseBody(s, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// ImportMALList imports the given MyAnimeList entries into the UserMedia of
+// the User with the given ID, reporting each entry to the given Progress, if
+// not nil. Each entry is imported in its own transaction, so that a failed
+// entry does not undo the others.
+func ImportMALList(
+	ds *graphql.DataService, uID int, entries []*MALAnime, p db.Progress,
+) *ListImportSummary {
+	s := ListImportSummary{Rows: make([]*ListImportRow, 0, len(entries))}
+	if p != nil {
+		p.SetTotal(int64(len(entries)))
+	}
+
+	byTitle, err := indexMediaByTitle(ds)
+	for i, e := range entries {
+		row := ListImportRow{Row: i + 1, Title: e.Title}
+		rowErr := err
+		if rowErr == nil {
+			rowErr = ds.Database.Transaction(true, func(tx db.Tx) error {
+				return importMALEntry(ds, uID, e, byTitle, &row, tx)
+			})
+		}
+		if rowErr != nil {
+			row.Error = rowErr.Error()
+			row.MediaID, row.Created = nil, false
+			s.Failed++
+		} else {
+			s.Imported++
+			if row.Created {
+				byTitle[strings.ToLower(strings.TrimSpace(e.Title))] = *row.MediaID
+			}
+		}
+		s.Rows = append(s.Rows, &row)
+		if p != nil {
+			p.Advance(1)
+		}
+	}
+	return &s
+}
+
+// indexMediaByTitle returns the IDs of the Media by their titles and then
+// their MediaAliases, ignoring case.
+func indexMediaByTitle(ds *graphql.DataService) (map[string]int, error) {
+	byTitle := map[string]int{}
+	add := func(title string, mID int) {
+		key := strings.ToLower(strings.TrimSpace(title))
+		if _, ok := byTitle[key]; !ok {
+			byTitle[key] = mID
+		}
+	}
+	err := ds.Database.Transaction(false, func(tx db.Tx) error {
+		mdList, err := ds.MediaService.GetAll(nil, nil, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get Media: %w", err)
+		}
+		for _, md := range mdList {
+			for _, t := range md.Titles {
+				add(t.String, md.Meta.ID)
+			}
+		}
+
+		aliases, err := ds.MediaAliasService.GetAll(nil, nil, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get MediaAliases: %w", err)
+		}
+		for _, a := range aliases {
+			add(a.Title, a.MediaID)
+		}
+		return nil
+	})
+	return byTitle, err
+}
+
+// importMALEntry imports a single MyAnimeList entry into the UserMedia of the
+// User with the given ID, updating the UserMedia of its Media if the User
+// already has one.
+func importMALEntry(
+	ds *graphql.DataService, uID int, e *MALAnime, byTitle map[string]int,
+	row *ListImportRow, tx db.Tx,
+) error {
+	title := strings.TrimSpace(e.Title)
+	if title == "" {
+		return fmt.Errorf("series_title: %w", data.ErrInvalid)
+	}
+	status, err := parseMALStatus(e.Status)
+	if err != nil {
+		return err
+	}
+	var score *int
+	if e.Score > 0 {
+		score, err = models.ScoreFormatPoint10.Normalize(&e.Score)
+		if err != nil {
+			return fmt.Errorf("my_score: %v: %w", err, data.ErrInvalid)
+		}
+	}
+	start, err := parseMALDate(e.StartDate)
+	if err != nil {
+		return fmt.Errorf("my_start_date: %w", err)
+	}
+	end, err := parseMALDate(e.FinishDate)
+	if err != nil {
+		return fmt.Errorf("my_finish_date: %w", err)
+	}
+
+	mID, ok := byTitle[strings.ToLower(title)]
+	if !ok {
+		md := models.Media{Titles: []models.Title{{String: title}}}
+		if e.Type != "" {
+			md.Type = &e.Type
+		}
+		mID, err = ds.MediaService.Create(&md, tx)
+		if err != nil {
+			return fmt.Errorf("failed to create Media: %w", err)
+		}
+		row.Created = true
+	}
+	row.MediaID = &mID
+
+	instances := []models.WatchedInstance{{
+		Episodes:  e.WatchedEpisodes,
+		Ongoing:   status == models.WatchStatusCurrent,
+		StartDate: start,
+		EndDate:   end,
+	}}
+	for i := 0; i < e.TimesWatched; i++ {
+		instances = append(instances, models.WatchedInstance{
+			Episodes: e.Episodes,
+			Rewatch:  i + 1,
+		})
+	}
+	var comments []models.Title
+	if c := strings.TrimSpace(e.Comments); c != "" {
+		comments = []models.Title{{String: c}}
+	}
+
+	umList, err := ds.UserMediaService.GetFilter(nil, nil, tx,
+		func(um *models.UserMedia) bool {
+			return um.UserID == uID && um.MediaID == mID
+		})
+	if err != nil {
+		return fmt.Errorf("failed to get UserMedia: %w", err)
+	}
+	if len(umList) > 0 {
+		um := umList[0]
+		um.Status, um.Score, um.WatchInstances = &status, score, instances
+		if comments != nil {
+			um.Comments = comments
+		}
+		err = ds.UserMediaService.Update(um, tx)
+		if err != nil {
+			return fmt.Errorf("failed to update UserMedia with ID %d: %w", um.Meta.ID, err)
+		}
+		return nil
+	}
+
+	um := models.UserMedia{
+		UserID:         uID,
+		MediaID:        mID,
+		Status:         &status,
+		Score:          score,
+		WatchInstances: instances,
+		Comments:       comments,
+	}
+	_, err = ds.UserMediaService.Create(&um, tx)
+	if err != nil {
+		return fmt.Errorf("failed to create UserMedia: %w", err)
+	}
+	return nil
+}
+
+// parseMALStatus returns the WatchStatus of the given MyAnimeList status,
+// given by name or number.
+func parseMALStatus(s string) (models.WatchStatus, error) {
+	value, ok := map[string]models.WatchStatus{
+		"watching":      models.WatchStatusCurrent,
+		"1":             models.WatchStatusCurrent,
+		"completed":     models.WatchStatusCompleted,
+		"2":             models.WatchStatusCompleted,
+		"on-hold":       models.WatchStatusHold,
+		"3":             models.WatchStatusHold,
+		"dropped":       models.WatchStatusDropped,
+		"4":             models.WatchStatusDropped,
+		"plan to watch": models.WatchStatusPlanning,
+		"6":             models.WatchStatusPlanning,
+	}[strings.ToLower(strings.TrimSpace(s))]
+	if !ok {
+		return 0, fmt.Errorf("my_status %q: %w", s, data.ErrInvalid)
+	}
+	return value, nil
+}
+
+// parseMALDate returns the given MyAnimeList date, or nil if it is empty or
+// unknown.
+func parseMALDate(s string) (*time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.HasPrefix(s, "0000") {
+		return nil, nil
+	}
+	t, err := time.Parse(exportDateFormat, s)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", s, data.ErrInvalid)
+	}
+	return &t, nil
+}
+
+// sendImportSummary emails the given summary of a finished import to the
+// given User, if mail is enabled and they have an email address.
+func sendImportSummary(mq *mail.Queue, u *models.User, s *ListImportSummary) {
+	if mq == nil || u == nil || u.Email == "" {
+		return
+	}
+
+	summary := mail.ImportSummaryData{
+		Username: u.Username,
+		Imported: s.Imported,
+		Skipped:  s.Failed,
+	}
+	for _, row := range s.Rows {
+		if row.Error != "" {
+			summary.Errors = append(summary.Errors,
+				"Row "+strconv.Itoa(row.Row)+" ("+row.Title+"): "+row.Error)
+		}
+	}
+	m, err := mail.ImportSummary.Render(u.Email, summary)
+	if err == nil {
+		err = mq.Enqueue(m)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"user": u.Meta.ID,
+		}).Errorf("Failed to send import summary: %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package naos_test
+
+import (
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/naos"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestImportMALList tests that imported entries are matched to Media by
+// title, that stubs are created for unknown titles, and that invalid entries
+// fail alone.
+func TestImportMALList(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	s := naos.ImportMALList(ds, refs["spike"], []*naos.MALAnime{
+		{Title: "cowboy bebop: the movie", Status: "Completed", Score: 8},
+		{Title: "Samurai Champloo", Status: "Watching", WatchedEpisodes: 3},
+		{Title: "Trigun", Status: "Rewatching"},
+	}, nil)
+	if s.Imported != 2 || s.Failed != 1 {
+		t.Fatalf("expected 2 imported and 1 failed, got %d and %d", s.Imported, s.Failed)
+	}
+	if id := s.Rows[0].MediaID; id == nil || *id != refs["movie"] || s.Rows[0].Created {
+		t.Errorf("expected existing Media %d, got %v", refs["movie"], id)
+	}
+	if !s.Rows[1].Created {
+		t.Errorf("expected stub Media to be created")
+	}
+	if s.Rows[2].Error == "" {
+		t.Errorf("expected error for invalid status")
+	}
+
+	err := ds.Database.Transaction(false, func(tx db.Tx) error {
+		umList, err := ds.UserMediaService.GetByMedia(refs["movie"], nil, nil, tx)
+		if err != nil {
+			return err
+		}
+		if len(umList) != 1 || umList[0].Score == nil || *umList[0].Score != 80 ||
+			*umList[0].Status != models.WatchStatusCompleted {
+			t.Errorf("expected imported UserMedia, got %+v", umList)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,457 @@
+package naos
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jobs"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/mail"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	json "github.com/json-iterator/go"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultImportBatchSize is the number of staged entries imported at once if
+// not configured.
+const DefaultImportBatchSize = 100
+
+// DefaultImportInterval is the duration between batches of staged entries if
+// not configured.
+const DefaultImportInterval = 5 * time.Second
+
+// ImportQueue imports the entries of lists staged in the ImportRow bucket
+// into the libraries of Users in batches, in the background, so that the
+// entries of imports cut short are imported once the server is back.
+type ImportQueue struct {
+	DataLayer *graphql.DataService
+	// Imports keeps the summaries of the imports, updated as they finish.
+	Imports *ListImports
+	Jobs    *jobs.Manager
+	// Mail sends Users the summaries of their imports; disabled if nil.
+	Mail *mail.Queue
+	// BatchSize is the largest number of entries imported in a batch.
+	BatchSize int
+	// Interval is the duration between batches.
+	Interval time.Duration
+	// OnError is called with the errors encountered while importing in the
+	// background.
+	OnError func(error)
+
+	mu    sync.Mutex
+	tasks map[int]*jobs.Task
+	sched schedule
+}
+
+// NewImportQueue returns an ImportQueue that imports the entries staged in
+// the given data layer.
+func NewImportQueue(
+	ds *graphql.DataService, li *ListImports, jm *jobs.Manager, mq *mail.Queue,
+	batchSize int, interval time.Duration, onError func(error),
+) *ImportQueue {
+	return &ImportQueue{
+		DataLayer: ds,
+		Imports:   li,
+		Jobs:      jm,
+		Mail:      mq,
+		BatchSize: batchSize,
+		Interval:  interval,
+		OnError:   onError,
+		tasks:     map[int]*jobs.Task{},
+	}
+}
+
+// Start begins importing a batch of staged entries at every interval.
+func (q *ImportQueue) Start() error {
+	err := q.sched.start(q.Interval, func(_, _ time.Time) error {
+		_, err := q.Process()
+		return err
+	}, q.OnError)
+	if err != nil {
+		return fmt.Errorf("failed to start import queue: %w", err)
+	}
+	return nil
+}
+
+// Stop stops importing staged entries and waits for a batch in progress to
+// finish.
+func (q *ImportQueue) Stop() {
+	q.sched.halt()
+}
+
+// Enqueue stages the given MyAnimeList entries to be imported into the
+// UserMedia of the User with the given ID, replacing their previous staged
+// entries. It returns an error wrapping data.ErrConflict if some of those are
+// still pending.
+func (q *ImportQueue) Enqueue(uID int, entries []*MALAnime) error {
+	rows := make([]*models.ImportRow, len(entries))
+	for i, e := range entries {
+		buf, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("failed to encode entry %d: %w", i+1, err)
+		}
+		rows[i] = &models.ImportRow{Title: e.Title, Entry: buf}
+	}
+	err := q.DataLayer.Database.Transaction(true, func(tx db.Tx) error {
+		return q.DataLayer.ImportRowService.Stage(uID, rows, tx)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to stage import: %w", err)
+	}
+	q.track(uID, len(rows))
+	return nil
+}
+
+// Retry stages the failed entries of the latest import of the User with the
+// given ID at the given positions, or all of them if none are given, to be
+// imported again, and returns the number staged.
+func (q *ImportQueue) Retry(uID int, rows []int) (int, error) {
+	var n int
+	err := q.DataLayer.Database.Transaction(true, func(tx db.Tx) error {
+		var err error
+		n, err = q.DataLayer.ImportRowService.Retry(uID, rows, tx)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to retry import: %w", err)
+	}
+	if n > 0 {
+		q.track(uID, n)
+	}
+	return n, nil
+}
+
+// track starts the job of the given number of entries of the User with the
+// given ID, replacing the summary of their latest import.
+func (q *ImportQueue) track(uID int, n int) {
+	task := q.Jobs.Start(jobs.KindImport)
+	task.SetTotal(int64(n))
+	jobID := task.ID()
+
+	q.mu.Lock()
+	if prev, ok := q.tasks[uID]; ok {
+		prev.Finish(nil)
+	}
+	q.tasks[uID] = task
+	q.mu.Unlock()
+
+	q.Imports.set(uID, &ListImportSummary{
+		JobID: &jobID, Running: true, Rows: []*ListImportRow{},
+	})
+}
+
+// Rows returns the staged entries of the latest import of the User with the
+// given ID, only those of the given status if not nil.
+func (q *ImportQueue) Rows(uID int, status *models.ImportRowStatus) ([]*ListImportRow, error) {
+	var rows []*models.ImportRow
+	err := q.DataLayer.Database.Transaction(false, func(tx db.Tx) error {
+		var err error
+		rows, err = q.DataLayer.ImportRowService.GetByUser(uID, status, tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return importRowSummary(rows).Rows, nil
+}
+
+// Process imports a batch of pending staged entries, of all Users, and
+// returns the number imported. The batch is written in a single transaction;
+// if it fails, each entry is written in its own, so that a failed entry does
+// not undo the others. The imports whose entries are all written are
+// finished, and their summaries sent to their Users.
+func (q *ImportQueue) Process() (int, error) {
+	ds := q.DataLayer
+	size := q.BatchSize
+	if size <= 0 {
+		size = DefaultImportBatchSize
+	}
+
+	var pending []*models.ImportRow
+	err := ds.Database.Transaction(false, func(tx db.Tx) error {
+		var err error
+		pending, err = ds.ImportRowService.Pending(&size, tx)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get pending ImportRows: %w", err)
+	}
+	if len(pending) == 0 {
+		return 0, nil
+	}
+
+	byTitle, err := indexMediaByTitle(ds)
+	if err != nil {
+		return 0, err
+	}
+
+	imported := 0
+	titles := copyTitles(byTitle)
+	err = ds.Database.Transaction(true, func(tx db.Tx) error {
+		for _, r := range pending {
+			err := importStagedRow(ds, *r, titles, tx)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		imported = len(pending)
+	} else {
+		for _, r := range pending {
+			titles = copyTitles(byTitle)
+			rowErr := ds.Database.Transaction(true, func(tx db.Tx) error {
+				return importStagedRow(ds, *r, titles, tx)
+			})
+			if rowErr == nil {
+				byTitle = titles
+				imported++
+				continue
+			}
+
+			failed := *r
+			failed.Status = models.ImportRowStatusFailed
+			failed.Attempts++
+			failed.Error = rowErr.Error()
+			failed.MediaID, failed.Created = nil, false
+			err = ds.Database.Transaction(true, func(tx db.Tx) error {
+				return ds.ImportRowService.Update(&failed, tx)
+			})
+			if err != nil {
+				return imported, fmt.Errorf("failed to update ImportRow with ID %d: %w",
+					r.Meta.ID, err)
+			}
+		}
+	}
+
+	users := map[int]int{}
+	for _, r := range pending {
+		users[r.UserID]++
+	}
+	for uID, n := range users {
+		q.advance(uID, n)
+		err = q.finish(uID)
+		if err != nil {
+			return imported, err
+		}
+	}
+	return imported, nil
+}
+
+// advance reports the given number of entries of the User with the given ID
+// done to the job of their import.
+func (q *ImportQueue) advance(uID int, n int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if task, ok := q.tasks[uID]; ok {
+		task.Advance(int64(n))
+	}
+}
+
+// finish finishes the import of the User with the given ID if none of its
+// entries are pending.
+func (q *ImportQueue) finish(uID int) error {
+	ds := q.DataLayer
+	var rows []*models.ImportRow
+	var u *models.User
+	err := ds.Database.Transaction(false, func(tx db.Tx) error {
+		var err error
+		rows, err = ds.ImportRowService.GetByUser(uID, nil, tx)
+		if err != nil {
+			return err
+		}
+		u, err = ds.UserService.GetByID(uID, tx)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get import of User with ID %d: %w", uID, err)
+	}
+	for _, r := range rows {
+		if r.Status == models.ImportRowStatusPending {
+			return nil
+		}
+	}
+
+	s := importRowSummary(rows)
+	q.mu.Lock()
+	if task, ok := q.tasks[uID]; ok {
+		jobID := task.ID()
+		s.JobID = &jobID
+		task.Finish(nil)
+		delete(q.tasks, uID)
+	}
+	q.mu.Unlock()
+
+	q.Imports.set(uID, s)
+	sendImportSummary(q.Mail, u, s)
+	log.WithFields(log.Fields{
+		"user":     uID,
+		"imported": s.Imported,
+		"failed":   s.Failed,
+	}).Info("Finished list import")
+	return nil
+}
+
+// importStagedRow imports the given staged entry and marks it imported,
+// adding the stub Media created for it to the given index of Media by title.
+func importStagedRow(
+	ds *graphql.DataService, r models.ImportRow, byTitle map[string]int, tx db.Tx,
+) error {
+	var e MALAnime
+	err := json.Unmarshal(r.Entry, &e)
+	if err != nil {
+		return fmt.Errorf("failed to decode entry: %w", err)
+	}
+
+	row := ListImportRow{Row: r.Row, Title: r.Title}
+	err = importMALEntry(ds, r.UserID, &e, byTitle, &row, tx)
+	if err != nil {
+		return err
+	}
+	if row.Created {
+		byTitle[strings.ToLower(strings.TrimSpace(e.Title))] = *row.MediaID
+	}
+
+	r.Status = models.ImportRowStatusImported
+	r.Attempts++
+	r.Error = ""
+	r.MediaID, r.Created = row.MediaID, row.Created
+	err = ds.ImportRowService.Update(&r, tx)
+	if err != nil {
+		return fmt.Errorf("failed to update ImportRow with ID %d: %w", r.Meta.ID, err)
+	}
+	return nil
+}
+
+// importRowSummary returns the summary of an import with the given staged
+// entries.
+func importRowSummary(rows []*models.ImportRow) *ListImportSummary {
+	s := ListImportSummary{Rows: make([]*ListImportRow, 0, len(rows))}
+	for _, r := range rows {
+		status := r.Status
+		s.Rows = append(s.Rows, &ListImportRow{
+			Row:      r.Row,
+			Title:    r.Title,
+			MediaID:  r.MediaID,
+			Created:  r.Created,
+			Error:    r.Error,
+			Status:   &status,
+			Attempts: r.Attempts,
+		})
+		switch r.Status {
+		case models.ImportRowStatusPending:
+			s.Running = true
+		case models.ImportRowStatusImported:
+			s.Imported++
+		case models.ImportRowStatusFailed:
+			s.Failed++
+		}
+	}
+	return &s
+}
+
+func copyTitles(byTitle map[string]int) map[string]int {
+	c := make(map[string]int, len(byTitle))
+	for k, v := range byTitle {
+		c[k] = v
+	}
+	return c
+}
+
+// ImportRetry is the request body of retries of staged imports.
+type ImportRetry struct {
+	// Rows are the positions of the failed entries retried; all if empty.
+	Rows []int `json:"rows"`
+}
+
+// NewImportRowsHandler returns a GET endpoint handler that lists the staged
+// entries of the latest import of the User given by the id path variable,
+// only those of the status given by the status query parameter if set. Only
+// the User may view them.
+func NewImportRowsHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator, q *ImportQueue,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			uID, _, ok := authorizeLibraryOwner(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+
+			var status *models.ImportRowStatus
+			if v := r.URL.Query().Get("status"); v != "" {
+				s, err := models.ParseImportRowStatus(v)
+				if err != nil {
+					web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing,
+						fmt.Errorf("query parameter %q: %w", "status", err), w)
+					return
+				}
+				status = &s
+			}
+
+			rows, err := q.Rows(uID, status)
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+			web.EncodeResponseBody(rows, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewImportRetryHandler returns a POST endpoint handler that stages the
+// failed entries of the latest import of the User given by the id path
+// variable to be imported again: those at the positions given in the request
+// body, or all of them if none are. Only the User may retry them.
+func NewImportRetryHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator, q *ImportQueue,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			uID, _, ok := authorizeLibraryOwner(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+
+			var body ImportRetry
+			buf, err := web.ReadRequestBody(r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorRequestBodyReading, err, w)
+				return
+			}
+			if len(buf) > 0 {
+				err = json.Unmarshal(buf, &body)
+				if err != nil {
+					web.EncodeResponseErrorBadRequest(web.ErrorRequestBodyParsing, err, w)
+					return
+				}
+			}
+
+			_, err = q.Retry(uID, body.Rows)
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+			web.EncodeResponseBody(q.Imports.Get(uID), w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
@@ -0,0 +1,76 @@
+package naos_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/jobs"
+	"github.com/Dophin2009/nao/internal/naos"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestImportQueue tests that staged entries are imported in batches, that
+// failed entries are kept with their errors, and that they can be retried.
+func TestImportQueue(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	q := naos.NewImportQueue(ds, naos.NewListImports(), jobs.NewManager(10), nil,
+		2, naos.DefaultImportInterval, nil)
+	uID := refs["spike"]
+	err := q.Enqueue(uID, []*naos.MALAnime{
+		{Title: "cowboy bebop: the movie", Status: "Completed", Score: 8},
+		{Title: "Samurai Champloo", Status: "Watching", WatchedEpisodes: 3},
+		{Title: "Trigun", Status: "Rewatching"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = q.Enqueue(uID, []*naos.MALAnime{{Title: "Trigun", Status: "Watching"}})
+	if !errors.Is(err, data.ErrConflict) {
+		t.Errorf("expected conflict while entries are pending, got %v", err)
+	}
+
+	n, err := q.Process()
+	if err != nil || n != 2 {
+		t.Fatalf("expected first batch of 2 imported, got %d: %v", n, err)
+	}
+	if s := q.Imports.Get(uID); s == nil || !s.Running {
+		t.Errorf("expected import to be running, got %+v", s)
+	}
+	n, err = q.Process()
+	if err != nil || n != 0 {
+		t.Fatalf("expected invalid entry to fail, got %d imported: %v", n, err)
+	}
+	s := q.Imports.Get(uID)
+	if s == nil || s.Running || s.Imported != 2 || s.Failed != 1 {
+		t.Fatalf("expected finished import with 2 imported and 1 failed, got %+v", s)
+	}
+
+	failed := models.ImportRowStatusFailed
+	rows, err := q.Rows(uID, &failed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Row != 3 || rows[0].Error == "" || rows[0].Attempts != 1 {
+		t.Fatalf("expected third entry failed once, got %+v", rows)
+	}
+
+	n, err = q.Retry(uID, []int{3})
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 entry retried, got %d: %v", n, err)
+	}
+	_, err = q.Process()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err = q.Rows(uID, &failed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Attempts != 2 {
+		t.Errorf("expected retried entry to fail again, got %+v", rows)
+	}
+}
@@ -0,0 +1,543 @@
+package naos
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jobs"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// IntegrityIssueKind describes a kind of inconsistency found in the database.
+type IntegrityIssueKind string
+
+const (
+	// IntegrityDangling means a relation references an entity that does not
+	// exist.
+	IntegrityDangling IntegrityIssueKind = "Dangling"
+	// IntegrityDuplicate means a relation pairs the same entities as an older
+	// relation.
+	IntegrityDuplicate IntegrityIssueKind = "Duplicate"
+	// IntegrityInvalidEnum means a record holds an enum value that is not
+	// valid.
+	IntegrityInvalidEnum IntegrityIssueKind = "InvalidEnum"
+	// IntegrityMissingInverse means a MediaRelation has no inverse from its
+	// related Media to its owning Media.
+	IntegrityMissingInverse IntegrityIssueKind = "MissingInverse"
+)
+
+// IntegrityIssue is a single inconsistency found in the database.
+type IntegrityIssue struct {
+	Bucket      string             `json:"bucket"`
+	ID          int                `json:"id"`
+	Kind        IntegrityIssueKind `json:"kind"`
+	Description string             `json:"description"`
+	Fixed       bool               `json:"fixed"`
+}
+
+// IntegrityReport lists the inconsistencies found in the relation buckets of
+// the database.
+type IntegrityReport struct {
+	// Checked is the number of records checked in each bucket.
+	Checked map[string]int    `json:"checked"`
+	Issues  []*IntegrityIssue `json:"issues"`
+}
+
+// CheckIntegrity walks the relation buckets of the given data layer and
+// reports dangling references, duplicate relation pairs, and invalid enum
+// values. If fix is true, dangling and duplicate relations are deleted and
+// invalid enum values are cleared, or set to Other for relationships of
+// MediaRelations. The checked buckets are reported to the
+// given Progress, if not nil.
+func CheckIntegrity(
+	ds *graphql.DataService, fix bool, p db.Progress,
+) (*IntegrityReport, error) {
+	rep := IntegrityReport{
+		Checked: map[string]int{},
+		Issues:  []*IntegrityIssue{},
+	}
+
+	err := ds.Database.Transaction(fix, func(tx db.Tx) error {
+		c := integrityChecker{ds: ds, tx: tx, rep: &rep, fix: fix, progress: p}
+		return c.check()
+	})
+	if p != nil {
+		p.Finish(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rep, nil
+}
+
+// integrityChecker holds the state of a single integrity check.
+type integrityChecker struct {
+	ds  *graphql.DataService
+	tx  db.Tx
+	rep *IntegrityReport
+	fix bool
+
+	progress db.Progress
+
+	// ids caches the sets of existing IDs by bucket
+	ids map[string]map[int]bool
+}
+
+// relation is the generic form of a relation record that is checked.
+type relation struct {
+	id int
+	// refs are the referenced entities, by service and ID
+	refs []relationRef
+	// pair identifies the entities paired by the relation, for duplicates
+	pair string
+}
+
+type relationRef struct {
+	ser db.Service
+	id  int
+}
+
+// integritySteps is the number of steps of a check reported as progress: one
+// for each relation bucket and one for enum values.
+const integritySteps = 10
+
+func (c *integrityChecker) check() error {
+	ds := c.ds
+	if c.progress != nil {
+		c.progress.SetTotal(integritySteps)
+	}
+
+	mcList, err := ds.MediaCharacterService.GetAll(nil, nil, c.tx)
+	if err != nil {
+		return fmt.Errorf("failed to get MediaCharacters: %w", err)
+	}
+	rels := make([]relation, len(mcList))
+	for i, mc := range mcList {
+		pair, err := ds.MediaCharacterService.UniqueKey(mc)
+		if err != nil {
+			return err
+		}
+		r := relation{
+			id:   mc.Meta.ID,
+			refs: []relationRef{{ds.MediaService, mc.MediaID}},
+			pair: pair,
+		}
+		if mc.CharacterID != nil {
+			r.refs = append(r.refs, relationRef{ds.CharacterService, *mc.CharacterID})
+		}
+		if mc.PersonID != nil {
+			r.refs = append(r.refs, relationRef{ds.PersonService, *mc.PersonID})
+		}
+		rels[i] = r
+	}
+	err = c.checkRelations(ds.MediaCharacterService, rels)
+	if err != nil {
+		return err
+	}
+
+	mgList, err := ds.MediaGenreService.GetAll(nil, nil, c.tx)
+	if err != nil {
+		return fmt.Errorf("failed to get MediaGenres: %w", err)
+	}
+	rels = make([]relation, len(mgList))
+	for i, mg := range mgList {
+		pair, err := ds.MediaGenreService.UniqueKey(mg)
+		if err != nil {
+			return err
+		}
+		rels[i] = relation{
+			id: mg.Meta.ID,
+			refs: []relationRef{
+				{ds.MediaService, mg.MediaID}, {ds.GenreService, mg.GenreID},
+			},
+			pair: pair,
+		}
+	}
+	err = c.checkRelations(ds.MediaGenreService, rels)
+	if err != nil {
+		return err
+	}
+
+	mpList, err := ds.MediaProducerService.GetAll(nil, nil, c.tx)
+	if err != nil {
+		return fmt.Errorf("failed to get MediaProducers: %w", err)
+	}
+	rels = make([]relation, len(mpList))
+	for i, mp := range mpList {
+		pair, err := ds.MediaProducerService.UniqueKey(mp)
+		if err != nil {
+			return err
+		}
+		rels[i] = relation{
+			id: mp.Meta.ID,
+			refs: []relationRef{
+				{ds.MediaService, mp.MediaID}, {ds.ProducerService, mp.ProducerID},
+			},
+			pair: pair,
+		}
+	}
+	err = c.checkRelations(ds.MediaProducerService, rels)
+	if err != nil {
+		return err
+	}
+
+	mrList, err := ds.MediaRelationSerivce.GetAll(nil, nil, c.tx)
+	if err != nil {
+		return fmt.Errorf("failed to get MediaRelations: %w", err)
+	}
+	rels = make([]relation, len(mrList))
+	for i, mr := range mrList {
+		rels[i] = relation{
+			id: mr.Meta.ID,
+			refs: []relationRef{
+				{ds.MediaService, mr.OwnerID}, {ds.MediaService, mr.RelatedID},
+			},
+			pair: fmt.Sprintf("%d/%d/%s", mr.OwnerID, mr.RelatedID, mr.Relationship),
+		}
+	}
+	err = c.checkRelations(ds.MediaRelationSerivce, rels)
+	if err != nil {
+		return err
+	}
+
+	msList, err := ds.MediaStaffService.GetAll(nil, nil, c.tx)
+	if err != nil {
+		return fmt.Errorf("failed to get MediaStaff: %w", err)
+	}
+	rels = make([]relation, len(msList))
+	for i, ms := range msList {
+		rels[i] = relation{
+			id: ms.Meta.ID,
+			refs: []relationRef{
+				{ds.MediaService, ms.MediaID}, {ds.PersonService, ms.PersonID},
+			},
+			pair: fmt.Sprintf("%d/%d/%s", ms.MediaID, ms.PersonID, ms.Role),
+		}
+		if ms.FirstEpisode != nil {
+			rels[i].pair += fmt.Sprintf("/%d", *ms.FirstEpisode)
+		}
+	}
+	err = c.checkRelations(ds.MediaStaffService, rels)
+	if err != nil {
+		return err
+	}
+
+	psList, err := ds.ProducerStaffService.GetAll(nil, nil, c.tx)
+	if err != nil {
+		return fmt.Errorf("failed to get ProducerStaff: %w", err)
+	}
+	rels = make([]relation, len(psList))
+	for i, ps := range psList {
+		rels[i] = relation{
+			id: ps.Meta.ID,
+			refs: []relationRef{
+				{ds.ProducerService, ps.ProducerID}, {ds.PersonService, ps.PersonID},
+			},
+			pair: fmt.Sprintf("%d/%d/%s", ps.ProducerID, ps.PersonID, ps.Role),
+		}
+		if ps.StartDate != nil {
+			rels[i].pair += "/" + ps.StartDate.Format(time.RFC3339)
+		}
+	}
+	err = c.checkRelations(ds.ProducerStaffService, rels)
+	if err != nil {
+		return err
+	}
+
+	rvList, err := ds.ReviewService.GetAll(nil, nil, c.tx)
+	if err != nil {
+		return fmt.Errorf("failed to get Reviews: %w", err)
+	}
+	rels = make([]relation, len(rvList))
+	for i, rv := range rvList {
+		rels[i] = relation{
+			id: rv.Meta.ID,
+			refs: []relationRef{
+				{ds.UserService, rv.UserID}, {ds.MediaService, rv.MediaID},
+			},
+			pair: fmt.Sprintf("%d/%d", rv.UserID, rv.MediaID),
+		}
+	}
+	err = c.checkRelations(ds.ReviewService, rels)
+	if err != nil {
+		return err
+	}
+
+	ufList, err := ds.UserFollowService.GetAll(nil, nil, c.tx)
+	if err != nil {
+		return fmt.Errorf("failed to get UserFollows: %w", err)
+	}
+	rels = make([]relation, len(ufList))
+	for i, uf := range ufList {
+		rels[i] = relation{
+			id: uf.Meta.ID,
+			refs: []relationRef{
+				{ds.UserService, uf.FollowerID}, {ds.UserService, uf.FolloweeID},
+			},
+			pair: fmt.Sprintf("%d/%d", uf.FollowerID, uf.FolloweeID),
+		}
+	}
+	err = c.checkRelations(ds.UserFollowService, rels)
+	if err != nil {
+		return err
+	}
+
+	umList, err := ds.UserMediaService.GetAll(nil, nil, c.tx)
+	if err != nil {
+		return fmt.Errorf("failed to get UserMedia: %w", err)
+	}
+	rels = make([]relation, len(umList))
+	for i, um := range umList {
+		pair, err := ds.UserMediaService.UniqueKey(um)
+		if err != nil {
+			return err
+		}
+		rels[i] = relation{
+			id: um.Meta.ID,
+			refs: []relationRef{
+				{ds.UserService, um.UserID}, {ds.MediaService, um.MediaID},
+			},
+			pair: pair,
+		}
+	}
+	err = c.checkRelations(ds.UserMediaService, rels)
+	if err != nil {
+		return err
+	}
+
+	// Check enum values of the remaining UserMedia
+	for _, um := range umList {
+		if um.Status == nil || um.Status.IsValid() ||
+			c.deleted(ds.UserMediaService, um.Meta.ID) {
+			continue
+		}
+
+		issue := c.report(ds.UserMediaService, um.Meta.ID, IntegrityInvalidEnum,
+			fmt.Sprintf("invalid status %d", int(*um.Status)))
+		if c.fix {
+			um.Status = nil
+			err = ds.UserMediaService.Update(um, c.tx)
+			if err != nil {
+				return fmt.Errorf("failed to clear status of UserMedia with ID %d: %w",
+					um.Meta.ID, err)
+			}
+			issue.Fixed = true
+		}
+	}
+
+	// Check enum values of the remaining MediaRelations
+	for _, mr := range mrList {
+		if mr.Relationship.IsValid() || c.deleted(ds.MediaRelationSerivce, mr.Meta.ID) {
+			continue
+		}
+
+		issue := c.report(ds.MediaRelationSerivce, mr.Meta.ID, IntegrityInvalidEnum,
+			fmt.Sprintf("invalid relationship %q", mr.Relationship))
+		if c.fix {
+			mr.Relationship = models.MediaRelationshipOther
+			err = c.tx.Database().Update(mr, ds.MediaRelationSerivce, c.tx)
+			if err != nil {
+				return fmt.Errorf("failed to clear relationship of MediaRelation with ID %d: %w",
+					mr.Meta.ID, err)
+			}
+			issue.Fixed = true
+		}
+	}
+
+	// Check that the remaining MediaRelations have inverses
+	remaining := map[string]bool{}
+	for _, mr := range mrList {
+		if !c.deleted(ds.MediaRelationSerivce, mr.Meta.ID) {
+			remaining[fmt.Sprintf("%d/%d/%s", mr.OwnerID, mr.RelatedID, mr.Relationship)] = true
+		}
+	}
+	for _, mr := range mrList {
+		inv := ds.MediaRelationSerivce.Inverse(mr.Relationship)
+		if c.deleted(ds.MediaRelationSerivce, mr.Meta.ID) ||
+			remaining[fmt.Sprintf("%d/%d/%s", mr.RelatedID, mr.OwnerID, inv)] {
+			continue
+		}
+
+		issue := c.report(ds.MediaRelationSerivce, mr.Meta.ID, IntegrityMissingInverse,
+			fmt.Sprintf("no %s relation from Media with ID %d", inv, mr.RelatedID))
+		if c.fix {
+			err = ds.MediaRelationSerivce.EnsureInverse(mr, c.tx)
+			if err != nil {
+				return err
+			}
+			issue.Fixed = true
+		}
+	}
+	c.advance()
+
+	return nil
+}
+
+// checkRelations reports the dangling and duplicate relations among the
+// given relations of the given service, deleting them if fixing.
+func (c *integrityChecker) checkRelations(ser db.Service, rels []relation) error {
+	defer c.advance()
+	c.rep.Checked[ser.Bucket()] = len(rels)
+
+	// Check older relations first so that they are kept over duplicates
+	sort.Slice(rels, func(i, j int) bool {
+		return rels[i].id < rels[j].id
+	})
+
+	seen := map[string]int{}
+	for _, r := range rels {
+		var issue *IntegrityIssue
+		for _, ref := range r.refs {
+			exists, err := c.exists(ref.ser, ref.id)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				issue = c.report(ser, r.id, IntegrityDangling,
+					fmt.Sprintf("references missing %s with ID %d", ref.ser.Bucket(), ref.id))
+				break
+			}
+		}
+
+		if issue == nil {
+			if orig, ok := seen[r.pair]; ok {
+				issue = c.report(ser, r.id, IntegrityDuplicate,
+					fmt.Sprintf("duplicates relation with ID %d", orig))
+			} else {
+				seen[r.pair] = r.id
+			}
+		}
+
+		if issue != nil && c.fix {
+			err := c.tx.Database().Delete(r.id, ser, c.tx)
+			if err != nil {
+				return fmt.Errorf("failed to delete %s with ID %d: %w",
+					ser.Bucket(), r.id, err)
+			}
+			issue.Fixed = true
+		}
+	}
+	return nil
+}
+
+// advance reports a finished step of the check.
+func (c *integrityChecker) advance() {
+	if c.progress != nil {
+		c.progress.Advance(1)
+	}
+}
+
+// exists returns true if the entity with the given ID exists in the bucket of
+// the given service.
+func (c *integrityChecker) exists(ser db.Service, id int) (bool, error) {
+	if c.ids == nil {
+		c.ids = map[string]map[int]bool{}
+	}
+
+	set, ok := c.ids[ser.Bucket()]
+	if !ok {
+		list, err := c.tx.Database().GetAll(nil, nil, ser, c.tx)
+		if err != nil {
+			return false, fmt.Errorf("failed to get all in %q: %w", ser.Bucket(), err)
+		}
+
+		set = make(map[int]bool, len(list))
+		for _, m := range list {
+			set[m.Metadata().ID] = true
+		}
+		c.ids[ser.Bucket()] = set
+	}
+	return set[id], nil
+}
+
+// deleted returns true if the record with the given ID was deleted by a fix.
+func (c *integrityChecker) deleted(ser db.Service, id int) bool {
+	for _, issue := range c.rep.Issues {
+		if issue.Bucket == ser.Bucket() && issue.ID == id && issue.Fixed {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *integrityChecker) report(
+	ser db.Service, id int, kind IntegrityIssueKind, desc string,
+) *IntegrityIssue {
+	issue := IntegrityIssue{
+		Bucket:      ser.Bucket(),
+		ID:          id,
+		Kind:        kind,
+		Description: desc,
+	}
+	c.rep.Issues = append(c.rep.Issues, &issue)
+	return &issue
+}
+
+// Dedupe deletes the relations of the given data layer that hold the unique
+// keys of older relations, such as MediaGenres of the same Media and Genre,
+// and returns the IDs of the deleted relations by bucket.
+func Dedupe(ds *graphql.DataService) (map[string][]int, error) {
+	sers := []db.UniqueService{
+		ds.MediaCharacterService,
+		ds.MediaGenreService,
+		ds.MediaProducerService,
+		ds.UserMediaService,
+	}
+
+	deleted := map[string][]int{}
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		for _, ser := range sers {
+			ids, err := tx.Database().Dedupe(ser, tx)
+			if err != nil {
+				return fmt.Errorf("failed to dedupe %s: %w", ser.Bucket(), err)
+			}
+			deleted[ser.Bucket()] = ids
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// NewIntegrityHandler returns an endpoint handler that reports the
+// inconsistencies in the database to Admin callers. GET requests only report
+// them; POST requests also fix them. The progress of checks is tracked as a
+// job.
+func NewIntegrityHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+	jm *jobs.Manager, fix bool,
+) web.Handler {
+	method := http.MethodGet
+	if fix {
+		method = http.MethodPost
+	}
+
+	return web.Handler{
+		Method: method,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			if !authorizeRole(w, r, ds, au, models.RoleAdmin) {
+				return
+			}
+
+			rep, err := CheckIntegrity(ds, fix, jm.Start(jobs.KindIntegrity))
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+			web.EncodeResponseBody(rep, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
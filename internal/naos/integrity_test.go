@@ -0,0 +1,119 @@
+package naos_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/naos"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestCheckIntegrity tests that duplicate relations are reported and deleted
+// when fixing.
+func TestCheckIntegrity(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	// Persist duplicates as they were before their uniqueness was enforced
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		_, err := ds.Database.DatabaseDriver.Create(&models.MediaGenre{
+			MediaID: refs["bebop"], GenreID: refs["scifi"],
+		}, ds.MediaGenreService, tx)
+		if err != nil {
+			return err
+		}
+		_, err = ds.Database.DatabaseDriver.Create(&models.UserMedia{
+			UserID: refs["spike"], MediaID: refs["bebop"],
+		}, ds.UserMediaService, tx)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to persist duplicates: %v", err)
+	}
+
+	rep, err := naos.CheckIntegrity(ds, false, nil)
+	if err != nil {
+		t.Fatalf("failed to check integrity: %v", err)
+	}
+	if len(rep.Issues) != 2 {
+		t.Fatalf("expected 2 issues, got %d", len(rep.Issues))
+	}
+	for _, issue := range rep.Issues {
+		if issue.Kind != naos.IntegrityDuplicate || issue.Fixed {
+			t.Errorf("expected unfixed duplicate, got %+v", *issue)
+		}
+	}
+
+	rep, err = naos.CheckIntegrity(ds, true, nil)
+	if err != nil {
+		t.Fatalf("failed to fix integrity: %v", err)
+	}
+	for _, issue := range rep.Issues {
+		if !issue.Fixed {
+			t.Errorf("expected fixed issue, got %+v", *issue)
+		}
+	}
+
+	rep, err = naos.CheckIntegrity(ds, false, nil)
+	if err != nil {
+		t.Fatalf("failed to check integrity: %v", err)
+	}
+	if len(rep.Issues) != 0 {
+		t.Errorf("expected no issues after fixing, got %d", len(rep.Issues))
+	}
+}
+
+// TestUniqueRelations tests that relations of the same entities are rejected,
+// and that existing duplicates are deleted by Dedupe.
+func TestUniqueRelations(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	var dupID int
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		_, err := ds.MediaGenreService.Create(&models.MediaGenre{
+			MediaID: refs["bebop"], GenreID: refs["scifi"],
+		}, tx)
+		if !errors.Is(err, db.ErrConflict) {
+			t.Errorf("expected conflict, got %v", err)
+		}
+
+		// Updates may not take the key of another relation either
+		id, err := ds.UserMediaService.Create(&models.UserMedia{
+			UserID: refs["spike"], MediaID: refs["movie"],
+		}, tx)
+		if err != nil {
+			return err
+		}
+		um, err := ds.UserMediaService.GetByID(id, tx)
+		if err != nil {
+			return err
+		}
+		um.MediaID = refs["bebop"]
+		err = ds.UserMediaService.Update(um, tx)
+		if !errors.Is(err, db.ErrConflict) {
+			t.Errorf("expected conflict, got %v", err)
+		}
+
+		dupID, err = ds.Database.DatabaseDriver.Create(&models.UserMedia{
+			UserID: refs["spike"], MediaID: refs["bebop"],
+		}, ds.UserMediaService, tx)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to create relations: %v", err)
+	}
+
+	deleted, err := naos.Dedupe(ds)
+	if err != nil {
+		t.Fatalf("failed to dedupe: %v", err)
+	}
+	if ids := deleted["UserMedia"]; len(ids) != 1 || ids[0] != dupID {
+		t.Errorf("expected UserMedia %d deleted, got %v", dupID, ids)
+	}
+	if ids := deleted["MediaGenre"]; len(ids) != 0 {
+		t.Errorf("expected no MediaGenres deleted, got %v", ids)
+	}
+}
@@ -0,0 +1,113 @@
+package naos
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jobs"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/models"
+	json "github.com/json-iterator/go"
+	"github.com/julienschmidt/httprouter"
+)
+
+// JobStreamKeepAlive is the interval at which comments are sent on idle job
+// streams so that proxies don't close them.
+const JobStreamKeepAlive = 15 * time.Second
+
+// NewJobsHandler returns a GET endpoint handler that lists the running and
+// recently finished jobs to Admin callers.
+func NewJobsHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator, jm *jobs.Manager,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			if !authorizeRole(w, r, ds, au, models.RoleAdmin) {
+				return
+			}
+			web.EncodeResponseBody(jm.Jobs(), w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewJobStreamHandler returns a GET endpoint handler that pushes the progress
+// of jobs to Admin callers as server-sent events. Each event, named "job",
+// holds the latest state of a single job; the states of all known jobs are
+// sent when the stream opens.
+func NewJobStreamHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator, jm *jobs.Manager,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Stream: true,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			if !authorizeRole(w, r, ds, au, models.RoleAdmin) {
+				return
+			}
+
+			flusher, ok := w.(http.Flusher)
+			if !ok {
+				web.EncodeResponseErrorInternalServer(web.ErrorInternalServer,
+					errors.New("response streaming is not supported"), w)
+				return
+			}
+
+			// Subscribe before listing so that no change is missed
+			sub := jm.Subscribe()
+			defer sub.Close()
+
+			w.Header().Set(web.HeaderContentType, "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("Connection", "keep-alive")
+			w.WriteHeader(http.StatusOK)
+
+			err := writeJobEvents(w, jm.Jobs())
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+
+			keepAlive := time.NewTicker(JobStreamKeepAlive)
+			defer keepAlive.Stop()
+			for {
+				select {
+				case <-r.Context().Done():
+					return
+				case <-keepAlive.C:
+					_, err = fmt.Fprint(w, ": keep-alive\n\n")
+				case <-sub.C():
+					err = writeJobEvents(w, sub.Next())
+				}
+				if err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		},
+	}
+}
+
+// writeJobEvents writes the given Jobs as server-sent events.
+func writeJobEvents(w http.ResponseWriter, list []jobs.Job) error {
+	for _, j := range list {
+		v, err := json.Marshal(j)
+		if err != nil {
+			return fmt.Errorf("failed to encode job: %w", err)
+		}
+		_, err = fmt.Fprintf(w, "event: job\ndata: %s\n\n", v)
+		if err != nil {
+			return fmt.Errorf("failed to write event: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package naos
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	json "github.com/json-iterator/go"
+	"github.com/julienschmidt/httprouter"
+)
+
+// BulkEditRequest is the request body of a bulk edit of a User's library.
+type BulkEditRequest struct {
+	UserMediaIDs []int                `json:"userMediaIDs"`
+	Edit         models.UserMediaEdit `json:"edit"`
+}
+
+// BulkEditResponse is the response body of a bulk edit of a User's library.
+type BulkEditResponse struct {
+	Changed int `json:"changed"`
+}
+
+// NewLibraryHealthHandler returns a GET endpoint handler that reports the
+// problems found in the library of the User given by the id path variable.
+// Callers other than the User may view it if the User's stats are visible to
+// them.
+func NewLibraryHealthHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+	staleAfter time.Duration,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			uID, _, ok := authorizeLibraryView(w, r, ps, ds, au, models.PrivacyStats)
+			if !ok {
+				return
+			}
+
+			var h *models.LibraryHealth
+			err := ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var err error
+				h, err = ds.UserMediaService.LibraryHealth(uID, staleAfter, time.Now(), tx)
+				if err != nil {
+					return fmt.Errorf("failed to report library health: %w", err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(h, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewLibraryBulkEditHandler returns a POST endpoint handler that applies a
+// single edit to many UserMedia in the library of the User given by the id
+// path variable, such as the fixes suggested by the library health report.
+// The score of the edit is in the ScoreFormat of the caller.
+func NewLibraryBulkEditHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		DryRun: true,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			uID, u, ok := authorizeLibraryOwner(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+
+			body, err := web.ReadRequestBody(r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorRequestBodyReading, err, w)
+				return
+			}
+			var req BulkEditRequest
+			err = json.Unmarshal(body, &req)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorRequestBodyParsing, err, w)
+				return
+			}
+			req.Edit.Score, err = data.NormalizeScoreAs(u, req.Edit.Score)
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorRequestBodyParsing, err, w)
+				return
+			}
+
+			var changed int
+			err = ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				changed, err = ds.UserMediaService.BulkEdit(
+					uID, req.UserMediaIDs, &req.Edit, tx)
+				if err != nil {
+					return fmt.Errorf("failed to bulk edit UserMedia: %w", err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(BulkEditResponse{Changed: changed}, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewContinueWatchingHandler returns a GET endpoint handler that lists the
+// Media the User given by the id path variable is in the middle of watching.
+// Callers other than the User may view it if the User's lists are visible to
+// them.
+func NewContinueWatchingHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			uID, u, ok := authorizeLibraryView(w, r, ps, ds, au, models.PrivacyLists)
+			if !ok {
+				return
+			}
+
+			var list []*models.ContinueWatching
+			err := ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var err error
+				list, err = ds.UserMediaService.ContinueWatching(uID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to list continue watching: %w", err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			format := data.ScoreFormatOf(u)
+			for _, cw := range list {
+				cw.UserMedia.Score = format.Display(cw.UserMedia.Score)
+			}
+			web.EncodeResponseBody(list, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// authorizeLibraryOwner returns the User ID given by the id path variable and
+// the caller if the caller is that User or an Admin. Otherwise, it encodes an
+// error response and returns false.
+func authorizeLibraryOwner(
+	w http.ResponseWriter, r *http.Request, ps httprouter.Params,
+	ds *graphql.DataService, au *jwt.Authenticator,
+) (int, *models.User, bool) {
+	uID, u, ok := libraryCaller(w, r, ps, ds, au)
+	if !ok {
+		return 0, nil, false
+	}
+	if u == nil {
+		web.EncodeResponseErrorUnauthorized(web.ErrorAuthentication,
+			errors.New("no credentials given"), w)
+		return 0, nil, false
+	}
+	err := data.AuthorizeOwner(u, uID)
+	if err != nil {
+		web.EncodeResponseErrorForbidden(web.ErrorAuthorization,
+			fmt.Errorf("library of User with ID %d: %w", uID, err), w)
+		return 0, nil, false
+	}
+
+	return uID, u, true
+}
+
+// authorizeLibraryView returns the User ID given by the id path variable and
+// the caller, which is nil for anonymous callers, if the caller may view the
+// data of the given scope of that User. Otherwise, it encodes an error
+// response and returns false.
+func authorizeLibraryView(
+	w http.ResponseWriter, r *http.Request, ps httprouter.Params,
+	ds *graphql.DataService, au *jwt.Authenticator, scope models.PrivacyScope,
+) (int, *models.User, bool) {
+	uID, u, ok := libraryCaller(w, r, ps, ds, au)
+	if !ok {
+		return 0, nil, false
+	}
+
+	err := ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+		return ds.UserService.AuthorizeViewAs(u, uID, scope, tx)
+	})
+	if errors.Is(err, data.ErrUnauthorized) {
+		err = fmt.Errorf("library of User with ID %d: %w", uID, err)
+		if u == nil {
+			web.EncodeResponseErrorUnauthorized(web.ErrorAuthentication, err, w)
+		} else {
+			web.EncodeResponseErrorForbidden(web.ErrorAuthorization, err, w)
+		}
+		return 0, nil, false
+	}
+	if err != nil {
+		web.EncodeResponseErrorFor(web.ErrorAuthorization, err, w)
+		return 0, nil, false
+	}
+
+	return uID, u, true
+}
+
+// libraryCaller returns the User ID given by the id path variable and the
+// caller of the request, which is nil for anonymous callers. If either
+// cannot be read, it encodes an error response and returns false.
+func libraryCaller(
+	w http.ResponseWriter, r *http.Request, ps httprouter.Params,
+	ds *graphql.DataService, au *jwt.Authenticator,
+) (int, *models.User, bool) {
+	uID, err := web.ParsePathVarInt("id", &ps)
+	if err != nil {
+		web.EncodeResponseErrorBadRequest(web.ErrorPathVariableParsing, err, w)
+		return 0, nil, false
+	}
+
+	u, err := RequestUser(r, ds, au)
+	if err != nil {
+		web.EncodeResponseErrorFor(web.ErrorAuthentication, err, w)
+		return 0, nil, false
+	}
+	return uID, u, true
+}
@@ -0,0 +1,132 @@
+package naos_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestLibraryHealth tests that duplicate UserMedia are reported oldest first,
+// with a fix that keeps the oldest, and that UserMedia of Media that no
+// longer exist are reported as orphaned.
+func TestLibraryHealth(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	uID := refs["spike"]
+	var dupID, orphanID int
+	// Persist them as they were before their uniqueness and Media were
+	// checked; the duplicate is older than the UserMedia it duplicates,
+	// though its ID is greater
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		var err error
+		dupID, err = ds.Database.DatabaseDriver.Create(&models.UserMedia{
+			Meta:   db.ModelMetadata{CreatedAt: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)},
+			UserID: uID, MediaID: refs["bebop"],
+		}, ds.UserMediaService, tx)
+		if err != nil {
+			return err
+		}
+		orphanID, err = ds.Database.DatabaseDriver.Create(&models.UserMedia{
+			UserID: uID, MediaID: refs["bebop"] + 1000,
+		}, ds.UserMediaService, tx)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to persist UserMedia: %v", err)
+	}
+
+	var h *models.LibraryHealth
+	err = ds.Database.Transaction(false, func(tx db.Tx) error {
+		var err error
+		h, err = ds.UserMediaService.LibraryHealth(uID, 0, time.Now(), tx)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to check library health: %v", err)
+	}
+
+	expected := [][]int{{dupID, refs["watching"]}}
+	if !reflect.DeepEqual(h.Duplicates, expected) {
+		t.Errorf("expected duplicates %v, got %v", expected, h.Duplicates)
+	}
+	if !reflect.DeepEqual(h.Orphaned, []int{orphanID}) {
+		t.Errorf("expected orphaned %v, got %v", []int{orphanID}, h.Orphaned)
+	}
+	fixes := map[models.LibraryIssue][]int{}
+	for _, fix := range h.Fixes {
+		fixes[fix.Issue] = fix.UserMediaIDs
+	}
+	if !reflect.DeepEqual(fixes[models.LibraryIssueDuplicate], []int{refs["watching"]}) {
+		t.Errorf("expected fix to delete %d, got %v",
+			refs["watching"], fixes[models.LibraryIssueDuplicate])
+	}
+	if !reflect.DeepEqual(fixes[models.LibraryIssueOrphaned], []int{orphanID}) {
+		t.Errorf("expected fix to delete %d, got %v",
+			orphanID, fixes[models.LibraryIssueOrphaned])
+	}
+}
+
+// TestBulkEditRollback tests that a bulk edit that fails partway is undone
+// along with its transaction.
+func TestBulkEditRollback(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	uID := refs["spike"]
+	var orphanID int
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		var err error
+		orphanID, err = ds.Database.DatabaseDriver.Create(&models.UserMedia{
+			UserID: uID, MediaID: refs["bebop"] + 1000,
+		}, ds.UserMediaService, tx)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to persist UserMedia: %v", err)
+	}
+
+	// The orphaned UserMedia fails validation after the other is edited
+	dropped := models.WatchStatusDropped
+	err = ds.Database.Transaction(true, func(tx db.Tx) error {
+		_, err := ds.UserMediaService.BulkEdit(uID, []int{refs["watching"], orphanID},
+			&models.UserMediaEdit{Status: &dropped}, tx)
+		return err
+	})
+	if err == nil || !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("expected bulk edit to fail with not found, got %v", err)
+	}
+
+	err = ds.Database.Transaction(false, func(tx db.Tx) error {
+		um, err := ds.UserMediaService.GetByID(refs["watching"], tx)
+		if err != nil {
+			return err
+		}
+		if um.Status == nil || *um.Status != models.WatchStatusCompleted {
+			t.Errorf("expected status %v to be kept, got %v",
+				models.WatchStatusCompleted, um.Status)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to get UserMedia: %v", err)
+	}
+
+	// The orphaned UserMedia are deleted by their fix
+	err = ds.Database.Transaction(true, func(tx db.Tx) error {
+		n, err := ds.UserMediaService.BulkEdit(uID, []int{orphanID},
+			&models.UserMediaEdit{Delete: true}, tx)
+		if err == nil && n != 1 {
+			t.Errorf("expected 1 UserMedia deleted, got %d", n)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to delete orphaned UserMedia: %v", err)
+	}
+}
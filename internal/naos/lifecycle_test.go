@@ -0,0 +1,64 @@
+package naos_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestLifecycle tests that registered hooks are called inside transactions,
+// aborting them on errors, and after commits, but not after rollbacks.
+func TestLifecycle(t *testing.T) {
+	ds, _, cleanup := naostest.NewDataService(t)
+	defer cleanup()
+
+	errRejected := errors.New("rejected")
+	bucket := ds.GenreService.Bucket()
+	ds.Lifecycle.Register(bucket, db.BeforeCreate,
+		func(m db.Model, _ db.Service, _ db.Tx) error {
+			if m.(*models.Genre).Names[0].String == "Rejected" {
+				return errRejected
+			}
+			return nil
+		})
+	var created []int
+	ds.Lifecycle.RegisterCommitted(bucket, db.AfterCreate,
+		func(m db.Model, _ db.Service) {
+			created = append(created, m.Metadata().ID)
+		})
+
+	create := func(name string, rollback bool) (int, error) {
+		var id int
+		err := ds.Database.Transaction(true, func(tx db.Tx) error {
+			var err error
+			id, err = ds.GenreService.Create(&models.Genre{
+				Names: []models.Title{{String: name, Language: "en"}},
+			}, tx)
+			if err == nil && rollback {
+				return errors.New("rolled back")
+			}
+			return err
+		})
+		return id, err
+	}
+
+	id, err := create("Mecha", false)
+	if err != nil {
+		t.Fatalf("failed to create Genre: %v", err)
+	}
+	_, err = create("Rejected", false)
+	if !errors.Is(err, errRejected) {
+		t.Errorf("expected hook to reject Genre, got %v", err)
+	}
+	_, err = create("Isekai", true)
+	if err == nil {
+		t.Fatalf("expected transaction to be rolled back")
+	}
+
+	if len(created) != 1 || created[0] != id {
+		t.Errorf("expected committed hook to be called for Genre %d only, got %v", id, created)
+	}
+}
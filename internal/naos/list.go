@@ -0,0 +1,103 @@
+package naos
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// ListReorderRequest is the request body of a change to the sections and
+// order of the entries of a UserMediaList.
+type ListReorderRequest struct {
+	// Sections, if present, replaces the sections of the list. Sections given
+	// without an ID are created.
+	Sections []models.UserMediaListSection `json:"sections"`
+	// Moves are applied in order, after the sections are replaced.
+	Moves []models.UserMediaListMove `json:"moves"`
+}
+
+// NewListHandler returns a GET endpoint handler for the UserMediaList given
+// by the id path variable, if the lists of its User are visible to the
+// caller.
+func NewListHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			id, u, ok := libraryCaller(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+
+			var uml *models.UserMediaList
+			err := ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var err error
+				uml, err = ds.UserMediaListService.GetByIDAs(u, id, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get UserMediaList by ID %d: %w", id, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(uml, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewListReorderHandler returns a PATCH endpoint handler that replaces the
+// sections of the UserMediaList given by the id path variable and moves its
+// entries between sections and positions, all at once. Only the User and
+// Admins may change it.
+func NewListReorderHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPatch,
+		Path:   path,
+		DryRun: true,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			id, u, ok := authenticatedCaller(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+			var req ListReorderRequest
+			if !parseRequestBody(w, r, &req) {
+				return
+			}
+
+			var uml *models.UserMediaList
+			err := ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				var err error
+				uml, err = ds.UserMediaListService.ReorderAs(u, id, req.Sections, req.Moves, tx)
+				if err != nil {
+					return fmt.Errorf("failed to reorder UserMediaList with ID %d: %w", id, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(uml, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
@@ -0,0 +1,76 @@
+package naos_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestListReorder tests that entries of a UserMediaList are moved between
+// sections and kept ordered by section.
+func TestListReorder(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	owner := &models.User{Meta: db.ModelMetadata{ID: refs["spike"]}}
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		_, err := ds.UserMediaService.Create(&models.UserMedia{
+			UserID: owner.Meta.ID, MediaID: refs["movie"],
+		}, tx)
+		if err != nil {
+			return err
+		}
+		umList, err := ds.UserMediaService.GetByUser(owner.Meta.ID, nil, nil, tx)
+		if err != nil {
+			return err
+		}
+		a, b := umList[0].Meta.ID, umList[1].Meta.ID
+
+		uml := models.UserMediaList{UserID: owner.Meta.ID, UserMedia: []int{a, b}}
+		id, err := ds.UserMediaListService.CreateAs(owner, &uml, tx)
+		if err != nil {
+			return err
+		}
+
+		// Move the first entry into a new section, and the second before it
+		sections := []models.UserMediaListSection{
+			{Names: []models.Title{{String: "Favorites"}}},
+		}
+		got, err := ds.UserMediaListService.ReorderAs(owner, id, sections, nil, tx)
+		if err != nil {
+			return err
+		}
+		secID := got.Sections[0].ID
+		got, err = ds.UserMediaListService.ReorderAs(owner, id, nil,
+			[]models.UserMediaListMove{
+				{UserMediaID: a, SectionID: &secID},
+				{UserMediaID: b, SectionID: &secID, Position: 0},
+			}, tx)
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(got.UserMedia, []int{b, a}) {
+			t.Errorf("expected entries %v, got %v", []int{b, a}, got.UserMedia)
+		}
+
+		// Move the second entry out of the section, before the first
+		got, err = ds.UserMediaListService.ReorderAs(owner, id, nil,
+			[]models.UserMediaListMove{{UserMediaID: a, Position: 5}}, tx)
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(got.UserMedia, []int{a, b}) {
+			t.Errorf("expected entries %v, got %v", []int{a, b}, got.UserMedia)
+		}
+		if s, ok := got.EntrySections[a]; ok {
+			t.Errorf("expected entry %d in no section, got section %d", a, s)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to reorder list: %v", err)
+	}
+}
@@ -0,0 +1,24 @@
+package naos
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/Dophin2009/nao/internal/web"
+)
+
+// Listen returns the listener the HTTP API is served on as given in the
+// configuration: the socket passed by systemd if listen.systemd is set, the
+// Unix domain socket at listen.socket if set, or else the TCP address of
+// hostname and port.
+func Listen(c *Configuration) (net.Listener, error) {
+	lc := c.Listen
+	switch {
+	case lc.Systemd:
+		return web.SystemdListener(lc.SystemdName)
+	case lc.Socket != "":
+		return web.ListenUnix(lc.Socket, os.FileMode(lc.SocketMode))
+	}
+	return net.Listen("tcp", fmt.Sprintf("%s:%s", c.Hostname, c.Port))
+}
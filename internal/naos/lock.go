@@ -0,0 +1,135 @@
+package naos
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// DefaultLockTTL is how long Locks are held for if not requested or
+// configured, and DefaultLockMaxTTL the longest that may be requested.
+const (
+	DefaultLockTTL    = 15 * time.Minute
+	DefaultLockMaxTTL = 24 * time.Hour
+)
+
+// NewMediaLockHandler returns a POST endpoint handler that locks the Media
+// given by the id path variable for the caller, for the number of seconds
+// given by the ttl query parameter up to maxTTL, or ttl by default, so that
+// other Users may not change it meanwhile. Locking the Media again renews the
+// Lock. Media locked by another User are refused with 423 Locked. Only
+// Moderators may lock Media.
+func NewMediaLockHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+	ttl time.Duration, maxTTL time.Duration,
+) web.Handler {
+	if ttl <= 0 {
+		ttl = DefaultLockTTL
+	}
+	if maxTTL <= 0 {
+		maxTTL = DefaultLockMaxTTL
+	}
+
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			u, ok := authorizeRoleUser(w, r, ds, au, models.RoleModerator)
+			if !ok {
+				return
+			}
+			mID, err := web.ParsePathVarInt("id", &ps)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorPathVariableParsing, err, w)
+				return
+			}
+			seconds, err := web.ParseQueryInt("ttl", r)
+			if err == nil && seconds != nil && *seconds <= 0 {
+				err = fmt.Errorf("query parameter %q: must be positive: %w", "ttl",
+					data.ErrInvalid)
+			}
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+				return
+			}
+			d := ttl
+			if seconds != nil {
+				d = time.Duration(*seconds) * time.Second
+			}
+			if d > maxTTL {
+				d = maxTTL
+			}
+
+			var l *models.Lock
+			err = ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				_, err := ds.MediaService.GetByID(mID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get Media by ID %d: %w", mID, err)
+				}
+
+				now := time.Now()
+				l, err = ds.LockService.Lock(ds.MediaService.Bucket(), mID, u.Meta.ID,
+					now.Add(d), now, tx)
+				if err != nil {
+					return fmt.Errorf("failed to lock Media with ID %d: %w", mID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+			web.EncodeResponseBody(l, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewMediaUnlockHandler returns a DELETE endpoint handler that releases the
+// Lock of the Media given by the id path variable. Only the User holding the
+// Lock may release it before it expires, unless the force query parameter is
+// true and the caller is an Admin. Only Moderators may unlock Media.
+func NewMediaUnlockHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodDelete,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			u, ok := authorizeRoleUser(w, r, ds, au, models.RoleModerator)
+			if !ok {
+				return
+			}
+			mID, err := web.ParsePathVarInt("id", &ps)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorPathVariableParsing, err, w)
+				return
+			}
+			force := r.URL.Query().Get("force") == "true"
+
+			err = ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				err := ds.LockService.Unlock(u, ds.MediaService.Bucket(), mID, force,
+					time.Now(), tx)
+				if err != nil {
+					return fmt.Errorf("failed to unlock Media with ID %d: %w", mID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		},
+	}
+}
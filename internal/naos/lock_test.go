@@ -0,0 +1,97 @@
+package naos_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestMediaLock tests that Media locked by a User are only changed by that
+// User until the Lock expires or is released, and that only Admins may force
+// the Locks of others.
+func TestMediaLock(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	bucket := ds.MediaService.Bucket()
+	mID := refs["bebop"]
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		spike, err := ds.UserService.GetByID(refs["spike"], tx)
+		if err != nil {
+			return err
+		}
+		faye, err := ds.UserService.GetByID(refs["faye"], tx)
+		if err != nil {
+			return err
+		}
+		md, err := ds.MediaService.GetByID(mID, tx)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		_, err = ds.LockService.Lock(bucket, mID, spike.Meta.ID, now.Add(time.Hour), now, tx)
+		if err != nil {
+			return err
+		}
+		_, err = ds.LockService.Lock(bucket, mID, faye.Meta.ID, now.Add(time.Hour), now, tx)
+		if !errors.Is(err, data.ErrLocked) {
+			t.Errorf("expected Lock of another User to be refused, got %v", err)
+		}
+		err = ds.MediaService.UpdateAs(faye, md, tx)
+		if !errors.Is(err, data.ErrLocked) {
+			t.Errorf("expected update by another User to be refused, got %v", err)
+		}
+		err = ds.MediaService.UpdateAs(spike, md, tx)
+		if err != nil {
+			t.Errorf("expected update by the holder, got %v", err)
+		}
+
+		err = ds.LockService.Unlock(faye, bucket, mID, false, now, tx)
+		if !errors.Is(err, data.ErrLocked) {
+			t.Errorf("expected unlock by another User to be refused, got %v", err)
+		}
+		err = ds.LockService.Unlock(faye, bucket, mID, true, now, tx)
+		if !errors.Is(err, data.ErrUnauthorized) {
+			t.Errorf("expected forced unlock by non-Admin to be refused, got %v", err)
+		}
+		faye.Permissions = models.UserPermission{WriteMedia: true, WriteUsers: true}
+		err = ds.LockService.Unlock(faye, bucket, mID, true, now, tx)
+		if err != nil {
+			t.Errorf("expected forced unlock by Admin, got %v", err)
+		}
+
+		// Expired Locks are taken over
+		_, err = ds.LockService.Lock(bucket, mID, spike.Meta.ID, now.Add(time.Minute), now, tx)
+		if err != nil {
+			return err
+		}
+		later := now.Add(time.Hour)
+		_, err = ds.LockService.Lock(bucket, mID, faye.Meta.ID, later.Add(time.Hour), later, tx)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Locks are deleted with the locked Media
+	err = ds.Database.Transaction(true, func(tx db.Tx) error {
+		err := ds.MediaService.Delete(mID, tx)
+		if err != nil {
+			return err
+		}
+		_, err = ds.LockService.GetByEntity(bucket, mID, tx)
+		if !errors.Is(err, data.ErrNotFound) {
+			t.Errorf("expected Lock to be deleted with Media, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,117 @@
+package naos
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// LoginSessions is the response body of the login sessions of a User.
+type LoginSessions struct {
+	// Current is the ID of the session of the request, if any.
+	Current  *int                   `json:"current"`
+	Sessions []*models.LoginSession `json:"sessions"`
+}
+
+// NewLoginSessionsHandler returns a GET endpoint handler that lists the
+// unexpired login sessions of the caller, most recently used first.
+func NewLoginSessionsHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			u, ok := loginCaller(w, r, ds, au)
+			if !ok {
+				return
+			}
+
+			res := LoginSessions{}
+			if session := RequestSession(r, au); session != 0 {
+				res.Current = &session
+			}
+			err := ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var err error
+				res.Sessions, err = ds.LoginSessionService.GetByUser(u.Meta.ID, time.Now(), tx)
+				if err != nil {
+					return fmt.Errorf("failed to get LoginSessions by User ID %d: %w",
+						u.Meta.ID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(res, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewLoginSessionRevokeHandler returns a DELETE endpoint handler that revokes
+// the login session of the caller given by the id path variable, so that its
+// tokens are no longer accepted.
+func NewLoginSessionRevokeHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodDelete,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			id, err := web.ParsePathVarInt("id", &ps)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorPathVariableParsing, err, w)
+				return
+			}
+			u, ok := loginCaller(w, r, ds, au)
+			if !ok {
+				return
+			}
+
+			err = ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				return ds.LoginSessionService.Revoke(id, u.Meta.ID, tx)
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(struct{}{}, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// loginCaller returns the User authenticated by the given request. If there
+// is none, it encodes an error response and returns false.
+func loginCaller(
+	w http.ResponseWriter, r *http.Request, ds *graphql.DataService,
+	au *jwt.Authenticator,
+) (*models.User, bool) {
+	u, err := RequestUser(r, ds, au)
+	if err != nil {
+		web.EncodeResponseErrorFor(web.ErrorAuthentication, err, w)
+		return nil, false
+	}
+	if u == nil {
+		web.EncodeResponseErrorUnauthorized(web.ErrorAuthentication,
+			errors.New("no credentials given"), w)
+		return nil, false
+	}
+	return u, true
+}
@@ -0,0 +1,65 @@
+package naos_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// TestLoginSession tests that login sessions are listed until they expire or
+// are revoked, after which they are no longer accepted.
+func TestLoginSession(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	spike := refs["spike"]
+	now := time.Date(2020, 4, 1, 20, 0, 0, 0, time.UTC)
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		ser := ds.LoginSessionService
+		laptop, err := ser.Start(spike, "laptop", "10.0.0.1", now, now.Add(time.Hour), tx)
+		if err != nil {
+			return err
+		}
+		phone, err := ser.Start(spike, "phone", "10.0.0.2", now, now.Add(time.Hour), tx)
+		if err != nil {
+			return err
+		}
+		_, err = ser.Use(laptop.Meta.ID, spike, "", now.Add(time.Minute), time.Time{}, tx)
+		if err != nil {
+			return err
+		}
+
+		list, err := ser.GetByUser(spike, now.Add(time.Minute), tx)
+		if err != nil {
+			return err
+		}
+		if len(list) != 2 || list[0].Device != "laptop" {
+			t.Errorf("expected laptop session first of 2, got %d sessions", len(list))
+		}
+
+		err = ser.Revoke(phone.Meta.ID, spike+1, tx)
+		if !errors.Is(err, data.ErrNotFound) {
+			t.Errorf("expected session of other User to be not found, got %v", err)
+		}
+		err = ser.Revoke(phone.Meta.ID, spike, tx)
+		if err != nil {
+			return err
+		}
+		_, err = ser.Verify(phone.Meta.ID, spike, now, tx)
+		if !errors.Is(err, data.ErrUnauthorized) {
+			t.Errorf("expected revoked session to be unauthorized, got %v", err)
+		}
+		_, err = ser.Verify(laptop.Meta.ID, spike, now.Add(2*time.Hour), tx)
+		if !errors.Is(err, data.ErrUnauthorized) {
+			t.Errorf("expected expired session to be unauthorized, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to manage login sessions: %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package naos
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/mail"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// NewMailQueue returns the queue of the email messages sent to Users as
+// given in the configuration, or nil if mail is disabled.
+func NewMailQueue(c *Configuration) *mail.Queue {
+	mc := c.Mail
+
+	var sender mail.Sender
+	switch {
+	case mc.DryRun:
+		sender = &mail.LogSender{Log: func(m *mail.Message) {
+			log.WithFields(log.Fields{
+				"to":      m.To,
+				"subject": m.Subject,
+			}).Infof("Dry run, not sending message:\n%s", m.Body)
+		}}
+	case mc.Host != "":
+		port := mc.Port
+		if port == "" {
+			port = "25"
+		}
+		sender = &mail.SMTPSender{
+			Host:     mc.Host,
+			Port:     port,
+			Username: mc.Username,
+			Password: mc.Password,
+			From:     mc.From,
+		}
+	default:
+		return nil
+	}
+
+	q := mail.NewQueue(sender, mc.QueueSize, mc.Retries, func(err error) {
+		log.Errorf("Failed to send message: %v", err)
+	})
+	q.RetryDelay = mc.RetryDelay
+	return q
+}
+
+// DigestScheduler periodically sends Users digests of the Episodes aired
+// since the previous run of the Media they are watching.
+type DigestScheduler struct {
+	DataLayer *graphql.DataService
+	Queue     *mail.Queue
+	// Interval is the duration between runs.
+	Interval time.Duration
+	// OnError is called with the errors encountered while sending digests in
+	// the background.
+	OnError func(error)
+
+	sched schedule
+}
+
+// NewDigestScheduler returns a DigestScheduler for the given data layer and
+// mail queue.
+func NewDigestScheduler(
+	ds *graphql.DataService, q *mail.Queue, interval time.Duration,
+	onError func(error),
+) *DigestScheduler {
+	return &DigestScheduler{
+		DataLayer: ds,
+		Queue:     q,
+		Interval:  interval,
+		OnError:   onError,
+	}
+}
+
+// Start begins sending digests of the Episodes aired from now on, at every
+// interval.
+func (s *DigestScheduler) Start() error {
+	err := s.sched.start(s.Interval, func(from time.Time, to time.Time) error {
+		var msgs []*mail.Message
+		err := s.DataLayer.Database.Transaction(false, func(tx db.Tx) error {
+			var err error
+			msgs, err = AiringDigests(s.DataLayer, from, to, tx)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		// Digests not queued are dropped rather than sent twice
+		for _, m := range msgs {
+			err = s.Queue.Enqueue(m)
+			if err != nil && s.OnError != nil {
+				s.OnError(err)
+			}
+		}
+		return nil
+	}, s.OnError)
+	if err != nil {
+		return fmt.Errorf("failed to start digest scheduler: %w", err)
+	}
+	return nil
+}
+
+// Stop stops sending digests and waits for a run in progress to finish.
+func (s *DigestScheduler) Stop() {
+	s.sched.halt()
+}
+
+// AiringDigests returns the digests of the Episodes that Users with email
+// addresses were notified of airing in the period after the given start time,
+// up to and including the given end time.
+func AiringDigests(
+	ds *graphql.DataService, from time.Time, to time.Time, tx db.Tx,
+) ([]*mail.Message, error) {
+	notifications, err := ds.NotificationService.GetFilter(nil, nil, tx,
+		func(n *models.Notification) bool {
+			created := n.Meta.CreatedAt
+			return n.Kind == models.NotificationEpisodeAired && n.MediaID != nil &&
+				created.After(from) && !created.After(to)
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Notifications: %w", err)
+	}
+
+	// Count the aired Episodes of each Media by User
+	counts := map[int]map[int]int{}
+	for _, n := range notifications {
+		if counts[n.UserID] == nil {
+			counts[n.UserID] = map[int]int{}
+		}
+		counts[n.UserID][*n.MediaID]++
+	}
+	uIDs := make([]int, 0, len(counts))
+	for uID := range counts {
+		uIDs = append(uIDs, uID)
+	}
+	sort.Ints(uIDs)
+
+	titles := map[int]string{}
+	msgs := []*mail.Message{}
+	for _, uID := range uIDs {
+		u, err := ds.UserService.GetByID(uID, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get User by ID %d: %w", uID, err)
+		}
+		if u.Email == "" || u.Disabled {
+			continue
+		}
+
+		digest := mail.AiringDigestData{Username: u.Username}
+		for mID, n := range counts[uID] {
+			if _, ok := titles[mID]; !ok {
+				md, err := ds.MediaService.GetByID(mID, tx)
+				if errors.Is(err, data.ErrNotFound) {
+					// The Media was deleted since
+					continue
+				}
+				if err != nil {
+					return nil, fmt.Errorf("failed to get Media by ID %d: %w", mID, err)
+				}
+				titles[mID] = mediaTitle(md)
+			}
+			digest.Entries = append(digest.Entries, mail.AiringDigestEntry{
+				Title:    titles[mID],
+				Episodes: n,
+			})
+		}
+		sort.Slice(digest.Entries, func(i, j int) bool {
+			return digest.Entries[i].Title < digest.Entries[j].Title
+		})
+
+		m, err := mail.AiringDigest.Render(u.Email, digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render digest for User with ID %d: %w", uID, err)
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, nil
+}
+
+// mediaTitle returns the preferred title of the given Media.
+func mediaTitle(md *models.Media) string {
+	t := models.SelectTitle(md.Titles, nil)
+	if t == nil {
+		return fmt.Sprintf("Media %d", md.Meta.ID)
+	}
+	return t.String
+}
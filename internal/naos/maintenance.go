@@ -0,0 +1,58 @@
+package naos
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// MaintenanceRequest is the request body to switch maintenance mode.
+type MaintenanceRequest struct {
+	Enabled bool `json:"enabled"`
+	// RetryAfter is the number of seconds callers are told to wait before
+	// retrying refused writes; the default if not positive.
+	RetryAfter int `json:"retryAfter"`
+}
+
+// NewMaintenanceHandler returns an endpoint handler for maintenance mode.
+// GET requests return whether the server is in maintenance mode and PUT
+// requests switch it as given in the request body if update is true. Only
+// Admins may switch it, even while in maintenance mode.
+func NewMaintenanceHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator, m *web.Maintenance,
+	update bool,
+) web.Handler {
+	method := http.MethodGet
+	if update {
+		method = http.MethodPut
+	}
+
+	return web.Handler{
+		Method: method,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			if update {
+				if !authorizeRole(w, r, ds, au, models.RoleAdmin) {
+					return
+				}
+				var req MaintenanceRequest
+				if !parseRequestBody(w, r, &req) {
+					return
+				}
+				m.Set(req.Enabled, time.Duration(req.RetryAfter)*time.Second)
+			}
+
+			web.EncodeResponseBody(m.State(), w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+		// Maintenance mode must be switched off while in it
+		AllowInMaintenance: true,
+	}
+}
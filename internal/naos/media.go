@@ -0,0 +1,795 @@
+package naos
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// MaxMediaIDs is the most Media that may be asked for by ID at once.
+const MaxMediaIDs = 100
+
+// NewMediaByIDsHandler returns a GET endpoint handler that lists the Media
+// with the comma-separated IDs given by the ids query parameter, in the order
+// of the IDs and null for those of no Media, with their Titles ordered for
+// the Accept-Language header.
+func NewMediaByIDsHandler(path []string, ds *graphql.DataService) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			ids, err := parseQueryIntList("ids", r)
+			if err == nil && len(ids) == 0 {
+				err = fmt.Errorf("query parameter %q: %w", "ids", data.ErrInvalid)
+			}
+			if err == nil && len(ids) > MaxMediaIDs {
+				err = fmt.Errorf("query parameter %q: more than %d IDs: %w", "ids",
+					MaxMediaIDs, data.ErrInvalid)
+			}
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+				return
+			}
+
+			var list []*models.Media
+			err = ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				list, err = ds.MediaService.GetByIDs(ids, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get Media by IDs: %w", err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			langs := models.ParseAcceptLanguage(r.Header.Get(web.HeaderAcceptLanguage))
+			for _, md := range list {
+				if md != nil {
+					md.Titles = models.LocalizeTitles(md.Titles, langs)
+				}
+			}
+			web.EncodeResponseBody(list, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewMediaBySlugHandler returns a GET endpoint handler that responds with the
+// Media given by the slug path variable, with its Titles ordered for the
+// Accept-Language header.
+func NewMediaBySlugHandler(path []string, ds *graphql.DataService) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			slug := ps.ByName("slug")
+
+			var md *models.Media
+			err := ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var err error
+				md, err = ds.MediaService.GetBySlug(slug, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get Media by slug %q: %w", slug, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			langs := models.ParseAcceptLanguage(r.Header.Get(web.HeaderAcceptLanguage))
+			md.Titles = models.LocalizeTitles(md.Titles, langs)
+			web.EncodeResponseBody(md, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// MediaCount is the number of Media that pass some filter.
+type MediaCount struct {
+	Count int `json:"count"`
+}
+
+// NewMediaCountHandler returns a GET endpoint handler that counts the Media,
+// only those of the type, source, premiere year and quarter, and release
+// statuses given by the query parameters of the same names, if given. Types
+// and sources are matched ignoring case.
+func NewMediaCountHandler(path []string, ds *graphql.DataService) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			keep, err := parseMediaFilter(r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+				return
+			}
+
+			var res MediaCount
+			err = ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				res.Count, err = ds.MediaService.Count(tx, keep)
+				if err != nil {
+					return fmt.Errorf("failed to count Media: %w", err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(res, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// parseMediaFilter returns the filter of Media given by the type, source,
+// year, quarter, releaseStatus and q query parameters of the given request,
+// or nil if none are given. The releaseStatus parameter is a comma-separated
+// list of ReleaseStatuses, any of which the Media may have, and q is a query
+// expression over the fields of data.MediaQuery.
+func parseMediaFilter(r *http.Request) (func(md *models.Media) bool, error) {
+	q := r.URL.Query()
+	expr := func(*models.Media) bool { return true }
+	if v := q.Get("q"); v != "" {
+		var err error
+		expr, err = data.CompileMediaQuery(v)
+		if err != nil {
+			return nil, fmt.Errorf("query parameter %q: %w", "q", err)
+		}
+	}
+	typ := q.Get("type")
+	source := q.Get("source")
+	year, err := web.ParseQueryInt("year", r)
+	if err != nil {
+		return nil, err
+	}
+	var quarter *models.Quarter
+	if v := q.Get("quarter"); v != "" {
+		qt, err := parseQuarter(v)
+		if err != nil {
+			return nil, fmt.Errorf("query parameter %q: %w", "quarter", err)
+		}
+		quarter = &qt
+	}
+	var statuses []models.ReleaseStatus
+	if v := q.Get("releaseStatus"); v != "" {
+		for _, name := range strings.Split(v, ",") {
+			s, err := parseReleaseStatus(name)
+			if err != nil {
+				return nil, fmt.Errorf("query parameter %q: %w", "releaseStatus", err)
+			}
+			statuses = append(statuses, s)
+		}
+	}
+
+	if typ == "" && source == "" && year == nil && quarter == nil && len(statuses) == 0 &&
+		q.Get("q") == "" {
+		return nil, nil
+	}
+	matches := func(want string, v *string) bool {
+		return want == "" || (v != nil && strings.EqualFold(*v, want))
+	}
+	return func(md *models.Media) bool {
+		s := md.SeasonPremiered
+		return matches(typ, md.Type) && matches(source, md.Source) &&
+			(year == nil || (s.Year != nil && *s.Year == *year)) &&
+			(quarter == nil || (s.Quarter != nil && *s.Quarter == *quarter)) &&
+			md.HasReleaseStatus(statuses...) && expr(md)
+	}, nil
+}
+
+// parseReleaseStatus returns the ReleaseStatus with the given name, ignoring
+// case.
+func parseReleaseStatus(v string) (models.ReleaseStatus, error) {
+	v = strings.TrimSpace(v)
+	for _, s := range models.ReleaseStatuses {
+		if strings.EqualFold(s.String(), v) {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("release status %q: %w", v, data.ErrInvalid)
+}
+
+// NewMediaExistsHandler returns a HEAD endpoint handler that responds with
+// status OK if the Media given by the id path variable exists, and Not Found
+// otherwise, without decoding the Media.
+func NewMediaExistsHandler(path []string, ds *graphql.DataService) web.Handler {
+	return web.Handler{
+		Method: http.MethodHead,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			id, err := web.ParsePathVarInt("id", &ps)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			var ok bool
+			err = ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				ok, err = ds.MediaService.Exists(id, tx)
+				return err
+			})
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		},
+	}
+}
+
+// MaxRandomMedia is the most Media that may be picked at random at once.
+const MaxRandomMedia = 20
+
+// NewRandomMediaHandler returns a GET endpoint handler that picks Media at
+// random, as many as given by the limit query parameter or one, with their
+// Titles ordered for the Accept-Language header. The Media may be filtered by
+// the parameters of NewMediaCountHandler, by the Genre ID given by the genre
+// parameter, and by the status parameter to those in the library of the
+// authenticated User with that WatchStatus, such as Planning.
+func NewRandomMediaHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			limit, err := web.ParseQueryInt("limit", r)
+			if err == nil && limit != nil && (*limit <= 0 || *limit > MaxRandomMedia) {
+				err = fmt.Errorf("query parameter %q: not between 1 and %d: %w", "limit",
+					MaxRandomMedia, data.ErrInvalid)
+			}
+			var genre *int
+			if err == nil {
+				genre, err = web.ParseQueryInt("genre", r)
+			}
+			var status *models.WatchStatus
+			if v := r.URL.Query().Get("status"); err == nil && v != "" {
+				status = new(models.WatchStatus)
+				err = status.UnmarshalJSON([]byte(strconv.Quote(v)))
+				if err != nil {
+					err = fmt.Errorf("query parameter %q: %v: %w", "status", err,
+						data.ErrInvalid)
+				}
+			}
+			var keep func(md *models.Media) bool
+			if err == nil {
+				keep, err = parseMediaFilter(r)
+			}
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+				return
+			}
+			n := 1
+			if limit != nil {
+				n = *limit
+			}
+
+			var u *models.User
+			if status != nil {
+				var ok bool
+				u, ok = loginCaller(w, r, ds, au)
+				if !ok {
+					return
+				}
+			}
+
+			var list []*models.Media
+			err = ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var ids []map[int]bool
+				if genre != nil {
+					mgs, err := ds.MediaGenreService.GetByGenre(*genre, nil, nil, tx)
+					if err != nil {
+						return fmt.Errorf("failed to get MediaGenres by Genre ID %d: %w",
+							*genre, err)
+					}
+					set := make(map[int]bool, len(mgs))
+					for _, mg := range mgs {
+						set[mg.MediaID] = true
+					}
+					ids = append(ids, set)
+				}
+				if status != nil {
+					ums, err := ds.UserMediaService.GetByUser(u.Meta.ID, nil, nil, tx)
+					if err != nil {
+						return fmt.Errorf("failed to get UserMedia by User ID %d: %w",
+							u.Meta.ID, err)
+					}
+					set := make(map[int]bool, len(ums))
+					for _, um := range ums {
+						if um.Status != nil && *um.Status == *status {
+							set[um.MediaID] = true
+						}
+					}
+					ids = append(ids, set)
+				}
+
+				filter := keep
+				if len(ids) > 0 {
+					filter = func(md *models.Media) bool {
+						for _, set := range ids {
+							if !set[md.Meta.ID] {
+								return false
+							}
+						}
+						return keep == nil || keep(md)
+					}
+				}
+
+				list, err = ds.MediaService.Random(n, tx, filter, nil)
+				if err != nil {
+					return fmt.Errorf("failed to pick random Media: %w", err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			langs := models.ParseAcceptLanguage(r.Header.Get(web.HeaderAcceptLanguage))
+			for _, md := range list {
+				md.Titles = models.LocalizeTitles(md.Titles, langs)
+			}
+			web.EncodeResponseBody(list, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewMediaCreateHandler returns a POST endpoint handler that creates the
+// Media in the request body. If the upsert query parameter is true, the Media
+// whose key given by the key query parameter, externalID by default, matches
+// that of the body is updated instead if there is one, so that importers may
+// send the same Media again, unless it is locked by another User. Created
+// Media are responded with 201 Created. Only Moderators may create them.
+func NewMediaCreateHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		DryRun: true,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			u, ok := authorizeRoleUser(w, r, ds, au, models.RoleModerator)
+			if !ok {
+				return
+			}
+			upsert := r.URL.Query().Get("upsert") == "true"
+			key := r.URL.Query().Get("key")
+			if key == "" {
+				key = data.MediaKeyExternalID
+			}
+			var md models.Media
+			if !parseRequestBody(w, r, &md) {
+				return
+			}
+			md.Meta = db.ModelMetadata{}
+
+			created := true
+			err := ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				var err error
+				if upsert {
+					_, created, err = ds.MediaService.UpsertAs(u, &md, key, tx)
+				} else {
+					_, err = ds.MediaService.Create(&md, tx)
+				}
+				if err != nil {
+					return fmt.Errorf("failed to save Media: %w", err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			if created {
+				w.WriteHeader(http.StatusCreated)
+			}
+			web.EncodeResponseBody(md, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// QueryConfirm is the name of the query parameter that carries the token
+// confirming a bulk deletion, given by its dry run.
+const QueryConfirm = "confirm"
+
+// MediaDeleteResponse is the response body of a bulk deletion of Media.
+type MediaDeleteResponse struct {
+	// Deleted are the IDs of the deleted Media.
+	Deleted []int `json:"deleted"`
+	// Token confirms the deletion of the same Media; it is only given by dry
+	// runs.
+	Token string `json:"token,omitempty"`
+}
+
+// NewMediaDeleteHandler returns a DELETE endpoint handler that deletes the
+// Media that pass the filter of the query parameters of parseMediaFilter,
+// such as those of a bad import, in a single transaction. A dry run lists
+// the Media that would be deleted along with a token, which the confirm
+// query parameter must then give for the Media to be deleted; the deletion
+// is refused if the Media that pass the filter changed since. Only Admins may
+// delete Media in bulk.
+func NewMediaDeleteHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodDelete,
+		Path:   path,
+		DryRun: true,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			if !authorizeRole(w, r, ds, au, models.RoleAdmin) {
+				return
+			}
+			keep, err := parseMediaFilter(r)
+			if err == nil && keep == nil {
+				err = fmt.Errorf("filter: must not be empty: %w", data.ErrInvalid)
+			}
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+				return
+			}
+			dry := web.IsDryRun(r)
+			confirm := r.URL.Query().Get(QueryConfirm)
+			if !dry && confirm == "" {
+				web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing,
+					fmt.Errorf("query parameter %q: must be the token of a dry run: %w",
+						QueryConfirm, data.ErrInvalid), w)
+				return
+			}
+
+			var res MediaDeleteResponse
+			err = ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				var err error
+				res.Deleted, err = ds.MediaService.DeleteFilter(keep, tx)
+				if err != nil {
+					return fmt.Errorf("failed to delete Media: %w", err)
+				}
+				if dry {
+					res.Token = data.ConfirmationToken(ds.MediaService.Bucket(), res.Deleted)
+					return nil
+				}
+				return data.CheckConfirmationToken(confirm, ds.MediaService.Bucket(),
+					res.Deleted)
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+			web.EncodeResponseBody(res, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewMediaPatchHandler returns a PATCH endpoint handler that applies the
+// JSON Merge Patch or JSON Patch in the request body, by its content type, to
+// the Media given by the id path variable in a single transaction, and
+// responds with the patched Media. Only Moderators may change it, and only if
+// it is not locked by another User.
+func NewMediaPatchHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPatch,
+		Path:   path,
+		DryRun: true,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			u, ok := authorizeRoleUser(w, r, ds, au, models.RoleModerator)
+			if !ok {
+				return
+			}
+			mID, err := web.ParsePathVarInt("id", &ps)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorPathVariableParsing, err, w)
+				return
+			}
+			patch, err := web.ReadRequestBody(r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorRequestBodyReading, err, w)
+				return
+			}
+
+			var md *models.Media
+			err = ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				md, err = ds.MediaService.GetByID(mID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get Media by ID %d: %w", mID, err)
+				}
+
+				err = patchModel(r.Header.Get(web.HeaderContentType), patch, md)
+				if err != nil {
+					return err
+				}
+				err = ds.MediaService.UpdateAs(u, md, tx)
+				if err != nil {
+					return fmt.Errorf("failed to update Media with ID %d: %w", mID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				encodePatchError(err, w)
+				return
+			}
+			web.EncodeResponseBody(md, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// MediaGenresRequest is the request body of a change to the Genres of a
+// Media.
+type MediaGenresRequest struct {
+	// GenreIDs is the full list of the Genres of the Media.
+	GenreIDs []int `json:"genreIDs"`
+}
+
+// NewMediaGenresHandler returns a POST endpoint handler that reconciles the
+// MediaGenres of the Media given by the id path variable with the Genres
+// listed in the request body, in a single transaction. Only Moderators may
+// change them.
+func NewMediaGenresHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		DryRun: true,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			if !authorizeRole(w, r, ds, au, models.RoleModerator) {
+				return
+			}
+			mID, err := web.ParsePathVarInt("id", &ps)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorPathVariableParsing, err, w)
+				return
+			}
+			var req MediaGenresRequest
+			if !parseRequestBody(w, r, &req) {
+				return
+			}
+
+			var list []*models.MediaGenre
+			err = ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				list, err = ds.MediaGenreService.SetByMedia(mID, req.GenreIDs, tx)
+				if err != nil {
+					return fmt.Errorf("failed to set Genres of Media with ID %d: %w", mID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+			web.EncodeResponseBody(list, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// MediaCharacterEntry is a MediaCharacter along with its Character and
+// Person, if any.
+type MediaCharacterEntry struct {
+	Relation  *models.MediaCharacter `json:"relation"`
+	Character *models.Character      `json:"character,omitempty"`
+	Person    *models.Person         `json:"person,omitempty"`
+}
+
+// NewMediaCharactersHandler returns a GET endpoint handler that lists the
+// Characters and People of the Media given by the id path variable,
+// paginated by the first and skip query parameters. Only the Characters of
+// the role given by the role query parameter, such as main, are listed if it
+// is given. Names are ordered for the Accept-Language header.
+func NewMediaCharactersHandler(path []string, ds *graphql.DataService) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			mID, err := web.ParsePathVarInt("id", &ps)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorPathVariableParsing, err, w)
+				return
+			}
+			var role string
+			if v := r.URL.Query().Get("role"); v != "" {
+				role, err = models.ParseCharacterRole(v)
+				if err != nil {
+					web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing,
+						fmt.Errorf("query parameter %q: %v: %w", "role", err, data.ErrInvalid), w)
+					return
+				}
+			}
+			first, skip, ok := parsePagination(w, r)
+			if !ok {
+				return
+			}
+
+			var list []MediaCharacterEntry
+			err = ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				_, err := ds.MediaService.GetByID(mID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get Media by ID %d: %w", mID, err)
+				}
+
+				var mcs []*models.MediaCharacter
+				if role != "" {
+					mcs, err = ds.MediaCharacterService.GetByMediaRole(mID, role, first, skip, tx)
+				} else {
+					mcs, err = ds.MediaCharacterService.GetByMedia(mID, first, skip, tx)
+				}
+				if err != nil {
+					return fmt.Errorf("failed to get MediaCharacters by Media ID %d: %w",
+						mID, err)
+				}
+
+				list = make([]MediaCharacterEntry, len(mcs))
+				for i, mc := range mcs {
+					list[i].Relation = mc
+					if mc.CharacterID != nil {
+						list[i].Character, err = ds.CharacterService.GetByID(*mc.CharacterID, tx)
+						if err != nil {
+							return fmt.Errorf("failed to get Character by ID %d: %w",
+								*mc.CharacterID, err)
+						}
+					}
+					if mc.PersonID != nil {
+						list[i].Person, err = ds.PersonService.GetByID(*mc.PersonID, tx)
+						if err != nil {
+							return fmt.Errorf("failed to get Person by ID %d: %w",
+								*mc.PersonID, err)
+						}
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			langs := models.ParseAcceptLanguage(r.Header.Get(web.HeaderAcceptLanguage))
+			for _, e := range list {
+				if e.Character != nil {
+					e.Character.Names = models.LocalizeTitles(e.Character.Names, langs)
+					e.Character.Information = models.LocalizeTitles(e.Character.Information, langs)
+				}
+				if e.Person != nil {
+					e.Person.Names = models.LocalizeTitles(e.Person.Names, langs)
+					e.Person.Information = models.LocalizeTitles(e.Person.Information, langs)
+				}
+			}
+			web.EncodeResponseBody(list, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// MediaStaffEntry is a MediaStaff credit along with the entity at its other
+// end: the Person when listing the staff of a Media, and the Media when
+// listing the credits of a Person.
+type MediaStaffEntry struct {
+	Credit *models.MediaStaff `json:"credit"`
+	Media  *models.Media      `json:"media,omitempty"`
+	Person *models.Person     `json:"person,omitempty"`
+}
+
+// NewMediaStaffHandler returns a GET endpoint handler that lists the staff
+// credited on the Media given by the id path variable or, if byPerson is
+// true, the credits of the Person given by the id path variable, paginated
+// by the first and skip query parameters. Titles and names are ordered for
+// the Accept-Language header.
+func NewMediaStaffHandler(path []string, ds *graphql.DataService, byPerson bool) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			id, err := web.ParsePathVarInt("id", &ps)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorPathVariableParsing, err, w)
+				return
+			}
+			first, skip, ok := parsePagination(w, r)
+			if !ok {
+				return
+			}
+
+			var list []MediaStaffEntry
+			err = ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var credits []*models.MediaStaff
+				if byPerson {
+					_, err = ds.PersonService.GetByID(id, tx)
+					if err != nil {
+						return fmt.Errorf("failed to get Person by ID %d: %w", id, err)
+					}
+					credits, err = ds.MediaStaffService.GetByPerson(id, first, skip, tx)
+				} else {
+					_, err = ds.MediaService.GetByID(id, tx)
+					if err != nil {
+						return fmt.Errorf("failed to get Media by ID %d: %w", id, err)
+					}
+					credits, err = ds.MediaStaffService.GetByMedia(id, first, skip, tx)
+				}
+				if err != nil {
+					return fmt.Errorf("failed to get MediaStaff: %w", err)
+				}
+
+				list = make([]MediaStaffEntry, len(credits))
+				for i, ms := range credits {
+					list[i].Credit = ms
+					if byPerson {
+						list[i].Media, err = ds.MediaService.GetByID(ms.MediaID, tx)
+						if err != nil {
+							return fmt.Errorf("failed to get Media by ID %d: %w",
+								ms.MediaID, err)
+						}
+					} else {
+						list[i].Person, err = ds.PersonService.GetByID(ms.PersonID, tx)
+						if err != nil {
+							return fmt.Errorf("failed to get Person by ID %d: %w",
+								ms.PersonID, err)
+						}
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			langs := models.ParseAcceptLanguage(r.Header.Get(web.HeaderAcceptLanguage))
+			for _, e := range list {
+				if e.Media != nil {
+					e.Media.Titles = models.LocalizeTitles(e.Media.Titles, langs)
+				}
+				if e.Person != nil {
+					e.Person.Names = models.LocalizeTitles(e.Person.Names, langs)
+					e.Person.Information = models.LocalizeTitles(e.Person.Information, langs)
+				}
+			}
+			web.EncodeResponseBody(list, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
@@ -0,0 +1,667 @@
+package naos_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/naos"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestMediaByIDs tests that Media are retrieved in the order of their IDs,
+// with nil for IDs of no Media.
+func TestMediaByIDs(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	ids := []int{refs["movie"], refs["movie"] + refs["bebop"] + 1000, refs["bebop"]}
+	var list []*models.Media
+	err := ds.Database.Transaction(false, func(tx db.Tx) error {
+		var err error
+		list, err = ds.MediaService.GetByIDs(ids, tx)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != len(ids) {
+		t.Fatalf("expected %d Media, got %d", len(ids), len(list))
+	}
+	if list[0] == nil || list[0].Meta.ID != ids[0] ||
+		list[1] != nil ||
+		list[2] == nil || list[2].Meta.ID != ids[2] {
+		t.Errorf("expected Media %d, none and %d, got %+v", ids[0], ids[2], list)
+	}
+}
+
+// TestMediaCount tests that Media are counted with and without filters, and
+// that their existence is checked.
+func TestMediaCount(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	err := ds.Database.Transaction(false, func(tx db.Tx) error {
+		n, err := ds.MediaService.Count(tx, nil)
+		if err != nil {
+			return err
+		}
+		if n != 2 {
+			t.Errorf("expected 2 Media, got %d", n)
+		}
+
+		n, err = ds.MediaService.Count(tx, func(md *models.Media) bool {
+			return md.Type != nil && *md.Type == "Movie"
+		})
+		if err != nil {
+			return err
+		}
+		if n != 1 {
+			t.Errorf("expected 1 movie, got %d", n)
+		}
+
+		for id, want := range map[int]bool{
+			refs["bebop"]:                        true,
+			refs["bebop"] + refs["movie"] + 1000: false,
+		} {
+			ok, err := ds.MediaService.Exists(id, tx)
+			if err != nil {
+				return err
+			}
+			if ok != want {
+				t.Errorf("expected existence of Media %d to be %t", id, want)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestMediaRandom tests that Media are picked at random among those that pass
+// the filter, no more than asked for.
+func TestMediaRandom(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	rnd := rand.New(rand.NewSource(1))
+	err := ds.Database.Transaction(false, func(tx db.Tx) error {
+		list, err := ds.MediaService.Random(1, tx, nil, rnd)
+		if err != nil {
+			return err
+		}
+		if len(list) != 1 {
+			t.Errorf("expected 1 Media, got %d", len(list))
+		}
+
+		list, err = ds.MediaService.Random(5, tx, nil, rnd)
+		if err != nil {
+			return err
+		}
+		if len(list) != 2 {
+			t.Errorf("expected all 2 Media, got %d", len(list))
+		}
+
+		for i := 0; i < 10; i++ {
+			list, err = ds.MediaService.Random(1, tx, func(md *models.Media) bool {
+				return md.Meta.ID == refs["movie"]
+			}, rnd)
+			if err != nil {
+				return err
+			}
+			if len(list) != 1 || list[0].Meta.ID != refs["movie"] {
+				t.Fatalf("expected Media %d, got %+v", refs["movie"], list)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestMediaCharacterRoles tests that Characters are validated, and that
+// their roles in Media are normalized and filtered by.
+func TestMediaCharacterRoles(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		_, err := ds.CharacterService.Create(&models.Character{
+			Birthday: &models.Birthday{Month: 2, Day: 30},
+		}, tx)
+		if !errors.Is(err, data.ErrInvalid) {
+			t.Errorf("expected the 30th of February to be invalid, got %v", err)
+		}
+		cID, err := ds.CharacterService.Create(&models.Character{
+			Names:    []models.Title{{String: "Spike Spiegel", Language: "en"}},
+			Birthday: &models.Birthday{Month: 6, Day: 26},
+			Images:   []string{"https://example.test/spike.png"},
+		}, tx)
+		if err != nil {
+			return err
+		}
+
+		role := "cameo"
+		_, err = ds.MediaCharacterService.Create(&models.MediaCharacter{
+			MediaID: refs["bebop"], CharacterID: &cID, CharacterRole: &role,
+		}, tx)
+		if !errors.Is(err, data.ErrInvalid) {
+			t.Errorf("expected role %q to be invalid, got %v", role, err)
+		}
+		role = "main"
+		_, err = ds.MediaCharacterService.Create(&models.MediaCharacter{
+			MediaID: refs["bebop"], CharacterID: &cID, CharacterRole: &role,
+		}, tx)
+		if err != nil {
+			return err
+		}
+
+		for want, n := range map[string]int{
+			models.CharacterRoleMain: 1, models.CharacterRoleSupporting: 0,
+		} {
+			list, err := ds.MediaCharacterService.GetByMediaRole(
+				refs["bebop"], want, nil, nil, tx)
+			if err != nil {
+				return err
+			}
+			if len(list) != n {
+				t.Errorf("expected %d %s Characters, got %d", n, want, len(list))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestMediaGenresSet tests that the Genres of a Media are reconciled with a
+// full list, keeping the relations of Genres still listed.
+func TestMediaGenresSet(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		before, err := ds.MediaGenreService.GetByMedia(refs["bebop"], nil, nil, tx)
+		if err != nil {
+			return err
+		}
+		gID, err := ds.GenreService.Create(&models.Genre{
+			Names: []models.Title{{String: "Space Western", Language: "en"}},
+		}, tx)
+		if err != nil {
+			return err
+		}
+
+		list, err := ds.MediaGenreService.SetByMedia(refs["bebop"],
+			[]int{gID, refs["scifi"], gID}, tx)
+		if err != nil {
+			return err
+		}
+		if len(list) != 2 || list[0].Meta.ID != before[0].Meta.ID || list[1].GenreID != gID {
+			t.Errorf("expected the Sci-Fi relation kept and one added, got %+v", list)
+		}
+
+		_, err = ds.MediaGenreService.SetByMedia(refs["bebop"], []int{gID + 1000}, tx)
+		if !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("expected missing Genre to be not found, got %v", err)
+		}
+
+		list, err = ds.MediaGenreService.SetByMedia(refs["bebop"], []int{gID}, tx)
+		if err != nil {
+			return err
+		}
+		after, err := ds.MediaGenreService.GetByMedia(refs["bebop"], nil, nil, tx)
+		if err != nil {
+			return err
+		}
+		if len(list) != 1 || len(after) != 1 || after[0].GenreID != gID {
+			t.Errorf("expected only Genre %d left, got %+v", gID, after)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestMediaStaff tests that staff credits are validated, listed from both
+// ends, and deleted with their People.
+func TestMediaStaff(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		pID, err := ds.PersonService.Create(&models.Person{
+			Names: []models.Title{{String: "Yoko Kanno", Language: "en"}},
+		}, tx)
+		if err != nil {
+			return err
+		}
+
+		firstEp, lastEp := 5, 2
+		_, err = ds.MediaStaffService.Create(&models.MediaStaff{
+			MediaID: refs["bebop"], PersonID: pID, Role: "Composer",
+			FirstEpisode: &firstEp, LastEpisode: &lastEp,
+		}, tx)
+		if !errors.Is(err, data.ErrInvalid) {
+			t.Errorf("expected a credit ending before it starts to be invalid, got %v", err)
+		}
+		_, err = ds.MediaStaffService.Create(&models.MediaStaff{
+			MediaID: refs["bebop"] + refs["movie"] + 1000, PersonID: pID, Role: "Composer",
+		}, tx)
+		if !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("expected a credit on no Media to be rejected, got %v", err)
+		}
+		_, err = ds.MediaStaffService.Create(&models.MediaStaff{
+			MediaID: refs["bebop"], PersonID: pID, Role: "Composer",
+		}, tx)
+		if err != nil {
+			return err
+		}
+
+		byMedia, err := ds.MediaStaffService.GetByMedia(refs["bebop"], nil, nil, tx)
+		if err != nil {
+			return err
+		}
+		if len(byMedia) != 1 || byMedia[0].PersonID != pID {
+			t.Errorf("expected the credit of Person %d, got %+v", pID, byMedia)
+		}
+
+		err = ds.PersonService.Delete(pID, tx)
+		if err != nil {
+			return err
+		}
+		byMedia, err = ds.MediaStaffService.GetByMedia(refs["bebop"], nil, nil, tx)
+		if err != nil {
+			return err
+		}
+		if len(byMedia) != 0 {
+			t.Errorf("expected credits deleted with the Person, got %+v", byMedia)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestMediaRelationInverse tests that relationships are normalized, and that
+// inverse MediaRelations are created and deleted along with them.
+func TestMediaRelationInverse(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	var rel models.MediaRelationship
+	err := json.Unmarshal([]byte(`"SIDE_STORY"`), &rel)
+	if err != nil || rel != models.MediaRelationshipSideStory {
+		t.Errorf("expected %q, got %q, %v", models.MediaRelationshipSideStory, rel, err)
+	}
+
+	ser := ds.MediaRelationSerivce
+	err = ds.Database.Transaction(true, func(tx db.Tx) error {
+		_, err := ser.Create(&models.MediaRelation{
+			OwnerID: refs["bebop"], RelatedID: refs["movie"], Relationship: "spinoff",
+		}, tx)
+		if !errors.Is(err, data.ErrInvalid) {
+			t.Errorf("expected relationship %q to be invalid, got %v", "spinoff", err)
+		}
+
+		id, err := ser.Create(&models.MediaRelation{
+			OwnerID: refs["bebop"], RelatedID: refs["movie"], Relationship: "sequel",
+		}, tx)
+		if err != nil {
+			return err
+		}
+		list, err := ser.GetAll(nil, nil, tx)
+		if err != nil {
+			return err
+		}
+		if len(list) != 2 {
+			t.Fatalf("expected the relation and its inverse, got %+v", list)
+		}
+		for _, mr := range list {
+			want := models.MediaRelationshipSequel
+			if mr.Meta.ID != id {
+				want = models.MediaRelationshipPrequel
+			}
+			if mr.Relationship != want {
+				t.Errorf("expected relationship %q, got %q", want, mr.Relationship)
+			}
+		}
+
+		err = ser.Delete(id, tx)
+		if err != nil {
+			return err
+		}
+		n, err := ser.Count(tx)
+		if err != nil {
+			return err
+		}
+		if n != 0 {
+			t.Errorf("expected the inverse deleted along with the relation, got %d", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRelationInverses tests that configured inverses of relationships
+// override the defaults only if each is the inverse of its inverse.
+func TestRelationInverses(t *testing.T) {
+	var c naos.Configuration
+	c.Relations.Inverses = map[string]string{"character": "other", "other": "character"}
+	inverses, err := naos.RelationInverses(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ser := &data.MediaRelationService{Inverses: inverses}
+	if inv := ser.Inverse(models.MediaRelationshipCharacter); inv != models.MediaRelationshipOther {
+		t.Errorf("expected the inverse of Character to be Other, got %q", inv)
+	}
+	if inv := ser.Inverse(models.MediaRelationshipSequel); inv != models.MediaRelationshipPrequel {
+		t.Errorf("expected the inverse of Sequel to be Prequel, got %q", inv)
+	}
+
+	c.Relations.Inverses = map[string]string{"sequel": "other"}
+	_, err = naos.RelationInverses(&c)
+	if !errors.Is(err, db.ErrInvalid) {
+		t.Errorf("expected one-way inverses to be invalid, got %v", err)
+	}
+}
+
+// TestMediaUpsert tests that Media are created when no Media has their key,
+// updated when one does, and that external IDs are unique.
+func TestMediaUpsert(t *testing.T) {
+	ds, _, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		ser := ds.MediaService
+		md := models.Media{
+			Titles:     []models.Title{{String: "Trigun", Language: "en"}},
+			ExternalID: "mal:6",
+		}
+		id, created, err := ser.Upsert(&md, data.MediaKeyExternalID, tx)
+		if err != nil {
+			return err
+		}
+		if !created {
+			t.Errorf("expected Media to be created")
+		}
+
+		again := models.Media{
+			Titles:     []models.Title{{String: "Trigun Stampede", Language: "en"}},
+			ExternalID: "mal:6",
+		}
+		againID, created, err := ser.Upsert(&again, data.MediaKeyExternalID, tx)
+		if err != nil {
+			return err
+		}
+		if created || againID != id || again.Meta.Version != 1 {
+			t.Errorf("expected Media %d to be updated, got %d (created %t, version %d)",
+				id, againID, created, again.Meta.Version)
+		}
+
+		_, _, err = ser.Upsert(&models.Media{}, data.MediaKeyExternalID, tx)
+		if !errors.Is(err, data.ErrInvalid) {
+			t.Errorf("expected empty key to be invalid, got %v", err)
+		}
+		_, _, err = ser.Upsert(&again, "title", tx)
+		if !errors.Is(err, data.ErrInvalid) {
+			t.Errorf("expected unknown key to be invalid, got %v", err)
+		}
+		_, err = ser.Create(&models.Media{ExternalID: "mal:6"}, tx)
+		if !errors.Is(err, data.ErrConflict) {
+			t.Errorf("expected duplicate external ID to conflict, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestMediaDryRun tests that writes in dry runs are cleaned and validated but
+// not persisted.
+func TestMediaDryRun(t *testing.T) {
+	ds, _, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	ctx := db.WithDryRun(context.Background())
+	md := models.Media{Titles: []models.Title{{String: " Trigun ", Language: "en"}}}
+	err := ds.Database.TransactionContext(ctx, true, func(tx db.Tx) error {
+		_, err := ds.MediaService.Create(&md, tx)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Meta.ID == 0 || md.Slug == "" {
+		t.Errorf("expected cleaned Media, got %+v", md)
+	}
+	err = ds.Database.Transaction(false, func(tx db.Tx) error {
+		_, err := ds.MediaService.GetByID(md.Meta.ID, tx)
+		return err
+	})
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected Media of dry run not to be persisted, got %v", err)
+	}
+
+	err = ds.Database.TransactionContext(ctx, true, func(tx db.Tx) error {
+		return ds.MediaService.Update(&models.Media{Meta: db.ModelMetadata{ID: md.Meta.ID}}, tx)
+	})
+	if !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("expected errors of dry run to be returned, got %v", err)
+	}
+}
+
+// TestMediaDeleteFilter tests that Media are deleted in bulk only with the
+// token of a dry run that deleted the same Media.
+func TestMediaDeleteFilter(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	bucket := ds.MediaService.Bucket()
+	movies := func(md *models.Media) bool { return md.IsSingleUnit() }
+	var token string
+	err := ds.Database.TransactionContext(db.WithDryRun(context.Background()), true,
+		func(tx db.Tx) error {
+			ids, err := ds.MediaService.DeleteFilter(movies, tx)
+			if err != nil {
+				return err
+			}
+			if len(ids) != 1 || ids[0] != refs["movie"] {
+				t.Errorf("expected movie to be deleted, got %v", ids)
+			}
+			token = data.ConfirmationToken(bucket, ids)
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	typ := models.MediaTypeMovie
+	err = ds.Database.Transaction(true, func(tx db.Tx) error {
+		_, err := ds.MediaService.Create(&models.Media{
+			Titles: []models.Title{{String: "Cowboy Bebop: Sequel", Language: "en"}},
+			Type:   &typ,
+		}, tx)
+		if err != nil {
+			return err
+		}
+		ids, err := ds.MediaService.DeleteFilter(movies, tx)
+		if err != nil {
+			return err
+		}
+		return data.CheckConfirmationToken(token, bucket, ids)
+	})
+	if !errors.Is(err, data.ErrConflict) {
+		t.Fatalf("expected stale token to be refused, got %v", err)
+	}
+
+	// The refused deletion rolled back along with the new Media
+	err = ds.Database.Transaction(true, func(tx db.Tx) error {
+		ids, err := ds.MediaService.DeleteFilter(movies, tx)
+		if err != nil {
+			return err
+		}
+		return data.CheckConfirmationToken(token, bucket, ids)
+	})
+	if err != nil {
+		t.Fatalf("failed to delete Media: %v", err)
+	}
+	err = ds.Database.Transaction(false, func(tx db.Tx) error {
+		_, err := ds.MediaService.GetByID(refs["movie"], tx)
+		if !errors.Is(err, data.ErrNotFound) {
+			t.Errorf("expected movie to be deleted, got %v", err)
+		}
+		_, err = ds.MediaService.GetByID(refs["bebop"], tx)
+		return err
+	})
+	if err != nil {
+		t.Errorf("expected other Media to be kept, got %v", err)
+	}
+}
+
+// TestMediaAliases tests that Media are found by their MediaAliases, that a
+// Media may not have the same alias twice, and that MediaAliases are deleted
+// and unindexed with their Media.
+func TestMediaAliases(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		_, err := ds.MediaAliasService.Create(&models.MediaAlias{
+			MediaID: refs["movie"], Title: "Tengoku no Tobira", Language: "ja-Latn",
+		}, tx)
+		if err != nil {
+			return err
+		}
+		_, err = ds.MediaAliasService.Create(&models.MediaAlias{
+			MediaID: refs["movie"], Title: "tengoku  no TOBIRA", Language: "ja-Latn",
+		}, tx)
+		if !errors.Is(err, data.ErrConflict) {
+			t.Errorf("expected a repeated alias to conflict, got %v", err)
+		}
+		_, err = ds.MediaAliasService.Create(&models.MediaAlias{
+			MediaID: refs["movie"], Title: " - ", Language: "en",
+		}, tx)
+		if !errors.Is(err, data.ErrInvalid) {
+			t.Errorf("expected an alias of no letters to be invalid, got %v", err)
+		}
+
+		list, err := ds.MediaService.Search("tengoku", nil, tx)
+		if err != nil {
+			return err
+		}
+		if len(list) != 1 || list[0].Meta.ID != refs["movie"] {
+			t.Errorf("expected Media %d by its alias, got %v", refs["movie"], list)
+		}
+		list, err = ds.MediaService.Search("Cowboy Bebop", nil, tx)
+		if err != nil {
+			return err
+		}
+		if len(list) != 2 || list[0].Meta.ID != refs["bebop"] {
+			t.Errorf("expected Media %d first by exact title, got %v", refs["bebop"], list)
+		}
+
+		err = ds.MediaService.Delete(refs["movie"], tx)
+		if err != nil {
+			return err
+		}
+		aliases, err := ds.MediaAliasService.GetAll(nil, nil, tx)
+		if err != nil {
+			return err
+		}
+		if len(aliases) != 0 {
+			t.Errorf("expected aliases deleted with the Media, got %+v", aliases)
+		}
+		list, err = ds.MediaService.Search("tengoku", nil, tx)
+		if err != nil {
+			return err
+		}
+		if len(list) != 0 {
+			t.Errorf("expected deleted Media unindexed, got %v", list)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestMediaReleaseStatus tests that the ReleaseStatus of Media is derived from
+// their dates if not given, kept in updates that do not give it, and only
+// changed as its transitions allow.
+func TestMediaReleaseStatus(t *testing.T) {
+	ds, _, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	start := time.Now().AddDate(0, -1, 0)
+	status := func(s models.ReleaseStatus) *models.ReleaseStatus { return &s }
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		md := models.Media{
+			Titles:    []models.Title{{String: "Carole & Tuesday", Language: "en"}},
+			StartDate: &start,
+		}
+		_, err := ds.MediaService.Create(&md, tx)
+		if err != nil {
+			return err
+		}
+		if !md.HasReleaseStatus(models.ReleaseStatusReleasing) {
+			t.Errorf("expected Media started a month ago to be Releasing, got %v",
+				md.ReleaseStatus)
+		}
+
+		md.ReleaseStatus = status(models.ReleaseStatusHiatus)
+		err = ds.MediaService.Update(&md, tx)
+		if err != nil {
+			return err
+		}
+		md.ReleaseStatus = nil
+		err = ds.MediaService.Update(&md, tx)
+		if err != nil {
+			return err
+		}
+		if !md.HasReleaseStatus(models.ReleaseStatusHiatus) {
+			t.Errorf("expected the ReleaseStatus kept, got %v", md.ReleaseStatus)
+		}
+
+		md.ReleaseStatus = status(models.ReleaseStatusFinished)
+		err = ds.MediaService.Update(&md, tx)
+		if err != nil {
+			return err
+		}
+		md.ReleaseStatus = status(models.ReleaseStatusNotYetReleased)
+		err = ds.MediaService.Update(&md, tx)
+		if !errors.Is(err, data.ErrInvalid) {
+			t.Errorf("expected Finished Media to stay Finished, got %v", err)
+		}
+
+		n, err := ds.MediaService.Count(tx, func(md *models.Media) bool {
+			return md.HasReleaseStatus(models.ReleaseStatusFinished, models.ReleaseStatusCancelled)
+		})
+		if err != nil {
+			return err
+		}
+		if n != 1 {
+			t.Errorf("expected 1 Finished or Cancelled Media, got %d", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,137 @@
+package naos
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// Reencode rewrites all persisted records of the given data layer with the
+// currently configured codecs.
+func Reencode(ds *graphql.DataService) error {
+	for _, ser := range Services(ds) {
+		err := ds.Database.Transaction(true, func(tx db.Tx) error {
+			n, err := tx.Database().Reencode(ser, tx)
+			if err != nil {
+				return err
+			}
+
+			log.WithFields(log.Fields{
+				"bucket": ser.Bucket(),
+				"codec":  db.Codecs.ForBucket(ser.Bucket()).Format(),
+				"count":  n,
+			}).Info("Re-encoded records")
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to re-encode bucket %q: %w", ser.Bucket(), err)
+		}
+	}
+	return nil
+}
+
+// Rekey rewrites the keys of the records in the database of the given
+// configuration that are in another encoding into the configured one, as
+// the databases of earlier versions are keyed in binary, and returns the
+// number of records re-keyed. It must be run before the data layer is
+// created, which refuses databases keyed in another encoding.
+func Rekey(c *Configuration) (int, error) {
+	keys, err := keyEncoding(c)
+	if err != nil {
+		return 0, err
+	}
+	driver, err := db.ConnectBoltDatabase(&db.BoltDatabaseConfig{
+		Path:     c.DB.Path,
+		FileMode: os.FileMode(c.DB.Filemode),
+		Keys:     keys,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer driver.Close()
+
+	n := 0
+	for _, from := range []db.KeyEncoding{db.BinaryKeys{}, db.StringKeys{}} {
+		if from == keys {
+			continue
+		}
+		rekeyed, err := driver.Rekey(from)
+		if err != nil {
+			return n, err
+		}
+		n += rekeyed
+	}
+	return n, nil
+}
+
+// keyEncoding returns the encoding of the IDs of records as their keys
+// selected in the given configuration; BinaryKeys if unset.
+func keyEncoding(c *Configuration) (db.KeyEncoding, error) {
+	if c.DB.KeyEncoding == "" {
+		return db.BinaryKeys{}, nil
+	}
+	keys, err := db.KeyEncodingByName(c.DB.KeyEncoding)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select key encoding: %w", err)
+	}
+	return keys, nil
+}
+
+// MigrateMediaRelations rewrites the relationships of the MediaRelations of
+// the given data layer, written when they were free strings, to the
+// MediaRelationship of their names, or Other if there is none, and creates
+// the missing inverses of all MediaRelations. It returns the numbers of
+// rewritten MediaRelations and of created inverses.
+func MigrateMediaRelations(ds *graphql.DataService) (int, int, error) {
+	ser := ds.MediaRelationSerivce
+	rewritten, created := 0, 0
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		list, err := ser.GetAll(nil, nil, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get MediaRelations: %w", err)
+		}
+		before, err := ser.Count(tx)
+		if err != nil {
+			return err
+		}
+
+		for _, mr := range list {
+			rel, err := models.ParseMediaRelationship(string(mr.Relationship))
+			if err != nil {
+				rel = models.MediaRelationshipOther
+			}
+			if rel == mr.Relationship {
+				continue
+			}
+
+			mr.Relationship = rel
+			err = tx.Database().Update(mr, ser, tx)
+			if err != nil {
+				return fmt.Errorf("failed to update MediaRelation with ID %d: %w",
+					mr.Meta.ID, err)
+			}
+			rewritten++
+		}
+
+		for _, mr := range list {
+			err = ser.EnsureInverse(mr, tx)
+			if err != nil {
+				return err
+			}
+		}
+		after, err := ser.Count(tx)
+		if err != nil {
+			return err
+		}
+		created = after - before
+		return nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to migrate MediaRelations: %w", err)
+	}
+	return rewritten, created, nil
+}
@@ -4,42 +4,784 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/Dophin2009/nao/internal/cluster"
 	"github.com/Dophin2009/nao/internal/data"
 	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jobs"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/mail"
+	"github.com/Dophin2009/nao/internal/rpc"
+	"github.com/Dophin2009/nao/internal/script"
+	"github.com/Dophin2009/nao/internal/trace"
 	"github.com/Dophin2009/nao/internal/web"
 	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
 )
 
 // Application is the main naos application.
 type Application struct {
 	Server    *web.Server
 	DataLayer *graphql.DataService
+	// Snapshots writes periodic snapshots of the database; nil if disabled.
+	Snapshots *db.SnapshotScheduler
+	// Jobs tracks the progress of long-running jobs.
+	Jobs *jobs.Manager
+	// Errors keeps the most recently logged errors.
+	Errors *web.ErrorLog
+	// Airing notifies Users of newly aired Episodes; nil if disabled.
+	Airing *AiringScheduler
+	// Trending recomputes the trending Media; nil if disabled.
+	Trending *TrendingScheduler
+	// Refresh refreshes the metadata of Media from the catalogues of their
+	// ExternalIDs; nil if disabled.
+	Refresh *MetadataRefreshScheduler
+	// Mail sends email messages to Users; nil if disabled.
+	Mail *mail.Queue
+	// Digests emails Users digests of aired Episodes; nil if disabled.
+	Digests *DigestScheduler
+	// ImportQueue writes the staged entries of list imports; nil if a
+	// follower.
+	ImportQueue *ImportQueue
+	// Tracer exports traces of the requests served; nil if disabled.
+	Tracer *trace.Tracer
+	// Tenants serves the databases of tenants; nil if none are configured.
+	Tenants *Tenants
+	// Scripts runs the scripts of operators; nil if disabled.
+	Scripts *script.Engine
+	// Replication pulls the replication log of the primary of a follower;
+	// nil if not a follower.
+	Replication *ReplicationScheduler
+	// Cluster is the node of the cluster the database is replicated across;
+	// nil if not clustered.
+	Cluster *cluster.Cluster
+	// GRPCServer serves the gRPC API on GRPCAddress; nil if disabled.
+	GRPCServer  *grpc.Server
+	GRPCAddress string
+	// Proxies are the reverse proxies trusted to give the addresses of
+	// clients; nil if none are.
+	Proxies *web.Proxies
+	// BasePath is the path prefix the API is served under; empty if served
+	// at the root.
+	BasePath string
 }
 
-// HTTPServer returns the application's HTTP server.
+// HTTPServer returns the application's HTTP server, which passes the
+// requests of tenants on to them, and those that write to the leader of the
+// cluster, under the base path and seeing past trusted proxies.
 func (a *Application) HTTPServer() http.Server {
-	return a.Server.HTTPServer()
+	srv := a.Server.HTTPServer()
+	if a.Cluster != nil {
+		// Writes are forwarded to the leader of the cluster
+		srv.Handler = a.Cluster.Handler(srv.Handler, "/cluster/status")
+	} else if a.Tenants != nil {
+		srv.Handler = a.Tenants.Handler(srv.Handler)
+	}
+	if a.BasePath != "" {
+		srv.Handler = web.BasePath(a.BasePath, srv.Handler)
+	}
+	if a.Proxies != nil {
+		srv.Handler = a.Proxies.Handler(srv.Handler)
+	}
+	return srv
 }
 
 // NewApplication returns a new naos Application.
 func NewApplication(c *Configuration) (*Application, error) {
+	ds, err := NewDataService(c, true)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := web.NewErrorLog(0)
+	log.AddHook(errs)
+	web.ErrorDebug = c.Errors.Debug
+
+	app, err := newApplication(c, ds, errs)
+	if err != nil {
+		return nil, err
+	}
+	if c.Frontend.Dir != "" {
+		app.Server.Frontend = &web.Frontend{
+			FS:      http.Dir(c.Frontend.Dir),
+			Exclude: c.Frontend.Exclude,
+			MaxAge:  c.Frontend.MaxAge,
+		}
+	}
+
+	// Tenants are served under the base path and behind the proxies of the
+	// default database
+	app.BasePath = c.basePath()
+	if len(c.Proxies.Trusted) > 0 {
+		app.Proxies, err = web.NewProxies(c.Proxies.Trusted)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure trusted proxies: %w", err)
+		}
+	}
+	if len(c.Tenants) > 0 {
+		app.Tenants, err = NewTenants(c, errs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure tenants: %w", err)
+		}
+	}
+	return app, nil
+}
+
+// newApplication returns a naos Application serving the given data layer,
+// which keeps the logged errors in the given ErrorLog.
+func newApplication(
+	c *Configuration, ds *graphql.DataService, errs *web.ErrorLog,
+) (*Application, error) {
+	// Followers only write what they replicate from their primary
+	follower := c.Replication.Primary != ""
+	// Nodes of a cluster commit their writes through the Raft log
+	var clu *cluster.Cluster
+	clustered := c.Cluster.ID != ""
+	if clustered {
+		var err error
+		clu, err = NewCluster(c, ds)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.Replication.Log && !follower {
+		retain := c.Replication.Retain
+		if retain == 0 {
+			retain = DefaultReplicationRetain
+		}
+		db.RecordReplication(ds.Lifecycle, retain)
+	}
+
+	// Index the Media of databases created before the season index
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		one := 1
+		seasons, err := ds.MediaSeasonService.GetAll(&one, nil, tx)
+		if err != nil || len(seasons) > 0 {
+			return err
+		}
+		n, err := ds.MediaSeasonService.Reindex(tx)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			log.WithFields(log.Fields{"count": n}).Info("Indexed Media by season")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to index Media by season: %w", err)
+	}
+
+	// Index the Episodes of databases created before the airing index
+	err = ds.Database.Transaction(true, func(tx db.Tx) error {
+		one := 1
+		airings, err := ds.EpisodeAiringService.GetAll(&one, nil, tx)
+		if err != nil || len(airings) > 0 {
+			return err
+		}
+		n, err := ds.EpisodeAiringService.Reindex(tx)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			log.WithFields(log.Fields{"count": n}).Info("Indexed Episodes by airing date")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to index Episodes by airing date: %w", err)
+	}
+
+	// Sort the Media of databases created before the sorted views, or in
+	// views of other title languages
+	err = ds.Database.Transaction(true, func(tx db.Tx) error {
+		orders, err := ds.MediaOrderService.GetAll(nil, nil, tx)
+		if err != nil {
+			return err
+		}
+		names := ds.MediaOrderService.Names()
+		kept := map[string]bool{}
+		for _, o := range orders {
+			kept[o.Name] = true
+		}
+		complete := len(orders) == len(names)
+		for _, name := range names {
+			complete = complete && kept[name]
+		}
+		if complete {
+			return nil
+		}
+		n, err := ds.MediaOrderService.Reindex(tx)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			log.WithFields(log.Fields{"count": n}).Info("Sorted Media")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sort Media: %w", err)
+	}
+
+	// Index the entities of databases created before Slugs
+	err = ds.Database.Transaction(true, func(tx db.Tx) error {
+		one := 1
+		slugs, err := ds.SlugService.GetAll(&one, nil, tx)
+		if err != nil || len(slugs) > 0 {
+			return err
+		}
+		n, err := ds.SlugService.Reindex(tx)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			log.WithFields(log.Fields{"count": n}).Info("Indexed entities by slug")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to index entities by slug: %w", err)
+	}
+
+	// Index the Media, People and Characters of databases created before
+	// Names
+	err = ds.Database.Transaction(true, func(tx db.Tx) error {
+		one := 1
+		names, err := ds.NameService.GetAll(&one, nil, tx)
+		if err != nil || len(names) > 0 {
+			return err
+		}
+		n, err := ds.NameService.Reindex(tx)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			log.WithFields(log.Fields{"count": n}).Info("Indexed entities by name")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to index entities by name: %w", err)
+	}
+
+	// Seed the empty buckets of new databases, which nodes of a cluster
+	// cannot write until a leader is elected
+	if c.DB.SeedDir != "" && !follower && !clustered {
+		n, err := SeedEmpty(ds, c.DB.SeedDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to seed database: %w", err)
+		}
+		if n > 0 {
+			log.WithFields(log.Fields{"count": n}).Info("Seeded database")
+		}
+	}
+
+	// Load the scripts of operators
+	var scripts *script.Engine
+	if c.Scripts.Dir != "" {
+		scripts, err = script.Load(c.Scripts.Dir, &ds.Database, PublicServices(ds),
+			c.Scripts.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load scripts: %w", err)
+		}
+		scripts.Attach(ds.Lifecycle)
+		log.WithFields(log.Fields{
+			"count": len(scripts.Scripts()),
+		}).Info("Loaded scripts")
+	}
+
+	// Create the API controller and HTTP server
+	address := fmt.Sprintf("%s:%s", c.Hostname, c.Port)
+	s := web.NewServer(address)
+	s.Tracer = NewTracer(c)
+	s.Compression = NewCompression(c)
+	if c.Errors.Sentry.DSN != "" {
+		reporter, err := web.NewSentryReporter(c.Errors.Sentry.DSN)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure Sentry: %w", err)
+		}
+		reporter.Environment = c.Errors.Sentry.Environment
+		s.PanicReporter = reporter
+	}
+	s.Maintenance = web.NewMaintenance(c.Maintenance.Enabled || follower,
+		c.Maintenance.RetryAfter)
+	s.Timeouts, err = NewTimeouts(c)
+	if err != nil {
+		return nil, err
+	}
+	if s.Tracer != nil {
+		ds.Database.Tracer = trace.DatabaseTracer{}
+	}
+
+	// Read the secret key used to sign authentication tokens
+	var au *jwt.Authenticator
+	if c.JWT.EnvPath != "" {
+		key, err := jwt.ReadKeyFromEnv(c.JWT.EnvPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT key: %w", err)
+		}
+		au = jwt.NewAuthenticator(key)
+		// Tokens are only valid for the tenant they were issued by
+		au.Audience = c.tenant
+	}
+	if c.Access.PublicReadOnly {
+		s.Access = &web.Access{
+			Rules: PublicRoutes,
+			Authenticate: func(r *http.Request) error {
+				return RequireCaller(r, ds, au)
+			},
+		}
+	}
+
+	graphqlHandler, err := NewGraphQLHandler([]string{"graphql"}, ds, au,
+		c.GraphQL.AllowlistOnly, c.Access.PublicReadOnly, s.Maintenance)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GraphQL handler: %w", err)
+	}
+	s.RegisterHandler(graphqlHandler)
+
+	graphiqlHandler, err := NewGraphiQLHandler(
+		[]string{"graphiql"}, c.basePath()+c.pathPrefix+graphqlHandler.PathString(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GraphiQL handler: %w", err)
+	}
+
+	s.RegisterHandler(graphiqlHandler)
+
+	publicBuckets := []string{}
+	for _, ser := range PublicServices(ds) {
+		publicBuckets = append(publicBuckets, ser.Bucket())
+	}
+	changeFeedHandler := NewChangeFeedHandler(
+		[]string{"changes", "feed"}, ds, publicBuckets,
+	)
+	s.RegisterHandler(changeFeedHandler)
+	s.RegisterHandler(NewChangeFeedDocsHandler(
+		[]string{"changes"}, c.basePath()+c.pathPrefix+changeFeedHandler.PathString(), publicBuckets,
+	))
+
+	s.RegisterHandler(NewTokenHandler(
+		[]string{"auth", "token"}, ds, au, c.JWT.TokenDuration,
+	))
+	s.RegisterHandler(NewTokenRefreshHandler(
+		[]string{"auth", "refresh"}, ds, au, c.JWT.TokenDuration,
+	))
+	s.RegisterHandler(NewLoginSessionsHandler([]string{"users", "me", "sessions"}, ds, au))
+	s.RegisterHandler(NewLoginSessionRevokeHandler(
+		[]string{"users", "me", "sessions", ":id"}, ds, au,
+	))
+	// Login sessions were first served under auth/
+	s.RegisterHandler(NewLoginSessionsHandler([]string{"auth", "sessions"}, ds, au))
+	s.RegisterHandler(NewLoginSessionRevokeHandler(
+		[]string{"auth", "sessions", ":id"}, ds, au,
+	))
+	s.RegisterHandler(NewAPIKeyCreateHandler([]string{"auth", "keys"}, ds, au))
+	s.RegisterHandler(NewAPIKeysHandler([]string{"auth", "keys"}, ds, au))
+	s.RegisterHandler(NewAPIKeyRevokeHandler([]string{"auth", "keys", ":id"}, ds, au))
+	s.RegisterHandler(NewAdminAPIKeysHandler([]string{"admin", "keys"}, ds, au))
+	s.RegisterHandler(NewPersistedQueriesHandler([]string{"admin", "queries"}, ds, au))
+	if len(c.OIDC.Providers) > 0 {
+		providers := NewOIDCProviders(c)
+		logins := NewOIDCLogins()
+		s.RegisterHandler(NewOIDCLoginHandler(
+			[]string{"auth", "oidc", ":provider"}, ds, au, providers, logins,
+			c.OIDC.LoginDuration,
+		))
+		s.RegisterHandler(NewOIDCCallbackHandler(
+			[]string{"auth", "oidc", ":provider", "callback"}, ds, au, providers, logins,
+			c.JWT.TokenDuration,
+		))
+	}
+	mq := NewMailQueue(c)
+	s.RegisterHandler(NewPasswordResetHandler(
+		[]string{"auth", "reset"}, ds, mq, c.Mail.ResetURL, c.Mail.ResetDuration,
+	))
+	s.RegisterHandler(NewPasswordResetConfirmHandler([]string{"auth", "reset", "confirm"}, ds))
+	jm := jobs.NewManager(0)
+	s.RegisterHandler(NewOverviewHandler([]string{"admin", "overview"}, ds, au, jm, errs))
+	s.RegisterHandler(NewMaintenanceHandler([]string{"admin", "maintenance"}, ds, au,
+		s.Maintenance, false))
+	s.RegisterHandler(NewMaintenanceHandler([]string{"admin", "maintenance"}, ds, au,
+		s.Maintenance, true))
+	s.RegisterHandler(NewJobsHandler([]string{"admin", "jobs"}, ds, au, jm))
+	s.RegisterHandler(NewJobStreamHandler([]string{"admin", "jobs", "stream"}, ds, au, jm))
+	s.RegisterHandler(NewBackupHandler([]string{"admin", "backup"}, ds, au, jm))
+	s.RegisterHandler(NewReplicationLogHandler([]string{"admin", "replication", "log"}, ds, au))
+	if clu != nil {
+		s.RegisterHandler(NewClusterStatusHandler([]string{"cluster", "status"}, ds, au, clu))
+	}
+	s.RegisterHandler(NewIntegrityHandler([]string{"admin", "integrity"}, ds, au, jm, false))
+	s.RegisterHandler(NewIntegrityHandler([]string{"admin", "integrity"}, ds, au, jm, true))
+	s.RegisterHandler(NewScrobbleHandler([]string{"scrobble"}, ds, au))
+	s.RegisterHandler(NewTraktScrobbleHandler([]string{"scrobble", "start"}, ds, au,
+		models.PlaybackEventStarted))
+	s.RegisterHandler(NewTraktScrobbleHandler([]string{"scrobble", "pause"}, ds, au,
+		models.PlaybackEventPaused))
+	s.RegisterHandler(NewTraktScrobbleHandler([]string{"scrobble", "stop"}, ds, au,
+		models.PlaybackEventFinished))
+	s.RegisterHandler(NewLibraryHealthHandler(
+		[]string{"user", ":id", "library", "health"}, ds, au, c.Library.StaleAfter,
+	))
+	s.RegisterHandler(NewLibraryBulkEditHandler(
+		[]string{"user", ":id", "library", "bulk"}, ds, au,
+	))
+	s.RegisterHandler(NewProgressHandler([]string{"user", ":id", "progress"}, ds, au))
+	s.RegisterHandler(NewRewatchHandler([]string{"user", ":id", "rewatch"}, ds, au))
+	s.RegisterHandler(NewWatchSessionsHandler([]string{"user", ":id", "sessions"}, ds, au))
+	s.RegisterHandler(NewWatchedHandler([]string{"user", ":id", "watched", ":mediaID"}, ds, au))
+	s.RegisterHandler(NewMarkWatchedHandler(
+		[]string{"user", ":id", "watched", ":mediaID"}, ds, au,
+	))
+	s.RegisterHandler(NewMarkUnwatchedHandler(
+		[]string{"user", ":id", "watched", ":mediaID", ":episodeID"}, ds, au,
+	))
+	s.RegisterHandler(NewHeatmapHandler(
+		[]string{"user", ":id", "history", "heatmap"}, ds, au,
+	))
+	s.RegisterHandler(NewWrapupHandler([]string{"user", ":id", "wrapup", ":year"}, ds, au))
+	s.RegisterHandler(NewContinueWatchingHandler(
+		[]string{"user", ":id", "continue"}, ds, au,
+	))
+	s.RegisterHandler(NewUpcomingHandler([]string{"user", ":id", "upcoming"}, ds, au))
+	s.RegisterHandler(NewListExportHandler(
+		[]string{"user", ":id", "list", "export"}, ds, au,
+	))
+	importInterval := c.Import.Interval
+	if importInterval <= 0 {
+		importInterval = DefaultImportInterval
+	}
+	imports := NewImportQueue(ds, NewListImports(), jm, mq, c.Import.BatchSize,
+		importInterval, func(err error) {
+			log.Errorf("Failed to import staged list entries: %v", err)
+		})
+	s.RegisterHandler(NewListImportHandler(
+		[]string{"user", ":id", "list", "import"}, ds, au, imports,
+	))
+	s.RegisterHandler(NewListImportSummaryHandler(
+		[]string{"user", ":id", "list", "import"}, ds, au, imports.Imports,
+	))
+	s.RegisterHandler(NewImportRowsHandler(
+		[]string{"user", ":id", "list", "import", "rows"}, ds, au, imports,
+	))
+	s.RegisterHandler(NewImportRetryHandler(
+		[]string{"user", ":id", "list", "import", "retry"}, ds, au, imports,
+	))
+	s.RegisterHandler(NewSyncPullHandler([]string{"sync"}, ds, au))
+	s.RegisterHandler(NewSyncPushHandler([]string{"sync"}, ds, au))
+	s.RegisterHandler(NewListHandler([]string{"list", ":id"}, ds, au))
+	s.RegisterHandler(NewListReorderHandler([]string{"list", ":id"}, ds, au))
+	s.RegisterHandler(NewActivityHandler([]string{"user", ":id", "activity"}, ds, au))
+	s.RegisterHandler(NewActivityFeedHandler([]string{"activity"}, ds, au, false))
+	s.RegisterHandler(NewActivityFeedHandler([]string{"activity", "friends"}, ds, au, true))
+	s.RegisterHandler(NewFollowHandler([]string{"user", ":id", "follow"}, ds, au, false))
+	s.RegisterHandler(NewFollowHandler([]string{"user", ":id", "follow"}, ds, au, true))
+	s.RegisterHandler(NewFollowListHandler([]string{"user", ":id", "followers"}, ds, au, true))
+	s.RegisterHandler(NewFollowListHandler([]string{"user", ":id", "following"}, ds, au, false))
+	s.RegisterHandler(NewTrendingHandler([]string{"media", "trending"}, ds))
+	s.RegisterHandler(NewSeasonHandler([]string{"media", "season", ":year", ":quarter"}, ds))
+	s.RegisterHandler(NewMediaByIDsHandler([]string{"media"}, ds))
+	s.RegisterHandler(NewMediaCreateHandler([]string{"media"}, ds, au))
+	s.RegisterHandler(NewMediaDeleteHandler([]string{"media"}, ds, au))
+	s.RegisterHandler(NewMediaImportHandler([]string{"media", "import"}, ds, au))
+	s.RegisterHandler(NewMediaExistsHandler([]string{"media", ":id"}, ds))
+	s.RegisterHandler(NewMediaPatchHandler([]string{"media", ":id"}, ds, au))
+	s.RegisterHandler(NewMediaBySlugHandler([]string{"media", "by-slug", ":slug"}, ds))
+	s.RegisterHandler(NewMediaCountHandler([]string{"media", "count"}, ds))
+	s.RegisterHandler(NewRandomMediaHandler([]string{"media", "random"}, ds, au))
+	s.RegisterHandler(NewMediaSearchHandler([]string{"search", "media"}, ds))
+	s.RegisterHandler(NewSortedMediaHandler([]string{"sorted", "media"}, ds))
+	s.RegisterHandler(NewPersonSearchHandler([]string{"search", "people"}, ds))
+	s.RegisterHandler(NewCharacterSearchHandler([]string{"search", "characters"}, ds))
+	s.RegisterHandler(NewProducerStaffHandler([]string{"producer", ":id", "staff"}, ds, false))
+	s.RegisterHandler(NewProducerStaffHandler([]string{"people", ":id", "producers"}, ds, true))
+	s.RegisterHandler(NewFriendScoresHandler([]string{"media", ":id", "friends"}, ds, au))
+	s.RegisterHandler(NewMediaGenresHandler([]string{"media", ":id", "genres"}, ds, au))
+	s.RegisterHandler(NewMediaCharactersHandler([]string{"media", ":id", "characters"}, ds))
+	s.RegisterHandler(NewMediaStaffHandler([]string{"media", ":id", "staff"}, ds, false))
+	s.RegisterHandler(NewMediaAliasesHandler([]string{"media", ":id", "aliases"}, ds))
+	s.RegisterHandler(NewNextEpisodeHandler([]string{"media", ":id", "next-episode"}, ds))
+	s.RegisterHandler(NewMediaExportHandler([]string{"media", ":id", "export"}, ds))
+	s.RegisterHandler(NewMediaLockHandler([]string{"media", ":id", "lock"}, ds, au,
+		c.Lock.TTL, c.Lock.MaxTTL))
+	s.RegisterHandler(NewMediaUnlockHandler([]string{"media", ":id", "lock"}, ds, au))
+	s.RegisterHandler(NewProposalCreateHandler([]string{"media", ":id", "proposals"}, ds, au))
+	s.RegisterHandler(NewMediaAliasCreateHandler([]string{"media", ":id", "aliases"}, ds, au))
+	s.RegisterHandler(NewMediaAliasUpdateHandler([]string{"alias", ":id"}, ds, au))
+	s.RegisterHandler(NewMediaAliasDeleteHandler([]string{"alias", ":id"}, ds, au))
+	s.RegisterHandler(NewMediaStaffHandler([]string{"people", ":id", "credits"}, ds, true))
+	s.RegisterHandler(NewMediaReviewsHandler([]string{"media", ":id", "reviews"}, ds, au))
+	s.RegisterHandler(NewReviewCreateHandler([]string{"media", ":id", "reviews"}, ds, au))
+	s.RegisterHandler(NewReviewHandler([]string{"review", ":id"}, ds, au))
+	s.RegisterHandler(NewReviewUpdateHandler([]string{"review", ":id"}, ds, au))
+	s.RegisterHandler(NewReviewPatchHandler([]string{"review", ":id"}, ds, au))
+	s.RegisterHandler(NewReviewDeleteHandler([]string{"review", ":id"}, ds, au))
+	s.RegisterHandler(NewFlagHandler([]string{"review", ":id", "flag"}, ds, au, false))
+	s.RegisterHandler(NewHiddenHandler([]string{"review", ":id", "hidden"}, ds, au, false))
+	s.RegisterHandler(NewCommentsHandler([]string{"review", ":id", "comments"}, ds, au))
+	s.RegisterHandler(NewCommentCreateHandler([]string{"review", ":id", "comments"}, ds, au))
+	s.RegisterHandler(NewCommentDeleteHandler([]string{"comment", ":id"}, ds, au))
+	s.RegisterHandler(NewFlagHandler([]string{"comment", ":id", "flag"}, ds, au, true))
+	s.RegisterHandler(NewHiddenHandler([]string{"comment", ":id", "hidden"}, ds, au, true))
+	s.RegisterHandler(NewFlaggedHandler([]string{"moderation", "flagged"}, ds, au))
+	s.RegisterHandler(NewReportHandler([]string{"reports"}, ds, au))
+	s.RegisterHandler(NewReportsHandler([]string{"admin", "reports"}, ds, au))
+	s.RegisterHandler(NewReportResolveHandler([]string{"admin", "reports", ":id"}, ds, au))
+	s.RegisterHandler(NewProposalsHandler([]string{"admin", "proposals"}, ds, au))
+	s.RegisterHandler(NewProposalReviewHandler(
+		[]string{"admin", "proposals", ":id", "approve"}, ds, au, true,
+	))
+	s.RegisterHandler(NewProposalReviewHandler(
+		[]string{"admin", "proposals", ":id", "reject"}, ds, au, false,
+	))
+	s.RegisterHandler(NewNotificationsHandler([]string{"notifications"}, ds, au))
+	s.RegisterHandler(NewNotificationsReadHandler([]string{"notifications", "read"}, ds, au))
+	s.RegisterHandler(NewProfileHandler([]string{"user", ":id", "profile"}, ds, au))
+	s.RegisterHandler(NewPrivacyHandler([]string{"user", ":id", "privacy"}, ds, au))
+	s.RegisterHandler(NewPrivacyUpdateHandler([]string{"user", ":id", "privacy"}, ds, au))
+	s.RegisterHandler(NewCustomStatusesHandler([]string{"user", ":id", "statuses"}, ds, au))
+	s.RegisterHandler(NewCustomStatusesUpdateHandler(
+		[]string{"user", ":id", "statuses"}, ds, au,
+	))
+	s.RegisterHandler(NewSettingsHandler([]string{"user", ":id", "settings"}, ds, au, false))
+	s.RegisterHandler(NewSettingsHandler([]string{"user", ":id", "settings"}, ds, au, true))
+	if scripts != nil {
+		s.RegisterHandler(NewWebhookHandler([]string{"hooks", ":name"}, scripts))
+	}
+
+	var snapshots *db.SnapshotScheduler
+	if c.DB.Snapshots.Interval > 0 {
+		dir := c.DB.Snapshots.Dir
+		if dir == "" {
+			dir = filepath.Join(filepath.Dir(c.DB.Path), "snapshots")
+		}
+		snapshots = db.NewSnapshotScheduler(&ds.Database, db.SnapshotConfig{
+			Interval: c.DB.Snapshots.Interval,
+			Retain:   c.DB.Snapshots.Retain,
+			Dir:      dir,
+		}, func(err error) {
+			log.Errorf("Failed to write database snapshot: %v", err)
+		})
+		snapshots.NewProgress = func() db.Progress {
+			return jm.Start(jobs.KindSnapshot)
+		}
+	}
+
+	var airing *AiringScheduler
+	if c.Notifications.AiringInterval > 0 && !follower {
+		airing = NewAiringScheduler(ds, c.Notifications.AiringInterval, func(err error) {
+			log.Errorf("Failed to notify aired Episodes: %v", err)
+		})
+	}
+
+	var trending *TrendingScheduler
+	if c.Trending.Interval > 0 {
+		trending = NewTrendingScheduler(ds, c.Trending.Interval, func(err error) {
+			log.Errorf("Failed to compute trending Media: %v", err)
+		})
+	}
+
+	var refresh *MetadataRefreshScheduler
+	if c.Refresh.Interval > 0 && !follower {
+		providers := map[string]MetadataProvider{
+			"anilist": &AniListProvider{
+				URL:        c.Refresh.AniListURL,
+				HTTPClient: &http.Client{Timeout: 30 * time.Second},
+			},
+		}
+		if c.Refresh.TMDBAPIKey != "" {
+			providers["tmdb"] = &TMDBProvider{
+				URL:        c.Refresh.TMDBURL,
+				APIKey:     c.Refresh.TMDBAPIKey,
+				HTTPClient: &http.Client{Timeout: 30 * time.Second},
+			}
+		}
+		refresh = NewMetadataRefreshScheduler(ds, providers, c.Refresh.Interval, func(err error) {
+			log.Errorf("Failed to refresh Media metadata: %v", err)
+		})
+		if c.Refresh.Delay > 0 {
+			refresh.Delay = c.Refresh.Delay
+		}
+		refresh.NewProgress = func() db.Progress {
+			return jm.Start(jobs.KindRefresh)
+		}
+	}
+
+	var digests *DigestScheduler
+	if mq != nil && c.Mail.DigestInterval > 0 && !follower {
+		digests = NewDigestScheduler(ds, mq, c.Mail.DigestInterval, func(err error) {
+			log.Errorf("Failed to send airing digests: %v", err)
+		})
+	}
+
+	// Only the leader of a cluster runs the schedulers that write
+	if clu != nil {
+		if airing != nil {
+			airing.sched.active = clu.IsLeader
+		}
+		if trending != nil {
+			trending.sched.active = clu.IsLeader
+		}
+		if refresh != nil {
+			refresh.sched.active = clu.IsLeader
+		}
+		if digests != nil {
+			digests.sched.active = clu.IsLeader
+		}
+		imports.sched.active = clu.IsLeader
+	}
+
+	var replication *ReplicationScheduler
+	if follower {
+		interval := c.Replication.Interval
+		if interval <= 0 {
+			interval = DefaultReplicationInterval
+		}
+		replication = NewReplicationScheduler(ds, c.Replication.Primary,
+			c.Replication.APIKey, interval, func(err error) {
+				log.Errorf("Failed to replicate primary: %v", err)
+			})
+	}
+
+	app := Application{
+		Server:      &s,
+		DataLayer:   ds,
+		Snapshots:   snapshots,
+		Jobs:        jm,
+		Errors:      errs,
+		Airing:      airing,
+		Trending:    trending,
+		Refresh:     refresh,
+		Mail:        mq,
+		Digests:     digests,
+		Tracer:      s.Tracer,
+		Scripts:     scripts,
+		Replication: replication,
+		Cluster:     clu,
+	}
+	if !follower {
+		app.ImportQueue = imports
+	}
+	if c.GRPCPort != "" {
+		app.GRPCAddress = fmt.Sprintf("%s:%s", c.Hostname, c.GRPCPort)
+		app.GRPCServer = rpc.NewServer(ds,
+			func(token string) (*models.User, models.APIKeyScope, error) {
+				return CredentialUser(token, ds, au)
+			}, s.Maintenance.Err)
+	}
+	return &app, nil
+}
+
+// NewTracer returns the Tracer of the requests served as given in the
+// configuration, or nil if tracing is disabled.
+func NewTracer(c *Configuration) *trace.Tracer {
+	tc := c.Tracing
+	if tc.Endpoint == "" {
+		return nil
+	}
+
+	name := tc.ServiceName
+	if name == "" {
+		name = "naos"
+	}
+	t := trace.NewTracer(tc.Endpoint, name, func(err error) {
+		log.Errorf("Failed to export traces: %v", err)
+	})
+	t.Headers = tc.Headers
+	if tc.FlushInterval > 0 {
+		t.FlushInterval = tc.FlushInterval
+	}
+	return t
+}
+
+// NewTimeouts returns the timeouts of requests as given in the
+// configuration.
+func NewTimeouts(c *Configuration) (*web.Timeouts, error) {
+	t := web.Timeouts{
+		Default: c.Timeouts.Default,
+		Routes:  map[string]time.Duration{},
+	}
+	for route, d := range c.Timeouts.Routes {
+		key, err := web.ParseTimeoutRoute(route)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure timeouts: %w", err)
+		}
+		t.Routes[key] = d
+	}
+	return &t, nil
+}
+
+// NewCompression returns the compression of response bodies as given in the
+// configuration, or nil if compression is disabled.
+func NewCompression(c *Configuration) *web.Compression {
+	cc := c.Compression
+	if cc.Disabled {
+		return nil
+	}
+
+	comp := web.Compression{
+		MinSize:      cc.MinSize,
+		ContentTypes: cc.ContentTypes,
+	}
+	if comp.MinSize <= 0 {
+		comp.MinSize = web.DefaultCompressionMinSize
+	}
+	if len(comp.ContentTypes) == 0 {
+		comp.ContentTypes = web.DefaultCompressionContentTypes
+	}
+	return &comp
+}
+
+// NewDataService connects to the database and returns the data layer
+// services.
+func NewDataService(c *Configuration, clearOnClose bool) (*graphql.DataService, error) {
+	// Select record encodings
+	err := ConfigureCodecs(c)
+	if err != nil {
+		return nil, err
+	}
+
+	// Select ID assignment strategies
+	err = ConfigureIDGenerators(c)
+	if err != nil {
+		return nil, err
+	}
+
+	ConfigureNormalizer(c)
+	ConfigureScanWorkers(c)
+	return newDataService(c, clearOnClose)
+}
+
+// newDataService connects to the database and returns the data layer
+// services, with the record encodings and ID assignment strategies already
+// selected, which are shared by the databases of all tenants.
+func newDataService(c *Configuration, clearOnClose bool) (*graphql.DataService, error) {
+	inverses, err := RelationInverses(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read relation inverses: %w", err)
+	}
+
 	// Open database connection
 	log.WithFields(log.Fields{
 		"path":     c.DB.Path,
 		"filemode": c.DB.Filemode,
+		"tenant":   c.tenant,
 	}).Info("Establishing database connection")
 
-	// Create the API controller and HTTP server
-	address := fmt.Sprintf("%s:%s", c.Hostname, c.Port)
-	s := web.NewServer(address)
-
 	characterService := &data.CharacterService{}
 	episodeService := &data.EpisodeService{}
-	episodeSetService := &data.EpisodeSetService{}
 	genreService := &data.GenreService{}
 	mediaService := &data.MediaService{}
+	episodeSetService := &data.EpisodeSetService{
+		EpisodeService: episodeService,
+		MediaService:   mediaService,
+	}
 	personService := &data.PersonService{}
 	producerService := &data.ProducerService{}
 	userService := &data.UserService{}
@@ -57,40 +799,171 @@ func NewApplication(c *Configuration) (*Application, error) {
 		MediaService:    mediaService,
 		ProducerService: producerService,
 	}
+	// MediaRelations are created and deleted along with their inverses
 	mediaRelationService := &data.MediaRelationService{
 		MediaService: mediaService,
+		Inverses:     inverses,
 	}
 	userMediaService := &data.UserMediaService{
-		UserService:  userService,
-		MediaService: mediaService,
+		UserService:        userService,
+		MediaService:       mediaService,
+		EpisodeService:     episodeService,
+		EpisodeSetService:  episodeSetService,
+		ScrobbleSessionGap: c.Scrobble.SessionGap,
 	}
 	userMediaListService := &data.UserMediaListService{
 		UserService:      userService,
 		UserMediaService: userMediaService,
 	}
+	// Watch states of Episodes are deleted with their Users and Episodes
+	userEpisodeService := data.NewUserEpisodeService(db.PersistHooks{}, userService,
+		episodeService, userMediaService)
+	// Staff credits are deleted with their Media and People
+	mediaStaffService := data.NewMediaStaffService(db.PersistHooks{},
+		mediaService, personService)
+	// Staff are deleted with their Producers and People
+	producerStaffService := data.NewProducerStaffService(db.PersistHooks{},
+		producerService, personService)
+	// Follows are deleted with either of their Users
+	userFollowService := data.NewUserFollowService(db.PersistHooks{}, userService)
+	// Reviews are deleted with their Users and Media, and Comments with their
+	// Users and Reviews
+	reviewService := data.NewReviewService(db.PersistHooks{}, userService, mediaService)
+	commentService := data.NewCommentService(db.PersistHooks{}, userService, reviewService)
+	// Reports are deleted with their reporters and the reported content
+	moderationService := data.NewModerationService(db.PersistHooks{}, userService,
+		mediaService, reviewService, commentService)
+	// Watch sessions are deleted with their Users and UserMedia
+	watchSessionService := data.NewWatchSessionService(db.PersistHooks{},
+		c.Scrobble.SessionGap, userService, userMediaService)
+	// Notifications are deleted with their Users
+	notificationService := data.NewNotificationService(db.PersistHooks{}, userService,
+		userFollowService, userMediaService)
+	// Media are indexed by the season they premiered in
+	mediaSeasonService := data.NewMediaSeasonService(db.PersistHooks{}, mediaService,
+		userMediaService)
+	// Dated Episodes are indexed by the date they air
+	episodeAiringService := data.NewEpisodeAiringService(db.PersistHooks{}, mediaService,
+		episodeService, episodeSetService, userMediaService)
+	// Media are kept sorted by their start dates, scores and titles
+	titleLanguages := c.Order.TitleLanguages
+	if len(titleLanguages) == 0 {
+		titleLanguages = DefaultOrderTitleLanguages
+	}
+	mediaOrderService := data.NewMediaOrderService(db.PersistHooks{}, mediaService,
+		userMediaService, titleLanguages)
+	// Media, People, Characters and Producers are indexed by their Slugs
+	slugService := data.NewSlugService(db.PersistHooks{}, mediaService, personService,
+		characterService, producerService)
+	// Aliases are deleted with their Media
+	mediaAliasService := data.NewMediaAliasService(db.PersistHooks{}, mediaService)
+	// Media, People and Characters are indexed by their titles, aliases and
+	// names for search, names in kanji and hanzi also by their readings
+	nameService := data.NewNameService(db.PersistHooks{}, mediaService, mediaAliasService,
+		personService, characterService, data.NewKanjiRomanizer(), data.NewPinyinRomanizer())
+	// Password resets are deleted with their Users
+	passwordResetService := data.NewPasswordResetService(db.PersistHooks{}, userService)
+	// Login sessions are deleted with their Users
+	loginSessionService := data.NewLoginSessionService(db.PersistHooks{}, userService)
+	// Identities at external providers are deleted with their Users
+	identityService := data.NewIdentityService(db.PersistHooks{}, userService)
+	// API keys are deleted with their Users
+	apiKeyService := data.NewAPIKeyService(db.PersistHooks{}, userService)
+	changeService := &data.ChangeService{}
+	// Changes to the entities of Users are deleted with them
+	syncService := data.NewSyncService(changeService, userService)
+	activityService := &data.ActivityService{
+		UserService: userService,
+		FeedSize:    c.Activity.FeedSize,
+	}
+	persistedQueryService := &data.PersistedQueryService{}
+	// Locks are deleted with their Users and the locked entities
+	lockService := data.NewLockService(db.PersistHooks{}, userService, mediaService)
+	// Proposals are deleted with their proposers and Media, and approved ones
+	// are attributed to their proposers in the change log
+	proposalService := data.NewProposalService(db.PersistHooks{}, userService,
+		mediaService, changeService, mergePatchMedia)
+	mediaBundleService := &data.MediaBundleService{
+		MediaService:          mediaService,
+		EpisodeService:        episodeService,
+		EpisodeSetService:     episodeSetService,
+		GenreService:          genreService,
+		MediaGenreService:     mediaGenreService,
+		CharacterService:      characterService,
+		PersonService:         personService,
+		MediaCharacterService: mediaCharacterService,
+		MediaStaffService:     mediaStaffService,
+		MediaRelationService:  mediaRelationService,
+	}
+	// Staged imports are deleted with their Users
+	importRowService := data.NewImportRowService(db.PersistHooks{}, userService)
+	trendingService := &data.TrendingService{
+		UserMediaService: userMediaService,
+		ActivityService:  activityService,
+		Window:           c.Trending.Window,
+	}
+	statsService := &data.StatsService{
+		WatchSessionService: watchSessionService,
+		EpisodeService:      episodeService,
+		MediaGenreService:   mediaGenreService,
+		UserMediaService:    userMediaService,
+	}
 
 	buckets := []string{
 		characterService.Bucket(), episodeService.Bucket(), episodeSetService.Bucket(),
 		genreService.Bucket(), mediaService.Bucket(), personService.Bucket(),
-		producerService.Bucket(), userService.Bucket(), mediaCharacterService.Bucket(),
+		producerService.Bucket(), producerStaffService.Bucket(), userService.Bucket(),
+		mediaCharacterService.Bucket(),
 		mediaGenreService.Bucket(), mediaProducerService.Bucket(),
-		mediaRelationService.Bucket(), userMediaService.Bucket(),
-		userMediaListService.Bucket(),
+		mediaRelationService.Bucket(), mediaStaffService.Bucket(), userMediaService.Bucket(),
+		userMediaListService.Bucket(), userEpisodeService.Bucket(), userFollowService.Bucket(),
+		reviewService.Bucket(), commentService.Bucket(), moderationService.Bucket(),
+		watchSessionService.Bucket(), notificationService.Bucket(), changeService.Bucket(),
+		activityService.Bucket(), passwordResetService.Bucket(),
+		mediaSeasonService.Bucket(), episodeAiringService.Bucket(),
+		mediaOrderService.Bucket(), loginSessionService.Bucket(),
+		identityService.Bucket(), apiKeyService.Bucket(), persistedQueryService.Bucket(),
+		slugService.Bucket(), importRowService.Bucket(), nameService.Bucket(),
+		mediaAliasService.Bucket(), lockService.Bucket(), proposalService.Bucket(),
 	}
 
+	keys, err := keyEncoding(c)
+	if err != nil {
+		return nil, err
+	}
 	driver, err := db.ConnectBoltDatabase(&db.BoltDatabaseConfig{
 		Path:         c.DB.Path,
 		FileMode:     os.FileMode(c.DB.Filemode),
 		Buckets:      buckets,
-		ClearOnClose: true,
+		ClearOnClose: clearOnClose,
+		Keys:         keys,
+		VerifyOnly:   c.DB.VerifyBuckets,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
+	// Records keyed in another encoding would not be found by ID
+	mismatched, err := driver.VerifyKeys()
+	if err == nil && len(mismatched) > 0 {
+		err = fmt.Errorf("buckets %s; run naosmigrate to re-key them as %q: %w",
+			strings.Join(mismatched, ", "), c.DB.KeyEncoding, db.ErrKeyEncoding)
+	}
+	if err != nil {
+		// Closed without clearing on close
+		driver.Bolt.Close()
+		return nil, fmt.Errorf("failed to verify keys of database: %w", err)
+	}
+
 	database := db.DatabaseService{
 		DatabaseDriver: driver,
 	}
+	if c.DB.Cache.Size > 0 {
+		database.DatabaseDriver = db.NewCachedDatabase(driver, db.CacheConfig{
+			Size: c.DB.Cache.Size,
+			TTL:  c.DB.Cache.TTL,
+		})
+	}
 	ds := graphql.DataService{
 		Database:              database,
 		CharacterService:      characterService,
@@ -102,27 +975,101 @@ func NewApplication(c *Configuration) (*Application, error) {
 		MediaGenreService:     mediaGenreService,
 		MediaProducerService:  mediaProducerService,
 		MediaRelationSerivce:  mediaRelationService,
+		MediaStaffService:     mediaStaffService,
+		MediaAliasService:     mediaAliasService,
 		PersonService:         personService,
 		ProducerService:       producerService,
+		ProducerStaffService:  producerStaffService,
 		UserService:           userService,
 		UserMediaService:      userMediaService,
 		UserMediaListService:  userMediaListService,
+		UserEpisodeService:    userEpisodeService,
+		UserFollowService:     userFollowService,
+		ReviewService:         reviewService,
+		CommentService:        commentService,
+		ModerationService:     moderationService,
+		WatchSessionService:   watchSessionService,
+		NotificationService:   notificationService,
+		PasswordResetService:  passwordResetService,
+		LoginSessionService:   loginSessionService,
+		IdentityService:       identityService,
+		APIKeyService:         apiKeyService,
+		MediaSeasonService:    mediaSeasonService,
+		EpisodeAiringService:  episodeAiringService,
+		MediaOrderService:     mediaOrderService,
+		MediaBundleService:    mediaBundleService,
+		LockService:           lockService,
+		ProposalService:       proposalService,
+		SlugService:           slugService,
+		NameService:           nameService,
+		TrendingService:       trendingService,
+		StatsService:          statsService,
+		ChangeService:         changeService,
+		SyncService:           syncService,
+		ActivityService:       activityService,
+		PersistedQueryService: persistedQueryService,
+		ImportRowService:      importRowService,
+		Lifecycle:             &db.Lifecycle{},
 	}
 
-	graphqlHandler := NewGraphQLHandler([]string{"graphql"}, &ds)
-	s.RegisterHandler(graphqlHandler)
-
-	graphiqlHandler, err := NewGraphiQLHandler(
-		[]string{"graphiql"}, graphqlHandler.PathString(),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create GraphiQL handler: %w", err)
+	// Record changes to public entities in the change log
+	for _, ser := range PublicServices(&ds) {
+		changeService.Track(ser)
 	}
+	// Let clients sync the libraries of Users
+	syncService.Register(data.SyncType{
+		Service: userMediaService,
+		New:     func() db.Model { return &models.UserMedia{} },
+		Owner: func(m db.Model) (int, error) {
+			um, err := userMediaService.AssertType(m)
+			if err != nil {
+				return 0, err
+			}
+			return um.UserID, nil
+		},
+	})
+	syncService.Register(data.SyncType{
+		Service: userMediaListService,
+		New:     func() db.Model { return &models.UserMediaList{} },
+		Owner: func(m db.Model) (int, error) {
+			uml, err := userMediaListService.AssertType(m)
+			if err != nil {
+				return 0, err
+			}
+			return uml.UserID, nil
+		},
+	})
+	// Record the events of Users in their activity feeds
+	activityService.Track(userMediaService, userMediaListService)
+	// Notify followers of the events of Users
+	notificationService.Track(activityService)
+	// Call the hooks registered by embedders and modules, after all others
+	ds.Lifecycle.Attach(Services(&ds)...)
 
-	s.RegisterHandler(graphiqlHandler)
+	return &ds, nil
+}
+
+// PublicServices returns the services of the public catalog entities, those
+// not owned by any User.
+func PublicServices(ds *graphql.DataService) []db.Service {
+	return []db.Service{
+		ds.CharacterService, ds.EpisodeService, ds.EpisodeSetService,
+		ds.GenreService, ds.MediaService, ds.PersonService, ds.ProducerService,
+		ds.MediaCharacterService, ds.MediaGenreService, ds.MediaProducerService,
+		ds.MediaRelationSerivce, ds.MediaStaffService, ds.ProducerStaffService,
+		ds.MediaAliasService,
+	}
+}
 
-	return &Application{
-		Server:    &s,
-		DataLayer: &ds,
-	}, nil
+// Services returns all the services of the given data layer.
+func Services(ds *graphql.DataService) []db.Service {
+	return append(PublicServices(ds),
+		ds.UserService, ds.UserMediaService, ds.UserMediaListService,
+		ds.UserEpisodeService, ds.UserFollowService, ds.ReviewService, ds.CommentService,
+		ds.ModerationService, ds.WatchSessionService, ds.NotificationService,
+		ds.PasswordResetService, ds.MediaSeasonService, ds.EpisodeAiringService,
+		ds.MediaOrderService, ds.ChangeService,
+		ds.ActivityService, ds.LoginSessionService, ds.IdentityService,
+		ds.APIKeyService, ds.PersistedQueryService, ds.SlugService,
+		ds.ImportRowService, ds.NameService, ds.LockService, ds.ProposalService)
 }
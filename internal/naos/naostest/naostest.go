@@ -0,0 +1,49 @@
+// Package naostest provides a harness for integration tests against a real
+// database.
+package naostest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/fixtures"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/naos"
+)
+
+// NewDataService returns a data layer backed by a new temporary database,
+// loaded with the fixtures files at the given paths, and the refs of the
+// loaded entities. The returned function closes and removes the database.
+func NewDataService(
+	t testing.TB, paths ...string,
+) (*graphql.DataService, fixtures.Refs, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "naostest")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+
+	var c naos.Configuration
+	c.DB.Path = filepath.Join(dir, "naos.db")
+	c.DB.Filemode = 0600
+
+	ds, err := naos.NewDataService(&c, false)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("failed to initialize data layer: %v", err)
+	}
+	cleanup := func() {
+		ds.Database.Close()
+		os.RemoveAll(dir)
+	}
+
+	refs, err := naos.Seed(ds, paths...)
+	if err != nil {
+		cleanup()
+		t.Fatalf("failed to load fixtures: %v", err)
+	}
+	return ds, refs, cleanup
+}
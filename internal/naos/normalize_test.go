@@ -0,0 +1,74 @@
+package naos_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestNormalize tests that the strings of entities are trimmed and put in
+// NFC, with the whitespace of single lines collapsed, and that dates before
+// those they follow or with years out of bounds are rejected.
+func TestNormalize(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		mID, err := ds.MediaService.Create(&models.Media{
+			Titles: []models.Title{{String: " Cafe\u0301 Bebop\n", Language: "en"}},
+		}, tx)
+		if err != nil {
+			return err
+		}
+		md, err := ds.MediaService.GetByID(mID, tx)
+		if err != nil {
+			return err
+		}
+		if s := md.Titles[0].String; s != "Café Bebop" {
+			t.Errorf("expected the Title trimmed in NFC, got %q", s)
+		}
+
+		a := models.MediaAlias{MediaID: refs["bebop"], Title: " Cowboy \t\n Bebop "}
+		_, err = ds.MediaAliasService.Create(&a, tx)
+		if err != nil {
+			return err
+		}
+		if a.Title != "Cowboy Bebop" {
+			t.Errorf("expected the whitespace of the alias collapsed, got %q", a.Title)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(1998, time.April, 3, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, -1)
+	early := time.Date(1700, time.January, 1, 0, 0, 0, 0, time.UTC)
+	err = ds.Database.Transaction(true, func(tx db.Tx) error {
+		_, err := ds.MediaService.Create(&models.Media{
+			Titles:    []models.Title{{String: "Cowboy Bebop", Language: "en"}},
+			StartDate: &start,
+			EndDate:   &end,
+		}, tx)
+		return err
+	})
+	checkFieldErrors(t, err, []data.FieldError{
+		{Path: "EndDate", Code: data.FieldOutOfRange},
+	})
+
+	err = ds.Database.Transaction(true, func(tx db.Tx) error {
+		_, err := ds.UserMediaService.Create(&models.UserMedia{
+			UserID: refs["faye"], MediaID: refs["bebop"],
+			WatchInstances: []models.WatchedInstance{{StartDate: &early}},
+		}, tx)
+		return err
+	})
+	checkFieldErrors(t, err, []data.FieldError{
+		{Path: "WatchInstances[0].StartDate", Code: data.FieldOutOfRange},
+	})
+}
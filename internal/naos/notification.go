@@ -0,0 +1,194 @@
+package naos
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Inbox is a single page of the Notifications of a User.
+type Inbox struct {
+	// Unread is the number of unread Notifications of the User.
+	Unread        int                    `json:"unread"`
+	First         *int                   `json:"first"`
+	Skip          *int                   `json:"skip"`
+	Notifications []*models.Notification `json:"notifications"`
+}
+
+// ReadRequest is the request body of marking Notifications as read.
+type ReadRequest struct {
+	// IDs are the Notifications to mark; all are marked if empty.
+	IDs []int `json:"ids"`
+}
+
+// NewNotificationsHandler returns a GET endpoint handler that lists the
+// Notifications of the authenticated User, newest first, paginated by the
+// first and skip query parameters, along with their number of unread
+// Notifications. Only unread Notifications are listed if the unread query
+// parameter is true, and only those updated after the updated_since query
+// parameter if it is given.
+func NewNotificationsHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			u, ok := notificationsCaller(w, r, ds, au)
+			if !ok {
+				return
+			}
+			first, skip, ok := parsePagination(w, r)
+			if !ok {
+				return
+			}
+			since, ok := parseUpdatedSince(w, r)
+			if !ok {
+				return
+			}
+			unread := r.URL.Query().Get("unread") == "true"
+
+			inbox := Inbox{First: first, Skip: skip}
+			err := ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var err error
+				inbox.Notifications, err = ds.NotificationService.GetByUser(
+					u.Meta.ID, unread, since, first, skip, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get Notifications of User with ID %d: %w",
+						u.Meta.ID, err)
+				}
+				inbox.Unread, err = ds.NotificationService.UnreadCount(u.Meta.ID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to count unread Notifications of User with ID %d: %w",
+						u.Meta.ID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(inbox, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewNotificationsReadHandler returns a POST endpoint handler that marks the
+// Notifications of the authenticated User given in the request body as read,
+// or all of them if none are given, and responds with the number of unread
+// Notifications left.
+func NewNotificationsReadHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			u, ok := notificationsCaller(w, r, ds, au)
+			if !ok {
+				return
+			}
+			var req ReadRequest
+			if !parseRequestBody(w, r, &req) {
+				return
+			}
+
+			inbox := Inbox{Notifications: []*models.Notification{}}
+			err := ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				err := ds.NotificationService.MarkRead(u.Meta.ID, req.IDs, tx)
+				if err != nil {
+					return fmt.Errorf("failed to mark Notifications as read: %w", err)
+				}
+				inbox.Unread, err = ds.NotificationService.UnreadCount(u.Meta.ID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to count unread Notifications of User with ID %d: %w",
+						u.Meta.ID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(inbox, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// notificationsCaller returns the authenticated caller of the request.
+// Otherwise, it encodes an error response and returns false.
+func notificationsCaller(
+	w http.ResponseWriter, r *http.Request, ds *graphql.DataService, au *jwt.Authenticator,
+) (*models.User, bool) {
+	u, err := RequestUser(r, ds, au)
+	if err != nil {
+		web.EncodeResponseErrorFor(web.ErrorAuthentication, err, w)
+		return nil, false
+	}
+	if u == nil {
+		web.EncodeResponseErrorUnauthorized(web.ErrorAuthentication,
+			errors.New("no credentials given"), w)
+		return nil, false
+	}
+	return u, true
+}
+
+// AiringScheduler periodically notifies Users of the Episodes aired since the
+// previous run.
+type AiringScheduler struct {
+	DataLayer *graphql.DataService
+	// Interval is the duration between runs.
+	Interval time.Duration
+	// OnError is called with the errors encountered while notifying in the
+	// background.
+	OnError func(error)
+
+	sched schedule
+}
+
+// NewAiringScheduler returns an AiringScheduler for the given data layer.
+func NewAiringScheduler(
+	ds *graphql.DataService, interval time.Duration, onError func(error),
+) *AiringScheduler {
+	return &AiringScheduler{
+		DataLayer: ds,
+		Interval:  interval,
+		OnError:   onError,
+	}
+}
+
+// Start begins notifying Users of the Episodes aired from now on, at every
+// interval.
+func (s *AiringScheduler) Start() error {
+	err := s.sched.start(s.Interval, func(from time.Time, to time.Time) error {
+		return s.DataLayer.Database.Transaction(true, func(tx db.Tx) error {
+			_, err := s.DataLayer.NotificationService.NotifyAired(from, to, tx)
+			return err
+		})
+	}, s.OnError)
+	if err != nil {
+		return fmt.Errorf("failed to start airing scheduler: %w", err)
+	}
+	return nil
+}
+
+// Stop stops notifying Users and waits for a run in progress to finish.
+func (s *AiringScheduler) Stop() {
+	s.sched.halt()
+}
@@ -0,0 +1,104 @@
+package naos_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestNotifications tests that followers are notified of Activities and Users
+// of aired Episodes of the Media they are watching, once each.
+func TestNotifications(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	spike := refs["spike"]
+	aired := time.Date(2020, 4, 1, 20, 0, 0, 0, time.UTC)
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		jetID, err := ds.UserService.Create(
+			&models.User{Username: "jet", Password: []byte("bonsai")}, tx)
+		if err != nil {
+			return err
+		}
+		u, err := ds.UserService.GetByID(spike, tx)
+		if err != nil {
+			return err
+		}
+		u.Privacy.Lists = models.VisibilityUsers
+		err = ds.UserService.Update(u, tx)
+		if err != nil {
+			return err
+		}
+		err = ds.UserFollowService.Follow(jetID, spike, tx)
+		if err != nil {
+			return err
+		}
+
+		// Scoring records an Activity of which jet is notified
+		um, err := ds.UserMediaService.GetByID(refs["watching"], tx)
+		if err != nil {
+			return err
+		}
+		score := 90
+		um.Score = &score
+		status := models.WatchStatusCurrent
+		um.Status = &status
+		err = ds.UserMediaService.Update(um, tx)
+		if err != nil {
+			return err
+		}
+
+		epID, err := ds.EpisodeService.Create(&models.Episode{Date: &aired}, tx)
+		if err != nil {
+			return err
+		}
+		_, err = ds.EpisodeSetService.Create(&models.EpisodeSet{
+			MediaID: refs["bebop"], Episodes: []int{epID},
+		}, tx)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 2; i++ {
+			_, err = ds.NotificationService.NotifyAired(
+				aired.Add(-time.Hour), aired.Add(time.Hour), tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, c := range []struct {
+			uID  int
+			kind models.NotificationKind
+		}{
+			{jetID, models.NotificationFriendActivity},
+			{spike, models.NotificationEpisodeAired},
+		} {
+			list, err := ds.NotificationService.GetByUser(c.uID, true, nil, nil, nil, tx)
+			if err != nil {
+				return err
+			}
+			if len(list) != 1 || list[0].Kind != c.kind {
+				t.Errorf("expected a %v Notification for User %d, got %d", c.kind, c.uID, len(list))
+			}
+		}
+
+		err = ds.NotificationService.MarkRead(spike, nil, tx)
+		if err != nil {
+			return err
+		}
+		n, err := ds.NotificationService.UnreadCount(spike, tx)
+		if err != nil {
+			return err
+		}
+		if n != 0 {
+			t.Errorf("expected no unread Notifications, got %d", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+}
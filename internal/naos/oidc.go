@@ -0,0 +1,353 @@
+package naos
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/oidc"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// DefaultOIDCLoginDuration is how long Users have to complete logins at
+// identity providers if not configured.
+const DefaultOIDCLoginDuration = 10 * time.Minute
+
+// NewOIDCProviders returns the OpenID Connect identity providers given in the
+// configuration, by name.
+func NewOIDCProviders(c *Configuration) map[string]*oidc.Provider {
+	providers := map[string]*oidc.Provider{}
+	for name, pc := range c.OIDC.Providers {
+		providers[name] = oidc.NewProvider(oidc.Config{
+			Issuer:       pc.Issuer,
+			ClientID:     pc.ClientID,
+			ClientSecret: pc.ClientSecret,
+			RedirectURL:  pc.RedirectURL,
+			Scopes:       pc.Scopes,
+		})
+	}
+	return providers
+}
+
+// OIDCLogin is a login at an identity provider in progress.
+type OIDCLogin struct {
+	Provider string
+	Nonce    string
+	// UserID is the ID of the User the account is linked to, or 0 to log in
+	// with the account.
+	UserID    int
+	Device    string
+	ExpiresAt time.Time
+}
+
+// OIDCLogins holds the logins at identity providers in progress by their
+// state. It is safe for concurrent use.
+type OIDCLogins struct {
+	mu     sync.Mutex
+	logins map[string]*OIDCLogin
+}
+
+// NewOIDCLogins returns an empty OIDCLogins.
+func NewOIDCLogins() *OIDCLogins {
+	return &OIDCLogins{logins: map[string]*OIDCLogin{}}
+}
+
+// Begin holds the given login under the given state, dropping expired logins.
+func (ol *OIDCLogins) Begin(state string, l *OIDCLogin, now time.Time) {
+	ol.mu.Lock()
+	defer ol.mu.Unlock()
+
+	for s, o := range ol.logins {
+		if now.After(o.ExpiresAt) {
+			delete(ol.logins, s)
+		}
+	}
+	ol.logins[state] = l
+}
+
+// Complete returns and removes the unexpired login of the given provider with
+// the given state, or nil if there is none. Each login completes only once.
+func (ol *OIDCLogins) Complete(provider string, state string, now time.Time) *OIDCLogin {
+	ol.mu.Lock()
+	defer ol.mu.Unlock()
+
+	l, ok := ol.logins[state]
+	if !ok {
+		return nil
+	}
+	delete(ol.logins, state)
+	if l.Provider != provider || now.After(l.ExpiresAt) {
+		return nil
+	}
+	return l
+}
+
+// OIDCLoginResponse is the response body of a login begun at an identity
+// provider.
+type OIDCLoginResponse struct {
+	// URL is the address of the login page of the provider that the User is
+	// sent to.
+	URL string `json:"url"`
+}
+
+// NewOIDCLoginHandler returns a GET endpoint handler that begins a login at
+// the identity provider given by the provider path variable and returns the
+// address of its login page. If the request is authenticated, the account
+// is linked to its User instead. The device query parameter names the
+// device logged in from, as in token requests.
+func NewOIDCLoginHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+	providers map[string]*oidc.Provider, logins *OIDCLogins, duration time.Duration,
+) web.Handler {
+	if duration <= 0 {
+		duration = DefaultOIDCLoginDuration
+	}
+
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			name := ps.ByName("provider")
+			p, ok := providers[name]
+			if !ok {
+				web.EncodeResponseErrorFor(web.ErrorPathVariableParsing,
+					fmt.Errorf("identity provider %q: %w", name, data.ErrNotFound), w)
+				return
+			}
+
+			u, scope, err := RequestCaller(r, ds, au)
+			if err == nil && u != nil && !scope.Includes(models.APIKeyScopeAdmin) {
+				// Linked accounts log in with all the permissions of the User
+				err = fmt.Errorf("API key of scope %s: may not link accounts: %w", scope,
+					data.ErrUnauthorized)
+			}
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorAuthentication, err, w)
+				return
+			}
+
+			state, err := oidc.NewState()
+			if err != nil {
+				web.EncodeResponseErrorInternalServer(web.ErrorInternalServer, err, w)
+				return
+			}
+			nonce, err := oidc.NewState()
+			if err != nil {
+				web.EncodeResponseErrorInternalServer(web.ErrorInternalServer, err, w)
+				return
+			}
+			url, err := p.AuthCodeURL(r.Context(), state, nonce)
+			if err != nil {
+				web.EncodeResponseErrorInternalServer(web.ErrorInternalServer,
+					fmt.Errorf("identity provider %q: %w", name, err), w)
+				return
+			}
+
+			now := time.Now()
+			l := OIDCLogin{
+				Provider:  name,
+				Nonce:     nonce,
+				Device:    loginDevice(r, r.URL.Query().Get("device")),
+				ExpiresAt: now.Add(duration),
+			}
+			if u != nil {
+				l.UserID = u.Meta.ID
+			}
+			logins.Begin(state, &l, now)
+
+			web.EncodeResponseBody(OIDCLoginResponse{URL: url}, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewOIDCCallbackHandler returns a GET endpoint handler that completes the
+// login at the identity provider given by the provider path variable with
+// the code and state query parameters sent back by it, and issues a token as
+// for logins with a password. Users are created for accounts that are not
+// linked to any.
+func NewOIDCCallbackHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+	providers map[string]*oidc.Provider, logins *OIDCLogins, duration time.Duration,
+) web.Handler {
+	if duration <= 0 {
+		duration = DefaultTokenDuration
+	}
+
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			name := ps.ByName("provider")
+			p, ok := providers[name]
+			if !ok {
+				web.EncodeResponseErrorFor(web.ErrorPathVariableParsing,
+					fmt.Errorf("identity provider %q: %w", name, data.ErrNotFound), w)
+				return
+			}
+			if !tokensConfigured(w, au) {
+				return
+			}
+
+			q := r.URL.Query()
+			if e := q.Get("error"); e != "" {
+				web.EncodeResponseErrorFor(web.ErrorAuthentication,
+					fmt.Errorf("identity provider %q: %s: %w", name, e, data.ErrUnauthorized), w)
+				return
+			}
+			now := time.Now()
+			l := logins.Complete(name, q.Get("state"), now)
+			if l == nil {
+				web.EncodeResponseErrorFor(web.ErrorAuthentication,
+					fmt.Errorf("login state: invalid or expired: %w", data.ErrUnauthorized), w)
+				return
+			}
+
+			claims, err := p.Exchange(r.Context(), q.Get("code"), l.Nonce)
+			if errors.Is(err, oidc.ErrInvalidToken) {
+				err = fmt.Errorf("%v: %w", err, data.ErrUnauthorized)
+			}
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorAuthentication,
+					fmt.Errorf("identity provider %q: %w", name, err), w)
+				return
+			}
+
+			var u *models.User
+			var ls *models.LoginSession
+			err = ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				var err error
+				u, err = OIDCUser(ds, name, claims, l.UserID, tx)
+				if err != nil {
+					return err
+				}
+				if u.Disabled {
+					return fmt.Errorf("User %q: disabled: %w", u.Username, data.ErrUnauthorized)
+				}
+				ls, err = ds.LoginSessionService.Start(u.Meta.ID, l.Device, requestIP(r),
+					now, now.Add(duration), tx)
+				return err
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorAuthentication, err, w)
+				return
+			}
+
+			issueToken(w, u.Username, ls.Meta.ID, au, duration)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// maxUsernameAttempts is the number of usernames tried for a User created
+// for an account before giving up.
+const maxUsernameAttempts = 100
+
+// OIDCUser returns the User linked to the account with the given verified
+// claims at the identity provider with the given name. If the User with the
+// given ID is not 0, the account is linked to them, failing with an error
+// wrapping data.ErrConflict if it is linked to another User. Otherwise, a
+// User is created for accounts not linked to any, named after the preferred
+// username or email address of the account.
+func OIDCUser(
+	ds *graphql.DataService, provider string, claims *oidc.Claims, linkID int,
+	tx db.Tx,
+) (*models.User, error) {
+	id, err := ds.IdentityService.GetBySubject(claims.Issuer, claims.Subject, tx)
+	if err != nil && !errors.Is(err, data.ErrNotFound) {
+		return nil, err
+	}
+
+	if id == nil {
+		uID := linkID
+		if uID == 0 {
+			u, err := createOIDCUser(ds, claims, tx)
+			if err != nil {
+				return nil, err
+			}
+			uID = u.Meta.ID
+		}
+		id, err = ds.IdentityService.Link(uID, provider, claims.Issuer, claims.Subject,
+			claims.Email, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to link account: %w", err)
+		}
+	} else if linkID != 0 && id.UserID != linkID {
+		return nil, fmt.Errorf("account %q of issuer %q: linked to another User: %w",
+			claims.Subject, claims.Issuer, data.ErrConflict)
+	}
+
+	u, err := ds.UserService.GetByID(id.UserID, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get User by ID %d: %w", id.UserID, err)
+	}
+	return u, nil
+}
+
+// createOIDCUser creates a User for the account with the given claims. Its
+// password is random, so it logs in through the identity provider until it
+// is reset.
+func createOIDCUser(
+	ds *graphql.DataService, claims *oidc.Claims, tx db.Tx,
+) (*models.User, error) {
+	base := strings.TrimSpace(claims.PreferredUsername)
+	if base == "" {
+		base = strings.TrimSpace(strings.SplitN(claims.Email, "@", 2)[0])
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	username := ""
+	for i := 1; i <= maxUsernameAttempts; i++ {
+		candidate := base
+		if i > 1 {
+			candidate += strconv.Itoa(i)
+		}
+		_, err := ds.UserService.GetByUsername(candidate, tx)
+		if errors.Is(err, data.ErrNotFound) {
+			username = candidate
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get User by username %q: %w", candidate, err)
+		}
+	}
+	if username == "" {
+		return nil, fmt.Errorf("username %q: %w", base, data.ErrConflict)
+	}
+
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate password: %w", err)
+	}
+	u := models.User{
+		Username: username,
+		Password: []byte(hex.EncodeToString(buf)),
+	}
+	if claims.EmailVerified {
+		u.Email = claims.Email
+	}
+	_, err = ds.UserService.Create(&u, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create User: %w", err)
+	}
+	return &u, nil
+}
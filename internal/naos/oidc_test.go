@@ -0,0 +1,63 @@
+package naos_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/naos"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/internal/oidc"
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// TestOIDCUser tests that Users are created for accounts at identity
+// providers on first login and found by them afterwards, and that accounts
+// are linked to only one User.
+func TestOIDCUser(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	claims := oidc.Claims{
+		Issuer:            "https://id.test",
+		Subject:           "faye",
+		PreferredUsername: "spike",
+		Email:             "faye@bebop.test",
+		EmailVerified:     true,
+	}
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		u, err := naos.OIDCUser(ds, "test", &claims, 0, tx)
+		if err != nil {
+			return err
+		}
+		if u.Username != "spike2" || u.Email != "faye@bebop.test" {
+			t.Errorf("expected new User spike2, got %q", u.Username)
+		}
+
+		again, err := naos.OIDCUser(ds, "test", &claims, 0, tx)
+		if err != nil {
+			return err
+		}
+		if again.Meta.ID != u.Meta.ID {
+			t.Errorf("expected User %d on second login, got %d", u.Meta.ID, again.Meta.ID)
+		}
+
+		_, err = naos.OIDCUser(ds, "test", &claims, refs["spike"], tx)
+		if !errors.Is(err, data.ErrConflict) {
+			t.Errorf("expected linking to another User to conflict, got %v", err)
+		}
+
+		claims.Subject = "spike"
+		linked, err := naos.OIDCUser(ds, "test", &claims, refs["spike"], tx)
+		if err != nil {
+			return err
+		}
+		if linked.Meta.ID != refs["spike"] {
+			t.Errorf("expected account linked to spike, got User %d", linked.Meta.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to log in: %v", err)
+	}
+}
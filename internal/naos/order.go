@@ -0,0 +1,100 @@
+package naos
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// DefaultOrderTitleLanguages are the language ranges Media are kept sorted by
+// Title in if not configured.
+var DefaultOrderTitleLanguages = []string{"en"}
+
+// SortedMedia is a single page of the Media in a sorted view.
+type SortedMedia struct {
+	By         string          `json:"by"`
+	Descending bool            `json:"descending"`
+	First      *int            `json:"first"`
+	Skip       *int            `json:"skip"`
+	Total      int             `json:"total"`
+	Media      []*models.Media `json:"media"`
+}
+
+// NewSortedMediaHandler returns a GET endpoint handler that lists the Media
+// sorted by the by query parameter, one of startDate, score and title,
+// without loading every Media. Media are sorted by title in the language
+// given by the lang query parameter, the first of those kept sorted by
+// default. The Media are listed descending if the order query parameter is
+// desc, those without a value last either way, and paginated by the first
+// and skip query parameters. Their Titles are ordered for the
+// Accept-Language header.
+func NewSortedMediaHandler(path []string, ds *graphql.DataService) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			q := r.URL.Query()
+			by := q.Get("by")
+			if by == "" {
+				web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing,
+					fmt.Errorf("query parameter %q: must not be empty: %w", "by", data.ErrInvalid), w)
+				return
+			}
+			name := by
+			if by == data.MediaOrderTitle {
+				lang := q.Get("lang")
+				if lang == "" && len(ds.MediaOrderService.TitleLanguages) > 0 {
+					lang = ds.MediaOrderService.TitleLanguages[0]
+				}
+				name = by + ":" + lang
+			}
+			var desc bool
+			switch strings.ToLower(q.Get("order")) {
+			case "", "asc":
+			case "desc":
+				desc = true
+			default:
+				web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing,
+					fmt.Errorf("query parameter %q: must be asc or desc: %w", "order",
+						data.ErrInvalid), w)
+				return
+			}
+			first, skip, ok := parsePagination(w, r)
+			if !ok {
+				return
+			}
+
+			res := SortedMedia{By: by, Descending: desc, First: first, Skip: skip}
+			err := ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var err error
+				res.Media, res.Total, err = ds.MediaOrderService.List(name, desc, first, skip, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get Media sorted by %s: %w", name, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			langs := models.ParseAcceptLanguage(r.Header.Get(web.HeaderAcceptLanguage))
+			for _, md := range res.Media {
+				if md != nil {
+					md.Titles = models.LocalizeTitles(md.Titles, langs)
+				}
+			}
+			web.EncodeResponseBody(res, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
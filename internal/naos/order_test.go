@@ -0,0 +1,94 @@
+package naos_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestMediaOrder tests that Media are kept sorted by title, start date and
+// score as they and their UserMedia change, with those without a value last.
+func TestMediaOrder(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	bebop, movie := refs["bebop"], refs["movie"]
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		ser := ds.MediaOrderService
+		expect := func(name string, desc bool, want ...int) {
+			t.Helper()
+			list, total, err := ser.List(name, desc, nil, nil, tx)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			ids := make([]int, len(list))
+			for i, md := range list {
+				ids[i] = md.Meta.ID
+			}
+			if total != len(want) || len(ids) != len(want) {
+				t.Fatalf("%s: expected %v, got %v of %d", name, want, ids, total)
+			}
+			for i := range want {
+				if ids[i] != want[i] {
+					t.Fatalf("%s: expected %v, got %v", name, want, ids)
+				}
+			}
+		}
+
+		expect("title:en", false, bebop, movie)
+		expect("title:en", true, movie, bebop)
+		expect(data.MediaOrderStartDate, false, bebop, movie)
+
+		md, err := ds.MediaService.GetByID(movie, tx)
+		if err != nil {
+			return err
+		}
+		start := time.Date(2001, 9, 1, 0, 0, 0, 0, time.UTC)
+		md.StartDate = &start
+		err = ds.MediaService.Update(md, tx)
+		if err != nil {
+			return err
+		}
+		expect(data.MediaOrderStartDate, false, movie, bebop)
+		expect(data.MediaOrderStartDate, true, movie, bebop)
+
+		um, err := ds.UserMediaService.GetByID(refs["watching"], tx)
+		if err != nil {
+			return err
+		}
+		low, high := 40, 90
+		um.Score = &low
+		err = ds.UserMediaService.Update(um, tx)
+		if err != nil {
+			return err
+		}
+		_, err = ds.UserMediaService.Create(&models.UserMedia{
+			UserID: refs["faye"], MediaID: movie, Score: &high,
+		}, tx)
+		if err != nil {
+			return err
+		}
+		expect(data.MediaOrderScore, true, movie, bebop)
+
+		err = ds.MediaService.Delete(movie, tx)
+		if err != nil {
+			return err
+		}
+		expect(data.MediaOrderScore, true, bebop)
+		expect("title:en", false, bebop)
+
+		_, _, err = ser.List("popularity", false, nil, nil, tx)
+		if !errors.Is(err, data.ErrInvalid) {
+			t.Errorf("expected unknown order to be invalid, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
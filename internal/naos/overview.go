@@ -0,0 +1,108 @@
+package naos
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jobs"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Overview is the response body of the state of the server shown on the
+// dashboards of Admins.
+type Overview struct {
+	Database DatabaseOverview  `json:"database"`
+	Errors   []web.LoggedError `json:"errors"`
+	Jobs     []jobs.Job        `json:"jobs"`
+	Sessions SessionsOverview  `json:"sessions"`
+}
+
+// DatabaseOverview is the storage of the database.
+type DatabaseOverview struct {
+	// FileSize is the size in bytes of the database file.
+	FileSize int64 `json:"fileSize"`
+	// FreePages is the number of pages free for reuse, and PendingPages the
+	// number of pages freed that are still in use by open transactions.
+	FreePages    int `json:"freePages"`
+	PendingPages int `json:"pendingPages"`
+	FreeBytes    int `json:"freeBytes"`
+	// Records is the number of records in each bucket, by bucket name.
+	Records map[string]int `json:"records"`
+}
+
+// SessionsOverview counts the unexpired login sessions.
+type SessionsOverview struct {
+	// Active is the number of unexpired login sessions, and Users the number
+	// of Users with any.
+	Active int `json:"active"`
+	Users  int `json:"users"`
+}
+
+// NewOverviewHandler returns a GET endpoint handler that reports to Admin
+// callers the statistics of the database, the most recently logged errors,
+// the running and recently finished jobs, and the number of active login
+// sessions.
+func NewOverviewHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator, jm *jobs.Manager,
+	errs *web.ErrorLog,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			if !authorizeRole(w, r, ds, au, models.RoleAdmin) {
+				return
+			}
+
+			stats, err := ds.Database.Stats()
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer,
+					fmt.Errorf("failed to read database statistics: %w", err), w)
+				return
+			}
+			res := Overview{
+				Database: DatabaseOverview{
+					FileSize:     stats.FileSize,
+					FreePages:    stats.FreePages,
+					PendingPages: stats.PendingPages,
+					FreeBytes:    stats.FreeBytes,
+					Records:      stats.Records,
+				},
+				Errors: errs.Errors(),
+				Jobs:   jm.Jobs(),
+			}
+
+			now := time.Now()
+			err = ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				users := map[int]bool{}
+				list, err := ds.LoginSessionService.GetFilter(nil, nil, tx,
+					func(ls *models.LoginSession) bool {
+						return ls.ExpiresAt.After(now)
+					})
+				if err != nil {
+					return fmt.Errorf("failed to get LoginSessions: %w", err)
+				}
+				for _, ls := range list {
+					users[ls.UserID] = true
+				}
+				res.Sessions = SessionsOverview{Active: len(list), Users: len(users)}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(res, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
@@ -0,0 +1,47 @@
+package naos
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	json "github.com/json-iterator/go"
+)
+
+// patchModel applies the given patch, of the given media type, to the given
+// Model in place, keeping its metadata. Properties removed by the patch are
+// reset to their zero values.
+func patchModel(mediaType string, patch []byte, m db.Model) error {
+	doc, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to encode Model: %w", err)
+	}
+	patched, err := web.ApplyPatch(mediaType, doc, patch)
+	if err != nil {
+		return err
+	}
+
+	meta := *m.Metadata()
+	v := reflect.ValueOf(m).Elem()
+	v.Set(reflect.Zero(v.Type()))
+	err = json.Unmarshal(patched, m)
+	if err != nil {
+		return fmt.Errorf("%v: %w", err, web.ErrPatchInvalid)
+	}
+	*m.Metadata() = meta
+	return nil
+}
+
+// encodePatchError encodes the error response of the given error of
+// patchModel, or of the update that followed it.
+func encodePatchError(err error, w http.ResponseWriter) {
+	if errors.Is(err, web.ErrPatchMediaType) || errors.Is(err, web.ErrPatchInvalid) ||
+		errors.Is(err, web.ErrPatchConflict) {
+		web.EncodeResponseError(web.ErrorPatchApplying, err, web.PatchErrorStatus(err), w)
+		return
+	}
+	web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+}
@@ -0,0 +1,62 @@
+package naos
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// PersistedQueriesRequest is the request body of a registration of GraphQL
+// queries.
+type PersistedQueriesRequest struct {
+	// Queries are the documents of the queries to register.
+	Queries []string `json:"queries" validate:"required,dive,required"`
+}
+
+// NewPersistedQueriesHandler returns a POST endpoint handler that registers
+// the GraphQL queries in the request body as persisted queries, allowed when
+// only registered queries are, and returns them with their hashes. Only
+// Admins may register queries.
+func NewPersistedQueriesHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			if !authorizeRole(w, r, ds, au, models.RoleAdmin) {
+				return
+			}
+			var req PersistedQueriesRequest
+			if !parseRequestBody(w, r, &req) {
+				return
+			}
+
+			list := make([]*models.PersistedQuery, len(req.Queries))
+			err := ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				for i, q := range req.Queries {
+					pq, err := ds.PersistedQueryService.Store(q, true, tx)
+					if err != nil {
+						return fmt.Errorf("failed to register query %d: %w", i, err)
+					}
+					list[i] = pq
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+			web.EncodeResponseBody(list, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
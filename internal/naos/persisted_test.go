@@ -0,0 +1,59 @@
+package naos_test
+
+import (
+	"context"
+	"testing"
+
+	gqlgen "github.com/99designs/gqlgen/graphql"
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestPersistedQueries tests that automatically persisted queries are found
+// by their hashes, and that only registered queries are allowed for callers
+// other than Admins.
+func TestPersistedQueries(t *testing.T) {
+	ds, _, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	query := "{ media { totalCount } }"
+	hash := data.HashQuery(query)
+	cache := graphql.PersistedQueryCache{DataService: ds}
+	ctx := context.Background()
+	cache.Add(ctx, hash, query)
+	v, ok := cache.Get(ctx, hash)
+	if !ok || v != query {
+		t.Errorf("expected query %q by hash, got %v", query, v)
+	}
+
+	allowlist := graphql.PersistedQueryAllowlist{DataService: ds}
+	params := gqlgen.RawParams{Extensions: map[string]interface{}{
+		"persistedQuery": map[string]interface{}{"version": 1, "sha256Hash": hash},
+	}}
+	userCtx := context.WithValue(ctx, graphql.RoleKey, models.RoleUser)
+	if err := allowlist.MutateOperationParameters(userCtx, &params); err == nil {
+		t.Errorf("expected unregistered query to be refused")
+	}
+	adminCtx := context.WithValue(ctx, graphql.RoleKey, models.RoleAdmin)
+	if err := allowlist.MutateOperationParameters(adminCtx, &params); err != nil {
+		t.Errorf("expected unregistered query to be allowed for Admins, got %v", err)
+	}
+
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		_, err := ds.PersistedQueryService.Store(query, true, tx)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to register query: %v", err)
+	}
+	if err := allowlist.MutateOperationParameters(userCtx, &params); err != nil {
+		t.Errorf("expected registered query to be allowed, got %v", err)
+	}
+	params = gqlgen.RawParams{Query: query}
+	if err := allowlist.MutateOperationParameters(userCtx, &params); err != nil {
+		t.Errorf("expected registered query sent in full to be allowed, got %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package naos
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	json "github.com/json-iterator/go"
+	"github.com/julienschmidt/httprouter"
+)
+
+// NewProfileHandler returns a GET endpoint handler for the profile of the
+// User given by the id path variable, if visible to the caller.
+func NewProfileHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			uID, _, ok := authorizeLibraryView(w, r, ps, ds, au, models.PrivacyProfile)
+			if !ok {
+				return
+			}
+
+			var profile models.UserProfile
+			err := ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var err error
+				profile, err = userProfile(ds, uID, tx)
+				return err
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(profile, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewPrivacyHandler returns a GET endpoint handler for the privacy settings
+// of the User given by the id path variable. Only the User and Admins may
+// view them.
+func NewPrivacyHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			uID, _, ok := authorizeLibraryOwner(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+
+			var u *models.User
+			err := ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var err error
+				u, err = ds.UserService.GetByID(uID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get User by ID %d: %w", uID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(u.Privacy, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewPrivacyUpdateHandler returns a PUT endpoint handler that replaces the
+// privacy settings of the User given by the id path variable with those in
+// the request body. Only the User and Admins may change them.
+func NewPrivacyUpdateHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPut,
+		Path:   path,
+		DryRun: true,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			uID, _, ok := authorizeLibraryOwner(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+
+			body, err := web.ReadRequestBody(r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorRequestBodyReading, err, w)
+				return
+			}
+			var privacy models.PrivacySettings
+			err = json.Unmarshal(body, &privacy)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorRequestBodyParsing, err, w)
+				return
+			}
+
+			err = ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				u, err := ds.UserService.GetByID(uID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get User by ID %d: %w", uID, err)
+				}
+
+				u.Privacy = privacy
+				err = ds.UserService.Update(u, tx)
+				if err != nil {
+					return fmt.Errorf("failed to update User with ID %d: %w", uID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(privacy, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
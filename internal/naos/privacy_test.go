@@ -0,0 +1,59 @@
+package naos_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestPrivacySettings tests that the UserMedia of a User are visible to other
+// callers only as allowed by the User's privacy settings.
+func TestPrivacySettings(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	owner := &models.User{Meta: db.ModelMetadata{ID: refs["spike"]}}
+	other := &models.User{Meta: db.ModelMetadata{ID: refs["spike"] + 1000}}
+	umID := refs["watching"]
+
+	tests := []struct {
+		lists  models.Visibility
+		caller *models.User
+		ok     bool
+	}{
+		{models.VisibilityPrivate, owner, true},
+		{models.VisibilityPrivate, other, false},
+		{models.VisibilityPrivate, nil, false},
+		{models.VisibilityUsers, other, true},
+		{models.VisibilityUsers, nil, false},
+		{models.VisibilityPublic, nil, true},
+	}
+	for _, tt := range tests {
+		err := ds.Database.Transaction(true, func(tx db.Tx) error {
+			u, err := ds.UserService.GetByID(owner.Meta.ID, tx)
+			if err != nil {
+				return err
+			}
+			u.Privacy.Lists = tt.lists
+			err = ds.UserService.Update(u, tx)
+			if err != nil {
+				return err
+			}
+
+			_, err = ds.UserMediaService.GetByIDAs(tt.caller, umID, tx)
+			return err
+		})
+		if tt.ok && err != nil {
+			t.Errorf("lists %s, caller %v: expected access, got %v",
+				tt.lists, tt.caller, err)
+		}
+		if !tt.ok && !errors.Is(err, data.ErrUnauthorized) {
+			t.Errorf("lists %s, caller %v: expected unauthorized, got %v",
+				tt.lists, tt.caller, err)
+		}
+	}
+}
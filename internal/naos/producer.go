@@ -0,0 +1,105 @@
+package naos
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// ProducerStaffEntry is a ProducerStaff along with the entity at its other
+// end: the Person when listing the staff of a Producer, and the Producer when
+// listing the Producers of a Person.
+type ProducerStaffEntry struct {
+	Staff    *models.ProducerStaff `json:"staff"`
+	Producer *models.Producer      `json:"producer,omitempty"`
+	Person   *models.Person        `json:"person,omitempty"`
+}
+
+// NewProducerStaffHandler returns a GET endpoint handler that lists the staff
+// of the Producer given by the id path variable or, if byPerson is true, the
+// Producers the Person given by the id path variable has worked at,
+// paginated by the first and skip query parameters. Titles and names are
+// ordered for the Accept-Language header.
+func NewProducerStaffHandler(
+	path []string, ds *graphql.DataService, byPerson bool,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			id, err := web.ParsePathVarInt("id", &ps)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorPathVariableParsing, err, w)
+				return
+			}
+			first, skip, ok := parsePagination(w, r)
+			if !ok {
+				return
+			}
+
+			var list []ProducerStaffEntry
+			err = ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var staff []*models.ProducerStaff
+				if byPerson {
+					_, err = ds.PersonService.GetByID(id, tx)
+					if err != nil {
+						return fmt.Errorf("failed to get Person by ID %d: %w", id, err)
+					}
+					staff, err = ds.ProducerStaffService.GetByPerson(id, first, skip, tx)
+				} else {
+					_, err = ds.ProducerService.GetByID(id, tx)
+					if err != nil {
+						return fmt.Errorf("failed to get Producer by ID %d: %w", id, err)
+					}
+					staff, err = ds.ProducerStaffService.GetByProducer(id, first, skip, tx)
+				}
+				if err != nil {
+					return fmt.Errorf("failed to get ProducerStaff: %w", err)
+				}
+
+				list = make([]ProducerStaffEntry, len(staff))
+				for i, s := range staff {
+					list[i].Staff = s
+					if byPerson {
+						list[i].Producer, err = ds.ProducerService.GetByID(s.ProducerID, tx)
+						if err != nil {
+							return fmt.Errorf("failed to get Producer by ID %d: %w",
+								s.ProducerID, err)
+						}
+					} else {
+						list[i].Person, err = ds.PersonService.GetByID(s.PersonID, tx)
+						if err != nil {
+							return fmt.Errorf("failed to get Person by ID %d: %w",
+								s.PersonID, err)
+						}
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			langs := models.ParseAcceptLanguage(r.Header.Get(web.HeaderAcceptLanguage))
+			for _, e := range list {
+				if e.Producer != nil {
+					e.Producer.Titles = models.LocalizeTitles(e.Producer.Titles, langs)
+				}
+				if e.Person != nil {
+					e.Person.Names = models.LocalizeTitles(e.Person.Names, langs)
+					e.Person.Information = models.LocalizeTitles(e.Person.Information, langs)
+				}
+			}
+			web.EncodeResponseBody(list, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
@@ -0,0 +1,88 @@
+package naos_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestProducerStaff tests that staff are validated, listed from both ends,
+// and deleted with their Producers.
+func TestProducerStaff(t *testing.T) {
+	ds, _, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	start := time.Date(1998, time.April, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(-1, 0, 0)
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		_, err := ds.ProducerService.Create(&models.Producer{
+			Titles:  []models.Title{{String: "Sunrise", Language: "en"}},
+			Aliases: []string{"Sunrise Inc."},
+			Founded: &start,
+			Defunct: &end,
+		}, tx)
+		if !errors.Is(err, data.ErrInvalid) {
+			t.Errorf("expected a Producer defunct before founded to be invalid, got %v", err)
+		}
+		pdID, err := ds.ProducerService.Create(&models.Producer{
+			Titles:  []models.Title{{String: "Sunrise", Language: "en"}},
+			Founded: &start,
+		}, tx)
+		if err != nil {
+			return err
+		}
+		pID, err := ds.PersonService.Create(&models.Person{
+			Names: []models.Title{{String: "Shinichiro Watanabe", Language: "en"}},
+		}, tx)
+		if err != nil {
+			return err
+		}
+
+		_, err = ds.ProducerStaffService.Create(&models.ProducerStaff{
+			ProducerID: pdID, PersonID: pID, Role: "Director",
+			StartDate: &start, EndDate: &end,
+		}, tx)
+		if !errors.Is(err, data.ErrInvalid) {
+			t.Errorf("expected staff ending before starting to be invalid, got %v", err)
+		}
+		_, err = ds.ProducerStaffService.Create(&models.ProducerStaff{
+			ProducerID: pdID, PersonID: pID, Role: "Director", StartDate: &start,
+		}, tx)
+		if err != nil {
+			return err
+		}
+
+		byProducer, err := ds.ProducerStaffService.GetByProducer(pdID, nil, nil, tx)
+		if err != nil {
+			return err
+		}
+		byPerson, err := ds.ProducerStaffService.GetByPerson(pID, nil, nil, tx)
+		if err != nil {
+			return err
+		}
+		if len(byProducer) != 1 || len(byPerson) != 1 {
+			t.Errorf("expected 1 staff of each, got %d and %d", len(byProducer), len(byPerson))
+		}
+
+		err = ds.ProducerService.Delete(pdID, tx)
+		if err != nil {
+			return err
+		}
+		byPerson, err = ds.ProducerStaffService.GetByPerson(pID, nil, nil, tx)
+		if err != nil {
+			return err
+		}
+		if len(byPerson) != 0 {
+			t.Errorf("expected staff deleted with the Producer, got %+v", byPerson)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,143 @@
+package naos
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// ProgressRequest is the request body of a report of progress through some
+// Media.
+type ProgressRequest struct {
+	MediaID int `json:"mediaID" validate:"required"`
+	// EpisodeID is the ID of the Episode watched; it may be omitted for Media
+	// watched as a single unit.
+	EpisodeID *int `json:"episodeID"`
+	// Time is the time the Episode was watched; defaults to the time the
+	// report was received.
+	Time *time.Time `json:"time"`
+}
+
+// ProgressResponse is the response body of a report of progress.
+type ProgressResponse struct {
+	UserMedia *models.UserMedia
+	Session   *models.WatchSession
+}
+
+// WatchSessions is the response body of the watch sessions of a User.
+type WatchSessions struct {
+	First    *int
+	Skip     *int
+	Sessions []*models.WatchSession
+}
+
+// NewProgressHandler returns a POST endpoint handler that records progress of
+// the User given by the id path variable through some Media in the current
+// watch of their UserMedia and in their watch sessions. Only the User may
+// report their progress.
+func NewProgressHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			uID, u, ok := authorizeLibraryOwner(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+			var req ProgressRequest
+			if !parseRequestBody(w, r, &req) {
+				return
+			}
+
+			p := models.ProgressReport{
+				UserID:    uID,
+				MediaID:   req.MediaID,
+				EpisodeID: req.EpisodeID,
+				Time:      time.Now(),
+			}
+			if req.Time != nil {
+				p.Time = *req.Time
+			}
+
+			var res ProgressResponse
+			err := ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				var err error
+				res.UserMedia, err = ds.UserMediaService.ReportProgressAs(u, &p, tx)
+				if err != nil {
+					return fmt.Errorf("failed to record progress through Media with ID %d: %w",
+						p.MediaID, err)
+				}
+				res.Session, err = ds.WatchSessionService.Record(res.UserMedia, &p, tx)
+				if err != nil {
+					return fmt.Errorf("failed to record watch session: %w", err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(res, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewWatchSessionsHandler returns a GET endpoint handler that lists the watch
+// sessions of the User given by the id path variable, oldest first, paginated
+// by the first and skip query parameters. The sessions are part of the
+// statistics of the User.
+func NewWatchSessionsHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			uID, _, ok := authorizeLibraryView(w, r, ps, ds, au, models.PrivacyStats)
+			if !ok {
+				return
+			}
+			first, skip, ok := parsePagination(w, r)
+			if !ok {
+				return
+			}
+
+			var list []*models.WatchSession
+			err := ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var err error
+				list, err = ds.WatchSessionService.GetByUser(uID, first, skip, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get WatchSessions of User with ID %d: %w",
+						uID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(WatchSessions{
+				First:    first,
+				Skip:     skip,
+				Sessions: list,
+			}, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
@@ -0,0 +1,90 @@
+package naos_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestProgress tests that reports of progress complete the Media at its last
+// Episode and are grouped into watch sessions.
+func TestProgress(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	owner := &models.User{Meta: db.ModelMetadata{ID: refs["spike"]}}
+	start := time.Date(2020, 4, 1, 20, 0, 0, 0, time.UTC)
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		mID, err := ds.MediaService.Create(&models.Media{
+			Titles: []models.Title{{String: "Samurai Champloo", Language: "en"}},
+		}, tx)
+		if err != nil {
+			return err
+		}
+		eps := make([]int, 2)
+		for i := range eps {
+			eps[i], err = ds.EpisodeService.Create(&models.Episode{}, tx)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = ds.EpisodeSetService.Create(&models.EpisodeSet{
+			MediaID: mID, Episodes: eps,
+		}, tx)
+		if err != nil {
+			return err
+		}
+
+		report := func(epID int, t time.Time) (*models.UserMedia, error) {
+			p := models.ProgressReport{
+				UserID: owner.Meta.ID, MediaID: mID, EpisodeID: &epID, Time: t,
+			}
+			um, err := ds.UserMediaService.ReportProgressAs(owner, &p, tx)
+			if err != nil {
+				return nil, err
+			}
+			_, err = ds.WatchSessionService.Record(um, &p, tx)
+			return um, err
+		}
+
+		um, err := report(eps[0], start)
+		if err != nil {
+			return err
+		}
+		if um.Status == nil || *um.Status != models.WatchStatusCurrent {
+			t.Errorf("expected status %v, got %v", models.WatchStatusCurrent, um.Status)
+		}
+		um, err = report(eps[1], start.Add(30*time.Minute))
+		if err != nil {
+			return err
+		}
+		if um.Status == nil || *um.Status != models.WatchStatusCompleted {
+			t.Errorf("expected status %v, got %v", models.WatchStatusCompleted, um.Status)
+		}
+		_, err = report(eps[0], start.Add(48*time.Hour))
+		if err != nil {
+			return err
+		}
+
+		sessions, err := ds.WatchSessionService.GetByUser(owner.Meta.ID, nil, nil, tx)
+		if err != nil {
+			return err
+		}
+		if len(sessions) != 2 {
+			t.Fatalf("expected 2 sessions, got %d", len(sessions))
+		}
+		if ws := sessions[0]; !reflect.DeepEqual(ws.Episodes, eps) ||
+			ws.Duration() != 30*time.Minute {
+			t.Errorf("expected first session of %v over 30m, got %v over %v",
+				eps, ws.Episodes, ws.Duration())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to record progress: %v", err)
+	}
+}
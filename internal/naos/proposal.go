@@ -0,0 +1,185 @@
+package naos
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// ProposalRequest is the request body of a proposed change to a Media.
+type ProposalRequest struct {
+	// Patch is the JSON Merge Patch (RFC 7396) of the Media.
+	Patch   json.RawMessage `json:"patch" validate:"required"`
+	Comment string          `json:"comment" validate:"max=1000"`
+}
+
+// mergePatchMedia applies the given JSON Merge Patch to the given Media, for
+// the Proposals of the data layer.
+func mergePatchMedia(md *models.Media, patch []byte) error {
+	return patchModel(web.HeaderContentTypeValMergePatch, patch, md)
+}
+
+// NewProposalCreateHandler returns a POST endpoint handler that proposes the
+// change to the Media given by the id path variable in the request body for
+// Moderators to review, and responds with the Proposal with 201 Created. Any
+// User may propose changes.
+func NewProposalCreateHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		DryRun: true,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			u, err := RequestUser(r, ds, au)
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorAuthentication, err, w)
+				return
+			}
+			if u == nil {
+				web.EncodeResponseErrorUnauthorized(web.ErrorAuthentication,
+					errors.New("no credentials given"), w)
+				return
+			}
+			mID, err := web.ParsePathVarInt("id", &ps)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorPathVariableParsing, err, w)
+				return
+			}
+			var req ProposalRequest
+			if !parseRequestBody(w, r, &req) {
+				return
+			}
+
+			p := models.Proposal{
+				MediaID: mID,
+				Patch:   req.Patch,
+				Comment: req.Comment,
+			}
+			err = ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				_, err := ds.ProposalService.ProposeAs(u, &p, tx)
+				if err != nil {
+					return fmt.Errorf("failed to propose change to Media with ID %d: %w",
+						mID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			w.WriteHeader(http.StatusCreated)
+			web.EncodeResponseBody(p, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewProposalsHandler returns a GET endpoint handler that lists the
+// Proposals to Moderators, paginated by the first and skip query parameters.
+// Only the Proposals with the status given by the status query parameter are
+// listed, if present.
+func NewProposalsHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			if !authorizeRole(w, r, ds, au, models.RoleModerator) {
+				return
+			}
+			first, skip, ok := parsePagination(w, r)
+			if !ok {
+				return
+			}
+			var status *models.ProposalStatus
+			if v := r.URL.Query().Get("status"); v != "" {
+				s, err := models.ParseProposalStatus(v)
+				if err != nil {
+					web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+					return
+				}
+				status = &s
+			}
+
+			var list []*models.Proposal
+			err := ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var err error
+				list, err = ds.ProposalService.GetByStatus(status, first, skip, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get Proposals: %w", err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(list, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewProposalReviewHandler returns a POST endpoint handler that approves the
+// pending Proposal given by the id path variable if approve is true, applying
+// it to its Media, or rejects it otherwise, and responds with the Proposal.
+// Only Moderators may review Proposals.
+func NewProposalReviewHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator, approve bool,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		DryRun: true,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			u, ok := authorizeRoleUser(w, r, ds, au, models.RoleModerator)
+			if !ok {
+				return
+			}
+			id, err := web.ParsePathVarInt("id", &ps)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorPathVariableParsing, err, w)
+				return
+			}
+
+			var p *models.Proposal
+			err = ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				var err error
+				if approve {
+					p, err = ds.ProposalService.ApproveAs(u, id, tx)
+				} else {
+					p, err = ds.ProposalService.RejectAs(u, id, tx)
+				}
+				if err != nil {
+					return fmt.Errorf("failed to review Proposal with ID %d: %w", id, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(p, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
@@ -0,0 +1,81 @@
+package naos_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestProposal tests that a change proposed by a User is applied to the Media
+// once approved by a Moderator, attributed to the proposer in the change
+// log, and that a Proposal is reviewed only once.
+func TestProposal(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	mID := refs["bebop"]
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		spike, err := ds.UserService.GetByID(refs["spike"], tx)
+		if err != nil {
+			return err
+		}
+		faye, err := ds.UserService.GetByID(refs["faye"], tx)
+		if err != nil {
+			return err
+		}
+		spike.Permissions.WriteMedia = true
+
+		p := models.Proposal{
+			MediaID: mID,
+			Patch:   []byte(`{"Synopses": [{"String": "Bounty hunters in space.", "Language": "en"}]}`),
+		}
+		pID, err := ds.ProposalService.ProposeAs(faye, &p, tx)
+		if err != nil {
+			return err
+		}
+		_, err = ds.ProposalService.ApproveAs(faye, pID, tx)
+		if !errors.Is(err, data.ErrUnauthorized) {
+			t.Errorf("expected approval by a User to be refused, got %v", err)
+		}
+
+		approved, err := ds.ProposalService.ApproveAs(spike, pID, tx)
+		if err != nil {
+			return err
+		}
+		if approved.Status != models.ProposalStatusApproved ||
+			approved.ReviewerID == nil || *approved.ReviewerID != spike.Meta.ID {
+			t.Errorf("expected Proposal approved by %d, got %+v", spike.Meta.ID, approved)
+		}
+		md, err := ds.MediaService.GetByID(mID, tx)
+		if err != nil {
+			return err
+		}
+		if len(md.Synopses) != 1 || md.Synopses[0].String != "Bounty hunters in space." {
+			t.Errorf("expected patched synopsis, got %v", md.Synopses)
+		}
+
+		changes, err := ds.ChangeService.GetFilter(nil, nil, tx, func(c *models.Change) bool {
+			return c.Bucket == ds.MediaService.Bucket() && c.EntityID == mID &&
+				c.Action == models.ChangeActionUpdate
+		})
+		if err != nil {
+			return err
+		}
+		if len(changes) != 1 || changes[0].AuthorID != faye.Meta.ID {
+			t.Errorf("expected update attributed to %d, got %v", faye.Meta.ID, changes)
+		}
+
+		_, err = ds.ProposalService.RejectAs(spike, pID, tx)
+		if !errors.Is(err, data.ErrConflict) {
+			t.Errorf("expected reviewed Proposal to conflict, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,429 @@
+package naos
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	json "github.com/json-iterator/go"
+)
+
+// DefaultAniListURL is the URL of the GraphQL API of AniList if not
+// configured.
+const DefaultAniListURL = "https://graphql.anilist.co"
+
+// DefaultTMDBURL is the base URL of the API of The Movie Database if not
+// configured.
+const DefaultTMDBURL = "https://api.themoviedb.org/3"
+
+// DefaultRefreshDelay is the duration waited between fetches of metadata
+// from catalogues if not configured, to keep under their rate limits.
+const DefaultRefreshDelay = time.Second
+
+// MetadataProvider fetches the metadata of Media from an external catalogue.
+type MetadataProvider interface {
+	// FetchMedia returns the metadata of the Media with the given ID in the
+	// catalogue, that after the colon in its ExternalID. Fields not known in
+	// the catalogue are left unset.
+	FetchMedia(ctx context.Context, id string) (*models.Media, error)
+}
+
+// MetadataRefreshScheduler periodically refreshes the metadata of the Media
+// linked to external catalogues by their ExternalIDs, such as anilist:1,
+// from the catalogues, keeping the fields locked in each Media.
+type MetadataRefreshScheduler struct {
+	DataLayer *graphql.DataService
+	// Providers fetch the metadata of Media by the catalogue of their
+	// ExternalIDs, the prefix before the colon; Media of other catalogues
+	// are not refreshed.
+	Providers map[string]MetadataProvider
+	// Interval is the duration between refreshes.
+	Interval time.Duration
+	// Delay is the duration waited between fetches.
+	Delay time.Duration
+	// OnError is called with the errors encountered while refreshing in the
+	// background.
+	OnError func(error)
+	// NewProgress, if set, is called before each refresh to obtain the
+	// Progress the Media fetched are reported to.
+	NewProgress func() db.Progress
+
+	sched  schedule
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// NewMetadataRefreshScheduler returns a MetadataRefreshScheduler that
+// refreshes the Media of the given data layer from the given providers.
+func NewMetadataRefreshScheduler(
+	ds *graphql.DataService, providers map[string]MetadataProvider,
+	interval time.Duration, onError func(error),
+) *MetadataRefreshScheduler {
+	return &MetadataRefreshScheduler{
+		DataLayer: ds,
+		Providers: providers,
+		Interval:  interval,
+		Delay:     DefaultRefreshDelay,
+		OnError:   onError,
+	}
+}
+
+// Start begins refreshing the Media at every interval.
+func (s *MetadataRefreshScheduler) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	err := s.sched.start(s.Interval, func(_, _ time.Time) error {
+		_, err := s.Refresh(ctx)
+		return err
+	}, s.OnError)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("failed to start metadata refresh scheduler: %w", err)
+	}
+
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+	return nil
+}
+
+// Stop stops refreshing the Media, cancelling a refresh in progress, and
+// waits for it to finish.
+func (s *MetadataRefreshScheduler) Stop() {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+	s.mu.Unlock()
+	s.sched.halt()
+}
+
+// Refresh fetches the metadata of every Media with an ExternalID of a
+// catalogue of the providers and applies it with MediaService.Refresh, each
+// in its own transaction, and returns the number of Media changed. Media that
+// fail to be refreshed are skipped, and the first error returned once the
+// rest are refreshed.
+func (s *MetadataRefreshScheduler) Refresh(ctx context.Context) (int, error) {
+	ds := s.DataLayer
+	var list []*models.Media
+	err := ds.Database.Transaction(false, func(tx db.Tx) error {
+		var err error
+		list, err = ds.MediaService.GetFilter(nil, nil, tx, func(md *models.Media) bool {
+			_, _, ok := s.provider(md.ExternalID)
+			return ok
+		})
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get Media: %w", err)
+	}
+
+	var p db.Progress
+	if s.NewProgress != nil {
+		p = s.NewProgress()
+		p.SetTotal(int64(len(list)))
+	}
+	n, err := s.refresh(ctx, list, p)
+	if p != nil {
+		p.Finish(err)
+	}
+	return n, err
+}
+
+// refresh refreshes the given Media, reporting each to the given Progress if
+// not nil.
+func (s *MetadataRefreshScheduler) refresh(
+	ctx context.Context, list []*models.Media, p db.Progress,
+) (int, error) {
+	ds := s.DataLayer
+	changed := 0
+	var first error
+	for i, md := range list {
+		if i > 0 && s.Delay > 0 {
+			select {
+			case <-ctx.Done():
+				return changed, ctx.Err()
+			case <-time.After(s.Delay):
+			}
+		}
+
+		pr, id, _ := s.provider(md.ExternalID)
+		fetched, err := pr.FetchMedia(ctx, id)
+		ok := false
+		if err == nil {
+			err = ds.Database.Transaction(true, func(tx db.Tx) error {
+				var err error
+				ok, err = ds.MediaService.Refresh(md.Meta.ID, fetched, tx)
+				return err
+			})
+		}
+		if err == nil && ok {
+			changed++
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return changed, ctx.Err()
+			}
+			if first == nil {
+				first = fmt.Errorf("failed to refresh Media with ID %d from %q: %w",
+					md.Meta.ID, md.ExternalID, err)
+			}
+		}
+		if p != nil {
+			p.Advance(1)
+		}
+	}
+	return changed, first
+}
+
+// provider returns the MetadataProvider of the catalogue of the given
+// ExternalID and the ID in the catalogue, or false if there is none.
+func (s *MetadataRefreshScheduler) provider(externalID string) (MetadataProvider, string, bool) {
+	i := strings.Index(externalID, ":")
+	if i < 0 {
+		return nil, "", false
+	}
+	pr, ok := s.Providers[externalID[:i]]
+	if !ok || pr == nil {
+		return nil, "", false
+	}
+	return pr, externalID[i+1:], true
+}
+
+// AniListProvider fetches the metadata of Media from AniList by their IDs
+// there, as in ExternalIDs such as anilist:1.
+type AniListProvider struct {
+	// URL is the URL of the GraphQL API; DefaultAniListURL if empty.
+	URL string
+	// HTTPClient is the client requests are sent with;
+	// http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// aniListQuery is the GraphQL query of the metadata of a Media of AniList.
+const aniListQuery = `query ($id: Int) {
+  Media(id: $id) {
+    title { romaji english native }
+    description(asHtml: false)
+    startDate { year month day }
+    endDate { year month day }
+    episodes
+  }
+}`
+
+// aniListDate is a date of AniList, whose parts may be unknown.
+type aniListDate struct {
+	Year  *int `json:"year"`
+	Month *int `json:"month"`
+	Day   *int `json:"day"`
+}
+
+// time returns the date, or nil if not fully known.
+func (d aniListDate) time() *time.Time {
+	if d.Year == nil || d.Month == nil || d.Day == nil {
+		return nil
+	}
+	t := time.Date(*d.Year, time.Month(*d.Month), *d.Day, 0, 0, 0, 0, time.UTC)
+	return &t
+}
+
+// FetchMedia returns the metadata of the Media with the given AniList ID.
+func (p *AniListProvider) FetchMedia(ctx context.Context, id string) (*models.Media, error) {
+	aID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, fmt.Errorf("AniList ID %q: %w", id, db.ErrInvalid)
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"query":     aniListQuery,
+		"variables": map[string]interface{}{"id": aID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode query: %w", err)
+	}
+
+	u := p.URL
+	if u == "" {
+		u = DefaultAniListURL
+	}
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	var res struct {
+		Data struct {
+			Media *struct {
+				Title struct {
+					Romaji  string `json:"romaji"`
+					English string `json:"english"`
+					Native  string `json:"native"`
+				} `json:"title"`
+				Description string      `json:"description"`
+				StartDate   aniListDate `json:"startDate"`
+				EndDate     aniListDate `json:"endDate"`
+				Episodes    *int        `json:"episodes"`
+			} `json:"Media"`
+		} `json:"data"`
+	}
+	err = fetchJSON(ctx, p.HTTPClient, req, &res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch AniList Media %d: %w", aID, err)
+	}
+	am := res.Data.Media
+	if am == nil {
+		return nil, fmt.Errorf("AniList Media %d: %w", aID, db.ErrNotFound)
+	}
+
+	md := models.Media{
+		Titles:       []models.Title{},
+		Synopses:     []models.Title{},
+		StartDate:    am.StartDate.time(),
+		EndDate:      am.EndDate.time(),
+		EpisodeCount: am.Episodes,
+	}
+	md.Titles = appendTitle(md.Titles, am.Title.English, "en", models.TitlePriorityPrimary)
+	md.Titles = appendTitle(md.Titles, am.Title.Native, "ja", models.TitlePriorityPrimary)
+	md.Titles = appendTitle(md.Titles, am.Title.Romaji, "ja-Latn", models.TitlePriorityPrimary)
+	md.Synopses = appendTitle(md.Synopses, am.Description, "en", models.TitlePriorityPrimary)
+	return &md, nil
+}
+
+// TMDBProvider fetches the metadata of Media from The Movie Database by their
+// kinds and IDs there, as in ExternalIDs such as tmdb:tv/1 and tmdb:movie/1.
+type TMDBProvider struct {
+	// URL is the base URL of the API; DefaultTMDBURL if empty.
+	URL string
+	// APIKey is the API key requests are authorized with.
+	APIKey string
+	// HTTPClient is the client requests are sent with;
+	// http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// FetchMedia returns the metadata of the TV series or movie with the given
+// kind and ID, such as tv/1. The EndDate of series is only known once they
+// have ended, and movies have neither an EndDate nor an EpisodeCount.
+func (p *TMDBProvider) FetchMedia(ctx context.Context, id string) (*models.Media, error) {
+	parts := strings.Split(id, "/")
+	if len(parts) != 2 || parts[0] != "tv" && parts[0] != "movie" {
+		return nil, fmt.Errorf("TMDB ID %q: %w", id, db.ErrInvalid)
+	}
+	if _, err := strconv.Atoi(parts[1]); err != nil {
+		return nil, fmt.Errorf("TMDB ID %q: %w", id, db.ErrInvalid)
+	}
+
+	base := p.URL
+	if base == "" {
+		base = DefaultTMDBURL
+	}
+	u := strings.TrimSuffix(base, "/") + "/" + id + "?" + url.Values{
+		"api_key":  {p.APIKey},
+		"language": {"en-US"},
+	}.Encode()
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	var res struct {
+		// Series have names and movies titles
+		Name             string `json:"name"`
+		OriginalName     string `json:"original_name"`
+		Title            string `json:"title"`
+		OriginalTitle    string `json:"original_title"`
+		OriginalLanguage string `json:"original_language"`
+		Overview         string `json:"overview"`
+		FirstAirDate     string `json:"first_air_date"`
+		LastAirDate      string `json:"last_air_date"`
+		ReleaseDate      string `json:"release_date"`
+		Status           string `json:"status"`
+		NumberOfEpisodes *int   `json:"number_of_episodes"`
+	}
+	err = fetchJSON(ctx, p.HTTPClient, req, &res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch TMDB %s: %w", id, err)
+	}
+
+	md := models.Media{
+		Titles:   []models.Title{},
+		Synopses: []models.Title{},
+	}
+	name, original := res.Name, res.OriginalName
+	if parts[0] == "movie" {
+		name, original = res.Title, res.OriginalTitle
+		md.StartDate = parseTMDBDate(res.ReleaseDate)
+	} else {
+		md.StartDate = parseTMDBDate(res.FirstAirDate)
+		if res.Status == "Ended" || res.Status == "Canceled" {
+			md.EndDate = parseTMDBDate(res.LastAirDate)
+		}
+		md.EpisodeCount = res.NumberOfEpisodes
+	}
+	md.Titles = appendTitle(md.Titles, name, "en", models.TitlePriorityPrimary)
+	if res.OriginalLanguage != "" && res.OriginalLanguage != "en" {
+		md.Titles = appendTitle(md.Titles, original, res.OriginalLanguage,
+			models.TitlePriorityPrimary)
+	}
+	md.Synopses = appendTitle(md.Synopses, res.Overview, "en", models.TitlePriorityPrimary)
+	return &md, nil
+}
+
+// parseTMDBDate returns the given date of TMDB, such as 2006-01-02, or nil if
+// it is empty or malformed.
+func parseTMDBDate(s string) *time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// appendTitle appends a Title of the given string, language and priority to
+// the given Titles, unless the string is empty.
+func appendTitle(
+	titles []models.Title, s string, lang string, priority models.TitlePriority,
+) []models.Title {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return titles
+	}
+	return append(titles, models.Title{String: s, Language: lang, Priority: priority})
+}
+
+// fetchJSON sends the given request with the given context and client,
+// http.DefaultClient if nil, and decodes the JSON response into v. Responses
+// with status Not Found are returned as errors wrapping db.ErrNotFound.
+func fetchJSON(ctx context.Context, client *http.Client, req *http.Request, v interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("catalogue responded with status %d: %w", res.StatusCode, db.ErrNotFound)
+	case res.StatusCode != http.StatusOK:
+		return fmt.Errorf("catalogue responded with status %d", res.StatusCode)
+	}
+
+	err = json.NewDecoder(res.Body).Decode(v)
+	if err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package naos_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/naos"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	json "github.com/json-iterator/go"
+)
+
+// TestMetadataRefresh tests that the metadata of Media linked to AniList is
+// refreshed from it, except for the fields edited by hand, that titles in
+// other languages are kept, and that Media of other catalogues are not
+// fetched.
+func TestMetadataRefresh(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		var req struct {
+			Variables struct {
+				ID int `json:"id"`
+			} `json:"variables"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.Variables.ID != 1 {
+			t.Errorf("expected AniList Media 1 queried, got %d: %v", req.Variables.ID, err)
+		}
+		w.Write([]byte(`{"data": {"Media": {
+			"title": {"romaji": "Cowboy Bebop", "english": "Cowboy Bebop!", "native": "カウボーイビバップ"},
+			"description": "In the year 2071...",
+			"startDate": {"year": 1998, "month": 4, "day": 3},
+			"endDate": {"year": 1999, "month": 4, "day": 24},
+			"episodes": 26
+		}}}`))
+	}))
+	defer srv.Close()
+
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		for ref, extID := range map[string]string{"bebop": "anilist:1", "movie": "mal:5"} {
+			md, err := ds.MediaService.GetByID(refs[ref], tx)
+			if err != nil {
+				return err
+			}
+			md.ExternalID = extID
+			md.Titles = append(md.Titles, models.Title{String: "Cowboy Bebop", Language: "fr"})
+			err = ds.MediaService.Update(md, tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		md, err := ds.MediaService.GetByID(refs["bebop"], tx)
+		if err != nil {
+			return err
+		}
+		md.Synopses = []models.Title{{String: "Space cowboys.", Language: "en"}}
+		return ds.MediaService.Edit(md, tx)
+	})
+	if err != nil {
+		t.Fatalf("failed to link Media: %v", err)
+	}
+
+	s := naos.NewMetadataRefreshScheduler(ds, map[string]naos.MetadataProvider{
+		"anilist": &naos.AniListProvider{URL: srv.URL},
+	}, time.Hour, nil)
+	s.Delay = 0
+	n, err := s.Refresh(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 Media refreshed, got %d: %v", n, err)
+	}
+	if r := atomic.LoadInt32(&requests); r != 1 {
+		t.Errorf("expected only Media of AniList fetched, got %d requests", r)
+	}
+
+	err = ds.Database.Transaction(false, func(tx db.Tx) error {
+		md, err := ds.MediaService.GetByID(refs["bebop"], tx)
+		if err != nil {
+			return err
+		}
+		titles := map[string]string{}
+		for _, title := range md.Titles {
+			titles[title.Language] = title.String
+		}
+		if titles["en"] != "Cowboy Bebop!" || titles["ja"] != "カウボーイビバップ" ||
+			titles["fr"] != "Cowboy Bebop" {
+			t.Errorf("expected titles refreshed and French title kept, got %v", titles)
+		}
+		if len(md.Synopses) != 1 || md.Synopses[0].String != "Space cowboys." {
+			t.Errorf("expected synopsis edited by hand kept, got %v", md.Synopses)
+		}
+		if !md.Locked(models.MediaFieldSynopses) || md.Locked(models.MediaFieldTitles) {
+			t.Errorf("expected only synopses locked, got %v", md.LockedFields)
+		}
+		if md.EpisodeCount == nil || *md.EpisodeCount != 26 {
+			t.Errorf("expected 26 episodes, got %v", md.EpisodeCount)
+		}
+		if md.StartDate == nil || !md.StartDate.Equal(time.Date(1998, 4, 3, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("expected start date refreshed, got %v", md.StartDate)
+		}
+		if !md.HasReleaseStatus(models.ReleaseStatusFinished) {
+			t.Errorf("expected release status derived as finished, got %v", md.ReleaseStatus)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to get Media: %v", err)
+	}
+
+	n, err = s.Refresh(context.Background())
+	if err != nil || n != 0 {
+		t.Errorf("expected no Media changed again, got %d: %v", n, err)
+	}
+}
@@ -0,0 +1,204 @@
+package naos
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	json "github.com/json-iterator/go"
+	"github.com/julienschmidt/httprouter"
+)
+
+// DefaultReplicationLimit is the number of entries of the replication log
+// returned at once if not given.
+const DefaultReplicationLimit = 1000
+
+// DefaultReplicationInterval is the duration between pulls of the
+// replication log of the primary if not configured.
+const DefaultReplicationInterval = 5 * time.Second
+
+// DefaultReplicationRetain is the number of entries kept in the replication
+// log if not configured.
+const DefaultReplicationRetain = 100000
+
+// ReplicationLog is a page of the replication log.
+type ReplicationLog struct {
+	Entries []db.ReplicationEntry `json:"entries"`
+	// Position is the sequence number of the last entry recorded.
+	Position uint64 `json:"position"`
+}
+
+// NewReplicationLogHandler returns a GET endpoint handler that lists to Admin
+// callers the entries of the replication log after the sequence number given
+// by the after query parameter, up to the number given by the limit query
+// parameter, for followers to apply.
+func NewReplicationLogHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			if !authorizeRole(w, r, ds, au, models.RoleAdmin) {
+				return
+			}
+
+			var after uint64
+			if v := r.URL.Query().Get("after"); v != "" {
+				var err error
+				after, err = strconv.ParseUint(v, 10, 64)
+				if err != nil {
+					web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing,
+						fmt.Errorf("query parameter %q: %w", "after", err), w)
+					return
+				}
+			}
+			limit, err := web.ParseQueryInt("limit", r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+				return
+			}
+			n := DefaultReplicationLimit
+			if limit != nil && *limit > 0 && *limit < n {
+				n = *limit
+			}
+
+			pos, err := ds.Database.ReplicationPosition()
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+			entries, err := ds.Database.ReplicationLog(after, n)
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+			web.EncodeResponseBody(ReplicationLog{
+				Entries:  entries,
+				Position: pos,
+			}, w)
+		},
+	}
+}
+
+// ReplicationScheduler periodically pulls the replication log of a primary
+// instance and applies it to the database of a follower.
+type ReplicationScheduler struct {
+	DataLayer *graphql.DataService
+	// Primary is the base URL of the HTTP API of the primary, such as
+	// https://nao.example.com/api/v1.
+	Primary string
+	// APIKey is an API key of an Admin of the primary.
+	APIKey string
+	// Interval is the duration between pulls.
+	Interval time.Duration
+	// OnError is called with the errors encountered while replicating in the
+	// background.
+	OnError func(error)
+	// HTTPClient is the client requests are sent with;
+	// http.DefaultClient if nil.
+	HTTPClient *http.Client
+
+	sched schedule
+}
+
+// NewReplicationScheduler returns a ReplicationScheduler that replicates the
+// given primary to the given data layer.
+func NewReplicationScheduler(
+	ds *graphql.DataService, primary string, apiKey string,
+	interval time.Duration, onError func(error),
+) *ReplicationScheduler {
+	return &ReplicationScheduler{
+		DataLayer:  ds,
+		Primary:    primary,
+		APIKey:     apiKey,
+		Interval:   interval,
+		OnError:    onError,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Start begins pulling the replication log at every interval.
+func (s *ReplicationScheduler) Start() error {
+	err := s.sched.start(s.Interval, func(_, _ time.Time) error {
+		_, err := s.Pull()
+		return err
+	}, s.OnError)
+	if err != nil {
+		return fmt.Errorf("failed to start replication scheduler: %w", err)
+	}
+	return nil
+}
+
+// Stop stops pulling the replication log and waits for a pull in progress to
+// finish.
+func (s *ReplicationScheduler) Stop() {
+	s.sched.halt()
+}
+
+// Pull applies the entries of the replication log of the primary after the
+// last applied, until caught up, and returns the number applied.
+func (s *ReplicationScheduler) Pull() (int, error) {
+	applied := 0
+	for {
+		pos, err := s.DataLayer.Database.ReplicationPosition()
+		if err != nil {
+			return applied, err
+		}
+		page, err := s.fetch(pos)
+		if err != nil {
+			return applied, err
+		}
+		err = s.DataLayer.Database.ApplyReplication(page.Entries)
+		if err != nil {
+			return applied, fmt.Errorf("failed to apply replication log: %w", err)
+		}
+		applied += len(page.Entries)
+		if len(page.Entries) < DefaultReplicationLimit {
+			return applied, nil
+		}
+	}
+}
+
+// fetch returns the page of the replication log of the primary after the
+// given sequence number.
+func (s *ReplicationScheduler) fetch(after uint64) (*ReplicationLog, error) {
+	u := strings.TrimSuffix(s.Primary, "/") + "/admin/replication/log?" + url.Values{
+		"after": {strconv.FormatUint(after, 10)},
+		"limit": {strconv.Itoa(DefaultReplicationLimit)},
+	}.Encode()
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set(HeaderAuthorization, "Bearer "+s.APIKey)
+
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request replication log: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("primary responded with status %d", res.StatusCode)
+	}
+
+	var page ReplicationLog
+	err = json.NewDecoder(res.Body).Decode(&page)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse replication log: %w", err)
+	}
+	return &page, nil
+}
@@ -0,0 +1,117 @@
+package naos_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestReplication tests that the writes recorded in the replication log of a
+// primary are applied to a follower in order, and that gaps are refused.
+func TestReplication(t *testing.T) {
+	primary, _, cleanup := naostest.NewDataService(t)
+	defer cleanup()
+	follower, _, cleanupFollower := naostest.NewDataService(t)
+	defer cleanupFollower()
+
+	db.RecordReplication(primary.Lifecycle, 10)
+
+	var mecha, isekai int
+	err := primary.Database.Transaction(true, func(tx db.Tx) error {
+		var err error
+		mecha, err = primary.GenreService.Create(&models.Genre{
+			Names: []models.Title{{String: "Mecha", Language: "en"}},
+		}, tx)
+		if err != nil {
+			return err
+		}
+		isekai, err = primary.GenreService.Create(&models.Genre{
+			Names: []models.Title{{String: "Isekai", Language: "en"}},
+		}, tx)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to create Genres: %v", err)
+	}
+
+	entries, err := primary.Database.ReplicationLog(0, 0)
+	if err != nil {
+		t.Fatalf("failed to read replication log: %v", err)
+	}
+	if len(entries) < 2 {
+		t.Fatalf("expected at least 2 entries, got %d", len(entries))
+	}
+	err = follower.Database.ApplyReplication(entries[:1])
+	if err != nil {
+		t.Fatalf("failed to apply replication log: %v", err)
+	}
+	err = follower.Database.ApplyReplication(entries[1:])
+	if err != nil {
+		t.Fatalf("failed to apply replication log: %v", err)
+	}
+
+	err = primary.Database.Transaction(true, func(tx db.Tx) error {
+		return primary.GenreService.Delete(mecha, tx)
+	})
+	if err != nil {
+		t.Fatalf("failed to delete Genre: %v", err)
+	}
+	pos, err := follower.Database.ReplicationPosition()
+	if err != nil {
+		t.Fatalf("failed to get replication position: %v", err)
+	}
+	entries, err = primary.Database.ReplicationLog(pos, 0)
+	if err != nil {
+		t.Fatalf("failed to read replication log: %v", err)
+	}
+	err = follower.Database.ApplyReplication(entries)
+	if err != nil {
+		t.Fatalf("failed to apply replication log: %v", err)
+	}
+
+	err = follower.Database.Transaction(false, func(tx db.Tx) error {
+		_, err := follower.GenreService.GetByID(mecha, tx)
+		if !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("expected deleted Genre to be not found, got %v", err)
+		}
+		g, err := follower.GenreService.GetByID(isekai, tx)
+		if err != nil {
+			return err
+		}
+		if g.Names[0].String != "Isekai" {
+			t.Errorf("expected replicated Genre Isekai, got %q", g.Names[0].String)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to get replicated Genre: %v", err)
+	}
+
+	// Entries trimmed from the log leave a gap
+	for i := 0; i < 10; i++ {
+		err = primary.Database.Transaction(true, func(tx db.Tx) error {
+			_, err := primary.GenreService.Create(&models.Genre{
+				Names: []models.Title{{String: "Trimmed", Language: "en"}},
+			}, tx)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("failed to create Genre: %v", err)
+		}
+	}
+	pos, err = follower.Database.ReplicationPosition()
+	if err != nil {
+		t.Fatalf("failed to get replication position: %v", err)
+	}
+	entries, err = primary.Database.ReplicationLog(pos, 0)
+	if err != nil {
+		t.Fatalf("failed to read replication log: %v", err)
+	}
+	err = follower.Database.ApplyReplication(entries)
+	if !errors.Is(err, db.ErrReplicationGap) {
+		t.Errorf("expected ErrReplicationGap, got %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package naos
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// ReportRequest is the request body of a report of some content.
+type ReportRequest struct {
+	Target   models.ReportTarget `json:"target"`
+	TargetID int                 `json:"targetID" validate:"required"`
+	Reason   string              `json:"reason" validate:"required"`
+}
+
+// ReportResolution is the request body of the resolution of a Report.
+type ReportResolution struct {
+	Status models.ReportStatus `json:"status"`
+	// Hide hides the reported content; the status must be Actioned.
+	Hide bool `json:"hide"`
+}
+
+// NewReportHandler returns a POST endpoint handler that reports the Review,
+// Comment or Media given in the request body to the moderators.
+func NewReportHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			u, err := RequestUser(r, ds, au)
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorAuthentication, err, w)
+				return
+			}
+			if u == nil {
+				web.EncodeResponseErrorUnauthorized(web.ErrorAuthentication,
+					errors.New("no credentials given"), w)
+				return
+			}
+			var req ReportRequest
+			if !parseRequestBody(w, r, &req) {
+				return
+			}
+
+			report := models.Report{
+				Target:   req.Target,
+				TargetID: req.TargetID,
+				Reason:   req.Reason,
+			}
+			err = ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				_, err := ds.ModerationService.ReportAs(u, &report, tx)
+				if err != nil {
+					return fmt.Errorf("failed to report %s with ID %d: %w",
+						req.Target, req.TargetID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(report, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewReportsHandler returns a GET endpoint handler that lists the Reports to
+// Moderators, paginated by the first and skip query parameters. Only the
+// Reports with the status given by the status query parameter are listed, if
+// present.
+func NewReportsHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			if !authorizeRole(w, r, ds, au, models.RoleModerator) {
+				return
+			}
+			first, skip, ok := parsePagination(w, r)
+			if !ok {
+				return
+			}
+			var status *models.ReportStatus
+			if v := r.URL.Query().Get("status"); v != "" {
+				s, err := models.ParseReportStatus(v)
+				if err != nil {
+					web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+					return
+				}
+				status = &s
+			}
+
+			var list []*models.Report
+			err := ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var err error
+				list, err = ds.ModerationService.GetByStatus(status, first, skip, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get Reports: %w", err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(list, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewReportResolveHandler returns a PUT endpoint handler that resolves the
+// Report given by the id path variable, along with the other open Reports of
+// the same content, optionally hiding the content. Only Moderators may
+// resolve Reports.
+func NewReportResolveHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPut,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			id, u, ok := authenticatedCaller(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+			var req ReportResolution
+			if !parseRequestBody(w, r, &req) {
+				return
+			}
+
+			var report *models.Report
+			err := ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				var err error
+				report, err = ds.ModerationService.ResolveAs(u, id, req.Status, req.Hide, tx)
+				return err
+			})
+			if errors.Is(err, data.ErrUnauthorized) {
+				web.EncodeResponseErrorForbidden(web.ErrorAuthorization, err, w)
+				return
+			}
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer,
+					fmt.Errorf("failed to resolve Report with ID %d: %w", id, err), w)
+				return
+			}
+
+			web.EncodeResponseBody(report, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
@@ -0,0 +1,87 @@
+package naos_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestReportResolve tests that resolving a Report hides the reported Review
+// and resolves the other open Reports of it.
+func TestReportResolve(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	author := &models.User{Meta: db.ModelMetadata{ID: refs["spike"]}}
+	mod := &models.User{
+		Meta:        db.ModelMetadata{ID: refs["spike"] + 1000},
+		Permissions: models.UserPermission{WriteMedia: true},
+	}
+
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		jet := models.User{Username: "jet", Password: []byte("bonsai")}
+		jetID, err := ds.UserService.Create(&jet, tx)
+		if err != nil {
+			return err
+		}
+		jet.Meta.ID = jetID
+
+		rv := models.Review{UserID: author.Meta.ID, MediaID: refs["bebop"], Body: "Whatever happens, happens."}
+		rID, err := ds.ReviewService.CreateAs(author, &rv, tx)
+		if err != nil {
+			return err
+		}
+
+		var reportIDs []int
+		for _, u := range []*models.User{author, &jet} {
+			report := models.Report{
+				Target:   models.ReportTargetReview,
+				TargetID: rID,
+				Reason:   "spoilers",
+			}
+			id, err := ds.ModerationService.ReportAs(u, &report, tx)
+			if err != nil {
+				return err
+			}
+			reportIDs = append(reportIDs, id)
+		}
+
+		_, err = ds.ModerationService.ResolveAs(author, reportIDs[0],
+			models.ReportStatusActioned, true, tx)
+		if !errors.Is(err, data.ErrUnauthorized) {
+			t.Errorf("expected only Moderators to resolve Reports, got %v", err)
+		}
+		_, err = ds.ModerationService.ResolveAs(mod, reportIDs[0],
+			models.ReportStatusActioned, true, tx)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range reportIDs {
+			report, err := ds.ModerationService.GetByID(id, tx)
+			if err != nil {
+				return err
+			}
+			if report.Status != models.ReportStatusActioned {
+				t.Errorf("Report %d: expected status %s, got %s",
+					id, models.ReportStatusActioned, report.Status)
+			}
+		}
+		got, err := ds.ReviewService.GetByID(rID, tx)
+		if err != nil {
+			return err
+		}
+		if !got.Hidden || got.Flagged {
+			t.Errorf("expected hidden and unflagged Review, got hidden %t and flagged %t",
+				got.Hidden, got.Flagged)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to resolve Report: %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package naos
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/mail"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/julienschmidt/httprouter"
+)
+
+// DefaultResetDuration is how long password reset tokens are valid for if not
+// configured.
+const DefaultResetDuration = time.Hour
+
+// PasswordResetRequest is the request body of a request to reset the
+// password of a User.
+type PasswordResetRequest struct {
+	Username string `json:"username" validate:"required"`
+}
+
+// PasswordResetConfirmation is the request body of the reset of the password
+// of a User with a token sent to them.
+type PasswordResetConfirmation struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// NewPasswordResetHandler returns a POST endpoint handler that emails a token
+// to reset their password to the User with the username given in the request
+// body. The response does not reveal whether the User exists or has an email
+// address. Reset links point to the given URL with the token in the token
+// query parameter, if set.
+func NewPasswordResetHandler(
+	path []string, ds *graphql.DataService, mq *mail.Queue,
+	resetURL string, duration time.Duration,
+) web.Handler {
+	if duration <= 0 {
+		duration = DefaultResetDuration
+	}
+
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			if mq == nil {
+				web.EncodeResponseErrorInternalServer(web.ErrorInternalServer,
+					errors.New("mail is not configured"), w)
+				return
+			}
+			var req PasswordResetRequest
+			if !parseRequestBody(w, r, &req) {
+				return
+			}
+
+			var msg *mail.Message
+			err := ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				u, err := ds.UserService.GetByUsername(req.Username, tx)
+				if errors.Is(err, data.ErrNotFound) {
+					return nil
+				}
+				if err != nil {
+					return fmt.Errorf("failed to get User by username %q: %w", req.Username, err)
+				}
+				if u.Email == "" || u.Disabled {
+					return nil
+				}
+
+				expiresAt := time.Now().Add(duration)
+				token, err := ds.PasswordResetService.Request(u.Meta.ID, expiresAt, tx)
+				if err != nil {
+					return fmt.Errorf("failed to reset password of User with ID %d: %w",
+						u.Meta.ID, err)
+				}
+				msg, err = mail.PasswordReset.Render(u.Email, mail.PasswordResetData{
+					Username:  u.Username,
+					Token:     token,
+					URL:       passwordResetURL(resetURL, token),
+					ExpiresAt: expiresAt,
+				})
+				return err
+			})
+			if err == nil && msg != nil {
+				err = mq.Enqueue(msg)
+			}
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(struct{}{}, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewPasswordResetConfirmHandler returns a POST endpoint handler that
+// replaces the password of the User with the reset token given in the request
+// body.
+func NewPasswordResetConfirmHandler(path []string, ds *graphql.DataService) web.Handler {
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			var req PasswordResetConfirmation
+			if !parseRequestBody(w, r, &req) {
+				return
+			}
+
+			err := ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				return ds.PasswordResetService.Redeem(req.Token, req.Password, time.Now(), tx)
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorAuthentication, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(struct{}{}, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// passwordResetURL returns the given URL with the given token in the token
+// query parameter, or an empty string if no URL is given.
+func passwordResetURL(resetURL string, token string) string {
+	if resetURL == "" {
+		return ""
+	}
+	u, err := url.Parse(resetURL)
+	if err != nil {
+		return ""
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
@@ -0,0 +1,68 @@
+package naos_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/mail"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// TestPasswordReset tests that reset tokens replace the password of their
+// User once, before they expire.
+func TestPasswordReset(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	spike := refs["spike"]
+	now := time.Date(2020, 4, 1, 20, 0, 0, 0, time.UTC)
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		expired, err := ds.PasswordResetService.Request(spike, now.Add(-time.Minute), tx)
+		if err != nil {
+			return err
+		}
+		err = ds.PasswordResetService.Redeem(expired, "swordfish", now, tx)
+		if !errors.Is(err, data.ErrUnauthorized) {
+			t.Errorf("expected expired token to be unauthorized, got %v", err)
+		}
+
+		token, err := ds.PasswordResetService.Request(spike, now.Add(time.Hour), tx)
+		if err != nil {
+			return err
+		}
+		msg, err := mail.PasswordReset.Render("spike@bebop.test", mail.PasswordResetData{
+			Username: "spike", Token: token, ExpiresAt: now.Add(time.Hour),
+		})
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(msg.Body, token) {
+			t.Errorf("expected message to contain token, got %q", msg.Body)
+		}
+
+		err = ds.PasswordResetService.Redeem(token, "swordfish", now, tx)
+		if err != nil {
+			return err
+		}
+		u, err := ds.UserService.GetByID(spike, tx)
+		if err != nil {
+			return err
+		}
+		err = ds.UserService.AuthenticateWithPassword(u.Username, "swordfish", tx)
+		if err != nil {
+			t.Errorf("expected new password to authenticate: %v", err)
+		}
+		err = ds.PasswordResetService.Redeem(token, "swordfish", now, tx)
+		if !errors.Is(err, data.ErrUnauthorized) {
+			t.Errorf("expected redeemed token to be unauthorized, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to reset password: %v", err)
+	}
+}
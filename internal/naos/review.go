@@ -0,0 +1,626 @@
+package naos
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	json "github.com/json-iterator/go"
+	"github.com/julienschmidt/httprouter"
+)
+
+// ReviewRequest is the request body of the creation or update of a Review.
+type ReviewRequest struct {
+	Body    string `json:"body" validate:"required"`
+	Score   *int   `json:"score"`
+	Spoiler bool   `json:"spoiler"`
+}
+
+// CommentRequest is the request body of the creation of a Comment.
+type CommentRequest struct {
+	Body     string `json:"body" validate:"required"`
+	ParentID *int   `json:"parentID"`
+}
+
+// HiddenRequest is the request body of a moderation change to the
+// visibility of a Review or Comment.
+type HiddenRequest struct {
+	Hidden bool `json:"hidden"`
+}
+
+// FlaggedContent is the response body of the listing of the Reviews and
+// Comments flagged for moderation.
+type FlaggedContent struct {
+	Reviews  []*models.Review  `json:"reviews"`
+	Comments []*models.Comment `json:"comments"`
+}
+
+// NewMediaReviewsHandler returns a GET endpoint handler that lists the
+// Reviews of the Media given by the id path variable visible to the caller,
+// paginated by the first and skip query parameters. Only Reviews updated
+// after the updated_since query parameter are listed if it is given.
+func NewMediaReviewsHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			mID, u, ok := libraryCaller(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+			first, skip, ok := parsePagination(w, r)
+			if !ok {
+				return
+			}
+			since, ok := parseUpdatedSince(w, r)
+			if !ok {
+				return
+			}
+
+			var list []*models.Review
+			err := ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var err error
+				list, err = ds.ReviewService.GetByMediaAs(u, mID, since, first, skip, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get Reviews by Media ID %d: %w", mID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(list, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewReviewCreateHandler returns a POST endpoint handler that creates a
+// Review by the caller of the Media given by the id path variable.
+func NewReviewCreateHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		DryRun: true,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			mID, u, ok := authenticatedCaller(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+			var req ReviewRequest
+			if !parseRequestBody(w, r, &req) {
+				return
+			}
+
+			rv := models.Review{
+				UserID:  u.Meta.ID,
+				MediaID: mID,
+				Body:    req.Body,
+				Score:   req.Score,
+				Spoiler: req.Spoiler,
+			}
+			err := ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				_, err := ds.ReviewService.CreateAs(u, &rv, tx)
+				if err != nil {
+					return fmt.Errorf("failed to create Review of Media with ID %d: %w", mID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(rv, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewReviewHandler returns a GET endpoint handler for the Review given by the
+// id path variable, if visible to the caller.
+func NewReviewHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			rID, u, ok := libraryCaller(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+
+			var rv *models.Review
+			err := ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var err error
+				rv, err = ds.ReviewService.GetByIDAs(u, rID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get Review by ID %d: %w", rID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(rv, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewReviewUpdateHandler returns a PUT endpoint handler that replaces the
+// body, score and spoiler flag of the Review given by the id path variable.
+// Only the User and Admins may change it.
+func NewReviewUpdateHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPut,
+		Path:   path,
+		DryRun: true,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			rID, u, ok := authenticatedCaller(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+			var req ReviewRequest
+			if !parseRequestBody(w, r, &req) {
+				return
+			}
+
+			var rv *models.Review
+			err := ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				var err error
+				rv, err = ds.ReviewService.GetByIDAs(u, rID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get Review by ID %d: %w", rID, err)
+				}
+
+				rv.Body = req.Body
+				rv.Score = req.Score
+				rv.Spoiler = req.Spoiler
+				err = ds.ReviewService.UpdateAs(u, rv, tx)
+				if err != nil {
+					return fmt.Errorf("failed to update Review with ID %d: %w", rID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(rv, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewReviewPatchHandler returns a PATCH endpoint handler that applies the
+// JSON Merge Patch or JSON Patch in the request body, by its content type, to
+// the Review given by the id path variable in a single transaction. Only the
+// User and Admins may change it, and only its body, score and spoiler flag.
+func NewReviewPatchHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPatch,
+		Path:   path,
+		DryRun: true,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			rID, u, ok := authenticatedCaller(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+			patch, err := web.ReadRequestBody(r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorRequestBodyReading, err, w)
+				return
+			}
+
+			var rv *models.Review
+			err = ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				var err error
+				rv, err = ds.ReviewService.GetByIDAs(u, rID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get Review by ID %d: %w", rID, err)
+				}
+
+				err = patchModel(r.Header.Get(web.HeaderContentType), patch, rv)
+				if err != nil {
+					return err
+				}
+				err = ds.ReviewService.UpdateAs(u, rv, tx)
+				if err != nil {
+					return fmt.Errorf("failed to update Review with ID %d: %w", rID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				encodePatchError(err, w)
+				return
+			}
+
+			web.EncodeResponseBody(rv, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewReviewDeleteHandler returns a DELETE endpoint handler that deletes the
+// Review given by the id path variable, along with its Comments. Only the
+// User and Admins may delete it.
+func NewReviewDeleteHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodDelete,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			rID, u, ok := authenticatedCaller(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+
+			err := ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				err := ds.ReviewService.DeleteAs(u, rID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to delete Review with ID %d: %w", rID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		},
+	}
+}
+
+// NewCommentsHandler returns a GET endpoint handler that lists the Comments
+// on the Review given by the id path variable visible to the caller,
+// paginated by the first and skip query parameters. Top-level Comments are
+// listed unless the parent query parameter gives the ID of the Comment whose
+// replies to list. Only Comments updated after the updated_since query
+// parameter are listed if it is given.
+func NewCommentsHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			rID, u, ok := libraryCaller(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+			first, skip, ok := parsePagination(w, r)
+			if !ok {
+				return
+			}
+			since, ok := parseUpdatedSince(w, r)
+			if !ok {
+				return
+			}
+			parentID, err := web.ParseQueryInt("parent", r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+				return
+			}
+
+			var list []*models.Comment
+			err = ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				_, err := ds.ReviewService.GetByIDAs(u, rID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get Review by ID %d: %w", rID, err)
+				}
+
+				list, err = ds.CommentService.GetByReviewAs(u, rID, parentID, since, first, skip,
+					tx)
+				if err != nil {
+					return fmt.Errorf("failed to get Comments by Review ID %d: %w", rID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(list, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewCommentCreateHandler returns a POST endpoint handler that creates a
+// Comment by the caller on the Review given by the id path variable.
+func NewCommentCreateHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		DryRun: true,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			rID, u, ok := authenticatedCaller(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+			var req CommentRequest
+			if !parseRequestBody(w, r, &req) {
+				return
+			}
+
+			c := models.Comment{
+				UserID:   u.Meta.ID,
+				ReviewID: rID,
+				ParentID: req.ParentID,
+				Body:     req.Body,
+			}
+			err := ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				_, err := ds.CommentService.CreateAs(u, &c, tx)
+				if err != nil {
+					return fmt.Errorf("failed to create Comment on Review with ID %d: %w", rID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(c, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewCommentDeleteHandler returns a DELETE endpoint handler that deletes the
+// Comment given by the id path variable, along with its replies. Only the
+// User, Moderators and Admins may delete it.
+func NewCommentDeleteHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodDelete,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			cID, u, ok := authenticatedCaller(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+
+			err := ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				err := ds.CommentService.DeleteAs(u, cID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to delete Comment with ID %d: %w", cID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		},
+	}
+}
+
+// NewFlagHandler returns a POST endpoint handler that flags the Review, or
+// the Comment if comment is true, given by the id path variable for
+// moderation.
+func NewFlagHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator, comment bool,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			id, u, ok := authenticatedCaller(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+
+			err := ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				if comment {
+					return ds.CommentService.FlagAs(u, id, tx)
+				}
+				return ds.ReviewService.FlagAs(u, id, tx)
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer,
+					fmt.Errorf("failed to flag %s with ID %d: %w", moderatedKind(comment), id, err), w)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		},
+	}
+}
+
+// NewHiddenHandler returns a PUT endpoint handler that hides or shows the
+// Review, or the Comment if comment is true, given by the id path variable,
+// and clears its flag. Only Moderators may change it.
+func NewHiddenHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator, comment bool,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPut,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			id, u, ok := authenticatedCaller(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+			var req HiddenRequest
+			if !parseRequestBody(w, r, &req) {
+				return
+			}
+
+			var m db.Model
+			err := ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				var err error
+				if comment {
+					m, err = ds.CommentService.SetHiddenAs(u, id, req.Hidden, tx)
+				} else {
+					m, err = ds.ReviewService.SetHiddenAs(u, id, req.Hidden, tx)
+				}
+				return err
+			})
+			if errors.Is(err, data.ErrUnauthorized) {
+				web.EncodeResponseErrorForbidden(web.ErrorAuthorization, err, w)
+				return
+			}
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer,
+					fmt.Errorf("failed to moderate %s with ID %d: %w", moderatedKind(comment), id, err), w)
+				return
+			}
+
+			web.EncodeResponseBody(m, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewFlaggedHandler returns a GET endpoint handler that lists the Reviews and
+// Comments flagged for moderation. Only Moderators may view them.
+func NewFlaggedHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			u, err := RequestUser(r, ds, au)
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorAuthentication, err, w)
+				return
+			}
+			if u == nil {
+				web.EncodeResponseErrorUnauthorized(web.ErrorAuthentication,
+					errors.New("no credentials given"), w)
+				return
+			}
+			if role := u.Permissions.Role(); !role.Includes(models.RoleModerator) {
+				web.EncodeResponseErrorForbidden(web.ErrorAuthorization,
+					fmt.Errorf("role %s: insufficient permissions", role), w)
+				return
+			}
+			first, skip, ok := parsePagination(w, r)
+			if !ok {
+				return
+			}
+
+			var flagged FlaggedContent
+			err = ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var err error
+				flagged.Reviews, err = ds.ReviewService.GetFlagged(first, skip, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get flagged Reviews: %w", err)
+				}
+				flagged.Comments, err = ds.CommentService.GetFlagged(first, skip, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get flagged Comments: %w", err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(flagged, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// authenticatedCaller returns the ID given by the id path variable and the
+// caller, who must be authenticated. Otherwise, it encodes an error response
+// and returns false.
+func authenticatedCaller(
+	w http.ResponseWriter, r *http.Request, ps httprouter.Params,
+	ds *graphql.DataService, au *jwt.Authenticator,
+) (int, *models.User, bool) {
+	id, u, ok := libraryCaller(w, r, ps, ds, au)
+	if !ok {
+		return 0, nil, false
+	}
+	if u == nil {
+		web.EncodeResponseErrorUnauthorized(web.ErrorAuthentication,
+			errors.New("no credentials given"), w)
+		return 0, nil, false
+	}
+	return id, u, true
+}
+
+// parseRequestBody decodes the JSON request body into v and checks it against
+// its validate tags. If the body cannot be read or decoded, or is not valid, it
+// encodes an error response and returns false.
+func parseRequestBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	body, err := web.ReadRequestBody(r)
+	if err != nil {
+		web.EncodeResponseErrorBadRequest(web.ErrorRequestBodyReading, err, w)
+		return false
+	}
+	err = json.Unmarshal(body, v)
+	if err != nil {
+		web.EncodeResponseErrorBadRequest(web.ErrorRequestBodyParsing, err, w)
+		return false
+	}
+
+	var verr data.ValidationError
+	data.ValidateTags(v, &verr)
+	err = verr.Err()
+	if err != nil {
+		web.EncodeResponseErrorFor(web.ErrorRequestBodyParsing, err, w)
+		return false
+	}
+	return true
+}
+
+// moderatedKind returns the name of the kind of content moderated.
+func moderatedKind(comment bool) string {
+	if comment {
+		return "Comment"
+	}
+	return "Review"
+}
@@ -0,0 +1,123 @@
+package naos_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestReview tests that Reviews are unique per User and Media, that hidden
+// Reviews are visible only to their Users and Moderators, and that Comments
+// are deleted with their Reviews.
+func TestReview(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	author := &models.User{Meta: db.ModelMetadata{ID: refs["spike"]}}
+	other := &models.User{Meta: db.ModelMetadata{ID: refs["spike"] + 1000}}
+	mod := &models.User{
+		Meta:        db.ModelMetadata{ID: refs["spike"] + 1001},
+		Permissions: models.UserPermission{WriteMedia: true},
+	}
+	mID := refs["bebop"]
+
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		rv := models.Review{UserID: author.Meta.ID, MediaID: mID, Body: "See you, space cowboy."}
+		rID, err := ds.ReviewService.CreateAs(author, &rv, tx)
+		if err != nil {
+			return err
+		}
+
+		dup := models.Review{UserID: author.Meta.ID, MediaID: mID, Body: "Again."}
+		_, err = ds.ReviewService.CreateAs(author, &dup, tx)
+		if !errors.Is(err, data.ErrConflict) {
+			t.Errorf("expected conflicting second Review, got %v", err)
+		}
+
+		c := models.Comment{UserID: author.Meta.ID, ReviewID: rID, Body: "Bang."}
+		cID, err := ds.CommentService.CreateAs(author, &c, tx)
+		if err != nil {
+			return err
+		}
+		reply := models.Comment{UserID: author.Meta.ID, ReviewID: rID, ParentID: &cID, Body: "Bang!"}
+		_, err = ds.CommentService.CreateAs(author, &reply, tx)
+		if err != nil {
+			return err
+		}
+
+		_, err = ds.ReviewService.SetHiddenAs(author, rID, true, tx)
+		if !errors.Is(err, data.ErrUnauthorized) {
+			t.Errorf("expected only Moderators to hide Reviews, got %v", err)
+		}
+		_, err = ds.ReviewService.SetHiddenAs(mod, rID, true, tx)
+		if err != nil {
+			return err
+		}
+		for _, tc := range []struct {
+			caller  *models.User
+			visible bool
+		}{{nil, false}, {other, false}, {author, true}, {mod, true}} {
+			list, err := ds.ReviewService.GetByMediaAs(tc.caller, mID, nil, nil, nil, tx)
+			if err != nil {
+				return err
+			}
+			if visible := len(list) == 1; visible != tc.visible {
+				t.Errorf("caller %v: expected hidden Review visible %t, got %t",
+					tc.caller, tc.visible, visible)
+			}
+		}
+
+		err = ds.ReviewService.DeleteAs(author, rID, tx)
+		if err != nil {
+			return err
+		}
+		comments, err := ds.CommentService.GetFilter(nil, nil, tx,
+			func(c *models.Comment) bool { return true })
+		if err != nil {
+			return err
+		}
+		if len(comments) != 0 {
+			t.Errorf("expected Comments of deleted Review to be deleted, got %d", len(comments))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to review: %v", err)
+	}
+}
+
+// TestReviewValidation tests that every invalid property of a Review is
+// reported by its path in one ValidationError.
+func TestReviewValidation(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	author := &models.User{Meta: db.ModelMetadata{ID: refs["spike"]}}
+	score := data.ReviewScoreMax + 1
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		rv := models.Review{UserID: author.Meta.ID, MediaID: refs["bebop"], Body: " ", Score: &score}
+		_, err := ds.ReviewService.CreateAs(author, &rv, tx)
+		return err
+	})
+
+	var verr *data.ValidationError
+	if !errors.As(err, &verr) || !errors.Is(err, data.ErrInvalid) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	expected := []data.FieldError{
+		{Path: "Body", Code: data.FieldRequired},
+		{Path: "Score", Code: data.FieldOutOfRange},
+	}
+	if len(verr.Fields) != len(expected) {
+		t.Fatalf("expected %d field errors, got %+v", len(expected), verr.Fields)
+	}
+	for i, f := range verr.Fields {
+		if f.Path != expected[i].Path || f.Code != expected[i].Code || f.Message == "" {
+			t.Errorf("expected field error %+v, got %+v", expected[i], f)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package naos
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// RewatchRequest is the request body of starting a rewatch of some Media.
+type RewatchRequest struct {
+	MediaID int `json:"mediaID" validate:"required"`
+	// Time is the time the rewatch started; defaults to the time the request
+	// was received.
+	Time *time.Time `json:"time"`
+}
+
+// NewRewatchHandler returns a POST endpoint handler that starts a rewatch of
+// some Media completed by the User given by the id path variable, as a new
+// watch of their UserMedia. Only the User may start their rewatches.
+func NewRewatchHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			uID, u, ok := authorizeLibraryOwner(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+			var req RewatchRequest
+			if !parseRequestBody(w, r, &req) {
+				return
+			}
+			t := time.Now()
+			if req.Time != nil {
+				t = *req.Time
+			}
+
+			var um *models.UserMedia
+			err := ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				var err error
+				um, err = ds.UserMediaService.StartRewatchAs(u, uID, req.MediaID, t, tx)
+				if err != nil {
+					return fmt.Errorf("failed to start rewatch of Media with ID %d: %w",
+						req.MediaID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(um, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
@@ -0,0 +1,69 @@
+package naos_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestRewatch tests that rewatches are started only of completed Media, that
+// they are counted on their UserMedia, and that the time spent in them is
+// counted separately in wrap-ups.
+func TestRewatch(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	spike := &models.User{Meta: db.ModelMetadata{ID: refs["spike"]}}
+	faye := &models.User{Meta: db.ModelMetadata{ID: refs["faye"]}}
+	start := time.Date(2020, 4, 1, 20, 0, 0, 0, time.UTC)
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		_, err := ds.UserMediaService.StartRewatchAs(faye, faye.Meta.ID, refs["bebop"], start, tx)
+		if !errors.Is(err, data.ErrInvalid) {
+			t.Errorf("expected rewatch of Media on hold to be invalid, got %v", err)
+		}
+
+		for i := 1; i <= 2; i++ {
+			um, err := ds.UserMediaService.StartRewatchAs(spike, spike.Meta.ID, refs["bebop"],
+				start.Add(time.Duration(i)*time.Hour), tx)
+			if err != nil {
+				return err
+			}
+			latest := um.WatchInstances[len(um.WatchInstances)-1]
+			if um.RewatchCount != i || latest.Rewatch != i || !latest.Ongoing {
+				t.Errorf("expected ongoing rewatch %d, got %d of %d", i, latest.Rewatch,
+					um.RewatchCount)
+			}
+			if um.Status == nil || *um.Status != models.WatchStatusCurrent {
+				t.Errorf("expected status %v, got %v", models.WatchStatusCurrent, um.Status)
+			}
+		}
+
+		for _, ws := range []models.WatchSession{
+			{Start: start, End: start.Add(time.Hour)},
+			{Start: start.Add(3 * time.Hour), End: start.Add(5 * time.Hour)},
+		} {
+			ws.UserID, ws.MediaID, ws.UserMediaID = spike.Meta.ID, refs["bebop"], refs["watching"]
+			_, err = ds.WatchSessionService.Create(&ws, tx)
+			if err != nil {
+				return err
+			}
+		}
+		wu, err := ds.StatsService.Wrapup(spike.Meta.ID, 2020, time.UTC, tx)
+		if err != nil {
+			return err
+		}
+		if math.Abs(wu.Hours-3) > 1e-9 || math.Abs(wu.RewatchHours-2) > 1e-9 {
+			t.Errorf("expected 2 of 3 hours rewatching, got %v of %v", wu.RewatchHours, wu.Hours)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to rewatch: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package naos
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// schedule runs a job over consecutive periods of time, at every interval, in
+// the background.
+type schedule struct {
+	// active, if set, returns whether the job is run on this instance, such
+	// as only on the leader of a cluster. Runs are skipped while it returns
+	// false, and their periods taken as done.
+	active func() bool
+
+	stop chan struct{}
+	done chan struct{}
+	mu   sync.Mutex
+}
+
+// start begins running the given job at every interval, over the period
+// since the end of its last successful run, starting from now. Errors of the
+// job are passed to onError, if set, and its period is retried in the next
+// run.
+func (s *schedule) start(
+	interval time.Duration, job func(from time.Time, to time.Time) error,
+	onError func(error),
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop != nil {
+		return errors.New("already started")
+	}
+	if interval <= 0 {
+		return fmt.Errorf("interval %s: %w", interval, db.ErrInvalid)
+	}
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func(stop <-chan struct{}, done chan<- struct{}) {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		last := time.Now()
+		for {
+			select {
+			case <-stop:
+				return
+			case t := <-ticker.C:
+				if s.active != nil && !s.active() {
+					last = t
+					continue
+				}
+				err := job(last, t)
+				if err != nil {
+					if onError != nil {
+						onError(err)
+					}
+					continue
+				}
+				last = t
+			}
+		}
+	}(s.stop, s.done)
+	return nil
+}
+
+// halt stops running the job and waits for a run in progress to finish.
+func (s *schedule) halt() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	s.stop, s.done = nil, nil
+}
@@ -0,0 +1,62 @@
+package naos
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/script"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/julienschmidt/httprouter"
+)
+
+// NewWebhookHandler returns a POST endpoint handler that calls the script
+// webhook given by the name path variable with the request, and responds
+// with the value it returns. Scripts authenticate the callers of their
+// webhooks themselves, such as by the signature in a header.
+func NewWebhookHandler(path []string, engine *script.Engine) web.Handler {
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			body, err := web.ReadRequestBody(r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorRequestBodyReading, err, w)
+				return
+			}
+
+			req := script.WebhookRequest{
+				Method:  r.Method,
+				Path:    r.URL.Path,
+				Query:   firstValues(r.URL.Query()),
+				Headers: firstValues(r.Header),
+				Body:    string(body),
+			}
+			res, err := engine.Webhook(r.Context(), ps.ByName("name"), &req)
+			if errors.Is(err, script.ErrNoWebhook) {
+				err = fmt.Errorf("%v: %w", err, data.ErrNotFound)
+			}
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(res, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// firstValues returns the first of the values of each of the given keys.
+func firstValues(values map[string][]string) map[string]string {
+	first := make(map[string]string, len(values))
+	for k, v := range values {
+		if len(v) > 0 {
+			first[k] = v[0]
+		}
+	}
+	return first
+}
@@ -0,0 +1,198 @@
+package naos
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	json "github.com/json-iterator/go"
+	"github.com/julienschmidt/httprouter"
+)
+
+// TraktWatchedProgress is the percentage of an Episode that must have been
+// played for a stopped playback to count as finished, as in the Trakt
+// scrobble API.
+const TraktWatchedProgress = 80
+
+// ScrobbleRequest is the request body of a playback event reported by a media
+// player.
+//
+// Players report either their progress through the Media, by Episodes and
+// Completed, or, if Event is given, the starting, pausing or finishing of the
+// Episode given by Episode or EpisodeID.
+type ScrobbleRequest struct {
+	MediaID   int  `json:"mediaID"`
+	Episodes  int  `json:"episodes"`
+	Completed bool `json:"completed"`
+	// Event is the kind of event of the Episode played.
+	Event *models.PlaybackEventKind `json:"event"`
+	// Episode is the number of the regular Episode played, starting at 1.
+	Episode *int `json:"episode"`
+	// EpisodeID is the ID of the Episode played, if known.
+	EpisodeID *int `json:"episodeID"`
+	// Time is the time of the event; defaults to the time it was received.
+	Time *time.Time `json:"time"`
+}
+
+// TraktScrobbleRequest is the request body of a playback event in the style
+// of the Trakt scrobble API, with Media and Episodes given by their IDs in
+// naos.
+type TraktScrobbleRequest struct {
+	Media struct {
+		ID int `json:"id"`
+	} `json:"media"`
+	// Episode may be omitted for Media watched as a single unit.
+	Episode *struct {
+		ID     *int `json:"id"`
+		Number *int `json:"number"`
+	} `json:"episode"`
+	// Progress is the percentage of the Episode played.
+	Progress float64 `json:"progress"`
+}
+
+// NewScrobbleHandler returns a POST endpoint handler that stitches playback
+// events of the authenticated User into the watches of their UserMedia.
+func NewScrobbleHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			u, err := RequestUser(r, ds, au)
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorAuthentication, err, w)
+				return
+			}
+			if u == nil {
+				web.EncodeResponseErrorUnauthorized(web.ErrorAuthentication,
+					errors.New("no credentials given"), w)
+				return
+			}
+
+			body, err := web.ReadRequestBody(r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorRequestBodyReading, err, w)
+				return
+			}
+			var req ScrobbleRequest
+			err = json.Unmarshal(body, &req)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorRequestBodyParsing, err, w)
+				return
+			}
+
+			t := time.Now()
+			if req.Time != nil {
+				t = *req.Time
+			}
+
+			var um *models.UserMedia
+			err = ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				if req.Event != nil {
+					um, err = ds.UserMediaService.PlayAs(u, &models.PlaybackEvent{
+						UserID:    u.Meta.ID,
+						MediaID:   req.MediaID,
+						Kind:      *req.Event,
+						Episode:   req.Episode,
+						EpisodeID: req.EpisodeID,
+						Time:      t,
+					}, tx)
+				} else {
+					um, err = ds.UserMediaService.ScrobbleAs(u, &models.Scrobble{
+						UserID:    u.Meta.ID,
+						MediaID:   req.MediaID,
+						Episodes:  req.Episodes,
+						Completed: req.Completed,
+						EpisodeID: req.EpisodeID,
+						Time:      t,
+					}, tx)
+				}
+				if err != nil {
+					return fmt.Errorf("failed to scrobble Media with ID %d: %w",
+						req.MediaID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(um, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewTraktScrobbleHandler returns a POST endpoint handler that stitches
+// playback events of the authenticated User, reported in the style of the
+// Trakt scrobble API, into the watches of their UserMedia. The handler of each
+// of the start, pause and stop actions is given the kind of event of the
+// action; stopped playback counts as finished only if at least
+// TraktWatchedProgress percent of the Episode was played.
+func NewTraktScrobbleHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+	kind models.PlaybackEventKind,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			u, err := RequestUser(r, ds, au)
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorAuthentication, err, w)
+				return
+			}
+			if u == nil {
+				web.EncodeResponseErrorUnauthorized(web.ErrorAuthentication,
+					errors.New("no credentials given"), w)
+				return
+			}
+			var req TraktScrobbleRequest
+			if !parseRequestBody(w, r, &req) {
+				return
+			}
+
+			e := models.PlaybackEvent{
+				UserID:  u.Meta.ID,
+				MediaID: req.Media.ID,
+				Kind:    kind,
+				Time:    time.Now(),
+			}
+			if req.Episode != nil {
+				e.Episode, e.EpisodeID = req.Episode.Number, req.Episode.ID
+			}
+			if kind == models.PlaybackEventFinished && req.Progress < TraktWatchedProgress {
+				e.Kind = models.PlaybackEventPaused
+			}
+
+			var um *models.UserMedia
+			err = ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				um, err = ds.UserMediaService.PlayAs(u, &e, tx)
+				if err != nil {
+					return fmt.Errorf("failed to scrobble Media with ID %d: %w",
+						e.MediaID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(um, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
@@ -0,0 +1,162 @@
+package naos_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestPlay tests that starting a movie marks it as being watched and
+// finishing it completes it.
+func TestPlay(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	owner := &models.User{Meta: db.ModelMetadata{ID: refs["spike"]}}
+	start := time.Date(2020, 4, 1, 20, 0, 0, 0, time.UTC)
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		for i, c := range []struct {
+			kind   models.PlaybackEventKind
+			status models.WatchStatus
+		}{
+			{models.PlaybackEventStarted, models.WatchStatusCurrent},
+			{models.PlaybackEventPaused, models.WatchStatusCurrent},
+			{models.PlaybackEventFinished, models.WatchStatusCompleted},
+		} {
+			um, err := ds.UserMediaService.PlayAs(owner, &models.PlaybackEvent{
+				UserID:  owner.Meta.ID,
+				MediaID: refs["movie"],
+				Kind:    c.kind,
+				Time:    start.Add(time.Duration(i) * time.Hour),
+			}, tx)
+			if err != nil {
+				return err
+			}
+			if um.Status == nil || *um.Status != c.status {
+				t.Errorf("expected status %v after %v, got %v", c.status, c.kind, um.Status)
+			}
+			if n := len(um.WatchInstances); n != 1 {
+				t.Errorf("expected 1 watch after %v, got %d", c.kind, n)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to play Media: %v", err)
+	}
+}
+
+// TestScrobble tests that scrobbles are stitched into the ongoing watch of
+// the UserMedia while within the session gap of its last progress and not
+// moving backwards, and into a new watch otherwise.
+func TestScrobble(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	start := time.Date(2020, 4, 1, 20, 0, 0, 0, time.UTC)
+	tv := "TV"
+	at := func(h int) time.Time { return start.Add(time.Duration(h) * time.Hour) }
+	type scrobble struct {
+		hour      int
+		episodes  int
+		completed bool
+	}
+	tests := []struct {
+		name string
+		// ongoing is the ongoing watch of the UserMedia before the scrobbles,
+		// if any
+		ongoing   *models.WatchedInstance
+		scrobbles []scrobble
+		watches   int
+		episodes  int
+		end       time.Time
+		status    models.WatchStatus
+	}{
+		{"within gap", nil, []scrobble{{0, 1, false}, {1, 2, false}},
+			1, 2, at(1), models.WatchStatusCurrent},
+		{"past gap", nil, []scrobble{{0, 1, false}, {7, 2, false}},
+			2, 2, at(7), models.WatchStatusCurrent},
+		{"same episode", nil, []scrobble{{0, 2, false}, {1, 2, false}},
+			1, 2, at(1), models.WatchStatusCurrent},
+		{"out of order", nil, []scrobble{{1, 2, false}, {0, 3, false}},
+			1, 3, at(1), models.WatchStatusCurrent},
+		{"backwards", nil, []scrobble{{0, 3, false}, {1, 1, false}},
+			2, 1, at(1), models.WatchStatusCurrent},
+		{"completion", nil, []scrobble{{0, 11, false}, {1, 12, true}},
+			1, 12, at(1), models.WatchStatusCompleted},
+		{"after completion", nil, []scrobble{{0, 12, true}, {1, 1, false}},
+			2, 1, at(1), models.WatchStatusCurrent},
+		{"open without dates", &models.WatchedInstance{Ongoing: true, Episodes: 3},
+			[]scrobble{{0, 4, false}}, 1, 4, at(0), models.WatchStatusCurrent},
+		{"open without end", &models.WatchedInstance{Ongoing: true, Episodes: 3,
+			StartDate: &start}, []scrobble{{7, 4, false}}, 2, 4, at(7), models.WatchStatusCurrent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ds.Database.Transaction(true, func(tx db.Tx) error {
+				mID, err := ds.MediaService.Create(&models.Media{
+					Titles: []models.Title{{String: tt.name, Language: "en"}},
+					Type:   &tv,
+				}, tx)
+				if err != nil {
+					return err
+				}
+				uID := refs["spike"]
+				if tt.ongoing != nil {
+					_, err = ds.UserMediaService.Create(&models.UserMedia{
+						UserID:         uID,
+						MediaID:        mID,
+						WatchInstances: []models.WatchedInstance{*tt.ongoing},
+					}, tx)
+					if err != nil {
+						return err
+					}
+				}
+
+				var um *models.UserMedia
+				for _, s := range tt.scrobbles {
+					um, err = ds.UserMediaService.Scrobble(&models.Scrobble{
+						UserID:    uID,
+						MediaID:   mID,
+						Episodes:  s.episodes,
+						Completed: s.completed,
+						Time:      at(s.hour),
+					}, tx)
+					if err != nil {
+						return err
+					}
+				}
+
+				if len(um.WatchInstances) != tt.watches {
+					t.Fatalf("expected %d watches, got %+v", tt.watches, um.WatchInstances)
+				}
+				ongoing := 0
+				for _, wi := range um.WatchInstances {
+					if wi.Ongoing {
+						ongoing++
+					}
+				}
+				latest := um.WatchInstances[len(um.WatchInstances)-1]
+				completed := tt.status == models.WatchStatusCompleted
+				if latest.Episodes != tt.episodes || latest.Ongoing == completed ||
+					(!completed && ongoing != 1) {
+					t.Errorf("expected latest watch of %d episodes ongoing %v, got %+v",
+						tt.episodes, !completed, latest)
+				}
+				if latest.EndDate == nil || !latest.EndDate.Equal(tt.end) {
+					t.Errorf("expected latest watch to end at %v, got %v", tt.end, latest.EndDate)
+				}
+				if um.Status == nil || *um.Status != tt.status {
+					t.Errorf("expected status %v, got %v", tt.status, um.Status)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("failed to scrobble: %v", err)
+			}
+		})
+	}
+}
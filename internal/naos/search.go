@@ -0,0 +1,162 @@
+package naos
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// DefaultSearchLimit is the number of results of a search if not given.
+const DefaultSearchLimit = 20
+
+// MaxSearchLimit is the most results of a search that may be asked for.
+const MaxSearchLimit = 100
+
+// parseSearchQuery returns the search query given by the q query parameter,
+// and the number of results given by the limit query parameter.
+func parseSearchQuery(r *http.Request) (string, int, error) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		return "", 0, fmt.Errorf("query parameter %q: must not be empty: %w", "q",
+			data.ErrInvalid)
+	}
+	limit, err := web.ParseQueryInt("limit", r)
+	if err != nil {
+		return "", 0, err
+	}
+	if limit == nil {
+		return q, DefaultSearchLimit, nil
+	}
+	if *limit <= 0 || *limit > MaxSearchLimit {
+		return "", 0, fmt.Errorf("query parameter %q: not between 1 and %d: %w", "limit",
+			MaxSearchLimit, data.ErrInvalid)
+	}
+	return q, *limit, nil
+}
+
+// NewMediaSearchHandler returns a GET endpoint handler that lists the Media
+// with a Title or MediaAlias matching the q query parameter, in any script,
+// as many as the limit query parameter, with their Titles ordered for the
+// Accept-Language header.
+func NewMediaSearchHandler(path []string, ds *graphql.DataService) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			q, limit, err := parseSearchQuery(r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+				return
+			}
+
+			var list []*models.Media
+			err = ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				list, err = ds.MediaService.Search(q, &limit, tx)
+				if err != nil {
+					return fmt.Errorf("failed to search Media by %q: %w", q, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			langs := models.ParseAcceptLanguage(r.Header.Get(web.HeaderAcceptLanguage))
+			for _, md := range list {
+				md.Titles = models.LocalizeTitles(md.Titles, langs)
+			}
+			web.EncodeResponseBody(list, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewPersonSearchHandler returns a GET endpoint handler that lists the People
+// with a name matching the q query parameter, in any script, as many as the
+// limit query parameter, with their Names ordered for the Accept-Language
+// header.
+func NewPersonSearchHandler(path []string, ds *graphql.DataService) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			q, limit, err := parseSearchQuery(r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+				return
+			}
+
+			var list []*models.Person
+			err = ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				list, err = ds.PersonService.Search(q, &limit, tx)
+				if err != nil {
+					return fmt.Errorf("failed to search People by %q: %w", q, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			langs := models.ParseAcceptLanguage(r.Header.Get(web.HeaderAcceptLanguage))
+			for _, p := range list {
+				p.Names = models.LocalizeTitles(p.Names, langs)
+			}
+			web.EncodeResponseBody(list, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewCharacterSearchHandler returns a GET endpoint handler that lists the
+// Characters with a name matching the q query parameter, in any script, as
+// many as the limit query parameter, with their Names ordered for the
+// Accept-Language header.
+func NewCharacterSearchHandler(path []string, ds *graphql.DataService) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			q, limit, err := parseSearchQuery(r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+				return
+			}
+
+			var list []*models.Character
+			err = ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				list, err = ds.CharacterService.Search(q, &limit, tx)
+				if err != nil {
+					return fmt.Errorf("failed to search Characters by %q: %w", q, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			langs := models.ParseAcceptLanguage(r.Header.Get(web.HeaderAcceptLanguage))
+			for _, c := range list {
+				c.Names = models.LocalizeTitles(c.Names, langs)
+			}
+			web.EncodeResponseBody(list, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
@@ -0,0 +1,120 @@
+package naos_test
+
+import (
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// readings is a Romanizer of the readings of some kanji names.
+type readings map[string]string
+
+func (r readings) Romanize(key string) string {
+	return r[key]
+}
+
+// TestNameSearch tests that People and Characters are found by their names
+// in any script, normalized and with kana romanized, names in kanji and hanzi
+// by their readings, exact matches first, and by the readings of other
+// Romanizers once reindexed.
+func TestNameSearch(t *testing.T) {
+	ds, _, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		people := [][]models.Title{
+			{{String: "宮崎 駿", Language: "ja"}, {String: "Hayao Miyazaki", Language: "en"}},
+			{{String: "宮崎 吾朗", Language: "ja"}, {String: "Gorō Miyazaki", Language: "en"}},
+			{{String: "大友 克洋", Language: "ja"}, {String: "Katsuhiro Ōtomo", Language: "en"}},
+			{{String: "高畑 勲", Language: "ja"}},
+			{{String: "Gorō", Language: "en"}},
+			{{String: "新海誠", Language: "ja"}},
+			{{String: "磯 光雄", Language: "ja"}},
+			{{String: "王家衛", Language: "zh"}},
+		}
+		ids := make([]int, len(people))
+		for i, names := range people {
+			var err error
+			ids[i], err = ds.PersonService.Create(&models.Person{Names: names}, tx)
+			if err != nil {
+				return err
+			}
+		}
+		spike, err := ds.CharacterService.Create(&models.Character{
+			Names: []models.Title{{String: "スパイク・スピーゲル", Language: "ja"}},
+		}, tx)
+		if err != nil {
+			return err
+		}
+
+		for _, tc := range []struct {
+			query    string
+			expected []int
+		}{
+			{"Miyazaki", []int{ids[0], ids[1]}},
+			{"宮崎", []int{ids[0], ids[1]}},
+			{"miyazaki goro", []int{ids[1]}},
+			{"Hayao", []int{ids[0]}},
+			{"ＭＩＹＡＺＡＫＩ　ＨＡＹＡＯ", []int{ids[0]}},
+			{"Ootomo", []int{ids[2]}},
+			{"otomo katsu", []int{ids[2]}},
+			{"克洋", []int{ids[2]}},
+			{"Takahata", []int{ids[3]}},
+			{"isao takahata", []int{}},
+			{"Makoto Shinkai", []int{ids[5]}},
+			{"新海", []int{ids[5]}},
+			{"Mitsuo Iso", []int{ids[6]}},
+			{"Wang Jiawei", []int{ids[7]}},
+		} {
+			list, err := ds.PersonService.Search(tc.query, nil, tx)
+			if err != nil {
+				return err
+			}
+			if len(list) != len(tc.expected) {
+				t.Errorf("%q: expected %d People, got %d", tc.query, len(tc.expected), len(list))
+				continue
+			}
+			for i, p := range list {
+				if p.Meta.ID != tc.expected[i] {
+					t.Errorf("%q: expected Person %d at %d, got %d",
+						tc.query, tc.expected[i], i, p.Meta.ID)
+				}
+			}
+		}
+
+		// Exact matches come first
+		list, err := ds.PersonService.Search("Goro", nil, tx)
+		if err != nil || len(list) != 2 || list[0].Meta.ID != ids[4] {
+			t.Errorf("expected Person %d first by exact match, got %v, %v", ids[4], list, err)
+		}
+
+		for _, q := range []string{"supaiku", "スパイク", "すぴげる"} {
+			list, err := ds.CharacterService.Search(q, nil, tx)
+			if err != nil {
+				return err
+			}
+			if len(list) != 1 || list[0].Meta.ID != spike {
+				t.Errorf("%q: expected Character %d, got %v", q, spike, list)
+			}
+		}
+
+		// Readings of kanji the dictionary reads otherwise are added by
+		// Romanizers
+		ds.NameService.Romanizers = append(ds.NameService.Romanizers,
+			readings{"高畑 勲": "takahata isao"})
+		_, err = ds.NameService.Reindex(tx)
+		if err != nil {
+			return err
+		}
+		list, err = ds.PersonService.Search("Isao Takahata", nil, tx)
+		if err != nil || len(list) != 1 || list[0].Meta.ID != ids[3] {
+			t.Errorf("expected Person %d by reading, got %v, %v", ids[3], list, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,116 @@
+package naos
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// SeasonChart is a single page of the Media that premiered in a season.
+type SeasonChart struct {
+	Year    int                   `json:"year"`
+	Quarter models.Quarter        `json:"quarter"`
+	Sort    models.MediaSort      `json:"sort"`
+	First   *int                  `json:"first"`
+	Skip    *int                  `json:"skip"`
+	Media   []*models.SeasonEntry `json:"media"`
+}
+
+// NewSeasonHandler returns a GET endpoint handler that lists the Media that
+// premiered in the season given by the year and quarter path variables,
+// along with their statistics, paginated by the first and skip query
+// parameters and filtered by those of parseMediaFilter, such as
+// releaseStatus. The Media are sorted by the sort query parameter,
+// Popularity by default, and their Titles ordered for the Accept-Language
+// header.
+func NewSeasonHandler(path []string, ds *graphql.DataService) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			year, err := strconv.Atoi(ps.ByName("year"))
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorPathVariableParsing,
+					fmt.Errorf("year: %w", err), w)
+				return
+			}
+			quarter, err := parseQuarter(ps.ByName("quarter"))
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorPathVariableParsing, err, w)
+				return
+			}
+			order := models.MediaSortPopularity
+			if v := r.URL.Query().Get("sort"); v != "" {
+				order, err = models.ParseMediaSort(strings.Title(strings.ToLower(v)))
+				if err != nil {
+					web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing,
+						fmt.Errorf("sort: %w", err), w)
+					return
+				}
+			}
+			keep, err := parseMediaFilter(r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+				return
+			}
+			first, skip, ok := parsePagination(w, r)
+			if !ok {
+				return
+			}
+
+			chart := SeasonChart{
+				Year: year, Quarter: quarter, Sort: order, First: first, Skip: skip,
+			}
+			err = ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var err error
+				chart.Media, err = ds.MediaSeasonService.Chart(
+					year, quarter, order, keep, first, skip, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get Media of %s %d: %w", quarter, year, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			langs := models.ParseAcceptLanguage(r.Header.Get(web.HeaderAcceptLanguage))
+			for _, e := range chart.Media {
+				e.Media.Titles = models.LocalizeTitles(e.Media.Titles, langs)
+			}
+			web.EncodeResponseBody(chart, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// parseQuarter returns the Quarter with the given name, ignoring case, or
+// number.
+func parseQuarter(v string) (models.Quarter, error) {
+	n, err := strconv.Atoi(v)
+	if err == nil {
+		q := models.Quarter(n)
+		if !q.IsValid() {
+			return 0, fmt.Errorf("quarter %d: %w", n, data.ErrInvalid)
+		}
+		return q, nil
+	}
+
+	var q models.Quarter
+	err = q.UnmarshalGQL(strings.Title(strings.ToLower(v)))
+	if err != nil {
+		return 0, fmt.Errorf("quarter: %w", err)
+	}
+	return q, nil
+}
@@ -0,0 +1,99 @@
+package naos_test
+
+import (
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestSeasonChart tests that Media are indexed by the season they premiered
+// in as they change, and charted by popularity and score.
+func TestSeasonChart(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	year, spring, fall := 1998, models.QuarterSpring, models.QuarterFall
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		bebop, err := ds.MediaService.GetByID(refs["bebop"], tx)
+		if err != nil {
+			return err
+		}
+		bebop.SeasonPremiered = models.Season{Year: &year, Quarter: &spring}
+		err = ds.MediaService.Update(bebop, tx)
+		if err != nil {
+			return err
+		}
+		champlooID, err := ds.MediaService.Create(&models.Media{
+			SeasonPremiered: models.Season{Year: &year, Quarter: &spring},
+		}, tx)
+		if err != nil {
+			return err
+		}
+		score := 90
+		_, err = ds.UserMediaService.Create(&models.UserMedia{
+			UserID: refs["spike"], MediaID: champlooID, Score: &score,
+		}, tx)
+		if err != nil {
+			return err
+		}
+
+		chart := func(order models.MediaSort) ([]int, error) {
+			list, err := ds.MediaSeasonService.Chart(year, spring, order, nil, nil, nil, tx)
+			if err != nil {
+				return nil, err
+			}
+			ids := make([]int, len(list))
+			for i, e := range list {
+				ids[i] = e.Media.Meta.ID
+			}
+			return ids, nil
+		}
+		for _, c := range []struct {
+			order models.MediaSort
+			first int
+		}{
+			{models.MediaSortPopularity, bebop.Meta.ID},
+			{models.MediaSortScore, champlooID},
+		} {
+			ids, err := chart(c.order)
+			if err != nil {
+				return err
+			}
+			if len(ids) != 2 || ids[0] != c.first {
+				t.Errorf("expected Media %d first by %v, got %v", c.first, c.order, ids)
+			}
+		}
+
+		// Moving and deleting Media update the index
+		bebop.SeasonPremiered.Quarter = &fall
+		err = ds.MediaService.Update(bebop, tx)
+		if err != nil {
+			return err
+		}
+		err = ds.MediaService.Delete(champlooID, tx)
+		if err != nil {
+			return err
+		}
+		ids, err := chart(models.MediaSortPopularity)
+		if err != nil {
+			return err
+		}
+		if len(ids) != 0 {
+			t.Errorf("expected no Media in Spring %d, got %v", year, ids)
+		}
+
+		n, err := ds.MediaSeasonService.Reindex(tx)
+		if err != nil {
+			return err
+		}
+		if n != 1 {
+			t.Errorf("expected 1 Media reindexed, got %d", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to chart season: %v", err)
+	}
+}
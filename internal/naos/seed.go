@@ -0,0 +1,86 @@
+package naos
+
+import (
+	"fmt"
+
+	"github.com/Dophin2009/nao/internal/fixtures"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// Seed loads the fixtures files at the given paths, or in the directories at
+// them, into the database of the given data layer, in a single transaction.
+// Later files may refer to the entities of earlier ones.
+func Seed(ds *graphql.DataService, paths ...string) (fixtures.Refs, error) {
+	refs, _, err := seed(ds, false, paths)
+	return refs, err
+}
+
+// SeedEmpty loads the fixtures files at the given paths, or in the
+// directories at them, into the buckets of the database of the given data
+// layer that are empty, in a single transaction. Entities that refer to those
+// of buckets that are not empty are skipped too, so that seeding an already
+// seeded database does nothing. It returns the number of entities created.
+func SeedEmpty(ds *graphql.DataService, paths ...string) (int, error) {
+	_, n, err := seed(ds, true, paths)
+	return n, err
+}
+
+func seed(ds *graphql.DataService, onlyEmpty bool, paths []string) (fixtures.Refs, int, error) {
+	files, err := fixtures.Files(paths...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	list := make([]*fixtures.Fixtures, len(files))
+	for i, path := range files {
+		f, err := fixtures.ReadFile(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		list[i] = f
+	}
+
+	refs := fixtures.Refs{}
+	n := 0
+	err = ds.Database.Transaction(true, func(tx db.Tx) error {
+		var skip *fixtures.Skip
+		if onlyEmpty {
+			skip, err = skipFilled(ds, tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		for i, f := range list {
+			created, err := fixtures.LoadSkipTx(f, ds, tx, refs, skip)
+			n += created
+			if err != nil {
+				return fmt.Errorf("failed to load fixtures file %q: %w", files[i], err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return refs, n, nil
+}
+
+// skipFilled returns the Skip of the buckets of the given data layer that
+// are not empty.
+func skipFilled(ds *graphql.DataService, tx db.Tx) (*fixtures.Skip, error) {
+	skip := fixtures.Skip{Buckets: map[string]bool{}}
+	one := 1
+	for _, ser := range Services(ds) {
+		list, err := tx.Database().GetAll(&one, nil, ser, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check if bucket %q is empty: %w",
+				ser.Bucket(), err)
+		}
+		if len(list) > 0 {
+			skip.Buckets[ser.Bucket()] = true
+		}
+	}
+	return &skip, nil
+}
@@ -0,0 +1,81 @@
+package naos_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/naos"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// TestSeedEmpty tests that a directory of fixtures files is loaded only into
+// the empty buckets, skipping the entities that refer to those of the rest.
+func TestSeedEmpty(t *testing.T) {
+	ds, _, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	dir, err := ioutil.TempDir("", "naosseed")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"01-people.json": `{"Person": [{"ref": "ed", "Names": [{"String": "Ed"}]}]}`,
+		"02-media.yml": `
+Media:
+  - ref: samurai
+    Titles: [{String: Samurai Champloo, Language: en}]
+MediaCharacter:
+  - MediaID: $samurai
+    PersonID: $ed
+Character:
+  - ref: ein
+    Names: [{String: Ein}]
+`,
+		"README.md": "not fixtures",
+	}
+	for name, content := range files {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("failed to write fixtures file: %v", err)
+		}
+	}
+
+	n, err := naos.SeedEmpty(ds, dir)
+	if err != nil {
+		t.Fatalf("failed to seed database: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected the Person and Character to be created, got %d entities", n)
+	}
+
+	err = ds.Database.Transaction(false, func(tx db.Tx) error {
+		media, err := ds.MediaService.GetAll(nil, nil, tx)
+		if err != nil {
+			return err
+		}
+		if len(media) != 2 {
+			t.Errorf("expected the Media to be skipped, got %d Media", len(media))
+		}
+		mcs, err := ds.MediaCharacterService.GetAll(nil, nil, tx)
+		if err != nil {
+			return err
+		}
+		if len(mcs) != 0 {
+			t.Errorf("expected the MediaCharacter to be skipped, got %d", len(mcs))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to list entities: %v", err)
+	}
+
+	n, err = naos.SeedEmpty(ds, dir)
+	if err != nil || n != 0 {
+		t.Errorf("expected seeding again to create nothing, got %d, %v", n, err)
+	}
+}
@@ -0,0 +1,74 @@
+package naos
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// UserSettings is the request and response body of the settings of a User.
+type UserSettings struct {
+	ScoreFormat models.ScoreFormat `json:"scoreFormat"`
+}
+
+// NewSettingsHandler returns an endpoint handler for the settings of the
+// User given by the id path variable. GET requests return the settings and
+// PUT requests replace them with those in the request body if update is
+// true. Only the User and Admins may view or change them.
+func NewSettingsHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator, update bool,
+) web.Handler {
+	method := http.MethodGet
+	if update {
+		method = http.MethodPut
+	}
+
+	return web.Handler{
+		Method: method,
+		Path:   path,
+		DryRun: update,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			uID, _, ok := authorizeLibraryOwner(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+			var req UserSettings
+			if update && !parseRequestBody(w, r, &req) {
+				return
+			}
+
+			var settings UserSettings
+			err := ds.Database.TransactionContext(r.Context(), update, func(tx db.Tx) error {
+				u, err := ds.UserService.GetByID(uID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get User by ID %d: %w", uID, err)
+				}
+
+				if update {
+					u.ScoreFormat = req.ScoreFormat
+					err = ds.UserService.Update(u, tx)
+					if err != nil {
+						return fmt.Errorf("failed to update User with ID %d: %w", uID, err)
+					}
+				}
+				settings = UserSettings{ScoreFormat: u.ScoreFormat}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(settings, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
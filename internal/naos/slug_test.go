@@ -0,0 +1,96 @@
+package naos_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestSlugs tests that Slugs are generated from Titles and told apart from
+// those of other entities, kept through updates, and looked up by.
+func TestSlugs(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		bebop, err := ds.MediaService.GetByID(refs["bebop"], tx)
+		if err != nil {
+			return err
+		}
+		if bebop.Slug != "cowboy-bebop" {
+			t.Errorf("expected slug %q, got %q", "cowboy-bebop", bebop.Slug)
+		}
+
+		titles := []models.Title{
+			{String: "カウボーイビバップ", Language: "ja"},
+			{String: "Cowboy Bebop!", Language: "en"},
+		}
+		remakeID, err := ds.MediaService.Create(&models.Media{Titles: titles}, tx)
+		if err != nil {
+			return err
+		}
+		remake, err := ds.MediaService.GetBySlug("cowboy-bebop-2", tx)
+		if err != nil {
+			return err
+		}
+		if remake.Meta.ID != remakeID {
+			t.Errorf("expected Media %d by slug, got %d", remakeID, remake.Meta.ID)
+		}
+
+		// Slugs are kept if not given, and may be changed
+		remake.Slug = ""
+		remake.Titles = titles[:1]
+		err = ds.MediaService.Update(remake, tx)
+		if err != nil || remake.Slug != "cowboy-bebop-2" {
+			t.Errorf("expected slug to be kept, got %q, %v", remake.Slug, err)
+		}
+		remake.Slug = "Cowboy Bebop (2021)"
+		err = ds.MediaService.Update(remake, tx)
+		if err != nil {
+			return err
+		}
+		_, err = ds.MediaService.GetBySlug("cowboy-bebop-2021", tx)
+		if err != nil {
+			return err
+		}
+		_, err = ds.MediaService.GetBySlug("cowboy-bebop-2", tx)
+		if !errors.Is(err, data.ErrNotFound) {
+			t.Errorf("expected old slug to be freed, got %v", err)
+		}
+
+		remake.Slug = bebop.Slug
+		err = ds.MediaService.Update(remake, tx)
+		if !errors.Is(err, data.ErrConflict) {
+			t.Errorf("expected taken slug to conflict, got %v", err)
+		}
+
+		// Slugs are only unique among entities of the same type
+		personID, err := ds.PersonService.Create(&models.Person{
+			Names: []models.Title{{String: "Cowboy Bebop", Language: "en"}},
+		}, tx)
+		if err != nil {
+			return err
+		}
+		p, err := ds.PersonService.GetBySlug("cowboy-bebop", tx)
+		if err != nil || p.Meta.ID != personID {
+			t.Errorf("expected Person %d by slug, got %v", personID, err)
+		}
+
+		err = ds.MediaService.Delete(bebop.Meta.ID, tx)
+		if err != nil {
+			return err
+		}
+		_, err = ds.MediaService.GetBySlug("cowboy-bebop", tx)
+		if !errors.Is(err, data.ErrNotFound) {
+			t.Errorf("expected slug of deleted Media to be freed, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to persist entities: %v", err)
+	}
+}
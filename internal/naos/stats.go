@@ -0,0 +1,132 @@
+package naos
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// NewHeatmapHandler returns a GET endpoint handler that reports the number of
+// Episodes the User given by the id path variable watched on each day of the
+// year given by the year query parameter, the current year by default. Days
+// are in the time zone given by the tz query parameter, UTC by default.
+// Callers other than the User may view it if the User's stats are visible to
+// them.
+func NewHeatmapHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			uID, _, ok := authorizeLibraryView(w, r, ps, ds, au, models.PrivacyStats)
+			if !ok {
+				return
+			}
+			loc, err := parseQueryLocation(r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+				return
+			}
+			year := time.Now().In(loc).Year()
+			y, err := web.ParseQueryInt("year", r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+				return
+			}
+			if y != nil {
+				year = *y
+			}
+
+			var hm *models.Heatmap
+			err = ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				hm, err = ds.StatsService.Heatmap(uID, year, loc, tx)
+				if err != nil {
+					return fmt.Errorf("failed to compute heatmap of User with ID %d: %w",
+						uID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(hm, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewWrapupHandler returns a GET endpoint handler that summarizes the
+// watching of the User given by the id path variable over the year given by
+// the year path variable, with days in the time zone given by the tz query
+// parameter, UTC by default. Callers other than the User may view it if the
+// User's stats are visible to them.
+func NewWrapupHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			uID, _, ok := authorizeLibraryView(w, r, ps, ds, au, models.PrivacyStats)
+			if !ok {
+				return
+			}
+			year, err := web.ParsePathVarInt("year", &ps)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorPathVariableParsing, err, w)
+				return
+			}
+			loc, err := parseQueryLocation(r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+				return
+			}
+
+			var wu *models.Wrapup
+			err = ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				wu, err = ds.StatsService.Wrapup(uID, year, loc, tx)
+				if err != nil {
+					return fmt.Errorf("failed to compute wrap-up of User with ID %d: %w",
+						uID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(wu, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// parseQueryLocation returns the time zone given by its IANA name in the tz
+// query parameter, or UTC if not present.
+func parseQueryLocation(r *http.Request) (*time.Location, error) {
+	name := r.URL.Query().Get("tz")
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("query parameter %q: %v: %w", "tz", err, data.ErrInvalid)
+	}
+	return loc, nil
+}
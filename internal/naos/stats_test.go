@@ -0,0 +1,120 @@
+package naos_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestHeatmapAndWrapup tests that the Episodes of watch sessions are counted
+// on the days they started in, and that the wrap-up of a year counts the
+// hours, longest streak and top Genres of the sessions in it.
+func TestHeatmapAndWrapup(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	uID := refs["spike"]
+	day := func(month time.Month, d int, hour int) time.Time {
+		return time.Date(2020, month, d, hour, 0, 0, 0, time.UTC)
+	}
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		minutes := 24
+		eps := make([]int, 3)
+		for i := range eps {
+			var err error
+			eps[i], err = ds.EpisodeService.Create(&models.Episode{Duration: &minutes}, tx)
+			if err != nil {
+				return err
+			}
+		}
+		movie, err := ds.UserMediaService.Create(&models.UserMedia{
+			UserID: uID, MediaID: refs["movie"],
+		}, tx)
+		if err != nil {
+			return err
+		}
+
+		for _, ws := range []models.WatchSession{
+			{MediaID: refs["bebop"], UserMediaID: refs["watching"],
+				Start: day(4, 1, 20), End: day(4, 1, 21), Episodes: eps[:2]},
+			{MediaID: refs["bebop"], UserMediaID: refs["watching"],
+				Start: day(4, 2, 23), End: day(4, 3, 1), Episodes: eps[2:]},
+			{MediaID: refs["bebop"], UserMediaID: refs["watching"],
+				Start: day(4, 4, 20), End: day(4, 4, 20), Episodes: eps[:1]},
+			{MediaID: refs["movie"], UserMediaID: movie,
+				Start: day(6, 1, 20), End: day(6, 1, 20).Add(100 * time.Minute)},
+			{MediaID: refs["bebop"], UserMediaID: refs["watching"],
+				Start: day(1, 1, 0).Add(-time.Hour), End: day(1, 1, 0).Add(-time.Hour),
+				Episodes: eps},
+		} {
+			ws.UserID = uID
+			_, err = ds.WatchSessionService.Create(&ws, tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		hm, err := ds.StatsService.Heatmap(uID, 2020, time.UTC, tx)
+		if err != nil {
+			return err
+		}
+		if len(hm.Days) != 366 || hm.Episodes != 5 {
+			t.Errorf("expected 5 Episodes over 366 days, got %d over %d",
+				hm.Episodes, len(hm.Days))
+		}
+		for _, d := range []struct {
+			date     time.Time
+			episodes int
+		}{
+			{day(4, 1, 0), 2}, {day(4, 2, 0), 1}, {day(4, 3, 0), 0}, {day(6, 1, 0), 1},
+		} {
+			hd := hm.Days[d.date.YearDay()-1]
+			if !hd.Date.Equal(d.date) || hd.Episodes != d.episodes {
+				t.Errorf("expected %d Episodes on %v, got %d on %v",
+					d.episodes, d.date, hd.Episodes, hd.Date)
+			}
+		}
+
+		// Days are in the given time zone
+		loc := time.FixedZone("UTC+5", 5*60*60)
+		hm, err = ds.StatsService.Heatmap(uID, 2020, loc, tx)
+		if err != nil {
+			return err
+		}
+		if hm.Episodes != 8 || hm.Days[0].Episodes != 3 {
+			t.Errorf("expected the session of New Year's Eve in UTC in the year, got %d",
+				hm.Episodes)
+		}
+		if hd := hm.Days[day(4, 3, 0).YearDay()-1]; hd.Episodes != 1 {
+			t.Errorf("expected the session past midnight in UTC+5 on %v, got %d Episodes",
+				hd.Date, hd.Episodes)
+		}
+
+		wu, err := ds.StatsService.Wrapup(uID, 2020, time.UTC, tx)
+		if err != nil {
+			return err
+		}
+		if wu.Episodes != 5 || wu.Media != 2 {
+			t.Errorf("expected 5 Episodes of 2 Media, got %d of %d", wu.Episodes, wu.Media)
+		}
+		if math.Abs(wu.Hours-(4*24+100)/60.0) > 1e-9 {
+			t.Errorf("expected %v hours, got %v", (4*24+100)/60.0, wu.Hours)
+		}
+		if s := wu.LongestStreak; s.Days != 2 ||
+			!s.Start.Equal(day(4, 1, 0)) || !s.End.Equal(day(4, 2, 0)) {
+			t.Errorf("expected a streak of 2 days from April 1, got %+v", s)
+		}
+		if len(wu.TopGenres) != 1 ||
+			wu.TopGenres[0] != (models.GenreCount{GenreID: refs["scifi"], Episodes: 4}) {
+			t.Errorf("expected 4 Episodes of Genre %d, got %+v", refs["scifi"], wu.TopGenres)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
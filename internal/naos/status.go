@@ -0,0 +1,105 @@
+package naos
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// CustomStatuses is the request and response body of the custom statuses of
+// a User.
+type CustomStatuses struct {
+	Statuses []models.CustomStatus `json:"statuses"`
+}
+
+// NewCustomStatusesHandler returns a GET endpoint handler that lists the
+// custom statuses of the User given by the id path variable, to those who may
+// view the lists of the User.
+func NewCustomStatusesHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			uID, _, ok := authorizeLibraryView(w, r, ps, ds, au, models.PrivacyLists)
+			if !ok {
+				return
+			}
+
+			var u *models.User
+			err := ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var err error
+				u, err = ds.UserService.GetByID(uID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get User by ID %d: %w", uID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			statuses := u.CustomStatuses
+			if statuses == nil {
+				statuses = []models.CustomStatus{}
+			}
+			web.EncodeResponseBody(CustomStatuses{Statuses: statuses}, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewCustomStatusesUpdateHandler returns a PUT endpoint handler that replaces
+// the custom statuses of the User given by the id path variable with those in
+// the request body, updating the UserMedia that have them to match. Only the
+// User and Admins may change them.
+func NewCustomStatusesUpdateHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPut,
+		Path:   path,
+		DryRun: true,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			uID, _, ok := authorizeLibraryOwner(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+			var req CustomStatuses
+			if !parseRequestBody(w, r, &req) {
+				return
+			}
+			if req.Statuses == nil {
+				req.Statuses = []models.CustomStatus{}
+			}
+
+			err := ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				_, err := ds.UserMediaService.SetCustomStatuses(uID, req.Statuses, tx)
+				if err != nil {
+					return fmt.Errorf("failed to set custom statuses of User with ID %d: %w",
+						uID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(req, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
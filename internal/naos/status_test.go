@@ -0,0 +1,94 @@
+package naos_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestCustomStatuses tests that UserMedia of custom statuses have the core
+// statuses they map to, that changing only the core status clears the custom
+// one, and that changes to the definitions are applied to the UserMedia.
+func TestCustomStatuses(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	uID := refs["spike"]
+	paused := "paused"
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		_, err := ds.UserMediaService.SetCustomStatuses(uID, []models.CustomStatus{
+			{Key: "paused", Label: "Paused", Color: "#ff8800", Status: models.WatchStatusHold},
+			{Key: "paused", Label: "Paused again", Status: models.WatchStatusHold},
+		}, tx)
+		if !errors.Is(err, data.ErrInvalid) {
+			t.Errorf("expected duplicate custom statuses to be invalid, got %v", err)
+		}
+		_, err = ds.UserMediaService.SetCustomStatuses(uID, []models.CustomStatus{
+			{Key: "paused", Label: "Paused", Color: "#ff8800", Status: models.WatchStatusHold},
+		}, tx)
+		if err != nil {
+			return err
+		}
+
+		status := func(expected models.WatchStatus, custom *string) {
+			t.Helper()
+			um, err := ds.UserMediaService.GetByID(refs["watching"], tx)
+			if err != nil {
+				t.Fatalf("failed to get UserMedia: %v", err)
+			}
+			if um.Status == nil || *um.Status != expected ||
+				(um.CustomStatus == nil) != (custom == nil) ||
+				(custom != nil && *um.CustomStatus != *custom) {
+				t.Errorf("expected status %v of custom status %v, got %v of %v",
+					expected, custom, um.Status, um.CustomStatus)
+			}
+		}
+
+		um, err := ds.UserMediaService.GetByID(refs["watching"], tx)
+		if err != nil {
+			return err
+		}
+		um.CustomStatus = &paused
+		err = ds.UserMediaService.Update(um, tx)
+		if err != nil {
+			return err
+		}
+		status(models.WatchStatusHold, &paused)
+
+		// Clients that know only the core statuses change them alone
+		current := models.WatchStatusCurrent
+		um.Status = &current
+		err = ds.UserMediaService.Update(um, tx)
+		if err != nil {
+			return err
+		}
+		status(models.WatchStatusCurrent, nil)
+
+		um.CustomStatus = &paused
+		err = ds.UserMediaService.Update(um, tx)
+		if err != nil {
+			return err
+		}
+		_, err = ds.UserMediaService.SetCustomStatuses(uID, []models.CustomStatus{
+			{Key: "paused", Label: "Paused", Status: models.WatchStatusDropped},
+		}, tx)
+		if err != nil {
+			return err
+		}
+		status(models.WatchStatusDropped, &paused)
+
+		_, err = ds.UserMediaService.SetCustomStatuses(uID, nil, tx)
+		if err != nil {
+			return err
+		}
+		status(models.WatchStatusDropped, nil)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to set custom statuses: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package naos
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// SyncRequest is the request body of a batch of changes pushed by a client.
+type SyncRequest struct {
+	Changes []*models.SyncChange `json:"changes"`
+}
+
+// NewSyncPushHandler returns a POST endpoint handler that applies the batch
+// of changes to the entities of the caller given in the request body, and
+// returns which were applied, which conflict with changes made since, and
+// which were rejected.
+func NewSyncPushHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			u, ok := loginCaller(w, r, ds, au)
+			if !ok {
+				return
+			}
+			var req SyncRequest
+			if !parseRequestBody(w, r, &req) {
+				return
+			}
+
+			var res *models.SyncResult
+			err := ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				var err error
+				res, err = ds.SyncService.Push(u, req.Changes, tx)
+				if err != nil {
+					return fmt.Errorf("failed to apply changes: %w", err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(res, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewSyncPullHandler returns a GET endpoint handler that lists the entities
+// of the caller changed after the since query parameter, with tombstones for
+// those deleted, from at most as many changes as the first query parameter.
+// All the entities of the caller are listed if since is not given.
+func NewSyncPullHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			u, ok := loginCaller(w, r, ds, au)
+			if !ok {
+				return
+			}
+			since, err := web.ParseQueryTime("since", r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+				return
+			}
+			first, err := web.ParseQueryInt("first", r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+				return
+			}
+
+			var pull *models.SyncPull
+			err = ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var err error
+				pull, err = ds.SyncService.Pull(u.Meta.ID, since, first, time.Now(), tx)
+				if err != nil {
+					return fmt.Errorf("failed to pull changes of User with ID %d: %w",
+						u.Meta.ID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(pull, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
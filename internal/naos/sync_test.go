@@ -0,0 +1,92 @@
+package naos_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestSync tests that pushed changes are applied unless based on outdated
+// versions, and that pulls list the entities changed since with tombstones
+// for those deleted.
+func TestSync(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	u := &models.User{Meta: db.ModelMetadata{ID: refs["spike"]}}
+	entity := func(uID int) []byte {
+		return []byte(fmt.Sprintf(`{"UserID":%d,"MediaID":%d}`, uID, refs["movie"]))
+	}
+	since := time.Now()
+
+	push := func(changes ...*models.SyncChange) *models.SyncResult {
+		var res *models.SyncResult
+		err := ds.Database.Transaction(true, func(tx db.Tx) error {
+			var err error
+			res, err = ds.SyncService.Push(u, changes, tx)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	pull := func() *models.SyncPull {
+		var p *models.SyncPull
+		err := ds.Database.Transaction(false, func(tx db.Tx) error {
+			var err error
+			p, err = ds.SyncService.Pull(u.Meta.ID, &since, nil, time.Now(), tx)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	res := push(
+		&models.SyncChange{Type: "UserMedia", Action: models.ChangeActionCreate,
+			Entity: entity(u.Meta.ID)},
+		&models.SyncChange{Type: "UserMedia", Action: models.ChangeActionCreate,
+			Entity: entity(u.Meta.ID + 1000)},
+	)
+	if len(res.Applied) != 1 || len(res.Rejected) != 1 || res.Rejected[0].Index != 1 {
+		t.Fatalf("expected the change to another User's entity rejected, got %+v", res)
+	}
+	id := res.Applied[0].ID
+
+	update := &models.SyncChange{Type: "UserMedia", ID: id, Action: models.ChangeActionUpdate,
+		BaseVersion: 0, Entity: entity(u.Meta.ID)}
+	res = push(update, update)
+	if len(res.Applied) != 1 || res.Applied[0].Version != 1 {
+		t.Errorf("expected the first update applied, got %+v", res.Applied)
+	}
+	if len(res.Conflicts) != 1 || res.Conflicts[0].Version != 1 {
+		t.Errorf("expected the second update to conflict with version 1, got %+v",
+			res.Conflicts)
+	}
+
+	p := pull()
+	if len(p.Entities) != 1 || p.Entities[0].ID != id || p.Entities[0].Deleted {
+		t.Errorf("expected UserMedia %d pulled, got %+v", id, p.Entities)
+	}
+
+	res = push(&models.SyncChange{Type: "UserMedia", ID: id, Action: models.ChangeActionDelete,
+		BaseVersion: 1})
+	if len(res.Applied) != 1 {
+		t.Errorf("expected the deletion applied, got %+v", res)
+	}
+	res = push(update)
+	if len(res.Conflicts) != 1 || !res.Conflicts[0].Deleted {
+		t.Errorf("expected the update to conflict with the deletion, got %+v", res)
+	}
+
+	p = pull()
+	if len(p.Entities) != 1 || !p.Entities[0].Deleted {
+		t.Errorf("expected a tombstone of UserMedia %d, got %+v", id, p.Entities)
+	}
+}
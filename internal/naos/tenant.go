@@ -0,0 +1,242 @@
+package naos
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/web"
+	log "github.com/sirupsen/logrus"
+)
+
+// Tenant is an isolated database served alongside the default one, with its
+// own data layer services and API, opened on the first request for it.
+type Tenant struct {
+	Name string
+	// Hosts are the hostnames of the requests served by the tenant, in lower
+	// case, and Prefix the path prefix.
+	Hosts  []string
+	Prefix string
+
+	config *Configuration
+	errs   *web.ErrorLog
+
+	mu      sync.Mutex
+	app     *Application
+	handler http.Handler
+}
+
+// Open returns the Application serving the database of the tenant, opening
+// it if not yet opened.
+func (t *Tenant) Open() (*Application, error) {
+	app, _, err := t.open()
+	return app, err
+}
+
+// open returns the Application serving the database of the tenant and its
+// HTTP handler, opening it if not yet opened.
+func (t *Tenant) open() (*Application, http.Handler, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.app != nil {
+		return t.app, t.handler, nil
+	}
+
+	log.WithFields(log.Fields{
+		"tenant": t.Name,
+	}).Info("Opening tenant")
+
+	err := os.MkdirAll(filepath.Dir(t.config.DB.Path), 0755)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create database directory: %w", err)
+	}
+	ds, err := newDataService(t.config, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	app, err := newApplication(t.config, ds, t.errs)
+	if err != nil {
+		ds.Database.Close()
+		return nil, nil, err
+	}
+	// Tenants run no schedulers but that of their staged imports
+	if app.ImportQueue != nil {
+		err = app.ImportQueue.Start()
+		if err != nil {
+			ds.Database.Close()
+			return nil, nil, err
+		}
+	}
+
+	t.handler = app.HTTPServer().Handler
+	t.app = app
+	return app, t.handler, nil
+}
+
+// prefixes returns true if the given request path is under the path prefix
+// of the tenant.
+func (t *Tenant) prefixes(path string) bool {
+	return t.Prefix != "" && (path == t.Prefix || strings.HasPrefix(path, t.Prefix+"/"))
+}
+
+// Opened returns true if the database of the tenant has been opened.
+func (t *Tenant) Opened() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.app != nil
+}
+
+// close closes the database of the tenant if opened.
+func (t *Tenant) close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.app == nil {
+		return nil
+	}
+	if t.app.ImportQueue != nil {
+		t.app.ImportQueue.Stop()
+	}
+	t.app.Scripts.Close()
+	err := t.app.DataLayer.Database.Close()
+	t.app, t.handler = nil, nil
+	return err
+}
+
+// Tenants is the registry of the tenants of a server, which selects the
+// tenant serving each request by its hostname, or else its path prefix.
+type Tenants struct {
+	byName   map[string]*Tenant
+	byHost   map[string]*Tenant
+	prefixed []*Tenant
+}
+
+// NewTenants returns the registry of the tenants in the given configuration,
+// whose logged errors are kept in the given ErrorLog. Tenant names must be
+// slugs, as they name database files, and their hostnames and path prefixes
+// must not be shared.
+func NewTenants(c *Configuration, errs *web.ErrorLog) (*Tenants, error) {
+	ts := Tenants{
+		byName: map[string]*Tenant{},
+		byHost: map[string]*Tenant{},
+	}
+	prefixes := map[string]string{}
+	for name, tc := range c.Tenants {
+		if name == "" || data.Slugify(name) != name {
+			return nil, fmt.Errorf("tenant %q: name must be a slug: %w", name, data.ErrInvalid)
+		}
+		prefix := strings.Trim(tc.Prefix, "/")
+		if len(tc.Hosts) == 0 && prefix == "" {
+			return nil, fmt.Errorf("tenant %q: %w", name, errors.New("no hosts or path prefix"))
+		}
+
+		conf, err := c.TenantConfiguration(name)
+		if err != nil {
+			return nil, err
+		}
+		t := Tenant{
+			Name:   name,
+			config: conf,
+			errs:   errs,
+		}
+		if prefix != "" {
+			t.Prefix = "/" + prefix
+		}
+		conf.pathPrefix = t.Prefix
+
+		for _, host := range tc.Hosts {
+			host = strings.ToLower(host)
+			if other, ok := ts.byHost[host]; ok {
+				return nil, fmt.Errorf("tenant %q: host %q is that of tenant %q: %w",
+					name, host, other.Name, data.ErrConflict)
+			}
+			ts.byHost[host] = &t
+			t.Hosts = append(t.Hosts, host)
+		}
+		if t.Prefix != "" {
+			if other, ok := prefixes[t.Prefix]; ok {
+				return nil, fmt.Errorf("tenant %q: prefix %q is that of tenant %q: %w",
+					name, t.Prefix, other, data.ErrConflict)
+			}
+			prefixes[t.Prefix] = name
+			ts.prefixed = append(ts.prefixed, &t)
+		}
+		ts.byName[name] = &t
+	}
+
+	// Match the longest prefixes first, as of nested tenants
+	sort.Slice(ts.prefixed, func(i, j int) bool {
+		return len(ts.prefixed[i].Prefix) > len(ts.prefixed[j].Prefix)
+	})
+	return &ts, nil
+}
+
+// Get returns the tenant of the given name, or nil if there is none.
+func (ts *Tenants) Get(name string) *Tenant {
+	return ts.byName[name]
+}
+
+// Select returns the tenant serving the given request, or nil if it is
+// served by the default database.
+func (ts *Tenants) Select(r *http.Request) *Tenant {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if t, ok := ts.byHost[strings.ToLower(host)]; ok {
+		return t
+	}
+
+	for _, t := range ts.prefixed {
+		if t.prefixes(r.URL.Path) {
+			return t
+		}
+	}
+	return nil
+}
+
+// Handler returns a HTTP handler that passes requests on to the tenants
+// serving them, without their path prefixes, opening their databases if not
+// yet opened, and the others on to the given handler.
+func (ts *Tenants) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := ts.Select(r)
+		if t == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		_, h, err := t.open()
+		if err != nil {
+			web.EncodeResponseErrorFor(web.ErrorInternalServer,
+				fmt.Errorf("failed to open tenant %q: %w", t.Name, err), w)
+			return
+		}
+		if t.prefixes(r.URL.Path) {
+			h = http.StripPrefix(t.Prefix, h)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Close closes the databases of the opened tenants. A nil Tenants has none.
+func (ts *Tenants) Close() error {
+	if ts == nil {
+		return nil
+	}
+
+	var first error
+	for _, t := range ts.byName {
+		err := t.close()
+		if err != nil && first == nil {
+			first = fmt.Errorf("failed to close tenant %q: %w", t.Name, err)
+		}
+	}
+	return first
+}
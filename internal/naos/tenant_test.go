@@ -0,0 +1,78 @@
+package naos_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/naos"
+	"github.com/Dophin2009/nao/internal/web"
+)
+
+// TestTenants tests that requests are served by the tenants of their
+// hostnames or path prefixes, which have databases of their own opened when
+// first used.
+func TestTenants(t *testing.T) {
+	dir, err := ioutil.TempDir("", "naostest")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var c naos.Configuration
+	c.DB.Path = filepath.Join(dir, "naos.db")
+	c.DB.Filemode = 0600
+	c.Tenants = map[string]naos.TenantConfig{
+		"anime": {Prefix: "c/anime/"},
+		"manga": {Hosts: []string{"Manga.example.com"}},
+	}
+	ts, err := naos.NewTenants(&c, web.NewErrorLog(0))
+	if err != nil {
+		t.Fatalf("failed to configure tenants: %v", err)
+	}
+	defer ts.Close()
+
+	selected := map[string]string{
+		"http://localhost/c/anime/graphql":      "anime",
+		"http://localhost/c/anime":              "anime",
+		"http://localhost/c/animation":          "",
+		"http://manga.example.com:8080/graphql": "manga",
+		"http://localhost/graphql":              "",
+	}
+	for url, name := range selected {
+		tenant := ts.Select(httptest.NewRequest("GET", url, nil))
+		if (tenant == nil && name != "") || (tenant != nil && tenant.Name != name) {
+			t.Errorf("expected %s to select tenant %q, got %+v", url, name, tenant)
+		}
+	}
+
+	if ts.Get("anime").Opened() {
+		t.Errorf("expected tenants to be opened when first used")
+	}
+
+	// Tenants have databases of their own, and only serve HTTP
+	c.GRPCPort = "9090"
+	tc, err := c.TenantConfiguration("anime")
+	if err != nil {
+		t.Fatalf("failed to get tenant configuration: %v", err)
+	}
+	path := filepath.Join(dir, "tenants", "anime.db")
+	if tc.DB.Path != path || tc.DB.Filemode != c.DB.Filemode || tc.GRPCPort != "" {
+		t.Errorf("expected database %s without gRPC, got %s, %q", path, tc.DB.Path, tc.GRPCPort)
+	}
+
+	c.Tenants["comics"] = naos.TenantConfig{Hosts: []string{"manga.example.com"}}
+	_, err = naos.NewTenants(&c, nil)
+	if !errors.Is(err, data.ErrConflict) {
+		t.Errorf("expected shared hostnames to conflict, got %v", err)
+	}
+	c.Tenants = map[string]naos.TenantConfig{"Anime!": {Prefix: "/anime"}}
+	_, err = naos.NewTenants(&c, nil)
+	if !errors.Is(err, data.ErrInvalid) {
+		t.Errorf("expected tenant names that are not slugs to be invalid, got %v", err)
+	}
+}
@@ -0,0 +1,203 @@
+package naos
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	json "github.com/json-iterator/go"
+	"github.com/julienschmidt/httprouter"
+)
+
+// DefaultTokenDuration is how long issued tokens are valid for if not
+// configured.
+const DefaultTokenDuration = time.Hour
+
+// TokenRequest is the request body of a login with username and password.
+type TokenRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Device is the name of the device logged in from, listed in the
+	// sessions of the User; defaults to the user agent of the request.
+	Device string `json:"device"`
+}
+
+// TokenResponse is the response body of an issued token.
+type TokenResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// NewTokenHandler returns a POST endpoint handler that issues a token to the
+// User with the username and password given in the request body.
+func NewTokenHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+	duration time.Duration,
+) web.Handler {
+	if duration <= 0 {
+		duration = DefaultTokenDuration
+	}
+
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			body, err := web.ReadRequestBody(r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorRequestBodyReading, err, w)
+				return
+			}
+			var req TokenRequest
+			err = json.Unmarshal(body, &req)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorRequestBodyParsing, err, w)
+				return
+			}
+
+			if !tokensConfigured(w, au) {
+				return
+			}
+
+			device := loginDevice(r, req.Device)
+			now := time.Now()
+			var ls *models.LoginSession
+			err = ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				err := ds.UserService.AuthenticateWithPassword(
+					req.Username, req.Password, tx)
+				if err != nil {
+					return err
+				}
+				u, err := ds.UserService.GetByUsername(req.Username, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get User by username %q: %w", req.Username, err)
+				}
+				ls, err = ds.LoginSessionService.Start(u.Meta.ID, device, requestIP(r),
+					now, now.Add(duration), tx)
+				return err
+			})
+			if errors.Is(err, data.ErrNotFound) {
+				// Don't reveal which usernames exist
+				err = fmt.Errorf("%v: %w", err, data.ErrUnauthorized)
+			}
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorAuthentication, err, w)
+				return
+			}
+
+			issueToken(w, req.Username, ls.Meta.ID, au, duration)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewTokenRefreshHandler returns a POST endpoint handler that exchanges the
+// unexpired token of the request for a new one of the same login session,
+// extending the session.
+func NewTokenRefreshHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+	duration time.Duration,
+) web.Handler {
+	if duration <= 0 {
+		duration = DefaultTokenDuration
+	}
+
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			if tknstr, _ := bearerToken(r); data.IsAPIKey(tknstr) {
+				web.EncodeResponseErrorFor(web.ErrorAuthentication,
+					fmt.Errorf("API keys are not exchanged for tokens: %w",
+						data.ErrUnauthorized), w)
+				return
+			}
+			u, err := RequestUser(r, ds, au)
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorAuthentication, err, w)
+				return
+			}
+			if u == nil {
+				web.EncodeResponseErrorUnauthorized(web.ErrorAuthentication,
+					errors.New("no credentials given"), w)
+				return
+			}
+
+			session := RequestSession(r, au)
+			if session != 0 {
+				now := time.Now()
+				err = ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+					_, err := ds.LoginSessionService.Use(session, u.Meta.ID, requestIP(r),
+						now, now.Add(duration), tx)
+					return err
+				})
+				if err != nil {
+					web.EncodeResponseErrorFor(web.ErrorAuthentication, err, w)
+					return
+				}
+			}
+
+			issueToken(w, u.Username, session, au, duration)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// maxDeviceLength is the length of the longest device name kept.
+const maxDeviceLength = 200
+
+// loginDevice returns the device name of a login with the given request,
+// defaulting to its user agent.
+func loginDevice(r *http.Request, device string) string {
+	if device == "" {
+		device = r.UserAgent()
+	}
+	if len(device) > maxDeviceLength {
+		device = device[:maxDeviceLength]
+	}
+	return device
+}
+
+// tokensConfigured checks if tokens can be issued, encoding an error response
+// if not.
+func tokensConfigured(w http.ResponseWriter, au *jwt.Authenticator) bool {
+	if au == nil {
+		web.EncodeResponseErrorFor(web.ErrorAuthentication,
+			fmt.Errorf("token authentication is not configured: %w",
+				data.ErrUnauthorized), w)
+		return false
+	}
+	return true
+}
+
+// issueToken encodes a response with a new token for the given username and
+// login session.
+func issueToken(
+	w http.ResponseWriter, username string, session int, au *jwt.Authenticator,
+	duration time.Duration,
+) {
+	if !tokensConfigured(w, au) {
+		return
+	}
+
+	tkn, exp, err := au.NewToken(username, session, duration)
+	if err != nil {
+		web.EncodeResponseErrorInternalServer(web.ErrorInternalServer, err, w)
+		return
+	}
+
+	web.EncodeResponseBody(TokenResponse{
+		Token:     tkn,
+		ExpiresAt: exp,
+	}, w)
+}
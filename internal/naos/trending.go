@@ -0,0 +1,138 @@
+package naos
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// DefaultTrendingLimit is the number of trending Media listed if not given.
+const DefaultTrendingLimit = 10
+
+// TrendingEntry is a single trending Media.
+type TrendingEntry struct {
+	Media *models.Media `json:"media"`
+	Trend *models.Trend `json:"trend"`
+}
+
+// Trending lists the most trending Media as of some time.
+type Trending struct {
+	Updated time.Time        `json:"updated"`
+	Media   []*TrendingEntry `json:"media"`
+}
+
+// NewTrendingHandler returns a GET endpoint handler that lists the Media
+// trending in the recent activity of Users, up to the number given by the
+// limit query parameter, with their Titles ordered for the Accept-Language
+// header.
+func NewTrendingHandler(path []string, ds *graphql.DataService) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			limit, err := web.ParseQueryInt("limit", r)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorQueryParameterParsing, err, w)
+				return
+			}
+			n := DefaultTrendingLimit
+			if limit != nil && *limit > 0 {
+				n = *limit
+			}
+
+			res := Trending{Media: []*TrendingEntry{}}
+			err = ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				// Deleted Media are dropped, so ask for extra to fill the limit
+				trends, updated, err := ds.TrendingService.Get(0, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get trending Media: %w", err)
+				}
+				res.Updated = updated
+				for _, t := range trends {
+					if len(res.Media) >= n {
+						break
+					}
+					md, err := ds.MediaService.GetByID(t.MediaID, tx)
+					if errors.Is(err, data.ErrNotFound) {
+						continue
+					}
+					if err != nil {
+						return fmt.Errorf("failed to get Media by ID %d: %w", t.MediaID, err)
+					}
+					res.Media = append(res.Media, &TrendingEntry{Media: md, Trend: t})
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			langs := models.ParseAcceptLanguage(r.Header.Get(web.HeaderAcceptLanguage))
+			for _, e := range res.Media {
+				e.Media.Titles = models.LocalizeTitles(e.Media.Titles, langs)
+			}
+			web.EncodeResponseBody(res, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// TrendingScheduler periodically recomputes the Media trending in the recent
+// activity of Users.
+type TrendingScheduler struct {
+	DataLayer *graphql.DataService
+	// Interval is the duration between runs.
+	Interval time.Duration
+	// OnError is called with the errors encountered while computing trends in
+	// the background.
+	OnError func(error)
+
+	sched schedule
+}
+
+// NewTrendingScheduler returns a TrendingScheduler for the given data layer.
+func NewTrendingScheduler(
+	ds *graphql.DataService, interval time.Duration, onError func(error),
+) *TrendingScheduler {
+	return &TrendingScheduler{
+		DataLayer: ds,
+		Interval:  interval,
+		OnError:   onError,
+	}
+}
+
+// Start computes the trends and begins recomputing them at every interval.
+func (s *TrendingScheduler) Start() error {
+	refresh := func(_ time.Time, now time.Time) error {
+		return s.DataLayer.Database.Transaction(false, func(tx db.Tx) error {
+			return s.DataLayer.TrendingService.Refresh(now, tx)
+		})
+	}
+	err := refresh(time.Time{}, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to compute trending Media: %w", err)
+	}
+
+	err = s.sched.start(s.Interval, refresh, s.OnError)
+	if err != nil {
+		return fmt.Errorf("failed to start trending scheduler: %w", err)
+	}
+	return nil
+}
+
+// Stop stops recomputing the trends and waits for a run in progress to
+// finish.
+func (s *TrendingScheduler) Stop() {
+	s.sched.halt()
+}
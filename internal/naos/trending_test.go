@@ -0,0 +1,64 @@
+package naos_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestTrending tests that trends count the recent additions, completions and
+// scores of Media, and only those in the window.
+func TestTrending(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		score := 80
+		_, err := ds.UserMediaService.Create(&models.UserMedia{
+			UserID: refs["spike"], MediaID: refs["movie"], Score: &score,
+		}, tx)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		err = ds.TrendingService.Refresh(now, tx)
+		if err != nil {
+			return err
+		}
+		list, updated, err := ds.TrendingService.Get(0, tx)
+		if err != nil {
+			return err
+		}
+		if !updated.Equal(now) || len(list) != 2 {
+			t.Fatalf("expected 2 trends as of %v, got %d as of %v", now, len(list), updated)
+		}
+		bebop, movie := list[0], list[1]
+		if bebop.MediaID != refs["bebop"] || bebop.Adds != 2 || bebop.Completions != 1 {
+			t.Errorf("expected bebop first with 2 adds and 1 completion, got %+v", bebop)
+		}
+		if movie.MediaID != refs["movie"] || movie.Adds != 1 || movie.Scores != 1 {
+			t.Errorf("expected movie with 1 add and 1 score, got %+v", movie)
+		}
+
+		err = ds.TrendingService.Refresh(now.Add(data.DefaultTrendingWindow+time.Hour), tx)
+		if err != nil {
+			return err
+		}
+		list, _, err = ds.TrendingService.Get(0, tx)
+		if err != nil {
+			return err
+		}
+		if len(list) != 0 {
+			t.Errorf("expected no trends after the window, got %d", len(list))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to compute trends: %v", err)
+	}
+}
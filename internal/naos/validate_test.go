@@ -0,0 +1,75 @@
+package naos_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/naos"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestValidateTags tests that the validate tags of models are checked on
+// creation, with the paths of nested properties, and that those of request
+// bodies report the first failing rule of each property.
+func TestValidateTags(t *testing.T) {
+	ds, _, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		_, err := ds.MediaService.Create(&models.Media{
+			Titles: []models.Title{
+				{String: "Trigun", Language: "en"},
+				{String: "トライガン", Language: "not a language"},
+			},
+		}, tx)
+		return err
+	})
+	checkFieldErrors(t, err, []data.FieldError{
+		{Path: "Titles[1].Language", Code: data.FieldInvalid},
+	})
+
+	err = ds.Database.Transaction(true, func(tx db.Tx) error {
+		_, err := ds.CharacterService.Create(&models.Character{
+			Images: []string{"https://example.com/vash.png", "ftp://example.com/vash.png"},
+		}, tx)
+		return err
+	})
+	checkFieldErrors(t, err, []data.FieldError{
+		{Path: "Images[1]", Code: data.FieldInvalid},
+	})
+
+	var verr data.ValidationError
+	data.ValidateTags(&naos.MediaAliasRequest{
+		Title: strings.Repeat("a", 256), Language: "xx-!",
+	}, &verr)
+	data.ValidateTags(&naos.PersistedQueriesRequest{Queries: []string{"{ a }", " "}}, &verr)
+	data.ValidateTags(&naos.ReportRequest{Reason: "spam"}, &verr)
+	checkFieldErrors(t, verr.Err(), []data.FieldError{
+		{Path: "Title", Code: data.FieldOutOfRange},
+		{Path: "Language", Code: data.FieldInvalid},
+		{Path: "Queries[1]", Code: data.FieldRequired},
+		{Path: "TargetID", Code: data.FieldRequired},
+	})
+}
+
+// checkFieldErrors checks that the given error is a ValidationError with the
+// given field errors, in order.
+func checkFieldErrors(t *testing.T, err error, expected []data.FieldError) {
+	t.Helper()
+	var verr *data.ValidationError
+	if !errors.As(err, &verr) || !errors.Is(err, data.ErrInvalid) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	if len(verr.Fields) != len(expected) {
+		t.Fatalf("expected %d field errors, got %+v", len(expected), verr.Fields)
+	}
+	for i, f := range verr.Fields {
+		if f.Path != expected[i].Path || f.Code != expected[i].Code || f.Message == "" {
+			t.Errorf("expected field error %+v, got %+v", expected[i], f)
+		}
+	}
+}
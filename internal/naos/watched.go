@@ -0,0 +1,199 @@
+package naos
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/jwt"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/julienschmidt/httprouter"
+)
+
+// MarkWatchedRequest is the request body of marking Episodes of some Media
+// watched.
+type MarkWatchedRequest struct {
+	// UpTo marks the first UpTo regular Episodes watched.
+	UpTo int `json:"upTo"`
+	// EpisodeIDs are the IDs of further Episodes marked watched, counted as
+	// rewatched if already watched.
+	EpisodeIDs []int `json:"episodeIDs"`
+	// Time is the time the Episodes were watched; defaults to the time the
+	// request was received.
+	Time *time.Time `json:"time"`
+}
+
+// WatchedResponse is the response body of the watch states of the Episodes
+// of some Media.
+type WatchedResponse struct {
+	// UserMedia is nil if the User has no UserMedia of the Media.
+	UserMedia *models.UserMedia
+	Episodes  []*models.UserEpisode
+}
+
+// NewWatchedHandler returns a GET endpoint handler that lists the watch
+// states of the Episodes of the Media given by the mediaID path variable by
+// the User given by the id path variable, regular Episodes in watch order
+// followed by specials.
+func NewWatchedHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodGet,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			uID, u, ok := authorizeLibraryView(w, r, ps, ds, au, models.PrivacyLists)
+			if !ok {
+				return
+			}
+			mID, err := web.ParsePathVarInt("mediaID", &ps)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorPathVariableParsing, err, w)
+				return
+			}
+
+			var res WatchedResponse
+			err = ds.Database.TransactionContext(r.Context(), false, func(tx db.Tx) error {
+				var err error
+				res.Episodes, err = ds.UserEpisodeService.GetByUserMediaAs(u, uID, mID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to get watch states of Media with ID %d: %w",
+						mID, err)
+				}
+				list, err := ds.UserMediaService.GetFilter(nil, nil, tx,
+					func(um *models.UserMedia) bool {
+						return um.UserID == uID && um.MediaID == mID
+					})
+				if err != nil {
+					return fmt.Errorf("failed to get UserMedia of Media with ID %d: %w",
+						mID, err)
+				}
+				if len(list) > 0 {
+					res.UserMedia = list[0]
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(res, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewMarkWatchedHandler returns a POST endpoint handler that marks Episodes
+// of the Media given by the mediaID path variable watched by the User given
+// by the id path variable, and records the progress derived from them in the
+// latest watch of their UserMedia. Only the User may mark their Episodes.
+func NewMarkWatchedHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodPost,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			uID, u, ok := authorizeLibraryOwner(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+			mID, err := web.ParsePathVarInt("mediaID", &ps)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorPathVariableParsing, err, w)
+				return
+			}
+			var req MarkWatchedRequest
+			if !parseRequestBody(w, r, &req) {
+				return
+			}
+
+			mk := models.EpisodeMark{
+				UserID:     uID,
+				MediaID:    mID,
+				UpTo:       req.UpTo,
+				EpisodeIDs: req.EpisodeIDs,
+				Time:       time.Now(),
+			}
+			if req.Time != nil {
+				mk.Time = *req.Time
+			}
+
+			var res WatchedResponse
+			err = ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				var err error
+				res.UserMedia, res.Episodes, err = ds.UserEpisodeService.MarkWatchedAs(u, &mk, tx)
+				if err != nil {
+					return fmt.Errorf("failed to mark Episodes of Media with ID %d watched: %w",
+						mID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(res, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
+
+// NewMarkUnwatchedHandler returns a DELETE endpoint handler that marks the
+// Episode given by the episodeID path variable of the Media given by the
+// mediaID path variable unwatched by the User given by the id path variable.
+// Only the User may mark their Episodes.
+func NewMarkUnwatchedHandler(
+	path []string, ds *graphql.DataService, au *jwt.Authenticator,
+) web.Handler {
+	return web.Handler{
+		Method: http.MethodDelete,
+		Path:   path,
+		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+			uID, u, ok := authorizeLibraryOwner(w, r, ps, ds, au)
+			if !ok {
+				return
+			}
+			mID, err := web.ParsePathVarInt("mediaID", &ps)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorPathVariableParsing, err, w)
+				return
+			}
+			epID, err := web.ParsePathVarInt("episodeID", &ps)
+			if err != nil {
+				web.EncodeResponseErrorBadRequest(web.ErrorPathVariableParsing, err, w)
+				return
+			}
+
+			var res WatchedResponse
+			err = ds.Database.TransactionContext(r.Context(), true, func(tx db.Tx) error {
+				var err error
+				res.UserMedia, res.Episodes, err =
+					ds.UserEpisodeService.MarkUnwatchedAs(u, uID, mID, epID, tx)
+				if err != nil {
+					return fmt.Errorf("failed to mark Episode with ID %d unwatched: %w",
+						epID, err)
+				}
+				return nil
+			})
+			if err != nil {
+				web.EncodeResponseErrorFor(web.ErrorInternalServer, err, w)
+				return
+			}
+
+			web.EncodeResponseBody(res, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+}
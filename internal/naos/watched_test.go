@@ -0,0 +1,96 @@
+package naos_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// TestMarkWatched tests that marking Episodes watched records their states
+// and rewatches, and that the progress of the UserMedia is derived from them.
+func TestMarkWatched(t *testing.T) {
+	ds, refs, cleanup := naostest.NewDataService(t, "testdata/library.yml")
+	defer cleanup()
+
+	owner := &models.User{Meta: db.ModelMetadata{ID: refs["spike"]}}
+	start := time.Date(2020, 4, 1, 20, 0, 0, 0, time.UTC)
+	err := ds.Database.Transaction(true, func(tx db.Tx) error {
+		mID, err := ds.MediaService.Create(&models.Media{
+			Titles: []models.Title{{String: "Samurai Champloo", Language: "en"}},
+		}, tx)
+		if err != nil {
+			return err
+		}
+		eps := make([]int, 3)
+		for i := range eps {
+			eps[i], err = ds.EpisodeService.Create(&models.Episode{}, tx)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = ds.EpisodeSetService.Create(&models.EpisodeSet{
+			MediaID: mID, Episodes: eps,
+		}, tx)
+		if err != nil {
+			return err
+		}
+
+		uID := owner.Meta.ID
+		um, states, err := ds.UserEpisodeService.MarkWatchedAs(owner, &models.EpisodeMark{
+			UserID: uID, MediaID: mID, UpTo: 2, Time: start,
+		}, tx)
+		if err != nil {
+			return err
+		}
+		if um == nil || len(um.WatchInstances) != 1 || um.WatchInstances[0].Episodes != 2 {
+			t.Fatalf("expected a watch of 2 episodes, got %+v", um)
+		}
+		if len(states) != 3 || !states[0].Watched || !states[1].Watched || states[2].Watched {
+			t.Fatalf("expected first 2 of 3 episodes watched, got %+v", states)
+		}
+
+		um, states, err = ds.UserEpisodeService.MarkWatchedAs(owner, &models.EpisodeMark{
+			UserID: uID, MediaID: mID, UpTo: 1, EpisodeIDs: []int{eps[0], eps[2]},
+			Time: start.Add(time.Hour),
+		}, tx)
+		if err != nil {
+			return err
+		}
+		if states[0].Rewatches != 1 || states[1].Rewatches != 0 {
+			t.Errorf("expected only first episode rewatched, got %d and %d",
+				states[0].Rewatches, states[1].Rewatches)
+		}
+		if !states[0].LastWatched.Equal(start.Add(time.Hour)) ||
+			!states[0].FirstWatched.Equal(start) {
+			t.Errorf("expected first episode watched at %v and %v, got %v and %v",
+				start, start.Add(time.Hour), states[0].FirstWatched, states[0].LastWatched)
+		}
+		if um.Status == nil || *um.Status != models.WatchStatusCompleted {
+			t.Errorf("expected status %v, got %v", models.WatchStatusCompleted, um.Status)
+		}
+
+		um, _, err = ds.UserEpisodeService.MarkUnwatchedAs(owner, uID, mID, eps[2], tx)
+		if err != nil {
+			return err
+		}
+		latest := um.WatchInstances[len(um.WatchInstances)-1]
+		if latest.Episodes != 2 || !latest.Ongoing ||
+			um.Status == nil || *um.Status != models.WatchStatusCurrent {
+			t.Errorf("expected ongoing watch of 2 episodes, got %+v", latest)
+		}
+
+		_, _, err = ds.UserEpisodeService.MarkWatchedAs(&models.User{}, &models.EpisodeMark{
+			UserID: uID, MediaID: mID, UpTo: 1, Time: start,
+		}, tx)
+		if err == nil {
+			t.Errorf("expected others not to mark episodes of the User")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to mark episodes: %v", err)
+	}
+}
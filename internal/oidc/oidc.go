@@ -0,0 +1,254 @@
+// Package oidc implements the client side of the OpenID Connect authorization
+// code flow, through which Users log in with external identity providers.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	json "github.com/json-iterator/go"
+)
+
+// discoveryPath is the path of the provider configuration document relative
+// to the issuer.
+const discoveryPath = "/.well-known/openid-configuration"
+
+// DefaultScopes are the scopes requested if none are configured.
+var DefaultScopes = []string{"openid", "profile", "email"}
+
+// ErrInvalidToken is returned when an ID token fails verification.
+var ErrInvalidToken = errors.New("invalid ID token")
+
+// Config configures a Provider.
+type Config struct {
+	// Issuer is the URL identifying the provider, from which its
+	// configuration is discovered.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the address the provider sends Users back to with the
+	// authorization code.
+	RedirectURL string
+	// Scopes are the scopes requested; "openid" is always included.
+	Scopes []string
+}
+
+// Discovery is the part of the configuration document of a provider that is
+// used.
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is an OpenID Connect identity provider. Its configuration is
+// discovered on first use. It is safe for concurrent use.
+type Provider struct {
+	Config     Config
+	HTTPClient *http.Client
+
+	mu        sync.Mutex
+	discovery *Discovery
+	keys      *keySet
+}
+
+// NewProvider returns a Provider with the given configuration.
+func NewProvider(c Config) *Provider {
+	if len(c.Scopes) == 0 {
+		c.Scopes = DefaultScopes
+	}
+	return &Provider{
+		Config:     c,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Discover returns the configuration document of the provider, fetching it
+// if it has not been.
+func (p *Provider) Discover(ctx context.Context) (*Discovery, error) {
+	p.mu.Lock()
+	d := p.discovery
+	p.mu.Unlock()
+	if d != nil {
+		return d, nil
+	}
+
+	issuer := strings.TrimSuffix(p.Config.Issuer, "/")
+	var disc Discovery
+	err := p.getJSON(ctx, issuer+discoveryPath, &disc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get provider configuration: %w", err)
+	}
+	if strings.TrimSuffix(disc.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("provider configuration: issuer %q does not match %q",
+			disc.Issuer, p.Config.Issuer)
+	}
+	if disc.AuthorizationEndpoint == "" || disc.TokenEndpoint == "" ||
+		disc.JWKSURI == "" {
+		return nil, errors.New("provider configuration: missing endpoints")
+	}
+
+	p.mu.Lock()
+	p.discovery = &disc
+	p.mu.Unlock()
+	return &disc, nil
+}
+
+// AuthCodeURL returns the address of the login page of the provider, which
+// sends Users back to the redirect URL with the given state and an ID token
+// bound to the given nonce.
+func (p *Provider) AuthCodeURL(ctx context.Context, state string, nonce string) (string, error) {
+	d, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	scopes := p.Config.Scopes
+	if !containsString(scopes, "openid") {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.Config.ClientID)
+	q.Set("redirect_uri", p.Config.RedirectURL)
+	q.Set("scope", strings.Join(scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// tokenResponse is the response body of the token endpoint.
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange redeems the given authorization code at the token endpoint and
+// returns the claims of the verified ID token, which must be bound to the
+// given nonce.
+func (p *Provider) Exchange(
+	ctx context.Context, code string, nonce string,
+) (*Claims, error) {
+	d, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.Config.RedirectURL)
+	req, err := http.NewRequest(http.MethodPost, d.TokenEndpoint,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.Config.ClientID),
+		url.QueryEscape(p.Config.ClientSecret))
+
+	res, err := p.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request token: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	var tr tokenResponse
+	err = json.Unmarshal(body, &tr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token response: %w", err)
+	}
+	if tr.Error != "" {
+		return nil, fmt.Errorf("token endpoint: %s: %s", tr.Error, tr.ErrorDescription)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint responded with status %d", res.StatusCode)
+	}
+	if tr.IDToken == "" {
+		return nil, fmt.Errorf("token response: no ID token: %w", ErrInvalidToken)
+	}
+
+	return p.Verify(ctx, tr.IDToken, nonce, time.Now())
+}
+
+// NewState returns a random value for the state and nonce parameters of
+// logins.
+func NewState() (string, error) {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate state: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// maxResponseSize is the size of the largest response body read from
+// providers.
+const maxResponseSize = 1 << 20
+
+func (p *Provider) getJSON(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+
+	res, err := p.client().Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with status %d", u, res.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	err = json.Unmarshal(body, v)
+	if err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+func (p *Provider) client() *http.Client {
+	if p.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return p.HTTPClient
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
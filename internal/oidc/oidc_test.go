@@ -0,0 +1,86 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/oidc"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// TestExchange tests that authorization codes are exchanged for the claims of
+// ID tokens signed by the provider and bound to the nonce of the login.
+func TestExchange(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	var srv *httptest.Server
+	nonce := "n-0S6_WzA2Mj"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintf(w, `{"issuer":%q,"authorization_endpoint":%q,"token_endpoint":%q,"jwks_uri":%q}`,
+			srv.URL, srv.URL+"/authorize", srv.URL+"/token", srv.URL+"/keys")
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintf(w, `{"keys":[{"kty":"RSA","kid":"k1","use":"sig","n":%q,"e":%q}]}`,
+			base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()))
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, _ := r.BasicAuth(); id != "naos" || secret != "hunter2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"invalid_client"}`)
+			return
+		}
+		tkn := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            srv.URL,
+			"aud":            []string{"naos"},
+			"sub":            "248289761001",
+			"exp":            time.Now().Add(time.Hour).Unix(),
+			"nonce":          r.FormValue("code"),
+			"email":          "spike@bebop.test",
+			"email_verified": true,
+		})
+		tkn.Header["kid"] = "k1"
+		s, err := tkn.SignedString(key)
+		if err != nil {
+			t.Errorf("failed to sign token: %v", err)
+		}
+		fmt.Fprintf(w, `{"id_token":%q}`, s)
+	})
+	srv = httptest.NewServer(mux)
+	defer srv.Close()
+
+	p := oidc.NewProvider(oidc.Config{
+		Issuer:       srv.URL,
+		ClientID:     "naos",
+		ClientSecret: "hunter2",
+		RedirectURL:  "https://naos.test/login",
+	})
+	ctx := context.Background()
+	// The test provider binds ID tokens to the code as the nonce
+	claims, err := p.Exchange(ctx, nonce, nonce)
+	if err != nil {
+		t.Fatalf("failed to exchange code: %v", err)
+	}
+	if claims.Subject != "248289761001" || claims.Email != "spike@bebop.test" ||
+		!claims.EmailVerified {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	_, err = p.Exchange(ctx, nonce, "replayed")
+	if !errors.Is(err, oidc.ErrInvalidToken) {
+		t.Errorf("expected token with other nonce to be invalid, got %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// clockSkew is the difference allowed between the clocks of the server
+	// and providers when checking the times of ID tokens.
+	clockSkew = time.Minute
+	// keyRefreshInterval is the shortest time between fetches of the keys of
+	// a provider prompted by ID tokens signed with unknown keys.
+	keyRefreshInterval = time.Minute
+)
+
+// Claims are the claims of a verified ID token identifying a User.
+type Claims struct {
+	Issuer string
+	// Subject identifies the User at the issuer.
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+}
+
+// keySet is the signing keys of a provider by their key ID.
+type keySet struct {
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+// jwk is a JSON web key; only RSA keys are used.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// Verify checks the signature, issuer, audience, expiry and nonce of the
+// given ID token at the given time and returns its claims.
+func (p *Provider) Verify(
+	ctx context.Context, idToken string, nonce string, now time.Time,
+) (*Claims, error) {
+	d, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := jwt.Parser{
+		ValidMethods:         []string{jwt.SigningMethodRS256.Alg()},
+		SkipClaimsValidation: true,
+	}
+	mc := jwt.MapClaims{}
+	_, err = parser.ParseWithClaims(idToken, mc, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, ErrInvalidToken)
+	}
+
+	iss, _ := mc["iss"].(string)
+	if iss != d.Issuer {
+		return nil, fmt.Errorf("issuer %q: %w", iss, ErrInvalidToken)
+	}
+	if !hasAudience(mc["aud"], p.Config.ClientID) {
+		return nil, fmt.Errorf("audience: %w", ErrInvalidToken)
+	}
+	exp, ok := mc["exp"].(float64)
+	if !ok || now.Add(-clockSkew).After(time.Unix(int64(exp), 0)) {
+		return nil, fmt.Errorf("expired: %w", ErrInvalidToken)
+	}
+	if iat, ok := mc["iat"].(float64); ok &&
+		now.Add(clockSkew).Before(time.Unix(int64(iat), 0)) {
+		return nil, fmt.Errorf("issued in the future: %w", ErrInvalidToken)
+	}
+	if n, _ := mc["nonce"].(string); n != nonce {
+		return nil, fmt.Errorf("nonce: %w", ErrInvalidToken)
+	}
+
+	c := Claims{Issuer: iss}
+	c.Subject, _ = mc["sub"].(string)
+	if c.Subject == "" {
+		return nil, fmt.Errorf("no subject: %w", ErrInvalidToken)
+	}
+	c.Email, _ = mc["email"].(string)
+	c.EmailVerified, _ = mc["email_verified"].(bool)
+	c.PreferredUsername, _ = mc["preferred_username"].(string)
+	c.Name, _ = mc["name"].(string)
+	return &c, nil
+}
+
+// key returns the signing key of the provider with the given ID, fetching the
+// keys again if it is unknown, so that rotated keys are picked up.
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	ks := p.keys
+	p.mu.Unlock()
+
+	if ks != nil {
+		if k := ks.find(kid); k != nil {
+			return k, nil
+		}
+		if time.Since(ks.fetchedAt) < keyRefreshInterval {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+	}
+
+	ks, err := p.fetchKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.keys = ks
+	p.mu.Unlock()
+
+	if k := ks.find(kid); k != nil {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// find returns the key with the given ID, or the only key if no ID is given.
+func (ks *keySet) find(kid string) *rsa.PublicKey {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, k := range ks.keys {
+			return k
+		}
+	}
+	return ks.keys[kid]
+}
+
+func (p *Provider) fetchKeys(ctx context.Context) (*keySet, error) {
+	d, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	err = p.getJSON(ctx, d.JWKSURI, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get signing keys: %w", err)
+	}
+
+	ks := keySet{
+		keys:      map[string]*rsa.PublicKey{},
+		fetchedAt: time.Now(),
+	}
+	for _, k := range doc.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		pub, err := k.rsaKey()
+		if err != nil {
+			return nil, fmt.Errorf("signing key %q: %w", k.Kid, err)
+		}
+		ks.keys[k.Kid] = pub
+	}
+	return &ks, nil
+}
+
+func (k *jwk) rsaKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode exponent: %w", err)
+	}
+	exp := new(big.Int).SetBytes(e)
+	if len(n) == 0 || !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid RSA key")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+}
+
+// hasAudience checks if the given aud claim, a string or list of strings,
+// includes the given client ID.
+func hasAudience(aud interface{}, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
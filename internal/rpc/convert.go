@@ -0,0 +1,270 @@
+package rpc
+
+import (
+	"time"
+
+	"github.com/Dophin2009/nao/internal/rpc/naospb"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+// converter converts between models and their messages, keeping the first
+// error encountered so that conversions read as plain assignments.
+type converter struct {
+	// scores is the ScoreFormat of the scores of UserMedia messages.
+	scores models.ScoreFormat
+	err    error
+}
+
+func (c *converter) timestamp(t *time.Time) *timestamp.Timestamp {
+	if t == nil || c.err != nil {
+		return nil
+	}
+	ts, err := ptypes.TimestampProto(*t)
+	if err != nil {
+		c.err = err
+		return nil
+	}
+	return ts
+}
+
+func (c *converter) time(ts *timestamp.Timestamp) *time.Time {
+	if ts == nil || c.err != nil {
+		return nil
+	}
+	t, err := ptypes.Timestamp(ts)
+	if err != nil {
+		c.err = err
+		return nil
+	}
+	return &t
+}
+
+func (c *converter) metaToProto(m db.ModelMetadata) *naospb.Metadata {
+	return &naospb.Metadata{
+		Id:        int64(m.ID),
+		CreatedAt: c.timestamp(&m.CreatedAt),
+		UpdatedAt: c.timestamp(&m.UpdatedAt),
+		Version:   int64(m.Version),
+	}
+}
+
+// metaFromProto returns the metadata given by the client, of which only the
+// ID is used; the rest is maintained by the database.
+func metaFromProto(m *naospb.Metadata) db.ModelMetadata {
+	return db.ModelMetadata{
+		ID: int(m.GetId()),
+	}
+}
+
+func titlesToProto(list []models.Title) []*naospb.Title {
+	res := make([]*naospb.Title, len(list))
+	for i, t := range list {
+		res[i] = &naospb.Title{
+			String_:   t.String,
+			Language:  t.Language,
+			Priority:  naospb.TitlePriority(t.Priority),
+			Preferred: t.Preferred,
+		}
+	}
+	return res
+}
+
+func titlesFromProto(list []*naospb.Title) []models.Title {
+	res := make([]models.Title, len(list))
+	for i, t := range list {
+		res[i] = models.Title{
+			String:    t.GetString_(),
+			Language:  t.GetLanguage(),
+			Priority:  models.TitlePriority(t.GetPriority()),
+			Preferred: t.GetPreferred(),
+		}
+	}
+	return res
+}
+
+func stringToProto(s *string) *wrappers.StringValue {
+	if s == nil {
+		return nil
+	}
+	return &wrappers.StringValue{Value: *s}
+}
+
+func stringFromProto(v *wrappers.StringValue) *string {
+	if v == nil {
+		return nil
+	}
+	s := v.Value
+	return &s
+}
+
+func intToProto(i *int) *wrappers.Int64Value {
+	if i == nil {
+		return nil
+	}
+	return &wrappers.Int64Value{Value: int64(*i)}
+}
+
+func intFromProto(v *wrappers.Int64Value) *int {
+	if v == nil {
+		return nil
+	}
+	i := int(v.Value)
+	return &i
+}
+
+func (c *converter) mediaToProto(md *models.Media) *naospb.Media {
+	var quarter naospb.Quarter
+	if q := md.SeasonPremiered.Quarter; q != nil {
+		quarter = naospb.Quarter(*q)
+	}
+
+	return &naospb.Media{
+		Meta:       c.metaToProto(md.Meta),
+		Titles:     titlesToProto(md.Titles),
+		Synopses:   titlesToProto(md.Synopses),
+		Background: titlesToProto(md.Background),
+		StartDate:  c.timestamp(md.StartDate),
+		EndDate:    c.timestamp(md.EndDate),
+		SeasonPremiered: &naospb.Season{
+			Quarter: quarter,
+			Year:    intToProto(md.SeasonPremiered.Year),
+		},
+		Type:         stringToProto(md.Type),
+		Source:       stringToProto(md.Source),
+		EpisodeCount: intToProto(md.EpisodeCount),
+		LockedFields: md.LockedFields,
+	}
+}
+
+func (c *converter) mediaFromProto(md *naospb.Media) *models.Media {
+	var quarter *models.Quarter
+	if q := md.GetSeasonPremiered().GetQuarter(); q != naospb.Quarter_QUARTER_UNSPECIFIED {
+		v := models.Quarter(q)
+		quarter = &v
+	}
+
+	return &models.Media{
+		Titles:     titlesFromProto(md.GetTitles()),
+		Synopses:   titlesFromProto(md.GetSynopses()),
+		Background: titlesFromProto(md.GetBackground()),
+		StartDate:  c.time(md.GetStartDate()),
+		EndDate:    c.time(md.GetEndDate()),
+		SeasonPremiered: models.Season{
+			Quarter: quarter,
+			Year:    intFromProto(md.GetSeasonPremiered().GetYear()),
+		},
+		Type:         stringFromProto(md.GetType()),
+		Source:       stringFromProto(md.GetSource()),
+		EpisodeCount: intFromProto(md.GetEpisodeCount()),
+		LockedFields: md.GetLockedFields(),
+		Meta:         metaFromProto(md.GetMeta()),
+	}
+}
+
+func (c *converter) episodeToProto(ep *models.Episode) *naospb.Episode {
+	return &naospb.Episode{
+		Meta:     c.metaToProto(ep.Meta),
+		Titles:   titlesToProto(ep.Titles),
+		Synopses: titlesToProto(ep.Synopses),
+		Date:     c.timestamp(ep.Date),
+		Duration: intToProto(ep.Duration),
+		Filler:   ep.Filler,
+		Recap:    ep.Recap,
+		Special:  ep.Special,
+	}
+}
+
+func (c *converter) episodeFromProto(ep *naospb.Episode) *models.Episode {
+	return &models.Episode{
+		Titles:   titlesFromProto(ep.GetTitles()),
+		Synopses: titlesFromProto(ep.GetSynopses()),
+		Date:     c.time(ep.GetDate()),
+		Duration: intFromProto(ep.GetDuration()),
+		Filler:   ep.GetFiller(),
+		Recap:    ep.GetRecap(),
+		Special:  ep.GetSpecial(),
+		Meta:     metaFromProto(ep.GetMeta()),
+	}
+}
+
+// userMediaToProto converts the given UserMedia. WatchStatus values are
+// offset by one in messages, as zero is reserved for unspecified values.
+func (c *converter) userMediaToProto(um *models.UserMedia) *naospb.UserMedia {
+	var st naospb.WatchStatus
+	if um.Status != nil {
+		st = naospb.WatchStatus(*um.Status + 1)
+	}
+
+	instances := make([]*naospb.WatchedInstance, len(um.WatchInstances))
+	for i, wi := range um.WatchInstances {
+		specials := make([]int64, len(wi.Specials))
+		for k, id := range wi.Specials {
+			specials[k] = int64(id)
+		}
+		instances[i] = &naospb.WatchedInstance{
+			Episodes:  int64(wi.Episodes),
+			Specials:  specials,
+			Ongoing:   wi.Ongoing,
+			StartDate: c.timestamp(wi.StartDate),
+			EndDate:   c.timestamp(wi.EndDate),
+			Comments:  titlesToProto(wi.Comments),
+		}
+	}
+
+	return &naospb.UserMedia{
+		Meta:           c.metaToProto(um.Meta),
+		UserId:         int64(um.UserID),
+		MediaId:        int64(um.MediaID),
+		Priority:       intToProto(um.Priority),
+		Score:          intToProto(c.scores.Display(um.Score)),
+		Recommended:    intToProto(um.Recommended),
+		Status:         st,
+		WatchInstances: instances,
+		Comments:       titlesToProto(um.Comments),
+	}
+}
+
+func (c *converter) userMediaFromProto(um *naospb.UserMedia) *models.UserMedia {
+	var st *models.WatchStatus
+	if s := um.GetStatus(); s != naospb.WatchStatus_WATCH_STATUS_UNSPECIFIED {
+		v := models.WatchStatus(s - 1)
+		st = &v
+	}
+
+	instances := make([]models.WatchedInstance, len(um.GetWatchInstances()))
+	for i, wi := range um.GetWatchInstances() {
+		specials := make([]int, len(wi.GetSpecials()))
+		for k, id := range wi.GetSpecials() {
+			specials[k] = int(id)
+		}
+		instances[i] = models.WatchedInstance{
+			Episodes:  int(wi.GetEpisodes()),
+			Specials:  specials,
+			Ongoing:   wi.GetOngoing(),
+			StartDate: c.time(wi.GetStartDate()),
+			EndDate:   c.time(wi.GetEndDate()),
+			Comments:  titlesFromProto(wi.GetComments()),
+		}
+	}
+
+	score, err := c.scores.Normalize(intFromProto(um.GetScore()))
+	if err != nil && c.err == nil {
+		c.err = err
+	}
+
+	return &models.UserMedia{
+		UserID:         int(um.GetUserId()),
+		MediaID:        int(um.GetMediaId()),
+		Priority:       intFromProto(um.GetPriority()),
+		Score:          score,
+		Recommended:    intFromProto(um.GetRecommended()),
+		Status:         st,
+		WatchInstances: instances,
+		Comments:       titlesFromProto(um.GetComments()),
+		Meta:           metaFromProto(um.GetMeta()),
+	}
+}
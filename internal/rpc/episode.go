@@ -0,0 +1,141 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Dophin2009/nao/internal/rpc/naospb"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// episodeServer implements naospb.EpisodeServiceServer.
+type episodeServer struct {
+	*Server
+}
+
+func (s *episodeServer) Get(ctx context.Context, req *naospb.GetRequest) (*naospb.Episode, error) {
+	var ep *models.Episode
+	err := s.DataService.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		var err error
+		ep, err = s.DataService.EpisodeService.GetByID(int(req.GetId()), tx)
+		if err != nil {
+			return fmt.Errorf("failed to get Episode by ID %d: %w", req.GetId(), err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	var c converter
+	res := c.episodeToProto(ep)
+	if c.err != nil {
+		return nil, statusError(c.err)
+	}
+	return res, nil
+}
+
+func (s *episodeServer) List(req *naospb.ListRequest, stream naospb.EpisodeService_ListServer) error {
+	first, skip, err := listRange(req.GetFirst(), req.GetSkip())
+	if err != nil {
+		return err
+	}
+
+	var list []*models.Episode
+	err = s.DataService.Database.TransactionContext(stream.Context(), false, func(tx db.Tx) error {
+		list, err = s.DataService.EpisodeService.GetAll(first, skip, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get Episode: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return statusError(err)
+	}
+
+	var c converter
+	for _, ep := range list {
+		res := c.episodeToProto(ep)
+		if c.err != nil {
+			return statusError(c.err)
+		}
+		err = stream.Send(res)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *episodeServer) Create(ctx context.Context, req *naospb.Episode) (*naospb.Episode, error) {
+	return s.write(ctx, req, func(ep *models.Episode, tx db.Tx) error {
+		_, err := s.DataService.EpisodeService.Create(ep, tx)
+		if err != nil {
+			return fmt.Errorf("failed to create Episode: %w", err)
+		}
+		return nil
+	})
+}
+
+func (s *episodeServer) Update(ctx context.Context, req *naospb.Episode) (*naospb.Episode, error) {
+	return s.write(ctx, req, func(ep *models.Episode, tx db.Tx) error {
+		err := s.DataService.EpisodeService.Update(ep, tx)
+		if err != nil {
+			return fmt.Errorf("failed to update Episode with ID %d: %w", ep.Meta.ID, err)
+		}
+		return nil
+	})
+}
+
+func (s *episodeServer) Delete(ctx context.Context, req *naospb.DeleteRequest) (*empty.Empty, error) {
+	_, err := s.requireRole(ctx, models.RoleModerator)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.DataService.Database.TransactionContext(ctx, true, func(tx db.Tx) error {
+		err := s.DataService.EpisodeService.Delete(int(req.GetId()), tx)
+		if err != nil {
+			return fmt.Errorf("failed to delete Episode with ID %d: %w", req.GetId(), err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &empty.Empty{}, nil
+}
+
+// write applies the given persisting function to the Episode of the request
+// and returns the result.
+func (s *episodeServer) write(
+	ctx context.Context, req *naospb.Episode, persist func(ep *models.Episode, tx db.Tx) error,
+) (*naospb.Episode, error) {
+	_, err := s.requireRole(ctx, models.RoleModerator)
+	if err != nil {
+		return nil, err
+	}
+
+	var c converter
+	ep := c.episodeFromProto(req)
+	if c.err != nil {
+		return nil, status.Error(codes.InvalidArgument, c.err.Error())
+	}
+
+	err = s.DataService.Database.TransactionContext(ctx, true, func(tx db.Tx) error {
+		return persist(ep, tx)
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	res := c.episodeToProto(ep)
+	if c.err != nil {
+		return nil, statusError(c.err)
+	}
+	return res, nil
+}
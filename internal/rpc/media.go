@@ -0,0 +1,142 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Dophin2009/nao/internal/rpc/naospb"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// mediaServer implements naospb.MediaServiceServer.
+type mediaServer struct {
+	*Server
+}
+
+func (s *mediaServer) Get(ctx context.Context, req *naospb.GetRequest) (*naospb.Media, error) {
+	var md *models.Media
+	err := s.DataService.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		var err error
+		md, err = s.DataService.MediaService.GetByID(int(req.GetId()), tx)
+		if err != nil {
+			return fmt.Errorf("failed to get Media by ID %d: %w", req.GetId(), err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	var c converter
+	res := c.mediaToProto(md)
+	if c.err != nil {
+		return nil, statusError(c.err)
+	}
+	return res, nil
+}
+
+func (s *mediaServer) List(req *naospb.ListRequest, stream naospb.MediaService_ListServer) error {
+	first, skip, err := listRange(req.GetFirst(), req.GetSkip())
+	if err != nil {
+		return err
+	}
+
+	var list []*models.Media
+	err = s.DataService.Database.TransactionContext(stream.Context(), false, func(tx db.Tx) error {
+		list, err = s.DataService.MediaService.GetAll(first, skip, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get Media: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return statusError(err)
+	}
+
+	var c converter
+	for _, md := range list {
+		res := c.mediaToProto(md)
+		if c.err != nil {
+			return statusError(c.err)
+		}
+		err = stream.Send(res)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *mediaServer) Create(ctx context.Context, req *naospb.Media) (*naospb.Media, error) {
+	return s.write(ctx, req, func(_ *models.User, md *models.Media, tx db.Tx) error {
+		_, err := s.DataService.MediaService.Create(md, tx)
+		if err != nil {
+			return fmt.Errorf("failed to create Media: %w", err)
+		}
+		return nil
+	})
+}
+
+func (s *mediaServer) Update(ctx context.Context, req *naospb.Media) (*naospb.Media, error) {
+	return s.write(ctx, req, func(u *models.User, md *models.Media, tx db.Tx) error {
+		err := s.DataService.MediaService.UpdateAs(u, md, tx)
+		if err != nil {
+			return fmt.Errorf("failed to update Media with ID %d: %w", md.Meta.ID, err)
+		}
+		return nil
+	})
+}
+
+func (s *mediaServer) Delete(ctx context.Context, req *naospb.DeleteRequest) (*empty.Empty, error) {
+	_, err := s.requireRole(ctx, models.RoleModerator)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.DataService.Database.TransactionContext(ctx, true, func(tx db.Tx) error {
+		err := s.DataService.MediaService.Delete(int(req.GetId()), tx)
+		if err != nil {
+			return fmt.Errorf("failed to delete Media with ID %d: %w", req.GetId(), err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &empty.Empty{}, nil
+}
+
+// write applies the given persisting function to the Media of the request on
+// behalf of the caller and returns the result.
+func (s *mediaServer) write(
+	ctx context.Context, req *naospb.Media,
+	persist func(u *models.User, md *models.Media, tx db.Tx) error,
+) (*naospb.Media, error) {
+	u, err := s.requireRole(ctx, models.RoleModerator)
+	if err != nil {
+		return nil, err
+	}
+
+	var c converter
+	md := c.mediaFromProto(req)
+	if c.err != nil {
+		return nil, status.Error(codes.InvalidArgument, c.err.Error())
+	}
+
+	err = s.DataService.Database.TransactionContext(ctx, true, func(tx db.Tx) error {
+		return persist(u, md, tx)
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	res := c.mediaToProto(md)
+	if c.err != nil {
+		return nil, statusError(c.err)
+	}
+	return res, nil
+}
@@ -0,0 +1,169 @@
+// Package rpc implements the gRPC API of naos, defined in naospb/naos.proto.
+// Run `make generate` to generate the naospb package.
+package rpc
+
+//go:generate protoc --go_out=plugins=grpc,paths=source_relative:. naospb/naos.proto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/rpc/naospb"
+	"github.com/Dophin2009/nao/pkg/models"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// MetadataAuthorization is the request metadata key that carries the
+// caller's bearer token.
+const MetadataAuthorization = "authorization"
+
+// Authenticator returns the User authenticated by the given token and the
+// scope of the token.
+type Authenticator func(token string) (*models.User, models.APIKeyScope, error)
+
+// Server serves the gRPC services over the data services shared with the
+// HTTP APIs.
+type Server struct {
+	DataService  *graphql.DataService
+	Authenticate Authenticator
+	// Writable returns an error if methods that modify data are refused for
+	// a while, such as in maintenance mode; they are allowed if nil.
+	Writable func() error
+}
+
+// NewServer returns a gRPC server with all the services registered.
+func NewServer(
+	ds *graphql.DataService, authenticate Authenticator, writable func() error,
+) *grpc.Server {
+	srv := &Server{
+		DataService:  ds,
+		Authenticate: authenticate,
+		Writable:     writable,
+	}
+
+	s := grpc.NewServer()
+	naospb.RegisterMediaServiceServer(s, &mediaServer{srv})
+	naospb.RegisterEpisodeServiceServer(s, &episodeServer{srv})
+	naospb.RegisterUserMediaServiceServer(s, &userMediaServer{srv})
+	return s
+}
+
+// caller returns the User authenticated by the bearer token in the metadata
+// of the request, or nil if the request carries no token.
+func (s *Server) caller(ctx context.Context) (*models.User, error) {
+	u, _, err := s.authenticate(ctx)
+	return u, err
+}
+
+// authenticate returns the User authenticated by the bearer token in the
+// metadata of the request, or nil if the request carries no token, and the
+// scope of the token.
+func (s *Server) authenticate(ctx context.Context) (*models.User, models.APIKeyScope, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, models.APIKeyScopeAdmin, nil
+	}
+	values := md.Get(MetadataAuthorization)
+	if len(values) == 0 {
+		return nil, models.APIKeyScopeAdmin, nil
+	}
+
+	tknstr := strings.TrimPrefix(values[0], "Bearer ")
+	if tknstr == values[0] {
+		return nil, models.APIKeyScopeRead, status.Error(codes.Unauthenticated,
+			"authorization metadata is not a bearer token")
+	}
+	if s.Authenticate == nil {
+		return nil, models.APIKeyScopeRead, status.Error(codes.Unauthenticated,
+			"token authentication is not configured")
+	}
+
+	u, scope, err := s.Authenticate(tknstr)
+	if err != nil {
+		return nil, scope, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return u, scope, nil
+}
+
+// requireRole returns the caller of the request if they have the given Role.
+// It is used by methods that modify data, so read-only API keys are refused,
+// as are all callers while writes are not allowed.
+func (s *Server) requireRole(ctx context.Context, role models.Role) (*models.User, error) {
+	u, scope, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, status.Error(codes.Unauthenticated, "no credentials given")
+	}
+	if s.Writable != nil {
+		err = s.Writable()
+		if err != nil {
+			return nil, statusError(err)
+		}
+	}
+	if !scope.Includes(models.APIKeyScopeWrite) {
+		return nil, status.Errorf(codes.PermissionDenied,
+			"API key of scope %s: read-only", scope)
+	}
+	if r := u.Permissions.Role(); !r.Includes(role) {
+		return nil, status.Errorf(codes.PermissionDenied,
+			"role %s: insufficient permissions", r)
+	}
+	return u, nil
+}
+
+// statusError returns the gRPC status error for the given error, by the data
+// layer error it wraps.
+func statusError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	code := codes.Internal
+	switch {
+	case errors.Is(err, data.ErrNotFound):
+		code = codes.NotFound
+	case errors.Is(err, data.ErrInvalid):
+		code = codes.InvalidArgument
+	case errors.Is(err, data.ErrConflict):
+		code = codes.AlreadyExists
+	case errors.Is(err, data.ErrUnauthorized):
+		code = codes.PermissionDenied
+	case errors.Is(err, data.ErrUnavailable):
+		code = codes.Unavailable
+	case errors.Is(err, data.ErrLocked):
+		code = codes.FailedPrecondition
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	}
+	return status.Error(code, err.Error())
+}
+
+// listRange returns the first and skip parameters of a list request.
+func listRange(first int64, skip int64) (*int, *int, error) {
+	if first < 0 || skip < 0 {
+		return nil, nil, status.Error(codes.InvalidArgument,
+			fmt.Sprintf("first %d, skip %d: must not be negative", first, skip))
+	}
+
+	var f, sk *int
+	if first > 0 {
+		v := int(first)
+		f = &v
+	}
+	if skip > 0 {
+		v := int(skip)
+		sk = &v
+	}
+	return f, sk, nil
+}
@@ -0,0 +1,166 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/rpc/naospb"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+	"github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// userMediaServer implements naospb.UserMediaServiceServer. Ownership of
+// UserMedia and the privacy settings of their Users are checked by the data
+// layer. Scores are given and read in the ScoreFormat of the caller.
+type userMediaServer struct {
+	*Server
+}
+
+func (s *userMediaServer) Get(
+	ctx context.Context, req *naospb.GetRequest,
+) (*naospb.UserMedia, error) {
+	u, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var um *models.UserMedia
+	err = s.DataService.Database.TransactionContext(ctx, false, func(tx db.Tx) error {
+		um, err = s.DataService.UserMediaService.GetByIDAs(u, int(req.GetId()), tx)
+		if err != nil {
+			return fmt.Errorf("failed to get UserMedia by ID %d: %w", req.GetId(), err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	c := converter{scores: data.ScoreFormatOf(u)}
+	res := c.userMediaToProto(um)
+	if c.err != nil {
+		return nil, statusError(c.err)
+	}
+	return res, nil
+}
+
+func (s *userMediaServer) List(
+	req *naospb.ListUserMediaRequest, stream naospb.UserMediaService_ListServer,
+) error {
+	u, err := s.caller(stream.Context())
+	if err != nil {
+		return err
+	}
+	uID := int(req.GetUserId())
+	first, skip, err := listRange(req.GetFirst(), req.GetSkip())
+	if err != nil {
+		return err
+	}
+
+	var list []*models.UserMedia
+	err = s.DataService.Database.TransactionContext(stream.Context(), false, func(tx db.Tx) error {
+		list, err = s.DataService.UserMediaService.GetByUserAs(u, uID, first, skip, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get UserMedia by User ID %d: %w", uID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return statusError(err)
+	}
+
+	c := converter{scores: data.ScoreFormatOf(u)}
+	for _, um := range list {
+		res := c.userMediaToProto(um)
+		if c.err != nil {
+			return statusError(c.err)
+		}
+		err = stream.Send(res)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *userMediaServer) Create(
+	ctx context.Context, req *naospb.UserMedia,
+) (*naospb.UserMedia, error) {
+	return s.write(ctx, req, func(u *models.User, um *models.UserMedia, tx db.Tx) error {
+		_, err := s.DataService.UserMediaService.CreateAs(u, um, tx)
+		if err != nil {
+			return fmt.Errorf("failed to create UserMedia: %w", err)
+		}
+		return nil
+	})
+}
+
+func (s *userMediaServer) Update(
+	ctx context.Context, req *naospb.UserMedia,
+) (*naospb.UserMedia, error) {
+	return s.write(ctx, req, func(u *models.User, um *models.UserMedia, tx db.Tx) error {
+		err := s.DataService.UserMediaService.UpdateAs(u, um, tx)
+		if err != nil {
+			return fmt.Errorf("failed to update UserMedia with ID %d: %w",
+				um.Meta.ID, err)
+		}
+		return nil
+	})
+}
+
+func (s *userMediaServer) Delete(
+	ctx context.Context, req *naospb.DeleteRequest,
+) (*empty.Empty, error) {
+	u, err := s.requireRole(ctx, models.RoleUser)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.DataService.Database.TransactionContext(ctx, true, func(tx db.Tx) error {
+		err := s.DataService.UserMediaService.DeleteAs(u, int(req.GetId()), tx)
+		if err != nil {
+			return fmt.Errorf("failed to delete UserMedia with ID %d: %w",
+				req.GetId(), err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &empty.Empty{}, nil
+}
+
+// write applies the given persisting function to the caller and the
+// UserMedia of the request, and returns the result.
+func (s *userMediaServer) write(
+	ctx context.Context, req *naospb.UserMedia,
+	persist func(u *models.User, um *models.UserMedia, tx db.Tx) error,
+) (*naospb.UserMedia, error) {
+	u, err := s.requireRole(ctx, models.RoleUser)
+	if err != nil {
+		return nil, err
+	}
+
+	c := converter{scores: data.ScoreFormatOf(u)}
+	um := c.userMediaFromProto(req)
+	if c.err != nil {
+		return nil, status.Error(codes.InvalidArgument, c.err.Error())
+	}
+
+	err = s.DataService.Database.TransactionContext(ctx, true, func(tx db.Tx) error {
+		return persist(u, um, tx)
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	res := c.userMediaToProto(um)
+	if c.err != nil {
+		return nil, statusError(c.err)
+	}
+	return res, nil
+}
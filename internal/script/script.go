@@ -0,0 +1,429 @@
+// Package script runs the Lua scripts of operators on the lifecycle events of
+// entities and as HTTP webhooks, in a sandbox with read access to the public
+// catalog.
+package script
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	json "github.com/json-iterator/go"
+	log "github.com/sirupsen/logrus"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// DefaultTimeout is the longest a script may run for each call if not
+// configured.
+const DefaultTimeout = 5 * time.Second
+
+// MaxList is the largest number of entities listed by scripts at once.
+const MaxList = 100
+
+// ErrNoWebhook is returned when calling a webhook no script registered.
+var ErrNoWebhook = errors.New("no such webhook")
+
+// Engine runs the Lua scripts of a directory. Each script is run when
+// loaded, registering the functions called on lifecycle events with
+// nao.on(bucket, event, fn) and those called as webhooks with
+// nao.webhook(name, fn). Scripts may read entities of the buckets given with
+// nao.get(bucket, id) and nao.list(bucket, first, skip), and only the base,
+// table, string and math libraries are available to them. It is safe for
+// concurrent use, though the calls of each script are run one at a time.
+type Engine struct {
+	// Timeout is the longest a script may run for each call.
+	Timeout time.Duration
+
+	database *db.DatabaseService
+	services map[string]db.Service
+	scripts  []*Script
+	hooks    []hook
+	webhooks map[string]webhook
+}
+
+// Script is a single loaded script.
+type Script struct {
+	Name string
+
+	engine *Engine
+	mu     sync.Mutex
+	state  *lua.LState
+	// tx is the transaction of the hook being called, read from by the
+	// script; nil if reads begin transactions of their own.
+	tx db.Tx
+}
+
+type hook struct {
+	script *Script
+	bucket string
+	event  db.LifecycleEvent
+	fn     *lua.LFunction
+}
+
+type webhook struct {
+	script *Script
+	fn     *lua.LFunction
+}
+
+// Load loads and runs the scripts with the .lua extension in the given
+// directory, in the order of their names, giving them read access to the
+// entities of the given services, and allowing each call the given duration,
+// or DefaultTimeout if not positive.
+func Load(
+	dir string, database *db.DatabaseService, services []db.Service, timeout time.Duration,
+) (*Engine, error) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	e := Engine{
+		Timeout:  timeout,
+		database: database,
+		services: map[string]db.Service{},
+		webhooks: map[string]webhook{},
+	}
+	for _, ser := range services {
+		e.services[ser.Bucket()] = ser
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.lua"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scripts: %w", err)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		s := e.newScript(strings.TrimSuffix(filepath.Base(path), ".lua"))
+		e.scripts = append(e.scripts, s)
+
+		ctx, cancel := context.WithTimeout(context.Background(), e.Timeout)
+		s.state.SetContext(ctx)
+		err := s.state.DoFile(path)
+		cancel()
+		if err != nil {
+			e.Close()
+			return nil, fmt.Errorf("failed to load script %q: %w", s.Name, err)
+		}
+	}
+	return &e, nil
+}
+
+// Scripts returns the loaded scripts.
+func (e *Engine) Scripts() []*Script {
+	return e.scripts
+}
+
+// Attach registers the hooks of the scripts with the given Lifecycle. Hooks
+// of events before changes are called inside the transaction, and may reject
+// the changes by raising errors; the others are called once the transaction
+// is committed, and their errors are logged.
+func (e *Engine) Attach(l *db.Lifecycle) {
+	for _, h := range e.hooks {
+		h := h
+		switch h.event {
+		case db.BeforeCreate, db.BeforeUpdate, db.BeforeDelete:
+			l.Register(h.bucket, h.event, func(m db.Model, _ db.Service, tx db.Tx) error {
+				err := h.call(m, tx)
+				if err != nil {
+					return fmt.Errorf("script %q: %v: %w", h.script.Name, err, db.ErrInvalid)
+				}
+				return nil
+			})
+		default:
+			l.RegisterCommitted(h.bucket, h.event, func(m db.Model, _ db.Service) {
+				err := h.call(m, nil)
+				if err != nil {
+					log.WithFields(log.Fields{
+						"script": h.script.Name,
+						"bucket": h.bucket,
+						"event":  h.event.String(),
+					}).Errorf("Failed to run script hook: %v", err)
+				}
+			})
+		}
+	}
+}
+
+// call calls the hook with the given entity, reading in the given
+// transaction.
+func (h *hook) call(m db.Model, tx db.Tx) error {
+	v, err := plain(m)
+	if err != nil {
+		return err
+	}
+	_, err = h.script.call(context.Background(), tx, h.fn, v, h.event.String())
+	return err
+}
+
+// WebhookRequest is a HTTP request passed to a webhook.
+type WebhookRequest struct {
+	Method string
+	Path   string
+	// Query and Headers are the first values of each query parameter and
+	// header.
+	Query   map[string]string
+	Headers map[string]string
+	Body    string
+}
+
+// Webhook calls the webhook of the given name with the given request, and
+// returns the value it returns, of the types decoded from JSON. It returns
+// an error wrapping ErrNoWebhook if no script registered the webhook.
+func (e *Engine) Webhook(
+	ctx context.Context, name string, req *WebhookRequest,
+) (interface{}, error) {
+	wh, ok := e.webhooks[name]
+	if !ok {
+		return nil, fmt.Errorf("webhook %q: %w", name, ErrNoWebhook)
+	}
+
+	query := map[string]interface{}{}
+	for k, v := range req.Query {
+		query[k] = v
+	}
+	headers := map[string]interface{}{}
+	for k, v := range req.Headers {
+		headers[k] = v
+	}
+	arg := map[string]interface{}{
+		"method":  req.Method,
+		"path":    req.Path,
+		"query":   query,
+		"headers": headers,
+		"body":    req.Body,
+	}
+
+	ret, err := wh.script.call(ctx, nil, wh.fn, arg)
+	if err != nil {
+		return nil, fmt.Errorf("script %q: %w", wh.script.Name, err)
+	}
+	return ret, nil
+}
+
+// Close closes the scripts. A nil Engine has none.
+func (e *Engine) Close() {
+	if e == nil {
+		return
+	}
+	for _, s := range e.scripts {
+		s.mu.Lock()
+		s.state.Close()
+		s.mu.Unlock()
+	}
+}
+
+// newScript returns a new Script of the given name, with a sandboxed state.
+func (e *Engine) newScript(name string) *Script {
+	s := &Script{
+		Name:   name,
+		engine: e,
+		state:  lua.NewState(lua.Options{SkipOpenLibs: true}),
+	}
+	L := s.state
+
+	libs := []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	}
+	for _, lib := range libs {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	// Scripts may not read files or load code of their own
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+
+	mod := L.NewTable()
+	L.SetFuncs(mod, map[string]lua.LGFunction{
+		"on":          s.luaOn,
+		"webhook":     s.luaWebhook,
+		"get":         s.luaGet,
+		"list":        s.luaList,
+		"log":         s.luaLog,
+		"json_encode": luaJSONEncode,
+		"json_decode": luaJSONDecode,
+	})
+	L.SetGlobal("nao", mod)
+	return s
+}
+
+// call calls the given function of the script with the given arguments, of
+// the types decoded from JSON, reading in the given transaction, and returns
+// the value it returns.
+func (s *Script) call(
+	ctx context.Context, tx db.Tx, fn *lua.LFunction, args ...interface{},
+) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	largs := make([]lua.LValue, len(args))
+	for i, arg := range args {
+		largs[i] = toLua(s.state, arg)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.engine.Timeout)
+	defer cancel()
+	s.state.SetContext(ctx)
+	defer s.state.RemoveContext()
+	s.tx = tx
+	defer func() { s.tx = nil }()
+
+	err := s.state.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, largs...)
+	if err != nil {
+		var apiErr *lua.ApiError
+		if errors.As(err, &apiErr) {
+			return nil, errors.New(apiErr.Object.String())
+		}
+		return nil, err
+	}
+	ret := s.state.Get(-1)
+	s.state.Pop(1)
+	return fromLua(ret), nil
+}
+
+// read calls the given function with the transaction of the hook being
+// called, or else a new read-only transaction.
+func (s *Script) read(f func(tx db.Tx) error) error {
+	if s.tx != nil {
+		return f(s.tx)
+	}
+	return s.engine.database.Transaction(false, f)
+}
+
+// service returns the service of the bucket given as the argument at the
+// given position, raising an error if scripts may not read it.
+func (s *Script) service(L *lua.LState, n int) db.Service {
+	bucket := L.CheckString(n)
+	ser, ok := s.engine.services[bucket]
+	if !ok {
+		L.ArgError(n, fmt.Sprintf("unknown bucket %q", bucket))
+	}
+	return ser
+}
+
+// luaOn implements nao.on(bucket, event, fn).
+func (s *Script) luaOn(L *lua.LState) int {
+	ser := s.service(L, 1)
+	name := L.CheckString(2)
+	fn := L.CheckFunction(3)
+
+	for e := db.BeforeCreate; e <= db.AfterDelete; e++ {
+		if e.String() == name {
+			s.engine.hooks = append(s.engine.hooks, hook{
+				script: s,
+				bucket: ser.Bucket(),
+				event:  e,
+				fn:     fn,
+			})
+			return 0
+		}
+	}
+	L.ArgError(2, fmt.Sprintf("unknown event %q", name))
+	return 0
+}
+
+// luaWebhook implements nao.webhook(name, fn).
+func (s *Script) luaWebhook(L *lua.LState) int {
+	name := L.CheckString(1)
+	fn := L.CheckFunction(2)
+	if other, ok := s.engine.webhooks[name]; ok {
+		L.RaiseError("webhook %q already registered by script %q", name, other.script.Name)
+	}
+	s.engine.webhooks[name] = webhook{script: s, fn: fn}
+	return 0
+}
+
+// luaGet implements nao.get(bucket, id), which returns nil if there is no
+// entity with the ID.
+func (s *Script) luaGet(L *lua.LState) int {
+	ser := s.service(L, 1)
+	id := L.CheckInt(2)
+
+	var v interface{}
+	err := s.read(func(tx db.Tx) error {
+		m, err := tx.Database().GetByID(id, ser, tx)
+		if errors.Is(err, db.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		v, err = plain(m)
+		return err
+	})
+	if err != nil {
+		L.RaiseError("failed to get %s with ID %d: %v", ser.Bucket(), id, err)
+	}
+	L.Push(toLua(L, v))
+	return 1
+}
+
+// luaList implements nao.list(bucket, first, skip), which lists at most
+// MaxList entities.
+func (s *Script) luaList(L *lua.LState) int {
+	ser := s.service(L, 1)
+	first := L.OptInt(2, MaxList)
+	if first <= 0 || first > MaxList {
+		first = MaxList
+	}
+	skip := L.OptInt(3, 0)
+
+	var list []interface{}
+	err := s.read(func(tx db.Tx) error {
+		models, err := tx.Database().GetAll(&first, &skip, ser, tx)
+		if err != nil {
+			return err
+		}
+		for _, m := range models {
+			v, err := plain(m)
+			if err != nil {
+				return err
+			}
+			list = append(list, v)
+		}
+		return nil
+	})
+	if err != nil {
+		L.RaiseError("failed to list %s: %v", ser.Bucket(), err)
+	}
+	L.Push(toLua(L, list))
+	return 1
+}
+
+// luaLog implements nao.log(message).
+func (s *Script) luaLog(L *lua.LState) int {
+	log.WithFields(log.Fields{"script": s.Name}).Info(L.CheckString(1))
+	return 0
+}
+
+// luaJSONEncode implements nao.json_encode(value).
+func luaJSONEncode(L *lua.LState) int {
+	buf, err := json.Marshal(fromLua(L.CheckAny(1)))
+	if err != nil {
+		L.RaiseError("failed to encode JSON: %v", err)
+	}
+	L.Push(lua.LString(buf))
+	return 1
+}
+
+// luaJSONDecode implements nao.json_decode(string).
+func luaJSONDecode(L *lua.LState) int {
+	var v interface{}
+	err := json.Unmarshal([]byte(L.CheckString(1)), &v)
+	if err != nil {
+		L.RaiseError("failed to decode JSON: %v", err)
+	}
+	L.Push(toLua(L, v))
+	return 1
+}
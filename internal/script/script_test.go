@@ -0,0 +1,104 @@
+package script_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/naos"
+	"github.com/Dophin2009/nao/internal/naos/naostest"
+	"github.com/Dophin2009/nao/internal/script"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+const testScript = `
+nao.on("Genre", "BeforeCreate", function(g)
+	if g.Names[1].String == "Forbidden" then
+		error("forbidden genre")
+	end
+end)
+
+local created = {}
+nao.on("Genre", "AfterCreate", function(g)
+	table.insert(created, g.Meta.ID)
+end)
+
+nao.webhook("created", function(req)
+	local body = nao.json_decode(req.body)
+	return {
+		echo = body.echo,
+		ids = created,
+		genre = nao.get("Genre", created[1]).Names[1].String,
+		sandboxed = io == nil and os == nil and dofile == nil,
+	}
+end)
+`
+
+// TestEngine tests that scripts may reject changes in hooks before them, are
+// called after commits, and serve webhooks, in a sandbox.
+func TestEngine(t *testing.T) {
+	ds, _, cleanup := naostest.NewDataService(t)
+	defer cleanup()
+
+	dir, err := ioutil.TempDir("", "script")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "genres.lua"), []byte(testScript), 0600)
+	if err != nil {
+		t.Fatalf("failed to write script: %v", err)
+	}
+
+	engine, err := script.Load(dir, &ds.Database, naos.PublicServices(ds), 0)
+	if err != nil {
+		t.Fatalf("failed to load scripts: %v", err)
+	}
+	defer engine.Close()
+	engine.Attach(ds.Lifecycle)
+
+	create := func(name string) (int, error) {
+		var id int
+		err := ds.Database.Transaction(true, func(tx db.Tx) error {
+			var err error
+			id, err = ds.GenreService.Create(&models.Genre{
+				Names: []models.Title{{String: name, Language: "en"}},
+			}, tx)
+			return err
+		})
+		return id, err
+	}
+	id, err := create("Mecha")
+	if err != nil {
+		t.Fatalf("failed to create Genre: %v", err)
+	}
+	_, err = create("Forbidden")
+	if !errors.Is(err, db.ErrInvalid) {
+		t.Errorf("expected script to reject Genre, got %v", err)
+	}
+
+	res, err := engine.Webhook(context.Background(), "created", &script.WebhookRequest{
+		Method: "POST",
+		Body:   `{"echo": "hello"}`,
+	})
+	if err != nil {
+		t.Fatalf("failed to call webhook: %v", err)
+	}
+	obj, _ := res.(map[string]interface{})
+	ids, _ := obj["ids"].([]interface{})
+	if len(ids) != 1 || ids[0] != float64(id) {
+		t.Errorf("expected committed Genre %d only, got %v", id, obj["ids"])
+	}
+	if obj["echo"] != "hello" || obj["genre"] != "Mecha" || obj["sandboxed"] != true {
+		t.Errorf("unexpected webhook response %v", obj)
+	}
+
+	_, err = engine.Webhook(context.Background(), "missing", &script.WebhookRequest{})
+	if !errors.Is(err, script.ErrNoWebhook) {
+		t.Errorf("expected missing webhook error, got %v", err)
+	}
+}
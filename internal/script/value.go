@@ -0,0 +1,83 @@
+package script
+
+import (
+	"fmt"
+
+	"github.com/Dophin2009/nao/pkg/db"
+	json "github.com/json-iterator/go"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// plain returns the given entity as the values its JSON encoding decodes to,
+// as it is passed to scripts.
+func plain(m db.Model) (interface{}, error) {
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode entity: %w", err)
+	}
+	var v interface{}
+	err = json.Unmarshal(buf, &v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode entity: %w", err)
+	}
+	return v, nil
+}
+
+// toLua returns the Lua value of the given value of the types decoded from
+// JSON; objects and arrays are tables.
+func toLua(L *lua.LState, v interface{}) lua.LValue {
+	switch v := v.(type) {
+	case nil:
+		return lua.LNil
+	case bool:
+		return lua.LBool(v)
+	case float64:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case []interface{}:
+		t := L.CreateTable(len(v), 0)
+		for i, e := range v {
+			t.RawSetInt(i+1, toLua(L, e))
+		}
+		return t
+	case map[string]interface{}:
+		t := L.CreateTable(0, len(v))
+		for k, e := range v {
+			t.RawSetString(k, toLua(L, e))
+		}
+		return t
+	}
+	return lua.LString(fmt.Sprint(v))
+}
+
+// fromLua returns the value of the types decoded from JSON of the given Lua
+// value. Tables with a sequence are arrays of its elements, and others are
+// objects keyed by the string forms of their keys.
+func fromLua(v lua.LValue) interface{} {
+	switch v := v.(type) {
+	case lua.LBool:
+		return bool(v)
+	case lua.LNumber:
+		return float64(v)
+	case lua.LString:
+		return string(v)
+	case *lua.LTable:
+		if n := v.Len(); n > 0 {
+			list := make([]interface{}, 0, n)
+			for i := 1; i <= n; i++ {
+				list = append(list, fromLua(v.RawGetInt(i)))
+			}
+			return list
+		}
+		obj := map[string]interface{}{}
+		v.ForEach(func(k lua.LValue, e lua.LValue) {
+			obj[k.String()] = fromLua(e)
+		})
+		return obj
+	}
+	if v == lua.LNil {
+		return nil
+	}
+	return v.String()
+}
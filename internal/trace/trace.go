@@ -0,0 +1,205 @@
+// Package trace serves requests in spans of OpenTelemetry traces, continuing
+// the W3C Trace Context of callers, and exports them to a collector.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// DefaultFlushInterval is the longest time finished spans wait to be
+// exported if not configured.
+const DefaultFlushInterval = 5 * time.Second
+
+// instrumentation is the name of the instrumentation spans are started by.
+const instrumentation = "github.com/Dophin2009/nao"
+
+// Tracer starts the spans of the requests served and exports them in batches
+// to an OpenTelemetry collector over OTLP/HTTP once finished. It is safe for
+// concurrent use.
+type Tracer struct {
+	// Endpoint is the URL spans are exported to, such as
+	// http://localhost:4318/v1/traces.
+	Endpoint string
+	// ServiceName is the name of the service the spans are reported for.
+	ServiceName string
+	// Headers are sent with each export, such as for authentication.
+	Headers map[string]string
+	// FlushInterval is the longest time finished spans wait to be exported.
+	FlushInterval time.Duration
+	// OnError is called with the errors of failed exports.
+	OnError func(error)
+
+	mu       sync.Mutex
+	provider *sdktrace.TracerProvider
+}
+
+// NewTracer returns a Tracer that exports the spans of the given service to
+// the given endpoint.
+func NewTracer(endpoint string, serviceName string, onError func(error)) *Tracer {
+	return &Tracer{
+		Endpoint:      endpoint,
+		ServiceName:   serviceName,
+		FlushInterval: DefaultFlushInterval,
+		OnError:       onError,
+	}
+}
+
+// Start begins exporting finished spans in the background.
+func (t *Tracer) Start() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.provider != nil {
+		return errors.New("tracer already started")
+	}
+	if t.FlushInterval <= 0 {
+		t.FlushInterval = DefaultFlushInterval
+	}
+
+	exp, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(t.Endpoint),
+		otlptracehttp.WithHeaders(t.Headers))
+	if err != nil {
+		return fmt.Errorf("failed to create exporter: %w", err)
+	}
+	res := resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(t.ServiceName))
+	t.provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(&reportingExporter{exp, t.OnError},
+			sdktrace.WithBatchTimeout(t.FlushInterval)),
+		sdktrace.WithResource(res))
+	return nil
+}
+
+// Stop exports the spans finished so far and stops exporting.
+func (t *Tracer) Stop() {
+	t.mu.Lock()
+	p := t.provider
+	t.provider = nil
+	t.mu.Unlock()
+
+	if p == nil {
+		return
+	}
+	err := p.Shutdown(context.Background())
+	if err != nil && t.OnError != nil {
+		t.OnError(fmt.Errorf("failed to stop tracing: %w", err))
+	}
+}
+
+// StartRootSpan starts a server span for a request from a remote caller,
+// continuing the trace of the caller if the given headers carry a valid
+// traceparent, and returns it with a context in which it is current. The
+// span does nothing if the Tracer is not started.
+func (t *Tracer) StartRootSpan(
+	ctx context.Context, name string, header http.Header,
+) (context.Context, oteltrace.Span) {
+	t.mu.Lock()
+	p := t.provider
+	t.mu.Unlock()
+
+	if p == nil {
+		return ctx, oteltrace.SpanFromContext(ctx)
+	}
+	ctx = propagation.TraceContext{}.Extract(ctx, propagation.HeaderCarrier(header))
+	return p.Tracer(instrumentation).Start(ctx, name,
+		oteltrace.WithSpanKind(oteltrace.SpanKindServer))
+}
+
+// reportingExporter passes the errors of failed exports to a function, so
+// that they are logged with those of the rest of the server.
+type reportingExporter struct {
+	sdktrace.SpanExporter
+	onError func(error)
+}
+
+func (e *reportingExporter) ExportSpans(
+	ctx context.Context, spans []sdktrace.ReadOnlySpan,
+) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	if err != nil && e.onError != nil {
+		e.onError(fmt.Errorf("failed to export %d spans: %w", len(spans), err))
+	}
+	return err
+}
+
+// FromContext returns the current span of the given context, which does
+// nothing if there is none.
+func FromContext(ctx context.Context) oteltrace.Span {
+	return oteltrace.SpanFromContext(ctx)
+}
+
+// StartSpan starts a child of the current span of the given context, and
+// returns it with a context in which it is current. If the context has no
+// current span, the returned span does nothing.
+func StartSpan(ctx context.Context, name string) (context.Context, oteltrace.Span) {
+	parent := oteltrace.SpanFromContext(ctx)
+	return parent.TracerProvider().Tracer(instrumentation).Start(ctx, name)
+}
+
+// Finish ends the given span, failed if err is not nil.
+func Finish(span oteltrace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// requestIDKey is the key of the request ID in a context.
+type requestIDKey struct{}
+
+// NewRequestID returns a random request ID.
+func NewRequestID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// WithRequestID returns a copy of the given context that carries the given
+// request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by the given context, or an empty
+// string if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// DatabaseTracer traces database transactions as children of the current
+// span of their context.
+type DatabaseTracer struct{}
+
+// StartTx starts a span for a transaction and returns the function that
+// finishes it.
+func (DatabaseTracer) StartTx(ctx context.Context, writable bool) func(error) {
+	_, span := StartSpan(ctx, "db.Transaction")
+	if !span.IsRecording() {
+		return func(error) {}
+	}
+	span.SetAttributes(
+		attribute.String("db.system", "bolt"),
+		attribute.Bool("db.writable", writable))
+	return func(err error) {
+		Finish(span, err)
+	}
+}
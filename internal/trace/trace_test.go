@@ -0,0 +1,59 @@
+package trace_test
+
+import (
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// TestTracer tests that spans continue the trace of the remote caller and
+// are exported to the collector with their parents.
+func TestTracer(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	tracer := trace.NewTracer(srv.URL+"/v1/traces", "naos", func(err error) {
+		t.Errorf("unexpected error: %v", err)
+	})
+	err := tracer.Start()
+	if err != nil {
+		t.Fatalf("failed to start tracer: %v", err)
+	}
+
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, root := tracer.StartRootSpan(context.Background(), "GET /media", header)
+	_, child := trace.StartSpan(ctx, "db.Transaction")
+	trace.Finish(child, nil)
+	trace.Finish(root, nil)
+	tracer.Stop()
+
+	var req coltracepb.ExportTraceServiceRequest
+	err = proto.Unmarshal(<-bodies, &req)
+	if err != nil {
+		t.Fatalf("failed to decode export: %v", err)
+	}
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	if spans[0].Name != "db.Transaction" ||
+		hex.EncodeToString(spans[0].ParentSpanId) != hex.EncodeToString(spans[1].SpanId) {
+		t.Errorf("expected db.Transaction child of root span, got %v", spans)
+	}
+	if hex.EncodeToString(spans[1].TraceId) != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		hex.EncodeToString(spans[1].ParentSpanId) != "00f067aa0ba902b7" {
+		t.Errorf("expected root span to continue remote trace, got %v", spans[1])
+	}
+}
@@ -0,0 +1,97 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// RoutePolicy is an enum that describes who a route is served to.
+type RoutePolicy int
+
+const (
+	// RouteAuthenticated serves the route only to callers with valid
+	// credentials.
+	RouteAuthenticated RoutePolicy = iota
+	// RoutePublic serves the route to anonymous callers too.
+	RoutePublic
+)
+
+// RouteRule is an entry of a route policy table, giving the policy of the
+// routes of its methods and path.
+type RouteRule struct {
+	// Methods are the HTTP methods of the routes; the rule matches routes of
+	// any method if empty.
+	Methods []string
+	// Path are the segments of the paths of the routes, as registered. A
+	// segment "*" matches any single segment, including path variables, and
+	// a final segment "**" matches any remaining segments, if any.
+	Path   []string
+	Policy RoutePolicy
+}
+
+// Matches returns true if the rule matches the route of the given handler.
+func (rr *RouteRule) Matches(h *Handler) bool {
+	if len(rr.Methods) > 0 && !containsString(rr.Methods, h.Method) {
+		return false
+	}
+	for i, seg := range rr.Path {
+		if seg == "**" && i == len(rr.Path)-1 {
+			return true
+		}
+		if i >= len(h.Path) || (seg != "*" && seg != h.Path[i]) {
+			return false
+		}
+	}
+	return len(rr.Path) == len(h.Path)
+}
+
+// Access requires callers of the routes of a server to authenticate, except
+// for those its route policy table makes public.
+type Access struct {
+	// Rules is the route policy table. The policy of a route is that of the
+	// first rule that matches it, and routes matched by no rule require
+	// authentication.
+	Rules []RouteRule
+	// Authenticate returns an error wrapping data.ErrUnauthorized if the
+	// given request carries no valid credentials.
+	Authenticate func(r *http.Request) error
+}
+
+// Policy returns the policy of the route of the given handler.
+func (a *Access) Policy(h *Handler) RoutePolicy {
+	for i := range a.Rules {
+		if a.Rules[i].Matches(h) {
+			return a.Rules[i].Policy
+		}
+	}
+	return RouteAuthenticated
+}
+
+// guard returns a HTTP handler function that refuses the requests to the
+// given handler without valid credentials, unless the server has no Access
+// or its route is public. Policies are looked up once, as handlers are
+// registered.
+func (s *Server) guard(h *Handler, f httprouter.Handle) httprouter.Handle {
+	if s.Access == nil || s.Access.Policy(h) == RoutePublic {
+		return f
+	}
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		err := s.Access.Authenticate(r)
+		if err != nil {
+			EncodeResponseErrorFor(ErrorAuthentication, err, w)
+			return
+		}
+		f(w, r, ps)
+	}
+}
+
+// containsString returns true if the given list contains the given string.
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package web_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/julienschmidt/httprouter"
+)
+
+// TestAccess tests that anonymous callers are served only the routes made
+// public by the first matching rule of the route policy table, and that
+// callers with credentials are served all of them.
+func TestAccess(t *testing.T) {
+	s := web.NewServer("")
+	s.Access = &web.Access{
+		Rules: []web.RouteRule{
+			{Methods: []string{http.MethodGet}, Path: []string{"media", "**"},
+				Policy: web.RoutePublic},
+			{Path: []string{"list", "*", "items"}, Policy: web.RouteAuthenticated},
+			{Path: []string{"list", "**"}, Policy: web.RoutePublic},
+		},
+		Authenticate: func(r *http.Request) error {
+			if r.Header.Get("Authorization") == "" {
+				return fmt.Errorf("credentials required: %w", data.ErrUnauthorized)
+			}
+			return nil
+		},
+	}
+	ok := func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {}
+	for _, h := range []web.Handler{
+		{Method: http.MethodGet, Path: []string{"media"}},
+		{Method: http.MethodGet, Path: []string{"media", ":id", "staff"}},
+		{Method: http.MethodPost, Path: []string{"media"}},
+		{Method: http.MethodGet, Path: []string{"list", ":id"}},
+		{Method: http.MethodGet, Path: []string{"list", ":id", "items"}},
+		{Method: http.MethodGet, Path: []string{"user", ":id", "sessions"}},
+	} {
+		h.Func = ok
+		s.RegisterHandler(h)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodGet, "/media", http.StatusOK},
+		{http.MethodGet, "/api/v1/media/1/staff", http.StatusOK},
+		{http.MethodPost, "/media", http.StatusUnauthorized},
+		{http.MethodGet, "/list/1", http.StatusOK},
+		{http.MethodGet, "/list/1/items", http.StatusUnauthorized},
+		{http.MethodGet, "/user/1/sessions", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		for _, auth := range []bool{false, true} {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			status := tt.status
+			if auth {
+				r.Header.Set("Authorization", "Bearer token")
+				status = http.StatusOK
+			}
+			w := httptest.NewRecorder()
+			s.Router.ServeHTTP(w, r)
+			if w.Code != status {
+				t.Errorf("%s %s, credentials %t: expected status %d, got %d",
+					tt.method, tt.path, auth, status, w.Code)
+			}
+		}
+	}
+
+	// The status of the server is registered before the policy applies
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected the status to be served, got %d", w.Code)
+	}
+}
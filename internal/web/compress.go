@@ -0,0 +1,223 @@
+package web
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// HeaderAcceptEncoding is a HTTP header name that states the encodings
+	// the caller accepts response bodies in.
+	HeaderAcceptEncoding = "Accept-Encoding"
+	// HeaderContentEncoding is a HTTP header name that states the encoding of
+	// the response body.
+	HeaderContentEncoding = "Content-Encoding"
+	// HeaderVary is a HTTP header name that states the request headers the
+	// response depends on.
+	HeaderVary = "Vary"
+
+	// encodingGzip and encodingDeflate are the names of the encodings bodies
+	// are compressed in.
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+)
+
+// DefaultCompressionMinSize is the size in bytes of the smallest response body
+// compressed by default; smaller ones are not worth the overhead.
+const DefaultCompressionMinSize = 1024
+
+// DefaultCompressionContentTypes are the media types of the response bodies
+// compressed by default.
+var DefaultCompressionContentTypes = []string{
+	HeaderContentTypeValJSON, HeaderContentTypeValXML, HeaderContentTypeValMsgpack,
+	"text/csv", "text/plain",
+}
+
+// Compression compresses response bodies with gzip or deflate, as accepted in
+// the Accept-Encoding header of the request.
+type Compression struct {
+	// MinSize is the size in bytes of the smallest body compressed.
+	MinSize int
+	// ContentTypes are the media types of the bodies compressed, without
+	// parameters.
+	ContentTypes []string
+}
+
+// Handler returns a HTTP handler that compresses the responses of the given
+// handler. Responses that are flushed before MinSize bytes are written, such
+// as streams, are not compressed.
+func (c *Compression) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add(HeaderVary, HeaderAcceptEncoding)
+		encoding := negotiateEncoding(r.Header.Get(HeaderAcceptEncoding))
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, compression: c, encoding: encoding}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressible returns true if bodies of the given content type are
+// compressed.
+func (c *Compression) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range c.ContentTypes {
+		if strings.EqualFold(t, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateEncoding returns the compression encoding of highest quality in
+// the given Accept-Encoding header, preferring gzip, or an empty string if
+// none is accepted.
+func negotiateEncoding(accept string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name == "*" {
+			name = encodingGzip
+		}
+		if name != encodingGzip && name != encodingDeflate {
+			continue
+		}
+
+		q := 1.0
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				v, err := strconv.ParseFloat(p[2:], 64)
+				if err == nil {
+					q = v
+				}
+			}
+		}
+		if q > bestQ || (q == bestQ && name == encodingGzip) {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// compressor is a compressing writer of gzip or flate.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressWriter holds a response body back until MinSize bytes are written,
+// then compresses it if its content type is compressible. The response is
+// passed through uncompressed if it is flushed or finished before then.
+type compressWriter struct {
+	http.ResponseWriter
+	compression *Compression
+	encoding    string
+	status      int
+	buf         bytes.Buffer
+	started     bool
+	// cw compresses the body once started, or is nil if it is passed through.
+	cw compressor
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.started {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.buf.Write(p)
+		if w.buf.Len() < w.compression.MinSize {
+			return len(p), nil
+		}
+		return len(p), w.start()
+	}
+	if w.cw != nil {
+		return w.cw.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// start sends the header, compressing the body if enough of it is held back
+// and it is of a compressible content type, and the body held back.
+func (w *compressWriter) start() error {
+	w.started = true
+
+	h := w.Header()
+	n := w.buf.Len()
+	if n > 0 && n >= w.compression.MinSize && h.Get(HeaderContentEncoding) == "" &&
+		w.compression.compressible(h.Get(HeaderContentType)) {
+		h.Set(HeaderContentEncoding, w.encoding)
+		h.Del("Content-Length")
+		if w.encoding == encodingGzip {
+			w.cw = gzip.NewWriter(w.ResponseWriter)
+		} else {
+			// The level is valid, so no error is returned
+			w.cw, _ = flate.NewWriter(w.ResponseWriter, flate.DefaultCompression)
+		}
+	}
+
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if n == 0 {
+		return nil
+	}
+
+	var err error
+	if w.cw != nil {
+		_, err = w.cw.Write(w.buf.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+	return err
+}
+
+// Flush sends the response written so far, so that streaming handlers keep
+// working.
+func (w *compressWriter) Flush() {
+	if !w.started {
+		w.start()
+	}
+	if w.cw != nil {
+		w.cw.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close sends the rest of the response.
+func (w *compressWriter) Close() error {
+	if !w.started {
+		err := w.start()
+		if err != nil {
+			return err
+		}
+	}
+	if w.cw != nil {
+		return w.cw.Close()
+	}
+	return nil
+}
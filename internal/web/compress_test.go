@@ -0,0 +1,72 @@
+package web_test
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/web"
+)
+
+// TestCompression tests that bodies are compressed only if accepted, large
+// enough and of a compressible content type.
+func TestCompression(t *testing.T) {
+	c := web.Compression{
+		MinSize:      16,
+		ContentTypes: web.DefaultCompressionContentTypes,
+	}
+	large := strings.Repeat("nao", 100)
+
+	tests := []struct {
+		accept      string
+		contentType string
+		body        string
+		encoding    string
+	}{
+		{"gzip, deflate", web.HeaderContentTypeValJSON, large, "gzip"},
+		{"gzip;q=0.5, deflate", "text/csv; charset=utf-8", large, "deflate"},
+		{"", web.HeaderContentTypeValJSON, large, ""},
+		{"gzip", web.HeaderContentTypeValJSON, "small", ""},
+		{"gzip", "application/octet-stream", large, ""},
+	}
+	for _, tt := range tests {
+		h := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(web.HeaderContentType, tt.contentType)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(tt.body))
+		}))
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.accept != "" {
+			r.Header.Set(web.HeaderAcceptEncoding, tt.accept)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != http.StatusCreated {
+			t.Errorf("%q: expected status %d, got %d", tt.accept, http.StatusCreated, w.Code)
+		}
+		enc := w.Header().Get(web.HeaderContentEncoding)
+		if enc != tt.encoding {
+			t.Errorf("%q: expected encoding %q, got %q", tt.accept, tt.encoding, enc)
+			continue
+		}
+		if enc == "" && w.Body.String() != tt.body {
+			t.Errorf("%q: expected body passed through, got %q", tt.accept, w.Body.String())
+		}
+		if enc != "gzip" {
+			continue
+		}
+
+		zr, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatalf("%q: failed to read gzip body: %v", tt.accept, err)
+		}
+		body, err := ioutil.ReadAll(zr)
+		if err != nil || string(body) != tt.body {
+			t.Errorf("%q: expected body to decompress, got %q, %v", tt.accept, body, err)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// QueryDryRun is the name of the query parameter that asks write endpoints
+// to clean and validate the entities written and respond with them, without
+// persisting them, if true.
+const QueryDryRun = "dry_run"
+
+// HeaderDryRun is a HTTP header name set on the responses to dry runs.
+const HeaderDryRun = "Dry-Run"
+
+// ErrorDryRun is the generic error message given when a dry run is asked of
+// an endpoint that does not support it.
+const ErrorDryRun = "error starting dry run"
+
+// errDryRunUnsupported is the error of dry runs asked of handlers that do
+// not support them.
+var errDryRunUnsupported = errors.New("endpoint does not support dry runs")
+
+// IsDryRun returns true if the given request asks for a dry run.
+func IsDryRun(r *http.Request) bool {
+	return r.URL.Query().Get(QueryDryRun) == "true"
+}
+
+// dryRun returns the given request in a dry run if it asks for one and the
+// handler supports them, or encodes the error response and returns false if
+// it does not.
+func (h *Handler) dryRun(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	if !IsDryRun(r) {
+		return r, true
+	}
+	if !h.DryRun {
+		EncodeResponseErrorBadRequest(ErrorDryRun, errDryRunUnsupported, w)
+		return nil, false
+	}
+	w.Header().Set(HeaderDryRun, "true")
+	return r.WithContext(db.WithDryRun(r.Context())), true
+}
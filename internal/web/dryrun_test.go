@@ -0,0 +1,47 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	"github.com/julienschmidt/httprouter"
+)
+
+// TestDryRun tests that dry runs are passed to the handlers that support them
+// in the context of the request, and refused by the others.
+func TestDryRun(t *testing.T) {
+	var dry bool
+	h := web.Handler{
+		Method: http.MethodPost,
+		Path:   []string{"media"},
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			dry = db.IsDryRun(r.Context())
+		},
+	}
+
+	tests := []struct {
+		supported bool
+		query     string
+		status    int
+		dry       bool
+	}{
+		{false, "", http.StatusOK, false},
+		{false, "?dry_run=true", http.StatusBadRequest, false},
+		{true, "?dry_run=false", http.StatusOK, false},
+		{true, "?dry_run=true", http.StatusOK, true},
+	}
+	for _, tt := range tests {
+		dry = false
+		h.DryRun = tt.supported
+		r := httptest.NewRequest(http.MethodPost, "/media"+tt.query, nil)
+		w := httptest.NewRecorder()
+		h.HandlerFunc()(w, r, nil)
+		if w.Code != tt.status || dry != tt.dry {
+			t.Errorf("supported %t, query %q: expected status %d and dry run %t, got %d and %t",
+				tt.supported, tt.query, tt.status, tt.dry, w.Code, dry)
+		}
+	}
+}
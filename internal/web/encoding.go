@@ -0,0 +1,241 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+const (
+	// HeaderContentTypeValXML is a value for the content type header for XML.
+	HeaderContentTypeValXML = "application/xml"
+	// HeaderContentTypeValMsgpack is a value for the content type header for
+	// MessagePack.
+	HeaderContentTypeValMsgpack = "application/msgpack"
+)
+
+// Encoder encodes response bodies in some media type. Handlers write their
+// bodies as JSON, which is decoded and encoded again by the Encoder asked for
+// in the Accept header of the request.
+type Encoder interface {
+	// ContentType returns the value of the content type header of the
+	// encoded bodies.
+	ContentType() string
+	// Encode writes the given decoded JSON value, in which numbers are
+	// json.Number, to the given writer.
+	Encode(w io.Writer, v interface{}) error
+}
+
+// Encoders are the Encoders of the response formats clients may ask for in
+// the Accept header, by media type. Formats are added by registering their
+// Encoders here before the server is started.
+var Encoders = map[string]Encoder{
+	HeaderContentTypeValJSON:    JSONEncoder{},
+	HeaderContentTypeValXML:     XMLEncoder{},
+	"text/xml":                  XMLEncoder{},
+	HeaderContentTypeValMsgpack: MsgpackEncoder{},
+	"application/x-msgpack":     MsgpackEncoder{},
+}
+
+// NegotiateEncoder returns the Encoder of the first media type in the Accept
+// header of the given request that has one, or JSONEncoder if none does.
+// Vendor media types that ask for a version of the API select the Encoder by
+// their suffix, as in application/vnd.naos.v1+xml.
+func NegotiateEncoder(r *http.Request) Encoder {
+	for _, accept := range r.Header[HeaderAccept] {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+
+			if strings.HasPrefix(mediaType, mediaTypeVendorPrefix) {
+				parts := strings.SplitN(mediaType, "+", 2)
+				if len(parts) < 2 {
+					continue
+				}
+				mediaType = "application/" + parts[1]
+			}
+			enc, ok := Encoders[mediaType]
+			if ok {
+				return enc
+			}
+		}
+	}
+	return JSONEncoder{}
+}
+
+// JSONEncoder encodes response bodies as JSON, the format handlers write.
+type JSONEncoder struct{}
+
+// ContentType returns HeaderContentTypeValJSON.
+func (JSONEncoder) ContentType() string {
+	return HeaderContentTypeValJSON
+}
+
+// Encode writes the given value as JSON.
+func (JSONEncoder) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// XMLEncoder encodes response bodies as XML under a response element. The
+// fields of objects are elements named by their keys, or entry elements
+// with a key attribute if the keys are not valid names, and the elements of
+// arrays are item elements. Null values are empty elements.
+type XMLEncoder struct{}
+
+// xmlRoot is the name of the root element of XML response bodies.
+const xmlRoot = "response"
+
+// ContentType returns HeaderContentTypeValXML.
+func (XMLEncoder) ContentType() string {
+	return HeaderContentTypeValXML
+}
+
+// Encode writes the given value as XML.
+func (XMLEncoder) Encode(w io.Writer, v interface{}) error {
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	err = encodeXMLElement(enc, xml.StartElement{Name: xml.Name{Local: xmlRoot}}, v)
+	if err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+func encodeXMLElement(enc *xml.Encoder, start xml.StartElement, v interface{}) error {
+	err := enc.EncodeToken(start)
+	if err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		// Sort keys, so that documents are stable
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			el := xml.StartElement{Name: xml.Name{Local: k}}
+			if !isXMLName(k) {
+				el = xml.StartElement{
+					Name: xml.Name{Local: "entry"},
+					Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: k}},
+				}
+			}
+			err = encodeXMLElement(enc, el, v[k])
+			if err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, e := range v {
+			err = encodeXMLElement(enc, xml.StartElement{Name: xml.Name{Local: "item"}}, e)
+			if err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		err = enc.EncodeToken(xml.CharData(fmt.Sprint(v)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+// isXMLName returns true if the given string may be used as the name of an
+// element. Only the ASCII names without colons that the XML specification
+// allows are.
+func isXMLName(s string) bool {
+	if s == "" || strings.HasPrefix(strings.ToLower(s), "xml") {
+		return false
+	}
+	for i, c := range s {
+		letter := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+		if i == 0 && !letter {
+			return false
+		}
+		if !letter && !(c >= '0' && c <= '9') && c != '-' && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// MsgpackEncoder encodes response bodies as MessagePack. Numbers are encoded
+// as integers if they are whole and as floats otherwise.
+type MsgpackEncoder struct{}
+
+// ContentType returns HeaderContentTypeValMsgpack.
+func (MsgpackEncoder) ContentType() string {
+	return HeaderContentTypeValMsgpack
+}
+
+// Encode writes the given value as MessagePack.
+func (MsgpackEncoder) Encode(w io.Writer, v interface{}) error {
+	return msgpack.NewEncoder(w).Encode(msgpackValue(v))
+}
+
+// msgpackValue returns the given decoded JSON value with its numbers
+// converted to integers or floats.
+func msgpackValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, fv := range v {
+			v[k] = msgpackValue(fv)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = msgpackValue(e)
+		}
+	case json.Number:
+		n, err := v.Int64()
+		if err == nil {
+			return n
+		}
+		f, err := v.Float64()
+		if err == nil {
+			return f
+		}
+		return v.String()
+	}
+	return v
+}
+
+// transcodeJSON returns the given JSON document encoded with the given
+// Encoder.
+func transcodeJSON(body []byte, enc Encoder) ([]byte, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	// Keep numbers, such as snowflake IDs, exactly as they were
+	dec.UseNumber()
+	err := dec.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = enc.Encode(&buf, v)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,76 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/julienschmidt/httprouter"
+	"github.com/vmihailenco/msgpack"
+)
+
+// TestNegotiateEncoder tests that JSON responses are encoded in the format
+// asked for in the Accept header, and in JSON otherwise.
+func TestNegotiateEncoder(t *testing.T) {
+	h := web.Handler{
+		Method: http.MethodGet,
+		Path:   []string{"media"},
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			web.EncodeResponseBody(struct {
+				ID     int64
+				Titles []string
+				En     bool `json:"en"`
+			}{1234567890123, []string{"Bebop"}, true}, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+
+	tests := []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"", web.HeaderContentTypeValJSON,
+			`{"ID":1234567890123,"Titles":["Bebop"],"en":true}` + "\n"},
+		{"text/html, application/xml", web.HeaderContentTypeValXML,
+			`<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+				`<response><ID>1234567890123</ID><Titles><item>Bebop</item></Titles>` +
+				`<en>true</en></response>`},
+		{"application/vnd.naos.v1+xml", web.HeaderContentTypeValXML, ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/media", nil)
+		if tt.accept != "" {
+			r.Header.Set(web.HeaderAccept, tt.accept)
+		}
+		w := httptest.NewRecorder()
+		h.HandlerFunc()(w, r, nil)
+
+		if ct := w.Header().Get(web.HeaderContentType); ct != tt.contentType {
+			t.Errorf("%q: expected content type %q, got %q", tt.accept, tt.contentType, ct)
+		}
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("%q: expected body %q, got %q", tt.accept, tt.body, w.Body.String())
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/media", nil)
+	r.Header.Set(web.HeaderAccept, web.HeaderContentTypeValMsgpack)
+	w := httptest.NewRecorder()
+	h.HandlerFunc()(w, r, nil)
+
+	var v struct {
+		ID     int64
+		Titles []string
+	}
+	err := msgpack.Unmarshal(w.Body.Bytes(), &v)
+	if err != nil {
+		t.Fatalf("failed to decode MessagePack: %v", err)
+	}
+	if v.ID != 1234567890123 || len(v.Titles) != 1 || v.Titles[0] != "Bebop" {
+		t.Errorf("unexpected MessagePack body %+v", v)
+	}
+}
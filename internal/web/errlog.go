@@ -0,0 +1,84 @@
+package web
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultErrorLogSize is the number of most recent errors kept by an
+// ErrorLog if not configured.
+const DefaultErrorLogSize = 50
+
+// LoggedError is a single error logged.
+type LoggedError struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+	// Fields are the fields logged with the error, such as the status code
+	// of the response it was served in.
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+// ErrorLog is a logrus hook that keeps the most recently logged errors, such
+// as those of server error responses and failed background tasks. It is safe
+// for concurrent use.
+type ErrorLog struct {
+	// Size is the number of most recent errors kept.
+	Size int
+
+	mu     sync.Mutex
+	errors []LoggedError
+}
+
+// NewErrorLog returns an ErrorLog that keeps the given number of errors.
+func NewErrorLog(size int) *ErrorLog {
+	if size <= 0 {
+		size = DefaultErrorLogSize
+	}
+	return &ErrorLog{Size: size}
+}
+
+// Levels returns the levels of the entries kept, those of errors.
+func (l *ErrorLog) Levels() []log.Level {
+	return []log.Level{log.PanicLevel, log.FatalLevel, log.ErrorLevel}
+}
+
+// Fire keeps the given entry, dropping the oldest kept if full.
+func (l *ErrorLog) Fire(e *log.Entry) error {
+	le := LoggedError{
+		Time:    e.Time,
+		Level:   e.Level.String(),
+		Message: e.Message,
+	}
+	if len(e.Data) > 0 {
+		le.Fields = make(map[string]interface{}, len(e.Data))
+		for k, v := range e.Data {
+			if err, ok := v.(error); ok {
+				v = err.Error()
+			}
+			le.Fields[k] = v
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errors = append(l.errors, le)
+	if len(l.errors) > l.Size {
+		l.errors = l.errors[len(l.errors)-l.Size:]
+	}
+	return nil
+}
+
+// Errors returns the errors kept, most recent first.
+func (l *ErrorLog) Errors() []LoggedError {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	list := make([]LoggedError, len(l.errors))
+	for i, le := range l.errors {
+		list[len(list)-1-i] = le
+	}
+	return list
+}
@@ -0,0 +1,32 @@
+package web_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/web"
+	log "github.com/sirupsen/logrus"
+)
+
+// TestErrorLog tests that only the most recent errors are kept, most recent
+// first, with their fields.
+func TestErrorLog(t *testing.T) {
+	errs := web.NewErrorLog(2)
+	logger := log.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(errs)
+
+	logger.Error("first")
+	logger.Warn("not an error")
+	logger.WithError(errors.New("cause")).Error("second")
+	logger.Error("third")
+
+	list := errs.Errors()
+	if len(list) != 2 || list[0].Message != "third" || list[1].Message != "second" {
+		t.Fatalf("expected the two most recent errors, got %+v", list)
+	}
+	if list[1].Fields[log.ErrorKey] != "cause" {
+		t.Errorf("expected the error field to be kept, got %+v", list[1].Fields)
+	}
+}
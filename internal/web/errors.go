@@ -0,0 +1,135 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Dophin2009/nao/internal/data"
+	log "github.com/sirupsen/logrus"
+)
+
+// Error codes identify the kind of an error to API clients, both in REST
+// error responses and in the extensions of GraphQL errors.
+const (
+	ErrorCodeNotFound     = "NOT_FOUND"
+	ErrorCodeInvalid      = "INVALID"
+	ErrorCodeConflict     = "CONFLICT"
+	ErrorCodeUnauthorized = "UNAUTHORIZED"
+	ErrorCodeUnavailable  = "UNAVAILABLE"
+	ErrorCodeLocked       = "LOCKED"
+	ErrorCodeInternal     = "INTERNAL"
+
+	ErrorCodeForbidden            = "FORBIDDEN"
+	ErrorCodeNotAcceptable        = "NOT_ACCEPTABLE"
+	ErrorCodeUnsupportedMediaType = "UNSUPPORTED_MEDIA_TYPE"
+	ErrorCodeTimeout              = "TIMEOUT"
+)
+
+// ErrorDebug includes the detail of internal server errors in error
+// responses; it is only meant for development.
+var ErrorDebug = false
+
+// errorKinds maps the errors of the data layer to the HTTP status codes and
+// error codes they are reported with. Requests whose contexts time out or are
+// cancelled, stopping their database scans, are reported as unavailable.
+var errorKinds = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{data.ErrNotFound, http.StatusNotFound, ErrorCodeNotFound},
+	{data.ErrInvalid, http.StatusBadRequest, ErrorCodeInvalid},
+	{data.ErrConflict, http.StatusConflict, ErrorCodeConflict},
+	{data.ErrUnauthorized, http.StatusUnauthorized, ErrorCodeUnauthorized},
+	{data.ErrUnavailable, http.StatusServiceUnavailable, ErrorCodeUnavailable},
+	{data.ErrLocked, http.StatusLocked, ErrorCodeLocked},
+	{context.DeadlineExceeded, http.StatusServiceUnavailable, ErrorCodeTimeout},
+	{context.Canceled, http.StatusServiceUnavailable, ErrorCodeUnavailable},
+}
+
+// ErrorStatus returns the HTTP status code for the given error, by the data
+// layer error it wraps. Errors of any other kind are internal server errors.
+func ErrorStatus(err error) int {
+	for _, k := range errorKinds {
+		if errors.Is(err, k.err) {
+			return k.status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// ErrorCode returns the error code for the given error, by the data layer
+// error it wraps.
+func ErrorCode(err error) string {
+	for _, k := range errorKinds {
+		if errors.Is(err, k.err) {
+			return k.code
+		}
+	}
+	return ErrorCodeInternal
+}
+
+// statusErrorCodes are the error codes of the HTTP status codes of errors
+// responded with by status rather than by kind.
+var statusErrorCodes = map[int]string{
+	http.StatusBadRequest:           ErrorCodeInvalid,
+	http.StatusUnauthorized:         ErrorCodeUnauthorized,
+	http.StatusForbidden:            ErrorCodeForbidden,
+	http.StatusNotFound:             ErrorCodeNotFound,
+	http.StatusNotAcceptable:        ErrorCodeNotAcceptable,
+	http.StatusConflict:             ErrorCodeConflict,
+	http.StatusUnsupportedMediaType: ErrorCodeUnsupportedMediaType,
+	http.StatusLocked:               ErrorCodeLocked,
+	http.StatusServiceUnavailable:   ErrorCodeUnavailable,
+}
+
+// StatusErrorCode returns the error code for the given HTTP status code of
+// an error. Other client errors are invalid requests, and other server errors
+// internal.
+func StatusErrorCode(status int) string {
+	if code, ok := statusErrorCodes[status]; ok {
+		return code
+	}
+	if status < http.StatusInternalServerError {
+		return ErrorCodeInvalid
+	}
+	return ErrorCodeInternal
+}
+
+// ErrorFields returns the problems with the fields of the ValidationError
+// wrapped by the given error, or nil if it wraps none.
+func ErrorFields(err error) []data.FieldError {
+	var verr *data.ValidationError
+	if !errors.As(err, &verr) {
+		return nil
+	}
+	return verr.Fields
+}
+
+// EncodeResponseErrorFor encodes an error response with the status code and
+// error code of the given error.
+func EncodeResponseErrorFor(err string, debug error, w http.ResponseWriter) {
+	encodeResponseError(err, debug, ErrorStatus(debug), ErrorCode(debug), w)
+}
+
+// encodeResponseError encodes an error response with the given status code
+// and error code, tagged with the ID of the request set by the server.
+func encodeResponseError(err string, debug error, status int, code string, w http.ResponseWriter) {
+	errorResponse := NewErrorResponse(err, status, code, debug)
+	errorResponse.RequestID = w.Header().Get(HeaderRequestID)
+	logServerError(status, err, debug, errorResponse.RequestID)
+	w.WriteHeader(status)
+	EncodeResponseBody(errorResponse, w)
+}
+
+// logServerError logs the given error if the status code is that of an
+// internal server error, as those are not the fault of the caller.
+func logServerError(status int, err string, debug error, requestID string) {
+	if status == http.StatusInternalServerError {
+		log.WithFields(log.Fields{
+			"status":    status,
+			"requestId": requestID,
+		}).Errorf("%s: %v", err, debug)
+	}
+}
@@ -0,0 +1,81 @@
+package web_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/web"
+)
+
+// TestEncodeResponseErrorForValidation tests that the problems of a wrapped
+// ValidationError are listed by field in the error response.
+func TestEncodeResponseErrorForValidation(t *testing.T) {
+	var verr data.ValidationError
+	verr.Add("Body", data.FieldRequired, "must not be empty")
+	verr.Add("Score", data.FieldOutOfRange, "must be between 0 and 100")
+
+	w := httptest.NewRecorder()
+	web.EncodeResponseErrorFor(web.ErrorInternalServer,
+		fmt.Errorf("failed to create Review: %w", &verr), w)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	var res web.ErrorResponse
+	err := json.Unmarshal(w.Body.Bytes(), &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Code != web.ErrorCodeInvalid || len(res.Fields) != 2 ||
+		res.Fields[0] != verr.Fields[0] || res.Fields[1] != verr.Fields[1] {
+		t.Errorf("expected invalid error with field errors %+v, got %+v", verr.Fields, res)
+	}
+}
+
+// TestEncodeResponseErrorEnvelope tests that error responses carry their
+// status, error code and request ID, and the detail of internal server errors
+// only if ErrorDebug is set.
+func TestEncodeResponseErrorEnvelope(t *testing.T) {
+	decode := func(w *httptest.ResponseRecorder) web.ErrorResponse {
+		t.Helper()
+		var res web.ErrorResponse
+		err := json.Unmarshal(w.Body.Bytes(), &res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	w := httptest.NewRecorder()
+	w.Header().Set(web.HeaderRequestID, "req-1")
+	web.EncodeResponseErrorFor(web.ErrorInternalServer, errors.New("bucket missing"), w)
+	res := decode(w)
+	if res.Status != http.StatusInternalServerError || res.Code != web.ErrorCodeInternal ||
+		res.RequestID != "req-1" {
+		t.Errorf("expected internal error of request req-1, got %+v", res)
+	}
+	if res.Debug != "" {
+		t.Errorf("expected detail of internal error to be hidden, got %q", res.Debug)
+	}
+
+	web.ErrorDebug = true
+	defer func() { web.ErrorDebug = false }()
+	w = httptest.NewRecorder()
+	web.EncodeResponseErrorFor(web.ErrorInternalServer, errors.New("bucket missing"), w)
+	if res := decode(w); res.Debug != "bucket missing" {
+		t.Errorf("expected detail of internal error with debug set, got %q", res.Debug)
+	}
+
+	w = httptest.NewRecorder()
+	web.EncodeResponseErrorForbidden(web.ErrorAuthorization, errors.New("not an Admin"), w)
+	res = decode(w)
+	if res.Status != http.StatusForbidden || res.Code != web.ErrorCodeForbidden ||
+		res.Debug != "not an Admin" {
+		t.Errorf("expected forbidden error with detail, got %+v", res)
+	}
+}
@@ -0,0 +1,198 @@
+package web
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+
+	json "github.com/json-iterator/go"
+)
+
+// QueryFields is the query parameter of GET requests that selects the fields
+// of the response body, as a comma-separated list such as
+// fields=Titles,StartDate,Type. Fields of nested objects are selected with
+// dots, such as fields=sessions.Device.
+const QueryFields = "fields"
+
+// identityFields are the fields kept in projected objects even if not
+// selected, so that callers can tell the projected records apart.
+var identityFields = []string{"meta", "id"}
+
+// FieldSelection is a set of selected fields by lowercased name, each with
+// the selection of its nested fields; a nil selection selects all fields.
+type FieldSelection map[string]FieldSelection
+
+// ParseFieldSelection returns the selection of the given comma-separated
+// list of fields, or nil if it selects none.
+func ParseFieldSelection(s string) FieldSelection {
+	var fs FieldSelection
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if fs == nil {
+			fs = FieldSelection{}
+		}
+		fs.add(strings.Split(strings.ToLower(field), "."))
+	}
+	return fs
+}
+
+func (fs FieldSelection) add(path []string) {
+	name := path[0]
+	sub, ok := fs[name]
+	if len(path) == 1 {
+		// Selecting a field entirely overrides selections of its fields
+		fs[name] = nil
+		return
+	}
+	if ok && sub == nil {
+		return
+	}
+	if sub == nil {
+		sub = FieldSelection{}
+		fs[name] = sub
+	}
+	sub.add(path[1:])
+}
+
+// Project returns the given decoded JSON value with only the selected fields
+// of its objects, and of the objects of its arrays. Names are matched
+// case-insensitively.
+func (fs FieldSelection) Project(v interface{}) interface{} {
+	if fs == nil {
+		return v
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(fs))
+		for k, fv := range v {
+			name := strings.ToLower(k)
+			sub, ok := fs[name]
+			if ok {
+				obj[k] = sub.Project(fv)
+			} else if isIdentityField(name) {
+				obj[k] = fv
+			}
+		}
+		return obj
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, e := range v {
+			list[i] = fs.Project(e)
+		}
+		return list
+	}
+	return v
+}
+
+func isIdentityField(name string) bool {
+	for _, f := range identityFields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ProjectJSON returns the given JSON document with only the selected fields.
+func ProjectJSON(body []byte, fs FieldSelection) ([]byte, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	// Keep numbers, such as snowflake IDs, exactly as they were
+	dec.UseNumber()
+	err := dec.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+
+	// Encode with sorted keys, so that projections are stable
+	var buf bytes.Buffer
+	err = json.ConfigCompatibleWithStandardLibrary.NewEncoder(&buf).Encode(fs.Project(v))
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// heldWriter holds a response body back to project it to the selected
+// fields, or to encode it in the negotiated format, once the handler is done.
+// Responses that are flushed, such as streams, are passed through untouched.
+type heldWriter struct {
+	http.ResponseWriter
+	// fields is the selection the body is projected to, if not nil.
+	fields FieldSelection
+	// encoder encodes the body, if not nil.
+	encoder     Encoder
+	status      int
+	buf         bytes.Buffer
+	passthrough bool
+}
+
+func (w *heldWriter) WriteHeader(status int) {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+}
+
+func (w *heldWriter) Write(p []byte) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.Write(p)
+	}
+	return w.buf.Write(p)
+}
+
+// Flush sends the response held so far untouched and passes the rest of it
+// through.
+func (w *heldWriter) Flush() {
+	if !w.passthrough {
+		w.passthrough = true
+		w.send(w.buf.Bytes())
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// finish sends the response held back. JSON bodies are projected to the
+// selected fields if the response is successful, and encoded in the
+// negotiated format whether or not it is.
+func (w *heldWriter) finish() {
+	if w.passthrough {
+		return
+	}
+
+	body := w.buf.Bytes()
+	ct := w.Header().Get(HeaderContentType)
+	if !strings.HasPrefix(ct, HeaderContentTypeValJSON) || len(body) == 0 {
+		w.send(body)
+		return
+	}
+
+	ok := w.status == 0 || (w.status >= 200 && w.status < 300)
+	if ok && w.fields != nil {
+		projected, err := ProjectJSON(body, w.fields)
+		if err == nil {
+			body = projected
+		}
+	}
+	if w.encoder != nil {
+		encoded, err := transcodeJSON(body, w.encoder)
+		if err == nil {
+			body = encoded
+			w.Header().Set(HeaderContentType, w.encoder.ContentType())
+		}
+	}
+	w.send(body)
+}
+
+func (w *heldWriter) send(body []byte) {
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	w.ResponseWriter.Write(body)
+}
@@ -0,0 +1,40 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/julienschmidt/httprouter"
+)
+
+// TestFieldSelection tests that the JSON responses of GET handlers are
+// projected to the fields selected in the query, keeping identifying fields.
+func TestFieldSelection(t *testing.T) {
+	h := web.Handler{
+		Method: http.MethodGet,
+		Func: func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+			web.EncodeResponseBody([]map[string]interface{}{{
+				"Titles":   []map[string]string{{"String": "Cowboy Bebop", "Language": "en"}},
+				"Type":     "TV",
+				"Synopses": []string{"In the year 2071..."},
+				"Meta":     map[string]int{"ID": 1254051793616896001},
+			}}, w)
+		},
+		ResponseHeaders: map[string]string{
+			web.HeaderContentType: web.HeaderContentTypeValJSON,
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/media?fields=titles.String,Type", nil)
+	h.HandlerFunc()(rec, r, nil)
+
+	body := strings.TrimSpace(rec.Body.String())
+	expected := `[{"Meta":{"ID":1254051793616896001},"Titles":[{"String":"Cowboy Bebop"}],"Type":"TV"}]`
+	if body != expected {
+		t.Errorf("expected %s, got %s", expected, body)
+	}
+}
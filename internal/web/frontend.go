@@ -0,0 +1,107 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	// HeaderCacheControl is a HTTP header name that directs caches.
+	HeaderCacheControl = "Cache-Control"
+
+	// frontendIndex is the name of the page of the frontend served for the
+	// paths of its own routes.
+	frontendIndex = "/index.html"
+)
+
+// DefaultFrontendExclude are the path prefixes never served by a Frontend
+// by default.
+var DefaultFrontendExclude = []string{"/api", "/graphql"}
+
+// DefaultFrontendMaxAge is how long the files of a Frontend are cached by
+// default.
+const DefaultFrontendMaxAge = time.Hour
+
+// Frontend serves the files of a static frontend, such as a single-page
+// application, alongside the API. Its index page is served for browser
+// navigations to paths that are not files, so that the frontend may route
+// them itself, as in history mode.
+type Frontend struct {
+	// FS is the filesystem of the files, such as a directory or an embedded
+	// filesystem, with index.html at its root.
+	FS http.FileSystem
+	// Exclude are the path prefixes passed on to the API, such as /api;
+	// DefaultFrontendExclude if nil.
+	Exclude []string
+	// MaxAge is how long files are cached for, DefaultFrontendMaxAge if 0;
+	// the index page is always revalidated, as it refers to the other files.
+	MaxAge time.Duration
+}
+
+// Handler returns a HTTP handler that serves the GET and HEAD requests for
+// the files of the frontend, and browser navigations that accept HTML to
+// other paths with its index page, passing all other requests on to the
+// given handler, such as those of clients of the API at its unprefixed
+// paths.
+func (f *Frontend) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || f.excludes(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		name := path.Clean("/" + r.URL.Path)
+		if name != "/" && f.serve(w, r, name, false) {
+			return
+		}
+		if !strings.Contains(r.Header.Get(HeaderAccept), "text/html") ||
+			!f.serve(w, r, frontendIndex, true) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// serve serves the file of the given name, returning false if it is not a
+// file of the frontend.
+func (f *Frontend) serve(w http.ResponseWriter, r *http.Request, name string, index bool) bool {
+	file, err := f.FS.Open(name)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil || fi.IsDir() {
+		return false
+	}
+
+	if index || name == frontendIndex {
+		w.Header().Set(HeaderCacheControl, "no-cache")
+	} else {
+		maxAge := f.MaxAge
+		if maxAge <= 0 {
+			maxAge = DefaultFrontendMaxAge
+		}
+		w.Header().Set(HeaderCacheControl,
+			fmt.Sprintf("public, max-age=%d", int(maxAge/time.Second)))
+	}
+	http.ServeContent(w, r, fi.Name(), fi.ModTime(), file)
+	return true
+}
+
+// excludes returns true if the given path is under an excluded prefix.
+func (f *Frontend) excludes(p string) bool {
+	exclude := f.Exclude
+	if exclude == nil {
+		exclude = DefaultFrontendExclude
+	}
+	for _, prefix := range exclude {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
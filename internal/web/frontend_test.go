@@ -0,0 +1,47 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/web"
+)
+
+// TestFrontend tests that files are served with cache headers, that browser
+// navigations fall back to the index page, and that the API is served all
+// other requests.
+func TestFrontend(t *testing.T) {
+	f := web.Frontend{FS: http.Dir("testdata/frontend")}
+	h := f.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("api"))
+	}))
+
+	tests := []struct {
+		method, target, accept string
+		body, cache            string
+	}{
+		{http.MethodGet, "/assets/app.js", "*/*", "console.log", "public, max-age=3600"},
+		{http.MethodGet, "/", "text/html", "<!doctype html>", "no-cache"},
+		{http.MethodGet, "/media/12", "text/html,application/xhtml+xml", "<!doctype html>", "no-cache"},
+		{http.MethodGet, "/media/12", "application/json", "api", ""},
+		{http.MethodGet, "/assets/missing.js", "*/*", "api", ""},
+		{http.MethodGet, "/api/v1/media/12", "text/html", "api", ""},
+		{http.MethodGet, "/graphql", "text/html", "api", ""},
+		{http.MethodPost, "/media", "text/html", "api", ""},
+		{http.MethodGet, "/../index.html", "*/*", "<!doctype html>", "no-cache"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.target, nil)
+		r.Header.Set(web.HeaderAccept, tt.accept)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if !strings.HasPrefix(rec.Body.String(), tt.body) {
+			t.Errorf("%s %s: expected body %q, got %q", tt.method, tt.target, tt.body, rec.Body)
+		}
+		if got := rec.Header().Get(web.HeaderCacheControl); got != tt.cache {
+			t.Errorf("%s %s: expected Cache-Control %q, got %q", tt.method, tt.target, tt.cache, got)
+		}
+	}
+}
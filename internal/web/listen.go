@@ -0,0 +1,95 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// systemdListenFDsStart is the first file descriptor of the sockets passed by
+// systemd socket activation.
+const systemdListenFDsStart = 3
+
+// ListenUnix returns a listener of the Unix domain socket at the given path,
+// with the given file mode, such as for a reverse proxy on the same host. A
+// stale socket left at the path by a server that did not shut down is
+// replaced, but not one that is still listened on. The socket is removed when
+// the listener is closed.
+func ListenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	fi, err := os.Stat(path)
+	if err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("socket %q: %w", path, errors.New("file exists"))
+		}
+		conn, err := net.DialTimeout("unix", path, time.Second)
+		if err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("socket %q: %w", path, errors.New("in use"))
+		}
+		err = os.Remove(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket %q: %w", path, err)
+		}
+	}
+
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		err = os.Chmod(path, mode)
+		if err != nil {
+			lis.Close()
+			return nil, fmt.Errorf("failed to set mode of socket %q: %w", path, err)
+		}
+	}
+	return lis, nil
+}
+
+// SystemdListener returns a listener of the socket passed to the process by
+// systemd socket activation, through the LISTEN_FDS environment variable, of
+// the given name, as in FileDescriptorName= of the socket unit, or the first
+// if the name is empty. The environment variables of socket activation are
+// unset, so that they are not passed on to child processes.
+func SystemdListener(name string) (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, errors.New("no sockets passed by systemd")
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, errors.New("no sockets passed by systemd")
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	i := 0
+	if name != "" {
+		i = -1
+		for j := 0; j < n && j < len(names); j++ {
+			if names[j] == name {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			return nil, fmt.Errorf("socket %q: %w", name, errors.New("not passed by systemd"))
+		}
+	}
+
+	// The listener holds a duplicate of the descriptor, which is closed on
+	// exec unlike those passed
+	f := os.NewFile(uintptr(systemdListenFDsStart+i), "LISTEN_FD_"+strconv.Itoa(i))
+	defer f.Close()
+	lis, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on socket passed by systemd: %w", err)
+	}
+	return lis, nil
+}
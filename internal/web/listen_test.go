@@ -0,0 +1,112 @@
+package web_test
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/web"
+)
+
+// TestListenUnix tests that sockets are created with the given mode, and that
+// stale sockets are replaced but those in use are not.
+func TestListenUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "listen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "naos.sock")
+
+	lis, err := web.ListenUnix(path, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600, got %s", fi.Mode().Perm())
+	}
+
+	_, err = web.ListenUnix(path, 0600)
+	if err == nil {
+		t.Error("expected socket in use to not be replaced")
+	}
+
+	// Leave the socket behind as a crashed server would
+	lis.(*net.UnixListener).SetUnlinkOnClose(false)
+	lis.Close()
+	lis, err = web.ListenUnix(path, 0600)
+	if err != nil {
+		t.Fatalf("expected stale socket to be replaced, got %v", err)
+	}
+	lis.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected socket to be removed on close, got %v", err)
+	}
+}
+
+// TestSystemdListener tests that a socket passed as by systemd is listened on
+// by name, in a child process that inherits it.
+func TestSystemdListener(t *testing.T) {
+	if os.Getenv("NAO_TEST_SYSTEMD") != "" {
+		os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+		lis, err := web.SystemdListener("http")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := lis.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Write([]byte("ok\n"))
+		conn.Close()
+		return
+	}
+
+	_, err := web.SystemdListener("")
+	if err == nil {
+		t.Error("expected no sockets to be passed to the test")
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	f, err := lis.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSystemdListener$")
+	cmd.Env = append(os.Environ(), "NAO_TEST_SYSTEMD=1", "LISTEN_FDS=2",
+		"LISTEN_FDNAMES=grpc:http")
+	cmd.ExtraFiles = []*os.File{f, f}
+	err = cmd.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	conn.Close()
+	if err != nil || line != "ok\n" {
+		t.Errorf("expected response from child, got %q, %v", line, err)
+	}
+	err = cmd.Wait()
+	if err != nil {
+		t.Errorf("child failed: %v", err)
+	}
+}
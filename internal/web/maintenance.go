@@ -0,0 +1,134 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/julienschmidt/httprouter"
+)
+
+// HeaderRetryAfter is a HTTP header name that states the number of seconds
+// after which a refused request may be retried.
+const HeaderRetryAfter = "Retry-After"
+
+// DefaultMaintenanceRetryAfter is the duration callers are told to wait
+// before retrying writes refused in maintenance mode if not configured.
+const DefaultMaintenanceRetryAfter = 5 * time.Minute
+
+// ErrorMaintenance is the generic error message given when a request is
+// refused in maintenance mode.
+const ErrorMaintenance = "server is in maintenance mode"
+
+// MaintenanceState is whether the server is in maintenance mode.
+type MaintenanceState struct {
+	Enabled bool `json:"enabled"`
+	// Since is when maintenance mode was last enabled; nil if disabled.
+	Since *time.Time `json:"since"`
+	// RetryAfter is the number of seconds callers are told to wait before
+	// retrying refused writes.
+	RetryAfter int `json:"retryAfter"`
+}
+
+// Maintenance switches the server in and out of maintenance mode, in which
+// requests that may write, those of methods other than GET, HEAD and
+// OPTIONS, are refused with status Service Unavailable while reads are
+// served, so that backups and migrations may be run on a live server. It is
+// safe for concurrent use.
+type Maintenance struct {
+	mu         sync.RWMutex
+	since      *time.Time
+	retryAfter time.Duration
+}
+
+// NewMaintenance returns a Maintenance switch, in maintenance mode if enabled,
+// that tells callers to retry refused writes after the given duration.
+func NewMaintenance(enabled bool, retryAfter time.Duration) *Maintenance {
+	m := &Maintenance{}
+	m.Set(enabled, retryAfter)
+	return m
+}
+
+// Set switches maintenance mode on or off, telling callers to retry refused
+// writes after the given duration, or DefaultMaintenanceRetryAfter if not
+// positive.
+func (m *Maintenance) Set(enabled bool, retryAfter time.Duration) {
+	if retryAfter <= 0 {
+		retryAfter = DefaultMaintenanceRetryAfter
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retryAfter = retryAfter
+	switch {
+	case !enabled:
+		m.since = nil
+	case m.since == nil:
+		now := time.Now()
+		m.since = &now
+	}
+}
+
+// Enabled returns true if the server is in maintenance mode. A nil
+// Maintenance is never enabled.
+func (m *Maintenance) Enabled() bool {
+	if m == nil {
+		return false
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.since != nil
+}
+
+// State returns whether the server is in maintenance mode.
+func (m *Maintenance) State() MaintenanceState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return MaintenanceState{
+		Enabled:    m.since != nil,
+		Since:      m.since,
+		RetryAfter: int(m.retryAfter / time.Second),
+	}
+}
+
+// Err returns an error wrapping data.ErrUnavailable if the server is in
+// maintenance mode, and nil otherwise.
+func (m *Maintenance) Err() error {
+	if !m.Enabled() {
+		return nil
+	}
+	return errMaintenance()
+}
+
+// Refuse encodes the error response to a write refused in maintenance mode.
+func (m *Maintenance) Refuse(w http.ResponseWriter) {
+	w.Header().Set(HeaderRetryAfter, strconv.Itoa(m.State().RetryAfter))
+	EncodeResponseErrorFor(ErrorMaintenance, errMaintenance(), w)
+}
+
+// errMaintenance returns the error of writes refused in maintenance mode.
+func errMaintenance() error {
+	return fmt.Errorf("%s: writes are refused: %w", ErrorMaintenance, data.ErrUnavailable)
+}
+
+// maintain returns a HTTP handler function that refuses the requests to the
+// given handler while the server is in maintenance mode, unless its method
+// only reads, it is allowed in maintenance mode or the request is a dry run
+// it supports.
+func (s *Server) maintain(h *Handler, f httprouter.Handle) httprouter.Handle {
+	switch {
+	case h.AllowInMaintenance, h.Method == http.MethodGet, h.Method == http.MethodHead,
+		h.Method == http.MethodOptions:
+		return f
+	}
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if s.Maintenance.Enabled() && !(h.DryRun && IsDryRun(r)) {
+			s.Maintenance.Refuse(w)
+			return
+		}
+		f(w, r, ps)
+	}
+}
@@ -0,0 +1,44 @@
+package web_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/web"
+)
+
+// TestMaintenance tests that writes are refused with status Service
+// Unavailable and a Retry-After header only while in maintenance mode.
+func TestMaintenance(t *testing.T) {
+	m := web.NewMaintenance(false, 0)
+	if m.Err() != nil || m.State().RetryAfter != int(web.DefaultMaintenanceRetryAfter/time.Second) {
+		t.Fatalf("expected maintenance mode to be off, got %+v", m.State())
+	}
+
+	m.Set(true, 30*time.Second)
+	state := m.State()
+	if !state.Enabled || state.Since == nil || state.RetryAfter != 30 {
+		t.Fatalf("expected maintenance mode to be on, got %+v", state)
+	}
+	if err := m.Err(); !errors.Is(err, data.ErrUnavailable) {
+		t.Errorf("expected unavailable error, got %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	m.Refuse(rec)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if got := rec.Header().Get(web.HeaderRetryAfter); got != "30" {
+		t.Errorf("expected Retry-After %q, got %q", "30", got)
+	}
+
+	m.Set(false, 0)
+	if m.Enabled() || m.State().Since != nil {
+		t.Errorf("expected maintenance mode to be off, got %+v", m.State())
+	}
+}
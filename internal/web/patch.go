@@ -0,0 +1,397 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	// HeaderContentTypeValMergePatch is a value for the content type header
+	// for JSON Merge Patch documents (RFC 7396).
+	HeaderContentTypeValMergePatch = "application/merge-patch+json"
+	// HeaderContentTypeValJSONPatch is a value for the content type header
+	// for JSON Patch documents (RFC 6902).
+	HeaderContentTypeValJSONPatch = "application/json-patch+json"
+)
+
+// ErrorPatchApplying is the generic error message given when a patch could
+// not be applied.
+const ErrorPatchApplying = "error applying patch"
+
+var (
+	// ErrPatchMediaType is returned when a patch is of a media type that is
+	// not supported.
+	ErrPatchMediaType = errors.New("unsupported patch media type")
+	// ErrPatchInvalid is returned when a patch is not a valid document of its
+	// media type.
+	ErrPatchInvalid = errors.New("invalid patch")
+	// ErrPatchConflict is returned when a patch is valid but does not apply
+	// to the document, such as when a path is missing or a test fails.
+	ErrPatchConflict = errors.New("patch does not apply")
+)
+
+// ApplyPatch applies the given patch, of the given media type, to the given
+// JSON document and returns the patched document. JSON Merge Patch and JSON
+// Patch documents are supported, and plain JSON is applied as a merge patch.
+func ApplyPatch(mediaType string, doc, patch []byte) ([]byte, error) {
+	mt, _, err := mime.ParseMediaType(mediaType)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", mediaType, ErrPatchMediaType)
+	}
+
+	switch mt {
+	case HeaderContentTypeValMergePatch, HeaderContentTypeValJSON:
+		return MergePatch(doc, patch)
+	case HeaderContentTypeValJSONPatch:
+		return JSONPatch(doc, patch)
+	}
+	return nil, fmt.Errorf("%q: %w", mt, ErrPatchMediaType)
+}
+
+// PatchErrorStatus returns the HTTP status code for the given error of
+// ApplyPatch.
+func PatchErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrPatchMediaType):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, ErrPatchConflict):
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+// MergePatch applies the given JSON Merge Patch to the given JSON document:
+// the members of objects in the patch replace those of the document, members
+// set to null are removed, and any other value replaces the target whole.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	d, err := decodeJSONValue(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode document: %w", err)
+	}
+	p, err := decodeJSONValue(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, ErrPatchInvalid)
+	}
+	return json.Marshal(mergePatch(d, p))
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	pm, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	tm, ok := target.(map[string]interface{})
+	if !ok {
+		tm = map[string]interface{}{}
+	}
+	for k, v := range pm {
+		if v == nil {
+			delete(tm, k)
+			continue
+		}
+		tm[k] = mergePatch(tm[k], v)
+	}
+	return tm
+}
+
+// patchOperation is an operation of a JSON Patch document.
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// JSONPatch applies the operations of the given JSON Patch to the given JSON
+// document in order. If any operation fails, none are applied.
+func JSONPatch(doc, patch []byte) ([]byte, error) {
+	d, err := decodeJSONValue(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode document: %w", err)
+	}
+	var ops []patchOperation
+	err = json.Unmarshal(patch, &ops)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, ErrPatchInvalid)
+	}
+
+	for i, op := range ops {
+		d, err = applyPatchOperation(d, &op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s): %w", i, op.Op, err)
+		}
+	}
+	return json.Marshal(d)
+}
+
+func applyPatchOperation(doc interface{}, op *patchOperation) (interface{}, error) {
+	if op.Path == nil {
+		return nil, fmt.Errorf("path: %w", ErrPatchInvalid)
+	}
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, fmt.Errorf("value: %w", ErrPatchInvalid)
+		}
+		value, err = decodeJSONValue(op.Value)
+		if err != nil {
+			return nil, fmt.Errorf("value: %v: %w", err, ErrPatchInvalid)
+		}
+	case "move", "copy":
+		if op.From == nil {
+			return nil, fmt.Errorf("from: %w", ErrPatchInvalid)
+		}
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if strings.HasPrefix(*op.Path, *op.From+"/") {
+				return nil, fmt.Errorf("cannot move %q into itself: %w", *op.From, ErrPatchInvalid)
+			}
+			doc, value, err = removePointer(doc, from)
+			if err != nil {
+				return nil, err
+			}
+			return addPointer(doc, path, value)
+		}
+		value, err = getPointer(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		// Copy the value so that the copies are not changed together
+		buf, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		value, err = decodeJSONValue(buf)
+		if err != nil {
+			return nil, err
+		}
+	case "remove":
+	default:
+		return nil, fmt.Errorf("operation %q: %w", op.Op, ErrPatchInvalid)
+	}
+
+	switch op.Op {
+	case "add", "copy":
+		return addPointer(doc, path, value)
+	case "remove":
+		doc, _, err = removePointer(doc, path)
+		return doc, err
+	case "replace":
+		doc, _, err = removePointer(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return addPointer(doc, path, value)
+	}
+
+	// Test
+	v, err := getPointer(doc, path)
+	if err != nil {
+		return nil, err
+	}
+	if !jsonEqual(v, value) {
+		return nil, fmt.Errorf("test of %q failed: %w", *op.Path, ErrPatchConflict)
+	}
+	return doc, nil
+}
+
+// parsePointer returns the reference tokens of the given JSON Pointer (RFC
+// 6901).
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return []string{}, nil
+	}
+	if p[0] != '/' {
+		return nil, fmt.Errorf("pointer %q: %w", p, ErrPatchInvalid)
+	}
+
+	unescape := strings.NewReplacer("~1", "/", "~0", "~")
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = unescape.Replace(t)
+	}
+	return tokens, nil
+}
+
+// getPointer returns the value at the given path in the given document.
+func getPointer(doc interface{}, path []string) (interface{}, error) {
+	for _, t := range path {
+		switch c := doc.(type) {
+		case map[string]interface{}:
+			v, ok := c[t]
+			if !ok {
+				return nil, fmt.Errorf("member %q missing: %w", t, ErrPatchConflict)
+			}
+			doc = v
+		case []interface{}:
+			i, err := arrayIndex(t, len(c))
+			if err != nil {
+				return nil, err
+			}
+			doc = c[i]
+		default:
+			return nil, fmt.Errorf("%q of a scalar: %w", t, ErrPatchConflict)
+		}
+	}
+	return doc, nil
+}
+
+// addPointer adds the given value at the given path in the given document,
+// replacing the member of an object or inserting into an array, and returns
+// the changed document.
+func addPointer(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return changePointer(doc, path, func(parent interface{}, t string) (interface{}, error) {
+		switch c := parent.(type) {
+		case map[string]interface{}:
+			c[t] = value
+			return c, nil
+		case []interface{}:
+			i := len(c)
+			if t != "-" {
+				var err error
+				i, err = arrayIndex(t, len(c)+1)
+				if err != nil {
+					return nil, err
+				}
+			}
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = value
+			return c, nil
+		}
+		return nil, fmt.Errorf("%q of a scalar: %w", t, ErrPatchConflict)
+	})
+}
+
+// removePointer removes the value at the given path in the given document,
+// and returns the changed document and the value removed.
+func removePointer(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("cannot remove the whole document: %w", ErrPatchConflict)
+	}
+
+	var removed interface{}
+	doc, err := changePointer(doc, path, func(parent interface{}, t string) (interface{}, error) {
+		switch c := parent.(type) {
+		case map[string]interface{}:
+			v, ok := c[t]
+			if !ok {
+				return nil, fmt.Errorf("member %q missing: %w", t, ErrPatchConflict)
+			}
+			removed = v
+			delete(c, t)
+			return c, nil
+		case []interface{}:
+			i, err := arrayIndex(t, len(c))
+			if err != nil {
+				return nil, err
+			}
+			removed = c[i]
+			return append(c[:i], c[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("%q of a scalar: %w", t, ErrPatchConflict)
+	})
+	return doc, removed, err
+}
+
+// changePointer calls change with the parent of the value at the given
+// non-empty path and the last token of the path, replacing the parent with
+// the one returned, and returns the changed document.
+func changePointer(
+	doc interface{}, path []string,
+	change func(parent interface{}, t string) (interface{}, error),
+) (interface{}, error) {
+	if len(path) == 1 {
+		return change(doc, path[0])
+	}
+
+	t := path[0]
+	switch c := doc.(type) {
+	case map[string]interface{}:
+		v, ok := c[t]
+		if !ok {
+			return nil, fmt.Errorf("member %q missing: %w", t, ErrPatchConflict)
+		}
+		v, err := changePointer(v, path[1:], change)
+		if err != nil {
+			return nil, err
+		}
+		c[t] = v
+		return c, nil
+	case []interface{}:
+		i, err := arrayIndex(t, len(c))
+		if err != nil {
+			return nil, err
+		}
+		v, err := changePointer(c[i], path[1:], change)
+		if err != nil {
+			return nil, err
+		}
+		c[i] = v
+		return c, nil
+	}
+	return nil, fmt.Errorf("%q of a scalar: %w", t, ErrPatchConflict)
+}
+
+// arrayIndex parses the given reference token as an index of an array,
+// which must be less than the given bound.
+func arrayIndex(t string, bound int) (int, error) {
+	if t == "" || (len(t) > 1 && t[0] == '0') {
+		return 0, fmt.Errorf("array index %q: %w", t, ErrPatchInvalid)
+	}
+	i, err := strconv.Atoi(t)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("array index %q: %w", t, ErrPatchInvalid)
+	}
+	if i >= bound {
+		return 0, fmt.Errorf("array index %d out of bounds: %w", i, ErrPatchConflict)
+	}
+	return i, nil
+}
+
+// decodeJSONValue decodes the given JSON value, keeping numbers as
+// json.Number so that they are encoded again unchanged.
+func decodeJSONValue(buf []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	var v interface{}
+	err := dec.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// jsonEqual returns true if the given decoded JSON values are equal, numbers
+// compared by value.
+func jsonEqual(a, b interface{}) bool {
+	decode := func(v interface{}) interface{} {
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return nil
+		}
+		var d interface{}
+		_ = json.Unmarshal(buf, &d)
+		return d
+	}
+	return reflect.DeepEqual(decode(a), decode(b))
+}
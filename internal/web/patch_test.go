@@ -0,0 +1,58 @@
+package web_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/web"
+)
+
+// TestApplyPatch tests that merge patches and JSON patches are applied by
+// their media types, and that patches that do not apply are reported as
+// conflicts.
+func TestApplyPatch(t *testing.T) {
+	doc := `{"Body":"Great","Score":80,"Tags":["a","b"],"Meta":{"ID":1234567890123}}`
+
+	tests := []struct {
+		mediaType string
+		patch     string
+		expected  string
+		err       error
+	}{
+		{web.HeaderContentTypeValMergePatch, `{"Score":null,"Meta":{"Version":2}}`,
+			`{"Body":"Great","Meta":{"ID":1234567890123,"Version":2},"Tags":["a","b"]}`, nil},
+		{web.HeaderContentTypeValJSON, `{"Tags":["c"]}`,
+			`{"Body":"Great","Meta":{"ID":1234567890123},"Score":80,"Tags":["c"]}`, nil},
+		{web.HeaderContentTypeValJSONPatch, `[
+			{"op":"test","path":"/Score","value":80.0},
+			{"op":"replace","path":"/Score","value":90},
+			{"op":"add","path":"/Tags/1","value":"c"},
+			{"op":"move","from":"/Tags/0","path":"/Tags/-"},
+			{"op":"copy","from":"/Body","path":"/Title"},
+			{"op":"remove","path":"/Meta"}
+		]`, `{"Body":"Great","Score":90,"Tags":["c","b","a"],"Title":"Great"}`, nil},
+		{web.HeaderContentTypeValJSONPatch, `[{"op":"test","path":"/Score","value":70}]`,
+			"", web.ErrPatchConflict},
+		{web.HeaderContentTypeValJSONPatch, `[{"op":"remove","path":"/Tags/2"}]`,
+			"", web.ErrPatchConflict},
+		{web.HeaderContentTypeValJSONPatch, `[{"op":"jump","path":"/Score"}]`,
+			"", web.ErrPatchInvalid},
+		{"text/plain", `Score=90`, "", web.ErrPatchMediaType},
+	}
+	for _, tt := range tests {
+		patched, err := web.ApplyPatch(tt.mediaType, []byte(doc), []byte(tt.patch))
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%s %s: expected error %v, got %v", tt.mediaType, tt.patch, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %s: %v", tt.mediaType, tt.patch, err)
+			continue
+		}
+		if string(patched) != tt.expected {
+			t.Errorf("%s %s: expected %s, got %s", tt.mediaType, tt.patch, tt.expected, patched)
+		}
+	}
+}
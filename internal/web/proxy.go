@@ -0,0 +1,126 @@
+package web
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Dophin2009/nao/internal/data"
+)
+
+// HeaderForwardedFor is the HTTP header name of the addresses of the client
+// and of the proxies a request was forwarded through, in order.
+const HeaderForwardedFor = "X-Forwarded-For"
+
+// Proxies are the reverse proxies trusted to give the addresses of the
+// clients of the requests they forward in the X-Forwarded-For header.
+type Proxies struct {
+	nets []*net.IPNet
+}
+
+// NewProxies returns the Proxies of the given IP addresses and CIDR ranges,
+// such as 10.0.0.0/8.
+func NewProxies(trusted []string) (*Proxies, error) {
+	p := Proxies{}
+	for _, s := range trusted {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("proxy %q: %w", s, data.ErrInvalid)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			p.nets = append(p.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("proxy %q: %w", s, data.ErrInvalid)
+		}
+		p.nets = append(p.nets, n)
+	}
+	return &p, nil
+}
+
+// Trusts returns true if the given address is that of a trusted proxy.
+func (p *Proxies) Trusts(ip net.IP) bool {
+	for _, n := range p.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client of the given request. If the
+// request is from a trusted proxy, it is the last address of X-Forwarded-For
+// that is not of a trusted proxy, as those before it may be forged by the
+// client; otherwise, it is that of the remote end. Requests over Unix domain
+// sockets are from trusted proxies, as only local processes may connect.
+func (p *Proxies) ClientIP(r *http.Request) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	ip := net.ParseIP(remote)
+	if ip != nil && !p.Trusts(ip) {
+		return remote
+	}
+
+	var hops []string
+	for _, h := range r.Header[HeaderForwardedFor] {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		ip := net.ParseIP(hop)
+		if ip == nil {
+			// Unparseable addresses are not trusted to be of proxies
+			break
+		}
+		remote = hop
+		if !p.Trusts(ip) {
+			break
+		}
+	}
+	return remote
+}
+
+// Handler returns a HTTP handler that sets the remote address of requests to
+// that of their clients, as given by ClientIP, so that handlers see past
+// trusted proxies.
+func (p *Proxies) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.RemoteAddr = p.ClientIP(r)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// BasePath returns a HTTP handler that serves the requests under the given
+// path prefix, such as /nao, with the prefix stripped, and responds to others
+// with 404 Not Found, for serving the API under a path of a reverse proxy.
+func BasePath(prefix string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = strings.TrimPrefix(path, prefix)
+		if r2.URL.Path == "" {
+			r2.URL.Path = "/"
+		}
+		r2.URL.RawPath = ""
+		next.ServeHTTP(w, r2)
+	})
+}
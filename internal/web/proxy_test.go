@@ -0,0 +1,81 @@
+package web_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/web"
+)
+
+// TestProxiesClientIP tests that the addresses of clients are taken from
+// X-Forwarded-For only past trusted proxies.
+func TestProxiesClientIP(t *testing.T) {
+	p, err := web.NewProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		remote    string
+		forwarded []string
+		expected  string
+	}{
+		{"203.0.113.7:4000", nil, "203.0.113.7"},
+		{"203.0.113.7:4000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"10.0.0.2:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+		// Addresses before the first untrusted one may be forged
+		{"10.0.0.2:4000", []string{"1.1.1.1, 198.51.100.1, 192.168.1.1"}, "198.51.100.1"},
+		{"10.0.0.2:4000", []string{"1.1.1.1", "198.51.100.1, 10.1.1.1"}, "198.51.100.1"},
+		{"10.0.0.2:4000", []string{"10.0.0.3"}, "10.0.0.3"},
+		{"10.0.0.2:4000", []string{"garbage"}, "10.0.0.2"},
+		{"10.0.0.2:4000", nil, "10.0.0.2"},
+		// Unix domain sockets are always of trusted proxies
+		{"@", []string{"198.51.100.1"}, "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remote
+		for _, f := range tt.forwarded {
+			r.Header.Add(web.HeaderForwardedFor, f)
+		}
+		if ip := p.ClientIP(r); ip != tt.expected {
+			t.Errorf("%s via %v: expected %s, got %s", tt.remote, tt.forwarded, tt.expected, ip)
+		}
+	}
+
+	_, err = web.NewProxies([]string{"10.0.0.0/33"})
+	if !errors.Is(err, data.ErrInvalid) {
+		t.Errorf("expected invalid range to be invalid, got %v", err)
+	}
+}
+
+// TestBasePath tests that only requests under the base path are served, with
+// it stripped.
+func TestBasePath(t *testing.T) {
+	var path string
+	h := web.BasePath("/nao", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+	}))
+
+	tests := map[string]string{
+		"/nao/api/v1/graphql": "/api/v1/graphql",
+		"/nao":                "/",
+		"/nao/":               "/",
+		"/naos/media":         "",
+		"/media":              "",
+	}
+	for target, expected := range tests {
+		path = ""
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if path != expected {
+			t.Errorf("%s: expected path %q, got %q", target, expected, path)
+		}
+		if expected == "" && rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status %d, got %d", target, http.StatusNotFound, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/trace"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// Panic is a panic recovered from the handler of a request.
+type Panic struct {
+	Time  time.Time
+	Value interface{}
+	// Stack is the stack trace of the panicking goroutine as printed by
+	// runtime/debug, and Frames its frames, innermost first.
+	Stack  string
+	Frames []runtime.Frame
+	// RequestID, Method, Route and URL are those of the request.
+	RequestID string
+	Method    string
+	Route     string
+	URL       string
+}
+
+// Error returns the panic value as a message.
+func (p *Panic) Error() string {
+	return fmt.Sprintf("panic: %v", p.Value)
+}
+
+// PanicReporter reports the panics recovered from handlers, such as to an
+// error tracking service. Panics are reported in the background.
+type PanicReporter interface {
+	ReportPanic(p *Panic) error
+}
+
+// recoverPanics returns a HTTP handler function that responds to requests to
+// the given route whose handler panics with an internal server error, with
+// the ID of the request, if nothing has been written yet. The stack trace is
+// logged, and the panic reported to the PanicReporter of the server, if set.
+// Panics that abort handlers on purpose are passed on to the HTTP server.
+func (s *Server) recoverPanics(route string, f httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		rw := recoverWriter{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			p := newPanic(v, r, route)
+			log.WithFields(log.Fields{
+				"status":    http.StatusInternalServerError,
+				"requestId": p.RequestID,
+				"route":     route,
+			}).Errorf("Recovered %s\n%s", p.Error(), p.Stack)
+			if s.PanicReporter != nil {
+				go func() {
+					err := s.PanicReporter.ReportPanic(p)
+					if err != nil {
+						log.Errorf("Failed to report panic: %v", err)
+					}
+				}()
+			}
+
+			if !rw.wrote {
+				res := NewErrorResponse(ErrorInternalServer, http.StatusInternalServerError,
+					ErrorCodeInternal, p)
+				res.RequestID = p.RequestID
+				rw.WriteHeader(http.StatusInternalServerError)
+				EncodeResponseBody(res, &rw)
+			}
+		}()
+		f(&rw, r, ps)
+	}
+}
+
+// newPanic returns the Panic of the given value recovered from the handler
+// of the given request to the given route. It must be called by the deferred
+// function that recovered the value, so that the stack is still that of the
+// panic.
+func newPanic(v interface{}, r *http.Request, route string) *Panic {
+	p := Panic{
+		Time:      time.Now(),
+		Value:     v,
+		Stack:     string(debug.Stack()),
+		RequestID: trace.RequestID(r.Context()),
+		Method:    r.Method,
+		Route:     route,
+		URL:       r.URL.String(),
+	}
+
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		p.Frames = append(p.Frames, frame)
+		if !more {
+			break
+		}
+	}
+	return &p
+}
+
+// recoverWriter records whether a response has begun to be written.
+type recoverWriter struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (w *recoverWriter) WriteHeader(status int) {
+	w.wrote = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recoverWriter) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends buffered data to the client, if the underlying ResponseWriter
+// supports it, so that streaming handlers keep working.
+func (w *recoverWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wrote = true
+		f.Flush()
+	}
+}
@@ -0,0 +1,108 @@
+package web_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/julienschmidt/httprouter"
+)
+
+// panicReporter records the panics reported to it.
+type panicReporter chan *web.Panic
+
+func (r panicReporter) ReportPanic(p *web.Panic) error {
+	r <- p
+	return nil
+}
+
+// TestRecoverPanics tests that panicking handlers are responded to with an
+// internal server error of the request, and that the panics are reported.
+func TestRecoverPanics(t *testing.T) {
+	reported := make(panicReporter, 1)
+	s := web.NewServer("")
+	s.PanicReporter = reported
+	s.RegisterHandler(web.Handler{
+		Method: http.MethodGet,
+		Path:   []string{"media", ":id"},
+		Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			var m map[string]int
+			m["boom"]++
+		},
+	})
+
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/media/1", nil)
+	r.Header.Set(web.HeaderRequestID, "req-1")
+	srv := s.HTTPServer()
+	srv.Handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+	var res web.ErrorResponse
+	err := json.Unmarshal(rec.Body.Bytes(), &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Code != web.ErrorCodeInternal || res.RequestID != "req-1" || res.Debug != "" {
+		t.Errorf("expected internal error of request req-1 without detail, got %+v", res)
+	}
+
+	p := <-reported
+	if p.RequestID != "req-1" || p.Route != "/api/v1/media/:id" ||
+		!strings.Contains(p.Error(), "nil map") {
+		t.Errorf("expected panic of request req-1, got %+v", p)
+	}
+	inHandler := false
+	for _, f := range p.Frames {
+		inHandler = inHandler || strings.HasSuffix(f.File, "recover_test.go")
+	}
+	if !inHandler {
+		t.Errorf("expected stack of panic in handler, got %v", p.Frames)
+	}
+}
+
+// TestSentryReporter tests that panics are sent to the envelope endpoint of
+// the project of the DSN.
+func TestSentryReporter(t *testing.T) {
+	var path, auth string
+	var event map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, auth = r.URL.Path, r.Header.Get("X-Sentry-Auth")
+		sc := bufio.NewScanner(r.Body)
+		sc.Buffer(nil, 1<<20)
+		for i := 0; sc.Scan(); i++ {
+			if i == 2 {
+				json.Unmarshal(sc.Bytes(), &event)
+			}
+		}
+	}))
+	defer ts.Close()
+
+	dsn := strings.Replace(ts.URL, "://", "://public@", 1) + "/sentry/42"
+	r, err := web.NewSentryReporter(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Environment = "test"
+	err = r.ReportPanic(&web.Panic{Value: "boom", Method: http.MethodGet,
+		Route: "/media/:id", RequestID: "req-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/sentry/api/42/envelope/" || !strings.Contains(auth, "sentry_key=public") {
+		t.Errorf("expected envelope of project 42 with key, got %s with %q", path, auth)
+	}
+	if event["transaction"] != "GET /media/:id" || event["environment"] != "test" {
+		t.Errorf("expected event of panic, got %v", event)
+	}
+
+	_, err = web.NewSentryReporter("https://sentry.example.com/42")
+	if err == nil {
+		t.Error("expected DSN without key to be invalid")
+	}
+}
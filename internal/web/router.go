@@ -0,0 +1,217 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Router is a HTTP request router that routes requests by method and path to
+// handles, as httprouter.Router, except that paths may have a static segment
+// where those of others have a wildcard, such as /media/count alongside
+// /media/:id; static segments take precedence over wildcards. Routes that
+// conflict with those registered before, such as routes already registered
+// or routes naming a wildcard differently from another at the same
+// position, are not registered but panic.
+//
+// Requests with a trailing slash, or lack of one, that only the path without
+// or with one is routed are redirected to it, as are requests of paths that
+// are routed once cleaned. Requests of paths routed only for other methods
+// are responded to with status Method Not Allowed, and OPTIONS requests with
+// the methods allowed.
+type Router struct {
+	// NotFound, if set, serves the requests no route is registered for;
+	// http.NotFound does otherwise.
+	NotFound http.Handler
+
+	// trees are the roots of the routes registered, by method
+	trees map[string]*routeNode
+}
+
+// routeNode is a node of the tree of routes of a method, one path segment
+// deep for each level of the tree.
+type routeNode struct {
+	// static are the children of the node by static segment
+	static map[string]*routeNode
+	// wildcard is the child of the node matching any other segment
+	wildcard *routeNode
+	// name is the name of the wildcard, if the node is one
+	name string
+	// handle is the handle of the route ending at the node, if any
+	handle httprouter.Handle
+}
+
+// NewRouter returns a new Router without any routes.
+func NewRouter() *Router {
+	return &Router{trees: map[string]*routeNode{}}
+}
+
+// Handle registers the given handle for requests of the given method and
+// path, whose segments beginning with a colon are wildcards, such as
+// /media/:id. It panics if the route conflicts with another.
+func (r *Router) Handle(method string, path string, handle httprouter.Handle) {
+	if !strings.HasPrefix(path, "/") {
+		panic(fmt.Sprintf("path %q must begin with '/'", path))
+	}
+	if r.trees == nil {
+		r.trees = map[string]*routeNode{}
+	}
+	n, ok := r.trees[method]
+	if !ok {
+		n = &routeNode{}
+		r.trees[method] = n
+	}
+
+	for _, seg := range splitPath(path) {
+		switch {
+		case strings.HasPrefix(seg, ":"):
+			name := seg[1:]
+			if name == "" {
+				panic(fmt.Sprintf("wildcard in path %q must be named", path))
+			}
+			if n.wildcard == nil {
+				n.wildcard = &routeNode{name: name}
+			} else if n.wildcard.name != name {
+				panic(fmt.Sprintf("wildcard %q in path %q conflicts with existing wildcard %q",
+					seg, path, ":"+n.wildcard.name))
+			}
+			n = n.wildcard
+		case strings.HasPrefix(seg, "*"):
+			panic(fmt.Sprintf("catch-all %q in path %q is not supported", seg, path))
+		default:
+			if n.static == nil {
+				n.static = map[string]*routeNode{}
+			}
+			c, ok := n.static[seg]
+			if !ok {
+				c = &routeNode{}
+				n.static[seg] = c
+			}
+			n = c
+		}
+	}
+
+	if n.handle != nil {
+		panic(fmt.Sprintf("a handle is already registered for %s %s", method, path))
+	}
+	n.handle = handle
+}
+
+// Lookup returns the handle registered for requests of the given method and
+// path, and the values of the wildcards of its route, or false if there is
+// none.
+func (r *Router) Lookup(method string, path string) (httprouter.Handle, httprouter.Params, bool) {
+	n, ok := r.trees[method]
+	if !ok {
+		return nil, nil, false
+	}
+	handle, ps := n.lookup(splitPath(path), nil)
+	return handle, ps, handle != nil
+}
+
+// ServeHTTP routes the given request to the handle registered for it.
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := req.URL.Path
+	if handle, ps, ok := r.Lookup(req.Method, path); ok {
+		handle(w, req, ps)
+		return
+	}
+
+	if req.Method != http.MethodConnect && path != "/" {
+		code := http.StatusMovedPermanently
+		if req.Method != http.MethodGet {
+			code = http.StatusTemporaryRedirect
+		}
+		for _, p := range redirectPaths(path) {
+			if _, _, ok := r.Lookup(req.Method, p); ok {
+				req.URL.Path = p
+				http.Redirect(w, req, req.URL.String(), code)
+				return
+			}
+		}
+	}
+
+	if allow := r.allowed(req.Method, path); allow != "" {
+		w.Header().Set("Allow", allow)
+		if req.Method != http.MethodOptions {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed),
+				http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	if r.NotFound != nil {
+		r.NotFound.ServeHTTP(w, req)
+		return
+	}
+	http.NotFound(w, req)
+}
+
+// allowed returns the methods other than the given one that requests of the
+// given path are routed for, along with OPTIONS, separated by commas, or an
+// empty string if there are none.
+func (r *Router) allowed(method string, path string) string {
+	allow := []string{}
+	for m := range r.trees {
+		if m == method || m == http.MethodOptions {
+			continue
+		}
+		if _, _, ok := r.Lookup(m, path); ok {
+			allow = append(allow, m)
+		}
+	}
+	if len(allow) == 0 {
+		return ""
+	}
+	sort.Strings(allow)
+	return strings.Join(append(allow, http.MethodOptions), ", ")
+}
+
+// lookup returns the handle of the route below the node matching the given
+// segments, trying static segments before wildcards, and the given values of
+// wildcards followed by those of the route.
+func (n *routeNode) lookup(
+	segs []string, ps httprouter.Params,
+) (httprouter.Handle, httprouter.Params) {
+	if len(segs) == 0 {
+		return n.handle, ps
+	}
+	if c, ok := n.static[segs[0]]; ok {
+		if handle, ps := c.lookup(segs[1:], ps); handle != nil {
+			return handle, ps
+		}
+	}
+	if n.wildcard == nil || segs[0] == "" {
+		return nil, nil
+	}
+	return n.wildcard.lookup(segs[1:],
+		append(ps, httprouter.Param{Key: n.wildcard.name, Value: segs[0]}))
+}
+
+// splitPath returns the segments of the given path; the root path has none.
+func splitPath(path string) []string {
+	path = strings.TrimPrefix(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// redirectPaths returns the paths requests of the given unrouted path are
+// redirected to if routed: the path without or with a trailing slash, and
+// the path cleaned.
+func redirectPaths(path string) []string {
+	paths := []string{}
+	if strings.HasSuffix(path, "/") {
+		paths = append(paths, strings.TrimSuffix(path, "/"))
+	} else {
+		paths = append(paths, path+"/")
+	}
+	if clean := httprouter.CleanPath(path); clean != path {
+		paths = append(paths, clean)
+	}
+	return paths
+}
@@ -0,0 +1,92 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/julienschmidt/httprouter"
+)
+
+// TestRouter tests that static path segments take precedence over wildcards
+// at the same position, falling back to them if the rest of the path is not
+// routed, and that unrouted requests are redirected or refused.
+func TestRouter(t *testing.T) {
+	r := web.NewRouter()
+	routed := ""
+	handle := func(name string) httprouter.Handle {
+		return func(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
+			routed = name + " " + ps.ByName("id")
+		}
+	}
+	r.Handle(http.MethodGet, "/media/:id", handle("media"))
+	r.Handle(http.MethodGet, "/media/:id/genres", handle("genres"))
+	r.Handle(http.MethodGet, "/media/count", handle("count"))
+	r.Handle(http.MethodGet, "/media/season/:year/:quarter", handle("season"))
+	r.Handle(http.MethodPost, "/media/:id/aliases", handle("aliases"))
+
+	tests := []struct {
+		method string
+		path   string
+		routed string
+		code   int
+	}{
+		{http.MethodGet, "/media/1", "media 1", http.StatusOK},
+		{http.MethodGet, "/media/count", "count ", http.StatusOK},
+		{http.MethodGet, "/media/count/genres", "genres count", http.StatusOK},
+		{http.MethodGet, "/media/season", "media season", http.StatusOK},
+		{http.MethodGet, "/media/season/2020/2", "season ", http.StatusOK},
+		{http.MethodGet, "/media/1/", "", http.StatusMovedPermanently},
+		{http.MethodGet, "/media//1", "", http.StatusMovedPermanently},
+		{http.MethodPost, "/media/1", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/media/1/aliases", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/people/1", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		routed = ""
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if routed != tt.routed || rec.Code != tt.code {
+			t.Errorf("expected %s %s routed to %q with status %d, got %q with %d",
+				tt.method, tt.path, tt.routed, tt.code, routed, rec.Code)
+		}
+	}
+}
+
+// TestRouterConflicts tests that registering routes that conflict with
+// others panics.
+func TestRouterConflicts(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+	}{
+		{"duplicate", []string{"/media/:id", "/media/:id"}},
+		{"renamed wildcard", []string{"/media/:id", "/media/:slug/genres"}},
+		{"catch-all", []string{"/files/*path"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected %v to conflict", tt.paths)
+				}
+			}()
+			r := web.NewRouter()
+			for _, p := range tt.paths {
+				r.Handle(http.MethodGet, p, func(http.ResponseWriter, *http.Request, httprouter.Params) {})
+			}
+		})
+	}
+
+	s := web.NewServer("")
+	h := web.Handler{Method: http.MethodGet, Path: []string{"media", ":id"}}
+	s.RegisterHandler(h)
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected server to refuse conflicting handler")
+		}
+	}()
+	h.Path = []string{"media", ":slug"}
+	s.RegisterHandler(h)
+}
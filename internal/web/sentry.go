@@ -0,0 +1,176 @@
+package web
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+)
+
+// sentryModule is the module path of the frames of the application's own
+// code in reported stack traces.
+const sentryModule = "github.com/Dophin2009/nao/"
+
+// SentryReporter is a PanicReporter that sends panics to Sentry as events,
+// through the envelope endpoint of the project of a DSN.
+type SentryReporter struct {
+	// DSN is the Data Source Name of the project, such as
+	// https://key@o1.ingest.sentry.io/2.
+	DSN string
+	// Environment and Release are reported with each event, if set.
+	Environment string
+	Release     string
+	HTTPClient  *http.Client
+
+	endpoint string
+	key      string
+}
+
+// NewSentryReporter returns a SentryReporter for the project of the given
+// DSN, which is invalid if it has no public key or project ID.
+func NewSentryReporter(dsn string) (*SentryReporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil || u.User.Username() == "" || u.Host == "" {
+		return nil, fmt.Errorf("sentry dsn: %w", data.ErrInvalid)
+	}
+	i := strings.LastIndex(u.Path, "/")
+	if i < 0 || u.Path[i+1:] == "" {
+		return nil, fmt.Errorf("sentry dsn: no project id: %w", data.ErrInvalid)
+	}
+
+	endpoint := url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+		Path:   u.Path[:i] + "/api/" + u.Path[i+1:] + "/envelope/",
+	}
+	return &SentryReporter{
+		DSN:        dsn,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		endpoint:   endpoint.String(),
+		key:        u.User.Username(),
+	}, nil
+}
+
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Platform    string            `json:"platform"`
+	Level       string            `json:"level"`
+	Logger      string            `json:"logger"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Transaction string            `json:"transaction"`
+	Request     sentryRequest     `json:"request"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Exception   sentryExceptions  `json:"exception"`
+}
+
+type sentryRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+type sentryExceptions struct {
+	Values []sentryException `json:"values"`
+}
+
+type sentryException struct {
+	Type       string           `json:"type"`
+	Value      string           `json:"value"`
+	Stacktrace sentryStacktrace `json:"stacktrace"`
+}
+
+type sentryStacktrace struct {
+	Frames []sentryFrame `json:"frames"`
+}
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+// ReportPanic sends the given panic to Sentry.
+func (r *SentryReporter) ReportPanic(p *Panic) error {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return fmt.Errorf("failed to generate event id: %w", err)
+	}
+	ev := sentryEvent{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   p.Time.UTC().Format(time.RFC3339Nano),
+		Platform:    "go",
+		Level:       "fatal",
+		Logger:      "naos",
+		Environment: r.Environment,
+		Release:     r.Release,
+		Transaction: p.Method + " " + p.Route,
+		Request:     sentryRequest{Method: p.Method, URL: p.URL},
+		Exception: sentryExceptions{Values: []sentryException{{
+			Type:  "panic",
+			Value: fmt.Sprint(p.Value),
+		}}},
+	}
+	ev.ServerName, _ = os.Hostname()
+	if p.RequestID != "" {
+		ev.Tags = map[string]string{"request_id": p.RequestID}
+	}
+	// Sentry lists frames outermost first
+	frames := make([]sentryFrame, len(p.Frames))
+	for i, f := range p.Frames {
+		frames[len(frames)-1-i] = sentryFrame{
+			Function: f.Function,
+			AbsPath:  f.File,
+			Lineno:   f.Line,
+			InApp:    strings.HasPrefix(f.Function, sentryModule),
+		}
+	}
+	ev.Exception.Values[0].Stacktrace.Frames = frames
+
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	header, err := json.Marshal(map[string]string{
+		"event_id": ev.EventID,
+		"dsn":      r.DSN,
+		"sent_at":  time.Now().UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode envelope: %w", err)
+	}
+	var envelope bytes.Buffer
+	envelope.Write(header)
+	fmt.Fprintf(&envelope, "\n{\"type\":\"event\",\"length\":%d}\n", len(body))
+	envelope.Write(body)
+	envelope.WriteByte('\n')
+
+	req, err := http.NewRequest(http.MethodPost, r.endpoint, &envelope)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set(HeaderContentType, "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", fmt.Sprintf(
+		"Sentry sentry_version=7, sentry_client=naos/1.0, sentry_key=%s", r.key))
+
+	res, err := r.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send event: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("failed to send event: status %d", res.StatusCode)
+	}
+	return nil
+}
@@ -9,6 +9,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/Dophin2009/nao/internal/trace"
 	json "github.com/json-iterator/go"
 	"github.com/julienschmidt/httprouter"
 	"github.com/rs/cors"
@@ -24,6 +26,24 @@ type Handler struct {
 	Path            []string
 	Func            HTTPReciever
 	ResponseHeaders map[string]string
+	// Versions are the API versions the handler is served under; it is
+	// served under all of APIVersions if empty. Registering handlers of the
+	// same method and path under different versions lets the versions of the
+	// API diverge.
+	Versions []string
+	// AllowInMaintenance serves the handler in maintenance mode even if its
+	// method may write, such as the handler that switches it off.
+	AllowInMaintenance bool
+	// DryRun marks handlers that make their writes only in transactions
+	// begun with the context of the request, so that they may be run
+	// without persisting them when the dry_run query parameter is true.
+	// Dry runs are refused by other handlers, and served in maintenance
+	// mode.
+	DryRun bool
+	// Stream marks handlers that stream their responses for as long as
+	// callers stay connected, such as server-sent events, which are not
+	// timed out.
+	Stream bool
 }
 
 // PathString returns the full string form of the path of the handler.
@@ -39,12 +59,31 @@ func (h *Handler) PathString() string {
 	return str.String()
 }
 
-// HandlerFunc returns a HTTP handler function that implements the handler's logic.
+// HandlerFunc returns a HTTP handler function that implements the handler's
+// logic. The JSON responses of GET handlers are projected to the fields
+// selected by the QueryFields query parameter, if given, and JSON responses
+// are encoded in the format negotiated from the Accept header.
 func (h *Handler) HandlerFunc() func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		for k, v := range h.ResponseHeaders {
 			w.Header().Add(k, v)
 		}
+
+		hw := &heldWriter{ResponseWriter: w}
+		if h.Method == http.MethodGet {
+			hw.fields = ParseFieldSelection(r.URL.Query().Get(QueryFields))
+		}
+		if enc := NegotiateEncoder(r); enc.ContentType() != HeaderContentTypeValJSON {
+			hw.encoder = enc
+		}
+		if hw.fields != nil || hw.encoder != nil {
+			defer hw.finish()
+			w = hw
+		}
+		r, ok := h.dryRun(w, r)
+		if !ok {
+			return
+		}
 		// Execute logic of handler
 		if h.Func != nil {
 			h.Func(w, r, ps)
@@ -63,21 +102,46 @@ const (
 	HeaderContentType = "Content-Type"
 	// HeaderContentTypeValJSON is a value for the content type header for JSON.
 	HeaderContentTypeValJSON = "application/json"
+	// HeaderAcceptLanguage is a HTTP header name that states the languages
+	// the caller prefers the response in.
+	HeaderAcceptLanguage = "Accept-Language"
 )
 
 // Server represents the API controller layer.
 type Server struct {
-	Router  *httprouter.Router
+	Router  *Router
 	Address string
+	// Tracer, if set, traces the requests served.
+	Tracer *trace.Tracer
+	// PanicReporter, if set, is reported the panics recovered from handlers.
+	PanicReporter PanicReporter
+	// Compression, if set, compresses the responses served.
+	Compression *Compression
+	// Frontend, if set, serves a static frontend alongside the API.
+	Frontend *Frontend
+	// Maintenance, if set, switches the server in and out of maintenance
+	// mode, refusing writes while in it.
+	Maintenance *Maintenance
+	// Access, if set, requires callers to authenticate for the routes its
+	// route policy table does not make public. It must be set before the
+	// handlers it applies to are registered.
+	Access *Access
+	// Timeouts, if set, bound how long requests are served for. It must be
+	// set before the handlers it applies to are registered.
+	Timeouts *Timeouts
+
+	// routes are the unversioned routes registered, by method and path
+	routes map[string]*negotiatedRoute
 }
 
 // NewServer returns a new instance of Controller.
 func NewServer(address string) Server {
 	// Instantiate controller
-	router := httprouter.New()
+	router := NewRouter()
 	s := Server{
 		Router:  router,
 		Address: address,
+		routes:  map[string]*negotiatedRoute{},
 	}
 
 	// Map routing handlers
@@ -88,19 +152,49 @@ func NewServer(address string) Server {
 
 // HTTPServer returns a new http.Server object for the server.
 func (s *Server) HTTPServer() http.Server {
+	var h http.Handler = s.Router
+	if s.Frontend != nil {
+		h = s.Frontend.Handler(h)
+	}
+	if s.Compression != nil {
+		h = s.Compression.Handler(h)
+	}
 	return http.Server{
 		Addr:    s.Address,
-		Handler: cors.Default().Handler(s.Router),
+		Handler: cors.Default().Handler(h),
 	}
 }
 
-// RegisterHandler registers the given handler with the server.
+// RegisterHandler registers the given handler with the server under the
+// prefixed path of each of its API versions, such as /api/v1/graphql, and
+// under its unprefixed path, where the version is negotiated from the Accept
+// header of requests. It panics if a route of the handler conflicts with one
+// registered before.
 func (s *Server) RegisterHandler(h Handler) {
 	log.WithFields(log.Fields{
-		"method": h.Method,
-		"path":   h.PathString(),
+		"method":   h.Method,
+		"path":     h.PathString(),
+		"versions": h.versions(),
 	}).Info("Registering handler")
-	s.Router.Handle(h.Method, h.PathString(), h.HandlerFunc())
+
+	key := h.Method + " " + h.PathString()
+	rt, ok := s.routes[key]
+	if !ok {
+		rt = &negotiatedRoute{versions: map[string]httprouter.Handle{}}
+		s.routes[key] = rt
+		s.Router.Handle(h.Method, h.PathString(),
+			s.instrument(h.PathString(), s.recoverPanics(h.PathString(), rt.serve)))
+	}
+
+	for _, v := range h.versions() {
+		if _, ok := rt.versions[v]; ok {
+			panic(fmt.Sprintf("handler %s already registered under API version %s", key, v))
+		}
+		f := withVersion(v, s.timeout(&h, s.guard(&h, s.maintain(&h, h.HandlerFunc()))))
+		rt.versions[v] = f
+		s.Router.Handle(h.Method, h.VersionPath(v),
+			s.instrument(h.VersionPath(v), s.recoverPanics(h.VersionPath(v), f)))
+	}
 }
 
 // RegisterHandlerGroup registers all the handlers in the given handler group
@@ -119,6 +213,7 @@ func (s *Server) StatusHandler() Handler {
 		Path:   []string{},
 		Func: func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 			status := CurrentStatus()
+			status.Version = RequestVersion(r)
 			json.NewEncoder(w).Encode(status)
 		},
 		ResponseHeaders: map[string]string{
@@ -147,28 +242,43 @@ type Status struct {
 func CurrentStatus() *Status {
 	currentTime := time.Now()
 	return &Status{
-		Version: "v1",
+		Version: APIVersionDefault,
 		Time:    &currentTime,
 	}
 }
 
-// ErrorResponse represents an error message to be returned to the client if an
-// error is encountered.
+// ErrorResponse is the envelope of the errors returned to clients: the HTTP
+// status code, a stable error code for programs, such as NOT_FOUND, a
+// message for people, the problems with the fields of invalid requests, and
+// the detail of the error. The detail of internal server errors is only
+// included if ErrorDebug is set, as it may reveal the workings of the server;
+// their request ID finds them in the logs instead.
 type ErrorResponse struct {
-	Time  *time.Time `json:"time"`
-	Error string     `json:"error"`
-	Debug string     `json:"debug"`
+	Time      *time.Time        `json:"time"`
+	Status    int               `json:"status"`
+	Code      string            `json:"code"`
+	Error     string            `json:"error"`
+	Fields    []data.FieldError `json:"fields,omitempty"`
+	Debug     string            `json:"debug,omitempty"`
+	RequestID string            `json:"requestId,omitempty"`
 }
 
-// ErrorResponseNew returns a new instance of errorResponse for the current
-// time.
-func ErrorResponseNew(err string, debug error) *ErrorResponse {
+// NewErrorResponse returns a new ErrorResponse for the current time with the
+// given message, status code and error code, for the given error. If the
+// error wraps a ValidationError, its problems are listed by field.
+func NewErrorResponse(msg string, status int, code string, debug error) *ErrorResponse {
 	currentTime := time.Now()
-	return &ErrorResponse{
-		Time:  &currentTime,
-		Error: err,
-		Debug: debug.Error(),
+	res := ErrorResponse{
+		Time:   &currentTime,
+		Status: status,
+		Code:   code,
+		Error:  msg,
+		Fields: ErrorFields(debug),
 	}
+	if debug != nil && (status < http.StatusInternalServerError || ErrorDebug) {
+		res.Debug = debug.Error()
+	}
+	return &res
 }
 
 const (
@@ -176,10 +286,18 @@ const (
 	// failed to authenticate.
 	ErrorAuthentication = "error authenticating user"
 
+	// ErrorAuthorization is the generic error message given when the user is
+	// not allowed to perform the request.
+	ErrorAuthorization = "error authorizing user"
+
 	// ErrorPathVariableParsing is the generic error message given when some path
 	// variable could not be parsed properly.
 	ErrorPathVariableParsing = "error parsing path variable"
 
+	// ErrorQueryParameterParsing is the generic error message given when some
+	// URL query parameter could not be parsed properly.
+	ErrorQueryParameterParsing = "error parsing query parameter"
+
 	// ErrorRequestBodyReading is the generic error message given when HTTP
 	// request body could not be read.
 	ErrorRequestBodyReading = "error reading request body"
@@ -191,6 +309,10 @@ const (
 	// ErrorInternalServer is the generic error message given when an error was
 	// encountered in the server.
 	ErrorInternalServer = "error within server"
+
+	// ErrorVersionNegotiation is the generic error message given when the
+	// version of the API asked for is not served.
+	ErrorVersionNegotiation = "error negotiating API version"
 )
 
 // ReadRequestBody reads and returns the request body of the given HTTP
@@ -229,18 +351,47 @@ func ParsePathVarInt(varName string, ps *httprouter.Params) (value int, err erro
 	return
 }
 
+// ParseQueryInt returns the int value of the URL query parameter with the
+// given name, or nil if the parameter is not present.
+func ParseQueryInt(name string, r *http.Request) (*int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return nil, nil
+	}
+
+	value, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("query parameter %q: %w", name, err)
+	}
+	return &value, nil
+}
+
+// ParseQueryTime returns the time value of the URL query parameter with the
+// given name in RFC 3339 format, or nil if the parameter is not present.
+func ParseQueryTime(name string, r *http.Request) (*time.Time, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return nil, nil
+	}
+
+	value, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return nil, fmt.Errorf("query parameter %q: %w", name, err)
+	}
+	return &value, nil
+}
+
 // EncodeResponseBody encodes the given value into the response body of the
 // given ResponseWriter.
 func EncodeResponseBody(body interface{}, w http.ResponseWriter) {
 	json.NewEncoder(w).Encode(body)
 }
 
-// EncodeResponseError encodes an error response into the response body of the
-// given ResponseWriter.
+// EncodeResponseError encodes an error response with the given status code,
+// and the error code of it, into the response body of the given
+// ResponseWriter.
 func EncodeResponseError(err string, debug error, statusCode int, w http.ResponseWriter) {
-	errorResponse := ErrorResponseNew(err, debug)
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(errorResponse)
+	encodeResponseError(err, debug, statusCode, StatusErrorCode(statusCode), w)
 }
 
 // EncodeResponseErrorBadRequest encodes an error response with status code
@@ -260,3 +411,9 @@ func EncodeResponseErrorInternalServer(err string, debug error, w http.ResponseW
 func EncodeResponseErrorUnauthorized(err string, debug error, w http.ResponseWriter) {
 	EncodeResponseError(err, debug, http.StatusUnauthorized, w)
 }
+
+// EncodeResponseErrorForbidden encodes an error response with status code
+// Forbidden.
+func EncodeResponseErrorForbidden(err string, debug error, w http.ResponseWriter) {
+	EncodeResponseError(err, debug, http.StatusForbidden, w)
+}
@@ -0,0 +1,67 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/data"
+	"github.com/julienschmidt/httprouter"
+)
+
+// DefaultTimeout is how long requests are served for by default.
+const DefaultTimeout = 30 * time.Second
+
+// Timeouts bound how long the requests to the routes of a server are served
+// for. The context of a request is done once its timeout passes, so that the
+// database scans of the transactions begun with it stop, and it is responded
+// to with 503 Service Unavailable rather than holding the connection.
+type Timeouts struct {
+	// Default is the timeout of the routes without one in Routes; requests
+	// are not timed out if 0.
+	Default time.Duration
+	// Routes are the timeouts of single routes, by method and path as
+	// registered, such as "GET /media/:id"; 0 disables the timeout of a
+	// route.
+	Routes map[string]time.Duration
+}
+
+// ParseTimeoutRoute returns the key in Routes of the given route, of an HTTP
+// method and a path separated by a space, such as "get /media/:id", with the
+// method in upper case.
+func ParseTimeoutRoute(route string) (string, error) {
+	parts := strings.Fields(route)
+	if len(parts) != 2 || !strings.HasPrefix(parts[1], "/") {
+		return "", fmt.Errorf("route %q: %w", route, data.ErrInvalid)
+	}
+	return strings.ToUpper(parts[0]) + " " + parts[1], nil
+}
+
+// Timeout returns the timeout of the route of the given handler.
+func (t *Timeouts) Timeout(h *Handler) time.Duration {
+	if d, ok := t.Routes[h.Method+" "+h.PathString()]; ok {
+		return d
+	}
+	return t.Default
+}
+
+// timeout returns a HTTP handler function that serves the requests to the
+// given handler with contexts that are done once its timeout passes, unless
+// the server has no Timeouts or the handler streams its responses.
+// Timeouts are looked up once, as handlers are registered.
+func (s *Server) timeout(h *Handler, f httprouter.Handle) httprouter.Handle {
+	if s.Timeouts == nil || h.Stream {
+		return f
+	}
+	d := s.Timeouts.Timeout(h)
+	if d <= 0 {
+		return f
+	}
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		f(w, r.WithContext(ctx), ps)
+	}
+}
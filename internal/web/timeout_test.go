@@ -0,0 +1,98 @@
+package web_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/julienschmidt/httprouter"
+)
+
+// TestTimeouts tests that requests are served with contexts that time out
+// by the timeout of their route, and that timed out requests are responded
+// to with status Service Unavailable.
+func TestTimeouts(t *testing.T) {
+	s := web.NewServer("")
+	s.Timeouts = &web.Timeouts{
+		Default: time.Hour,
+		Routes: map[string]time.Duration{
+			"GET /slow": 10 * time.Millisecond,
+			"GET /none": 0,
+		},
+	}
+
+	deadlines := map[string]bool{}
+	handler := func(path string) web.Handler {
+		return web.Handler{
+			Method: http.MethodGet,
+			Path:   []string{strings.TrimPrefix(path, "/")},
+			Func: func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+				_, deadlines[path] = r.Context().Deadline()
+				if path != "/slow" {
+					return
+				}
+				<-r.Context().Done()
+				web.EncodeResponseErrorFor("request timed out",
+					fmt.Errorf("scan stopped: %w", r.Context().Err()), w)
+			},
+		}
+	}
+	s.RegisterHandler(handler("/slow"))
+	s.RegisterHandler(handler("/none"))
+	s.RegisterHandler(handler("/default"))
+	stream := handler("/stream")
+	stream.Stream = true
+	s.RegisterHandler(stream)
+
+	for _, path := range []string{"/slow", "/none", "/default", "/stream"} {
+		rec := httptest.NewRecorder()
+		s.Router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if path == "/slow" && rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected status %d for %s, got %d",
+				http.StatusServiceUnavailable, path, rec.Code)
+		}
+	}
+
+	expected := map[string]bool{"/slow": true, "/none": false, "/default": true, "/stream": false}
+	for path, deadline := range expected {
+		if deadlines[path] != deadline {
+			t.Errorf("expected deadline %v for %s, got %v", deadline, path, deadlines[path])
+		}
+	}
+}
+
+// TestTimeoutErrors tests that errors of contexts are reported as
+// unavailable, with a distinct code for timeouts.
+func TestTimeoutErrors(t *testing.T) {
+	err := fmt.Errorf("scan stopped: %w", context.DeadlineExceeded)
+	if web.ErrorStatus(err) != http.StatusServiceUnavailable || web.ErrorCode(err) != web.ErrorCodeTimeout {
+		t.Errorf("expected %d %s, got %d %s", http.StatusServiceUnavailable,
+			web.ErrorCodeTimeout, web.ErrorStatus(err), web.ErrorCode(err))
+	}
+	err = fmt.Errorf("scan stopped: %w", context.Canceled)
+	if web.ErrorStatus(err) != http.StatusServiceUnavailable || web.ErrorCode(err) != web.ErrorCodeUnavailable {
+		t.Errorf("expected %d %s, got %d %s", http.StatusServiceUnavailable,
+			web.ErrorCodeUnavailable, web.ErrorStatus(err), web.ErrorCode(err))
+	}
+}
+
+// TestParseTimeoutRoute tests that routes are keyed with their methods in
+// upper case, and that keys without a method and an absolute path are
+// invalid.
+func TestParseTimeoutRoute(t *testing.T) {
+	key, err := web.ParseTimeoutRoute("get /media/:id")
+	if err != nil || key != "GET /media/:id" {
+		t.Errorf("expected %q, got %q, %v", "GET /media/:id", key, err)
+	}
+	for _, route := range []string{"/media", "GET media", "GET /media extra", ""} {
+		_, err := web.ParseTimeoutRoute(route)
+		if err == nil {
+			t.Errorf("expected route %q to be invalid", route)
+		}
+	}
+}
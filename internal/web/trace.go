@@ -0,0 +1,79 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Dophin2009/nao/internal/trace"
+	"github.com/julienschmidt/httprouter"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// HeaderRequestID is a HTTP header name that identifies a request; it is
+	// taken from the request if given, and generated otherwise, and returned
+	// in the response.
+	HeaderRequestID = "X-Request-ID"
+
+	// maxRequestIDLength is the length of the longest request ID accepted
+	// from callers.
+	maxRequestIDLength = 128
+)
+
+// instrument returns a HTTP handler function that assigns requests to the
+// given route an ID and, if the server has a Tracer, serves them in a span
+// continuing the trace of the caller.
+func (s *Server) instrument(route string, f httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		id := r.Header.Get(HeaderRequestID)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = trace.NewRequestID()
+		}
+		w.Header().Set(HeaderRequestID, id)
+		ctx := trace.WithRequestID(r.Context(), id)
+
+		if s.Tracer == nil {
+			f(w, r.WithContext(ctx), ps)
+			return
+		}
+
+		// Malformed trace contexts of callers start new traces
+		ctx, span := s.Tracer.StartRootSpan(ctx, r.Method+" "+route, r.Header)
+		span.SetAttributes(
+			attribute.String("http.method", r.Method),
+			attribute.String("http.route", route),
+			attribute.String("http.target", r.URL.RequestURI()),
+			attribute.String("http.request_id", id),
+			attribute.String("http.client_ip", r.RemoteAddr))
+
+		sw := statusWriter{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			span.SetAttributes(attribute.Int("http.status_code", sw.status))
+			var err error
+			if sw.status >= http.StatusInternalServerError {
+				err = fmt.Errorf("responded with status %d", sw.status)
+			}
+			trace.Finish(span, err)
+		}()
+		f(&sw, r.WithContext(ctx), ps)
+	}
+}
+
+// statusWriter records the status code of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Flush sends buffered data to the client, if the underlying ResponseWriter
+// supports it, so that streaming handlers keep working.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,146 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// APIPrefix is the first path segment of the paths of handlers under an
+// explicit API version, as in /api/v1/graphql.
+const APIPrefix = "api"
+
+const (
+	// APIVersion1 is the first version of the API.
+	APIVersion1 = "v1"
+
+	// APIVersionDefault is the version of the API served to requests that do
+	// not ask for one, so that clients written before versioning keep working.
+	APIVersionDefault = APIVersion1
+)
+
+// APIVersions are the supported versions of the API, oldest first. Handlers
+// without explicit versions are registered under all of them.
+var APIVersions = []string{APIVersion1}
+
+const (
+	// HeaderAccept is a HTTP header name that states the media types the
+	// caller accepts, through which it may ask for a version of the API.
+	HeaderAccept = "Accept"
+	// HeaderAPIVersion is a HTTP header name that states the version of the
+	// API that served the response.
+	HeaderAPIVersion = "API-Version"
+
+	// mediaTypeVendorPrefix is the prefix of the vendor media types that ask
+	// for a version of the API, as in application/vnd.naos.v1+json.
+	mediaTypeVendorPrefix = "application/vnd.naos."
+)
+
+// versionKey is the key of the API version of a request in its context.
+type versionKey struct{}
+
+// RequestVersion returns the version of the API that the given request is
+// served by.
+func RequestVersion(r *http.Request) string {
+	v, ok := r.Context().Value(versionKey{}).(string)
+	if !ok {
+		return APIVersionDefault
+	}
+	return v
+}
+
+// NegotiateVersion returns the version of the API asked for in the Accept
+// header of the given request, either as a vendor media type, such as
+// application/vnd.naos.v1+json, or as a version parameter, such as
+// application/json; version=1. It returns APIVersionDefault if none is asked
+// for, and an error if the version is not supported.
+func NegotiateVersion(r *http.Request) (string, error) {
+	for _, accept := range r.Header[HeaderAccept] {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+
+			var v string
+			if strings.HasPrefix(mediaType, mediaTypeVendorPrefix) {
+				v = strings.TrimPrefix(mediaType, mediaTypeVendorPrefix)
+				v = strings.SplitN(v, "+", 2)[0]
+			} else if p, ok := params["version"]; ok {
+				v = p
+				if !strings.HasPrefix(v, "v") {
+					v = "v" + v
+				}
+			} else {
+				continue
+			}
+
+			if !isAPIVersion(v) {
+				return "", fmt.Errorf("unsupported API version %q", v)
+			}
+			return v, nil
+		}
+	}
+	return APIVersionDefault, nil
+}
+
+// VersionPath returns the path of the handler under the given API version.
+func (h *Handler) VersionPath(version string) string {
+	path := "/" + APIPrefix + "/" + version
+	if len(h.Path) == 0 {
+		return path
+	}
+	return path + h.PathString()
+}
+
+// versions returns the API versions the handler is served under.
+func (h *Handler) versions() []string {
+	if len(h.Versions) == 0 {
+		return APIVersions
+	}
+	return h.Versions
+}
+
+// withVersion returns a HTTP handler function that serves the given version
+// of the API through the given function.
+func withVersion(version string, f httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		w.Header().Set(HeaderAPIVersion, version)
+		ctx := context.WithValue(r.Context(), versionKey{}, version)
+		f(w, r.WithContext(ctx), ps)
+	}
+}
+
+// negotiatedRoute dispatches requests to the unversioned path of a route to
+// the handler of the version negotiated from their Accept header.
+type negotiatedRoute struct {
+	versions map[string]httprouter.Handle
+}
+
+func (rt *negotiatedRoute) serve(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	version, err := NegotiateVersion(r)
+	if err != nil {
+		EncodeResponseError(ErrorVersionNegotiation, err, http.StatusNotAcceptable, w)
+		return
+	}
+	f, ok := rt.versions[version]
+	if !ok {
+		EncodeResponseError(ErrorVersionNegotiation,
+			fmt.Errorf("not available in API version %q", version), http.StatusNotFound, w)
+		return
+	}
+	f(w, r, ps)
+}
+
+func isAPIVersion(v string) bool {
+	for _, s := range APIVersions {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Dophin2009/nao/internal/web"
+)
+
+// TestNegotiateVersion tests that the version of the API is read from vendor
+// media types and version parameters of the Accept header.
+func TestNegotiateVersion(t *testing.T) {
+	tests := []struct {
+		accept  string
+		version string
+		err     bool
+	}{
+		{"", web.APIVersionDefault, false},
+		{"*/*", web.APIVersionDefault, false},
+		{"application/vnd.naos.v1+json", web.APIVersion1, false},
+		{"text/html, application/json; version=1", web.APIVersion1, false},
+		{"application/json; version=v1", web.APIVersion1, false},
+		{"application/vnd.naos.v9+json", "", true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.accept != "" {
+			r.Header.Set(web.HeaderAccept, tt.accept)
+		}
+
+		v, err := web.NegotiateVersion(r)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: expected error, got version %q", tt.accept, v)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.accept, err)
+		} else if v != tt.version {
+			t.Errorf("%q: expected version %q, got %q", tt.accept, tt.version, v)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// ChangeFeed is a single page of the public change feed.
+type ChangeFeed struct {
+	Type    *string          `json:"type"`
+	Since   *time.Time       `json:"since"`
+	First   *int             `json:"first"`
+	Skip    *int             `json:"skip"`
+	Changes []*models.Change `json:"changes"`
+	// Next is the time to list Changes since on the next sync, if Since is
+	// given.
+	Next *time.Time `json:"next,omitempty"`
+}
+
+// ChangeService performs requests on the public change feed.
+type ChangeService struct {
+	client *Client
+}
+
+// List returns a page of the Changes to public entities of the given type,
+// or of all types if empty.
+func (s *ChangeService) List(
+	ctx context.Context, typ string, opts ListOptions,
+) (*ChangeFeed, error) {
+	return s.list(ctx, typ, nil, opts)
+}
+
+// Since returns a page of the Changes to public entities of the given type,
+// or of all types if empty, made after the given time, oldest first. The
+// Next time of the feed is the time to pass on the following sync.
+func (s *ChangeService) Since(
+	ctx context.Context, typ string, since time.Time, opts ListOptions,
+) (*ChangeFeed, error) {
+	return s.list(ctx, typ, &since, opts)
+}
+
+func (s *ChangeService) list(
+	ctx context.Context, typ string, since *time.Time, opts ListOptions,
+) (*ChangeFeed, error) {
+	q := url.Values{}
+	if typ != "" {
+		q.Set("type", typ)
+	}
+	if since != nil {
+		q.Set("since", since.Format(time.RFC3339Nano))
+	}
+	if opts.First > 0 {
+		q.Set("first", strconv.Itoa(opts.First))
+	}
+	if opts.Skip > 0 {
+		q.Set("skip", strconv.Itoa(opts.Skip))
+	}
+
+	path := "/changes/feed"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+
+	var feed ChangeFeed
+	err := s.client.do(ctx, http.MethodGet, path, nil, &feed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get change feed: %w", err)
+	}
+	return &feed, nil
+}
+
+// Each calls fn with every Change to public entities of the given type, or
+// of all types if empty, fetching pages of the given size as needed.
+// Iteration stops at the first error returned by fn; ErrStop stops it without
+// an error.
+func (s *ChangeService) Each(
+	ctx context.Context, typ string, size int, fn func(c *models.Change) error,
+) error {
+	return Paginate(ctx, size, func(ctx context.Context, opts ListOptions) (int, error) {
+		feed, err := s.List(ctx, typ, opts)
+		if err != nil {
+			return 0, err
+		}
+		for _, c := range feed.Changes {
+			err = fn(c)
+			if err != nil {
+				return 0, err
+			}
+		}
+		return len(feed.Changes), nil
+	})
+}
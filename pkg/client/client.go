@@ -0,0 +1,217 @@
+// Package client provides a typed Go client for the naos API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRefreshBefore is how long before its expiry the token of a Client is
+// refreshed if not configured.
+const DefaultRefreshBefore = 5 * time.Minute
+
+// APIVersion is the version of the API the Client is written against, which
+// it asks the server for in the Accept header of its requests.
+const APIVersion = "v1"
+
+// Client is a client of a naos server. It is safe for concurrent use.
+type Client struct {
+	// BaseURL is the URL of the server, such as "http://localhost:8080".
+	BaseURL    string
+	HTTPClient *http.Client
+	// RefreshBefore is how long before its expiry the token is exchanged for
+	// a new one.
+	RefreshBefore time.Duration
+	// AcceptLanguage, if set, is sent as the Accept-Language header so that
+	// Titles are ordered for the given languages, such as "ja, en;q=0.8".
+	AcceptLanguage string
+
+	Media   *MediaService
+	Changes *ChangeService
+	Library *LibraryService
+	Sync    *SyncService
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// NewClient returns a Client of the server at the given base URL that
+// authenticates with the given token. The token may be empty for anonymous
+// access or if the Client logs in later.
+func NewClient(baseURL string, token string) *Client {
+	c := &Client{
+		BaseURL:       strings.TrimSuffix(baseURL, "/"),
+		HTTPClient:    http.DefaultClient,
+		RefreshBefore: DefaultRefreshBefore,
+	}
+	c.Media = &MediaService{c}
+	c.Changes = &ChangeService{c}
+	c.Library = &LibraryService{c}
+	c.Sync = &SyncService{c}
+	c.SetToken(token)
+	return c
+}
+
+// Token returns the current token of the Client.
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+// SetToken replaces the token of the Client.
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setToken(token, tokenExpiry(token))
+}
+
+func (c *Client) setToken(token string, expiresAt time.Time) {
+	c.token = token
+	c.expiresAt = expiresAt
+}
+
+// tokenResponse is the response body of an issued token.
+type tokenResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Login authenticates with the given username and password and replaces the
+// token of the Client with the one issued.
+func (c *Client) Login(ctx context.Context, username string, password string) error {
+	body := struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}{username, password}
+
+	var res tokenResponse
+	err := c.send(ctx, http.MethodPost, "/auth/token", "", body, &res)
+	if err != nil {
+		return fmt.Errorf("failed to log in: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setToken(res.Token, res.ExpiresAt)
+	return nil
+}
+
+// Refresh exchanges the token of the Client for a new one. Tokens are
+// refreshed automatically before they expire, so this need not be called
+// directly.
+func (c *Client) Refresh(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.refresh(ctx)
+}
+
+func (c *Client) refresh(ctx context.Context) error {
+	var res tokenResponse
+	err := c.send(ctx, http.MethodPost, "/auth/refresh", c.token, nil, &res)
+	if err != nil {
+		return fmt.Errorf("failed to refresh token: %w", err)
+	}
+	c.setToken(res.Token, res.ExpiresAt)
+	return nil
+}
+
+// currentToken returns the token to authenticate requests with, refreshing it
+// first if it expires soon.
+func (c *Client) currentToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Tokens without a known expiry are never refreshed, and expired tokens
+	// can no longer be refreshed
+	if c.token == "" || c.expiresAt.IsZero() {
+		return c.token, nil
+	}
+	now := time.Now()
+	if now.Before(c.expiresAt) && c.expiresAt.Sub(now) < c.RefreshBefore {
+		err := c.refresh(ctx)
+		if err != nil {
+			return "", err
+		}
+	}
+	return c.token, nil
+}
+
+// do sends an authenticated request with the given body encoded as JSON and
+// decodes the response body into out, if not nil.
+func (c *Client) do(
+	ctx context.Context, method string, path string, in interface{}, out interface{},
+) error {
+	token, err := c.currentToken(ctx)
+	if err != nil {
+		return err
+	}
+	return c.send(ctx, method, path, token, in, out)
+}
+
+func (c *Client) send(
+	ctx context.Context, method string, path string, token string,
+	in interface{}, out interface{},
+) error {
+	var body io.Reader
+	if in != nil {
+		buf, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request body: %w", err)
+		}
+		body = bytes.NewReader(buf)
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/vnd.naos."+APIVersion+"+json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if c.AcceptLanguage != "" {
+		req.Header.Set("Accept-Language", c.AcceptLanguage)
+	}
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	buf, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		apiErr := Error{StatusCode: res.StatusCode}
+		if json.Unmarshal(buf, &apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = http.StatusText(res.StatusCode)
+		}
+		return &apiErr
+	}
+
+	if out == nil {
+		return nil
+	}
+	err = json.Unmarshal(buf, out)
+	if err != nil {
+		return fmt.Errorf("failed to decode response body: %w", err)
+	}
+	return nil
+}
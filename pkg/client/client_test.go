@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+func testToken(exp time.Time) string {
+	enc := base64.RawURLEncoding
+	payload := fmt.Sprintf(`{"Username":"test","exp":%d}`, exp.Unix())
+	return enc.EncodeToString([]byte(`{"alg":"HS256"}`)) + "." +
+		enc.EncodeToString([]byte(payload)) + ".sig"
+}
+
+func TestClientRefreshesToken(t *testing.T) {
+	expiring := testToken(time.Now().Add(time.Minute))
+	fresh := testToken(time.Now().Add(time.Hour))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth/refresh", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+expiring {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(tokenResponse{
+			Token:     fresh,
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+	})
+	mux.HandleFunc(GraphQLPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+fresh {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"data":{"mediaByID":{"meta":{"id":"7"},` +
+			`"titles":[{"string":"Title","language":"en","priority":"Primary"}]}}}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c := NewClient(srv.URL, expiring)
+	md, err := c.Media.Get(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("failed to get Media: %v", err)
+	}
+	if md.Meta.ID != 7 || len(md.Titles) != 1 || md.Titles[0].Priority != "Primary" {
+		t.Errorf("unexpected Media: %+v", md)
+	}
+	if c.Token() != fresh {
+		t.Errorf("token was not refreshed")
+	}
+}
+
+func TestChangeServiceEach(t *testing.T) {
+	total := 7
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		first, _ := strconv.Atoi(r.URL.Query().Get("first"))
+		skip, _ := strconv.Atoi(r.URL.Query().Get("skip"))
+
+		feed := ChangeFeed{Changes: []*models.Change{}}
+		for i := skip; i < total && i < skip+first; i++ {
+			feed.Changes = append(feed.Changes, &models.Change{EntityID: i})
+		}
+		json.NewEncoder(w).Encode(feed)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, "")
+	var ids []int
+	err := c.Changes.Each(context.Background(), "", 3, func(ch *models.Change) error {
+		ids = append(ids, ch.EntityID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to iterate: %v", err)
+	}
+	if len(ids) != total {
+		t.Fatalf("expected %d changes, got %v", total, ids)
+	}
+	for i, id := range ids {
+		if id != i {
+			t.Errorf("expected change %d at position %d, got %d", i, i, id)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error codes identify the kind of an Error.
+const (
+	CodeNotFound     = "NOT_FOUND"
+	CodeInvalid      = "INVALID"
+	CodeConflict     = "CONFLICT"
+	CodeUnauthorized = "UNAUTHORIZED"
+	CodeInternal     = "INTERNAL"
+
+	CodeForbidden            = "FORBIDDEN"
+	CodeUnavailable          = "UNAVAILABLE"
+	CodeLocked               = "LOCKED"
+	CodeNotAcceptable        = "NOT_ACCEPTABLE"
+	CodeUnsupportedMediaType = "UNSUPPORTED_MEDIA_TYPE"
+	CodeTimeout              = "TIMEOUT"
+)
+
+// Error is an error returned by the API.
+type Error struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int    `json:"-"`
+	Message    string `json:"error"`
+	Code       string `json:"code"`
+	// Fields are the problems with the fields of an invalid request.
+	Fields []FieldError `json:"fields"`
+	// Debug is the detail of the error, which is omitted for internal server
+	// errors unless the server is configured to include it.
+	Debug string `json:"debug"`
+	// RequestID identifies the request in the logs of the server.
+	RequestID string `json:"requestId"`
+}
+
+// FieldError is a problem with a single field of an invalid request, by its
+// path, such as "Titles[1].Language".
+type FieldError struct {
+	Path    string `json:"path"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("naos: %d %s", e.StatusCode, e.Message)
+	if e.Code != "" {
+		msg += " (" + e.Code + ")"
+	}
+	if e.Debug != "" {
+		msg += ": " + e.Debug
+	}
+	return msg
+}
+
+// IsNotFound returns true if the given error is an Error for an entity that
+// does not exist.
+func IsNotFound(err error) bool {
+	return hasKind(err, CodeNotFound, http.StatusNotFound)
+}
+
+// IsUnauthorized returns true if the given error is an Error for a request
+// that is not authenticated or not permitted.
+func IsUnauthorized(err error) bool {
+	return hasKind(err, CodeUnauthorized, http.StatusUnauthorized) ||
+		hasKind(err, CodeForbidden, http.StatusForbidden)
+}
+
+// hasKind returns true if the given error is an Error with the given code, or
+// with the given status code if it has no code.
+func hasKind(err error, code string, status int) bool {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.Code != "" {
+		return apiErr.Code == code
+	}
+	return apiErr.StatusCode == status
+}
@@ -0,0 +1,60 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// GraphQLPath is the path of the GraphQL endpoint of the server.
+const GraphQLPath = "/graphql"
+
+type graphqlRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+type graphqlResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string `json:"message"`
+		Extensions struct {
+			Code string `json:"code"`
+		} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// Query executes the given GraphQL query or mutation with the given variables
+// and decodes the data of the result into out, if not nil. The first error of
+// the result, if any, is returned as an Error.
+func (c *Client) Query(
+	ctx context.Context, query string, vars map[string]interface{}, out interface{},
+) error {
+	var res graphqlResponse
+	err := c.do(ctx, http.MethodPost, GraphQLPath, graphqlRequest{
+		Query:     query,
+		Variables: vars,
+	}, &res)
+	if err != nil {
+		return err
+	}
+
+	if len(res.Errors) > 0 {
+		e := res.Errors[0]
+		return &Error{
+			StatusCode: http.StatusOK,
+			Message:    e.Message,
+			Code:       e.Extensions.Code,
+		}
+	}
+
+	if out == nil || len(res.Data) == 0 {
+		return nil
+	}
+	err = json.Unmarshal(res.Data, out)
+	if err != nil {
+		return fmt.Errorf("failed to decode query result: %w", err)
+	}
+	return nil
+}
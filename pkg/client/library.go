@@ -0,0 +1,86 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// Scrobble is a playback event reported by a media player.
+type Scrobble struct {
+	MediaID   int  `json:"mediaID"`
+	Episodes  int  `json:"episodes"`
+	Completed bool `json:"completed"`
+	// EpisodeID is the ID of the Episode played, if known.
+	EpisodeID *int `json:"episodeID,omitempty"`
+	// Time is the time of the event; defaults to the time it is received.
+	Time *time.Time `json:"time,omitempty"`
+}
+
+// LibraryService performs requests on the libraries of Users.
+type LibraryService struct {
+	client *Client
+}
+
+// Scrobble reports a playback event of the authenticated User and returns
+// the updated UserMedia.
+func (s *LibraryService) Scrobble(ctx context.Context, sc *Scrobble) (*models.UserMedia, error) {
+	var um models.UserMedia
+	err := s.client.do(ctx, http.MethodPost, "/scrobble", sc, &um)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scrobble Media with ID %d: %w", sc.MediaID, err)
+	}
+	return &um, nil
+}
+
+// Health returns the problems found in the library of the User with the
+// given ID.
+func (s *LibraryService) Health(ctx context.Context, userID int) (*models.LibraryHealth, error) {
+	var h models.LibraryHealth
+	path := fmt.Sprintf("/user/%d/library/health", userID)
+	err := s.client.do(ctx, http.MethodGet, path, nil, &h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get library health of User with ID %d: %w",
+			userID, err)
+	}
+	return &h, nil
+}
+
+// BulkEdit applies the given edit to the UserMedia with the given IDs in the
+// library of the User with the given ID, and returns the number changed.
+func (s *LibraryService) BulkEdit(
+	ctx context.Context, userID int, ids []int, edit models.UserMediaEdit,
+) (int, error) {
+	body := struct {
+		UserMediaIDs []int                `json:"userMediaIDs"`
+		Edit         models.UserMediaEdit `json:"edit"`
+	}{ids, edit}
+
+	var res struct {
+		Changed int `json:"changed"`
+	}
+	path := fmt.Sprintf("/user/%d/library/bulk", userID)
+	err := s.client.do(ctx, http.MethodPost, path, body, &res)
+	if err != nil {
+		return 0, fmt.Errorf("failed to edit library of User with ID %d: %w", userID, err)
+	}
+	return res.Changed, nil
+}
+
+// ContinueWatching returns the Media the User with the given ID is in the
+// middle of watching.
+func (s *LibraryService) ContinueWatching(
+	ctx context.Context, userID int,
+) ([]*models.ContinueWatching, error) {
+	var list []*models.ContinueWatching
+	path := fmt.Sprintf("/user/%d/continue", userID)
+	err := s.client.do(ctx, http.MethodGet, path, nil, &list)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get continue watching of User with ID %d: %w",
+			userID, err)
+	}
+	return list, nil
+}
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+	"fmt"
+)
+
+// Media is a Media as served by the GraphQL API.
+type Media struct {
+	Meta            Metadata `json:"meta"`
+	Titles          []Title  `json:"titles"`
+	Synopses        []Title  `json:"synopses"`
+	Background      []Title  `json:"background"`
+	SeasonPremiered Season   `json:"seasonPremiered"`
+	Type            *string  `json:"type"`
+	Source          *string  `json:"source"`
+}
+
+// Metadata is the metadata of an entity.
+type Metadata struct {
+	// ID is served as a string, as GraphQL IDs are.
+	ID int `json:"id,string"`
+}
+
+// Title is a language-specific string used as a name or descriptor.
+type Title struct {
+	String   string `json:"string"`
+	Language string `json:"language"`
+	// Priority is one of "Primary", "Secondary" or "Other".
+	Priority  string `json:"priority"`
+	Preferred bool   `json:"preferred"`
+}
+
+// Season is a season of some year.
+type Season struct {
+	// Quarter is one of "Winter", "Spring", "Summer" or "Fall".
+	Quarter *string `json:"quarter"`
+	Year    *int    `json:"year"`
+}
+
+const mediaFields = `
+	meta { id }
+	titles { string language priority preferred }
+	synopses { string language priority preferred }
+	background { string language priority preferred }
+	seasonPremiered { quarter year }
+	type
+	source
+`
+
+// MediaService performs requests on Media.
+type MediaService struct {
+	client *Client
+}
+
+// Get returns the Media with the given ID.
+func (s *MediaService) Get(ctx context.Context, id int) (*Media, error) {
+	var res struct {
+		Media *Media `json:"mediaByID"`
+	}
+	err := s.client.Query(ctx,
+		`query($id: ID!) { mediaByID(id: $id) {`+mediaFields+`} }`,
+		map[string]interface{}{"id": id}, &res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Media by ID %d: %w", id, err)
+	}
+	return res.Media, nil
+}
+
+// GetMany returns the Media with the given IDs in a single request, in the
+// order of the IDs and nil for those of no Media.
+func (s *MediaService) GetMany(ctx context.Context, ids []int) ([]*Media, error) {
+	var res struct {
+		Media []*Media `json:"mediaByIDs"`
+	}
+	err := s.client.Query(ctx,
+		`query($ids: [ID!]!) { mediaByIDs(ids: $ids) {`+mediaFields+`} }`,
+		map[string]interface{}{"ids": ids}, &res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Media by IDs: %w", err)
+	}
+	return res.Media, nil
+}
+
+// Create creates the given Media and returns it as persisted. It requires
+// the Moderator role.
+func (s *MediaService) Create(ctx context.Context, md *Media) (*Media, error) {
+	titles := func(list []Title) []Title {
+		if list == nil {
+			return []Title{}
+		}
+		return list
+	}
+	input := map[string]interface{}{
+		"meta":            md.Meta,
+		"titles":          titles(md.Titles),
+		"synopses":        titles(md.Synopses),
+		"background":      titles(md.Background),
+		"seasonPremiered": md.SeasonPremiered,
+		"type":            md.Type,
+		"source":          md.Source,
+	}
+
+	var res struct {
+		Media *Media `json:"createMedia"`
+	}
+	err := s.client.Query(ctx,
+		`mutation($media: MediaInput!) { createMedia(media: $media) {`+mediaFields+`} }`,
+		map[string]interface{}{"media": input}, &res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Media: %w", err)
+	}
+	return res.Media, nil
+}
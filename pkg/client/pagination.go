@@ -0,0 +1,55 @@
+package client
+
+import (
+	"context"
+	"errors"
+)
+
+// DefaultPageSize is the number of items fetched per page by iterators if
+// not given.
+const DefaultPageSize = 50
+
+// ErrStop may be returned by the callbacks of iterators to stop iterating
+// without an error.
+var ErrStop = errors.New("stop iterating")
+
+// ListOptions are the pagination parameters of list requests. Zero values
+// are left to the server's defaults.
+type ListOptions struct {
+	// First is the maximum number of items to return.
+	First int
+	// Skip is the number of items to skip before collecting.
+	Skip int
+}
+
+// PageFunc fetches the page of a list given by opts and returns the number of
+// items in it.
+type PageFunc func(ctx context.Context, opts ListOptions) (int, error)
+
+// Paginate calls fetch with successive pages of the given size, starting from
+// the first item, until a page is not full. If fetch returns ErrStop,
+// Paginate stops and returns nil.
+func Paginate(ctx context.Context, size int, fetch PageFunc) error {
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+
+	opts := ListOptions{First: size}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := fetch(ctx, opts)
+		if errors.Is(err, ErrStop) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if n < size {
+			return nil
+		}
+		opts.Skip += n
+	}
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/models"
+)
+
+// SyncService performs requests to sync a local copy of the entities of the
+// authenticated User.
+type SyncService struct {
+	client *Client
+}
+
+// Push sends the given changes made to the local copy, and returns which
+// were applied, which conflict with changes made since, and which were
+// rejected.
+func (s *SyncService) Push(
+	ctx context.Context, changes []*models.SyncChange,
+) (*models.SyncResult, error) {
+	body := struct {
+		Changes []*models.SyncChange `json:"changes"`
+	}{changes}
+
+	var res models.SyncResult
+	err := s.client.do(ctx, http.MethodPost, "/sync", body, &res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to push changes: %w", err)
+	}
+	return &res, nil
+}
+
+// Pull returns the entities changed after the given time, from at most first
+// changes if positive; its Next time is the time to pull since on the next
+// sync. All the entities are returned if since is nil.
+func (s *SyncService) Pull(
+	ctx context.Context, since *time.Time, first int,
+) (*models.SyncPull, error) {
+	q := url.Values{}
+	if since != nil {
+		q.Set("since", since.Format(time.RFC3339Nano))
+	}
+	if first > 0 {
+		q.Set("first", strconv.Itoa(first))
+	}
+
+	path := "/sync"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+
+	var pull models.SyncPull
+	err := s.client.do(ctx, http.MethodGet, path, nil, &pull)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull changes: %w", err)
+	}
+	return &pull, nil
+}
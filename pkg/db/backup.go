@@ -0,0 +1,386 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BackupDriver is implemented by DatabaseDrivers that can write a consistent
+// snapshot of the whole database.
+type BackupDriver interface {
+	Backup(w io.Writer) (int64, error)
+	// BackupSize returns the number of bytes a snapshot would currently
+	// take; it may change before the snapshot is written.
+	BackupSize() (int64, error)
+}
+
+// Backup writes a consistent snapshot of the database to the given writer.
+func (dbs *DatabaseService) Backup(w io.Writer) (int64, error) {
+	bd, ok := dbs.DatabaseDriver.(BackupDriver)
+	if !ok {
+		return 0, errors.New("database driver does not support backups")
+	}
+	return bd.Backup(w)
+}
+
+// BackupSize returns the approximate number of bytes a snapshot of the
+// database would take.
+func (dbs *DatabaseService) BackupSize() (int64, error) {
+	bd, ok := dbs.DatabaseDriver.(BackupDriver)
+	if !ok {
+		return 0, errors.New("database driver does not support backups")
+	}
+	return bd.BackupSize()
+}
+
+// BackupWithProgress writes a consistent snapshot of the database to the
+// given writer, reporting the bytes written to the given Progress.
+func (dbs *DatabaseService) BackupWithProgress(w io.Writer, p Progress) (int64, error) {
+	size, err := dbs.BackupSize()
+	if err != nil {
+		p.Finish(err)
+		return 0, err
+	}
+	p.SetTotal(size)
+
+	n, err := dbs.Backup(ProgressWriter(w, p))
+	p.Finish(err)
+	return n, err
+}
+
+// Backup writes a consistent snapshot of the database to the given writer in
+// a read-only transaction, so that other transactions are not blocked.
+func (db *BoltDatabase) Backup(w io.Writer) (int64, error) {
+	var n int64
+	err := db.Bolt.View(func(tx *bolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	if err != nil {
+		return n, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return n, nil
+}
+
+// BackupSize returns the size of the database as of a new read-only
+// transaction.
+func (db *BoltDatabase) BackupSize() (int64, error) {
+	var n int64
+	err := db.Bolt.View(func(tx *bolt.Tx) error {
+		n = tx.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read database size: %w", err)
+	}
+	return n, nil
+}
+
+// Backup writes a consistent snapshot of the underlying database to the given
+// writer.
+func (cdb *CachedDatabase) Backup(w io.Writer) (int64, error) {
+	bd, ok := cdb.Driver.(BackupDriver)
+	if !ok {
+		return 0, errors.New("database driver does not support backups")
+	}
+	return bd.Backup(w)
+}
+
+// BackupSize returns the approximate size of a snapshot of the underlying
+// database.
+func (cdb *CachedDatabase) BackupSize() (int64, error) {
+	bd, ok := cdb.Driver.(BackupDriver)
+	if !ok {
+		return 0, errors.New("database driver does not support backups")
+	}
+	return bd.BackupSize()
+}
+
+// RestoreDriver is implemented by DatabaseDrivers that can replace their
+// contents with a snapshot written by Backup while in use.
+type RestoreDriver interface {
+	Restore(r io.Reader) error
+}
+
+// Restore replaces the contents of the database with the snapshot read from
+// the given reader.
+func (dbs *DatabaseService) Restore(r io.Reader) error {
+	rd, ok := dbs.DatabaseDriver.(RestoreDriver)
+	if !ok {
+		return errors.New("database driver does not support restores")
+	}
+	return rd.Restore(r)
+}
+
+// Restore replaces all buckets of the database with those of the snapshot read
+// from the given reader, in a single transaction.
+func (db *BoltDatabase) Restore(r io.Reader) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(db.Bolt.Path()), "restore-*.db")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close snapshot file: %w", err)
+	}
+
+	snap, err := bolt.Open(tmp.Name(), 0600, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer snap.Close()
+
+	return snap.View(func(stx *bolt.Tx) error {
+		return db.Bolt.Update(func(tx *bolt.Tx) error {
+			// Drop the current buckets
+			names := [][]byte{}
+			err := tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+				names = append(names, append([]byte{}, name...))
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, name := range names {
+				err = tx.DeleteBucket(name)
+				if err != nil {
+					return fmt.Errorf("failed to delete bucket %q: %w", name, err)
+				}
+			}
+
+			// Copy those of the snapshot
+			return stx.ForEach(func(name []byte, sb *bolt.Bucket) error {
+				b, err := tx.CreateBucket(name)
+				if err != nil {
+					return fmt.Errorf("failed to create bucket %q: %w", name, err)
+				}
+				err = b.SetSequence(sb.Sequence())
+				if err != nil {
+					return fmt.Errorf("failed to restore sequence of %q: %w", name, err)
+				}
+				return sb.ForEach(func(k, v []byte) error {
+					return b.Put(k, v)
+				})
+			})
+		})
+	})
+}
+
+// Restore replaces the contents of the underlying database with the given
+// snapshot and empties the cache.
+func (cdb *CachedDatabase) Restore(r io.Reader) error {
+	rd, ok := cdb.Driver.(RestoreDriver)
+	if !ok {
+		return errors.New("database driver does not support restores")
+	}
+	return cdb.replace(func() error {
+		return rd.Restore(r)
+	})
+}
+
+// SnapshotConfig defines a set of options for a SnapshotScheduler.
+type SnapshotConfig struct {
+	// Interval is the duration between snapshots.
+	Interval time.Duration
+	// Retain is the number of most recent snapshots kept in Dir; older ones
+	// are removed. A zero Retain keeps all snapshots.
+	Retain int
+	// Dir is the directory snapshot files are written to.
+	Dir string
+}
+
+const (
+	snapshotPrefix     = "snapshot-"
+	snapshotSuffix     = ".db"
+	snapshotTimeLayout = "20060102T150405Z"
+)
+
+// SnapshotScheduler periodically writes snapshots of a database to files in a
+// directory while the database remains in use.
+type SnapshotScheduler struct {
+	Database *DatabaseService
+	Config   SnapshotConfig
+	// OnError is called with the errors encountered while writing snapshots
+	// in the background.
+	OnError func(error)
+	// NewProgress, if set, is called before each snapshot to obtain the
+	// Progress its writing is reported to.
+	NewProgress func() Progress
+
+	stop chan struct{}
+	done chan struct{}
+	mu   sync.Mutex
+}
+
+// NewSnapshotScheduler returns a SnapshotScheduler for the given database.
+func NewSnapshotScheduler(
+	dbs *DatabaseService, conf SnapshotConfig, onError func(error),
+) *SnapshotScheduler {
+	return &SnapshotScheduler{
+		Database: dbs,
+		Config:   conf,
+		OnError:  onError,
+	}
+}
+
+// Start begins writing snapshots in the background at every interval.
+func (s *SnapshotScheduler) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop != nil {
+		return errors.New("snapshot scheduler already started")
+	}
+	if s.Config.Interval <= 0 {
+		return fmt.Errorf("interval %s: %w", s.Config.Interval, ErrInvalid)
+	}
+	err := os.MkdirAll(s.Config.Dir, 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.run(s.stop, s.done)
+	return nil
+}
+
+// Stop stops writing snapshots and waits for a snapshot in progress to
+// finish.
+func (s *SnapshotScheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	s.stop, s.done = nil, nil
+}
+
+func (s *SnapshotScheduler) run(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(s.Config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case t := <-ticker.C:
+			_, err := s.Snapshot(t)
+			if err != nil && s.OnError != nil {
+				s.OnError(err)
+			}
+		}
+	}
+}
+
+// Snapshot writes a snapshot of the database, stamped with the given time, to
+// the snapshot directory, then removes old snapshots beyond the retention
+// count. It returns the path of the new snapshot.
+func (s *SnapshotScheduler) Snapshot(t time.Time) (string, error) {
+	name := snapshotPrefix + t.UTC().Format(snapshotTimeLayout) + snapshotSuffix
+	path := filepath.Join(s.Config.Dir, name)
+
+	// Write to a temporary file first so that incomplete snapshots are never
+	// mistaken for complete ones
+	tmp, err := ioutil.TempFile(s.Config.Dir, name+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if s.NewProgress != nil {
+		_, err = s.Database.BackupWithProgress(tmp, s.NewProgress())
+	} else {
+		_, err = s.Database.Backup(tmp)
+	}
+	if err != nil {
+		tmp.Close()
+		return "", err
+	}
+	err = tmp.Sync()
+	if err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to sync snapshot file: %w", err)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to close snapshot file: %w", err)
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return "", fmt.Errorf("failed to rename snapshot file: %w", err)
+	}
+
+	err = s.prune()
+	if err != nil {
+		return path, err
+	}
+	return path, nil
+}
+
+// Snapshots returns the paths of the snapshots in the snapshot directory,
+// oldest first.
+func (s *SnapshotScheduler) Snapshots() ([]string, error) {
+	infos, err := ioutil.ReadDir(s.Config.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot directory: %w", err)
+	}
+
+	paths := []string{}
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() ||
+			!strings.HasPrefix(name, snapshotPrefix) ||
+			!strings.HasSuffix(name, snapshotSuffix) {
+			continue
+		}
+		paths = append(paths, filepath.Join(s.Config.Dir, name))
+	}
+
+	// Timestamps in the names sort chronologically
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// prune removes the oldest snapshots beyond the retention count.
+func (s *SnapshotScheduler) prune() error {
+	if s.Config.Retain <= 0 {
+		return nil
+	}
+
+	paths, err := s.Snapshots()
+	if err != nil {
+		return err
+	}
+
+	for len(paths) > s.Config.Retain {
+		err = os.Remove(paths[0])
+		if err != nil {
+			return fmt.Errorf("failed to remove old snapshot: %w", err)
+		}
+		paths = paths[1:]
+	}
+	return nil
+}
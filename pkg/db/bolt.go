@@ -12,6 +12,9 @@ type BoltDatabase struct {
 	Bolt         *bolt.DB
 	Buckets      []string
 	ClearOnClose bool
+	// Keys is the encoding of the IDs of records as their keys; BinaryKeys
+	// if nil.
+	Keys KeyEncoding
 }
 
 // BoltTx implements Transaction for boltDB.
@@ -30,6 +33,11 @@ func (btx *BoltTx) Unwrap() interface{} {
 	return btx.Tx
 }
 
+// Writable returns whether the transaction allows updates.
+func (btx *BoltTx) Writable() bool {
+	return btx.Tx.Writable()
+}
+
 // BoltDatabaseConfig defines a set of options to be passed when opening a
 // boltDB instance.
 type BoltDatabaseConfig struct {
@@ -37,6 +45,11 @@ type BoltDatabaseConfig struct {
 	FileMode     os.FileMode
 	Buckets      []string
 	ClearOnClose bool
+	Keys         KeyEncoding
+	// VerifyOnly fails connecting to a database that lacks some of Buckets
+	// with ErrBucketMissing, rather than creating them. They are still
+	// created in a new database.
+	VerifyOnly bool
 }
 
 // ConnectBoltDatabase connects to the database file at the given path and
@@ -48,27 +61,21 @@ func ConnectBoltDatabase(conf *BoltDatabaseConfig) (*BoltDatabase, error) {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
+	db := BoltDatabase{
+		Bolt:         bdb,
+		Buckets:      conf.Buckets,
+		ClearOnClose: conf.ClearOnClose,
+		Keys:         conf.Keys,
+	}
+
 	// Check buckets exist
 	if len(conf.Buckets) > 0 {
-		err = bdb.Update(func(tx *bolt.Tx) error {
-			for _, bucket := range conf.Buckets {
-				_, err = tx.CreateBucketIfNotExists([]byte(bucket))
-				if err != nil {
-					return fmt.Errorf("failed to create bucket: %w", err)
-				}
-			}
-			return nil
-		})
+		err = db.ensureBuckets(conf.VerifyOnly)
 		if err != nil {
+			bdb.Close()
 			return nil, err
 		}
 	}
-
-	db := BoltDatabase{
-		Bolt:         bdb,
-		Buckets:      conf.Buckets,
-		ClearOnClose: conf.ClearOnClose,
-	}
 	return &db, nil
 }
 
@@ -105,7 +112,29 @@ func (db *BoltDatabase) Clear() error {
 	return nil
 }
 
-// Bucket returns the bucket with the given name
+// ensureBuckets creates the expected buckets missing from the database, or
+// returns ErrBucketMissing if verifyOnly and the database is not new.
+func (db *BoltDatabase) ensureBuckets(verifyOnly bool) error {
+	missing, err := db.VerifyBuckets(false)
+	if err != nil {
+		return err
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if verifyOnly && len(missing) < len(db.Buckets) {
+		return bucketMissing(missing...)
+	}
+	_, err = db.VerifyBuckets(true)
+	if err != nil {
+		return fmt.Errorf("failed to create buckets: %w", err)
+	}
+	return nil
+}
+
+// Bucket returns the bucket with the given name. Expected buckets that are
+// missing are created in writable transactions; otherwise, missing buckets
+// return ErrBucketMissing.
 func (db *BoltDatabase) Bucket(name string, tx Tx) (*bolt.Bucket, error) {
 	// Unwrap transaction
 	btx, err := db.unwrapTx(tx)
@@ -115,11 +144,28 @@ func (db *BoltDatabase) Bucket(name string, tx Tx) (*bolt.Bucket, error) {
 
 	// Return bucket
 	bucket := btx.Bucket([]byte(name))
-	if bucket == nil {
-		return nil, fmt.Errorf("bucket: %w", errNotFound)
+	if bucket != nil {
+		return bucket, nil
+	}
+	if !btx.Writable() || !db.expects(name) {
+		return nil, bucketMissing(name)
+	}
+	bucket, err = btx.CreateBucket([]byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bucket %q: %w", name, err)
 	}
 	return bucket, nil
+}
 
+// expects returns whether the bucket of the given name is among those
+// expected by the database.
+func (db *BoltDatabase) expects(name string) bool {
+	for _, bucket := range db.Buckets {
+		if bucket == name {
+			return true
+		}
+	}
+	return false
 }
 
 // Transaction is a wrapper method that begins a transaction and passes it to
@@ -177,14 +223,24 @@ func (db *BoltDatabase) Create(m Model, ser Service, tx Tx) (int, error) {
 		return 0, fmt.Errorf("%s %q: %w", errmsgBucketOpen, ser.Bucket(), err)
 	}
 
-	// Get next ID in sequence and assign to
-	// model
-	id, err := b.NextSequence()
-	if err != nil {
-		return 0, fmt.Errorf("%s: %w", errmsgBucketNextSeq, err)
+	// Generate a new ID and assign to model; random IDs are regenerated on
+	// the unlikely collision with an existing record
+	gen := IDGenerators.ForBucket(ser.Bucket())
+	var id int
+	for attempt := 0; ; attempt++ {
+		id, err = gen.NextID(b)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", errmsgBucketNextSeq, err)
+		}
+		if b.Get(db.key(id)) == nil {
+			break
+		}
+		if attempt >= maxIDAttempts {
+			return 0, fmt.Errorf("id %d: %w", id, ErrConflict)
+		}
 	}
 	meta := m.Metadata()
-	meta.ID = int(id)
+	meta.ID = id
 
 	// Save model in bucket
 	buf, err := ser.Marshal(m)
@@ -192,7 +248,7 @@ func (db *BoltDatabase) Create(m Model, ser Service, tx Tx) (int, error) {
 		return 0, fmt.Errorf("%s: %w", errmsgModelMarshal, err)
 	}
 
-	err = b.Put(itob(meta.ID), buf)
+	err = b.Put(db.key(meta.ID), buf)
 	if err != nil {
 		return 0, fmt.Errorf("%s %q: %w", errmsgBucketPut, ser.Bucket(), err)
 	}
@@ -232,7 +288,7 @@ func (db *BoltDatabase) Update(m Model, ser Service, tx Tx) error {
 		return fmt.Errorf("%s: %w", errmsgModelMarshal, err)
 	}
 
-	err = b.Put(itob(m.Metadata().ID), buf)
+	err = b.Put(db.key(m.Metadata().ID), buf)
 	if err != nil {
 		return fmt.Errorf("%s %q: %w", errmsgBucketPut, ser.Bucket(), err)
 	}
@@ -265,10 +321,7 @@ func (db *BoltDatabase) Delete(id int, ser Service, tx Tx) error {
 		return fmt.Errorf("%s %q: %w", errmsgBucketOpen, ser.Bucket(), err)
 	}
 
-	m, err := db.GetByID(id, ser, tx)
-
-	// Store existing model to return
-	err = b.Delete(itob(id))
+	err = b.Delete(db.key(id))
 	if err != nil {
 		return fmt.Errorf("failed to delete by id %d: %w", id, err)
 	}
@@ -317,65 +370,95 @@ func (db *BoltDatabase) GetRawByID(id int, ser Service, tx Tx) ([]byte, error) {
 	}
 
 	// Get entity by ID, exit if error
-	v := b.Get(itob(id))
+	v := b.Get(db.key(id))
 	if v == nil {
-		return nil, fmt.Errorf("model with id %d: %w", id, errNotFound)
+		return nil, fmt.Errorf("model with id %d: %w", id, ErrNotFound)
 	}
 
 	return v, nil
 }
 
-// DoMultiple unmarshals and performs some function on the persisted elements
-// that pass the given filter function specified by the given IDs.
-func (db *BoltDatabase) DoMultiple(ids []int, ser Service, tx Tx,
-	do func(Model, Service, Tx) (exit bool, err error), iff func(Model) bool) error {
+// GetRawAll retrieves the raw values of all persisted instances of a Model
+// type in key order.
+func (db *BoltDatabase) GetRawAll(ser Service, tx Tx) ([][]byte, error) {
 	// Unwrap transaction
 	_, err := db.unwrapTx(tx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Check service
 	err = CheckService(ser)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// If filter function is nil, filter nothing
-	if iff == nil {
-		iff = func(_ Model) bool {
-			return true
+	// Get bucket, exit if error
+	b, err := db.Bucket(ser.Bucket(), tx)
+	if err != nil {
+		return nil, fmt.Errorf("%s %q: %w", errmsgBucketOpen, ser.Bucket(), err)
+	}
+
+	list := [][]byte{}
+	err = b.ForEach(func(_, v []byte) error {
+		err := checkScan(len(list), ser, tx)
+		if err != nil {
+			return err
 		}
+		list = append(list, v)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate through %q: %w", ser.Bucket(), err)
 	}
 
-	// Calculate start and end numbers
-	start, end := db.calculatePaginationBounds(nil, nil)
+	return list, nil
+}
 
-	// Iterate through values
-	i := start
-	for _, id := range ids {
-		if i >= end {
-			break
-		}
+// CountAll returns the number of persisted instances of a Model type, from the
+// statistics of its bucket.
+func (db *BoltDatabase) CountAll(ser Service, tx Tx) (int, error) {
+	// Unwrap transaction
+	_, err := db.unwrapTx(tx)
+	if err != nil {
+		return 0, err
+	}
 
-		m, err := db.GetByID(id, ser, tx)
-		if err != nil {
-			return fmt.Errorf("failed to get Model by id %d: %w", id, err)
-		}
+	// Check service
+	err = CheckService(ser)
+	if err != nil {
+		return 0, err
+	}
 
-		// Check if pases filter
-		if !iff(m) {
-			continue
-		}
+	// Get bucket, exit if error
+	b, err := db.Bucket(ser.Bucket(), tx)
+	if err != nil {
+		return 0, fmt.Errorf("%s %q: %w", errmsgBucketOpen, ser.Bucket(), err)
+	}
 
-		exit, err := do(m, ser, tx)
-		if exit {
-			return err
-		}
-		i++
+	return b.Stats().KeyN, nil
+}
+
+// DoMultiple unmarshals and performs some function on the persisted elements
+// that pass the given filter function specified by the given IDs.
+func (db *BoltDatabase) DoMultiple(ids []int, ser Service, tx Tx,
+	do func(Model, Service, Tx) (exit bool, err error), iff func(Model) bool) error {
+	// Unwrap transaction
+	_, err := db.unwrapTx(tx)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	// Check service
+	err = CheckService(ser)
+	if err != nil {
+		return err
+	}
+
+	get := func(id int) (Model, error) {
+		return db.GetByID(id, ser, tx)
+	}
+	return doMultiple(ids, ser, tx, get, do, iff)
 }
 
 // DoEach unmarshals and performs some function on each persisted element
@@ -400,84 +483,26 @@ func (db *BoltDatabase) DoEach(first *int, skip *int, ser Service, tx Tx,
 		return fmt.Errorf("%s %q: %w", errmsgBucketOpen, ser.Bucket(), err)
 	}
 
-	// Calculate start and end numbers
-	start, end := db.calculatePaginationBounds(first, skip)
-
-	// Get cursor for bucket
+	// Iterate through values in key order
 	c := b.Cursor()
-
-	// Move cursor to starting element
-	var k, v []byte
-	c.First()
-	for i := 0; i < start; k, v = c.Next() {
-		if iff == nil {
-			i++
-		} else {
-			m, err := ser.Unmarshal(v)
-			if err != nil {
-				return fmt.Errorf("%s: %w", errmsgModelUnmarshal, err)
-			}
-
-			if iff(m) {
-				i++
-			}
-		}
-	}
-
-	if iff == nil {
-		iff = func(_ Model) bool {
-			return true
-		}
-	}
-
-	// Iterate until end is reached
-	for i := start; i < end && k != nil; k, v = c.Next() {
-		// Unmarshal element
-		m, err := ser.Unmarshal(v)
-		if err != nil {
-			return fmt.Errorf("%s: %w", errmsgModelUnmarshal, err)
-		}
-
-		// If element does not pass filter, continue to next
-		if !iff(m) {
-			continue
+	k, v := c.First()
+	next := func() ([]byte, bool) {
+		if k == nil {
+			return nil, false
 		}
-
-		exit, err := do(m, ser, tx)
-		if exit {
-			return err
-		}
-		i++
+		cur := v
+		k, v = c.Next()
+		return cur, true
 	}
 
-	return nil
+	return doEach(first, skip, ser, tx, next, do, iff)
 }
 
 // FindFirst returns the first element that matches the conditions in the
 // given function. Elements are iterated through in key order.
 func (db *BoltDatabase) FindFirst(
 	ser Service, tx Tx, match func(Model) (bool, error)) (Model, error) {
-	var found Model
-	check := func(m Model, _ Service, _ Tx) (exit bool, err error) {
-		t, err := match(m)
-		if err != nil {
-			return true, fmt.Errorf("failed to check if match was found: %w", err)
-		}
-
-		if t {
-			found = m
-			return true, nil
-		}
-
-		return false, nil
-	}
-
-	err := db.DoEach(nil, nil, ser, tx, check, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	return found, nil
+	return findFirst(ser, tx, db.DoEach, match)
 }
 
 // iterateKeys iterates through the keys of the given database bucket and
@@ -512,49 +537,17 @@ func (db *BoltDatabase) FindFirst(
 // return nil
 // }
 
-func (db *BoltDatabase) assertTx(tx Tx) (*BoltTx, error) {
-	btx, ok := tx.(*BoltTx)
-	if !ok {
-		return nil, fmt.Errorf("transaction type %T: %w", tx, errInvalid)
-	}
-	return btx, nil
-}
-
 func (db *BoltDatabase) unwrapTx(tx Tx) (*bolt.Tx, error) {
-	btx, err := db.assertTx(tx)
-	if err != nil {
-		return nil, err
+	if tx == nil {
+		return nil, fmt.Errorf("transaction: %w", errNil)
 	}
 
-	unwrapped := btx.Unwrap()
+	unwrapped := tx.Unwrap()
 	inner, ok := unwrapped.(*bolt.Tx)
 	if !ok {
 		return nil,
-			fmt.Errorf("wrapped transaction type %T: %w", unwrapped, errInvalid)
+			fmt.Errorf("wrapped transaction type %T: %w", unwrapped, ErrInvalid)
 	}
 
 	return inner, nil
 }
-
-func (db *BoltDatabase) calculatePaginationBounds(first *int, skip *int) (int, int) {
-	// The number of elements to skip
-	var start int
-	if skip == nil || *skip <= 0 {
-		start = 0
-	} else {
-		start = *skip
-	}
-
-	// When iterator reaches this number, stop
-	var end int
-	if first == nil || *first < 0 {
-		// Return all elements if `first` is nil
-		end = -1
-	} else if *first == 0 {
-		end = start
-	} else {
-		end = start + *first
-	}
-
-	return start, end
-}
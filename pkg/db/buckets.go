@@ -0,0 +1,74 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BucketVerifier is implemented by DatabaseDrivers that can check that the
+// buckets they expect exist.
+type BucketVerifier interface {
+	VerifyBuckets(repair bool) ([]string, error)
+}
+
+// VerifyBuckets returns the names of the buckets expected by the database that
+// are missing from it, creating them if repair is true.
+func (dbs *DatabaseService) VerifyBuckets(repair bool) ([]string, error) {
+	bv, ok := dbs.DatabaseDriver.(BucketVerifier)
+	if !ok {
+		return nil, errors.New("database driver does not support bucket verification")
+	}
+	return bv.VerifyBuckets(repair)
+}
+
+// VerifyBuckets returns the names of the expected buckets that are missing
+// from the database, creating them if repair is true.
+func (db *BoltDatabase) VerifyBuckets(repair bool) ([]string, error) {
+	missing := []string{}
+	check := func(tx *bolt.Tx) error {
+		for _, bucket := range db.Buckets {
+			if tx.Bucket([]byte(bucket)) != nil {
+				continue
+			}
+			missing = append(missing, bucket)
+			if !repair {
+				continue
+			}
+			_, err := tx.CreateBucket([]byte(bucket))
+			if err != nil {
+				return fmt.Errorf("failed to create bucket %q: %w", bucket, err)
+			}
+		}
+		return nil
+	}
+
+	var err error
+	if repair {
+		err = db.Bolt.Update(check)
+	} else {
+		err = db.Bolt.View(check)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return missing, nil
+}
+
+// VerifyBuckets returns the names of the buckets expected by the underlying
+// database that are missing from it, creating them if repair is true.
+func (cdb *CachedDatabase) VerifyBuckets(repair bool) ([]string, error) {
+	bv, ok := cdb.Driver.(BucketVerifier)
+	if !ok {
+		return nil, errors.New("database driver does not support bucket verification")
+	}
+	return bv.VerifyBuckets(repair)
+}
+
+// bucketMissing returns an error wrapping ErrBucketMissing for the buckets of
+// the given names.
+func bucketMissing(names ...string) error {
+	return fmt.Errorf("%s: %w", strings.Join(names, ", "), ErrBucketMissing)
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestVerifyBuckets tests that missing buckets are reported, refused when
+// only verifying, created when repairing, and created on demand in writable
+// transactions.
+func TestVerifyBuckets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nao-buckets")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.db")
+	connect := func(buckets []string, verifyOnly bool) (*BoltDatabase, error) {
+		return ConnectBoltDatabase(&BoltDatabaseConfig{
+			Path:       path,
+			FileMode:   0600,
+			Buckets:    buckets,
+			VerifyOnly: verifyOnly,
+		})
+	}
+
+	// A new database has its buckets created even when only verifying
+	bdb, err := connect([]string{"A"}, true)
+	if err != nil {
+		t.Fatalf("failed to connect to new database: %v", err)
+	}
+	bdb.Close()
+
+	_, err = connect([]string{"A", "B", "C"}, true)
+	if !errors.Is(err, ErrBucketMissing) {
+		t.Fatalf("expected ErrBucketMissing, got %v", err)
+	}
+
+	bdb, err = ConnectBoltDatabase(&BoltDatabaseConfig{Path: path, FileMode: 0600})
+	if err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+	bdb.Buckets = []string{"A", "B", "C"}
+	defer bdb.Close()
+
+	missing, err := bdb.VerifyBuckets(false)
+	if err != nil {
+		t.Fatalf("failed to verify buckets: %v", err)
+	}
+	if !reflect.DeepEqual(missing, []string{"B", "C"}) {
+		t.Fatalf("expected B and C missing, got %v", missing)
+	}
+
+	// Read-only transactions do not create buckets
+	err = bdb.Transaction(false, func(tx Tx) error {
+		_, err := bdb.Bucket("B", tx)
+		return err
+	})
+	if !errors.Is(err, ErrBucketMissing) {
+		t.Fatalf("expected ErrBucketMissing in read-only transaction, got %v", err)
+	}
+
+	// Writable transactions create expected buckets only
+	err = bdb.Transaction(true, func(tx Tx) error {
+		_, err := bdb.Bucket("B", tx)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to create bucket in writable transaction: %v", err)
+	}
+	err = bdb.Transaction(true, func(tx Tx) error {
+		_, err := bdb.Bucket("D", tx)
+		return err
+	})
+	if !errors.Is(err, ErrBucketMissing) {
+		t.Fatalf("expected ErrBucketMissing for unexpected bucket, got %v", err)
+	}
+
+	missing, err = bdb.VerifyBuckets(true)
+	if err != nil {
+		t.Fatalf("failed to repair buckets: %v", err)
+	}
+	if !reflect.DeepEqual(missing, []string{"C"}) {
+		t.Fatalf("expected C missing, got %v", missing)
+	}
+	missing, err = bdb.VerifyBuckets(false)
+	if err != nil {
+		t.Fatalf("failed to verify buckets: %v", err)
+	}
+	if len(missing) != 0 {
+		t.Fatalf("expected no buckets missing after repair, got %v", missing)
+	}
+}
@@ -0,0 +1,484 @@
+package db
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// CacheConfig defines a set of options for a CachedDatabase.
+type CacheConfig struct {
+	// Size is the maximum number of records held in the cache.
+	Size int
+	// TTL is the duration after which a cached record expires. A zero TTL
+	// means records never expire.
+	TTL time.Duration
+}
+
+// CachedDatabase is a DatabaseDriver that serves reads in read-only
+// transactions from an in-memory LRU cache in front of another
+// DatabaseDriver. Cached records are invalidated whenever an instance in their
+// bucket is created, updated, or deleted.
+//
+// Read-only transactions begun before a write to a bucket was committed
+// neither read nor cache its records, as they may still read the values of
+// before the write, which would otherwise be cached after its invalidation.
+// Neither do transactions while a write to the bucket is in flight, from its
+// first change until its generation advances after the underlying driver
+// committed or rolled it back, so that none begun once the write was
+// committed may be served the values of before it.
+type CachedDatabase struct {
+	Driver DatabaseDriver
+	lru    *lruCache
+
+	// gens are the generations of the buckets written to, the epoch at the
+	// end of the last writable transaction that wrote to them
+	gens map[string]uint64
+	// cleared is the generation of all buckets, the epoch they were last
+	// replaced at
+	cleared uint64
+	// epoch is incremented at the end of each transaction that wrote to
+	// some bucket and whenever the buckets are replaced
+	epoch uint64
+	// writing are the numbers of writes in flight to the buckets, and
+	// replacing the number of replacements of all buckets in flight
+	writing   map[string]int
+	replacing int
+	mu        sync.Mutex
+}
+
+// NewCachedDatabase returns a CachedDatabase in front of the given driver.
+func NewCachedDatabase(driver DatabaseDriver, conf CacheConfig) *CachedDatabase {
+	return &CachedDatabase{
+		Driver:  driver,
+		lru:     newLRUCache(conf.Size, conf.TTL),
+		gens:    map[string]uint64{},
+		writing: map[string]int{},
+	}
+}
+
+// cachedTx wraps the transaction of the underlying driver so that operations
+// through it are passed through the cache.
+type cachedTx struct {
+	Tx
+	db      *DatabaseService
+	touched map[cacheKey]bool
+	// writing are the buckets the transaction has marked as written to
+	writing map[string]bool
+	// epoch is the epoch of the database when the transaction was begun
+	epoch uint64
+}
+
+// Database returns the database of the transaction.
+func (ctx *cachedTx) Database() *DatabaseService {
+	return ctx.db
+}
+
+// Transaction begins a transaction with the underlying driver and passes it
+// to the given function.
+func (cdb *CachedDatabase) Transaction(writable bool, logic func(Tx) error) error {
+	touched := map[cacheKey]bool{}
+	writing := map[string]bool{}
+	// The epoch is taken before the transaction is begun, so that the writes
+	// it may not see are of later generations
+	cdb.mu.Lock()
+	epoch := cdb.epoch
+	cdb.mu.Unlock()
+	// The buckets written to are only marked as no longer in flight once the
+	// underlying transaction has ended, even if the logic panics
+	defer func() {
+		if len(touched) > 0 {
+			cdb.commit(touched, writing)
+		}
+	}()
+	return cdb.Driver.Transaction(writable, func(tx Tx) error {
+		return logic(&cachedTx{
+			Tx:      tx,
+			db:      &DatabaseService{DatabaseDriver: cdb},
+			touched: touched,
+			writing: writing,
+			epoch:   epoch,
+		})
+	})
+}
+
+// commit advances the generations of the buckets of the given keys, modified
+// in a transaction that has ended, invalidates the keys again, in case they
+// were cached by concurrent reads of the old values before the write, and
+// marks the given buckets as no longer written to by it.
+func (cdb *CachedDatabase) commit(touched map[cacheKey]bool, writing map[string]bool) {
+	cdb.mu.Lock()
+	defer cdb.mu.Unlock()
+
+	cdb.epoch++
+	for key := range touched {
+		cdb.gens[key.bucket] = cdb.epoch
+		cdb.lru.remove(key)
+	}
+	for bucket := range writing {
+		cdb.writing[bucket]--
+		if cdb.writing[bucket] <= 0 {
+			delete(cdb.writing, bucket)
+		}
+	}
+}
+
+// replace calls the given function, which replaces the contents of the
+// underlying database, with all buckets marked as written to, and then
+// empties the cache and advances the generations of all buckets.
+func (cdb *CachedDatabase) replace(fn func() error) error {
+	cdb.mu.Lock()
+	cdb.replacing++
+	cdb.mu.Unlock()
+
+	defer func() {
+		cdb.mu.Lock()
+		defer cdb.mu.Unlock()
+
+		cdb.replacing--
+		cdb.epoch++
+		cdb.cleared = cdb.epoch
+		cdb.lru.clear()
+	}()
+	return fn()
+}
+
+// cacheable returns true if the records of the given bucket may be read from
+// the cache in the given transaction: it is read-only, was begun after the
+// last write to the bucket was committed, and no write to the bucket is in
+// flight.
+func (cdb *CachedDatabase) cacheable(bucket string, tx Tx) bool {
+	if tx.Writable() {
+		return false
+	}
+	ctx, ok := innerTx(tx).(*cachedTx)
+	if !ok {
+		return false
+	}
+
+	cdb.mu.Lock()
+	defer cdb.mu.Unlock()
+	return cdb.current(bucket, ctx.epoch)
+}
+
+// cache adds the given value of the given key, read in the given
+// transaction, to the cache, unless a write to its bucket was committed
+// since the transaction was begun or is in flight, as the value may then be
+// stale.
+func (cdb *CachedDatabase) cache(key cacheKey, value interface{}, weight int, tx Tx) {
+	ctx, ok := innerTx(tx).(*cachedTx)
+	if !ok {
+		return
+	}
+
+	// The cache is added to while holding the lock, so that writes are not
+	// committed between the check and the addition
+	cdb.mu.Lock()
+	defer cdb.mu.Unlock()
+	if cdb.current(key.bucket, ctx.epoch) {
+		cdb.lru.add(key, value, weight)
+	}
+}
+
+// current returns true if no write to the given bucket was committed since
+// the given epoch or is in flight. The lock must be held.
+func (cdb *CachedDatabase) current(bucket string, epoch uint64) bool {
+	return cdb.gens[bucket] <= epoch && cdb.cleared <= epoch &&
+		cdb.writing[bucket] == 0 && cdb.replacing == 0
+}
+
+// Close closes the underlying driver.
+func (cdb *CachedDatabase) Close() error {
+	return cdb.Driver.Close()
+}
+
+// DoMultiple unmarshals and performs some function on the persisted elements
+// that pass the given filter function specified by the given IDs.
+func (cdb *CachedDatabase) DoMultiple(ids []int, ser Service, tx Tx,
+	do func(Model, Service, Tx) (exit bool, err error), iff func(Model) bool) error {
+	get := func(id int) (Model, error) {
+		return cdb.GetByID(id, ser, tx)
+	}
+	return doMultiple(ids, ser, tx, get, do, iff)
+}
+
+// DoEach unmarshals and performs some function on each persisted element
+// that passes the filter function.
+func (cdb *CachedDatabase) DoEach(first *int, skip *int, ser Service, tx Tx,
+	do func(Model, Service, Tx) (exit bool, err error), iff func(Model) bool) error {
+	if !cdb.cacheable(ser.Bucket(), tx) {
+		return cdb.Driver.DoEach(first, skip, ser, tx, do, iff)
+	}
+
+	vlist, err := cdb.GetRawAll(ser, tx)
+	if err != nil {
+		return err
+	}
+
+	i := 0
+	next := func() ([]byte, bool) {
+		if i >= len(vlist) {
+			return nil, false
+		}
+		i++
+		return vlist[i-1], true
+	}
+	return doEach(first, skip, ser, tx, next, do, iff)
+}
+
+// FindFirst returns the first element that matches the conditions in the
+// given function.
+func (cdb *CachedDatabase) FindFirst(
+	ser Service, tx Tx, match func(Model) (bool, error)) (Model, error) {
+	return findFirst(ser, tx, cdb.DoEach, match)
+}
+
+// Create persists the given Model and invalidates the cached records of its
+// bucket.
+func (cdb *CachedDatabase) Create(m Model, ser Service, tx Tx) (int, error) {
+	id, err := cdb.Driver.Create(m, ser, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	cdb.invalidate(allKey(ser.Bucket()), tx)
+	return id, nil
+}
+
+// Update replaces the value of the Model with the given ID and invalidates
+// the cached records of its bucket.
+func (cdb *CachedDatabase) Update(m Model, ser Service, tx Tx) error {
+	err := cdb.Driver.Update(m, ser, tx)
+	if err != nil {
+		return err
+	}
+
+	cdb.invalidate(recordKey(ser.Bucket(), m.Metadata().ID), tx)
+	cdb.invalidate(allKey(ser.Bucket()), tx)
+	return nil
+}
+
+// Delete deletes the Model with the given ID and invalidates the cached
+// records of its bucket.
+func (cdb *CachedDatabase) Delete(id int, ser Service, tx Tx) error {
+	err := cdb.Driver.Delete(id, ser, tx)
+	if err != nil {
+		return err
+	}
+
+	cdb.invalidate(recordKey(ser.Bucket(), id), tx)
+	cdb.invalidate(allKey(ser.Bucket()), tx)
+	return nil
+}
+
+// GetByID retrieves the persisted Model with the given ID.
+func (cdb *CachedDatabase) GetByID(id int, ser Service, tx Tx) (Model, error) {
+	v, err := cdb.GetRawByID(id, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := ser.Unmarshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// GetRawByID retrieves the raw value of the persisted Model with the given
+// ID, from the cache if possible; see cacheable.
+func (cdb *CachedDatabase) GetRawByID(id int, ser Service, tx Tx) ([]byte, error) {
+	if !cdb.cacheable(ser.Bucket(), tx) {
+		return cdb.Driver.GetRawByID(id, ser, tx)
+	}
+
+	key := recordKey(ser.Bucket(), id)
+	if v, ok := cdb.lru.get(key); ok {
+		return v.([]byte), nil
+	}
+
+	v, err := cdb.Driver.GetRawByID(id, ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	v = copyBytes(v)
+	cdb.cache(key, v, 1, tx)
+	return v, nil
+}
+
+// GetRawAll retrieves the raw values of all persisted instances of a Model
+// type, from the cache if possible; see cacheable.
+func (cdb *CachedDatabase) GetRawAll(ser Service, tx Tx) ([][]byte, error) {
+	if !cdb.cacheable(ser.Bucket(), tx) {
+		return cdb.Driver.GetRawAll(ser, tx)
+	}
+
+	key := allKey(ser.Bucket())
+	if v, ok := cdb.lru.get(key); ok {
+		return v.([][]byte), nil
+	}
+
+	vlist, err := cdb.Driver.GetRawAll(ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	cached := make([][]byte, len(vlist))
+	for i, v := range vlist {
+		cached[i] = copyBytes(v)
+	}
+	cdb.cache(key, cached, len(cached), tx)
+	return cached, nil
+}
+
+// CountAll returns the number of persisted instances of a Model type, from
+// the wrapped driver if it can count them without decoding.
+func (cdb *CachedDatabase) CountAll(ser Service, tx Tx) (int, error) {
+	if cd, ok := cdb.Driver.(CountDriver); ok {
+		return cd.CountAll(ser, tx)
+	}
+
+	vlist, err := cdb.GetRawAll(ser, tx)
+	if err != nil {
+		return 0, err
+	}
+	return len(vlist), nil
+}
+
+// invalidate removes the given key from the cache and marks it as modified in
+// the transaction, and its bucket as written to until the transaction ends.
+func (cdb *CachedDatabase) invalidate(key cacheKey, tx Tx) {
+	ctx, ok := innerTx(tx).(*cachedTx)
+
+	cdb.mu.Lock()
+	defer cdb.mu.Unlock()
+	if ok {
+		ctx.touched[key] = true
+		if !ctx.writing[key.bucket] {
+			ctx.writing[key.bucket] = true
+			cdb.writing[key.bucket]++
+		}
+	}
+	cdb.lru.remove(key)
+}
+
+func copyBytes(v []byte) []byte {
+	c := make([]byte, len(v))
+	copy(c, v)
+	return c
+}
+
+// cacheKey identifies either a single record or all the records of a bucket.
+type cacheKey struct {
+	bucket string
+	id     int
+	all    bool
+}
+
+func recordKey(bucket string, id int) cacheKey {
+	return cacheKey{bucket: bucket, id: id}
+}
+
+func allKey(bucket string) cacheKey {
+	return cacheKey{bucket: bucket, all: true}
+}
+
+// lruCache is a size-bounded, least-recently-used cache safe for concurrent
+// use. Each entry has a weight, and the total weight of all entries is kept
+// under the size of the cache.
+type lruCache struct {
+	size   int
+	ttl    time.Duration
+	weight int
+	order  *list.List
+	items  map[cacheKey]*list.Element
+	mu     sync.Mutex
+}
+
+type lruEntry struct {
+	key     cacheKey
+	value   interface{}
+	weight  int
+	expires time.Time
+}
+
+func newLRUCache(size int, ttl time.Duration) *lruCache {
+	return &lruCache{
+		size:  size,
+		ttl:   ttl,
+		order: list.New(),
+		items: map[cacheKey]*list.Element{},
+	}
+}
+
+func (c *lruCache) get(key cacheKey) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*lruEntry)
+	if c.ttl > 0 && time.Now().After(e.expires) {
+		c.removeElement(el)
+		return nil, false
+	}
+
+	c.order.MoveToFront(el)
+	return e.value, true
+}
+
+func (c *lruCache) add(key cacheKey, value interface{}, weight int) {
+	// Entries larger than the whole cache are never cached
+	if weight > c.size {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+
+	e := &lruEntry{
+		key:     key,
+		value:   value,
+		weight:  weight,
+		expires: time.Now().Add(c.ttl),
+	}
+	c.items[key] = c.order.PushFront(e)
+	c.weight += weight
+
+	// Evict least recently used entries until under size
+	for c.weight > c.size {
+		c.removeElement(c.order.Back())
+	}
+}
+
+func (c *lruCache) remove(key cacheKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+func (c *lruCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	c.items = map[cacheKey]*list.Element{}
+	c.weight = 0
+}
+
+func (c *lruCache) removeElement(el *list.Element) {
+	e := c.order.Remove(el).(*lruEntry)
+	delete(c.items, e.key)
+	c.weight -= e.weight
+}
@@ -0,0 +1,286 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// cacheModel is a Model whose records are its value.
+type cacheModel struct {
+	Meta  ModelMetadata
+	Value string
+}
+
+func (m *cacheModel) Metadata() *ModelMetadata {
+	return &m.Meta
+}
+
+// cacheService is a Service of cacheModels in the bucket of contextModels.
+type cacheService struct {
+	contextService
+}
+
+func (ser *cacheService) Marshal(m Model) ([]byte, error) {
+	return []byte(m.(*cacheModel).Value), nil
+}
+
+func (ser *cacheService) Unmarshal(buf []byte) (Model, error) {
+	return &cacheModel{Value: string(buf)}, nil
+}
+
+// TestLRUCache tests that the least recently used entries are evicted to
+// keep the total weight of the cache under its size, that entries heavier
+// than the cache are not cached, and that entries expire.
+func TestLRUCache(t *testing.T) {
+	c := newLRUCache(4, 0)
+	a, b, d := recordKey("B", 1), recordKey("B", 2), recordKey("B", 3)
+	all := allKey("B")
+
+	c.add(a, "a", 1)
+	c.add(b, "b", 1)
+	c.add(d, "d", 1)
+	c.get(a)
+	// Evicts b then d, the least recently used
+	c.add(all, "all", 3)
+	for key, cached := range map[cacheKey]bool{a: true, b: false, d: false, all: true} {
+		if _, ok := c.get(key); ok != cached {
+			t.Errorf("expected %+v cached %v, got %v", key, cached, ok)
+		}
+	}
+	if c.weight != 4 {
+		t.Errorf("expected weight 4, got %d", c.weight)
+	}
+
+	c.add(all, "all", 5)
+	if _, ok := c.get(all); !ok {
+		t.Errorf("expected entry heavier than the cache to keep the old value")
+	}
+	c.remove(all)
+	if c.weight != 1 {
+		t.Errorf("expected weight 1 after removal, got %d", c.weight)
+	}
+
+	c = newLRUCache(4, time.Millisecond)
+	c.add(a, "a", 1)
+	time.Sleep(2 * time.Millisecond)
+	if _, ok := c.get(a); ok || c.weight != 0 {
+		t.Errorf("expected entry to expire")
+	}
+}
+
+// TestCachedDatabaseInvalidation tests that records written to in committed
+// and rolled back transactions are read anew.
+func TestCachedDatabaseInvalidation(t *testing.T) {
+	dbs, cleanup := newContextDatabase(t, 3)
+	defer cleanup()
+	cdb := NewCachedDatabase(dbs.DatabaseDriver, CacheConfig{Size: 10})
+	ser := &cacheService{}
+
+	read := func() string {
+		var v string
+		err := cdb.Transaction(false, func(tx Tx) error {
+			m, err := cdb.GetByID(1, ser, tx)
+			if err != nil {
+				return err
+			}
+			v = m.(*cacheModel).Value
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		return v
+	}
+	write := func(v string, fail error) error {
+		return cdb.Transaction(true, func(tx Tx) error {
+			err := cdb.Update(&cacheModel{Meta: ModelMetadata{ID: 1}, Value: v}, ser, tx)
+			if err != nil {
+				return err
+			}
+			return fail
+		})
+	}
+
+	if v := read(); v != "1" {
+		t.Fatalf("expected 1, got %q", v)
+	}
+	if _, ok := cdb.lru.get(recordKey(ser.Bucket(), 1)); !ok {
+		t.Fatalf("expected record to be cached")
+	}
+
+	err := write("committed", nil)
+	if err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if v := read(); v != "committed" {
+		t.Errorf("expected committed value, got %q", v)
+	}
+
+	rollback := errors.New("rollback")
+	err = write("rolled back", rollback)
+	if !errors.Is(err, rollback) {
+		t.Fatalf("expected rollback, got %v", err)
+	}
+	if v := read(); v != "committed" {
+		t.Errorf("expected committed value after rollback, got %q", v)
+	}
+}
+
+// TestCachedDatabaseStaleRead tests that reads of a record in transactions
+// begun before a write to it was committed are not cached.
+func TestCachedDatabaseStaleRead(t *testing.T) {
+	dbs, cleanup := newContextDatabase(t, 3)
+	defer cleanup()
+	cdb := NewCachedDatabase(dbs.DatabaseDriver, CacheConfig{Size: 10})
+	ser := &cacheService{}
+
+	// Bolt remaps its file to grow it only once no transactions are open, so
+	// it is grown beforehand, and the pages freed, for the write not to wait
+	// for the read
+	big := &cacheModel{Value: string(make([]byte, 1<<19))}
+	for _, write := range []func(tx Tx) error{
+		func(tx Tx) error {
+			_, err := cdb.Create(big, ser, tx)
+			return err
+		},
+		func(tx Tx) error {
+			return cdb.Delete(big.Meta.ID, ser, tx)
+		},
+		func(tx Tx) error {
+			return cdb.Update(&cacheModel{Meta: ModelMetadata{ID: 2}, Value: "2"}, ser, tx)
+		},
+	} {
+		err := cdb.Transaction(true, write)
+		if err != nil {
+			t.Fatalf("failed to grow database: %v", err)
+		}
+	}
+
+	begun, written, done := make(chan bool), make(chan bool), make(chan string)
+	go func() {
+		var v string
+		cdb.Transaction(false, func(tx Tx) error {
+			begun <- true
+			<-written
+			m, err := cdb.GetByID(1, ser, tx)
+			if err == nil {
+				v = m.(*cacheModel).Value
+			}
+			return err
+		})
+		done <- v
+	}()
+
+	<-begun
+	err := cdb.Transaction(true, func(tx Tx) error {
+		return cdb.Update(&cacheModel{Meta: ModelMetadata{ID: 1}, Value: "new"}, ser, tx)
+	})
+	if err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	close(written)
+	if v := <-done; v != "1" {
+		t.Fatalf("expected old value in transaction begun before the write, got %q", v)
+	}
+
+	err = cdb.Transaction(false, func(tx Tx) error {
+		m, err := cdb.GetByID(1, ser, tx)
+		if err != nil {
+			return err
+		}
+		if v := m.(*cacheModel).Value; v != "new" {
+			t.Errorf("expected new value, got %q", v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+}
+
+// commitHookDriver is a DatabaseDriver that calls a function after each
+// writable transaction of the driver it wraps has ended.
+type commitHookDriver struct {
+	DatabaseDriver
+	after func()
+}
+
+func (d *commitHookDriver) Transaction(writable bool, logic func(Tx) error) error {
+	err := d.DatabaseDriver.Transaction(writable, logic)
+	if writable && d.after != nil {
+		d.after()
+	}
+	return err
+}
+
+// TestCachedDatabaseCommitWindow tests that values read while a write to
+// their bucket is in flight are not cached, so that transactions begun once
+// the underlying driver committed the write, but before the cache advanced
+// its generation, are not served the values of before it.
+func TestCachedDatabaseCommitWindow(t *testing.T) {
+	dbs, cleanup := newContextDatabase(t, 3)
+	defer cleanup()
+	hook := &commitHookDriver{DatabaseDriver: dbs.DatabaseDriver}
+	cdb := NewCachedDatabase(hook, CacheConfig{Size: 10})
+	ser := &cacheService{}
+
+	read := func() string {
+		var v string
+		err := cdb.Transaction(false, func(tx Tx) error {
+			m, err := cdb.GetByID(1, ser, tx)
+			if err == nil {
+				v = m.(*cacheModel).Value
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		return v
+	}
+
+	// A transaction begun before the write reads the old value while the
+	// write is in flight
+	begun, written, done := make(chan bool), make(chan bool), make(chan string)
+	go func() {
+		var v string
+		cdb.Transaction(false, func(tx Tx) error {
+			begun <- true
+			<-written
+			m, err := cdb.GetByID(1, ser, tx)
+			if err == nil {
+				v = m.(*cacheModel).Value
+			}
+			return err
+		})
+		done <- v
+	}()
+	<-begun
+
+	var inWindow string
+	hook.after = func() {
+		hook.after = nil
+		inWindow = read()
+	}
+	err := cdb.Transaction(true, func(tx Tx) error {
+		err := cdb.Update(&cacheModel{Meta: ModelMetadata{ID: 1}, Value: "new"}, ser, tx)
+		if err != nil {
+			return err
+		}
+		close(written)
+		if v := <-done; v != "1" {
+			t.Errorf("expected old value in transaction begun before the write, got %q", v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if inWindow != "new" {
+		t.Errorf("expected new value once committed, got %q", inWindow)
+	}
+	if v := read(); v != "new" {
+		t.Errorf("expected new value, got %q", v)
+	}
+}
@@ -0,0 +1,155 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	json "github.com/json-iterator/go"
+	"github.com/vmihailenco/msgpack"
+)
+
+// Format is a single byte prefixed to every encoded record that identifies
+// the Codec it was encoded with.
+type Format byte
+
+const (
+	// FormatJSON identifies records encoded with JSONCodec.
+	FormatJSON Format = 0x01
+	// FormatMsgpack identifies records encoded with MsgpackCodec.
+	FormatMsgpack Format = 0x02
+)
+
+// Codec defines an encoding used to store records.
+type Codec interface {
+	Format() Format
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(buf []byte, v interface{}) error
+}
+
+// JSONCodec encodes records as JSON.
+type JSONCodec struct{}
+
+// Format returns FormatJSON.
+func (JSONCodec) Format() Format {
+	return FormatJSON
+}
+
+// Marshal encodes the given value into JSON.
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes the given JSON into the given value.
+func (JSONCodec) Unmarshal(buf []byte, v interface{}) error {
+	return json.Unmarshal(buf, v)
+}
+
+// MsgpackCodec encodes records as MessagePack.
+type MsgpackCodec struct{}
+
+// Format returns FormatMsgpack.
+func (MsgpackCodec) Format() Format {
+	return FormatMsgpack
+}
+
+// Marshal encodes the given value into MessagePack.
+func (MsgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+// Unmarshal decodes the given MessagePack into the given value.
+func (MsgpackCodec) Unmarshal(buf []byte, v interface{}) error {
+	return msgpack.Unmarshal(buf, v)
+}
+
+// CodecByName returns the Codec with the given name, either "json" or
+// "msgpack".
+func CodecByName(name string) (Codec, error) {
+	switch name {
+	case "json":
+		return JSONCodec{}, nil
+	case "msgpack":
+		return MsgpackCodec{}, nil
+	}
+	return nil, fmt.Errorf("codec %q: %w", name, ErrInvalid)
+}
+
+// CodecSet selects the Codec used to encode the records of each bucket.
+// Records are always decoded with the Codec identified by their format byte,
+// so the Codec of a bucket may be changed without re-encoding existing data.
+type CodecSet struct {
+	Default Codec
+	Buckets map[string]Codec
+}
+
+// Codecs is the CodecSet used by the data layer services.
+var Codecs = &CodecSet{
+	Default: JSONCodec{},
+	Buckets: map[string]Codec{},
+}
+
+// ForBucket returns the Codec used to encode records in the given bucket.
+// Bucket names are also matched in lower case, as read from config files.
+func (cs *CodecSet) ForBucket(bucket string) Codec {
+	c, ok := cs.Buckets[bucket]
+	if !ok {
+		c, ok = cs.Buckets[strings.ToLower(bucket)]
+	}
+	if !ok || c == nil {
+		return cs.Default
+	}
+	return c
+}
+
+// Encode encodes the given value with the Codec of the given bucket and
+// prefixes the result with the format byte.
+func (cs *CodecSet) Encode(bucket string, v interface{}) ([]byte, error) {
+	c := cs.ForBucket(bucket)
+	buf, err := c.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errmsgModelMarshal, err)
+	}
+	return append([]byte{byte(c.Format())}, buf...), nil
+}
+
+// Decode decodes the given record into the given value with the Codec
+// identified by its format byte. Records without a format byte are legacy
+// records and are decoded as JSON.
+func (cs *CodecSet) Decode(buf []byte, v interface{}) error {
+	if len(buf) == 0 {
+		return fmt.Errorf("record: %w", ErrInvalid)
+	}
+
+	var c Codec
+	switch Format(buf[0]) {
+	case FormatJSON:
+		c, buf = JSONCodec{}, buf[1:]
+	case FormatMsgpack:
+		c, buf = MsgpackCodec{}, buf[1:]
+	default:
+		c = JSONCodec{}
+	}
+
+	err := c.Unmarshal(buf, v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelUnmarshal, err)
+	}
+	return nil
+}
+
+// Reencode rewrites every persisted instance of the Model type of the given
+// service with the Codec currently configured for its bucket.
+func (dbs *DatabaseService) Reencode(ser Service, tx Tx) (int, error) {
+	list, err := dbs.GetAll(nil, nil, ser, tx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get all in %q: %w", ser.Bucket(), err)
+	}
+
+	for _, m := range list {
+		err = dbs.DatabaseDriver.Update(m, ser, tx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to re-encode id %d: %w", m.Metadata().ID, err)
+		}
+	}
+	return len(list), nil
+}
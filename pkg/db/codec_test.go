@@ -0,0 +1,56 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCodecSetDecode tests that records encoded in any format, including
+// legacy records without a format byte, are decoded.
+func TestCodecSetDecode(t *testing.T) {
+	type record struct {
+		Name string
+		Meta ModelMetadata
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	exp := record{Name: "A", Meta: ModelMetadata{ID: 3, CreatedAt: now}}
+
+	legacy, err := JSONCodec{}.Marshal(exp)
+	if err != nil {
+		t.Fatalf("failed to encode legacy record: %v", err)
+	}
+
+	cases := []struct {
+		name  string
+		codec Codec
+	}{
+		{"json", JSONCodec{}},
+		{"msgpack", MsgpackCodec{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cs := &CodecSet{Default: tc.codec}
+			buf, err := cs.Encode("Bucket", exp)
+			if err != nil {
+				t.Fatalf("failed to encode: %v", err)
+			}
+			if Format(buf[0]) != tc.codec.Format() {
+				t.Fatalf("expected format %d, but got %d", tc.codec.Format(), buf[0])
+			}
+
+			for _, b := range [][]byte{buf, legacy} {
+				var res record
+				err = cs.Decode(b, &res)
+				if err != nil {
+					t.Fatalf("failed to decode: %v", err)
+				}
+				if res.Name != exp.Name || res.Meta.ID != exp.Meta.ID ||
+					!res.Meta.CreatedAt.Equal(exp.Meta.CreatedAt) {
+					t.Fatalf("expected %v, but got %v", exp, res)
+				}
+			}
+		})
+	}
+}
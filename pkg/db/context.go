@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// scanBatch is the number of records scanned between checks of whether the
+// context of the transaction has been cancelled or timed out.
+const scanBatch = 256
+
+// contextTx is a transaction begun with TransactionContext, which carries
+// the context it was begun with.
+type contextTx struct {
+	Tx
+	ctx context.Context
+}
+
+// withContext returns logic that passes the transaction it is given, carrying
+// the given context, to the given function, unless the context is already
+// done.
+func withContext(ctx context.Context, logic func(Tx) error) func(Tx) error {
+	return func(tx Tx) error {
+		err := ctx.Err()
+		if err != nil {
+			return fmt.Errorf("transaction not begun: %w", err)
+		}
+		return logic(&contextTx{Tx: tx, ctx: ctx})
+	}
+}
+
+// TxContext returns the context the given transaction was begun with by
+// TransactionContext, or an empty context if it was begun without one.
+func TxContext(tx Tx) context.Context {
+	if ctx, ok := tx.(*contextTx); ok {
+		return ctx.ctx
+	}
+	return context.Background()
+}
+
+// innerTx returns the transaction of the driver the given transaction wraps,
+// if it was begun with TransactionContext.
+func innerTx(tx Tx) Tx {
+	if ctx, ok := tx.(*contextTx); ok {
+		return ctx.Tx
+	}
+	return tx
+}
+
+// checkScan returns an error wrapping that of the context of the given
+// transaction if it has been cancelled or timed out, once every scanBatch
+// records, given the number of records scanned so far in the bucket of the
+// given service. Scans stop on the error, so that they do not outlive the
+// requests they serve.
+func checkScan(n int, ser Service, tx Tx) error {
+	if n%scanBatch != 0 {
+		return nil
+	}
+	err := TxContext(tx).Err()
+	if err != nil {
+		return fmt.Errorf("scan of %q stopped: %w", ser.Bucket(), err)
+	}
+	return nil
+}
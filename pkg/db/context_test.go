@@ -0,0 +1,167 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// contextModel is a Model whose records are its ID.
+type contextModel struct {
+	Meta ModelMetadata
+}
+
+func (m *contextModel) Metadata() *ModelMetadata {
+	return &m.Meta
+}
+
+// contextService is a Service of contextModels, of which only the methods
+// used by scans are implemented.
+type contextService struct {
+	Service
+}
+
+func (ser *contextService) Bucket() string {
+	return "Context"
+}
+
+func (ser *contextService) Unmarshal(buf []byte) (Model, error) {
+	id, err := strconv.Atoi(string(buf))
+	if err != nil {
+		return nil, err
+	}
+	return &contextModel{Meta: ModelMetadata{ID: id}}, nil
+}
+
+// newContextDatabase returns a database whose bucket of contextModels holds
+// the given number of records, and a function that removes it.
+func newContextDatabase(t *testing.T, count int) (*DatabaseService, func()) {
+	dir, err := ioutil.TempDir("", "nao-context")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+
+	ser := &contextService{}
+	bdb, err := ConnectBoltDatabase(&BoltDatabaseConfig{
+		Path:     filepath.Join(dir, "test.db"),
+		FileMode: 0600,
+		Buckets:  []string{ser.Bucket()},
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+	cleanup := func() {
+		bdb.Close()
+		os.RemoveAll(dir)
+	}
+
+	err = bdb.Transaction(true, func(tx Tx) error {
+		b, err := bdb.Bucket(ser.Bucket(), tx)
+		if err != nil {
+			return err
+		}
+		for i := 1; i <= count; i++ {
+			err = b.Put(itob(i), []byte(strconv.Itoa(i)))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		cleanup()
+		t.Fatalf("failed to fill bucket: %v", err)
+	}
+	return &DatabaseService{DatabaseDriver: bdb}, cleanup
+}
+
+// TestTransactionContext tests that scans through transactions begun with a
+// context stop once it is cancelled, and that transactions are not begun
+// with contexts already done.
+func TestTransactionContext(t *testing.T) {
+	const count = 4 * scanBatch
+	dbs, cleanup := newContextDatabase(t, count)
+	defer cleanup()
+	ser := &contextService{}
+
+	err := dbs.Transaction(false, func(tx Tx) error {
+		if TxContext(tx) != context.Background() {
+			t.Errorf("expected background context of transaction begun without one")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	// Scans run to completion while the context is not done
+	err = dbs.TransactionContext(context.Background(), false, func(tx Tx) error {
+		list, err := dbs.GetAll(nil, nil, ser, tx)
+		if err != nil {
+			return err
+		}
+		if len(list) != count {
+			t.Errorf("expected %d records, got %d", count, len(list))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to scan: %v", err)
+	}
+
+	// Scans stop within a batch of the context being cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	scanned := 0
+	err = dbs.TransactionContext(ctx, false, func(tx Tx) error {
+		if TxContext(tx) != ctx {
+			t.Errorf("expected context of transaction to be that it was begun with")
+		}
+		return dbs.DoEach(nil, nil, ser, tx, func(m Model, _ Service, _ Tx) (bool, error) {
+			scanned++
+			if scanned == 10 {
+				cancel()
+			}
+			return false, nil
+		}, nil)
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected scan to stop with context.Canceled, got %v", err)
+	}
+	if scanned != scanBatch {
+		t.Fatalf("expected %d records scanned, got %d", scanBatch, scanned)
+	}
+
+	err = dbs.TransactionContext(ctx, false, func(tx Tx) error {
+		t.Errorf("expected transaction not to begin with cancelled context")
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	err = dbs.TransactionContext(ctx, false, func(tx Tx) error {
+		cancel()
+		_, err := dbs.GetRawAll(ser, tx)
+		return err
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected raw scan to stop with context.Canceled, got %v", err)
+	}
+
+	// Commit hooks are registered through transactions begun with a context
+	committed := false
+	err = dbs.TransactionContext(context.Background(), true, func(tx Tx) error {
+		return OnCommit(tx, func() { committed = true })
+	})
+	if err != nil {
+		t.Fatalf("failed to register commit hook: %v", err)
+	}
+	if !committed {
+		t.Fatalf("expected commit hook to be called")
+	}
+}
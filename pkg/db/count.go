@@ -0,0 +1,54 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CountDriver is implemented by DatabaseDrivers that can count the persisted
+// instances of a Model type without decoding them.
+type CountDriver interface {
+	CountAll(ser Service, tx Tx) (int, error)
+}
+
+// Count returns the number of persisted instances of a Model type that pass
+// the filter. A nil filter passes all, and the instances are then counted
+// without being decoded.
+func (dbs *DatabaseService) Count(ser Service, tx Tx, keep func(m Model) bool) (int, error) {
+	if keep == nil {
+		cd, ok := dbs.DatabaseDriver.(CountDriver)
+		if ok {
+			return cd.CountAll(ser, tx)
+		}
+
+		raw, err := dbs.DatabaseDriver.GetRawAll(ser, tx)
+		if err != nil {
+			return 0, err
+		}
+		return len(raw), nil
+	}
+
+	n := 0
+	count := func(_ Model, _ Service, _ Tx) (exit bool, err error) {
+		n++
+		return false, nil
+	}
+	err := dbs.DoEach(nil, nil, ser, tx, count, keep)
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Exists returns true if an instance of a Model type with the given ID is
+// persisted. The instance is not decoded.
+func (dbs *DatabaseService) Exists(id int, ser Service, tx Tx) (bool, error) {
+	_, err := dbs.DatabaseDriver.GetRawByID(id, ser, tx)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get by id %d: %w", id, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,23 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+)
+
+// EncodeCursor returns an opaque cursor that points to the persisted instance
+// of a Model type with the given ID, derived from its key in the bucket.
+func EncodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString(itob(id))
+}
+
+// DecodeCursor returns the ID of the instance the given cursor points to, or
+// an error wrapping ErrInvalid if it is not a cursor.
+func DecodeCursor(cursor string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(b) != 8 {
+		return 0, fmt.Errorf("cursor %q: %w", cursor, ErrInvalid)
+	}
+	return int(binary.BigEndian.Uint64(b)), nil
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -23,9 +24,68 @@ type ModelMetadata struct {
 	Version   int
 }
 
+// UpdatedSince returns true if the Model was updated after the given time, or
+// if the time is nil.
+func (meta *ModelMetadata) UpdatedSince(since *time.Time) bool {
+	return since == nil || meta.UpdatedAt.After(*since)
+}
+
 // DatabaseService provides
 type DatabaseService struct {
 	DatabaseDriver
+	// Tracer, if set, traces the transactions begun with TransactionContext.
+	Tracer TxTracer
+}
+
+// Normalizer normalizes Models of any type for storage.
+type Normalizer interface {
+	Normalize(m Model) error
+}
+
+// ModelNormalizer, if set, normalizes the Models of every type as they are
+// created and updated, before their services validate and clean them.
+var ModelNormalizer Normalizer
+
+// normalize normalizes the given Model with the ModelNormalizer, if set.
+func normalize(m Model) error {
+	if ModelNormalizer == nil {
+		return nil
+	}
+	err := ModelNormalizer.Normalize(m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errmsgModelCleaning, err)
+	}
+	return nil
+}
+
+// TxTracer traces database transactions.
+type TxTracer interface {
+	// StartTx is called as a transaction begins with the context it was begun
+	// with, and the function it returns as the transaction ends.
+	StartTx(ctx context.Context, writable bool) func(err error)
+}
+
+// TransactionContext begins a transaction, traced with the given context,
+// and passes it to the given function. Writable transactions are rolled back
+// if the context is that of a dry run. The transaction carries the context,
+// as returned by TxContext, and scans through it stop with an error wrapping
+// that of the context once it is cancelled or times out.
+func (dbs *DatabaseService) TransactionContext(
+	ctx context.Context, writable bool, logic func(Tx) error,
+) error {
+	logic = withContext(ctx, logic)
+	transaction := dbs.Transaction
+	if writable && IsDryRun(ctx) {
+		transaction = dbs.dryRunTransaction
+	}
+	if dbs.Tracer == nil {
+		return transaction(writable, logic)
+	}
+
+	finish := dbs.Tracer.StartTx(ctx, writable)
+	err := transaction(writable, logic)
+	finish(err)
+	return err
 }
 
 // Create persists a new instance of a Model type.
@@ -36,6 +96,12 @@ func (dbs *DatabaseService) Create(m Model, ser Service, tx Tx) (int, error) {
 		return 0, err
 	}
 
+	// Normalize model
+	err = normalize(m)
+	if err != nil {
+		return 0, err
+	}
+
 	// Verify validity of model
 	err = ser.Validate(m, tx)
 	if err != nil {
@@ -48,6 +114,12 @@ func (dbs *DatabaseService) Create(m Model, ser Service, tx Tx) (int, error) {
 		return 0, fmt.Errorf("%s: %w", errmsgModelCleaning, err)
 	}
 
+	// Check that unique keys are not held by others
+	err = dbs.checkUnique(m, ser, tx)
+	if err != nil {
+		return 0, err
+	}
+
 	// Initialize metadata
 	meta := m.Metadata()
 	meta.CreatedAt = time.Now()
@@ -98,6 +170,12 @@ func (dbs *DatabaseService) Update(m Model, ser Service, tx Tx) error {
 		return fmt.Errorf("failed to get by id %d: %w", m.Metadata().ID, err)
 	}
 
+	// Normalize model
+	err = normalize(m)
+	if err != nil {
+		return err
+	}
+
 	// Verify validity of model
 	err = ser.Validate(m, tx)
 	if err != nil {
@@ -110,9 +188,16 @@ func (dbs *DatabaseService) Update(m Model, ser Service, tx Tx) error {
 		return fmt.Errorf("%s: %w", errmsgModelCleaning, err)
 	}
 
+	// Check that unique keys are not held by others
+	err = dbs.checkUnique(m, ser, tx)
+	if err != nil {
+		return err
+	}
+
 	// Replace properties of updated with certain frozen
 	// ones of old
 	meta := m.Metadata()
+	meta.CreatedAt = o.Metadata().CreatedAt
 	meta.UpdatedAt = time.Now()
 	meta.Version = meta.Version + 1
 	err = ser.PersistOldProperties(m, o, tx)
@@ -241,6 +326,24 @@ func (dbs *DatabaseService) GetMultiple(ids []int, ser Service, tx Tx,
 	return list, nil
 }
 
+// GetByIDs retrieves the persisted instances of a Model type with the given
+// IDs, in the order of the IDs. IDs of no persisted instance are left nil in
+// the list.
+func (dbs *DatabaseService) GetByIDs(ids []int, ser Service, tx Tx) ([]Model, error) {
+	list := make([]Model, len(ids))
+	for i, id := range ids {
+		m, err := dbs.DatabaseDriver.GetByID(id, ser, tx)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get by id %d: %w", id, err)
+		}
+		list[i] = m
+	}
+	return list, nil
+}
+
 // GetAll retrieves all persisted instances of a Model type with the given data
 // layer service.
 //
@@ -292,23 +395,168 @@ type DatabaseDriver interface {
 	Delete(id int, ser Service, tx Tx) error
 	GetByID(id int, ser Service, tx Tx) (Model, error)
 	GetRawByID(id int, ser Service, tx Tx) ([]byte, error)
+	// GetRawAll retrieves the raw values of all persisted instances of a Model
+	// type in key order. The values are only valid for the life of the
+	// transaction.
+	GetRawAll(ser Service, tx Tx) ([][]byte, error)
 }
 
 // Tx defines a wrapper for database transactions objects.
 type Tx interface {
 	Database() *DatabaseService
 	Unwrap() interface{}
+	Writable() bool
+}
+
+// doMultiple performs some function on the elements specified by the given
+// IDs, retrieved with the given function, that pass the filter function.
+func doMultiple(ids []int, ser Service, tx Tx, get func(id int) (Model, error),
+	do func(Model, Service, Tx) (exit bool, err error), iff func(Model) bool) error {
+	for i, id := range ids {
+		err := checkScan(i, ser, tx)
+		if err != nil {
+			return err
+		}
+
+		m, err := get(id)
+		if err != nil {
+			return fmt.Errorf("failed to get Model by id %d: %w", id, err)
+		}
+
+		// Check if passes filter
+		if iff != nil && !iff(m) {
+			continue
+		}
+
+		exit, err := do(m, ser, tx)
+		if exit {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// doEach unmarshals and performs some function on each raw element yielded
+// by next that passes the filter function, skipping the first `skip` and
+// stopping after `first` of those elements.
+func doEach(first *int, skip *int, ser Service, tx Tx, next func() ([]byte, bool),
+	do func(Model, Service, Tx) (exit bool, err error), iff func(Model) bool) error {
+	// If filter function is nil, filter nothing
+	if iff == nil {
+		iff = func(_ Model) bool {
+			return true
+		}
+	}
+
+	// Calculate start and end numbers
+	start, end := calculatePaginationBounds(first, skip)
+
+	for i, n := 0, 0; end < 0 || i < end; n++ {
+		err := checkScan(n, ser, tx)
+		if err != nil {
+			return err
+		}
+
+		v, ok := next()
+		if !ok {
+			break
+		}
+
+		// Unmarshal element
+		m, err := ser.Unmarshal(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", errmsgModelUnmarshal, err)
+		}
+
+		// If element does not pass filter, continue to next
+		if !iff(m) {
+			continue
+		}
+
+		// Skip elements until start is reached
+		if i < start {
+			i++
+			continue
+		}
+
+		exit, err := do(m, ser, tx)
+		if exit {
+			return err
+		}
+		i++
+	}
+
+	return nil
+}
+
+// findFirst returns the first element iterated through by each that matches
+// the conditions in the given function.
+func findFirst(ser Service, tx Tx,
+	each func(first *int, skip *int, ser Service, tx Tx,
+		do func(Model, Service, Tx) (exit bool, err error), iff func(Model) bool) error,
+	match func(Model) (bool, error)) (Model, error) {
+	var found Model
+	check := func(m Model, _ Service, _ Tx) (exit bool, err error) {
+		t, err := match(m)
+		if err != nil {
+			return true, fmt.Errorf("failed to check if match was found: %w", err)
+		}
+
+		if t {
+			found = m
+			return true, nil
+		}
+
+		return false, nil
+	}
+
+	err := each(nil, nil, ser, tx, check, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return found, nil
+}
+
+// calculatePaginationBounds returns the number of elements to skip and the
+// number at which to stop; a negative end means no limit.
+func calculatePaginationBounds(first *int, skip *int) (int, int) {
+	// The number of elements to skip
+	var start int
+	if skip == nil || *skip <= 0 {
+		start = 0
+	} else {
+		start = *skip
+	}
+
+	// When iterator reaches this number, stop
+	var end int
+	if first == nil || *first < 0 {
+		// Return all elements if `first` is nil
+		end = -1
+	} else if *first == 0 {
+		end = start
+	} else {
+		end = start + *first
+	}
+
+	return start, end
 }
 
 var (
 	// errNil is an error returned when some pointer is nil.
 	errNil = errors.New("is nil")
-	// errNotFound is an error returned when the requested object is not found.
-	errNotFound = errors.New("not found")
-	// errAlreadyExists is an error returned when a unique value already exists.
-	errAlreadyExists = errors.New("already exists")
-	// errInvalid is an error returned when some value is invalid.
-	errInvalid = errors.New("invalid")
+	// ErrNotFound is an error returned when the requested object is not found.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is an error returned when a unique value already exists.
+	ErrConflict = errors.New("already exists")
+	// ErrInvalid is an error returned when some value is invalid.
+	ErrInvalid = errors.New("invalid")
+	// ErrBucketMissing is an error returned when a bucket is missing from the
+	// database. Unlike ErrNotFound, it is a fault of the database rather than
+	// of the request.
+	ErrBucketMissing = errors.New("bucket missing")
 	// errUnwritableTx is an error returned when an update attempt was made with
 	// a transaction object that does now allow updates.
 	errUnwritableTx = errors.New("read-only transaction")
@@ -322,7 +570,7 @@ const (
 	errmsgModelMarshal    = "failed to marshal model"
 	errmsgModelUnmarshal  = "failed to unmarshal model"
 	errmsgBucketOpen      = "failed to open bucket"
-	errmsgBucketNextSeq   = "failed to generate next sequence ID"
+	errmsgBucketNextSeq   = "failed to generate ID"
 	errmsgBucketPut       = "failed to put value in bucket"
 	errmsgBucketDelete    = "failed to delete value in bucket"
 )
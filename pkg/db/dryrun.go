@@ -0,0 +1,44 @@
+package db
+
+import (
+	"context"
+	"errors"
+)
+
+// dryRunKey is the context key of the flag of dry runs.
+type dryRunKey struct{}
+
+// errDryRun is returned by the logic of the transactions of dry runs to roll
+// them back.
+var errDryRun = errors.New("dry run")
+
+// WithDryRun returns a copy of the given context in which the writable
+// transactions begun with TransactionContext are rolled back once their logic
+// succeeds, so that the writes are cleaned, validated and seen by the rest of
+// the logic, but not persisted. The functions registered with OnCommit are
+// not called.
+func WithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, true)
+}
+
+// IsDryRun returns true if the given context is that of a dry run.
+func IsDryRun(ctx context.Context) bool {
+	dry, _ := ctx.Value(dryRunKey{}).(bool)
+	return dry
+}
+
+// dryRunTransaction begins a transaction and passes it to the given
+// function, rolling it back even if the function succeeds.
+func (dbs *DatabaseService) dryRunTransaction(writable bool, logic func(Tx) error) error {
+	err := dbs.Transaction(writable, func(tx Tx) error {
+		err := logic(tx)
+		if err != nil {
+			return err
+		}
+		return errDryRun
+	})
+	if errors.Is(err, errDryRun) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,207 @@
+package db
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxIDAttempts is the number of times a new ID is regenerated when it
+// collides with an existing record.
+const maxIDAttempts = 3
+
+// Sequence is a monotonically increasing counter kept by a bucket.
+type Sequence interface {
+	NextSequence() (uint64, error)
+}
+
+// MaxID is the largest ID generated by the IDGenerators other than
+// SequenceIDGenerator, 2^53 - 1, the largest integer that JSON numbers carry
+// exactly to clients that read them as doubles, such as JavaScript.
+const MaxID = 1<<53 - 1
+
+// IDGenerator defines a strategy for assigning IDs to new records. Generated
+// IDs must be positive, and should not exceed MaxID. IDs are integers, so
+// UUIDs are not among the strategies; records of federated databases get
+// collision-free IDs from SnowflakeIDGenerators of distinct node numbers.
+type IDGenerator interface {
+	NextID(seq Sequence) (int, error)
+}
+
+// SequenceIDGenerator assigns IDs from the sequence of the bucket, so IDs are
+// consecutive in order of creation.
+type SequenceIDGenerator struct{}
+
+// NextID returns the next value of the bucket sequence.
+func (SequenceIDGenerator) NextID(seq Sequence) (int, error) {
+	id, err := seq.NextSequence()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+const (
+	snowflakeNodeBits    = 6
+	snowflakeCounterBits = 6
+	snowflakeNodeMax     = 1<<snowflakeNodeBits - 1
+	snowflakeCounterMax  = 1<<snowflakeCounterBits - 1
+)
+
+// SnowflakeEpoch is the time from which the timestamps of snowflake IDs are
+// counted.
+var SnowflakeEpoch = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// SnowflakeIDGenerator assigns time-ordered IDs composed of the milliseconds
+// since SnowflakeEpoch in 41 bits, the node number in 6 bits, and a
+// per-millisecond counter in 6 bits, which fit under MaxID for 69 years from
+// the epoch. IDs sort by creation time across nodes, and nodes with distinct
+// numbers never generate the same ID.
+type SnowflakeIDGenerator struct {
+	node    int
+	last    int64
+	counter int
+	mu      sync.Mutex
+}
+
+// NewSnowflakeIDGenerator returns a SnowflakeIDGenerator for the given node
+// number, between 0 and 63.
+func NewSnowflakeIDGenerator(node int) (*SnowflakeIDGenerator, error) {
+	if node < 0 || node > snowflakeNodeMax {
+		return nil, fmt.Errorf("node %d: %w", node, ErrInvalid)
+	}
+	return &SnowflakeIDGenerator{node: node}, nil
+}
+
+// NextID returns a new snowflake ID.
+func (g *SnowflakeIDGenerator) NextID(_ Sequence) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := time.Since(SnowflakeEpoch).Milliseconds()
+	if ms < g.last {
+		// Never go backwards if the clock does
+		ms = g.last
+	}
+
+	if ms == g.last {
+		g.counter++
+		if g.counter > snowflakeCounterMax {
+			// Borrow from the next millisecond once the counter is exhausted
+			ms++
+			g.counter = 0
+		}
+	} else {
+		g.counter = 0
+	}
+	g.last = ms
+
+	id := ms<<(snowflakeNodeBits+snowflakeCounterBits) |
+		int64(g.node)<<snowflakeCounterBits |
+		int64(g.counter)
+	return int(id), nil
+}
+
+// RandomIDGenerator assigns random 53-bit IDs drawn from crypto/rand, up to
+// MaxID. Collisions within a database are regenerated, but records created
+// independently in separate databases collide with a chance of about 1% once
+// they number ten million together, so merging them is not collision-free.
+type RandomIDGenerator struct{}
+
+// NextID returns a new random ID.
+func (RandomIDGenerator) NextID(_ Sequence) (int, error) {
+	var b [8]byte
+	for {
+		_, err := rand.Read(b[:])
+		if err != nil {
+			return 0, fmt.Errorf("failed to read random bytes: %w", err)
+		}
+
+		id := int(binary.BigEndian.Uint64(b[:]) & MaxID)
+		if id != 0 {
+			return id, nil
+		}
+	}
+}
+
+const orderedRandomBits = 12
+
+// OrderedIDGenerator assigns time-ordered random IDs composed of the
+// milliseconds since SnowflakeEpoch in 41 bits and 12 random bits, which fit
+// under MaxID for 69 years from the epoch. IDs generated by one instance are
+// increasing and need no node number, but with only 12 random bits, IDs of
+// instances that create records in the same millisecond collide with a
+// chance of 1 in 4096 per pair; instances whose records are merged should
+// use SnowflakeIDGenerator with distinct node numbers instead.
+type OrderedIDGenerator struct {
+	last int
+	mu   sync.Mutex
+}
+
+// NextID returns a new time-ordered random ID.
+func (g *OrderedIDGenerator) NextID(_ Sequence) (int, error) {
+	var b [4]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return 0, fmt.Errorf("failed to read random bytes: %w", err)
+	}
+	r := int64(binary.BigEndian.Uint32(b[:]) & (1<<orderedRandomBits - 1))
+	ms := time.Since(SnowflakeEpoch).Milliseconds()
+	id := int(ms<<orderedRandomBits | r)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if id <= g.last {
+		// Keep increasing within the same millisecond or if the clock goes
+		// backwards
+		id = g.last + 1
+	}
+	g.last = id
+	return id, nil
+}
+
+// IDGeneratorByName returns the IDGenerator with the given name, either
+// "sequence", "snowflake", "random", or "ordered". The node number is used
+// only by snowflake generators.
+func IDGeneratorByName(name string, node int) (IDGenerator, error) {
+	switch name {
+	case "sequence":
+		return SequenceIDGenerator{}, nil
+	case "snowflake":
+		return NewSnowflakeIDGenerator(node)
+	case "random":
+		return RandomIDGenerator{}, nil
+	case "ordered":
+		return &OrderedIDGenerator{}, nil
+	}
+	return nil, fmt.Errorf("id generator %q: %w", name, ErrInvalid)
+}
+
+// IDGeneratorSet selects the IDGenerator used to assign IDs to new records in
+// each bucket.
+type IDGeneratorSet struct {
+	Default IDGenerator
+	Buckets map[string]IDGenerator
+}
+
+// IDGenerators is the IDGeneratorSet used by the database drivers.
+var IDGenerators = &IDGeneratorSet{
+	Default: SequenceIDGenerator{},
+	Buckets: map[string]IDGenerator{},
+}
+
+// ForBucket returns the IDGenerator used for new records in the given bucket.
+// Bucket names are also matched in lower case, as read from config files.
+func (gs *IDGeneratorSet) ForBucket(bucket string) IDGenerator {
+	g, ok := gs.Buckets[bucket]
+	if !ok {
+		g, ok = gs.Buckets[strings.ToLower(bucket)]
+	}
+	if !ok || g == nil {
+		return gs.Default
+	}
+	return g
+}
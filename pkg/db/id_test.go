@@ -0,0 +1,107 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+// TestSnowflakeIDGeneratorOrder tests that snowflake IDs are unique and
+// increasing, even when many are generated within the same millisecond.
+func TestSnowflakeIDGeneratorOrder(t *testing.T) {
+	gen, err := NewSnowflakeIDGenerator(7)
+	if err != nil {
+		t.Fatalf("failed to create generator: %v", err)
+	}
+
+	last := 0
+	for i := 0; i < 3*(snowflakeCounterMax+1); i++ {
+		id, err := gen.NextID(nil)
+		if err != nil {
+			t.Fatalf("failed to generate id: %v", err)
+		}
+		if id <= last {
+			t.Fatalf("id %d generated after %d", id, last)
+		}
+		if node := id >> snowflakeCounterBits & snowflakeNodeMax; node != 7 {
+			t.Fatalf("expected node 7 in id %d, got %d", id, node)
+		}
+		last = id
+	}
+}
+
+// TestOrderedIDGeneratorOrder tests that ordered IDs are increasing and carry
+// the time they were generated at.
+func TestOrderedIDGeneratorOrder(t *testing.T) {
+	gen, err := IDGeneratorByName("ordered", 0)
+	if err != nil {
+		t.Fatalf("failed to create generator: %v", err)
+	}
+
+	start := time.Since(SnowflakeEpoch).Milliseconds()
+	last := 0
+	for i := 0; i < 10000; i++ {
+		id, err := gen.NextID(nil)
+		if err != nil {
+			t.Fatalf("failed to generate id: %v", err)
+		}
+		if id <= last {
+			t.Fatalf("id %d generated after %d", id, last)
+		}
+		last = id
+	}
+	if ms := int64(last >> orderedRandomBits); ms < start {
+		t.Fatalf("expected timestamp of at least %d in id %d, got %d", start, last, ms)
+	}
+}
+
+// TestIDGeneratorRange tests that generated IDs do not exceed MaxID, and
+// survive being served as JSON numbers to clients reading them as doubles and
+// as GraphQL IDs.
+func TestIDGeneratorRange(t *testing.T) {
+	for _, name := range []string{"snowflake", "random", "ordered"} {
+		t.Run(name, func(t *testing.T) {
+			gen, err := IDGeneratorByName(name, snowflakeNodeMax)
+			if err != nil {
+				t.Fatalf("failed to create generator: %v", err)
+			}
+			for i := 0; i < 1000; i++ {
+				id, err := gen.NextID(nil)
+				if err != nil {
+					t.Fatalf("failed to generate id: %v", err)
+				}
+				if id <= 0 || id > MaxID {
+					t.Fatalf("id %d out of range", id)
+				}
+
+				b, err := json.Marshal(id)
+				if err != nil {
+					t.Fatalf("failed to marshal id %d: %v", id, err)
+				}
+				var f float64
+				err = json.Unmarshal(b, &f)
+				if err != nil {
+					t.Fatalf("failed to unmarshal id %s: %v", b, err)
+				}
+				if int(f) != id {
+					t.Fatalf("id %d read as %.0f", id, f)
+				}
+
+				var buf bytes.Buffer
+				graphql.MarshalIntID(id).MarshalGQL(&buf)
+				var s string
+				err = json.Unmarshal(buf.Bytes(), &s)
+				if err != nil {
+					t.Fatalf("failed to unmarshal GraphQL id %s: %v", buf.String(), err)
+				}
+				gid, err := graphql.UnmarshalIntID(s)
+				if err != nil || gid != id {
+					t.Fatalf("GraphQL id %d read as %d: %v", id, gid, err)
+				}
+			}
+		})
+	}
+}
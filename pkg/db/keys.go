@@ -0,0 +1,204 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrKeyEncoding is returned when records are keyed in another KeyEncoding
+// than that of the database.
+var ErrKeyEncoding = errors.New("records keyed in another encoding")
+
+// idAlphabet is the Crockford base32 alphabet of string IDs, which sorts in
+// the same order as the values of its digits.
+const idAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// idLength is the length of string IDs, 11 digits of 5 bits, enough for
+// every ID up to MaxID and those of bucket sequences below 2^55.
+const idLength = 11
+
+// FormatID returns the string form of the given ID: its 11 Crockford base32
+// digits, such as 000000000ZZ for 1023. String IDs sort in the order of
+// their IDs.
+func FormatID(id int) string {
+	var b [idLength]byte
+	v := uint64(id)
+	for i := idLength - 1; i >= 0; i-- {
+		b[i] = idAlphabet[v&0x1f]
+		v >>= 5
+	}
+	return string(b[:])
+}
+
+// ParseID returns the ID of the given string form, as returned by FormatID,
+// in upper or lower case, or an error wrapping ErrInvalid if it is not one.
+func ParseID(s string) (int, error) {
+	if len(s) != idLength {
+		return 0, fmt.Errorf("string id %q: %w", s, ErrInvalid)
+	}
+	v := uint64(0)
+	for _, r := range strings.ToUpper(s) {
+		d := strings.IndexRune(idAlphabet, r)
+		if d < 0 {
+			return 0, fmt.Errorf("string id %q: %w", s, ErrInvalid)
+		}
+		v = v<<5 | uint64(d)
+	}
+	return int(v), nil
+}
+
+// KeyEncoding defines how the IDs of records are encoded as their keys in
+// buckets. Keys must sort in the order of their IDs, as records are iterated
+// through in key order.
+type KeyEncoding interface {
+	Key(id int) []byte
+	ID(key []byte) (int, error)
+}
+
+// BinaryKeys keys records by their IDs as 8-byte big-endian integers, as
+// databases created before key encodings could be selected are.
+type BinaryKeys struct{}
+
+// Key returns the 8 bytes of the given ID.
+func (BinaryKeys) Key(id int) []byte {
+	return itob(id)
+}
+
+// ID returns the ID of the given key, or an error wrapping ErrInvalid if it
+// is not 8 bytes long.
+func (BinaryKeys) ID(key []byte) (int, error) {
+	if len(key) != 8 {
+		return 0, fmt.Errorf("binary key %x: %w", key, ErrInvalid)
+	}
+	return int(binary.BigEndian.Uint64(key)), nil
+}
+
+// StringKeys keys records by the string forms of their IDs, as returned by
+// FormatID, so that keys are readable in dumps of the database and may be
+// shared with stores keyed by strings.
+type StringKeys struct{}
+
+// Key returns the string form of the given ID.
+func (StringKeys) Key(id int) []byte {
+	return []byte(FormatID(id))
+}
+
+// ID returns the ID of the string form in the given key.
+func (StringKeys) ID(key []byte) (int, error) {
+	return ParseID(string(key))
+}
+
+// KeyEncodingByName returns the KeyEncoding with the given name, either
+// "binary" or "string".
+func KeyEncodingByName(name string) (KeyEncoding, error) {
+	switch name {
+	case "binary":
+		return BinaryKeys{}, nil
+	case "string":
+		return StringKeys{}, nil
+	}
+	return nil, fmt.Errorf("key encoding %q: %w", name, ErrInvalid)
+}
+
+// key returns the key of the record with the given ID in the KeyEncoding of
+// the database.
+func (db *BoltDatabase) key(id int) []byte {
+	return db.keys().Key(id)
+}
+
+// keys returns the KeyEncoding of the database.
+func (db *BoltDatabase) keys() KeyEncoding {
+	if db.Keys == nil {
+		return BinaryKeys{}
+	}
+	return db.Keys
+}
+
+// VerifyKeys returns the names of the buckets of records in the database
+// whose keys are not in its KeyEncoding, which must be re-keyed with Rekey
+// before their records can be read.
+func (db *BoltDatabase) VerifyKeys() ([]string, error) {
+	enc := db.keys()
+	mismatched := []string{}
+	err := db.Bolt.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			if string(name) == ReplicationBucket {
+				return nil
+			}
+			k, _ := b.Cursor().First()
+			if k == nil {
+				return nil
+			}
+			if _, err := enc.ID(k); err != nil {
+				mismatched = append(mismatched, string(name))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify keys: %w", err)
+	}
+	return mismatched, nil
+}
+
+// Rekey rewrites the keys of the records in every bucket of the database
+// that are in the given KeyEncoding into that of the database, in a single
+// transaction, and returns the number of records re-keyed. Records already
+// keyed in the encoding of the database are kept, so that interrupted
+// migrations may be run again, while keys in neither encoding fail it. The
+// sequences of the buckets are kept.
+func (db *BoltDatabase) Rekey(from KeyEncoding) (int, error) {
+	to := db.keys()
+	n := 0
+	err := db.Bolt.Update(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			if string(name) == ReplicationBucket {
+				return nil
+			}
+
+			// Keys are rewritten after iterating through them, as buckets
+			// must not be modified while iterated through
+			type record struct{ old, new, value []byte }
+			records := []record{}
+			err := b.ForEach(func(k, v []byte) error {
+				if _, err := to.ID(k); err == nil {
+					return nil
+				}
+				id, err := from.ID(k)
+				if err != nil {
+					return fmt.Errorf("bucket %q: %w", name, err)
+				}
+				records = append(records, record{
+					old:   append([]byte{}, k...),
+					new:   to.Key(id),
+					value: append([]byte{}, v...),
+				})
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, r := range records {
+				err = b.Delete(r.old)
+				if err != nil {
+					return fmt.Errorf("%s %q: %w", errmsgBucketDelete, name, err)
+				}
+				err = b.Put(r.new, r.value)
+				if err != nil {
+					return fmt.Errorf("%s %q: %w", errmsgBucketPut, name, err)
+				}
+			}
+			n += len(records)
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to re-key records: %w", err)
+	}
+	return n, nil
+}
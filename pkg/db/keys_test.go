@@ -0,0 +1,103 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestFormatID tests that string IDs are parsed back to their IDs in either
+// case and sort in the order of their IDs, and that other strings are not
+// parsed.
+func TestFormatID(t *testing.T) {
+	ids := []int{0, 1, 31, 32, 1023, 1 << 40, MaxID}
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = FormatID(id)
+		for _, s := range []string{strs[i], strings.ToLower(strs[i])} {
+			parsed, err := ParseID(s)
+			if err != nil || parsed != id {
+				t.Errorf("expected %q parsed as %d, got %d: %v", s, id, parsed, err)
+			}
+		}
+	}
+	if FormatID(1023) != "000000000ZZ" {
+		t.Errorf("expected 1023 formatted as 000000000ZZ, got %q", FormatID(1023))
+	}
+	if !sort.StringsAreSorted(strs) {
+		t.Errorf("expected string ids sorted, got %v", strs)
+	}
+
+	for _, s := range []string{"", "1", "000000000ZZ0", "00000000OUI"} {
+		_, err := ParseID(s)
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("expected %q invalid, got %v", s, err)
+		}
+	}
+}
+
+// TestRekey tests that databases keyed in another encoding are reported
+// until re-keyed, and that re-keyed records are read and written by ID.
+func TestRekey(t *testing.T) {
+	dbs, cleanup := newContextDatabase(t, 3)
+	defer cleanup()
+	bdb := dbs.DatabaseDriver.(*BoltDatabase)
+	bdb.Keys = StringKeys{}
+	ser := &cacheService{}
+
+	mismatched, err := bdb.VerifyKeys()
+	if err != nil {
+		t.Fatalf("failed to verify keys: %v", err)
+	}
+	if !reflect.DeepEqual(mismatched, []string{ser.Bucket()}) {
+		t.Fatalf("expected %q keyed in another encoding, got %v", ser.Bucket(), mismatched)
+	}
+
+	_, err = bdb.Rekey(StringKeys{})
+	if !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected binary keys not re-keyed as string keys, got %v", err)
+	}
+	n, err := bdb.Rekey(BinaryKeys{})
+	if err != nil || n != 3 {
+		t.Fatalf("expected 3 records re-keyed, got %d: %v", n, err)
+	}
+	n, err = bdb.Rekey(BinaryKeys{})
+	if err != nil || n != 0 {
+		t.Fatalf("expected no records re-keyed again, got %d: %v", n, err)
+	}
+	mismatched, err = bdb.VerifyKeys()
+	if err != nil || len(mismatched) != 0 {
+		t.Fatalf("expected no buckets keyed in another encoding, got %v: %v", mismatched, err)
+	}
+
+	err = bdb.Transaction(true, func(tx Tx) error {
+		m, err := bdb.GetByID(2, ser, tx)
+		if err != nil {
+			return err
+		}
+		if v := m.(*cacheModel).Value; v != "2" {
+			t.Errorf("expected record 2, got %q", v)
+		}
+
+		id, err := bdb.Create(&cacheModel{Value: "new"}, ser, tx)
+		if err != nil {
+			return err
+		}
+		if id <= 3 {
+			t.Errorf("expected new record to take a free id, got %d", id)
+		}
+		b, err := bdb.Bucket(ser.Bucket(), tx)
+		if err != nil {
+			return err
+		}
+		if v := b.Get([]byte(FormatID(id))); string(v) != "new" {
+			t.Errorf("expected new record keyed by string id, got %q", v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to read and write re-keyed records: %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// LifecycleEvent is an event in the lifecycle of entities that hooks may be
+// registered for.
+type LifecycleEvent int
+
+const (
+	// BeforeCreate is before an entity is first persisted, when it has no ID
+	// yet.
+	BeforeCreate LifecycleEvent = iota
+	// AfterCreate is after an entity is first persisted.
+	AfterCreate
+	// BeforeUpdate is before the changes to an entity are persisted.
+	BeforeUpdate
+	// AfterUpdate is after the changes to an entity are persisted.
+	AfterUpdate
+	// BeforeDelete is before an entity is deleted.
+	BeforeDelete
+	// AfterDelete is after an entity is deleted.
+	AfterDelete
+)
+
+// String returns the name of the event.
+func (e LifecycleEvent) String() string {
+	switch e {
+	case BeforeCreate:
+		return "BeforeCreate"
+	case AfterCreate:
+		return "AfterCreate"
+	case BeforeUpdate:
+		return "BeforeUpdate"
+	case AfterUpdate:
+		return "AfterUpdate"
+	case BeforeDelete:
+		return "BeforeDelete"
+	case AfterDelete:
+		return "AfterDelete"
+	}
+	return fmt.Sprintf("LifecycleEvent(%d)", int(e))
+}
+
+// CommittedHookFunc is a callback called once the transaction an entity was
+// persisted in has been committed.
+type CommittedHookFunc = func(m Model, ser Service)
+
+// AllBuckets registers a lifecycle hook for the entities of every bucket.
+const AllBuckets = ""
+
+// Lifecycle is a registry of hooks called on the lifecycle events of the
+// entities of the services attached to it, by bucket, such as for custom
+// validation, denormalization and integrations with other systems, without
+// changes to the services. Hooks may be registered before or after the
+// services are attached. The zero value is an empty registry ready for use,
+// which is safe for concurrent use.
+type Lifecycle struct {
+	mu    sync.RWMutex
+	hooks map[lifecycleKey][]lifecycleHook
+}
+
+type lifecycleKey struct {
+	bucket string
+	event  LifecycleEvent
+}
+
+type lifecycleHook struct {
+	inTx      PersistHookFunc
+	committed CommittedHookFunc
+}
+
+// Register registers the given hook to be called inside the transaction on
+// the given event of the entities of the given bucket, or of all buckets if
+// AllBuckets. Errors returned by the hook abort the operation and roll the
+// transaction back.
+func (l *Lifecycle) Register(bucket string, e LifecycleEvent, f PersistHookFunc) {
+	l.register(bucket, e, lifecycleHook{inTx: f})
+}
+
+// RegisterCommitted registers the given hook to be called on the given event
+// of the entities of the given bucket, or of all buckets if AllBuckets, once
+// the transaction has been committed. It is not called if the transaction is
+// rolled back.
+func (l *Lifecycle) RegisterCommitted(bucket string, e LifecycleEvent, f CommittedHookFunc) {
+	l.register(bucket, e, lifecycleHook{committed: f})
+}
+
+func (l *Lifecycle) register(bucket string, e LifecycleEvent, h lifecycleHook) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.hooks == nil {
+		l.hooks = map[lifecycleKey][]lifecycleHook{}
+	}
+	key := lifecycleKey{bucket: bucket, event: e}
+	l.hooks[key] = append(l.hooks[key], h)
+}
+
+// Attach adds hooks to the given services that call the hooks registered for
+// their buckets, after the hooks the services already have.
+func (l *Lifecycle) Attach(services ...Service) {
+	for _, ser := range services {
+		hooks := ser.PersistHooks()
+		if hooks == nil {
+			continue
+		}
+		hooks.PreCreateHooks = append(hooks.PreCreateHooks, l.dispatch(BeforeCreate))
+		hooks.PostCreateHooks = append(hooks.PostCreateHooks, l.dispatch(AfterCreate))
+		hooks.PreUpdateHooks = append(hooks.PreUpdateHooks, l.dispatch(BeforeUpdate))
+		hooks.PostUpdateHooks = append(hooks.PostUpdateHooks, l.dispatch(AfterUpdate))
+		hooks.PreDeleteHooks = append(hooks.PreDeleteHooks, l.dispatch(BeforeDelete))
+		hooks.PostDeleteHooks = append(hooks.PostDeleteHooks, l.dispatch(AfterDelete))
+	}
+}
+
+// dispatch returns a hook function that calls the hooks registered for the
+// given event.
+func (l *Lifecycle) dispatch(e LifecycleEvent) PersistHookFunc {
+	return func(m Model, ser Service, tx Tx) error {
+		l.mu.RLock()
+		bucket := l.hooks[lifecycleKey{bucket: ser.Bucket(), event: e}]
+		all := l.hooks[lifecycleKey{bucket: AllBuckets, event: e}]
+		hooks := make([]lifecycleHook, 0, len(bucket)+len(all))
+		hooks = append(append(hooks, bucket...), all...)
+		l.mu.RUnlock()
+
+		for _, h := range hooks {
+			if h.committed != nil {
+				committed := h.committed
+				err := OnCommit(tx, func() { committed(m, ser) })
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			err := h.inTx(m, ser, tx)
+			if err != nil {
+				return fmt.Errorf("%s hook of %s: %w", e, ser.Bucket(), err)
+			}
+		}
+		return nil
+	}
+}
+
+// Committer is implemented by transactions that are committed by other means
+// than their boltDB transaction, and call the functions registered with
+// OnCommit themselves.
+type Committer interface {
+	OnCommit(f func())
+}
+
+// OnCommit registers the given function to be called once the given
+// writable transaction has been committed. It is not called if the
+// transaction is rolled back.
+func OnCommit(tx Tx, f func()) error {
+	if c, ok := innerTx(tx).(Committer); ok {
+		c.OnCommit(f)
+		return nil
+	}
+	btx, ok := tx.Unwrap().(*bolt.Tx)
+	if !ok {
+		return errors.New("transaction does not support commit hooks")
+	}
+	btx.OnCommit(f)
+	return nil
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// ScanWorkers is the number of goroutines GetFilterParallel unmarshals and
+// filters records with; scans are serial if it is less than 2.
+var ScanWorkers = runtime.NumCPU()
+
+// parallelScanMin is the number of records of the smallest bucket scanned in
+// parallel; smaller ones are scanned serially, as starting the workers would
+// take longer.
+const parallelScanMin = 4 * scanBatch
+
+// GetFilterParallel retrieves all persisted instances of a Model type that
+// pass the filter, as GetFilter, but partitions the records of large buckets
+// in key order across ScanWorkers goroutines that unmarshal and filter them
+// concurrently, merging the results in key order. It suits analytical scans
+// of whole buckets, such as the recomputation of statistics.
+//
+// The filter function is called concurrently, and must neither use the
+// transaction nor modify shared state without synchronization.
+func (dbs *DatabaseService) GetFilterParallel(first *int, skip *int, ser Service, tx Tx,
+	keep func(m Model) bool) ([]Model, error) {
+	err := CheckService(ser)
+	if err != nil {
+		return nil, err
+	}
+
+	vlist, err := dbs.GetRawAll(ser, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	workers := ScanWorkers
+	if workers > len(vlist)/scanBatch {
+		workers = len(vlist) / scanBatch
+	}
+	if workers < 2 || len(vlist) < parallelScanMin {
+		list := []Model{}
+		i := 0
+		next := func() ([]byte, bool) {
+			if i >= len(vlist) {
+				return nil, false
+			}
+			i++
+			return vlist[i-1], true
+		}
+		err = doEach(first, skip, ser, tx, next, func(m Model, _ Service, _ Tx) (bool, error) {
+			list = append(list, m)
+			return false, nil
+		}, keep)
+		if err != nil {
+			return nil, err
+		}
+		return list, nil
+	}
+
+	// Each worker scans a contiguous part of the key space, so that the
+	// results are in key order once concatenated
+	parts := make([][]Model, workers)
+	errs := make([]error, workers)
+	size := (len(vlist) + workers - 1) / workers
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		lo, hi := w*size, (w+1)*size
+		if hi > len(vlist) {
+			hi = len(vlist)
+		}
+		wg.Add(1)
+		go func(w int, part [][]byte) {
+			defer wg.Done()
+			parts[w], errs[w] = scanPart(part, ser, tx, keep)
+		}(w, vlist[lo:hi])
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	start, end := calculatePaginationBounds(first, skip)
+	list := []Model{}
+	i := 0
+	for _, part := range parts {
+		for _, m := range part {
+			if end >= 0 && i >= end {
+				return list, nil
+			}
+			if i >= start {
+				list = append(list, m)
+			}
+			i++
+		}
+	}
+	return list, nil
+}
+
+// scanPart unmarshals the given raw elements and returns those that pass the
+// filter function, in order.
+func scanPart(part [][]byte, ser Service, tx Tx, keep func(Model) bool) ([]Model, error) {
+	list := []Model{}
+	for n, v := range part {
+		err := checkScan(n, ser, tx)
+		if err != nil {
+			return nil, err
+		}
+
+		m, err := ser.Unmarshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", errmsgModelUnmarshal, err)
+		}
+		if keep == nil || keep(m) {
+			list = append(list, m)
+		}
+	}
+	return list, nil
+}
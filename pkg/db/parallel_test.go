@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestGetFilterParallel tests that parallel scans return the same elements
+// in the same order as serial ones, for large and small buckets alike, and
+// stop once the context of the transaction is cancelled.
+func TestGetFilterParallel(t *testing.T) {
+	defer func(workers int) { ScanWorkers = workers }(ScanWorkers)
+	ScanWorkers = 3
+
+	ids := func(list []Model) []int {
+		res := []int{}
+		for _, m := range list {
+			res = append(res, m.Metadata().ID)
+		}
+		return res
+	}
+	intp := func(n int) *int {
+		return &n
+	}
+	even := func(m Model) bool {
+		return m.Metadata().ID%2 == 0
+	}
+
+	for _, count := range []int{10 * scanBatch, 10} {
+		dbs, cleanup := newContextDatabase(t, count)
+		ser := &contextService{}
+		cases := []struct {
+			first, skip *int
+			keep        func(Model) bool
+		}{
+			{nil, nil, nil},
+			{nil, nil, even},
+			{intp(5), intp(3), even},
+			{intp(0), nil, nil},
+			{nil, intp(count - 2), nil},
+		}
+		err := dbs.Transaction(false, func(tx Tx) error {
+			for i, c := range cases {
+				expected, err := dbs.GetFilter(c.first, c.skip, ser, tx, c.keep)
+				if err != nil {
+					return err
+				}
+				got, err := dbs.GetFilterParallel(c.first, c.skip, ser, tx, c.keep)
+				if err != nil {
+					return err
+				}
+				if !reflect.DeepEqual(ids(got), ids(expected)) {
+					t.Errorf("case %d of %d records: expected %v, got %v",
+						i, count, ids(expected), ids(got))
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Errorf("failed to scan %d records: %v", count, err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		err = dbs.TransactionContext(ctx, false, func(tx Tx) error {
+			cancel()
+			_, err := dbs.GetFilterParallel(nil, nil, ser, tx, nil)
+			return err
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected scan of %d records to stop with context.Canceled, got %v",
+				count, err)
+		}
+		cleanup()
+	}
+}
@@ -0,0 +1,31 @@
+package db
+
+import "io"
+
+// Progress receives reports of the progress of a long-running operation, such
+// as a backup.
+type Progress interface {
+	// SetTotal sets the total number of units of work of the operation.
+	SetTotal(n int64)
+	// Advance adds the given number of units to those done.
+	Advance(n int64)
+	// Finish marks the operation as done, failed if err is not nil.
+	Finish(err error)
+}
+
+// ProgressWriter returns a writer that writes to the given writer and reports
+// the bytes written to the given Progress.
+func ProgressWriter(w io.Writer, p Progress) io.Writer {
+	return &progressWriter{w: w, p: p}
+}
+
+type progressWriter struct {
+	w io.Writer
+	p Progress
+}
+
+func (pw *progressWriter) Write(b []byte) (int, error) {
+	n, err := pw.w.Write(b)
+	pw.p.Advance(int64(n))
+	return n, err
+}
@@ -0,0 +1,308 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	json "github.com/json-iterator/go"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ReplicationBucket is the name of the bucket the replication log is kept in.
+// Its sequence is the number of the last write recorded in, or applied to,
+// the database.
+const ReplicationBucket = "ReplicationLog"
+
+// ReplicationEntry is a write recorded in the replication log: the raw value
+// stored under an ID in a bucket, or its deletion.
+type ReplicationEntry struct {
+	Seq    uint64 `json:"seq"`
+	Bucket string `json:"bucket"`
+	ID     int    `json:"id"`
+	// Value is the record as stored in the bucket, encoded by its codec;
+	// nil if Deleted.
+	Value   []byte `json:"value,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// ReplicationDriver is implemented by DatabaseDrivers that can read and apply
+// the replication log.
+type ReplicationDriver interface {
+	// ReplicationLog returns at most limit entries of the log after the
+	// given sequence number, oldest first.
+	ReplicationLog(after uint64, limit int) ([]ReplicationEntry, error)
+	// ApplyReplication applies the given consecutive entries, following the
+	// last applied, in a single transaction.
+	ApplyReplication(entries []ReplicationEntry) error
+	// ReplicationPosition returns the sequence number of the last entry
+	// recorded or applied.
+	ReplicationPosition() (uint64, error)
+}
+
+// ErrReplicationGap is an error returned when entries of the replication log
+// are missing between those applied and those given, such as once they are
+// trimmed from the log. The follower must be restored from a new backup.
+var ErrReplicationGap = errors.New("replication log entries missing")
+
+// RecordReplication registers hooks with the given lifecycle that append the
+// writes to every bucket to the replication log of the database, in the same
+// transaction. The log keeps at most retain entries, or all if retain is 0.
+func RecordReplication(l *Lifecycle, retain int) {
+	record := func(deleted bool) PersistHookFunc {
+		return func(m Model, ser Service, tx Tx) error {
+			e := ReplicationEntry{
+				Bucket:  ser.Bucket(),
+				ID:      m.Metadata().ID,
+				Deleted: deleted,
+			}
+			if !deleted {
+				v, err := ser.Marshal(m)
+				if err != nil {
+					return fmt.Errorf("%s: %w", errmsgModelMarshal, err)
+				}
+				e.Value = v
+			}
+			return appendReplication(tx, e, retain)
+		}
+	}
+	l.Register(AllBuckets, AfterCreate, record(false))
+	l.Register(AllBuckets, AfterUpdate, record(false))
+	l.Register(AllBuckets, AfterDelete, record(true))
+}
+
+// appendReplication appends the given entry to the replication log, trimming
+// the entry that falls out of the retained ones.
+func appendReplication(tx Tx, e ReplicationEntry, retain int) error {
+	btx, ok := tx.Unwrap().(*bolt.Tx)
+	if !ok {
+		return errors.New("transaction does not support replication")
+	}
+	b, err := btx.CreateBucketIfNotExists([]byte(ReplicationBucket))
+	if err != nil {
+		return fmt.Errorf("%s %q: %w", errmsgBucketOpen, ReplicationBucket, err)
+	}
+
+	e.Seq, err = b.NextSequence()
+	if err != nil {
+		return fmt.Errorf("failed to number replication entry: %w", err)
+	}
+	buf, err := json.Marshal(&e)
+	if err != nil {
+		return fmt.Errorf("failed to encode replication entry: %w", err)
+	}
+	err = b.Put(itob(int(e.Seq)), buf)
+	if err != nil {
+		return fmt.Errorf("%s %q: %w", errmsgBucketPut, ReplicationBucket, err)
+	}
+
+	if retain > 0 && e.Seq > uint64(retain) {
+		err = b.Delete(itob(int(e.Seq) - retain))
+		if err != nil {
+			return fmt.Errorf("failed to trim replication log: %w", err)
+		}
+	}
+	return nil
+}
+
+// ReplicationLog returns at most limit entries of the replication log after
+// the given sequence number, oldest first.
+func (dbs *DatabaseService) ReplicationLog(after uint64, limit int) ([]ReplicationEntry, error) {
+	rd, ok := dbs.DatabaseDriver.(ReplicationDriver)
+	if !ok {
+		return nil, errors.New("database driver does not support replication")
+	}
+	return rd.ReplicationLog(after, limit)
+}
+
+// ApplyReplication applies the given consecutive entries of the replication
+// log of another database, following the last applied.
+func (dbs *DatabaseService) ApplyReplication(entries []ReplicationEntry) error {
+	rd, ok := dbs.DatabaseDriver.(ReplicationDriver)
+	if !ok {
+		return errors.New("database driver does not support replication")
+	}
+	return rd.ApplyReplication(entries)
+}
+
+// ReplicationPosition returns the sequence number of the last entry of the
+// replication log recorded in, or applied to, the database.
+func (dbs *DatabaseService) ReplicationPosition() (uint64, error) {
+	rd, ok := dbs.DatabaseDriver.(ReplicationDriver)
+	if !ok {
+		return 0, errors.New("database driver does not support replication")
+	}
+	return rd.ReplicationPosition()
+}
+
+// ReplicationLog returns at most limit entries of the replication log after
+// the given sequence number, oldest first.
+func (db *BoltDatabase) ReplicationLog(after uint64, limit int) ([]ReplicationEntry, error) {
+	var entries []ReplicationEntry
+	err := db.Bolt.View(func(tx *bolt.Tx) error {
+		var err error
+		entries, err = readReplication(tx, after, limit)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// TxReplicationLog returns the entries of the replication log after the given
+// sequence number as of the given transaction, such as those recorded in it.
+func TxReplicationLog(tx Tx, after uint64) ([]ReplicationEntry, error) {
+	btx, ok := tx.Unwrap().(*bolt.Tx)
+	if !ok {
+		return nil, errors.New("transaction does not support replication")
+	}
+	return readReplication(btx, after, 0)
+}
+
+// TxReplicationPosition returns the sequence number of the last entry of the
+// replication log as of the given transaction.
+func TxReplicationPosition(tx Tx) (uint64, error) {
+	btx, ok := tx.Unwrap().(*bolt.Tx)
+	if !ok {
+		return 0, errors.New("transaction does not support replication")
+	}
+	b := btx.Bucket([]byte(ReplicationBucket))
+	if b == nil {
+		return 0, nil
+	}
+	return b.Sequence(), nil
+}
+
+// readReplication returns at most limit entries of the replication log after
+// the given sequence number, or all of them if limit is 0.
+func readReplication(tx *bolt.Tx, after uint64, limit int) ([]ReplicationEntry, error) {
+	entries := []ReplicationEntry{}
+	b := tx.Bucket([]byte(ReplicationBucket))
+	if b == nil {
+		return entries, nil
+	}
+
+	c := b.Cursor()
+	for k, v := c.Seek(itob(int(after) + 1)); k != nil; k, v = c.Next() {
+		if limit > 0 && len(entries) >= limit {
+			break
+		}
+		var e ReplicationEntry
+		err := json.Unmarshal(v, &e)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode replication entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// ApplyReplication writes the given consecutive entries, following the last
+// applied, to their buckets in a single transaction and advances the
+// position to the last of them. The sequences of the buckets are advanced to
+// the IDs written, as if the records were created in the database. Entries
+// are not recorded in the log of the database.
+func (db *BoltDatabase) ApplyReplication(entries []ReplicationEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return db.Bolt.Update(func(tx *bolt.Tx) error {
+		log, err := tx.CreateBucketIfNotExists([]byte(ReplicationBucket))
+		if err != nil {
+			return fmt.Errorf("%s %q: %w", errmsgBucketOpen, ReplicationBucket, err)
+		}
+
+		pos := log.Sequence()
+		for _, e := range entries {
+			if e.Seq != pos+1 {
+				return fmt.Errorf("entry %d after %d: %w", e.Seq, pos, ErrReplicationGap)
+			}
+			pos = e.Seq
+
+			b, err := tx.CreateBucketIfNotExists([]byte(e.Bucket))
+			if err != nil {
+				return fmt.Errorf("%s %q: %w", errmsgBucketOpen, e.Bucket, err)
+			}
+			if e.Deleted {
+				err = b.Delete(db.key(e.ID))
+			} else {
+				err = b.Put(db.key(e.ID), e.Value)
+				if err == nil && uint64(e.ID) > b.Sequence() {
+					err = b.SetSequence(uint64(e.ID))
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("failed to apply replication entry %d: %w", e.Seq, err)
+			}
+		}
+
+		err = log.SetSequence(pos)
+		if err != nil {
+			return fmt.Errorf("failed to advance replication position: %w", err)
+		}
+		return nil
+	})
+}
+
+// ReplicationPosition returns the sequence number of the last entry of the
+// replication log recorded in, or applied to, the database.
+func (db *BoltDatabase) ReplicationPosition() (uint64, error) {
+	var pos uint64
+	err := db.Bolt.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(ReplicationBucket))
+		if b != nil {
+			pos = b.Sequence()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return pos, nil
+}
+
+// ReplicationLog returns at most limit entries of the replication log of the
+// underlying database after the given sequence number.
+func (cdb *CachedDatabase) ReplicationLog(after uint64, limit int) ([]ReplicationEntry, error) {
+	rd, ok := cdb.Driver.(ReplicationDriver)
+	if !ok {
+		return nil, errors.New("database driver does not support replication")
+	}
+	return rd.ReplicationLog(after, limit)
+}
+
+// ApplyReplication applies the given entries to the underlying database and
+// invalidates the cached records they write, with their buckets marked as
+// written to while they are applied.
+func (cdb *CachedDatabase) ApplyReplication(entries []ReplicationEntry) error {
+	rd, ok := cdb.Driver.(ReplicationDriver)
+	if !ok {
+		return errors.New("database driver does not support replication")
+	}
+
+	touched := map[cacheKey]bool{}
+	writing := map[string]bool{}
+	cdb.mu.Lock()
+	for _, e := range entries {
+		touched[recordKey(e.Bucket, e.ID)] = true
+		touched[allKey(e.Bucket)] = true
+		if !writing[e.Bucket] {
+			writing[e.Bucket] = true
+			cdb.writing[e.Bucket]++
+		}
+	}
+	cdb.mu.Unlock()
+
+	defer cdb.commit(touched, writing)
+	return rd.ApplyReplication(entries)
+}
+
+// ReplicationPosition returns the position of the underlying database in the
+// replication log.
+func (cdb *CachedDatabase) ReplicationPosition() (uint64, error) {
+	rd, ok := cdb.Driver.(ReplicationDriver)
+	if !ok {
+		return 0, errors.New("database driver does not support replication")
+	}
+	return rd.ReplicationPosition()
+}
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"math/rand"
+)
+
+// Sample returns up to n persisted instances of a Model type that pass the
+// filter, chosen uniformly at random by reservoir sampling in a single pass
+// over the bucket. A nil filter passes all, and a nil rnd uses the default
+// source of math/rand.
+func (dbs *DatabaseService) Sample(
+	n int, ser Service, tx Tx, keep func(m Model) bool, rnd *rand.Rand,
+) ([]Model, error) {
+	if n <= 0 {
+		return []Model{}, nil
+	}
+	intn := rand.Intn
+	if rnd != nil {
+		intn = rnd.Intn
+	}
+
+	list := make([]Model, 0, n)
+	seen := 0
+	sample := func(m Model, _ Service, _ Tx) (exit bool, err error) {
+		seen++
+		if len(list) < n {
+			list = append(list, m)
+			return false, nil
+		}
+		if i := intn(seen); i < n {
+			list[i] = m
+		}
+		return false, nil
+	}
+	err := dbs.DoEach(nil, nil, ser, tx, sample, keep)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Stats are statistics of the storage of a database.
+type Stats struct {
+	// FileSize is the size in bytes of the database file.
+	FileSize int64
+	// FreePages is the number of pages free for reuse, and PendingPages the
+	// number of pages freed that are still in use by open transactions.
+	FreePages    int
+	PendingPages int
+	// FreeBytes is the number of bytes of the free pages.
+	FreeBytes int
+	// Records is the number of records in each bucket, by bucket name.
+	Records map[string]int
+}
+
+// StatsDriver is implemented by DatabaseDrivers that can report statistics
+// of their storage.
+type StatsDriver interface {
+	Stats() (*Stats, error)
+}
+
+// Stats returns statistics of the storage of the database.
+func (dbs *DatabaseService) Stats() (*Stats, error) {
+	sd, ok := dbs.DatabaseDriver.(StatsDriver)
+	if !ok {
+		return nil, errors.New("database driver does not support statistics")
+	}
+	return sd.Stats()
+}
+
+// Stats returns statistics of the storage of the database as of a new
+// read-only transaction.
+func (db *BoltDatabase) Stats() (*Stats, error) {
+	info, err := os.Stat(db.Bolt.Path())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read database file size: %w", err)
+	}
+
+	bs := db.Bolt.Stats()
+	stats := Stats{
+		FileSize:     info.Size(),
+		FreePages:    bs.FreePageN,
+		PendingPages: bs.PendingPageN,
+		FreeBytes:    bs.FreeAlloc,
+		Records:      map[string]int{},
+	}
+	err = db.Bolt.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			stats.Records[string(name)] = b.Stats().KeyN
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bucket statistics: %w", err)
+	}
+	return &stats, nil
+}
+
+// Stats returns statistics of the storage of the underlying database.
+func (cdb *CachedDatabase) Stats() (*Stats, error) {
+	sd, ok := cdb.Driver.(StatsDriver)
+	if !ok {
+		return nil, errors.New("database driver does not support statistics")
+	}
+	return sd.Stats()
+}
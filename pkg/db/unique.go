@@ -0,0 +1,80 @@
+package db
+
+import (
+	"fmt"
+)
+
+// UniqueService is implemented by Services whose Models must be unique by a
+// composite key of their properties, such as the IDs of the entities paired
+// by a relation. The key is enforced on create and update.
+type UniqueService interface {
+	Service
+	// UniqueKey returns the composite key of the given cleaned Model.
+	UniqueKey(m Model) (string, error)
+}
+
+// checkUnique returns an error wrapping ErrConflict if the key of the given
+// Model is held by another persisted instance of its type, if the Service is
+// a UniqueService. The bucket is scanned, as no separate index is kept.
+func (dbs *DatabaseService) checkUnique(m Model, ser Service, tx Tx) error {
+	user, ok := ser.(UniqueService)
+	if !ok {
+		return nil
+	}
+
+	key, err := user.UniqueKey(m)
+	if err != nil {
+		return fmt.Errorf("failed to get unique key: %w", err)
+	}
+
+	id := m.Metadata().ID
+	same, err := dbs.DatabaseDriver.FindFirst(ser, tx, func(o Model) (exit bool, err error) {
+		if o.Metadata().ID == id {
+			return false, nil
+		}
+		okey, err := user.UniqueKey(o)
+		if err != nil {
+			return true, fmt.Errorf("failed to get unique key: %w", err)
+		}
+		return okey == key, nil
+	})
+	if err != nil {
+		return err
+	}
+	if same != nil {
+		return fmt.Errorf("%s %q: held by ID %d: %w",
+			ser.Bucket(), key, same.Metadata().ID, ErrConflict)
+	}
+	return nil
+}
+
+// Dedupe deletes the persisted instances of a Model type whose unique keys
+// are held by instances of lower ID, keeping the oldest of each key, and
+// returns the IDs of the deleted instances in order.
+func (dbs *DatabaseService) Dedupe(ser UniqueService, tx Tx) ([]int, error) {
+	seen := map[string]bool{}
+	ids := []int{}
+	find := func(m Model, _ Service, _ Tx) (exit bool, err error) {
+		key, err := ser.UniqueKey(m)
+		if err != nil {
+			return true, fmt.Errorf("failed to get unique key: %w", err)
+		}
+		if seen[key] {
+			ids = append(ids, m.Metadata().ID)
+		}
+		seen[key] = true
+		return false, nil
+	}
+	err := dbs.DoEach(nil, nil, ser, tx, find, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		err = dbs.Delete(id, ser, tx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete by id %d: %w", id, err)
+		}
+	}
+	return ids, nil
+}
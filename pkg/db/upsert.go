@@ -0,0 +1,59 @@
+package db
+
+import (
+	"fmt"
+)
+
+// KeyedService is implemented by Services whose Models may be matched by
+// named keys of their properties, such as their IDs in external databases, so
+// that they may be upserted.
+type KeyedService interface {
+	Service
+	// Key returns the value of the key of the given name of the given Model,
+	// or an error wrapping ErrInvalid if the Service has no such key. Models
+	// with empty values match no other.
+	Key(name string, m Model) (string, error)
+}
+
+// Upsert updates the persisted instance of a Model type whose key of the
+// given name has the value of that of the given Model, or creates the Model
+// if there is none. It returns the ID of the Model and true if it was created.
+// The bucket is scanned, as no separate index is kept.
+func (dbs *DatabaseService) Upsert(
+	m Model, ser KeyedService, key string, tx Tx,
+) (int, bool, error) {
+	value, err := ser.Key(key, m)
+	if err != nil {
+		return 0, false, err
+	}
+	if value == "" {
+		return 0, false, fmt.Errorf("key %q is empty: %w", key, ErrInvalid)
+	}
+
+	same, err := dbs.DatabaseDriver.FindFirst(ser, tx, func(o Model) (exit bool, err error) {
+		ovalue, err := ser.Key(key, o)
+		if err != nil {
+			return true, fmt.Errorf("failed to get key %q: %w", key, err)
+		}
+		return ovalue == value, nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	if same == nil {
+		id, err := dbs.Create(m, ser, tx)
+		if err != nil {
+			return 0, false, err
+		}
+		return id, true, nil
+	}
+
+	meta := m.Metadata()
+	meta.ID = same.Metadata().ID
+	meta.Version = same.Metadata().Version
+	err = dbs.Update(m, ser, tx)
+	if err != nil {
+		return 0, false, err
+	}
+	return meta.ID, false, nil
+}
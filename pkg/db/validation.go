@@ -0,0 +1,75 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Field error codes identify the kind of problem with a property of a Model.
+const (
+	// FieldRequired is the code of a property that must be set but is not.
+	FieldRequired = "REQUIRED"
+	// FieldInvalid is the code of a property whose value is not allowed.
+	FieldInvalid = "INVALID"
+	// FieldOutOfRange is the code of a property whose value is outside of its
+	// bounds, or out of order with another property.
+	FieldOutOfRange = "OUT_OF_RANGE"
+)
+
+// FieldError is a problem with a single property of a Model. The path names
+// the property as in the encoded Model, with indices of lists in brackets,
+// such as "Sections[1].ID".
+type FieldError struct {
+	Path    string `json:"path"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects the problems with the properties of a Model found
+// by validation. It wraps ErrInvalid.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Add records a problem with the property at the given path.
+func (e *ValidationError) Add(path, code, message string) {
+	e.Fields = append(e.Fields, FieldError{Path: path, Code: code, Message: message})
+}
+
+// Addf records a problem with the property at the given path, with the
+// message formatted by fmt.Sprintf.
+func (e *ValidationError) Addf(path, code, format string, a ...interface{}) {
+	e.Add(path, code, fmt.Sprintf(format, a...))
+}
+
+// Err returns the ValidationError if any problems were recorded, or nil.
+func (e *ValidationError) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = fmt.Sprintf("%s: %s", f.Path, f.Message)
+	}
+	return fmt.Sprintf("%s: %s", strings.Join(msgs, "; "), ErrInvalid)
+}
+
+// Unwrap returns ErrInvalid, so that ValidationErrors are reported as invalid
+// values.
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalid
+}
+
+// FieldPath returns the path of the given property of the element at the
+// given index of the list at the given path.
+func FieldPath(list string, i int, prop string) string {
+	p := fmt.Sprintf("%s[%d]", list, i)
+	if prop != "" {
+		p += "." + prop
+	}
+	return p
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// Activity represents a single event in the feed of a User, such as
+// completing a Media.
+type Activity struct {
+	UserID      int
+	Kind        ActivityKind
+	MediaID     int
+	UserMediaID int
+	// Score is the score given in ActivityKindScored events.
+	Score *int
+	// UserMediaListID is the list added to in ActivityKindAddedToList events.
+	UserMediaListID *int
+	Meta            db.ModelMetadata
+}
+
+// Metadata returns Meta.
+func (a *Activity) Metadata() *db.ModelMetadata {
+	return &a.Meta
+}
+
+// ActivityKind is an enum that describes the kind of event recorded in an
+// Activity.
+type ActivityKind int
+
+const (
+	// ActivityKindCompleted means the User completed the Media.
+	ActivityKindCompleted ActivityKind = iota
+	// ActivityKindScored means the User gave the Media a new score.
+	ActivityKindScored
+	// ActivityKindAddedToList means the User added the Media to one of their
+	// UserMediaLists.
+	ActivityKindAddedToList
+)
+
+// IsValid checks if the ActivityKind has a value that is a valid one.
+func (k ActivityKind) IsValid() bool {
+	switch k {
+	case ActivityKindCompleted, ActivityKindScored, ActivityKindAddedToList:
+		return true
+	}
+	return false
+}
+
+// String returns the written name of the ActivityKind.
+func (k ActivityKind) String() string {
+	switch k {
+	case ActivityKindCompleted:
+		return "Completed"
+	case ActivityKindScored:
+		return "Scored"
+	case ActivityKindAddedToList:
+		return "AddedToList"
+	}
+	return fmt.Sprintf("%d", int(k))
+}
+
+// UnmarshalJSON defines custom JSON deserialization for ActivityKind.
+func (k *ActivityKind) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+
+	value, ok := map[string]ActivityKind{
+		"Completed":   ActivityKindCompleted,
+		"Scored":      ActivityKindScored,
+		"AddedToList": ActivityKindAddedToList,
+	}[s]
+	if !ok {
+		return fmt.Errorf("invalid value: %q", s)
+	}
+	*k = value
+	return nil
+}
+
+// MarshalJSON defines custom JSON serialization for ActivityKind.
+func (k ActivityKind) MarshalJSON() ([]byte, error) {
+	if !k.IsValid() {
+		return nil, fmt.Errorf("invalid value: %d", k)
+	}
+
+	v, err := json.Marshal(k.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return v, nil
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// EpisodeAiring indexes a dated Episode of a Media by the date it airs.
+type EpisodeAiring struct {
+	MediaID   int
+	EpisodeID int
+	// Number is the position of the Episode among the regular Episodes of the
+	// Media, from 1, or 0 for special Episodes.
+	Number int
+	Date   time.Time
+	Meta   db.ModelMetadata
+}
+
+// Metadata returns Meta.
+func (a *EpisodeAiring) Metadata() *db.ModelMetadata {
+	return &a.Meta
+}
+
+// NextEpisode is the next Episode of a Media to air.
+type NextEpisode struct {
+	Media   *Media
+	Episode *Episode
+	// Number is the position of the Episode among the regular Episodes of the
+	// Media, from 1, or 0 for special Episodes.
+	Number int
+	AirsAt time.Time
+	// TimeUntilAiring is the number of whole seconds until the Episode airs.
+	TimeUntilAiring int64
+}
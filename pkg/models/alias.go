@@ -0,0 +1,118 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// MediaAlias is an alternative title of a single Media, such as a synonym or
+// an abbreviation, that the Media is searched and matched by but not shown
+// with among its Titles.
+type MediaAlias struct {
+	MediaID  int
+	Title    string `validate:"required,max=255" clean:"line"`
+	Language string `validate:"lang"`
+	Type     MediaAliasType
+	Meta     db.ModelMetadata
+}
+
+// Metadata returns Meta.
+func (a *MediaAlias) Metadata() *db.ModelMetadata {
+	return &a.Meta
+}
+
+// MediaAliasType is an enum that describes the kind of a MediaAlias.
+type MediaAliasType int
+
+const (
+	// MediaAliasTypeSynonym means the alias is another name of the Media.
+	MediaAliasTypeSynonym MediaAliasType = iota
+	// MediaAliasTypeAbbreviation means the alias is a shortening of a title
+	// of the Media, such as an acronym.
+	MediaAliasTypeAbbreviation
+)
+
+// IsValid checks if the MediaAliasType has a value that is a valid one.
+func (t MediaAliasType) IsValid() bool {
+	switch t {
+	case MediaAliasTypeSynonym, MediaAliasTypeAbbreviation:
+		return true
+	}
+	return false
+}
+
+// String returns the written name of the MediaAliasType.
+func (t MediaAliasType) String() string {
+	switch t {
+	case MediaAliasTypeSynonym:
+		return "Synonym"
+	case MediaAliasTypeAbbreviation:
+		return "Abbreviation"
+	}
+	return fmt.Sprintf("%d", int(t))
+}
+
+// ParseMediaAliasType returns the MediaAliasType with the given written name.
+func ParseMediaAliasType(name string) (MediaAliasType, error) {
+	value, ok := map[string]MediaAliasType{
+		"Synonym":      MediaAliasTypeSynonym,
+		"Abbreviation": MediaAliasTypeAbbreviation,
+	}[name]
+	if !ok {
+		return MediaAliasTypeSynonym, fmt.Errorf("invalid value: %q", name)
+	}
+	return value, nil
+}
+
+// UnmarshalJSON defines custom JSON deserialization for MediaAliasType.
+func (t *MediaAliasType) UnmarshalJSON(data []byte) error {
+	var name string
+	err := json.Unmarshal(data, &name)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+
+	value, err := ParseMediaAliasType(name)
+	if err != nil {
+		return err
+	}
+	*t = value
+	return nil
+}
+
+// MarshalJSON defines custom JSON serialization for MediaAliasType.
+func (t MediaAliasType) MarshalJSON() ([]byte, error) {
+	if !t.IsValid() {
+		return nil, fmt.Errorf("invalid value: %d", t)
+	}
+
+	v, err := json.Marshal(t.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return v, nil
+}
+
+// UnmarshalGQL casts the type of the given value to a MediaAliasType.
+func (t *MediaAliasType) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("invalid value: %v", v)
+	}
+
+	value, err := ParseMediaAliasType(str)
+	if err != nil {
+		return err
+	}
+	*t = value
+	return nil
+}
+
+// MarshalGQL serializes the MediaAliasType into a GraphQL readable form.
+func (t MediaAliasType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(t.String()))
+}
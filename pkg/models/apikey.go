@@ -0,0 +1,107 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// APIKeyScope is an enum that describes what an API key may be used for. Each
+// APIKeyScope includes all the access of the scopes before it.
+type APIKeyScope int
+
+const (
+	// APIKeyScopeRead allows reading what the User may read.
+	APIKeyScopeRead APIKeyScope = iota
+	// APIKeyScopeWrite also allows modifying the data of the User.
+	APIKeyScopeWrite
+	// APIKeyScopeAdmin also allows using the global permissions of the User,
+	// as with tokens from logins.
+	APIKeyScopeAdmin
+)
+
+// IsValid checks if the APIKeyScope has a value that is a valid one.
+func (s APIKeyScope) IsValid() bool {
+	switch s {
+	case APIKeyScopeRead, APIKeyScopeWrite, APIKeyScopeAdmin:
+		return true
+	}
+	return false
+}
+
+// String returns the written name of the APIKeyScope.
+func (s APIKeyScope) String() string {
+	switch s {
+	case APIKeyScopeRead:
+		return "Read"
+	case APIKeyScopeWrite:
+		return "Write"
+	case APIKeyScopeAdmin:
+		return "Admin"
+	}
+	return fmt.Sprintf("%d", int(s))
+}
+
+// Includes returns true if the APIKeyScope has at least the access of the
+// given APIKeyScope.
+func (s APIKeyScope) Includes(o APIKeyScope) bool {
+	return s >= o
+}
+
+// Permissions returns the given permissions of a User as limited by the
+// APIKeyScope.
+func (s APIKeyScope) Permissions(p UserPermission) UserPermission {
+	if s.Includes(APIKeyScopeAdmin) {
+		return p
+	}
+	return UserPermission{}
+}
+
+// UnmarshalJSON defines custom JSON deserialization for APIKeyScope.
+func (s *APIKeyScope) UnmarshalJSON(data []byte) error {
+	var str string
+	err := json.Unmarshal(data, &str)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+
+	value, ok := map[string]APIKeyScope{
+		"Read":  APIKeyScopeRead,
+		"Write": APIKeyScopeWrite,
+		"Admin": APIKeyScopeAdmin,
+	}[str]
+	if !ok {
+		return fmt.Errorf("invalid value: %q", str)
+	}
+	*s = value
+	return nil
+}
+
+// MarshalJSON defines custom JSON serialization for APIKeyScope.
+func (s APIKeyScope) MarshalJSON() ([]byte, error) {
+	if !s.IsValid() {
+		return nil, fmt.Errorf("invalid value: %d", s)
+	}
+	return json.Marshal(s.String())
+}
+
+// APIKey is a long-lived credential of a User for programmatic access. Only
+// the hash of the key is kept.
+type APIKey struct {
+	UserID int
+	// Name describes what the key is used for.
+	Name  string `validate:"max=255" clean:"line"`
+	Scope APIKeyScope
+	// Prefix is the start of the key, by which Users recognize it.
+	Prefix   string
+	Hash     []byte
+	LastUsed *time.Time
+	Meta     db.ModelMetadata
+}
+
+// Metadata returns Meta.
+func (k *APIKey) Metadata() *db.ModelMetadata {
+	return &k.Meta
+}
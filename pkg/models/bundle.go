@@ -0,0 +1,33 @@
+package models
+
+// MediaBundle is a Media along with its Episodes, Genres, Characters, staff
+// and relations, for sharing entries between instances. The entities refer to
+// each other by their IDs in the exporting instance, which are remapped on
+// import.
+type MediaBundle struct {
+	Media           *Media
+	Episodes        []*Episode
+	EpisodeSets     []*EpisodeSet
+	Genres          []*Genre
+	MediaGenres     []*MediaGenre
+	Characters      []*Character
+	People          []*Person
+	MediaCharacters []*MediaCharacter
+	MediaStaff      []*MediaStaff
+	MediaRelations  []*MediaRelation
+	// RelatedMedia are the other Media of the MediaRelations, which are
+	// matched on import with those of the importing instance by their
+	// ExternalIDs.
+	RelatedMedia []*Media
+}
+
+// MediaBundleImport is the result of the import of a MediaBundle.
+type MediaBundleImport struct {
+	MediaID int
+	// IDs maps the buckets of the imported entities to the new IDs of the
+	// entities by their IDs in the MediaBundle.
+	IDs map[string]map[int]int
+	// SkippedRelations are the MediaRelations of the MediaBundle whose related
+	// Media are not in the importing instance, which are not imported.
+	SkippedRelations []*MediaRelation
+}
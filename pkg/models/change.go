@@ -0,0 +1,94 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// Change represents a single recorded modification of a persisted entity.
+type Change struct {
+	Bucket   string `validate:"required"`
+	EntityID int
+	// UserID is the ID of the User owning the entity, or 0 if it is public.
+	UserID int
+	// AuthorID is the ID of the User the modification is attributed to, such
+	// as the proposer of an approved Proposal, or 0 if it is not attributed.
+	AuthorID int
+	Action   ChangeAction
+	Meta     db.ModelMetadata
+}
+
+// Metadata returns Meta.
+func (c *Change) Metadata() *db.ModelMetadata {
+	return &c.Meta
+}
+
+// ChangeAction is an enum that describes the kind of modification recorded in
+// a Change.
+type ChangeAction int
+
+const (
+	// ChangeActionCreate means the entity was created.
+	ChangeActionCreate ChangeAction = iota
+	// ChangeActionUpdate means the entity was updated.
+	ChangeActionUpdate
+	// ChangeActionDelete means the entity was deleted.
+	ChangeActionDelete
+)
+
+// IsValid checks if the ChangeAction has a value that is a valid one.
+func (a ChangeAction) IsValid() bool {
+	switch a {
+	case ChangeActionCreate, ChangeActionUpdate, ChangeActionDelete:
+		return true
+	}
+	return false
+}
+
+// String returns the written name of the ChangeAction.
+func (a ChangeAction) String() string {
+	switch a {
+	case ChangeActionCreate:
+		return "Create"
+	case ChangeActionUpdate:
+		return "Update"
+	case ChangeActionDelete:
+		return "Delete"
+	}
+	return fmt.Sprintf("%d", int(a))
+}
+
+// UnmarshalJSON defines custom JSON deserialization for ChangeAction.
+func (a *ChangeAction) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+
+	value, ok := map[string]ChangeAction{
+		"Create": ChangeActionCreate,
+		"Update": ChangeActionUpdate,
+		"Delete": ChangeActionDelete,
+	}[s]
+	if !ok {
+		return fmt.Errorf("invalid value: %q", s)
+	}
+	*a = value
+	return nil
+}
+
+// MarshalJSON defines custom JSON serialization for ChangeAction.
+func (a ChangeAction) MarshalJSON() ([]byte, error) {
+	if !a.IsValid() {
+		return nil, fmt.Errorf("invalid value: %d", a)
+	}
+
+	v, err := json.Marshal(a.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return v, nil
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Birthday is the day of the year a Character was born on, and the year if
+// known.
+type Birthday struct {
+	Month int
+	Day   int
+	Year  *int
+}
+
+// IsValid checks if the Birthday is a day of the calendar. The 29th of
+// February is valid unless the year is given and is not a leap year.
+func (b *Birthday) IsValid() bool {
+	if b.Month < 1 || b.Month > 12 || b.Day < 1 {
+		return false
+	}
+	// 2000 is a leap year
+	year := 2000
+	if b.Year != nil {
+		year = *b.Year
+	}
+	t := time.Date(year, time.Month(b.Month), b.Day, 0, 0, 0, 0, time.UTC)
+	return t.Day() == b.Day
+}
+
+// Roles of Characters in Media.
+const (
+	// CharacterRoleMain means the Character is a protagonist or otherwise
+	// central to the Media.
+	CharacterRoleMain = "Main"
+	// CharacterRoleSupporting means the Character plays a recurring part in
+	// the Media.
+	CharacterRoleSupporting = "Supporting"
+	// CharacterRoleBackground means the Character makes minor appearances in
+	// the Media.
+	CharacterRoleBackground = "Background"
+)
+
+// ParseCharacterRole returns the role of Characters with the given name,
+// ignoring case.
+func ParseCharacterRole(name string) (string, error) {
+	for _, role := range []string{
+		CharacterRoleMain, CharacterRoleSupporting, CharacterRoleBackground,
+	} {
+		if strings.EqualFold(name, role) {
+			return role, nil
+		}
+	}
+	return "", fmt.Errorf("invalid value: %q", name)
+}
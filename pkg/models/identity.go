@@ -0,0 +1,22 @@
+package models
+
+import "github.com/Dophin2009/nao/pkg/db"
+
+// Identity links a User to their account at an external identity provider,
+// through which they may log in.
+type Identity struct {
+	UserID int
+	// Provider is the configured name of the identity provider.
+	Provider string
+	// Issuer and Subject identify the account at the provider.
+	Issuer  string
+	Subject string
+	// Email is the address of the account given by the provider, if any.
+	Email string
+	Meta  db.ModelMetadata
+}
+
+// Metadata returns Meta.
+func (i *Identity) Metadata() *db.ModelMetadata {
+	return &i.Meta
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// ImportRow is an entry of a list imported by a User, staged until it is
+// written to their library.
+type ImportRow struct {
+	UserID int
+	// Row is the position of the entry in the imported list, starting at 1.
+	Row   int
+	Title string
+	// Entry is the entry as imported, encoded in JSON.
+	Entry  []byte `validate:"required"`
+	Status ImportRowStatus
+	// Attempts is the number of times writing the entry was attempted.
+	Attempts int
+	// Error is the error of the last failed attempt.
+	Error string
+	// MediaID is the ID of the Media the entry was matched to, once
+	// imported.
+	MediaID *int
+	// Created is true if a stub Media was created for the entry as no Media
+	// has its title.
+	Created bool
+	Meta    db.ModelMetadata
+}
+
+// Metadata returns Meta.
+func (r *ImportRow) Metadata() *db.ModelMetadata {
+	return &r.Meta
+}
+
+// ImportRowStatus is an enum that describes the stage of a staged
+// ImportRow.
+type ImportRowStatus int
+
+const (
+	// ImportRowStatusPending means the ImportRow awaits being written.
+	ImportRowStatusPending ImportRowStatus = iota
+	// ImportRowStatusImported means the ImportRow was written.
+	ImportRowStatusImported
+	// ImportRowStatusFailed means writing the ImportRow failed, until it is
+	// retried.
+	ImportRowStatusFailed
+)
+
+// IsValid checks if the ImportRowStatus has a value that is a valid one.
+func (s ImportRowStatus) IsValid() bool {
+	switch s {
+	case ImportRowStatusPending, ImportRowStatusImported, ImportRowStatusFailed:
+		return true
+	}
+	return false
+}
+
+// String returns the written name of the ImportRowStatus.
+func (s ImportRowStatus) String() string {
+	switch s {
+	case ImportRowStatusPending:
+		return "Pending"
+	case ImportRowStatusImported:
+		return "Imported"
+	case ImportRowStatusFailed:
+		return "Failed"
+	}
+	return fmt.Sprintf("%d", int(s))
+}
+
+// ParseImportRowStatus returns the ImportRowStatus with the given written
+// name.
+func ParseImportRowStatus(name string) (ImportRowStatus, error) {
+	value, ok := map[string]ImportRowStatus{
+		"Pending":  ImportRowStatusPending,
+		"Imported": ImportRowStatusImported,
+		"Failed":   ImportRowStatusFailed,
+	}[name]
+	if !ok {
+		return ImportRowStatusPending, fmt.Errorf("invalid value: %q", name)
+	}
+	return value, nil
+}
+
+// UnmarshalJSON defines custom JSON deserialization for ImportRowStatus.
+func (s *ImportRowStatus) UnmarshalJSON(data []byte) error {
+	var name string
+	err := json.Unmarshal(data, &name)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+
+	value, err := ParseImportRowStatus(name)
+	if err != nil {
+		return err
+	}
+	*s = value
+	return nil
+}
+
+// MarshalJSON defines custom JSON serialization for ImportRowStatus.
+func (s ImportRowStatus) MarshalJSON() ([]byte, error) {
+	if !s.IsValid() {
+		return nil, fmt.Errorf("invalid value: %d", s)
+	}
+
+	v, err := json.Marshal(s.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return v, nil
+}
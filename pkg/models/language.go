@@ -0,0 +1,240 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrLanguageTag is the error returned for language tags that are not
+// well-formed BCP-47 tags.
+var ErrLanguageTag = errors.New("not a well-formed BCP-47 language tag")
+
+// CanonicalLanguage returns the given BCP-47 language tag in its canonical
+// case, such as "en-US" or "zh-Hant-TW", or an error wrapping ErrLanguageTag
+// if it is not well-formed. Underscores are accepted as separators. An empty
+// tag is returned as is.
+func CanonicalLanguage(tag string) (string, error) {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return "", nil
+	}
+
+	subtags := strings.Split(strings.Replace(tag, "_", "-", -1), "-")
+	for i, s := range subtags {
+		if len(s) < 1 || len(s) > 8 || !isAlphanum(s) {
+			return "", fmt.Errorf("%q: %w", tag, ErrLanguageTag)
+		}
+		subtags[i] = strings.ToLower(s)
+	}
+
+	// Tags of only private use subtags, such as x-klingon
+	if subtags[0] == "x" {
+		if len(subtags) < 2 {
+			return "", fmt.Errorf("%q: %w", tag, ErrLanguageTag)
+		}
+		return strings.Join(subtags, "-"), nil
+	}
+
+	// Primary language subtag, with up to three extended language subtags
+	if !isAlpha(subtags[0]) || len(subtags[0]) < 2 || len(subtags[0]) == 4 {
+		return "", fmt.Errorf("%q: %w", tag, ErrLanguageTag)
+	}
+	i := 1
+	for ext := 0; ext < 3 && i < len(subtags) && len(subtags[0]) <= 3 &&
+		len(subtags[i]) == 3 && isAlpha(subtags[i]); ext++ {
+		i++
+	}
+
+	// Script subtag
+	if i < len(subtags) && len(subtags[i]) == 4 && isAlpha(subtags[i]) {
+		subtags[i] = strings.ToUpper(subtags[i][:1]) + subtags[i][1:]
+		i++
+	}
+
+	// Region subtag
+	if i < len(subtags) {
+		s := subtags[i]
+		if len(s) == 2 && isAlpha(s) {
+			subtags[i] = strings.ToUpper(s)
+			i++
+		} else if len(s) == 3 && isDigits(s) {
+			i++
+		}
+	}
+
+	// Variant subtags
+	for i < len(subtags) {
+		s := subtags[i]
+		if !(len(s) >= 5 || len(s) == 4 && s[0] >= '0' && s[0] <= '9') {
+			break
+		}
+		i++
+	}
+
+	// Extension subtags, each a singleton followed by subtags of two to eight
+	// characters, and private use subtags
+	for i < len(subtags) {
+		if len(subtags[i]) != 1 || i+1 >= len(subtags) {
+			return "", fmt.Errorf("%q: %w", tag, ErrLanguageTag)
+		}
+		if subtags[i] == "x" {
+			i = len(subtags)
+			break
+		}
+		i++
+		n := 0
+		for i < len(subtags) && len(subtags[i]) >= 2 {
+			i++
+			n++
+		}
+		if n == 0 {
+			return "", fmt.Errorf("%q: %w", tag, ErrLanguageTag)
+		}
+	}
+
+	return strings.Join(subtags, "-"), nil
+}
+
+// ParseAcceptLanguage returns the language tags of the given Accept-Language
+// header value, in canonical case, ordered by descending quality. Ranges with
+// zero quality and malformed ones are omitted; the wildcard range "*" is
+// kept.
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag     string
+		quality float64
+	}
+
+	ranges := []weighted{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		tag := strings.TrimSpace(fields[0])
+		if tag == "" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			q, err := strconv.ParseFloat(param[2:], 64)
+			if err != nil || q < 0 || q > 1 {
+				quality = 0
+			} else {
+				quality = q
+			}
+		}
+		if quality == 0 {
+			continue
+		}
+
+		if tag != "*" {
+			var err error
+			tag, err = CanonicalLanguage(tag)
+			if err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, weighted{tag: tag, quality: quality})
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].quality > ranges[j].quality
+	})
+	tags := make([]string, len(ranges))
+	for i, r := range ranges {
+		tags[i] = r.tag
+	}
+	return tags
+}
+
+// MatchLanguage checks if the given language tag matches the given language
+// range, as in RFC 4647 basic filtering: if the range is the tag itself or,
+// ignoring case, a prefix of it ending at a subtag boundary, or the wildcard
+// "*".
+func MatchLanguage(tag string, lrange string) bool {
+	if lrange == "*" {
+		return true
+	}
+	tag, lrange = strings.ToLower(tag), strings.ToLower(lrange)
+	return tag == lrange || strings.HasPrefix(tag, lrange+"-")
+}
+
+// LocalizeTitles returns a copy of the given set of Titles ordered for the
+// given language ranges, as returned by ParseAcceptLanguage: Titles matching
+// earlier ranges first, each range followed by the Titles only sharing its
+// primary language, as "en" does "en-GB", then preferred Titles, then by
+// priority. The order of the set is otherwise kept.
+func LocalizeTitles(set []Title, langs []string) []Title {
+	rank := func(t *Title) int {
+		for i, l := range langs {
+			if MatchLanguage(t.Language, l) {
+				return 2 * i
+			}
+			if l != "*" && MatchLanguage(t.Language, primaryLanguage(l)) {
+				return 2*i + 1
+			}
+		}
+		return 2 * len(langs)
+	}
+
+	titles := make([]Title, len(set))
+	copy(titles, set)
+	sort.SliceStable(titles, func(i, j int) bool {
+		a, b := &titles[i], &titles[j]
+		if ra, rb := rank(a), rank(b); ra != rb {
+			return ra < rb
+		}
+		if a.Preferred != b.Preferred {
+			return a.Preferred
+		}
+		return a.Priority < b.Priority
+	})
+	return titles
+}
+
+// SelectTitle returns the Title of the given set that best matches the given
+// language ranges, as ordered by LocalizeTitles, or nil if the set is empty.
+func SelectTitle(set []Title, langs []string) *Title {
+	if len(set) == 0 {
+		return nil
+	}
+	return &LocalizeTitles(set, langs)[0]
+}
+
+// primaryLanguage returns the primary language subtag of the given tag.
+func primaryLanguage(tag string) string {
+	return strings.SplitN(tag, "-", 2)[0]
+}
+
+func isAlpha(s string) bool {
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlphanum(s string) bool {
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
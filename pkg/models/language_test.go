@@ -0,0 +1,44 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestCanonicalLanguage tests that well-formed language tags are put in
+// canonical case and others refused.
+func TestCanonicalLanguage(t *testing.T) {
+	cases := []struct {
+		tag string
+		res string
+		ok  bool
+	}{
+		{"", "", true},
+		{"EN", "en", true},
+		{"en_us", "en-US", true},
+		{"zh-hant-tw", "zh-Hant-TW", true},
+		{"es-419", "es-419", true},
+		{"sl-rozaj-biske", "sl-rozaj-biske", true},
+		{"de-DE-u-co-phonebk", "de-DE-u-co-phonebk", true},
+		{"x-Klingon", "x-klingon", true},
+		{"english", "english", true},
+		{"e", "", false},
+		{"abcd", "", false},
+		{"en--us", "", false},
+		{"en-US-u", "", false},
+		{"ja-JP!", "", false},
+		{"toolongtag", "", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.tag, func(t *testing.T) {
+			res, err := CanonicalLanguage(tc.tag)
+			if tc.ok && (err != nil || res != tc.res) {
+				t.Errorf("expected %q, got %q, %v", tc.res, res, err)
+			}
+			if !tc.ok && !errors.Is(err, ErrLanguageTag) {
+				t.Errorf("expected error, got %q", res)
+			}
+		})
+	}
+}
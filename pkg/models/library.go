@@ -0,0 +1,115 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// LibraryIssue is an enum that describes a kind of problem found in a User's
+// library of UserMedia.
+type LibraryIssue int
+
+const (
+	// LibraryIssueStale means the UserMedia is being watched but has had no
+	// progress in a long time.
+	LibraryIssueStale LibraryIssue = iota
+	// LibraryIssueMissingScore means the UserMedia has been watched but has
+	// no score.
+	LibraryIssueMissingScore
+	// LibraryIssueMissingFinishDate means the UserMedia is completed but its
+	// last watch has no end date.
+	LibraryIssueMissingFinishDate
+	// LibraryIssueDuplicate means the User has more than one UserMedia for
+	// the same Media.
+	LibraryIssueDuplicate
+	// LibraryIssueOrphaned means the UserMedia is of Media that no longer
+	// exists.
+	LibraryIssueOrphaned
+)
+
+// String returns the written name of the LibraryIssue.
+func (li LibraryIssue) String() string {
+	switch li {
+	case LibraryIssueStale:
+		return "Stale"
+	case LibraryIssueMissingScore:
+		return "MissingScore"
+	case LibraryIssueMissingFinishDate:
+		return "MissingFinishDate"
+	case LibraryIssueDuplicate:
+		return "Duplicate"
+	case LibraryIssueOrphaned:
+		return "Orphaned"
+	}
+	return "Unknown"
+}
+
+// MarshalJSON serializes the LibraryIssue as its written name.
+func (li LibraryIssue) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + li.String() + `"`), nil
+}
+
+// UnmarshalJSON deserializes the LibraryIssue from its written name.
+func (li *LibraryIssue) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+
+	value, ok := map[string]LibraryIssue{
+		"Stale":             LibraryIssueStale,
+		"MissingScore":      LibraryIssueMissingScore,
+		"MissingFinishDate": LibraryIssueMissingFinishDate,
+		"Duplicate":         LibraryIssueDuplicate,
+		"Orphaned":          LibraryIssueOrphaned,
+	}[s]
+	if !ok {
+		return fmt.Errorf("invalid value: %q", s)
+	}
+	*li = value
+	return nil
+}
+
+// LibraryHealth summarizes the problems found in a User's library.
+type LibraryHealth struct {
+	UserID int
+	// Total is the number of UserMedia in the library.
+	Total int
+	// Stale, MissingScore, MissingFinishDate and Orphaned contain the IDs of
+	// the UserMedia with each issue.
+	Stale             []int
+	MissingScore      []int
+	MissingFinishDate []int
+	Orphaned          []int
+	// Duplicates contains groups of IDs of UserMedia for the same Media,
+	// oldest first.
+	Duplicates [][]int
+	Fixes      []LibraryFix
+}
+
+// LibraryFix is a suggested fix for some issue in a User's library, given as
+// an edit to be applied through the bulk-edit endpoint. Fixes without an edit
+// need input from the User.
+type LibraryFix struct {
+	Issue        LibraryIssue
+	Description  string
+	UserMediaIDs []int
+	Edit         *UserMediaEdit
+}
+
+// UserMediaEdit is a change applied to many UserMedia at once. Nil properties
+// are left unchanged.
+type UserMediaEdit struct {
+	Status *WatchStatus
+	Score  *int
+	// FinishDate sets the end date of the last watch of each UserMedia that
+	// has none.
+	FinishDate *time.Time
+	// FillFinishDate sets the end date of the last watch of each UserMedia
+	// that has none to the time of its last update.
+	FillFinishDate bool
+	// Delete deletes the UserMedia instead.
+	Delete bool
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// Lock marks a single entity as being edited by a User, so that other Users
+// may not change it until the Lock is released or expires.
+type Lock struct {
+	// Bucket is the name of the bucket of the entity.
+	Bucket    string `validate:"required"`
+	ModelID   int
+	UserID    int
+	ExpiresAt time.Time
+	Meta      db.ModelMetadata
+}
+
+// Held returns true if the Lock has not expired by the given time.
+func (l *Lock) Held(now time.Time) bool {
+	return now.Before(l.ExpiresAt)
+}
+
+// Metadata returns Meta.
+func (l *Lock) Metadata() *db.ModelMetadata {
+	return &l.Meta
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// LoginSession is a login of a User on some device, which lasts as long as
+// the tokens issued for it are refreshed, until it expires or is revoked.
+type LoginSession struct {
+	UserID int
+	// Device is the name of the device given at login, or its user agent.
+	Device string
+	// IP is the address the session was last used from.
+	IP        string
+	LastUsed  time.Time
+	ExpiresAt time.Time
+	Meta      db.ModelMetadata
+}
+
+// Metadata returns Meta.
+func (ls *LoginSession) Metadata() *db.ModelMetadata {
+	return &ls.Meta
+}
@@ -16,11 +16,55 @@ type Media struct {
 	Synopses        []Title
 	Background      []Title
 	StartDate       *time.Time
-	EndDate         *time.Time
+	EndDate         *time.Time `clean:"after=StartDate"`
 	SeasonPremiered Season
-	Type            *string
-	Source          *string
-	Meta            db.ModelMetadata
+	// ReleaseStatus is derived from StartDate and EndDate if not given.
+	ReleaseStatus *ReleaseStatus
+	// EpisodeCount is the number of Episodes the Media has or is planned to
+	// have, if known.
+	EpisodeCount *int
+	Type         *string
+	Source       *string
+	// Slug is the unique, human-readable handle of the Media used in URLs,
+	// generated from its Titles if not given.
+	Slug string
+	// ExternalID identifies the Media in the catalogue it was imported from,
+	// such as mal:1, so that importers may upsert it; unique among Media if
+	// not empty.
+	ExternalID string
+	// LockedFields names the fields of the Media, of MediaRefreshFields,
+	// that were edited by hand and are kept in refreshes of its metadata
+	// from the catalogue of its ExternalID.
+	LockedFields []string
+	Meta         db.ModelMetadata
+}
+
+// Fields of Media refreshed from the catalogues of their ExternalIDs, by
+// their names in LockedFields.
+const (
+	MediaFieldTitles       = "titles"
+	MediaFieldSynopses     = "synopses"
+	MediaFieldStartDate    = "startDate"
+	MediaFieldEndDate      = "endDate"
+	MediaFieldEpisodeCount = "episodeCount"
+)
+
+// MediaRefreshFields are the fields of Media refreshed from the catalogues of
+// their ExternalIDs.
+var MediaRefreshFields = []string{
+	MediaFieldTitles, MediaFieldSynopses, MediaFieldStartDate,
+	MediaFieldEndDate, MediaFieldEpisodeCount,
+}
+
+// Locked checks if the field of the given name is in the LockedFields of the
+// Media.
+func (m *Media) Locked(field string) bool {
+	for _, f := range m.LockedFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
 }
 
 // Metadata returns Meta.
@@ -28,6 +72,23 @@ func (m *Media) Metadata() *db.ModelMetadata {
 	return &m.Meta
 }
 
+// HasReleaseStatus checks if the Media has any of the given ReleaseStatuses,
+// or if none are given.
+func (m *Media) HasReleaseStatus(statuses ...ReleaseStatus) bool {
+	if len(statuses) == 0 {
+		return true
+	}
+	if m.ReleaseStatus == nil {
+		return false
+	}
+	for _, s := range statuses {
+		if *m.ReleaseStatus == s {
+			return true
+		}
+	}
+	return false
+}
+
 // Season contains information about the quarter and year.
 type Season struct {
 	Quarter *Quarter
@@ -110,7 +171,14 @@ func (q Quarter) MarshalGQL(w io.Writer) {
 type Character struct {
 	Names       []Title
 	Information []Title
-	Meta        db.ModelMetadata
+	Birthday    *Birthday
+	// Images are the URLs of pictures of the Character, the first being
+	// the one to show by default.
+	Images []string `validate:"dive,url"`
+	// Slug is the unique, human-readable handle of the Character used in
+	// URLs, generated from its Names if not given.
+	Slug string
+	Meta db.ModelMetadata
 }
 
 // Metadata returns Meta.
@@ -126,7 +194,10 @@ type Episode struct {
 	Duration *int
 	Filler   bool
 	Recap    bool
-	Meta     db.ModelMetadata
+	// Special is true for episodes outside the regular numbering of the
+	// Media, such as OVAs and extras, which do not count towards progress.
+	Special bool
+	Meta    db.ModelMetadata
 }
 
 // Metadata returns Meta.
@@ -163,7 +234,10 @@ func (g *Genre) Metadata() *db.ModelMetadata {
 type Person struct {
 	Names       []Title
 	Information []Title
-	Meta        db.ModelMetadata
+	// Slug is the unique, human-readable handle of the Person used in URLs,
+	// generated from their Names if not given.
+	Slug string
+	Meta db.ModelMetadata
 }
 
 // Metadata returns Meta.
@@ -174,8 +248,17 @@ func (p *Person) Metadata() *db.ModelMetadata {
 // Producer represents a single studio, producer, licensor, etc.
 type Producer struct {
 	Titles []Title
-	Types  []string
-	Meta   db.ModelMetadata
+	Types  []string `clean:"line"`
+	// Aliases are other names the Producer is known by, such as
+	// abbreviations and former names.
+	Aliases []string `validate:"dive,required" clean:"line"`
+	Founded *time.Time
+	// Defunct is when the Producer ceased operation; nil if still active.
+	Defunct *time.Time `clean:"after=Founded"`
+	// Slug is the unique, human-readable handle of the Producer used in
+	// URLs, generated from its Titles if not given.
+	Slug string
+	Meta db.ModelMetadata
 }
 
 // Metadata return Meta.
@@ -217,7 +300,7 @@ func (mg *MediaGenre) Metadata() *db.ModelMetadata {
 type MediaProducer struct {
 	MediaID    int
 	ProducerID int
-	Role       string
+	Role       string `clean:"line"`
 	Meta       db.ModelMetadata
 }
 
@@ -226,12 +309,47 @@ func (mp *MediaProducer) Metadata() *db.ModelMetadata {
 	return &mp.Meta
 }
 
+// MediaStaff represents a credit of a Person on a Media, such as director or
+// composer. The credit covers the episodes from FirstEpisode to LastEpisode,
+// either end being open if nil, and all of the Media if both are nil.
+type MediaStaff struct {
+	MediaID      int
+	PersonID     int
+	Role         string `validate:"required,max=255" clean:"line"`
+	FirstEpisode *int
+	LastEpisode  *int
+	Meta         db.ModelMetadata
+}
+
+// Metadata returns Meta.
+func (ms *MediaStaff) Metadata() *db.ModelMetadata {
+	return &ms.Meta
+}
+
+// ProducerStaff represents a relationship between single instances of
+// Producer and Person, the Person having held the Role at the Producer from
+// StartDate to EndDate. Either date is nil if unknown, and EndDate is nil
+// while the Person still holds the Role.
+type ProducerStaff struct {
+	ProducerID int
+	PersonID   int
+	Role       string `validate:"required,max=255" clean:"line"`
+	StartDate  *time.Time
+	EndDate    *time.Time `clean:"after=StartDate"`
+	Meta       db.ModelMetadata
+}
+
+// Metadata returns Meta.
+func (ps *ProducerStaff) Metadata() *db.ModelMetadata {
+	return &ps.Meta
+}
+
 // MediaRelation represents a relationship between single instances of Media
 // and Producer.
 type MediaRelation struct {
 	OwnerID      int
 	RelatedID    int
-	Relationship string
+	Relationship MediaRelationship
 	Meta         db.ModelMetadata
 }
 
@@ -246,7 +364,16 @@ type User struct {
 	Email       string
 	Password    []byte
 	Permissions UserPermission
-	Meta        db.ModelMetadata
+	// Disabled Users may not authenticate.
+	Disabled bool
+	// Privacy sets who other than the User may view their data.
+	Privacy PrivacySettings
+	// ScoreFormat is the scale the User gives and reads scores in.
+	ScoreFormat ScoreFormat
+	// CustomStatuses are the statuses the User defined for their UserMedia
+	// beyond the WatchStatus enum.
+	CustomStatuses []CustomStatus
+	Meta           db.ModelMetadata
 }
 
 // Metadata returns Meta.
@@ -254,6 +381,18 @@ func (u *User) Metadata() *db.ModelMetadata {
 	return &u.Meta
 }
 
+// UserFollow represents a User following the activity of another User.
+type UserFollow struct {
+	FollowerID int
+	FolloweeID int
+	Meta       db.ModelMetadata
+}
+
+// Metadata returns Meta.
+func (uf *UserFollow) Metadata() *db.ModelMetadata {
+	return &uf.Meta
+}
+
 // UserPermission contains a number of permissions for users for
 // reading/writing data.
 type UserPermission struct {
@@ -279,12 +418,21 @@ func (uc *UserCharacter) Metadata() *db.ModelMetadata {
 }
 
 // UserEpisode represents a relationship between a User and an Episode,
-// containing information about the User's opinion on the Episode.
+// containing information about the User's opinion on the Episode and whether
+// they have watched it.
 type UserEpisode struct {
 	UserID    int
 	EpisodeID int
 	Score     *int
 	Comments  []Title
+	// Watched is true if the User has watched the Episode. FirstWatched and
+	// LastWatched are the times it was first and last watched.
+	Watched      bool
+	FirstWatched *time.Time
+	LastWatched  *time.Time
+	// Rewatches is the number of times the Episode was watched again after
+	// it was first watched.
+	Rewatches int
 	Meta      db.ModelMetadata
 }
 
@@ -294,17 +442,27 @@ func (uep *UserEpisode) Metadata() *db.ModelMetadata {
 }
 
 // UserMedia represents a relationship between a User and a Media, containing
-// information about the User's opinion on the Media.
+// information about the User's opinion on the Media. The Score is stored on a
+// scale of 0 to ScoreMax.
 type UserMedia struct {
-	UserID         int
-	MediaID        int
-	Priority       *int
-	Score          *int
-	Recommended    *int
-	Status         *WatchStatus
+	UserID      int
+	MediaID     int
+	Priority    *int
+	Score       *int
+	Recommended *int
+	Status      *WatchStatus
+	// CustomStatus is the Key of the CustomStatus of the User the UserMedia
+	// has, if any, in which case Status is the WatchStatus it maps to.
+	// Changing Status alone, as clients that know only the WatchStatus enum
+	// do, clears it.
+	CustomStatus   *string
 	WatchInstances []WatchedInstance
-	Comments       []Title
-	Meta           db.ModelMetadata
+	// RewatchCount is the number of rewatches of the Media started, the
+	// highest Rewatch of WatchInstances. It is derived as the UserMedia is
+	// persisted, regardless of the given value.
+	RewatchCount int
+	Comments     []Title
+	Meta         db.ModelMetadata
 }
 
 // Metadata returns Meta
@@ -314,10 +472,19 @@ func (um *UserMedia) Metadata() *db.ModelMetadata {
 
 // WatchedInstance contains information about a single watch of some Media.
 type WatchedInstance struct {
-	Episodes  int
-	Ongoing   bool
+	// Episodes is the number of regular episodes watched.
+	Episodes int
+	// Specials contains the IDs of the special Episodes watched, as they are
+	// not numbered in sequence.
+	Specials []int
+	Ongoing  bool
+	// Rewatch is the number of the rewatch of the Media that the watch is
+	// part of, starting at 1, or 0 if it is part of the first watch. A
+	// rewatch may span several instances, as watches are split by gaps in
+	// their progress.
+	Rewatch   int
 	StartDate *time.Time
-	EndDate   *time.Time
+	EndDate   *time.Time `clean:"after=StartDate"`
 	Comments  []Title
 }
 
@@ -346,6 +513,16 @@ const (
 	WatchStatusHold
 )
 
+// IsValid checks if the WatchStatus has a value that is a valid one.
+func (ws WatchStatus) IsValid() bool {
+	switch ws {
+	case WatchStatusCurrent, WatchStatusCompleted, WatchStatusPlanning,
+		WatchStatusDropped, WatchStatusHold:
+		return true
+	}
+	return false
+}
+
 // UnmarshalJSON defines custom JSON deserialization for WatchStatus.
 func (ws *WatchStatus) UnmarshalJSON(data []byte) error {
 	var s string
@@ -355,6 +532,7 @@ func (ws *WatchStatus) UnmarshalJSON(data []byte) error {
 	}
 
 	value, ok := map[string]WatchStatus{
+		"Current":   WatchStatusCurrent,
 		"Completed": WatchStatusCompleted,
 		"Planning":  WatchStatusPlanning,
 		"Dropped":   WatchStatusDropped,
@@ -370,6 +548,7 @@ func (ws *WatchStatus) UnmarshalJSON(data []byte) error {
 // MarshalJSON defines custom JSON serialization for WatchStatus.
 func (ws *WatchStatus) MarshalJSON() ([]byte, error) {
 	value, ok := map[WatchStatus]string{
+		WatchStatusCurrent:   "Current",
 		WatchStatusCompleted: "Completed",
 		WatchStatusPlanning:  "Planning",
 		WatchStatusDropped:   "Dropped",
@@ -392,8 +571,16 @@ type UserMediaList struct {
 	UserID       int
 	Names        []Title
 	Descriptions []Title
-	UserMedia    []int
-	Meta         db.ModelMetadata
+	// UserMedia are the IDs of the entries of the list in their manual order:
+	// the entries in no section first, then those of each section in the
+	// order of Sections.
+	UserMedia []int
+	// Sections are the User-defined sections of the list, in order.
+	Sections []UserMediaListSection
+	// EntrySections maps the IDs of the entries in sections to the IDs of
+	// their sections.
+	EntrySections map[int]int
+	Meta          db.ModelMetadata
 }
 
 // Metadata returns Meta.
@@ -401,6 +588,27 @@ func (uml *UserMediaList) Metadata() *db.ModelMetadata {
 	return &uml.Meta
 }
 
+// UserMediaListSection is a User-defined header grouping entries of a
+// UserMediaList.
+type UserMediaListSection struct {
+	// ID identifies the section within its UserMediaList. Sections given
+	// without an ID are assigned one.
+	ID    int
+	Names []Title
+}
+
+// UserMediaListMove moves an entry of a UserMediaList to a position in one of
+// its sections.
+type UserMediaListMove struct {
+	UserMediaID int
+	// SectionID is the ID of the section to move the entry into, or nil to
+	// move it out of any section.
+	SectionID *int
+	// Position is the index of the entry among the entries of the section
+	// after the move. Positions past the end place the entry last.
+	Position int
+}
+
 // UserPerson represents a relationship between a User and a Person,
 // containing information about the User's opinion on the Person.
 type UserPerson struct {
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// Name indexes the ID of a single Media, Person or Character by the keys of
+// its titles or names, normalized and romanized for search.
+type Name struct {
+	// Bucket is the name of the bucket of the entity.
+	Bucket  string `validate:"required"`
+	ModelID int
+	Keys    []string `validate:"required"`
+	Meta    db.ModelMetadata
+}
+
+// Metadata returns Meta.
+func (n *Name) Metadata() *db.ModelMetadata {
+	return &n.Meta
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// Notification represents a single entry of the inbox of a User, such as the
+// airing of a new Episode of some Media they follow.
+type Notification struct {
+	UserID int
+	Kind   NotificationKind
+	// MediaID is the Media the notification is about, if any.
+	MediaID *int
+	// EpisodeID is the Episode aired in NotificationEpisodeAired
+	// notifications.
+	EpisodeID *int
+	// ActorID is the followed User and ActivityID their Activity in
+	// NotificationFriendActivity notifications; the Activity may since have
+	// been dropped from their feed.
+	ActorID    *int
+	ActivityID *int
+	Read       bool
+	Meta       db.ModelMetadata
+}
+
+// Metadata returns Meta.
+func (n *Notification) Metadata() *db.ModelMetadata {
+	return &n.Meta
+}
+
+// NotificationKind is an enum that describes the kind of event a
+// Notification is about.
+type NotificationKind int
+
+const (
+	// NotificationEpisodeAired means a new Episode of some Media the User is
+	// watching or planning to watch has aired.
+	NotificationEpisodeAired NotificationKind = iota
+	// NotificationFriendActivity means a User followed by the User has a new
+	// Activity.
+	NotificationFriendActivity
+)
+
+// IsValid checks if the NotificationKind has a value that is a valid one.
+func (k NotificationKind) IsValid() bool {
+	switch k {
+	case NotificationEpisodeAired, NotificationFriendActivity:
+		return true
+	}
+	return false
+}
+
+// String returns the written name of the NotificationKind.
+func (k NotificationKind) String() string {
+	switch k {
+	case NotificationEpisodeAired:
+		return "EpisodeAired"
+	case NotificationFriendActivity:
+		return "FriendActivity"
+	}
+	return fmt.Sprintf("%d", int(k))
+}
+
+// UnmarshalJSON defines custom JSON deserialization for NotificationKind.
+func (k *NotificationKind) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+
+	value, ok := map[string]NotificationKind{
+		"EpisodeAired":   NotificationEpisodeAired,
+		"FriendActivity": NotificationFriendActivity,
+	}[s]
+	if !ok {
+		return fmt.Errorf("invalid value: %q", s)
+	}
+	*k = value
+	return nil
+}
+
+// MarshalJSON defines custom JSON serialization for NotificationKind.
+func (k NotificationKind) MarshalJSON() ([]byte, error) {
+	if !k.IsValid() {
+		return nil, fmt.Errorf("invalid value: %d", k)
+	}
+
+	v, err := json.Marshal(k.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return v, nil
+}
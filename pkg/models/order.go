@@ -0,0 +1,35 @@
+package models
+
+import (
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// MediaOrder is a view of all Media sorted by a single key, such as their
+// StartDate, kept sorted as they change so that they may be listed in order
+// without loading every Media.
+type MediaOrder struct {
+	// Name identifies the key, such as startDate, score or title:en.
+	Name string
+	// Entries are the Media with a key, sorted by key and then by ID.
+	Entries []MediaOrderEntry
+	// Unkeyed are the IDs of the Media without a key, in ascending order.
+	Unkeyed []int
+	Meta    db.ModelMetadata
+}
+
+// Metadata returns Meta.
+func (o *MediaOrder) Metadata() *db.ModelMetadata {
+	return &o.Meta
+}
+
+// Len returns the number of Media in the MediaOrder.
+func (o *MediaOrder) Len() int {
+	return len(o.Entries) + len(o.Unkeyed)
+}
+
+// MediaOrderEntry is a single Media of a MediaOrder along with its key, which
+// sorts as strings do.
+type MediaOrderEntry struct {
+	MediaID int
+	Key     string
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// PersistedQuery is a GraphQL query document stored by the SHA-256 hash
+// clients send in its place.
+type PersistedQuery struct {
+	// Hash is the hex-encoded SHA-256 hash of Query.
+	Hash  string
+	Query string `validate:"required" clean:"-"`
+	// Registered is true if the query was registered by an Admin, and so is
+	// allowed when only registered queries are.
+	Registered bool
+	Meta       db.ModelMetadata
+}
+
+// Metadata returns Meta.
+func (pq *PersistedQuery) Metadata() *db.ModelMetadata {
+	return &pq.Meta
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Visibility is an enum that describes who may view some data of a User.
+type Visibility int
+
+const (
+	// VisibilityPrivate means only the User and Admins may view the data.
+	VisibilityPrivate Visibility = iota
+	// VisibilityUsers means all authenticated Users may view the data.
+	VisibilityUsers
+	// VisibilityPublic means anyone may view the data.
+	VisibilityPublic
+)
+
+// IsValid checks if the Visibility has a value that is a valid one.
+func (v Visibility) IsValid() bool {
+	switch v {
+	case VisibilityPrivate, VisibilityUsers, VisibilityPublic:
+		return true
+	}
+	return false
+}
+
+// String returns the written name of the Visibility.
+func (v Visibility) String() string {
+	switch v {
+	case VisibilityPrivate:
+		return "Private"
+	case VisibilityUsers:
+		return "Users"
+	case VisibilityPublic:
+		return "Public"
+	}
+	return fmt.Sprintf("%d", int(v))
+}
+
+// Allows returns true if a caller with the given Role may view data with the
+// Visibility. Owners and Admins are not checked here; they may always view
+// the data.
+func (v Visibility) Allows(role Role) bool {
+	switch v {
+	case VisibilityPublic:
+		return true
+	case VisibilityUsers:
+		return role.Includes(RoleUser)
+	}
+	return false
+}
+
+// UnmarshalJSON defines custom JSON deserialization for Visibility.
+func (v *Visibility) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+
+	value, ok := map[string]Visibility{
+		"Private": VisibilityPrivate,
+		"Users":   VisibilityUsers,
+		"Public":  VisibilityPublic,
+	}[s]
+	if !ok {
+		return fmt.Errorf("invalid value: %q", s)
+	}
+	*v = value
+	return nil
+}
+
+// MarshalJSON defines custom JSON serialization for Visibility.
+func (v Visibility) MarshalJSON() ([]byte, error) {
+	if !v.IsValid() {
+		return nil, fmt.Errorf("invalid value: %d", v)
+	}
+	return json.Marshal(v.String())
+}
+
+// PrivacySettings contains the Visibility of each kind of data of a User. The
+// zero value keeps everything private.
+type PrivacySettings struct {
+	// Profile is the Visibility of the username and other account details.
+	Profile Visibility
+	// Lists is the Visibility of the UserMedia and UserMediaLists.
+	Lists Visibility
+	// Stats is the Visibility of the statistics derived from the UserMedia,
+	// such as library health.
+	Stats Visibility
+}
+
+// PrivacyScope is an enum that describes a kind of data of a User whose
+// Visibility is set in PrivacySettings.
+type PrivacyScope int
+
+const (
+	// PrivacyProfile is the scope of the account details.
+	PrivacyProfile PrivacyScope = iota
+	// PrivacyLists is the scope of the UserMedia and UserMediaLists.
+	PrivacyLists
+	// PrivacyStats is the scope of the statistics derived from the
+	// UserMedia.
+	PrivacyStats
+)
+
+// Of returns the Visibility of the data of the given scope.
+func (p *PrivacySettings) Of(scope PrivacyScope) Visibility {
+	switch scope {
+	case PrivacyProfile:
+		return p.Profile
+	case PrivacyLists:
+		return p.Lists
+	case PrivacyStats:
+		return p.Stats
+	}
+	return VisibilityPrivate
+}
+
+// IsValid checks if all the Visibilities of the settings are valid ones.
+func (p *PrivacySettings) IsValid() bool {
+	return p.Profile.IsValid() && p.Lists.IsValid() && p.Stats.IsValid()
+}
+
+// UserProfile is the view of a User given to other callers.
+type UserProfile struct {
+	ID       int
+	Username string
+}
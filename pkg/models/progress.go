@@ -0,0 +1,41 @@
+package models
+
+import "strings"
+
+// MediaTypeMovie is the Media type of movies, which consist of a single unit
+// regardless of their Episodes.
+const MediaTypeMovie = "Movie"
+
+// IsSingleUnit returns true if the Media is watched as a single unit rather
+// than episode by episode.
+func (m *Media) IsSingleUnit() bool {
+	return m.Type != nil && strings.EqualFold(*m.Type, MediaTypeMovie)
+}
+
+// Progress describes how far a User is through the latest watch of some
+// Media.
+type Progress struct {
+	// Watched is the number of regular units watched, and Total is the number
+	// of regular units of the Media, or 0 if unknown.
+	Watched int
+	Total   int
+	// Specials is the number of special Episodes watched, and TotalSpecials is
+	// the number of special Episodes of the Media.
+	Specials      int
+	TotalSpecials int
+	// SingleUnit is true if the Media is watched as a single unit, in which
+	// case Total is 1.
+	SingleUnit bool
+	Completed  bool
+}
+
+// ContinueWatching is an entry of the Media a User is in the middle of
+// watching.
+type ContinueWatching struct {
+	UserMedia *UserMedia
+	Media     *Media
+	Progress  *Progress
+	// Next is the next regular Episode to watch, or nil if unknown or if the
+	// Media is a single unit.
+	Next *Episode
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// Proposal is a change to a Media proposed by a User who may not edit Media
+// themselves, applied once approved by a Moderator.
+type Proposal struct {
+	MediaID int
+	// UserID is the ID of the User who proposed the change.
+	UserID int
+	// Patch is the JSON Merge Patch (RFC 7396) of the Media.
+	Patch   json.RawMessage `validate:"required"`
+	Comment string          `validate:"max=1000"`
+	Status  ProposalStatus
+	// ReviewerID is the ID of the Moderator that approved or rejected the
+	// Proposal, if reviewed.
+	ReviewerID *int
+	Meta       db.ModelMetadata
+}
+
+// Metadata returns Meta.
+func (p *Proposal) Metadata() *db.ModelMetadata {
+	return &p.Meta
+}
+
+// ProposalStatus is an enum that describes the stage of a Proposal in the
+// review workflow.
+type ProposalStatus int
+
+const (
+	// ProposalStatusPending means the Proposal awaits a Moderator.
+	ProposalStatusPending ProposalStatus = iota
+	// ProposalStatusApproved means a Moderator applied the Proposal.
+	ProposalStatusApproved
+	// ProposalStatusRejected means a Moderator declined the Proposal.
+	ProposalStatusRejected
+)
+
+// IsValid checks if the ProposalStatus has a value that is a valid one.
+func (s ProposalStatus) IsValid() bool {
+	switch s {
+	case ProposalStatusPending, ProposalStatusApproved, ProposalStatusRejected:
+		return true
+	}
+	return false
+}
+
+// String returns the written name of the ProposalStatus.
+func (s ProposalStatus) String() string {
+	switch s {
+	case ProposalStatusPending:
+		return "Pending"
+	case ProposalStatusApproved:
+		return "Approved"
+	case ProposalStatusRejected:
+		return "Rejected"
+	}
+	return fmt.Sprintf("%d", int(s))
+}
+
+// ParseProposalStatus returns the ProposalStatus with the given written name.
+func ParseProposalStatus(name string) (ProposalStatus, error) {
+	value, ok := map[string]ProposalStatus{
+		"Pending":  ProposalStatusPending,
+		"Approved": ProposalStatusApproved,
+		"Rejected": ProposalStatusRejected,
+	}[name]
+	if !ok {
+		return ProposalStatusPending, fmt.Errorf("invalid value: %q", name)
+	}
+	return value, nil
+}
+
+// UnmarshalJSON defines custom JSON deserialization for ProposalStatus.
+func (s *ProposalStatus) UnmarshalJSON(data []byte) error {
+	var name string
+	err := json.Unmarshal(data, &name)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+
+	value, err := ParseProposalStatus(name)
+	if err != nil {
+		return err
+	}
+	*s = value
+	return nil
+}
+
+// MarshalJSON defines custom JSON serialization for ProposalStatus.
+func (s ProposalStatus) MarshalJSON() ([]byte, error) {
+	if !s.IsValid() {
+		return nil, fmt.Errorf("invalid value: %d", s)
+	}
+
+	v, err := json.Marshal(s.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return v, nil
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MediaRelationship is an enum that describes how the related Media of a
+// MediaRelation relates to the owning Media. Its values are stored by name so
+// that records written before it was an enum still decode.
+type MediaRelationship string
+
+const (
+	// MediaRelationshipSequel means the related Media continues the story of
+	// the owning Media.
+	MediaRelationshipSequel MediaRelationship = "Sequel"
+	// MediaRelationshipPrequel means the related Media precedes the story of
+	// the owning Media.
+	MediaRelationshipPrequel MediaRelationship = "Prequel"
+	// MediaRelationshipSideStory means the related Media tells a story aside
+	// from that of the owning Media.
+	MediaRelationshipSideStory MediaRelationship = "SideStory"
+	// MediaRelationshipParentStory means the owning Media tells a story aside
+	// from that of the related Media.
+	MediaRelationshipParentStory MediaRelationship = "ParentStory"
+	// MediaRelationshipAdaptation means the related Media adapts the owning
+	// Media.
+	MediaRelationshipAdaptation MediaRelationship = "Adaptation"
+	// MediaRelationshipSource means the owning Media adapts the related Media.
+	MediaRelationshipSource MediaRelationship = "Source"
+	// MediaRelationshipAltVersion means the related Media retells the story
+	// of the owning Media.
+	MediaRelationshipAltVersion MediaRelationship = "AltVersion"
+	// MediaRelationshipCharacter means the related Media shares Characters
+	// with the owning Media.
+	MediaRelationshipCharacter MediaRelationship = "Character"
+	// MediaRelationshipOther means the Media are related in some other way.
+	MediaRelationshipOther MediaRelationship = "Other"
+)
+
+// MediaRelationships are all the valid MediaRelationships.
+var MediaRelationships = []MediaRelationship{
+	MediaRelationshipSequel, MediaRelationshipPrequel, MediaRelationshipSideStory,
+	MediaRelationshipParentStory, MediaRelationshipAdaptation, MediaRelationshipSource,
+	MediaRelationshipAltVersion, MediaRelationshipCharacter, MediaRelationshipOther,
+}
+
+// mediaRelationshipNames maps the names of MediaRelationships, in lower case
+// and without separators, to their values.
+var mediaRelationshipNames = map[string]MediaRelationship{
+	"sequel":             MediaRelationshipSequel,
+	"prequel":            MediaRelationshipPrequel,
+	"sidestory":          MediaRelationshipSideStory,
+	"side":               MediaRelationshipSideStory,
+	"parentstory":        MediaRelationshipParentStory,
+	"parent":             MediaRelationshipParentStory,
+	"adaptation":         MediaRelationshipAdaptation,
+	"source":             MediaRelationshipSource,
+	"original":           MediaRelationshipSource,
+	"altversion":         MediaRelationshipAltVersion,
+	"alternativeversion": MediaRelationshipAltVersion,
+	"alternative":        MediaRelationshipAltVersion,
+	"character":          MediaRelationshipCharacter,
+	"other":              MediaRelationshipOther,
+}
+
+// IsValid checks if the MediaRelationship has a value that is a valid one.
+func (r MediaRelationship) IsValid() bool {
+	for _, v := range MediaRelationships {
+		if r == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Inverse returns the MediaRelationship of the owning Media to the related
+// Media, such as Prequel for Sequel.
+func (r MediaRelationship) Inverse() MediaRelationship {
+	switch r {
+	case MediaRelationshipSequel:
+		return MediaRelationshipPrequel
+	case MediaRelationshipPrequel:
+		return MediaRelationshipSequel
+	case MediaRelationshipSideStory:
+		return MediaRelationshipParentStory
+	case MediaRelationshipParentStory:
+		return MediaRelationshipSideStory
+	case MediaRelationshipAdaptation:
+		return MediaRelationshipSource
+	case MediaRelationshipSource:
+		return MediaRelationshipAdaptation
+	}
+	return r
+}
+
+// ParseMediaRelationship returns the MediaRelationship with the given name,
+// ignoring case, spaces, hyphens and underscores, so that "Side Story" and
+// "SIDE_STORY" are both SideStory.
+func ParseMediaRelationship(name string) (MediaRelationship, error) {
+	key := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '_':
+			return -1
+		}
+		return r
+	}, strings.ToLower(name))
+
+	value, ok := mediaRelationshipNames[key]
+	if !ok {
+		return "", fmt.Errorf("invalid value: %q", name)
+	}
+	return value, nil
+}
+
+// UnmarshalJSON defines custom JSON deserialization for MediaRelationship.
+// Names are parsed with ParseMediaRelationship, and those of no
+// MediaRelationship are kept as is to be rejected on validation.
+func (r *MediaRelationship) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+
+	value, err := ParseMediaRelationship(s)
+	if err != nil {
+		value = MediaRelationship(s)
+	}
+	*r = value
+	return nil
+}
+
+// UnmarshalGQL casts the type of the given value to a MediaRelationship.
+func (r *MediaRelationship) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("invalid value: %v", v)
+	}
+
+	value := MediaRelationship(str)
+	if !value.IsValid() {
+		return fmt.Errorf("invalid value: %s", str)
+	}
+	*r = value
+	return nil
+}
+
+// MarshalGQL serializes the MediaRelationship into a GraphQL readable form.
+func (r MediaRelationship) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(string(r)))
+}
@@ -0,0 +1,171 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// ReleaseStatus is an enum that describes the state of the release of a
+// Media.
+type ReleaseStatus int
+
+const (
+	// ReleaseStatusNotYetReleased means the Media has been announced but not
+	// released.
+	ReleaseStatusNotYetReleased ReleaseStatus = iota + 1
+	// ReleaseStatusReleasing means the Media is being released, such as a
+	// series airing weekly.
+	ReleaseStatusReleasing
+	// ReleaseStatusFinished means all of the Media has been released.
+	ReleaseStatusFinished
+	// ReleaseStatusCancelled means the release of the Media was stopped for
+	// good.
+	ReleaseStatusCancelled
+	// ReleaseStatusHiatus means the release of the Media is paused, to be
+	// resumed.
+	ReleaseStatusHiatus
+)
+
+// ReleaseStatuses are all the ReleaseStatuses, in order of the lifecycle.
+var ReleaseStatuses = []ReleaseStatus{
+	ReleaseStatusNotYetReleased,
+	ReleaseStatusReleasing,
+	ReleaseStatusHiatus,
+	ReleaseStatusFinished,
+	ReleaseStatusCancelled,
+}
+
+// IsValid checks if the ReleaseStatus has a value that is a valid one.
+func (s ReleaseStatus) IsValid() bool {
+	switch s {
+	case ReleaseStatusNotYetReleased, ReleaseStatusReleasing,
+		ReleaseStatusFinished, ReleaseStatusCancelled, ReleaseStatusHiatus:
+		return true
+	}
+	return false
+}
+
+// CanBecome checks if a Media of the ReleaseStatus may change to the given
+// one. Media not yet released may be released, all at once or not, or be
+// cancelled; Media being released may finish, pause or be cancelled, and
+// paused Media may resume, finish or be cancelled. Finished and cancelled
+// Media stay so.
+func (s ReleaseStatus) CanBecome(to ReleaseStatus) bool {
+	if s == to {
+		return true
+	}
+	switch s {
+	case ReleaseStatusNotYetReleased:
+		return to == ReleaseStatusReleasing || to == ReleaseStatusFinished ||
+			to == ReleaseStatusCancelled
+	case ReleaseStatusReleasing:
+		return to == ReleaseStatusFinished || to == ReleaseStatusHiatus ||
+			to == ReleaseStatusCancelled
+	case ReleaseStatusHiatus:
+		return to == ReleaseStatusReleasing || to == ReleaseStatusFinished ||
+			to == ReleaseStatusCancelled
+	}
+	return false
+}
+
+// DeriveReleaseStatus returns the ReleaseStatus of a Media released from the
+// given start to the given end date at the given time, or nil if it cannot
+// be told without the start date.
+func DeriveReleaseStatus(start, end *time.Time, now time.Time) *ReleaseStatus {
+	var s ReleaseStatus
+	switch {
+	case start == nil:
+		return nil
+	case now.Before(*start):
+		s = ReleaseStatusNotYetReleased
+	case end != nil && !now.Before(*end):
+		s = ReleaseStatusFinished
+	default:
+		s = ReleaseStatusReleasing
+	}
+	return &s
+}
+
+// String returns the written name of the ReleaseStatus.
+func (s ReleaseStatus) String() string {
+	switch s {
+	case ReleaseStatusNotYetReleased:
+		return "NotYetReleased"
+	case ReleaseStatusReleasing:
+		return "Releasing"
+	case ReleaseStatusFinished:
+		return "Finished"
+	case ReleaseStatusCancelled:
+		return "Cancelled"
+	case ReleaseStatusHiatus:
+		return "Hiatus"
+	}
+	return fmt.Sprintf("%d", int(s))
+}
+
+// ParseReleaseStatus returns the ReleaseStatus with the given written name.
+func ParseReleaseStatus(name string) (ReleaseStatus, error) {
+	value, ok := map[string]ReleaseStatus{
+		"NotYetReleased": ReleaseStatusNotYetReleased,
+		"Releasing":      ReleaseStatusReleasing,
+		"Finished":       ReleaseStatusFinished,
+		"Cancelled":      ReleaseStatusCancelled,
+		"Hiatus":         ReleaseStatusHiatus,
+	}[name]
+	if !ok {
+		return 0, fmt.Errorf("invalid value: %q", name)
+	}
+	return value, nil
+}
+
+// UnmarshalJSON defines custom JSON deserialization for ReleaseStatus.
+func (s *ReleaseStatus) UnmarshalJSON(data []byte) error {
+	var name string
+	err := json.Unmarshal(data, &name)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+
+	value, err := ParseReleaseStatus(name)
+	if err != nil {
+		return err
+	}
+	*s = value
+	return nil
+}
+
+// MarshalJSON defines custom JSON serialization for ReleaseStatus.
+func (s ReleaseStatus) MarshalJSON() ([]byte, error) {
+	if !s.IsValid() {
+		return nil, fmt.Errorf("invalid value: %d", s)
+	}
+
+	v, err := json.Marshal(s.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return v, nil
+}
+
+// UnmarshalGQL casts the type of the given value to a ReleaseStatus.
+func (s *ReleaseStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("invalid value: %v", v)
+	}
+
+	value, err := ParseReleaseStatus(str)
+	if err != nil {
+		return err
+	}
+	*s = value
+	return nil
+}
+
+// MarshalGQL serializes the ReleaseStatus into a GraphQL readable form.
+func (s ReleaseStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(s.String()))
+}
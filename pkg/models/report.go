@@ -0,0 +1,170 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// Report represents a User's report of some content to the moderators.
+type Report struct {
+	ReporterID int
+	Target     ReportTarget
+	TargetID   int
+	Reason     string `validate:"required"`
+	Status     ReportStatus
+	// ResolverID is the ID of the Moderator that resolved the Report, if
+	// resolved.
+	ResolverID *int
+	Meta       db.ModelMetadata
+}
+
+// Metadata returns Meta.
+func (r *Report) Metadata() *db.ModelMetadata {
+	return &r.Meta
+}
+
+// ReportTarget is an enum that describes the kind of content reported.
+type ReportTarget int
+
+const (
+	// ReportTargetReview means a Review was reported.
+	ReportTargetReview ReportTarget = iota
+	// ReportTargetComment means a Comment was reported.
+	ReportTargetComment
+	// ReportTargetMedia means a Media entry was reported.
+	ReportTargetMedia
+)
+
+// IsValid checks if the ReportTarget has a value that is a valid one.
+func (t ReportTarget) IsValid() bool {
+	switch t {
+	case ReportTargetReview, ReportTargetComment, ReportTargetMedia:
+		return true
+	}
+	return false
+}
+
+// String returns the written name of the ReportTarget.
+func (t ReportTarget) String() string {
+	switch t {
+	case ReportTargetReview:
+		return "Review"
+	case ReportTargetComment:
+		return "Comment"
+	case ReportTargetMedia:
+		return "Media"
+	}
+	return fmt.Sprintf("%d", int(t))
+}
+
+// UnmarshalJSON defines custom JSON deserialization for ReportTarget.
+func (t *ReportTarget) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+
+	value, ok := map[string]ReportTarget{
+		"Review":  ReportTargetReview,
+		"Comment": ReportTargetComment,
+		"Media":   ReportTargetMedia,
+	}[s]
+	if !ok {
+		return fmt.Errorf("invalid value: %q", s)
+	}
+	*t = value
+	return nil
+}
+
+// MarshalJSON defines custom JSON serialization for ReportTarget.
+func (t ReportTarget) MarshalJSON() ([]byte, error) {
+	if !t.IsValid() {
+		return nil, fmt.Errorf("invalid value: %d", t)
+	}
+
+	v, err := json.Marshal(t.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return v, nil
+}
+
+// ReportStatus is an enum that describes the stage of a Report in the
+// moderation workflow.
+type ReportStatus int
+
+const (
+	// ReportStatusOpen means the Report awaits a Moderator.
+	ReportStatusOpen ReportStatus = iota
+	// ReportStatusReviewed means a Moderator found no action necessary.
+	ReportStatusReviewed
+	// ReportStatusActioned means a Moderator acted on the reported content.
+	ReportStatusActioned
+)
+
+// IsValid checks if the ReportStatus has a value that is a valid one.
+func (s ReportStatus) IsValid() bool {
+	switch s {
+	case ReportStatusOpen, ReportStatusReviewed, ReportStatusActioned:
+		return true
+	}
+	return false
+}
+
+// String returns the written name of the ReportStatus.
+func (s ReportStatus) String() string {
+	switch s {
+	case ReportStatusOpen:
+		return "Open"
+	case ReportStatusReviewed:
+		return "Reviewed"
+	case ReportStatusActioned:
+		return "Actioned"
+	}
+	return fmt.Sprintf("%d", int(s))
+}
+
+// ParseReportStatus returns the ReportStatus with the given written name.
+func ParseReportStatus(name string) (ReportStatus, error) {
+	value, ok := map[string]ReportStatus{
+		"Open":     ReportStatusOpen,
+		"Reviewed": ReportStatusReviewed,
+		"Actioned": ReportStatusActioned,
+	}[name]
+	if !ok {
+		return ReportStatusOpen, fmt.Errorf("invalid value: %q", name)
+	}
+	return value, nil
+}
+
+// UnmarshalJSON defines custom JSON deserialization for ReportStatus.
+func (s *ReportStatus) UnmarshalJSON(data []byte) error {
+	var name string
+	err := json.Unmarshal(data, &name)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+
+	value, err := ParseReportStatus(name)
+	if err != nil {
+		return err
+	}
+	*s = value
+	return nil
+}
+
+// MarshalJSON defines custom JSON serialization for ReportStatus.
+func (s ReportStatus) MarshalJSON() ([]byte, error) {
+	if !s.IsValid() {
+		return nil, fmt.Errorf("invalid value: %d", s)
+	}
+
+	v, err := json.Marshal(s.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return v, nil
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// PasswordReset is a pending request of a User to reset their password,
+// redeemed with a token sent to them.
+type PasswordReset struct {
+	UserID int
+	// TokenHash is the SHA-256 hash of the token; the token itself is not
+	// stored.
+	TokenHash []byte `validate:"required"`
+	ExpiresAt time.Time
+	Meta      db.ModelMetadata
+}
+
+// Metadata returns Meta.
+func (pr *PasswordReset) Metadata() *db.ModelMetadata {
+	return &pr.Meta
+}
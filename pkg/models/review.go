@@ -0,0 +1,46 @@
+package models
+
+import "github.com/Dophin2009/nao/pkg/db"
+
+// Review represents a User's written review of a Media. Each User may review
+// a Media once.
+type Review struct {
+	UserID  int
+	MediaID int
+	Body    string `validate:"required"`
+	Score   *int
+	// Spoiler marks reviews that reveal the plot of the Media.
+	Spoiler bool
+	// Flagged marks reviews reported by Users for moderation.
+	Flagged bool
+	// Hidden reviews have been hidden by a Moderator and are only visible to
+	// Moderators and their User.
+	Hidden bool
+	Meta   db.ModelMetadata
+}
+
+// Metadata returns Meta.
+func (r *Review) Metadata() *db.ModelMetadata {
+	return &r.Meta
+}
+
+// Comment represents a User's comment on a Review, or a reply to another
+// Comment on the same Review.
+type Comment struct {
+	UserID   int
+	ReviewID int
+	// ParentID is the ID of the Comment replied to, if any.
+	ParentID *int
+	Body     string `validate:"required"`
+	// Flagged marks comments reported by Users for moderation.
+	Flagged bool
+	// Hidden comments have been hidden by a Moderator and are only visible to
+	// Moderators and their User.
+	Hidden bool
+	Meta   db.ModelMetadata
+}
+
+// Metadata returns Meta.
+func (c *Comment) Metadata() *db.ModelMetadata {
+	return &c.Meta
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Role is an enum that describes the level of access of an API caller. Each
+// Role includes all the access of the Roles before it.
+type Role int
+
+const (
+	// RoleAnonymous is the Role of unauthenticated callers.
+	RoleAnonymous Role = iota
+	// RoleUser is the Role of authenticated Users without any global
+	// permissions.
+	RoleUser
+	// RoleModerator is the Role of Users allowed to modify global Media data.
+	RoleModerator
+	// RoleAdmin is the Role of Users allowed to modify all User data.
+	RoleAdmin
+)
+
+// IsValid checks if the Role has a value that is a valid one.
+func (r Role) IsValid() bool {
+	switch r {
+	case RoleAnonymous, RoleUser, RoleModerator, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// String returns the written name of the Role.
+func (r Role) String() string {
+	switch r {
+	case RoleAnonymous:
+		return "Anonymous"
+	case RoleUser:
+		return "User"
+	case RoleModerator:
+		return "Moderator"
+	case RoleAdmin:
+		return "Admin"
+	}
+	return fmt.Sprintf("%d", int(r))
+}
+
+// Includes returns true if the Role has at least the access of the given
+// Role.
+func (r Role) Includes(o Role) bool {
+	return r >= o
+}
+
+// UnmarshalGQL casts the type of the given value to a Role.
+func (r *Role) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("invalid value: %v", v)
+	}
+
+	switch str {
+	case "Anonymous":
+		*r = RoleAnonymous
+	case "User":
+		*r = RoleUser
+	case "Moderator":
+		*r = RoleModerator
+	case "Admin":
+		*r = RoleAdmin
+	default:
+		return fmt.Errorf("invalid value: %q", str)
+	}
+	return nil
+}
+
+// MarshalGQL serializes the Role into a GraphQL readable form.
+func (r Role) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(r.String()))
+}
+
+// Role returns the Role granted by the permissions.
+func (p *UserPermission) Role() Role {
+	switch {
+	case p.WriteUsers:
+		return RoleAdmin
+	case p.WriteMedia:
+		return RoleModerator
+	}
+	return RoleUser
+}
+
+// RolePermission returns the permissions that grant the given Role.
+func RolePermission(r Role) (UserPermission, error) {
+	switch r {
+	case RoleUser:
+		return UserPermission{}, nil
+	case RoleModerator:
+		return UserPermission{WriteMedia: true}, nil
+	case RoleAdmin:
+		return UserPermission{WriteMedia: true, WriteUsers: true}, nil
+	}
+	return UserPermission{}, fmt.Errorf("role %s: not grantable to Users", r)
+}
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ScoreMax is the highest score stored in UserMedia; scores are stored on a
+// scale of 0 to ScoreMax regardless of the ScoreFormat of their User.
+const ScoreMax = 100
+
+// ScoreFormat is an enum that describes the scale a User gives and reads
+// scores in.
+type ScoreFormat int
+
+const (
+	// ScoreFormatPoint100 means scores from 0 to 100, as stored.
+	ScoreFormatPoint100 ScoreFormat = iota
+	// ScoreFormatPoint10 means scores from 0 to 10.
+	ScoreFormatPoint10
+	// ScoreFormatStar5 means ratings from 0 to 5 stars.
+	ScoreFormatStar5
+)
+
+// IsValid checks if the ScoreFormat has a value that is a valid one.
+func (f ScoreFormat) IsValid() bool {
+	switch f {
+	case ScoreFormatPoint100, ScoreFormatPoint10, ScoreFormatStar5:
+		return true
+	}
+	return false
+}
+
+// String returns the written name of the ScoreFormat.
+func (f ScoreFormat) String() string {
+	switch f {
+	case ScoreFormatPoint100:
+		return "Point100"
+	case ScoreFormatPoint10:
+		return "Point10"
+	case ScoreFormatStar5:
+		return "Star5"
+	}
+	return fmt.Sprintf("%d", int(f))
+}
+
+// Max returns the highest score in the ScoreFormat.
+func (f ScoreFormat) Max() int {
+	switch f {
+	case ScoreFormatPoint10:
+		return 10
+	case ScoreFormatStar5:
+		return 5
+	}
+	return ScoreMax
+}
+
+// Normalize converts the given score in the ScoreFormat to the stored scale.
+// It returns an error if the score is out of the range of the ScoreFormat.
+func (f ScoreFormat) Normalize(score *int) (*int, error) {
+	if score == nil {
+		return nil, nil
+	}
+
+	max := f.Max()
+	if *score < 0 || *score > max {
+		return nil, fmt.Errorf("score %d: must be between 0 and %d", *score, max)
+	}
+	n := *score * ScoreMax / max
+	return &n, nil
+}
+
+// Display converts the given stored score to the ScoreFormat, rounding to
+// the nearest score of the format.
+func (f ScoreFormat) Display(score *int) *int {
+	if score == nil {
+		return nil
+	}
+
+	max := f.Max()
+	d := (*score*max + ScoreMax/2) / ScoreMax
+	return &d
+}
+
+// parseScoreFormat returns the ScoreFormat with the given written name.
+func parseScoreFormat(name string) (ScoreFormat, error) {
+	value, ok := map[string]ScoreFormat{
+		"Point100": ScoreFormatPoint100,
+		"Point10":  ScoreFormatPoint10,
+		"Star5":    ScoreFormatStar5,
+	}[name]
+	if !ok {
+		return ScoreFormatPoint100, fmt.Errorf("invalid value: %q", name)
+	}
+	return value, nil
+}
+
+// UnmarshalJSON defines custom JSON deserialization for ScoreFormat.
+func (f *ScoreFormat) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+
+	value, err := parseScoreFormat(s)
+	if err != nil {
+		return err
+	}
+	*f = value
+	return nil
+}
+
+// MarshalJSON defines custom JSON serialization for ScoreFormat.
+func (f ScoreFormat) MarshalJSON() ([]byte, error) {
+	if !f.IsValid() {
+		return nil, fmt.Errorf("invalid value: %d", f)
+	}
+
+	v, err := json.Marshal(f.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return v, nil
+}
+
+// UnmarshalGQL casts the type of the given value to a ScoreFormat.
+func (f *ScoreFormat) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("invalid value: %v", v)
+	}
+
+	value, err := parseScoreFormat(str)
+	if err != nil {
+		return err
+	}
+	*f = value
+	return nil
+}
+
+// MarshalGQL serializes the ScoreFormat into a GraphQL readable form.
+func (f ScoreFormat) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(f.String()))
+}
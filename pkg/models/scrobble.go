@@ -0,0 +1,108 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Scrobble is a playback event reported by a media player, describing the
+// progress of a User through some Media at some point in time. Scrobbles are
+// not persisted; they are stitched into the WatchedInstances of the User's
+// UserMedia.
+type Scrobble struct {
+	UserID  int
+	MediaID int
+	// Episodes is the number of regular episodes of the Media watched so far.
+	Episodes int
+	// EpisodeID is the ID of the Episode played, if known. Events of special
+	// Episodes do not count towards the regular episodes watched.
+	EpisodeID *int
+	// Completed is true if the playback reached the end of the Media.
+	Completed bool
+	Time      time.Time
+}
+
+// PlaybackEvent is an event of the playback of some Episode of some Media
+// reported by a media player, such as starting or finishing it. Events are
+// converted into Scrobbles.
+type PlaybackEvent struct {
+	UserID  int
+	MediaID int
+	Kind    PlaybackEventKind
+	// Episode is the number of the regular Episode played, starting at 1, and
+	// EpisodeID is its ID; either may be given. Both may be omitted for Media
+	// watched as a single unit.
+	Episode   *int
+	EpisodeID *int
+	Time      time.Time
+}
+
+// PlaybackEventKind is an enum that describes what happened in the playback
+// of an Episode.
+type PlaybackEventKind int
+
+const (
+	// PlaybackEventStarted means the Episode started playing.
+	PlaybackEventStarted PlaybackEventKind = iota
+	// PlaybackEventPaused means the playback of the Episode was paused or
+	// stopped before its end.
+	PlaybackEventPaused
+	// PlaybackEventFinished means the Episode was played to its end.
+	PlaybackEventFinished
+)
+
+// IsValid checks if the PlaybackEventKind has a value that is a valid one.
+func (k PlaybackEventKind) IsValid() bool {
+	switch k {
+	case PlaybackEventStarted, PlaybackEventPaused, PlaybackEventFinished:
+		return true
+	}
+	return false
+}
+
+// String returns the written name of the PlaybackEventKind.
+func (k PlaybackEventKind) String() string {
+	switch k {
+	case PlaybackEventStarted:
+		return "Started"
+	case PlaybackEventPaused:
+		return "Paused"
+	case PlaybackEventFinished:
+		return "Finished"
+	}
+	return fmt.Sprintf("%d", int(k))
+}
+
+// UnmarshalJSON defines custom JSON deserialization for PlaybackEventKind.
+func (k *PlaybackEventKind) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+
+	value, ok := map[string]PlaybackEventKind{
+		"Started":  PlaybackEventStarted,
+		"Paused":   PlaybackEventPaused,
+		"Finished": PlaybackEventFinished,
+	}[s]
+	if !ok {
+		return fmt.Errorf("invalid value: %q", s)
+	}
+	*k = value
+	return nil
+}
+
+// MarshalJSON defines custom JSON serialization for PlaybackEventKind.
+func (k PlaybackEventKind) MarshalJSON() ([]byte, error) {
+	if !k.IsValid() {
+		return nil, fmt.Errorf("invalid value: %d", k)
+	}
+
+	v, err := json.Marshal(k.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return v, nil
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// MediaSeason indexes the Media that premiered in a single season.
+type MediaSeason struct {
+	Year     int
+	Quarter  Quarter
+	MediaIDs []int
+	Meta     db.ModelMetadata
+}
+
+// Metadata returns Meta.
+func (s *MediaSeason) Metadata() *db.ModelMetadata {
+	return &s.Meta
+}
+
+// MediaStats are the statistics of a Media over the libraries of all Users.
+type MediaStats struct {
+	// Popularity is the number of Users with the Media in their library.
+	Popularity int
+	// Score is the mean score given to the Media, on the stored scale, or nil
+	// if no User scored it.
+	Score *int
+}
+
+// SeasonEntry is a single Media of a season chart.
+type SeasonEntry struct {
+	Media *Media
+	Stats MediaStats
+}
+
+// MediaSort is an enum that describes the order of a list of Media.
+type MediaSort int
+
+const (
+	// MediaSortPopularity means the Media in the most libraries come first.
+	MediaSortPopularity MediaSort = iota
+	// MediaSortScore means the Media with the highest mean score come first.
+	MediaSortScore
+)
+
+// IsValid checks if the MediaSort has a value that is a valid one.
+func (s MediaSort) IsValid() bool {
+	switch s {
+	case MediaSortPopularity, MediaSortScore:
+		return true
+	}
+	return false
+}
+
+// String returns the written name of the MediaSort.
+func (s MediaSort) String() string {
+	switch s {
+	case MediaSortPopularity:
+		return "Popularity"
+	case MediaSortScore:
+		return "Score"
+	}
+	return fmt.Sprintf("%d", int(s))
+}
+
+// ParseMediaSort returns the MediaSort with the given written name.
+func ParseMediaSort(name string) (MediaSort, error) {
+	value, ok := map[string]MediaSort{
+		"Popularity": MediaSortPopularity,
+		"Score":      MediaSortScore,
+	}[name]
+	if !ok {
+		return MediaSortPopularity, fmt.Errorf("invalid value: %q", name)
+	}
+	return value, nil
+}
+
+// UnmarshalJSON defines custom JSON deserialization for MediaSort.
+func (s *MediaSort) UnmarshalJSON(data []byte) error {
+	var str string
+	err := json.Unmarshal(data, &str)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+
+	value, err := ParseMediaSort(str)
+	if err != nil {
+		return err
+	}
+	*s = value
+	return nil
+}
+
+// MarshalJSON defines custom JSON serialization for MediaSort.
+func (s MediaSort) MarshalJSON() ([]byte, error) {
+	if !s.IsValid() {
+		return nil, fmt.Errorf("invalid value: %d", s)
+	}
+
+	v, err := json.Marshal(s.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return v, nil
+}
+
+// UnmarshalGQL casts the type of the given value to a MediaSort.
+func (s *MediaSort) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("invalid value: %v", v)
+	}
+
+	value, err := ParseMediaSort(str)
+	if err != nil {
+		return err
+	}
+	*s = value
+	return nil
+}
+
+// MarshalGQL serializes the MediaSort into a GraphQL readable form.
+func (s MediaSort) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(s.String()))
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// ProgressReport is a report by a User of having watched some Episode of some
+// Media at some point in time. Reports are converted into Scrobbles and
+// recorded in WatchSessions.
+type ProgressReport struct {
+	UserID  int
+	MediaID int
+	// EpisodeID is the ID of the Episode watched; it may be omitted for Media
+	// watched as a single unit.
+	EpisodeID *int
+	Time      time.Time
+}
+
+// WatchSession represents a period in which a User continuously watched some
+// Media, as recorded from the progress they reported.
+type WatchSession struct {
+	UserID      int
+	MediaID     int
+	UserMediaID int
+	// Start and End are the times of the first and last reports in the
+	// session.
+	Start time.Time
+	End   time.Time `clean:"after=Start"`
+	// Episodes are the IDs of the Episodes reported in the session, in order
+	// of report.
+	Episodes []int
+	// Reports is the number of reports recorded in the session.
+	Reports int
+	Meta    db.ModelMetadata
+}
+
+// Metadata returns Meta.
+func (ws *WatchSession) Metadata() *db.ModelMetadata {
+	return &ws.Meta
+}
+
+// Duration returns the time between the first and last reports in the
+// session.
+func (ws *WatchSession) Duration() time.Duration {
+	return ws.End.Sub(ws.Start)
+}
+
+// EpisodeMark marks Episodes of some Media watched by some User at some point
+// in time.
+type EpisodeMark struct {
+	UserID  int
+	MediaID int
+	// UpTo marks the first UpTo regular Episodes of the Media watched; those
+	// already watched are kept as they are.
+	UpTo int
+	// EpisodeIDs are the IDs of further Episodes of the Media marked watched,
+	// regular or special; those already watched count as rewatched.
+	EpisodeIDs []int
+	Time       time.Time
+}
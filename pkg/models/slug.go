@@ -0,0 +1,20 @@
+package models
+
+import (
+	"github.com/Dophin2009/nao/pkg/db"
+)
+
+// Slug indexes the ID of a single entity by its Slug, unique among those of
+// its type.
+type Slug struct {
+	// Bucket is the name of the bucket of the entity.
+	Bucket  string
+	Slug    string
+	ModelID int
+	Meta    db.ModelMetadata
+}
+
+// Metadata returns Meta.
+func (s *Slug) Metadata() *db.ModelMetadata {
+	return &s.Meta
+}
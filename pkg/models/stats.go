@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Heatmap is the number of Episodes a User watched on each day of a year.
+type Heatmap struct {
+	UserID int
+	Year   int
+	// Days contains every day of the year in order, including those on which
+	// nothing was watched.
+	Days []HeatmapDay
+	// Episodes is the number of Episodes watched in the year.
+	Episodes int
+}
+
+// HeatmapDay is the number of Episodes a User watched on a single day.
+type HeatmapDay struct {
+	// Date is the start of the day.
+	Date     time.Time
+	Episodes int
+}
+
+// Wrapup summarizes the watching of a User over a year.
+type Wrapup struct {
+	UserID int
+	Year   int
+	// Episodes is the number of Episodes watched in the year, and Media the
+	// number of different Media they were of.
+	Episodes int
+	Media    int
+	// Hours is the time spent watching in the year, and RewatchHours the part
+	// of it spent rewatching Media.
+	Hours        float64
+	RewatchHours float64
+	// LongestStreak is the longest run of consecutive days on which something
+	// was watched.
+	LongestStreak Streak
+	// TopGenres are the Genres of the most Episodes watched, most first.
+	TopGenres []GenreCount
+}
+
+// Streak is a run of consecutive days on which a User watched something.
+// Start and End are the starts of its first and last days, and are zero if
+// Days is 0.
+type Streak struct {
+	Days  int
+	Start time.Time
+	End   time.Time
+}
+
+// GenreCount is the number of Episodes a User watched of Media of a single
+// Genre.
+type GenreCount struct {
+	GenreID  int
+	Episodes int
+}
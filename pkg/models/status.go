@@ -0,0 +1,49 @@
+package models
+
+import "regexp"
+
+// MaxCustomStatuses is the number of CustomStatuses a User may define.
+const MaxCustomStatuses = 32
+
+var (
+	customStatusKeyRegexp   = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	customStatusColorRegexp = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+// CustomStatus is a status a User defines for their UserMedia beyond the
+// WatchStatus enum, such as "Paused" or "Rewatching". Each maps to a core
+// WatchStatus, which UserMedia of the custom status have as their Status, so
+// that clients that know only the enum still understand them.
+type CustomStatus struct {
+	// Key identifies the status among those of its User, and is referenced
+	// by UserMedia. It consists of lower case letters and digits, separated by
+	// single hyphens, such as "paused".
+	Key   string
+	Label string
+	// Color is the color the status is shown in, as a hex triplet such as
+	// "#ff8800", or empty.
+	Color  string
+	Status WatchStatus
+}
+
+// IsValidKey checks if the Key of the CustomStatus is well-formed.
+func (cs *CustomStatus) IsValidKey() bool {
+	return customStatusKeyRegexp.MatchString(cs.Key)
+}
+
+// IsValidColor checks if the Color of the CustomStatus is empty or a hex
+// triplet.
+func (cs *CustomStatus) IsValidColor() bool {
+	return cs.Color == "" || customStatusColorRegexp.MatchString(cs.Color)
+}
+
+// CustomStatus returns the CustomStatus of the User with the given key, or nil
+// if there is none.
+func (u *User) CustomStatus(key string) *CustomStatus {
+	for i := range u.CustomStatuses {
+		if u.CustomStatuses[i].Key == key {
+			return &u.CustomStatuses[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SyncChange is a change made by a client to its local copy of an entity of
+// its User, pushed to the server to be applied.
+type SyncChange struct {
+	// Type is the type of the entity, such as "UserMedia".
+	Type string
+	// ID is the ID of the entity; it is ignored for creations.
+	ID     int
+	Action ChangeAction
+	// BaseVersion is the version of the entity the change was made to; it is
+	// ignored for creations.
+	BaseVersion int
+	// Entity is the changed entity; it is ignored for deletions.
+	Entity json.RawMessage
+}
+
+// SyncApplied is a SyncChange that was applied.
+type SyncApplied struct {
+	// Index is the position of the change in the pushed batch.
+	Index int
+	ID    int
+	// Version is the version of the entity after the change, which later
+	// changes to it are based on.
+	Version int
+}
+
+// SyncConflict is a SyncChange that was not applied because the entity was
+// changed on the server since the version the change was based on.
+type SyncConflict struct {
+	// Index is the position of the change in the pushed batch.
+	Index  int
+	Change *SyncChange
+	// Server is the entity as it is on the server, or null if it was deleted.
+	Server json.RawMessage
+	// Version is the version of the entity on the server.
+	Version int
+	Deleted bool
+}
+
+// SyncRejected is a SyncChange that was not applied because it is not valid.
+type SyncRejected struct {
+	// Index is the position of the change in the pushed batch.
+	Index int
+	Error string
+}
+
+// SyncResult is the outcome of a pushed batch of SyncChanges. Each change is
+// in exactly one of its lists.
+type SyncResult struct {
+	Applied   []*SyncApplied
+	Conflicts []*SyncConflict
+	Rejected  []*SyncRejected
+}
+
+// SyncEntity is the state on the server of an entity changed since a client
+// last synced. Deleted entities are tombstones without the entity.
+type SyncEntity struct {
+	Type      string
+	ID        int
+	Action    ChangeAction
+	ChangedAt time.Time
+	Deleted   bool
+	// Entity is the entity as it is on the server, or null if it was
+	// deleted.
+	Entity json.RawMessage
+}
+
+// SyncPull is the set of entities of a User changed since a client last
+// synced.
+type SyncPull struct {
+	Since    *time.Time
+	Entities []*SyncEntity
+	// Next is the time to pull changes since on the next sync.
+	Next time.Time
+	// More is true if there are more changes to pull since Next.
+	More bool
+}
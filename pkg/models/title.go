@@ -7,11 +7,13 @@ import (
 )
 
 // Title is a language-specific string used as a name or descriptor in other
-// models.
+// models. Language is a BCP-47 language tag.
 type Title struct {
 	String   string
-	Language string
+	Language string `validate:"lang"`
 	Priority TitlePriority
+	// Preferred marks the Title shown first among those in its language.
+	Preferred bool
 }
 
 // TitlePriority is an enum that describes the priority of a Title within a set
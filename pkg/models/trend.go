@@ -0,0 +1,14 @@
+package models
+
+// Trend is the recent activity of Users on a single Media.
+type Trend struct {
+	MediaID int
+	// Score weighs the events counted below by their kind and recency.
+	Score float64
+	// Adds is the number of libraries the Media was added to, Completions the
+	// number of times it was completed, and Scores the number of times it was
+	// given a new score.
+	Adds        int
+	Completions int
+	Scores      int
+}
@@ -0,0 +1,340 @@
+// Package server provides the naos API server for embedding in other Go
+// programs, which may serve routes of their own alongside it.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/Dophin2009/nao/internal/graphql"
+	"github.com/Dophin2009/nao/internal/naos"
+	"github.com/Dophin2009/nao/internal/web"
+	"github.com/Dophin2009/nao/pkg/db"
+	log "github.com/sirupsen/logrus"
+)
+
+// Config is the configuration of a Server.
+type Config = naos.Configuration
+
+// TenantConfig is the configuration of a tenant of a Server.
+type TenantConfig = naos.TenantConfig
+
+// Handler is a single HTTP request handler registered with a Server.
+type Handler = web.Handler
+
+// DataService is the data layer of a Server.
+type DataService = graphql.DataService
+
+// PanicReporter reports the panics recovered from the handlers of a Server.
+type PanicReporter = web.PanicReporter
+
+// Panic is a panic recovered from the handler of a request.
+type Panic = web.Panic
+
+// ReadConfig returns the configuration read from the standard configuration
+// directories, as used by the naos command.
+func ReadConfig() (*Config, error) {
+	return naos.ReadConfigs()
+}
+
+// Server is an embeddable naos API server, serving the HTTP API and the gRPC
+// API, if configured, and running the configured background schedulers.
+type Server struct {
+	config *Config
+	app    *naos.Application
+
+	mu      sync.Mutex
+	started bool
+	http    *http.Server
+}
+
+// New opens the database given in the configuration and returns a Server
+// for it, which is not yet started.
+func New(c *Config) (*Server, error) {
+	app, err := naos.NewApplication(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize application: %w", err)
+	}
+	return &Server{config: c, app: app}, nil
+}
+
+// RegisterHandler registers the given handler with the server alongside
+// those of the API, under the same API versions. Handlers must be registered
+// before the server is started.
+func (s *Server) RegisterHandler(h Handler) {
+	s.app.Server.RegisterHandler(h)
+}
+
+// DataService returns the data layer of the server, for use in the handlers
+// registered.
+func (s *Server) DataService() *DataService {
+	return s.app.DataLayer
+}
+
+// Lifecycle returns the registry of hooks called on the lifecycle events of
+// the entities of the default database, such as for custom validation or
+// integrations. Hooks must be registered before the server is started.
+func (s *Server) Lifecycle() *db.Lifecycle {
+	return s.app.DataLayer.Lifecycle
+}
+
+// ReportPanics reports the panics recovered from the handlers of the default
+// database to the given PanicReporter, such as an error tracking service,
+// instead of the one in the configuration. It must be called before the
+// server is started.
+func (s *Server) ReportPanics(r PanicReporter) {
+	s.app.Server.PanicReporter = r
+}
+
+// ServeFrontend serves the static frontend in the given filesystem, such as
+// http.FS of an embedded one, alongside the API, as for frontend.dir in the
+// configuration, whose other frontend properties apply. It must be called
+// before the server is started.
+func (s *Server) ServeFrontend(fs http.FileSystem) {
+	fc := s.config.Frontend
+	s.app.Server.Frontend = &web.Frontend{FS: fs, Exclude: fc.Exclude, MaxAge: fc.MaxAge}
+}
+
+// HTTPHandler returns the HTTP handler of the API, for serving it from a
+// http.Server of the caller's own instead of starting the server.
+func (s *Server) HTTPHandler() http.Handler {
+	return s.app.HTTPServer().Handler
+}
+
+// Start starts the background schedulers and begins serving the HTTP API
+// and gRPC API, if configured, returning once their addresses are listened
+// on. The HTTP API is served on a Unix domain socket or a socket passed by
+// systemd instead of a TCP address if so configured.
+func (s *Server) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return errors.New("server already started")
+	}
+
+	err := s.startSchedulers()
+	if err != nil {
+		s.stopSchedulers()
+		return err
+	}
+
+	srv := s.app.HTTPServer()
+	lis, err := naos.Listen(s.config)
+	if err != nil {
+		s.stopSchedulers()
+		return fmt.Errorf("failed to listen for HTTP: %w", err)
+	}
+	s.http = &srv
+	go func() {
+		log.WithFields(log.Fields{
+			"network": lis.Addr().Network(),
+			"address": lis.Addr().String(),
+		}).Info("Launching server")
+		err := s.http.Serve(lis)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("Failed to serve HTTP: %v", err)
+		}
+	}()
+
+	// Launch gRPC server on its own port
+	if s.app.GRPCServer != nil {
+		glis, err := net.Listen("tcp", s.app.GRPCAddress)
+		if err != nil {
+			s.http.Close()
+			s.stopSchedulers()
+			return fmt.Errorf("failed to listen for gRPC: %w", err)
+		}
+		go func() {
+			log.WithFields(log.Fields{
+				"address": s.app.GRPCAddress,
+			}).Info("Launching gRPC server")
+			err := s.app.GRPCServer.Serve(glis)
+			if err != nil {
+				log.Errorf("Failed to serve gRPC: %v", err)
+			}
+		}()
+	}
+
+	s.started = true
+	return nil
+}
+
+// Shutdown stops serving the APIs, waiting for the requests in progress
+// until the given context is done, stops the background schedulers, and
+// closes the scripts and databases.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var first error
+	keep := func(err error) {
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	if s.started {
+		err := s.http.Shutdown(ctx)
+		if err != nil {
+			keep(fmt.Errorf("failed to shut down HTTP server: %w", err))
+		}
+		if s.app.GRPCServer != nil {
+			s.app.GRPCServer.GracefulStop()
+		}
+		s.stopSchedulers()
+		s.started = false
+	}
+
+	s.app.Scripts.Close()
+	err := s.app.Tenants.Close()
+	if err != nil {
+		keep(err)
+	}
+	err = s.app.DataLayer.Database.Close()
+	if err != nil {
+		keep(fmt.Errorf("failed to close database: %w", err))
+	}
+	return first
+}
+
+// startSchedulers starts the configured background schedulers.
+func (s *Server) startSchedulers() error {
+	app := s.app
+
+	// Begin writing periodic database snapshots
+	if app.Snapshots != nil {
+		err := app.Snapshots.Start()
+		if err != nil {
+			return fmt.Errorf("failed to start database snapshots: %w", err)
+		}
+		log.WithFields(log.Fields{
+			"interval": app.Snapshots.Config.Interval,
+			"dir":      app.Snapshots.Config.Dir,
+		}).Info("Scheduled database snapshots")
+	}
+
+	// Begin notifying Users of aired Episodes
+	if app.Airing != nil {
+		err := app.Airing.Start()
+		if err != nil {
+			return fmt.Errorf("failed to start airing notifications: %w", err)
+		}
+		log.WithFields(log.Fields{
+			"interval": app.Airing.Interval,
+		}).Info("Scheduled airing notifications")
+	}
+
+	// Begin exporting traces of the requests served
+	if app.Tracer != nil {
+		err := app.Tracer.Start()
+		if err != nil {
+			return fmt.Errorf("failed to start tracing: %w", err)
+		}
+		log.WithFields(log.Fields{
+			"endpoint": s.config.Tracing.Endpoint,
+		}).Info("Started tracing")
+	}
+
+	// Begin recomputing the trending Media
+	if app.Trending != nil {
+		err := app.Trending.Start()
+		if err != nil {
+			return fmt.Errorf("failed to start trending Media: %w", err)
+		}
+		log.WithFields(log.Fields{
+			"interval": app.Trending.Interval,
+		}).Info("Scheduled trending Media")
+	}
+
+	// Begin refreshing the metadata of Media from external catalogues
+	if app.Refresh != nil {
+		err := app.Refresh.Start()
+		if err != nil {
+			return fmt.Errorf("failed to start metadata refresh: %w", err)
+		}
+		log.WithFields(log.Fields{
+			"interval": app.Refresh.Interval,
+		}).Info("Scheduled metadata refresh")
+	}
+
+	// Begin sending queued email messages
+	if app.Mail != nil {
+		err := app.Mail.Start()
+		if err != nil {
+			return fmt.Errorf("failed to start mail queue: %w", err)
+		}
+		log.Info("Started mail queue")
+	}
+
+	// Begin replicating the primary of a follower
+	if app.Replication != nil {
+		err := app.Replication.Start()
+		if err != nil {
+			return fmt.Errorf("failed to start replication: %w", err)
+		}
+		log.WithFields(log.Fields{
+			"primary":  app.Replication.Primary,
+			"interval": app.Replication.Interval,
+		}).Info("Started replication")
+	}
+
+	// Begin emailing Users digests of aired Episodes
+	if app.Digests != nil {
+		err := app.Digests.Start()
+		if err != nil {
+			return fmt.Errorf("failed to start airing digests: %w", err)
+		}
+		log.WithFields(log.Fields{
+			"interval": app.Digests.Interval,
+		}).Info("Scheduled airing digests")
+	}
+
+	// Begin writing the staged entries of list imports
+	if app.ImportQueue != nil {
+		err := app.ImportQueue.Start()
+		if err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"interval":  app.ImportQueue.Interval,
+			"batchsize": app.ImportQueue.BatchSize,
+		}).Info("Scheduled list imports")
+	}
+	return nil
+}
+
+// stopSchedulers stops the background schedulers, in the reverse order they
+// are started in.
+func (s *Server) stopSchedulers() {
+	app := s.app
+	if app.ImportQueue != nil {
+		app.ImportQueue.Stop()
+	}
+	if app.Digests != nil {
+		app.Digests.Stop()
+	}
+	if app.Replication != nil {
+		app.Replication.Stop()
+	}
+	if app.Mail != nil {
+		app.Mail.Stop()
+	}
+	if app.Refresh != nil {
+		app.Refresh.Stop()
+	}
+	if app.Trending != nil {
+		app.Trending.Stop()
+	}
+	if app.Tracer != nil {
+		app.Tracer.Stop()
+	}
+	if app.Airing != nil {
+		app.Airing.Stop()
+	}
+	if app.Snapshots != nil {
+		app.Snapshots.Stop()
+	}
+}